@@ -3,19 +3,30 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
 	"gpt-load/internal/config"
 	db "gpt-load/internal/db/migrations"
+	"gpt-load/internal/hosthealth"
 	"gpt-load/internal/keypool"
+	"gpt-load/internal/middleware"
 	"gpt-load/internal/models"
+	"gpt-load/internal/notify"
 	"gpt-load/internal/proxy"
+	appruntime "gpt-load/internal/runtime"
 	"gpt-load/internal/services"
+	"gpt-load/internal/siem"
 	"gpt-load/internal/store"
 	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
 	"gpt-load/internal/version"
 
 	"github.com/gin-gonic/gin"
@@ -29,15 +40,32 @@ type App struct {
 	engine            *gin.Engine
 	configManager     types.ConfigManager
 	settingsManager   *config.SystemSettingsManager
+	featureFlags      *config.FeatureFlagManager
 	groupManager      *services.GroupManager
 	logCleanupService *services.LogCleanupService
 	requestLogService *services.RequestLogService
+	statsCounter      *services.StatsCounterService
+	goroutinePool     *appruntime.GoroutinePool
+	eventExporter     *services.ClickHouseExporter
+	recordings        *services.RecordingService
+	keySync           *services.KeySyncService
+	groupDeletion     *services.GroupDeletionService
+	logPartitions     *services.RequestLogPartitionService
+	payloadOffload    *services.PayloadOffloadService
+	geoRouting        *services.GeoRoutingService
 	cronChecker       *keypool.CronChecker
 	keyPoolProvider   *keypool.KeyProvider
+	keyEvents         *keypool.KeyEventStream
+	notifier          *notify.Notifier
+	siemStreamer      *siem.Streamer
+	envWatcher        *config.EnvFileWatcher
+	hostHealth        *hosthealth.Checker
 	proxyServer       *proxy.ProxyServer
+	inFlight          *middleware.InFlightTracker
 	storage           store.Store
 	db                *gorm.DB
 	httpServer        *http.Server
+	listener          net.Listener
 }
 
 // AppParams defines the dependencies for the App.
@@ -46,12 +74,28 @@ type AppParams struct {
 	Engine            *gin.Engine
 	ConfigManager     types.ConfigManager
 	SettingsManager   *config.SystemSettingsManager
+	FeatureFlags      *config.FeatureFlagManager
 	GroupManager      *services.GroupManager
 	LogCleanupService *services.LogCleanupService
 	RequestLogService *services.RequestLogService
+	StatsCounter      *services.StatsCounterService
+	GoroutinePool     *appruntime.GoroutinePool
+	EventExporter     *services.ClickHouseExporter
+	Recordings        *services.RecordingService
+	KeySync           *services.KeySyncService
+	GroupDeletion     *services.GroupDeletionService
+	LogPartitions     *services.RequestLogPartitionService
+	PayloadOffload    *services.PayloadOffloadService
+	GeoRouting        *services.GeoRoutingService
 	CronChecker       *keypool.CronChecker
 	KeyPoolProvider   *keypool.KeyProvider
+	KeyEvents         *keypool.KeyEventStream
+	Notifier          *notify.Notifier
+	SIEMStreamer      *siem.Streamer
+	EnvWatcher        *config.EnvFileWatcher
+	HostHealth        *hosthealth.Checker
 	ProxyServer       *proxy.ProxyServer
+	InFlight          *middleware.InFlightTracker
 	Storage           store.Store
 	DB                *gorm.DB
 }
@@ -62,12 +106,28 @@ func NewApp(params AppParams) *App {
 		engine:            params.Engine,
 		configManager:     params.ConfigManager,
 		settingsManager:   params.SettingsManager,
+		featureFlags:      params.FeatureFlags,
 		groupManager:      params.GroupManager,
 		logCleanupService: params.LogCleanupService,
 		requestLogService: params.RequestLogService,
+		statsCounter:      params.StatsCounter,
+		goroutinePool:     params.GoroutinePool,
+		eventExporter:     params.EventExporter,
+		recordings:        params.Recordings,
+		keySync:           params.KeySync,
+		groupDeletion:     params.GroupDeletion,
+		logPartitions:     params.LogPartitions,
+		payloadOffload:    params.PayloadOffload,
+		geoRouting:        params.GeoRouting,
 		cronChecker:       params.CronChecker,
 		keyPoolProvider:   params.KeyPoolProvider,
+		keyEvents:         params.KeyEvents,
+		notifier:          params.Notifier,
+		siemStreamer:      params.SIEMStreamer,
+		envWatcher:        params.EnvWatcher,
+		hostHealth:        params.HostHealth,
 		proxyServer:       params.ProxyServer,
+		inFlight:          params.InFlight,
 		storage:           params.Storage,
 		db:                params.DB,
 	}
@@ -75,6 +135,98 @@ func NewApp(params AppParams) *App {
 
 // Start runs the application, it is a non-blocking call.
 func (a *App) Start() error {
+	if err := a.Initialize(); err != nil {
+		return err
+	}
+
+	// 性能分析接口与管理 API 共用端口，采样率只在启动时应用
+	if pprofConfig := a.configManager.GetPprofConfig(); pprofConfig.Enabled {
+		runtime.SetMutexProfileFraction(pprofConfig.MutexFraction)
+		runtime.SetBlockProfileRate(pprofConfig.BlockFraction)
+		logrus.Warn("Runtime profiling is enabled at /debug/pprof. It exposes process internals and adds overhead, disable ENABLE_PPROF when you are done.")
+	}
+
+	// Create HTTP server
+	serverConfig := a.configManager.GetEffectiveServerConfig()
+	a.httpServer = &http.Server{
+		Addr:           net.JoinHostPort(serverConfig.Host, fmt.Sprint(serverConfig.Port)),
+		Handler:        a.Handler(),
+		ReadTimeout:    time.Duration(serverConfig.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(serverConfig.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(serverConfig.IdleTimeout) * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+
+	// 配置了证书时以 HTTPS 监听，证书在启动时加载，无法加载时直接返回错误
+	scheme := "http"
+	if serverConfig.TLSCertFile != "" {
+		tlsConfig, err := newServerTLSConfig(serverConfig)
+		if err != nil {
+			return utils.NewStartupError(utils.StartupErrInvalidConfig, err)
+		}
+		a.httpServer.TLSConfig = tlsConfig
+		scheme = "https"
+	}
+
+	// 先同步监听，绑定失败时直接返回错误；PORT=0 时由系统分配端口
+	listener, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		code := utils.StartupErrListenFailed
+		if errors.Is(err, syscall.EADDRINUSE) {
+			code = utils.StartupErrPortInUse
+		}
+		return utils.NewStartupError(code, fmt.Errorf("failed to listen on %s: %w", a.httpServer.Addr, err))
+	}
+	a.listener = listener
+	utils.EmitStartupEvent("listener_bound", map[string]any{"addr": a.ListenAddr()})
+
+	// Start HTTP server in a new goroutine
+	go func() {
+		logrus.Infof("GPT-Load proxy server started successfully on Version: %s", version.Version)
+		logrus.Infof("Server address: %s://%s", scheme, a.ListenAddr())
+		logrus.Info("")
+		var err error
+		if a.httpServer.TLSConfig != nil {
+			err = a.httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = a.httpServer.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("Server startup failed: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// newServerTLSConfig loads the server certificate and applies the minimum TLS version.
+func newServerTLSConfig(serverConfig types.ServerConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(serverConfig.TLSCertFile, serverConfig.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	// 配置校验时已确认版本合法
+	minVersion, _ := utils.ParseTLSVersion(serverConfig.TLSMinVersion)
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}, nil
+}
+
+// ListenAddr returns the configured host with the port the HTTP server is bound to, which is
+// picked by the system when PORT=0. It is empty before Start.
+func (a *App) ListenAddr() string {
+	if a.listener == nil {
+		return ""
+	}
+	host, _, _ := net.SplitHostPort(a.httpServer.Addr)
+	_, port, _ := net.SplitHostPort(a.listener.Addr().String())
+	return net.JoinHostPort(host, port)
+}
+
+// Initialize migrates the database, loads keys and settings, and starts the background
+// services, leaving the application ready to serve requests through Handler.
+func (a *App) Initialize() error {
 	// Master 节点执行初始化
 	if a.configManager.IsMaster() {
 		logrus.Info("Starting as Master Node.")
@@ -86,12 +238,19 @@ func (a *App) Start() error {
 			&models.APIKey{},
 			&models.RequestLog{},
 			&models.GroupHourlyStat{},
+			&models.KeySourceHourlyStat{},
+			&models.KeySourceDisableStat{},
+			&models.GroupStatCounter{},
+			&models.FeatureFlagOverride{},
+			&models.GeoRouteRule{},
+			&models.AdminAuditLog{},
 		); err != nil {
 			return fmt.Errorf("database auto-migration failed: %w", err)
 		}
 		// 数据修复
 		db.MigrateDatabase(a.db)
 		logrus.Info("Database auto-migration completed.")
+		utils.EmitStartupEvent("migrations_applied", nil)
 
 		// 初始化系统设置
 		if err := a.settingsManager.EnsureSettingsInitialized(a.configManager.GetAuthConfig()); err != nil {
@@ -108,75 +267,156 @@ func (a *App) Start() error {
 		logrus.Debug("API keys loaded into Redis cache by master.")
 
 		// 仅 Master 节点启动的服务
+		a.logPartitions.Start()
 		a.requestLogService.Start()
+		a.payloadOffload.Start()
 		a.logCleanupService.Start()
 		a.cronChecker.Start()
+		a.keySync.Start()
+		a.groupDeletion.Start()
 	} else {
 		logrus.Info("Starting as Slave Node.")
 		a.settingsManager.Initialize(a.storage, a.groupManager, a.configManager.IsMaster())
 	}
 
+	// 加载功能开关
+	if err := a.featureFlags.Initialize(a.storage); err != nil {
+		return fmt.Errorf("failed to initialize feature flags: %w", err)
+	}
+	if err := a.recordings.Start(); err != nil {
+		return fmt.Errorf("failed to start recording service: %w", err)
+	}
+
 	// 显示配置并启动所有后台服务
 	a.configManager.DisplayServerConfig()
 
 	a.groupManager.Initialize()
-
-	// Create HTTP server
-	serverConfig := a.configManager.GetEffectiveServerConfig()
-	a.httpServer = &http.Server{
-		Addr:           fmt.Sprintf("%s:%d", serverConfig.Host, serverConfig.Port),
-		Handler:        a.engine,
-		ReadTimeout:    time.Duration(serverConfig.ReadTimeout) * time.Second,
-		WriteTimeout:   time.Duration(serverConfig.WriteTimeout) * time.Second,
-		IdleTimeout:    time.Duration(serverConfig.IdleTimeout) * time.Second,
-		MaxHeaderBytes: 1 << 20,
+	a.keyPoolProvider.CheckPoolViability()
+	a.statsCounter.Start()
+	a.goroutinePool.Start()
+	a.eventExporter.Start()
+	a.requestLogService.StartQueueWriter()
+	a.notifier.Start()
+	a.siemStreamer.Start()
+	// 重新加载配置后按新的日志配置重建日志输出，CORS 等中间件每次请求时读取配置
+	a.envWatcher.OnReload(func() { utils.SetupLogger(a.configManager) })
+	a.envWatcher.Start()
+	a.hostHealth.Start()
+	if err := a.geoRouting.Start(); err != nil {
+		return fmt.Errorf("failed to start geo routing: %w", err)
+	}
+	if err := a.keyEvents.Start(); err != nil {
+		return fmt.Errorf("failed to start key event stream: %w", err)
 	}
-
-	// Start HTTP server in a new goroutine
-	go func() {
-		logrus.Infof("GPT-Load proxy server started successfully on Version: %s", version.Version)
-		logrus.Infof("Server address: http://%s:%d", serverConfig.Host, serverConfig.Port)
-		logrus.Info("")
-		if err := a.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logrus.Fatalf("Server startup failed: %v", err)
-		}
-	}()
 
 	return nil
 }
 
-// Stop gracefully shuts down the application.
-func (a *App) Stop(ctx context.Context) {
-	logrus.Info("Shutting down server...")
+// Handler returns the fully wired HTTP handler (auth, routing, proxy pipeline and logging).
+// After Initialize it can serve requests in-process, e.g. through httptest, without a listener.
+func (a *App) Handler() http.Handler {
+	return middleware.PathPrefixRouting(a.engine, a.settingsManager)
+}
 
-	serverConfig := a.configManager.GetEffectiveServerConfig()
-	totalTimeout := time.Duration(serverConfig.GracefulShutdownTimeout) * time.Second
+// streamCloseTimeout bounds how long force-closed streams get to send their final SSE event.
+const streamCloseTimeout = time.Second
+
+// shutdownHTTPServer stops the HTTP server in three phases: stop accepting new connections,
+// drain in-flight proxy requests, then drain in-flight admin requests.
+// New streams are refused once shutdown begins; streams still open after the proxy drain
+// phase are closed with a final SSE error event.
+// Connections still open after the last phase are closed forcibly.
+func (a *App) shutdownHTTPServer(serverConfig types.ServerConfig) {
+	stopAccepting := time.Duration(serverConfig.ShutdownStopAcceptingSeconds) * time.Second
+	drainProxy := time.Duration(serverConfig.ShutdownDrainProxySeconds) * time.Second
+	drainAdmin := time.Duration(serverConfig.ShutdownDrainAdminSeconds) * time.Second
 
-	// 动态计算 HTTP 关机超时时间，为后台服务固定预留 5 秒
-	httpShutdownTimeout := totalTimeout - 5*time.Second
-	httpShutdownCtx, cancelHttpShutdown := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	httpShutdownCtx, cancelHttpShutdown := context.WithTimeout(context.Background(), stopAccepting+drainProxy+drainAdmin)
 	defer cancelHttpShutdown()
 
-	logrus.Debugf("Attempting to gracefully shut down HTTP server (max %v)...", httpShutdownTimeout)
-	if err := a.httpServer.Shutdown(httpShutdownCtx); err != nil {
-		logrus.Debugf("HTTP server graceful shutdown timed out as expected, forcing remaining connections to close.")
+	// 阶段一：关闭监听器与空闲连接，不再接受新连接，同时拒绝新的流式请求
+	logrus.Infof("Shutdown phase 1/3: stop accepting new connections (max %v)", stopAccepting)
+	a.inFlight.BeginDraining()
+	a.httpServer.SetKeepAlivesEnabled(false)
+	shutdownDone := make(chan error, 1)
+	go func() {
+		shutdownDone <- a.httpServer.Shutdown(httpShutdownCtx)
+	}()
+
+	var shutdownErr error
+	finished := false
+	select {
+	case shutdownErr = <-shutdownDone:
+		finished = true
+	case <-time.After(stopAccepting):
+	}
+
+	if !finished {
+		// 阶段二：等待进行中的代理请求完成
+		logrus.Infof("Shutdown phase 2/3: draining in-flight proxy requests (max %v)", drainProxy)
+		if !a.inFlight.WaitProxy(drainProxy) {
+			logrus.Warn("Timed out draining proxy requests, remaining requests will be interrupted.")
+			// 仍在进行的流式响应发送 SSE error 事件后关闭
+			if !a.inFlight.CloseStreams(streamCloseTimeout) {
+				logrus.Warn("Timed out closing active streams.")
+			}
+		}
+
+		// 阶段三：等待进行中的管理请求完成
+		logrus.Infof("Shutdown phase 3/3: draining in-flight admin requests (max %v)", drainAdmin)
+		if !a.inFlight.WaitAdmin(drainAdmin) {
+			logrus.Warn("Timed out draining admin requests, remaining requests will be interrupted.")
+		}
+
+		shutdownErr = <-shutdownDone
+	}
+
+	if shutdownErr != nil {
+		logrus.Debugf("HTTP server graceful shutdown timed out, forcing remaining connections to close.")
 		if closeErr := a.httpServer.Close(); closeErr != nil {
 			logrus.Errorf("Error forcing HTTP server to close: %v", closeErr)
 		}
 	}
 	logrus.Info("HTTP server has been shut down.")
+}
+
+// Stop gracefully shuts down the application.
+func (a *App) Stop(ctx context.Context) {
+	logrus.Info("Shutting down server...")
+
+	serverConfig := a.configManager.GetEffectiveServerConfig()
+	// 仅通过 Initialize 在进程内使用时没有 HTTP 服务器需要关闭
+	if a.httpServer != nil {
+		a.shutdownHTTPServer(serverConfig)
+	}
 
 	// 使用原始的总超时 context 继续关闭其他后台服务
 	stoppableServices := []func(context.Context){
 		a.groupManager.Stop,
 		a.settingsManager.Stop,
+		a.featureFlags.Stop,
+		a.statsCounter.Stop,
+		a.goroutinePool.Stop,
+		a.eventExporter.Stop,
+		a.requestLogService.StopQueueWriter,
+		a.recordings.Stop,
+		a.geoRouting.Stop,
+		a.keyEvents.Stop,
+		a.notifier.Stop,
+		a.siemStreamer.Stop,
+		a.envWatcher.Stop,
+		a.hostHealth.Stop,
 	}
 
 	if serverConfig.IsMaster {
 		stoppableServices = append(stoppableServices,
 			a.cronChecker.Stop,
+			a.keySync.Stop,
+			a.groupDeletion.Stop,
 			a.logCleanupService.Stop,
+			a.payloadOffload.Stop,
 			a.requestLogService.Stop,
+			a.logPartitions.Stop,
 		)
 	}
 
@@ -0,0 +1,425 @@
+package app_test
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/internal/app"
+	"gpt-load/internal/container"
+	"gpt-load/internal/services"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// 参考路径：默认配置下，带请求头规则的 OpenAI 分组，经过认证、路由、选择密钥、请求日志后转发到本地空上游
+const (
+	benchAuthKey   = "bench-admin-key"
+	benchProxyKey  = "sk-bench-proxy-key"
+	benchGroupName = "bench-openai"
+	benchRequest   = `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"ping"}]}`
+	benchResponse  = `{"id":"chatcmpl-bench","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+)
+
+// 默认开销预算，可通过 GATEWAY_BUDGET_P99 和 GATEWAY_BUDGET_ALLOCS 覆盖
+const (
+	defaultOverheadBudgetP99    = 2 * time.Millisecond
+	defaultOverheadBudgetAllocs = 500
+)
+
+// gatewayHarness is the fully wired application served in-process through its handler.
+type gatewayHarness struct {
+	handler       http.Handler
+	upstream      *httptest.Server
+	groupManager  *services.GroupManager
+	configManager types.ConfigManager
+	recordings    *services.RecordingService
+	recordingDir  string
+}
+
+var (
+	harnessOnce sync.Once
+	harness     *gatewayHarness
+	harnessErr  error
+)
+
+// newGatewayHarness builds the application once per test binary, since the container
+// registers process-wide metrics, and configures the reference group against a no-op upstream.
+func newGatewayHarness(tb testing.TB) *gatewayHarness {
+	tb.Helper()
+	harnessOnce.Do(func() {
+		harness, harnessErr = buildGatewayHarness()
+	})
+	if harnessErr != nil {
+		tb.Fatalf("build gateway harness: %v", harnessErr)
+	}
+	return harness
+}
+
+func buildGatewayHarness() (*gatewayHarness, error) {
+	dataDir, err := os.MkdirTemp("", "gpt-load-bench")
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]string{
+		"AUTH_KEY":      benchAuthKey,
+		"DATABASE_DSN":  filepath.Join(dataDir, "bench.db"),
+		"RECORDING_DIR": filepath.Join(dataDir, "recordings"),
+		"LOG_LEVEL":     "error",
+		"SILENT_MODE":   "true",
+	} {
+		os.Setenv(key, value)
+	}
+	logrus.SetLevel(logrus.ErrorLevel)
+	logrus.SetOutput(io.Discard)
+	gormlogger.Default = gormlogger.Default.LogMode(gormlogger.Silent)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, benchResponse)
+	}))
+
+	c, err := container.BuildContainer()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Provide(func() embed.FS { return embed.FS{} }); err != nil {
+		return nil, err
+	}
+	if err := c.Provide(func() []byte { return []byte("<html></html>") }); err != nil {
+		return nil, err
+	}
+
+	var handler http.Handler
+	var groupManager *services.GroupManager
+	var configManager types.ConfigManager
+	var recordings *services.RecordingService
+	if err := c.Invoke(func(application *app.App, gm *services.GroupManager, cm types.ConfigManager, rs *services.RecordingService) error {
+		if err := application.Initialize(); err != nil {
+			return err
+		}
+		handler = application.Handler()
+		groupManager = gm
+		configManager = cm
+		recordings = rs
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	h := &gatewayHarness{
+		handler:       handler,
+		upstream:      upstream,
+		groupManager:  groupManager,
+		configManager: configManager,
+		recordings:    recordings,
+		recordingDir:  filepath.Join(dataDir, "recordings"),
+	}
+	groupID, err := h.createGroup()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.admin(http.MethodPost, "/api/keys/add-multiple", map[string]any{
+		"group_id":  groupID,
+		"keys_text": "sk-upstream-1\nsk-upstream-2\nsk-upstream-3",
+	}, nil); err != nil {
+		return nil, fmt.Errorf("add keys: %w", err)
+	}
+
+	// 分组缓存通过订阅异步刷新，刚启动时订阅可能尚未建立，等待期间重新发送刷新通知
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := h.proxy()
+		if w.Code == http.StatusOK {
+			return h, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("reference path returned %d: %s", w.Code, w.Body.String())
+		}
+		if err := groupManager.Invalidate(); err != nil {
+			return nil, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (h *gatewayHarness) createGroup() (uint, error) {
+	var group struct {
+		ID uint `json:"id"`
+	}
+	err := h.admin(http.MethodPost, "/api/groups", map[string]any{
+		"name":         benchGroupName,
+		"channel_type": "openai",
+		"test_model":   "gpt-4o-mini",
+		"upstreams":    []map[string]any{{"url": h.upstream.URL, "weight": 1}},
+		"proxy_keys":   benchProxyKey,
+		"header_rules": []map[string]string{
+			{"key": "X-Bench-Route", "value": "reference", "action": "set"},
+			{"key": "X-Client-Trace", "action": "remove"},
+		},
+	}, &group)
+	if err != nil {
+		return 0, fmt.Errorf("create group: %w", err)
+	}
+	return group.ID, nil
+}
+
+// admin calls an admin API endpoint and decodes the data of a successful response into out.
+func (h *gatewayHarness) admin(method, path string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Authorization", "Bearer "+benchAuthKey)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return fmt.Errorf("%s %s returned %d: %s", method, path, w.Code, w.Body.String())
+	}
+	if out == nil {
+		return nil
+	}
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// proxy sends one request on the reference path and returns the recorded response.
+func (h *gatewayHarness) proxy() *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/proxy/"+benchGroupName+"/v1/chat/completions", strings.NewReader(benchRequest))
+	req.Header.Set("Authorization", "Bearer "+benchProxyKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Client-Trace", "bench")
+	w := httptest.NewRecorder()
+	h.handler.ServeHTTP(w, req)
+	return w
+}
+
+// overheadResult is the per-request cost of the reference path.
+type overheadResult struct {
+	P50         time.Duration `json:"p50_ns"`
+	P99         time.Duration `json:"p99_ns"`
+	Mean        time.Duration `json:"mean_ns"`
+	AllocsPerOp float64       `json:"allocs_per_op"`
+	BytesPerOp  float64       `json:"bytes_per_op"`
+}
+
+// measureOverhead runs requests sequentially on the reference path and records their latency
+// and allocations. Allocations include those of background work the requests cause, such as
+// writing request logs.
+func measureOverhead(tb testing.TB, h *gatewayHarness, requests int) overheadResult {
+	tb.Helper()
+	// 预热连接池和缓存
+	for i := 0; i < 100; i++ {
+		if w := h.proxy(); w.Code != http.StatusOK {
+			tb.Fatalf("warm-up request returned %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	latencies := make([]time.Duration, requests)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	var total time.Duration
+	for i := range latencies {
+		start := time.Now()
+		w := h.proxy()
+		latencies[i] = time.Since(start)
+		if w.Code != http.StatusOK {
+			tb.Fatalf("request returned %d: %s", w.Code, w.Body.String())
+		}
+		total += latencies[i]
+	}
+	runtime.ReadMemStats(&after)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return overheadResult{
+		P50:         latencies[len(latencies)/2],
+		P99:         latencies[len(latencies)*99/100],
+		Mean:        total / time.Duration(requests),
+		AllocsPerOp: float64(after.Mallocs-before.Mallocs) / float64(requests),
+		BytesPerOp:  float64(after.TotalAlloc-before.TotalAlloc) / float64(requests),
+	}
+}
+
+// BenchmarkGatewayReferencePath reports the per-request overhead and allocations of the full
+// in-process pipeline: auth, routing, key selection, header rules and request logging.
+func BenchmarkGatewayReferencePath(b *testing.B) {
+	h := newGatewayHarness(b)
+	if w := h.proxy(); w.Code != http.StatusOK {
+		b.Fatalf("request returned %d: %s", w.Code, w.Body.String())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if w := h.proxy(); w.Code != http.StatusOK {
+			b.Fatalf("request returned %d: %s", w.Code, w.Body.String())
+		}
+	}
+}
+
+// BenchmarkGatewayReferencePathParallel measures the same path under concurrent load.
+func BenchmarkGatewayReferencePathParallel(b *testing.B) {
+	h := newGatewayHarness(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if w := h.proxy(); w.Code != http.StatusOK {
+				b.Errorf("request returned %d", w.Code)
+				return
+			}
+		}
+	})
+}
+
+// TestGatewayOverheadBudget fails when the reference path exceeds the overhead budget. Wall-clock
+// timings depend on the machine and its load, so the check only runs with GATEWAY_BUDGET_CHECK=1,
+// as in make bench. With GATEWAY_BENCH_OUTPUT set the results are saved to that file, and with
+// GATEWAY_BENCH_BASELINE set to the file of an earlier run they are printed as a comparison table,
+// e.g. to evaluate a PR:
+//
+//	git checkout main && GATEWAY_BUDGET_CHECK=1 GATEWAY_BENCH_OUTPUT=/tmp/base.json go test ./internal/app -run OverheadBudget
+//	git checkout pr && GATEWAY_BUDGET_CHECK=1 GATEWAY_BENCH_BASELINE=/tmp/base.json go test ./internal/app -run OverheadBudget -v
+func TestGatewayOverheadBudget(t *testing.T) {
+	if os.Getenv("GATEWAY_BUDGET_CHECK") != "1" {
+		t.Skip("set GATEWAY_BUDGET_CHECK=1 to check the gateway overhead budget")
+	}
+	budgetP99 := defaultOverheadBudgetP99
+	if value := os.Getenv("GATEWAY_BUDGET_P99"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			t.Fatalf("invalid GATEWAY_BUDGET_P99: %v", err)
+		}
+		budgetP99 = parsed
+	}
+	budgetAllocs := float64(defaultOverheadBudgetAllocs)
+	if value := os.Getenv("GATEWAY_BUDGET_ALLOCS"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("invalid GATEWAY_BUDGET_ALLOCS: %v", err)
+		}
+		budgetAllocs = parsed
+	}
+
+	h := newGatewayHarness(t)
+	result := measureOverhead(t, h, 2000)
+
+	if path := os.Getenv("GATEWAY_BENCH_OUTPUT"); path != "" {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write results: %v", err)
+		}
+	}
+	if path := os.Getenv("GATEWAY_BENCH_BASELINE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read baseline: %v", err)
+		}
+		var baseline overheadResult
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			t.Fatalf("parse baseline: %v", err)
+		}
+		t.Log("\n" + formatComparison(baseline, result))
+	} else {
+		t.Logf("p50=%v p99=%v mean=%v allocs/op=%.0f bytes/op=%.0f", result.P50, result.P99, result.Mean, result.AllocsPerOp, result.BytesPerOp)
+	}
+
+	if result.P99 > budgetP99 {
+		t.Errorf("p99 overhead %v exceeds the budget of %v", result.P99, budgetP99)
+	}
+	if result.AllocsPerOp > budgetAllocs {
+		t.Errorf("%.0f allocations per request exceed the budget of %.0f", result.AllocsPerOp, budgetAllocs)
+	}
+}
+
+// formatComparison prints two runs side by side with the relative change of each metric.
+func formatComparison(baseline, current overheadResult) string {
+	rows := []struct {
+		name        string
+		base, value float64
+		format      func(float64) string
+	}{
+		{"p50", float64(baseline.P50), float64(current.P50), formatDuration},
+		{"p99", float64(baseline.P99), float64(current.P99), formatDuration},
+		{"mean", float64(baseline.Mean), float64(current.Mean), formatDuration},
+		{"allocs/op", baseline.AllocsPerOp, current.AllocsPerOp, formatCount},
+		{"bytes/op", baseline.BytesPerOp, current.BytesPerOp, formatCount},
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-10s %12s %12s %9s\n", "metric", "baseline", "current", "delta")
+	for _, row := range rows {
+		delta := "n/a"
+		if row.base != 0 {
+			delta = fmt.Sprintf("%+.1f%%", (row.value-row.base)/row.base*100)
+		}
+		fmt.Fprintf(&sb, "%-10s %12s %12s %9s\n", row.name, row.format(row.base), row.format(row.value), delta)
+	}
+	return sb.String()
+}
+
+func formatDuration(ns float64) string {
+	return time.Duration(ns).Round(time.Microsecond).String()
+}
+
+func formatCount(n float64) string {
+	return strconv.FormatFloat(n, 'f', 0, 64)
+}
+
+func TestFormatComparison(t *testing.T) {
+	tests := []struct {
+		name      string
+		baseline  overheadResult
+		current   overheadResult
+		wantLines []string
+	}{
+		{
+			name:      "regression",
+			baseline:  overheadResult{P50: 200 * time.Microsecond, P99: time.Millisecond, Mean: 250 * time.Microsecond, AllocsPerOp: 400, BytesPerOp: 40000},
+			current:   overheadResult{P50: 300 * time.Microsecond, P99: 1500 * time.Microsecond, Mean: 250 * time.Microsecond, AllocsPerOp: 500, BytesPerOp: 30000},
+			wantLines: []string{"p50", "200µs", "300µs", "+50.0%", "p99", "1ms", "1.5ms", "allocs/op", "+25.0%", "bytes/op", "-25.0%", "+0.0%"},
+		},
+		{
+			name:      "empty baseline",
+			baseline:  overheadResult{},
+			current:   overheadResult{P99: time.Millisecond},
+			wantLines: []string{"n/a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := formatComparison(tt.baseline, tt.current)
+			for _, want := range tt.wantLines {
+				if !strings.Contains(table, want) {
+					t.Errorf("comparison table does not contain %q:\n%s", want, table)
+				}
+			}
+		})
+	}
+}
@@ -1,16 +1,10 @@
 package channel
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
-	"gpt-load/internal/utils"
-	"io"
 	"net/http"
-	"net/url"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +14,20 @@ func init() {
 	Register("anthropic", newAnthropicChannel)
 }
 
+// anthropicChatParams translates OpenAI chat parameters for Anthropic's OpenAI SDK compatibility endpoint.
+var anthropicChatParams = map[string]paramRule{
+	"stop":              stopParam(0),
+	"n":                 candidateCountParam(1),
+	"temperature":       rangeParam(0, 1),
+	"top_p":             rangeParam(0, 1),
+	"frequency_penalty": unsupportedParam,
+	"presence_penalty":  unsupportedParam,
+	"logit_bias":        unsupportedParam,
+	"logprobs":          unsupportedParam,
+	"top_logprobs":      unsupportedParam,
+	"seed":              unsupportedParam,
+}
+
 type AnthropicChannel struct {
 	*BaseChannel
 }
@@ -73,68 +81,33 @@ func (ch *AnthropicChannel) ExtractModel(c *gin.Context, bodyBytes []byte) strin
 	return ""
 }
 
-// ValidateKey checks if the given API key is valid by making a messages request.
-func (ch *AnthropicChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
-	upstreamURL := ch.getUpstreamURL()
-	if upstreamURL == nil {
-		return false, fmt.Errorf("no upstream URL configured for channel %s", ch.Name)
+// TranslateChatParams adapts OpenAI chat requests sent to the chat completions endpoint.
+func (ch *AnthropicChannel) TranslateChatParams(path string, body []byte) (*ParamTranslation, error) {
+	if !isChatCompletionsPath(path) {
+		return nil, nil
 	}
+	return translateChatParams(anthropicChatParams, body)
+}
+
+// ValidateKey checks if the given API key is valid by sending the group's validation probe.
+func (ch *AnthropicChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
+	return ch.validateWithProbe(ctx, ch, apiKey, group)
+}
+
+// DescribeValidationProbe returns the validation request that would be sent for the key.
+func (ch *AnthropicChannel) DescribeValidationProbe(apiKey *models.APIKey, group *models.Group) (*ProbeRequest, error) {
+	return ch.describeProbe(ch, apiKey, group)
+}
 
+// defaultValidationProbe validates keys with a minimal messages request.
+func (ch *AnthropicChannel) defaultValidationProbe() models.ValidationProbe {
 	validationEndpoint := ch.ValidationEndpoint
 	if validationEndpoint == "" {
 		validationEndpoint = "/v1/messages"
 	}
-	reqURL, err := url.JoinPath(upstreamURL.String(), validationEndpoint)
-	if err != nil {
-		return false, fmt.Errorf("failed to join upstream URL and validation endpoint: %w", err)
-	}
-
-	// Use a minimal, low-cost payload for validation
-	payload := gin.H{
-		"model":      ch.TestModel,
-		"max_tokens": 100,
-		"messages": []gin.H{
-			{"role": "user", "content": "hi"},
-		},
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal validation payload: %w", err)
+	return models.ValidationProbe{
+		Method:       http.MethodPost,
+		Path:         validationEndpoint,
+		BodyTemplate: `{"model":"${MODEL}","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`,
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(body))
-	if err != nil {
-		return false, fmt.Errorf("failed to create validation request: %w", err)
-	}
-	req.Header.Set("x-api-key", apiKey.KeyValue)
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("Content-Type", "application/json")
-
-	// Apply custom header rules if available
-	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContext(group, apiKey)
-		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
-	}
-
-	resp, err := ch.HTTPClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("failed to send validation request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Any 2xx status code indicates the key is valid.
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return true, nil
-	}
-
-	// For non-200 responses, parse the body to provide a more specific error reason.
-	errorBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("key is invalid (status %d), but failed to read error body: %w", resp.StatusCode, err)
-	}
-
-	// Use the new parser to extract a clean error message.
-	parsedError := app_errors.ParseUpstreamError(errorBody)
-
-	return false, fmt.Errorf("[status %d] %s", resp.StatusCode, parsedError)
 }
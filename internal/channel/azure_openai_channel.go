@@ -0,0 +1,173 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gpt-load/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	Register("azure-openai", newAzureOpenAIChannel)
+}
+
+// azureDeploymentsAPIVersion 是提供数据面部署列表接口的 api-version，较新的版本已移除该接口，仅用于密钥验证
+const azureDeploymentsAPIVersion = "2022-12-01"
+
+// azureDeploymentPaths 是需要路由到具体部署的 OpenAI 接口（去掉 /v1 前缀后的路径）
+var azureDeploymentPaths = map[string]bool{
+	"/chat/completions":     true,
+	"/completions":          true,
+	"/embeddings":           true,
+	"/images/generations":   true,
+	"/audio/speech":         true,
+	"/audio/transcriptions": true,
+	"/audio/translations":   true,
+}
+
+// AzureOpenAIChannel proxies OpenAI-style requests to Azure OpenAI, which serves each model
+// from a deployment and authenticates with the api-key header.
+type AzureOpenAIChannel struct {
+	*BaseChannel
+	deployments map[string]string
+}
+
+func newAzureOpenAIChannel(f *Factory, group *models.Group) (ChannelProxy, error) {
+	base, err := f.newBaseChannel("azure-openai", group)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := models.ParseAzureDeployments(group.EffectiveConfig.AzureDeployments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure_deployments for group %s: %w", group.Name, err)
+	}
+
+	return &AzureOpenAIChannel{
+		BaseChannel: base,
+		deployments: deployments,
+	}, nil
+}
+
+// BuildUpstreamURL constructs the target URL for requests whose model is unknown. Endpoints
+// served by a deployment cannot be routed without a model.
+func (ch *AzureOpenAIChannel) BuildUpstreamURL(originalURL *url.URL, group *models.Group) (string, error) {
+	return ch.BuildModelUpstreamURL(originalURL, group, "")
+}
+
+// BuildModelUpstreamURL rewrites an OpenAI-style path to the Azure format, routing requests
+// for a model to its mapped deployment, and adds the group's api-version unless the client
+// sent one. Paths already in the Azure format are forwarded as they are.
+func (ch *AzureOpenAIChannel) BuildModelUpstreamURL(originalURL *url.URL, group *models.Group, model string) (string, error) {
+	base := ch.getUpstreamURL()
+	if base == nil {
+		return "", fmt.Errorf("no upstream URL configured for channel %s", ch.Name)
+	}
+
+	requestPath := strings.TrimPrefix(originalURL.Path, "/proxy/"+group.Name)
+	azurePath, err := ch.azurePath(requestPath, model)
+	if err != nil {
+		return "", err
+	}
+
+	finalURL := *base
+	finalURL.Path = strings.TrimRight(finalURL.Path, "/") + azurePath
+	finalURL.RawPath = ""
+	finalURL.RawQuery = originalURL.RawQuery
+	if !originalURL.Query().Has("api-version") {
+		apiVersion := "api-version=" + url.QueryEscape(group.EffectiveConfig.AzureAPIVersion)
+		if finalURL.RawQuery == "" {
+			finalURL.RawQuery = apiVersion
+		} else {
+			finalURL.RawQuery += "&" + apiVersion
+		}
+	}
+
+	return finalURL.String(), nil
+}
+
+// azurePath maps a request path to the Azure OpenAI path.
+func (ch *AzureOpenAIChannel) azurePath(requestPath, model string) (string, error) {
+	if strings.HasPrefix(requestPath, "/openai/") {
+		return requestPath, nil
+	}
+
+	rest := strings.TrimPrefix(requestPath, "/v1")
+	if !azureDeploymentPaths[rest] {
+		return "/openai" + rest, nil
+	}
+	if model == "" {
+		return "", fmt.Errorf("%w: %s", ErrModelRequired, requestPath)
+	}
+
+	deployment := model
+	if mapped, ok := ch.deployments[model]; ok {
+		deployment = mapped
+	}
+	return "/openai/deployments/" + url.PathEscape(deployment) + rest, nil
+}
+
+// ModifyRequest sets the api-key header used by Azure OpenAI.
+func (ch *AzureOpenAIChannel) ModifyRequest(req *http.Request, apiKey *models.APIKey, group *models.Group) {
+	req.Header.Del("Authorization")
+	req.Header.Set("api-key", apiKey.KeyValue)
+}
+
+// IsStreamRequest checks if the request is for a streaming response using the pre-read body.
+func (ch *AzureOpenAIChannel) IsStreamRequest(c *gin.Context, bodyBytes []byte) bool {
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		return true
+	}
+
+	if c.Query("stream") == "true" {
+		return true
+	}
+
+	type streamPayload struct {
+		Stream bool `json:"stream"`
+	}
+	var p streamPayload
+	if err := json.Unmarshal(bodyBytes, &p); err == nil {
+		return p.Stream
+	}
+
+	return false
+}
+
+func (ch *AzureOpenAIChannel) ExtractModel(c *gin.Context, bodyBytes []byte) string {
+	type modelPayload struct {
+		Model string `json:"model"`
+	}
+	var p modelPayload
+	if err := json.Unmarshal(bodyBytes, &p); err == nil {
+		return p.Model
+	}
+	return ""
+}
+
+// ValidateKey checks if the given API key is valid by sending the group's validation probe.
+func (ch *AzureOpenAIChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
+	return ch.validateWithProbe(ctx, ch, apiKey, group)
+}
+
+// DescribeValidationProbe returns the validation request that would be sent for the key.
+func (ch *AzureOpenAIChannel) DescribeValidationProbe(apiKey *models.APIKey, group *models.Group) (*ProbeRequest, error) {
+	return ch.describeProbe(ch, apiKey, group)
+}
+
+// defaultValidationProbe validates keys by listing the deployments of the resource.
+func (ch *AzureOpenAIChannel) defaultValidationProbe() models.ValidationProbe {
+	validationEndpoint := ch.ValidationEndpoint
+	if validationEndpoint == "" {
+		validationEndpoint = "/openai/deployments?api-version=" + azureDeploymentsAPIVersion
+	}
+	return models.ValidationProbe{
+		Method: http.MethodGet,
+		Path:   validationEndpoint,
+	}
+}
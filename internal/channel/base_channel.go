@@ -3,6 +3,7 @@ package channel
 import (
 	"bytes"
 	"fmt"
+	"gpt-load/internal/hosthealth"
 	"gpt-load/internal/models"
 	"gpt-load/internal/types"
 	"net/http"
@@ -32,9 +33,14 @@ type BaseChannel struct {
 	upstreamLock       sync.Mutex
 
 	// Cached fields from the group for stale check
-	channelType     string
-	groupUpstreams  datatypes.JSON
-	effectiveConfig *types.SystemSettings
+	channelType      string
+	groupUpstreams   datatypes.JSON
+	effectiveConfig  *types.SystemSettings
+	keepaliveTimeout *int
+
+	// 上游主机健康状态，用于在多上游分组中跳过被标记为不可用的主机
+	groupID    uint
+	hostHealth *hosthealth.Checker
 }
 
 // getUpstreamURL selects an upstream URL using a smooth weighted round-robin algorithm.
@@ -49,11 +55,23 @@ func (b *BaseChannel) getUpstreamURL() *url.URL {
 		return b.Upstreams[0].URL
 	}
 
+	// 所有上游都不可用时不再跳过，仍按权重轮询
+	skipDown := false
+	for i := range b.Upstreams {
+		if !b.isUpstreamDown(b.Upstreams[i].URL) {
+			skipDown = true
+			break
+		}
+	}
+
 	totalWeight := 0
 	var best *UpstreamInfo
 
 	for i := range b.Upstreams {
 		up := &b.Upstreams[i]
+		if skipDown && b.isUpstreamDown(up.URL) {
+			continue
+		}
 		totalWeight += up.Weight
 		up.CurrentWeight += up.Weight
 
@@ -70,6 +88,11 @@ func (b *BaseChannel) getUpstreamURL() *url.URL {
 	return best.URL
 }
 
+// isUpstreamDown reports whether the host of the upstream failed its health probes.
+func (b *BaseChannel) isUpstreamDown(u *url.URL) bool {
+	return b.hostHealth != nil && b.hostHealth.IsDown(b.groupID, hosthealth.Origin(u))
+}
+
 // BuildUpstreamURL constructs the target URL for the upstream service.
 func (b *BaseChannel) BuildUpstreamURL(originalURL *url.URL, group *models.Group) (string, error) {
 	base := b.getUpstreamURL()
@@ -106,6 +129,9 @@ func (b *BaseChannel) IsConfigStale(group *models.Group) bool {
 	if !reflect.DeepEqual(b.effectiveConfig, &group.EffectiveConfig) {
 		return true
 	}
+	if !reflect.DeepEqual(b.keepaliveTimeout, group.KeepaliveTimeoutSeconds) {
+		return true
+	}
 	return false
 }
 
@@ -0,0 +1,147 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/hosthealth"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stubConfigManager returns a fixed proxy configuration. Other methods are not implemented and
+// panic when called.
+type stubConfigManager struct {
+	types.ConfigManager
+	proxy types.ProxyConfig
+}
+
+func (m *stubConfigManager) GetProxyConfig() types.ProxyConfig { return m.proxy }
+func (m *stubConfigManager) IsMaster() bool                    { return true }
+
+// newHostHealthChecker starts a checker over a group with the given upstreams and waits until
+// its first probe marked the hosts in down as down.
+func newHostHealthChecker(t *testing.T, groupID uint, upstreams []string, down map[string]bool) *hosthealth.Checker {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var defs []map[string]any
+	for _, u := range upstreams {
+		defs = append(defs, map[string]any{"url": u, "weight": 1})
+	}
+	data, _ := json.Marshal(defs)
+	if err := db.Create(&models.Group{ID: groupID, Name: "group", ChannelType: "openai", Upstreams: data}).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	checker := hosthealth.NewChecker(db, store.NewMemoryStore(clk), &stubConfigManager{proxy: types.ProxyConfig{
+		HostHealthCheckIntervalSeconds: 60,
+		HostHealthCheckTimeoutSeconds:  5,
+		HostHealthFailureThreshold:     1,
+	}}, clk, metrics.NewMetrics(prometheus.NewRegistry()))
+	checker.Start()
+	t.Cleanup(func() { checker.Stop(context.Background()) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(checker.Stats()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("host health checker did not probe the group")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, u := range upstreams {
+		if got := checker.IsDown(groupID, u); got != down[u] {
+			t.Fatalf("IsDown(%s) = %v, want %v", u, got, down[u])
+		}
+	}
+	return checker
+}
+
+func TestGetUpstreamURLSkipsDownHosts(t *testing.T) {
+	newServer := func(status int) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	a := newServer(http.StatusOK).URL
+	b := newServer(http.StatusOK).URL
+	deadA := newServer(http.StatusBadGateway).URL
+	deadB := newServer(http.StatusBadGateway).URL
+
+	tests := []struct {
+		name      string
+		upstreams []string
+		weights   []int
+		want      []string
+	}{
+		{
+			name:      "all hosts up",
+			upstreams: []string{a, b},
+			weights:   []int{1, 1},
+			want:      []string{a, b, a, b},
+		},
+		{
+			name:      "down host is skipped",
+			upstreams: []string{deadA, b},
+			weights:   []int{1, 1},
+			want:      []string{b, b, b},
+		},
+		{
+			name:      "down host is skipped despite a higher weight",
+			upstreams: []string{a, deadA},
+			weights:   []int{1, 5},
+			want:      []string{a, a, a},
+		},
+		{
+			name:      "all hosts down keeps round-robin",
+			upstreams: []string{deadA, deadB},
+			weights:   []int{1, 1},
+			want:      []string{deadA, deadB, deadA, deadB},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groupID := uint(i + 1)
+			down := map[string]bool{deadA: true, deadB: true}
+			ch := &BaseChannel{groupID: groupID, hostHealth: newHostHealthChecker(t, groupID, tt.upstreams, down)}
+			for j, u := range tt.upstreams {
+				parsed, _ := url.Parse(u)
+				ch.Upstreams = append(ch.Upstreams, UpstreamInfo{URL: parsed, Weight: tt.weights[j]})
+			}
+
+			var got []string
+			for range tt.want {
+				got = append(got, ch.getUpstreamURL().String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("upstreams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package channel
 
 import (
 	"context"
+	"errors"
 	"gpt-load/internal/models"
 	"net/http"
 	"net/url"
@@ -34,4 +35,17 @@ type ChannelProxy interface {
 
 	// ValidateKey checks if the given API key is valid.
 	ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error)
+
+	// DescribeValidationProbe returns the validation request that would be sent for the key.
+	DescribeValidationProbe(apiKey *models.APIKey, group *models.Group) (*ProbeRequest, error)
+}
+
+// ErrModelRequired is returned by a ModelRouter when a request must be routed by model but names none.
+var ErrModelRequired = errors.New("a model is required to route the request to a deployment")
+
+// ModelRouter is implemented by channels whose upstream URL depends on the requested model,
+// such as Azure OpenAI, which serves each model from a named deployment.
+type ModelRouter interface {
+	// BuildModelUpstreamURL constructs the target URL for a request for the given model.
+	BuildModelUpstreamURL(originalURL *url.URL, group *models.Group, model string) (string, error)
 }
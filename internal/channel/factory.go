@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"gpt-load/internal/config"
+	"gpt-load/internal/hosthealth"
 	"gpt-load/internal/httpclient"
 	"gpt-load/internal/models"
+	"gpt-load/internal/types"
 	"net/url"
 	"sync"
 	"time"
@@ -41,16 +43,20 @@ func GetChannels() []string {
 // Factory is responsible for creating channel proxies.
 type Factory struct {
 	settingsManager *config.SystemSettingsManager
+	configManager   types.ConfigManager
 	clientManager   *httpclient.HTTPClientManager
+	hostHealth      *hosthealth.Checker
 	channelCache    map[uint]ChannelProxy
 	cacheLock       sync.Mutex
 }
 
 // NewFactory creates a new channel factory.
-func NewFactory(settingsManager *config.SystemSettingsManager, clientManager *httpclient.HTTPClientManager) *Factory {
+func NewFactory(settingsManager *config.SystemSettingsManager, configManager types.ConfigManager, clientManager *httpclient.HTTPClientManager, hostHealth *hosthealth.Checker) *Factory {
 	return &Factory{
 		settingsManager: settingsManager,
+		configManager:   configManager,
 		clientManager:   clientManager,
+		hostHealth:      hostHealth,
 		channelCache:    make(map[uint]ChannelProxy),
 	}
 }
@@ -109,11 +115,13 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 		upstreamInfos = append(upstreamInfos, UpstreamInfo{URL: u, Weight: weight})
 	}
 
+	idleConnTimeout := f.idleConnTimeout(group)
+
 	// Base configuration for regular requests, derived from the group's effective settings.
 	clientConfig := &httpclient.Config{
 		ConnectTimeout:        time.Duration(group.EffectiveConfig.ConnectTimeout) * time.Second,
 		RequestTimeout:        time.Duration(group.EffectiveConfig.RequestTimeout) * time.Second,
-		IdleConnTimeout:       time.Duration(group.EffectiveConfig.IdleConnTimeout) * time.Second,
+		IdleConnTimeout:       idleConnTimeout,
 		MaxIdleConns:          group.EffectiveConfig.MaxIdleConns,
 		MaxIdleConnsPerHost:   group.EffectiveConfig.MaxIdleConnsPerHost,
 		ResponseHeaderTimeout: time.Duration(group.EffectiveConfig.ResponseHeaderTimeout) * time.Second,
@@ -150,5 +158,23 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 		channelType:        group.ChannelType,
 		groupUpstreams:     group.Upstreams,
 		effectiveConfig:    &group.EffectiveConfig,
+		keepaliveTimeout:   group.KeepaliveTimeoutSeconds,
+		groupID:            group.ID,
+		hostHealth:         f.hostHealth,
 	}, nil
 }
+
+// idleConnTimeout returns how long upstream connections of the group may stay idle. The group's
+// keepalive_timeout_seconds takes precedence, then an idle_conn_timeout group config override,
+// then HTTP_IDLE_CONN_TIMEOUT_SECONDS, then the idle_conn_timeout system setting.
+func (f *Factory) idleConnTimeout(group *models.Group) time.Duration {
+	if group.KeepaliveTimeoutSeconds != nil && *group.KeepaliveTimeoutSeconds > 0 {
+		return time.Duration(*group.KeepaliveTimeoutSeconds) * time.Second
+	}
+	if _, overridden := group.Config["idle_conn_timeout"]; !overridden {
+		if seconds := f.configManager.GetProxyConfig().IdleConnTimeoutSeconds; seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return time.Duration(group.EffectiveConfig.IdleConnTimeout) * time.Second
+}
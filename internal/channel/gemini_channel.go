@@ -1,16 +1,10 @@
 package channel
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
-	"gpt-load/internal/utils"
-	"io"
 	"net/http"
-	"net/url"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +14,15 @@ func init() {
 	Register("gemini", newGeminiChannel)
 }
 
+// geminiChatParams translates OpenAI chat parameters for Gemini's OpenAI compatibility endpoint.
+var geminiChatParams = map[string]paramRule{
+	"stop":              stopParam(5),
+	"n":                 candidateCountParam(8),
+	"frequency_penalty": unsupportedParam,
+	"presence_penalty":  unsupportedParam,
+	"logit_bias":        unsupportedParam,
+}
+
 type GeminiChannel struct {
 	*BaseChannel
 }
@@ -95,63 +98,29 @@ func (ch *GeminiChannel) ExtractModel(c *gin.Context, bodyBytes []byte) string {
 	return ""
 }
 
-// ValidateKey checks if the given API key is valid by making a generateContent request.
-func (ch *GeminiChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
-	upstreamURL := ch.getUpstreamURL()
-	if upstreamURL == nil {
-		return false, fmt.Errorf("no upstream URL configured for channel %s", ch.Name)
-	}
-
-	// Safely join the path segments
-	reqURL, err := url.JoinPath(upstreamURL.String(), "v1beta", "models", ch.TestModel+":generateContent")
-	if err != nil {
-		return false, fmt.Errorf("failed to create gemini validation path: %w", err)
-	}
-	reqURL += "?key=" + apiKey.KeyValue
-
-	payload := gin.H{
-		"contents": []gin.H{
-			{"parts": []gin.H{
-				{"text": "hi"},
-			}},
-		},
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal validation payload: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(body))
-	if err != nil {
-		return false, fmt.Errorf("failed to create validation request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Apply custom header rules if available
-	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContext(group, apiKey)
-		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
+// TranslateChatParams adapts OpenAI chat requests sent to the v1beta/openai endpoint.
+func (ch *GeminiChannel) TranslateChatParams(path string, body []byte) (*ParamTranslation, error) {
+	if !strings.Contains(path, "v1beta/openai") || !isChatCompletionsPath(path) {
+		return nil, nil
 	}
+	return translateChatParams(geminiChatParams, body)
+}
 
-	resp, err := ch.HTTPClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("failed to send validation request: %w", err)
-	}
-	defer resp.Body.Close()
+// ValidateKey checks if the given API key is valid by sending the group's validation probe.
+func (ch *GeminiChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
+	return ch.validateWithProbe(ctx, ch, apiKey, group)
+}
 
-	// Any 2xx status code indicates the key is valid.
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return true, nil
-	}
+// DescribeValidationProbe returns the validation request that would be sent for the key.
+func (ch *GeminiChannel) DescribeValidationProbe(apiKey *models.APIKey, group *models.Group) (*ProbeRequest, error) {
+	return ch.describeProbe(ch, apiKey, group)
+}
 
-	// For non-200 responses, parse the body to provide a more specific error reason.
-	errorBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("key is invalid (status %d), but failed to read error body: %w", resp.StatusCode, err)
+// defaultValidationProbe validates keys with a minimal generateContent request.
+func (ch *GeminiChannel) defaultValidationProbe() models.ValidationProbe {
+	return models.ValidationProbe{
+		Method:       http.MethodPost,
+		Path:         "/v1beta/models/${MODEL}:generateContent",
+		BodyTemplate: `{"contents":[{"parts":[{"text":"hi"}]}]}`,
 	}
-
-	// Use the new parser to extract a clean error message.
-	parsedError := app_errors.ParseUpstreamError(errorBody)
-
-	return false, fmt.Errorf("[status %d] %s", resp.StatusCode, parsedError)
 }
@@ -1,16 +1,10 @@
 package channel
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
-	"gpt-load/internal/utils"
-	"io"
 	"net/http"
-	"net/url"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -35,9 +29,16 @@ func newOpenAIChannel(f *Factory, group *models.Group) (ChannelProxy, error) {
 	}, nil
 }
 
-// ModifyRequest sets the Authorization header for the OpenAI service.
+// ModifyRequest sets the Authorization header for the OpenAI service, along with the
+// organization and project headers of project-scoped keys, overriding any sent by the client.
 func (ch *OpenAIChannel) ModifyRequest(req *http.Request, apiKey *models.APIKey, group *models.Group) {
 	req.Header.Set("Authorization", "Bearer "+apiKey.KeyValue)
+	if apiKey.OrgID != "" {
+		req.Header.Set("OpenAI-Organization", apiKey.OrgID)
+	}
+	if apiKey.ProjectID != "" {
+		req.Header.Set("OpenAI-Project", apiKey.ProjectID)
+	}
 }
 
 // IsStreamRequest checks if the request is for a streaming response using the pre-read body.
@@ -72,66 +73,25 @@ func (ch *OpenAIChannel) ExtractModel(c *gin.Context, bodyBytes []byte) string {
 	return ""
 }
 
-// ValidateKey checks if the given API key is valid by making a chat completion request.
+// ValidateKey checks if the given API key is valid by sending the group's validation probe.
 func (ch *OpenAIChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
-	upstreamURL := ch.getUpstreamURL()
-	if upstreamURL == nil {
-		return false, fmt.Errorf("no upstream URL configured for channel %s", ch.Name)
-	}
+	return ch.validateWithProbe(ctx, ch, apiKey, group)
+}
 
+// DescribeValidationProbe returns the validation request that would be sent for the key.
+func (ch *OpenAIChannel) DescribeValidationProbe(apiKey *models.APIKey, group *models.Group) (*ProbeRequest, error) {
+	return ch.describeProbe(ch, apiKey, group)
+}
+
+// defaultValidationProbe validates keys with a minimal chat completion request.
+func (ch *OpenAIChannel) defaultValidationProbe() models.ValidationProbe {
 	validationEndpoint := ch.ValidationEndpoint
 	if validationEndpoint == "" {
 		validationEndpoint = "/v1/chat/completions"
 	}
-	reqURL, err := url.JoinPath(upstreamURL.String(), validationEndpoint)
-	if err != nil {
-		return false, fmt.Errorf("failed to join upstream URL and validation endpoint: %w", err)
-	}
-
-	// Use a minimal, low-cost payload for validation
-	payload := gin.H{
-		"model": ch.TestModel,
-		"messages": []gin.H{
-			{"role": "user", "content": "hi"},
-		},
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal validation payload: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(body))
-	if err != nil {
-		return false, fmt.Errorf("failed to create validation request: %w", err)
+	return models.ValidationProbe{
+		Method:       http.MethodPost,
+		Path:         validationEndpoint,
+		BodyTemplate: `{"model":"${MODEL}","messages":[{"role":"user","content":"hi"}]}`,
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey.KeyValue)
-	req.Header.Set("Content-Type", "application/json")
-
-	// Apply custom header rules if available
-	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContext(group, apiKey)
-		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
-	}
-
-	resp, err := ch.HTTPClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("failed to send validation request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Any 2xx status code indicates the key is valid.
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return true, nil
-	}
-
-	// For non-200 responses, parse the body to provide a more specific error reason.
-	errorBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("key is invalid (status %d), but failed to read error body: %w", resp.StatusCode, err)
-	}
-
-	// Use the new parser to extract a clean error message.
-	parsedError := app_errors.ParseUpstreamError(errorBody)
-
-	return false, fmt.Errorf("[status %d] %s", resp.StatusCode, parsedError)
 }
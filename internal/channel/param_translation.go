@@ -0,0 +1,184 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChatParamTranslator is implemented by channels whose OpenAI-compatible chat endpoint
+// lacks some OpenAI chat parameters.
+type ChatParamTranslator interface {
+	// TranslateChatParams adapts an OpenAI chat request body for the channel. It returns nil
+	// if the request is not an OpenAI-format chat request for this channel.
+	TranslateChatParams(path string, body []byte) (*ParamTranslation, error)
+}
+
+// ParamTranslation is the result of translating OpenAI chat parameters for a provider.
+type ParamTranslation struct {
+	Body []byte
+	// Dropped lists the parameters whose values could not be fully carried over,
+	// either removed entirely or only partially translated.
+	Dropped []string
+}
+
+// paramRule translates one parameter value for a provider. keep reports whether the
+// (translated) value is forwarded; lossy reports whether part of the client's intent was lost.
+// Removing a parameter without loss, e.g. one set to its default, is keep=false, lossy=false.
+type paramRule func(value any) (translated any, keep bool, lossy bool)
+
+// translateChatParams applies a provider's translation table to a request body.
+// Parameters missing from the table are forwarded unchanged.
+func translateChatParams(table map[string]paramRule, body []byte) (*ParamTranslation, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var requestData map[string]any
+	if err := decoder.Decode(&requestData); err != nil {
+		return nil, fmt.Errorf("failed to parse chat request body: %w", err)
+	}
+
+	changed := false
+	var dropped []string
+	for name, rule := range table {
+		value, exists := requestData[name]
+		if !exists {
+			continue
+		}
+		translated, keep, lossy := rule(value)
+		if lossy {
+			dropped = append(dropped, name)
+		}
+		if keep {
+			requestData[name] = translated
+		} else {
+			delete(requestData, name)
+		}
+		changed = true
+	}
+
+	result := &ParamTranslation{Body: body, Dropped: dropped}
+	if !changed {
+		return result, nil
+	}
+	sort.Strings(result.Dropped)
+
+	translatedBody, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal translated chat request: %w", err)
+	}
+	result.Body = translatedBody
+	return result, nil
+}
+
+// isChatCompletionsPath reports whether the path targets an OpenAI chat completions endpoint.
+func isChatCompletionsPath(path string) bool {
+	return strings.HasSuffix(strings.TrimRight(path, "/"), "/chat/completions")
+}
+
+// unsupportedParam drops a parameter the provider has no equivalent for.
+// Values equal to the OpenAI default are removed without being reported.
+func unsupportedParam(value any) (any, bool, bool) {
+	return nil, false, !isDefaultParamValue(value)
+}
+
+// stopParam normalizes `stop` (a string or an array of strings) to an array, keeping at
+// most maxSequences entries when the provider limits them (0 means no limit).
+func stopParam(maxSequences int) paramRule {
+	return func(value any) (any, bool, bool) {
+		var sequences []any
+		switch v := value.(type) {
+		case nil:
+			return nil, false, false
+		case string:
+			if v != "" {
+				sequences = append(sequences, v)
+			}
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok && s != "" {
+					sequences = append(sequences, s)
+				}
+			}
+		default:
+			return nil, false, true
+		}
+
+		if len(sequences) == 0 {
+			return nil, false, false
+		}
+		if maxSequences > 0 && len(sequences) > maxSequences {
+			return sequences[:maxSequences], true, true
+		}
+		return sequences, true, false
+	}
+}
+
+// candidateCountParam forwards `n` while it is within the provider's candidate limit.
+// A larger `n` can't be served and is dropped, so a single choice is returned.
+func candidateCountParam(maxCandidates int) paramRule {
+	return func(value any) (any, bool, bool) {
+		n, ok := paramNumber(value)
+		switch {
+		case value == nil:
+			return nil, false, false
+		case !ok:
+			return nil, false, true
+		case n <= 1:
+			return nil, false, false
+		case n <= float64(maxCandidates):
+			return value, true, false
+		default:
+			return nil, false, true
+		}
+	}
+}
+
+// rangeParam clamps a numeric sampling parameter, such as temperature, to the provider's range.
+func rangeParam(minValue, maxValue float64) paramRule {
+	return func(value any) (any, bool, bool) {
+		n, ok := paramNumber(value)
+		switch {
+		case value == nil:
+			return nil, false, false
+		case !ok:
+			return value, true, false
+		case n < minValue:
+			return minValue, true, true
+		case n > maxValue:
+			return maxValue, true, true
+		default:
+			return value, true, false
+		}
+	}
+}
+
+func paramNumber(value any) (float64, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := number.Float64()
+	return f, err == nil
+}
+
+// isDefaultParamValue reports whether a value leaves the OpenAI default behaviour unchanged.
+func isDefaultParamValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case string:
+		return v == ""
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
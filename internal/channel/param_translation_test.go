@@ -0,0 +1,163 @@
+package channel
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTranslateChatParams(t *testing.T) {
+	const absent = "<absent>"
+
+	tests := []struct {
+		name        string
+		table       map[string]paramRule
+		param       string
+		value       string // 请求中参数的 JSON 值
+		want        string // 转发给上游的 JSON 值，absent 表示被移除
+		wantDropped bool
+	}{
+		// Gemini
+		{name: "gemini stop string", table: geminiChatParams, param: "stop", value: `"END"`, want: `["END"]`},
+		{name: "gemini stop array", table: geminiChatParams, param: "stop", value: `["a","b"]`, want: `["a","b"]`},
+		{name: "gemini stop array over limit", table: geminiChatParams, param: "stop", value: `["1","2","3","4","5","6"]`, want: `["1","2","3","4","5"]`, wantDropped: true},
+		{name: "gemini stop empty string", table: geminiChatParams, param: "stop", value: `""`, want: absent},
+		{name: "gemini stop empty array", table: geminiChatParams, param: "stop", value: `[]`, want: absent},
+		{name: "gemini stop null", table: geminiChatParams, param: "stop", value: `null`, want: absent},
+		{name: "gemini stop invalid type", table: geminiChatParams, param: "stop", value: `5`, want: absent, wantDropped: true},
+		{name: "gemini n default", table: geminiChatParams, param: "n", value: `1`, want: absent},
+		{name: "gemini n within limit", table: geminiChatParams, param: "n", value: `4`, want: `4`},
+		{name: "gemini n over limit", table: geminiChatParams, param: "n", value: `9`, want: absent, wantDropped: true},
+		{name: "gemini frequency_penalty", table: geminiChatParams, param: "frequency_penalty", value: `0.5`, want: absent, wantDropped: true},
+		{name: "gemini frequency_penalty default", table: geminiChatParams, param: "frequency_penalty", value: `0`, want: absent},
+		{name: "gemini presence_penalty", table: geminiChatParams, param: "presence_penalty", value: `-1`, want: absent, wantDropped: true},
+		{name: "gemini logit_bias", table: geminiChatParams, param: "logit_bias", value: `{"50256":-100}`, want: absent, wantDropped: true},
+		{name: "gemini logit_bias empty", table: geminiChatParams, param: "logit_bias", value: `{}`, want: absent},
+		{name: "gemini temperature unchanged", table: geminiChatParams, param: "temperature", value: `1.8`, want: `1.8`},
+		{name: "gemini seed unchanged", table: geminiChatParams, param: "seed", value: `42`, want: `42`},
+
+		// Anthropic
+		{name: "anthropic stop string", table: anthropicChatParams, param: "stop", value: `"\n\nHuman:"`, want: `["\n\nHuman:"]`},
+		{name: "anthropic stop array without limit", table: anthropicChatParams, param: "stop", value: `["1","2","3","4","5","6"]`, want: `["1","2","3","4","5","6"]`},
+		{name: "anthropic stop array skips empty", table: anthropicChatParams, param: "stop", value: `["a",""]`, want: `["a"]`},
+		{name: "anthropic n default", table: anthropicChatParams, param: "n", value: `1`, want: absent},
+		{name: "anthropic n over limit", table: anthropicChatParams, param: "n", value: `2`, want: absent, wantDropped: true},
+		{name: "anthropic n invalid type", table: anthropicChatParams, param: "n", value: `"2"`, want: absent, wantDropped: true},
+		{name: "anthropic temperature in range", table: anthropicChatParams, param: "temperature", value: `0.7`, want: `0.7`},
+		{name: "anthropic temperature clamped", table: anthropicChatParams, param: "temperature", value: `1.5`, want: `1`, wantDropped: true},
+		{name: "anthropic temperature negative", table: anthropicChatParams, param: "temperature", value: `-0.5`, want: `0`, wantDropped: true},
+		{name: "anthropic top_p clamped", table: anthropicChatParams, param: "top_p", value: `2`, want: `1`, wantDropped: true},
+		{name: "anthropic top_p in range", table: anthropicChatParams, param: "top_p", value: `0.9`, want: `0.9`},
+		{name: "anthropic frequency_penalty", table: anthropicChatParams, param: "frequency_penalty", value: `0.2`, want: absent, wantDropped: true},
+		{name: "anthropic presence_penalty", table: anthropicChatParams, param: "presence_penalty", value: `0.2`, want: absent, wantDropped: true},
+		{name: "anthropic logit_bias", table: anthropicChatParams, param: "logit_bias", value: `{"1":5}`, want: absent, wantDropped: true},
+		{name: "anthropic logprobs", table: anthropicChatParams, param: "logprobs", value: `true`, want: absent, wantDropped: true},
+		{name: "anthropic logprobs false", table: anthropicChatParams, param: "logprobs", value: `false`, want: absent},
+		{name: "anthropic top_logprobs", table: anthropicChatParams, param: "top_logprobs", value: `3`, want: absent, wantDropped: true},
+		{name: "anthropic seed", table: anthropicChatParams, param: "seed", value: `42`, want: absent, wantDropped: true},
+		{name: "anthropic max_tokens unchanged", table: anthropicChatParams, param: "max_tokens", value: `256`, want: `256`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"model":"m","messages":[{"role":"user","content":"hi"}],"` + tt.param + `":` + tt.value + `}`)
+			result, err := translateChatParams(tt.table, body)
+			if err != nil {
+				t.Fatalf("translateChatParams() error = %v", err)
+			}
+
+			var translated map[string]json.RawMessage
+			if err := json.Unmarshal(result.Body, &translated); err != nil {
+				t.Fatalf("translated body is not JSON: %v", err)
+			}
+			got, exists := translated[tt.param]
+			switch {
+			case tt.want == absent && exists:
+				t.Errorf("%s = %s, want it removed", tt.param, got)
+			case tt.want != absent && !exists:
+				t.Errorf("%s was removed, want %s", tt.param, tt.want)
+			case tt.want != absent && !jsonEqual(t, got, []byte(tt.want)):
+				t.Errorf("%s = %s, want %s", tt.param, got, tt.want)
+			}
+			if string(translated["model"]) != `"m"` || len(translated["messages"]) == 0 {
+				t.Errorf("other parameters changed: %s", result.Body)
+			}
+
+			var wantDropped []string
+			if tt.wantDropped {
+				wantDropped = []string{tt.param}
+			}
+			if !reflect.DeepEqual(result.Dropped, wantDropped) {
+				t.Errorf("dropped = %v, want %v", result.Dropped, wantDropped)
+			}
+		})
+	}
+}
+
+func TestTranslateChatParamsDroppedSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		table       map[string]paramRule
+		body        string
+		wantDropped []string
+		wantBody    bool // 请求体是否应保持原样
+	}{
+		{
+			name:        "gemini several unsupported",
+			table:       geminiChatParams,
+			body:        `{"model":"m","stop":"x","n":12,"presence_penalty":0.4,"frequency_penalty":0.1,"logit_bias":{"1":1}}`,
+			wantDropped: []string{"frequency_penalty", "logit_bias", "n", "presence_penalty"},
+		},
+		{
+			name:        "anthropic sorted and lossy clamps included",
+			table:       anthropicChatParams,
+			body:        `{"model":"m","temperature":1.2,"seed":7,"top_logprobs":2,"logprobs":true,"stop":["a"]}`,
+			wantDropped: []string{"logprobs", "seed", "temperature", "top_logprobs"},
+		},
+		{
+			name:     "only defaults removed",
+			table:    anthropicChatParams,
+			body:     `{"model":"m","n":1,"seed":null,"frequency_penalty":0}`,
+			wantBody: false,
+		},
+		{
+			name:     "nothing to translate",
+			table:    geminiChatParams,
+			body:     `{"model":"m","messages":[],"temperature":0.3}`,
+			wantBody: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := translateChatParams(tt.table, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("translateChatParams() error = %v", err)
+			}
+			if !reflect.DeepEqual(result.Dropped, tt.wantDropped) {
+				t.Errorf("dropped = %v, want %v", result.Dropped, tt.wantDropped)
+			}
+			if unchanged := string(result.Body) == tt.body; unchanged != tt.wantBody {
+				t.Errorf("body unchanged = %v, want %v (body: %s)", unchanged, tt.wantBody, result.Body)
+			}
+		})
+	}
+}
+
+func TestTranslateChatParamsInvalidBody(t *testing.T) {
+	if _, err := translateChatParams(geminiChatParams, []byte(`not json`)); err == nil {
+		t.Error("translateChatParams() error = nil, want a parse error")
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,159 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProbeRequest describes the validation request sent for a key, with the key masked.
+// An empty ExpectedStatuses means any 2xx status is accepted.
+type ProbeRequest struct {
+	Method           string            `json:"method"`
+	URL              string            `json:"url"`
+	Headers          map[string]string `json:"headers"`
+	Body             string            `json:"body,omitempty"`
+	ExpectedStatuses []int             `json:"expected_statuses,omitempty"`
+	ResponseJSONPath string            `json:"response_json_path,omitempty"`
+}
+
+// probeChannel is implemented by channels that validate keys with a validation probe.
+type probeChannel interface {
+	ModifyRequest(req *http.Request, apiKey *models.APIKey, group *models.Group)
+	defaultValidationProbe() models.ValidationProbe
+}
+
+// resolveValidationProbe returns the group's custom probe, or the channel default.
+func resolveValidationProbe(ch probeChannel, group *models.Group) (models.ValidationProbe, error) {
+	probe, err := models.ParseValidationProbe(group.ValidationProbe)
+	if err != nil {
+		return models.ValidationProbe{}, err
+	}
+	if probe == nil {
+		return ch.defaultValidationProbe(), nil
+	}
+	return *probe, nil
+}
+
+// newProbeRequest builds the validation request for a key from the group's probe.
+func (b *BaseChannel) newProbeRequest(ctx context.Context, ch probeChannel, probe models.ValidationProbe, apiKey *models.APIKey, group *models.Group) (*http.Request, string, error) {
+	upstreamURL := b.getUpstreamURL()
+	if upstreamURL == nil {
+		return nil, "", fmt.Errorf("no upstream URL configured for channel %s", b.Name)
+	}
+
+	probePath, rawQuery, _ := strings.Cut(probe.Path, "?")
+	reqURL := *upstreamURL
+	reqURL.Path = strings.TrimRight(reqURL.Path, "/") + strings.ReplaceAll(probePath, models.ValidationProbeModelPlaceholder, b.TestModel)
+	reqURL.RawPath = ""
+	reqURL.RawQuery = strings.ReplaceAll(rawQuery, models.ValidationProbeModelPlaceholder, url.QueryEscape(b.TestModel))
+
+	var body string
+	var bodyReader io.Reader
+	if probe.BodyTemplate != "" {
+		body = probe.RenderBody(b.TestModel)
+		bodyReader = bytes.NewBufferString(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, probe.Method, reqURL.String(), bodyReader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create validation request: %w", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	ch.ModifyRequest(req, apiKey, group)
+
+	// Apply custom header rules if available
+	if len(group.HeaderRuleList) > 0 {
+		headerCtx := utils.NewHeaderVariableContext(group, apiKey)
+		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
+	}
+
+	return req, body, nil
+}
+
+// validateWithProbe sends the group's validation probe and checks the response against its success criteria.
+func (b *BaseChannel) validateWithProbe(ctx context.Context, ch probeChannel, apiKey *models.APIKey, group *models.Group) (bool, error) {
+	probe, err := resolveValidationProbe(ch, group)
+	if err != nil {
+		return false, err
+	}
+
+	req, _, err := b.newProbeRequest(ctx, ch, probe, apiKey, group)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := b.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send validation request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if probe.IsExpectedStatus(resp.StatusCode) {
+		if probe.ResponseJSONPath == "" {
+			return true, nil
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false, fmt.Errorf("failed to read validation response: %w", err)
+		}
+		if !models.JSONPathExists(respBody, probe.ResponseJSONPath) {
+			return false, fmt.Errorf("[status %d] response does not contain %s", resp.StatusCode, probe.ResponseJSONPath)
+		}
+		return true, nil
+	}
+
+	// For unexpected responses, parse the body to provide a more specific error reason.
+	errorBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("key is invalid (status %d), but failed to read error body: %w", resp.StatusCode, err)
+	}
+
+	// Use the new parser to extract a clean error message.
+	parsedError := app_errors.ParseUpstreamError(errorBody)
+
+	return false, fmt.Errorf("[status %d] %s", resp.StatusCode, parsedError)
+}
+
+// describeProbe returns the validation request that would be sent for a key, with the key masked.
+func (b *BaseChannel) describeProbe(ch probeChannel, apiKey *models.APIKey, group *models.Group) (*ProbeRequest, error) {
+	probe, err := resolveValidationProbe(ch, group)
+	if err != nil {
+		return nil, err
+	}
+
+	req, body, err := b.newProbeRequest(context.Background(), ch, probe, apiKey, group)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := func(s string) string {
+		if apiKey.KeyValue == "" {
+			return s
+		}
+		return strings.ReplaceAll(s, apiKey.KeyValue, utils.MaskAPIKey(apiKey.KeyValue))
+	}
+
+	headers := make(map[string]string, len(req.Header))
+	for name := range req.Header {
+		headers[name] = mask(req.Header.Get(name))
+	}
+
+	return &ProbeRequest{
+		Method:           req.Method,
+		URL:              mask(req.URL.String()),
+		Headers:          headers,
+		Body:             body,
+		ExpectedStatuses: probe.ExpectedStatuses,
+		ResponseJSONPath: probe.ResponseJSONPath,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves when Advance or Set is called. Timers, tickers and
+// After channels fire synchronously during Advance, in order of their due time.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	due      time.Time
+	interval time.Duration // 大于 0 时为 ticker
+	ch       chan time.Time
+	fn       func()
+}
+
+// NewFake returns a fake clock set to start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the fake current time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t.
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Until returns the fake time remaining until t.
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+// After returns a channel that receives the fake time once it has advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	w := &fakeWaiter{ch: make(chan time.Time, 1)}
+	f.add(w, d)
+	return w.ch
+}
+
+// AfterFunc calls fn once the fake time has advanced by d.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &fakeWaiter{fn: fn}
+	f.add(w, d)
+	return &fakeTimer{clock: f, waiter: w}
+}
+
+// NewTicker returns a ticker that ticks every d of fake time. Like time.Ticker, ticks are
+// dropped when the receiver falls behind.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{interval: d, ch: make(chan time.Time, 1)}
+	f.add(w, d)
+	return &fakeTicker{clock: f, waiter: w}
+}
+
+// Advance moves the fake time forward by d, firing every timer that becomes due.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the fake time to t, firing every timer that becomes due. Time never moves backwards.
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mu.Lock()
+		w := f.nextDue(t)
+		if w == nil {
+			if t.After(f.now) {
+				f.now = t
+			}
+			f.mu.Unlock()
+			return
+		}
+		if w.due.After(f.now) {
+			f.now = w.due
+		}
+		now := f.now
+		if w.interval > 0 {
+			w.due = w.due.Add(w.interval)
+		} else {
+			f.remove(w)
+		}
+		f.mu.Unlock()
+
+		if w.ch != nil {
+			select {
+			case w.ch <- now:
+			default:
+			}
+		}
+		if w.fn != nil {
+			w.fn()
+		}
+	}
+}
+
+// Waiters returns the number of pending timers, tickers and After channels, so tests can wait
+// until the code under test has started waiting before advancing the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (f *Fake) add(w *fakeWaiter, d time.Duration) {
+	f.mu.Lock()
+	w.due = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+	f.mu.Unlock()
+	if d <= 0 {
+		f.Advance(0)
+	}
+}
+
+// nextDue returns the earliest waiter due at or before t. The caller holds f.mu.
+func (f *Fake) nextDue(t time.Time) *fakeWaiter {
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].due.Before(f.waiters[j].due)
+	})
+	if len(f.waiters) == 0 || f.waiters[0].due.After(t) {
+		return nil
+	}
+	return f.waiters[0]
+}
+
+// remove drops w from the pending waiters and reports whether it was pending. The caller holds f.mu.
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, pending := range f.waiters {
+		if pending == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	waiter *fakeWaiter
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t.waiter)
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.waiter.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.remove(t.waiter)
+}
@@ -0,0 +1,148 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		advance  []time.Duration
+		wantFire bool
+	}{
+		{name: "not due yet", delay: time.Minute, advance: []time.Duration{59 * time.Second}, wantFire: false},
+		{name: "due exactly", delay: time.Minute, advance: []time.Duration{time.Minute}, wantFire: true},
+		{name: "due across several advances", delay: time.Minute, advance: []time.Duration{30 * time.Second, 30 * time.Second}, wantFire: true},
+		{name: "zero delay fires immediately", delay: 0, wantFire: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFake(testStart)
+			ch := f.After(tt.delay)
+			for _, d := range tt.advance {
+				f.Advance(d)
+			}
+
+			select {
+			case fired := <-ch:
+				if !tt.wantFire {
+					t.Fatalf("fired at %v, want not fired", fired)
+				}
+				if want := testStart.Add(tt.delay); !fired.Equal(want) {
+					t.Errorf("fired at %v, want %v", fired, want)
+				}
+			default:
+				if tt.wantFire {
+					t.Fatal("not fired, want fired")
+				}
+			}
+		})
+	}
+}
+
+func TestFakeAfterFuncOrderAndStop(t *testing.T) {
+	f := NewFake(testStart)
+	var fired []string
+	var firedAt []time.Time
+	record := func(name string) func() {
+		return func() {
+			fired = append(fired, name)
+			firedAt = append(firedAt, f.Now())
+		}
+	}
+
+	f.AfterFunc(3*time.Second, record("third"))
+	f.AfterFunc(time.Second, record("first"))
+	stopped := f.AfterFunc(2*time.Second, record("stopped"))
+	f.AfterFunc(2*time.Second, record("second"))
+
+	if !stopped.Stop() {
+		t.Fatal("Stop of a pending timer returned false")
+	}
+	if stopped.Stop() {
+		t.Error("second Stop returned true")
+	}
+	if got := f.Waiters(); got != 3 {
+		t.Errorf("Waiters = %d, want 3", got)
+	}
+
+	f.Advance(10 * time.Second)
+
+	want := []string{"first", "second", "third"}
+	if len(fired) != len(want) {
+		t.Fatalf("fired = %v, want %v", fired, want)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Errorf("fired[%d] = %q, want %q", i, fired[i], want[i])
+		}
+		// 回调执行时时钟停在各自的到期时间
+		if wantAt := testStart.Add(time.Duration(i+1) * time.Second); !firedAt[i].Equal(wantAt) {
+			t.Errorf("%s fired at %v, want %v", fired[i], firedAt[i], wantAt)
+		}
+	}
+	if got := f.Now(); !got.Equal(testStart.Add(10 * time.Second)) {
+		t.Errorf("Now = %v, want %v", got, testStart.Add(10*time.Second))
+	}
+	if got := f.Waiters(); got != 0 {
+		t.Errorf("Waiters = %d, want 0", got)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(testStart)
+	ticker := f.NewTicker(time.Minute)
+
+	// 接收方未及时读取时丢弃多余的 tick，与 time.Ticker 一致
+	f.Advance(3 * time.Minute)
+	select {
+	case tick := <-ticker.C():
+		if want := testStart.Add(time.Minute); !tick.Equal(want) {
+			t.Errorf("first tick at %v, want %v", tick, want)
+		}
+	default:
+		t.Fatal("no tick after three intervals")
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("unexpected buffered tick at %v", tick)
+	default:
+	}
+
+	f.Advance(time.Minute)
+	select {
+	case tick := <-ticker.C():
+		if want := testStart.Add(4 * time.Minute); !tick.Equal(want) {
+			t.Errorf("tick at %v, want %v", tick, want)
+		}
+	default:
+		t.Fatal("no tick after the next interval")
+	}
+
+	ticker.Stop()
+	f.Advance(time.Hour)
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("tick at %v after Stop", tick)
+	default:
+	}
+}
+
+func TestFakeSetNeverMovesBackwards(t *testing.T) {
+	f := NewFake(testStart)
+	f.Set(testStart.Add(-time.Hour))
+	if got := f.Now(); !got.Equal(testStart) {
+		t.Errorf("Now = %v, want %v", got, testStart)
+	}
+	if got := f.Since(testStart.Add(-time.Minute)); got != time.Minute {
+		t.Errorf("Since = %v, want 1m", got)
+	}
+	if got := f.Until(testStart.Add(time.Minute)); got != time.Minute {
+		t.Errorf("Until = %v, want 1m", got)
+	}
+}
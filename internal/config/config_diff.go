@@ -0,0 +1,166 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces the value of a changed secret in the reload diff.
+const redactedValue = "[REDACTED]"
+
+// redactedConfigFields 是包含凭据的配置项，差异中只记录是否变化，不记录值。
+// json 标签为 "-" 的字段同样视为敏感字段。
+var redactedConfigFields = map[string]bool{
+	"auth.key":                          true,
+	"auth.keys":                         true,
+	"database.dsn":                      true,
+	"clickhouse.dsn":                    true,
+	"key_pool.degraded_webhook_url":     true,
+	"key_pool.error_budget_webhook_url": true,
+	"payload_offload.alert_webhook_url": true,
+	"proxy.quarantine_webhook_url":      true,
+	"redis_dsn":                         true,
+	"server.siem_stream_url":            true,
+}
+
+// restartRequiredConfigFields 是只在启动时读取的配置项，重新加载后仍使用旧值，需要重启才能生效。
+var restartRequiredConfigFields = map[string]bool{
+	"server.port":                           true,
+	"server.host":                           true,
+	"server.read_timeout":                   true,
+	"server.write_timeout":                  true,
+	"server.idle_timeout":                   true,
+	"server.tls_cert_file":                  true,
+	"server.tls_key_file":                   true,
+	"server.tls_min_version":                true,
+	"database.dsn":                          true,
+	"redis_dsn":                             true,
+	"performance.max_concurrent_requests":   true,
+	"performance.load_shed_queue_threshold": true,
+	"performance.reserved_probe_slots":      true,
+	"performance.decompress_max_body_bytes": true,
+	"metrics.latency_buckets":               true,
+	"pprof.enabled":                         true,
+	"pprof.mutex_fraction":                  true,
+	"pprof.block_fraction":                  true,
+	"log.request_log_queue_size":            true,
+}
+
+// ConfigChange is a single configuration field that changed on reload.
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+	// RequiresRestart is set when the field is only read at startup.
+	RequiresRestart bool `json:"requires_restart,omitempty"`
+}
+
+// diffConfig returns the fields that differ between two configurations, named by their
+// JSON path (e.g. "server.port"), with secret values redacted.
+func diffConfig(previous, current *Config) []ConfigChange {
+	var changes []ConfigChange
+	diffConfigValues("", false, reflect.ValueOf(*previous), reflect.ValueOf(*current), &changes)
+	return changes
+}
+
+func diffConfigValues(path string, secret bool, previous, current reflect.Value, changes *[]ConfigChange) {
+	if previous.Kind() == reflect.Struct {
+		t := previous.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, fieldSecret := configFieldName(field)
+			if path != "" {
+				name = path + "." + name
+			}
+			diffConfigValues(name, secret || fieldSecret || redactedConfigFields[name], previous.Field(i), current.Field(i), changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(previous.Interface(), current.Interface()) {
+		return
+	}
+	change := ConfigChange{Field: path, Old: previous.Interface(), New: current.Interface(), RequiresRestart: restartRequiredConfigFields[path]}
+	if secret {
+		change.Old = redactConfigValue(previous)
+		change.New = redactConfigValue(current)
+	}
+	*changes = append(*changes, change)
+}
+
+// configFieldName returns the JSON name of a config field and whether it is excluded from JSON,
+// which marks it as a secret. Excluded fields are named in snake case.
+func configFieldName(field reflect.StructField) (string, bool) {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag == "-" {
+		return toSnakeCase(field.Name), true
+	}
+	if tag == "" {
+		return toSnakeCase(field.Name), false
+	}
+	return tag, false
+}
+
+// redactConfigValue hides a secret, keeping only whether it is set.
+func redactConfigValue(v reflect.Value) string {
+	if v.IsZero() {
+		return ""
+	}
+	return redactedValue
+}
+
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// logConfigDiff logs the configuration changes of a successful reload.
+func logConfigDiff(changes []ConfigChange) {
+	if len(changes) == 0 {
+		logrus.Info("Configuration reloaded, no changes")
+		return
+	}
+	fields := make([]string, 0, len(changes))
+	var restartFields []string
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+		entry := logrus.WithFields(logrus.Fields{
+			"field": change.Field,
+			"old":   change.Old,
+			"new":   change.New,
+		})
+		if change.RequiresRestart {
+			restartFields = append(restartFields, change.Field)
+			entry.Warn("Configuration changed, requires restart to take effect")
+			continue
+		}
+		entry.Info("Configuration changed")
+	}
+
+	// 汇总本次变更，便于在日志中一眼确认哪些配置已生效、哪些需要重启
+	summary := logrus.WithFields(logrus.Fields{
+		"count":   len(changes),
+		"changed": strings.Join(fields, ", "),
+	})
+	if len(restartFields) > 0 {
+		summary.WithField("requires_restart", strings.Join(restartFields, ", ")).
+			Warnf("Configuration reloaded, %d of %d changes require restart", len(restartFields), len(changes))
+		return
+	}
+	summary.Info("Configuration reloaded")
+}
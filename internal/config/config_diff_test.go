@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gpt-load/internal/types"
+)
+
+func TestDiffConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []ConfigChange
+	}{
+		{name: "unchanged", modify: func(c *Config) {}, want: nil},
+		{
+			name:   "plain field",
+			modify: func(c *Config) { c.Log.Level = "debug" },
+			want:   []ConfigChange{{Field: "log.level", Old: "info", New: "debug"}},
+		},
+		{
+			name:   "restart required field",
+			modify: func(c *Config) { c.Server.Port = 3002 },
+			want:   []ConfigChange{{Field: "server.port", Old: 3001, New: 3002, RequiresRestart: true}},
+		},
+		{
+			name:   "listed secret",
+			modify: func(c *Config) { c.Auth.Key = "sk-new" },
+			want:   []ConfigChange{{Field: "auth.key", Old: redactedValue, New: redactedValue}},
+		},
+		{
+			name:   "listed secret slice",
+			modify: func(c *Config) { c.Auth.Keys = append(c.Auth.Keys, "sk-new") },
+			want:   []ConfigChange{{Field: "auth.keys", Old: redactedValue, New: redactedValue}},
+		},
+		{
+			name:   "secret cleared keeps only that it was set",
+			modify: func(c *Config) { c.RedisDSN = "" },
+			want:   []ConfigChange{{Field: "redis_dsn", Old: redactedValue, New: "", RequiresRestart: true}},
+		},
+		{
+			name:   "field excluded from json is secret",
+			modify: func(c *Config) { c.Database.EncryptionKey = "0011" },
+			want:   []ConfigChange{{Field: "database.encryption_key", Old: "", New: redactedValue}},
+		},
+		{
+			name: "several fields in declaration order",
+			modify: func(c *Config) {
+				c.Server.Host = "127.0.0.1"
+				c.Log.Level = "warn"
+			},
+			want: []ConfigChange{
+				{Field: "server.host", Old: "0.0.0.0", New: "127.0.0.1", RequiresRestart: true},
+				{Field: "log.level", Old: "info", New: "warn"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := Config{
+				Server:   types.ServerConfig{Port: 3001, Host: "0.0.0.0"},
+				Auth:     types.AuthConfig{Key: "sk-old", Keys: []string{"sk-old"}},
+				Log:      types.LogConfig{Level: "info"},
+				RedisDSN: "redis://localhost:6379",
+			}
+			current := previous
+			current.Auth.Keys = append([]string(nil), previous.Auth.Keys...)
+			tt.modify(&current)
+
+			if got := diffConfig(&previous, &current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Level", want: "level"},
+		{in: "EncryptionKey", want: "encryption_key"},
+		{in: "OldEncryptionKey", want: "old_encryption_key"},
+		{in: "key", want: "key"},
+	}
+	for _, tt := range tests {
+		if got := toSnakeCase(tt.in); got != tt.want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
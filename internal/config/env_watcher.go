@@ -0,0 +1,169 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"gpt-load/internal/types"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	envFileName = ".env"
+	// envReloadDebounce 合并编辑器分多次写入产生的连续事件
+	envReloadDebounce = 100 * time.Millisecond
+)
+
+// EnvFileWatcher reloads the configuration when the .env file is written or recreated, and on SIGHUP.
+// The directory is watched rather than the file, so editors that save by replacing the file are covered.
+type EnvFileWatcher struct {
+	configManager types.ConfigManager
+	watcher       *fsnotify.Watcher
+	signals       chan os.Signal
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	reloadMu sync.Mutex
+	// onReload 在配置重新加载成功后依次调用，用于应用日志等启动时读取的配置
+	onReload []func()
+}
+
+// NewEnvFileWatcher creates a new EnvFileWatcher.
+func NewEnvFileWatcher(configManager types.ConfigManager) *EnvFileWatcher {
+	return &EnvFileWatcher{
+		configManager: configManager,
+		signals:       make(chan os.Signal, 1),
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// OnReload registers a function to call after each successful reload. It must be called before Start.
+func (w *EnvFileWatcher) OnReload(fn func()) {
+	w.onReload = append(w.onReload, fn)
+}
+
+// Start starts watching the .env file and listening for SIGHUP.
+func (w *EnvFileWatcher) Start() {
+	signal.Notify(w.signals, syscall.SIGHUP)
+
+	if w.configManager.GetEffectiveServerConfig().DisableEnvFileWatcher {
+		logrus.Info("Env file watcher is disabled, send SIGHUP to reload the configuration.")
+	} else if watcher, err := fsnotify.NewWatcher(); err != nil {
+		logrus.WithError(err).Warn("Failed to create the env file watcher, send SIGHUP to reload the configuration.")
+	} else if err := watcher.Add(filepath.Dir(envFileName)); err != nil {
+		logrus.WithError(err).Warn("Failed to watch the env file, send SIGHUP to reload the configuration.")
+		watcher.Close()
+	} else {
+		w.watcher = watcher
+	}
+
+	w.wg.Add(1)
+	go w.run()
+}
+
+// Stop stops watching and cancels a pending reload.
+func (w *EnvFileWatcher) Stop(ctx context.Context) {
+	signal.Stop(w.signals)
+	close(w.stopChan)
+	if w.watcher != nil {
+		w.watcher.Close()
+	}
+
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("EnvFileWatcher stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("EnvFileWatcher stop timed out.")
+	}
+}
+
+func (w *EnvFileWatcher) run() {
+	defer w.wg.Done()
+
+	// 未启用文件监听时 nil channel 永远不会就绪
+	var events chan fsnotify.Event
+	var errs chan error
+	if w.watcher != nil {
+		events = w.watcher.Events
+		errs = w.watcher.Errors
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if filepath.Base(event.Name) != envFileName || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			logrus.WithField("op", event.Op.String()).Info("Env file changed, reloading the configuration")
+			w.scheduleReload()
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			logrus.WithError(err).Warn("Env file watcher error")
+		case <-w.signals:
+			logrus.Info("Received SIGHUP, reloading the configuration")
+			w.reload()
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// scheduleReload reloads once no further change has arrived within the debounce interval.
+func (w *EnvFileWatcher) scheduleReload() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(envReloadDebounce, w.reload)
+}
+
+func (w *EnvFileWatcher) reload() {
+	select {
+	case <-w.stopChan:
+		return
+	default:
+	}
+
+	// 文件被替换的瞬间可能不存在，此时跳过，避免进入交互式创建 .env 的流程
+	if _, err := os.Stat(envFileName); err != nil {
+		logrus.WithError(err).Warn("Env file is not readable, skipping the configuration reload")
+		return
+	}
+
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	if err := w.configManager.ReloadConfig(); err != nil {
+		logrus.WithError(err).Error("Failed to reload the configuration, keeping the previous configuration")
+		return
+	}
+	for _, fn := range w.onReload {
+		fn()
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"gpt-load/internal/db"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/syncer"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+const FeatureFlagsUpdateChannel = "feature_flags:updated"
+
+// 已知功能开关名称
+const (
+	FlagQuotaPrecheck     = "quota_precheck"
+	FlagSuspectProbe      = "suspect_probe"
+	FlagClickHouseExport  = "clickhouse_export"
+	FlagMetadataInjection = "metadata_injection"
+	FlagReplayProtection  = "replay_protection"
+	FlagInferContentType  = "infer_content_type"
+)
+
+// Flag source values reported by ListFlags.
+const (
+	FlagSourceDefault = "default"
+	FlagSourceGlobal  = "global"
+	FlagSourceGroup   = "group"
+)
+
+// FeatureFlagDefinition describes a known feature flag and its compiled-in default.
+type FeatureFlagDefinition struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// featureFlagDefinitions 是所有已知功能开关及其默认值，新的高风险子系统应在此注册
+var featureFlagDefinitions = []FeatureFlagDefinition{
+	{Name: FlagQuotaPrecheck, Description: "选择密钥前查询上游余额（仍需 QUOTA_PRECHECK_ENABLED）", Default: true},
+	{Name: FlagSuspectProbe, Description: "密钥达到黑名单阈值后先探测确认再禁用，关闭时直接禁用", Default: true},
+	{Name: FlagClickHouseExport, Description: "将请求事件导出到 ClickHouse（仍需 CLICKHOUSE_DSN）", Default: true},
+	{Name: FlagMetadataInjection, Description: "向 JSON 响应注入代理元数据（仍需 INJECT_PROXY_METADATA）", Default: true},
+	{Name: FlagReplayProtection, Description: "要求代理请求携带 X-Nonce 并拒绝 NONCE_TTL_SECONDS（或 X-Idempotency-TTL 指定的时长）内重复的 nonce，需要客户端配合", Default: false},
+	{Name: FlagInferContentType, Description: "上游响应缺少 Content-Type 时根据响应体推断（JSON 或 SSE），关闭时原样透传", Default: false},
+}
+
+// FeatureFlagStatus is the resolved state of a flag, as returned by the admin API.
+type FeatureFlagStatus struct {
+	Name           string        `json:"name"`
+	Description    string        `json:"description"`
+	Default        bool          `json:"default"`
+	Value          bool          `json:"value"`
+	Source         string        `json:"source"`
+	GroupOverrides map[uint]bool `json:"group_overrides"`
+}
+
+// featureFlagSnapshot 是功能开关的内存快照，加载后只读
+type featureFlagSnapshot struct {
+	global map[string]bool
+	groups map[uint]map[string]bool
+}
+
+// FeatureFlagManager 管理运行时功能开关
+type FeatureFlagManager struct {
+	syncer      *syncer.CacheSyncer[featureFlagSnapshot]
+	definitions map[string]FeatureFlagDefinition
+}
+
+// NewFeatureFlagManager creates a new, uninitialized FeatureFlagManager.
+func NewFeatureFlagManager() *FeatureFlagManager {
+	definitions := make(map[string]FeatureFlagDefinition, len(featureFlagDefinitions))
+	for _, def := range featureFlagDefinitions {
+		definitions[def.Name] = def
+	}
+	return &FeatureFlagManager{definitions: definitions}
+}
+
+// Initialize loads the flag overrides and subscribes to updates from other instances.
+func (fm *FeatureFlagManager) Initialize(store store.Store) error {
+	loader := func() (featureFlagSnapshot, error) {
+		var overrides []models.FeatureFlagOverride
+		if err := db.DB.Find(&overrides).Error; err != nil {
+			return featureFlagSnapshot{}, fmt.Errorf("failed to load feature flags from db: %w", err)
+		}
+
+		snapshot := featureFlagSnapshot{
+			global: make(map[string]bool),
+			groups: make(map[uint]map[string]bool),
+		}
+		for _, o := range overrides {
+			if _, ok := fm.definitions[o.FlagName]; !ok {
+				logrus.Warnf("Ignoring override for unknown feature flag: %s", o.FlagName)
+				continue
+			}
+			if o.GroupID == 0 {
+				snapshot.global[o.FlagName] = o.Enabled
+				continue
+			}
+			if snapshot.groups[o.GroupID] == nil {
+				snapshot.groups[o.GroupID] = make(map[string]bool)
+			}
+			snapshot.groups[o.GroupID][o.FlagName] = o.Enabled
+		}
+		return snapshot, nil
+	}
+
+	s, err := syncer.NewCacheSyncer(
+		loader,
+		store,
+		FeatureFlagsUpdateChannel,
+		logrus.WithField("syncer", "feature_flags"),
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create feature flags syncer: %w", err)
+	}
+
+	fm.syncer = s
+	return nil
+}
+
+// Stop gracefully stops the FeatureFlagManager's background syncer.
+func (fm *FeatureFlagManager) Stop(ctx context.Context) {
+	if fm.syncer != nil {
+		fm.syncer.Stop()
+	}
+}
+
+// IsEnabled reports whether a flag is enabled for a group. A group ID of 0 resolves the global value.
+// 按分组覆盖 > 全局覆盖 > 默认值的顺序解析。
+func (fm *FeatureFlagManager) IsEnabled(name string, groupID uint) bool {
+	value, _ := fm.resolve(name, groupID)
+	return value
+}
+
+func (fm *FeatureFlagManager) resolve(name string, groupID uint) (bool, string) {
+	def, ok := fm.definitions[name]
+	if !ok {
+		return false, FlagSourceDefault
+	}
+	if fm.syncer == nil {
+		return def.Default, FlagSourceDefault
+	}
+
+	snapshot := fm.syncer.Get()
+	if groupID != 0 {
+		if value, ok := snapshot.groups[groupID][name]; ok {
+			return value, FlagSourceGroup
+		}
+	}
+	if value, ok := snapshot.global[name]; ok {
+		return value, FlagSourceGlobal
+	}
+	return def.Default, FlagSourceDefault
+}
+
+// ListFlags returns every known flag with its default, global value, source and group overrides.
+func (fm *FeatureFlagManager) ListFlags() []FeatureFlagStatus {
+	var snapshot featureFlagSnapshot
+	if fm.syncer != nil {
+		snapshot = fm.syncer.Get()
+	}
+
+	statuses := make([]FeatureFlagStatus, 0, len(featureFlagDefinitions))
+	for _, def := range featureFlagDefinitions {
+		value, source := fm.resolve(def.Name, 0)
+		overrides := make(map[uint]bool)
+		for groupID, flags := range snapshot.groups {
+			if v, ok := flags[def.Name]; ok {
+				overrides[groupID] = v
+			}
+		}
+		statuses = append(statuses, FeatureFlagStatus{
+			Name:           def.Name,
+			Description:    def.Description,
+			Default:        def.Default,
+			Value:          value,
+			Source:         source,
+			GroupOverrides: overrides,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// IsKnownFlag reports whether a flag name is registered.
+func (fm *FeatureFlagManager) IsKnownFlag(name string) bool {
+	_, ok := fm.definitions[name]
+	return ok
+}
+
+// SetFlag sets or clears (value == nil) the override of a flag, globally when groupID is 0,
+// and notifies all instances to reload.
+func (fm *FeatureFlagManager) SetFlag(name string, groupID uint, value *bool, updatedBy string) error {
+	if !fm.IsKnownFlag(name) {
+		return fmt.Errorf("unknown feature flag: %s", name)
+	}
+
+	if value == nil {
+		if err := db.DB.Where("flag_name = ? AND group_id = ?", name, groupID).Delete(&models.FeatureFlagOverride{}).Error; err != nil {
+			return fmt.Errorf("failed to clear feature flag override: %w", err)
+		}
+	} else {
+		override := models.FeatureFlagOverride{
+			FlagName:  name,
+			GroupID:   groupID,
+			Enabled:   *value,
+			UpdatedBy: updatedBy,
+		}
+		if err := db.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "flag_name"}, {Name: "group_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_by", "updated_at"}),
+		}).Create(&override).Error; err != nil {
+			return fmt.Errorf("failed to save feature flag override: %w", err)
+		}
+	}
+
+	if fm.syncer == nil {
+		return nil
+	}
+	// 触发所有实例重新加载
+	return fm.syncer.Invalidate()
+}
@@ -2,9 +2,9 @@ package config
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"gpt-load/internal/db"
+	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/store"
 	"gpt-load/internal/syncer"
@@ -12,6 +12,8 @@ import (
 	"gpt-load/internal/utils"
 	"os"
 	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -74,6 +76,16 @@ func (sm *SystemSettingsManager) Initialize(store store.Store, gm groupManager,
 		}
 
 		settings.ProxyKeysMap = utils.StringToSet(settings.ProxyKeys, ",")
+		overrides, err := utils.StringToMap(settings.DefaultGroupOverrides, ",", ":")
+		if err != nil {
+			logrus.Warnf("Ignoring invalid default_group_overrides: %v", err)
+		}
+		settings.DefaultGroupOverridesMap = overrides
+		prefixRoutes, err := utils.ParsePathPrefixRoutes(settings.PathPrefixRoutes)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid path_prefix_routes: %v", err)
+		}
+		settings.PathPrefixRoutesMap = prefixRoutes
 
 		sm.DisplaySystemConfig(settings)
 
@@ -215,25 +227,32 @@ func (sm *SystemSettingsManager) GetEffectiveConfig(groupConfigJSON datatypes.JS
 		return effectiveConfig
 	}
 
-	var groupConfig models.GroupConfig
-	groupConfigBytes, err := groupConfigJSON.MarshalJSON()
+	groupConfig, unknownFields, err := models.ParseGroupConfig(groupConfigJSON)
+	if len(unknownFields) > 0 {
+		logrus.Warnf("Ignoring unknown group config fields: %s", strings.Join(unknownFields, ", "))
+	}
 	if err != nil {
-		logrus.Warnf("Failed to marshal group config JSON, using system settings only. Error: %v", err)
+		logrus.Warnf("Failed to parse group config, using system settings only. Error: %v", err)
 		return effectiveConfig
 	}
-	if err := json.Unmarshal(groupConfigBytes, &groupConfig); err != nil {
-		logrus.Warnf("Failed to unmarshal group config, using system settings only. Error: %v", err)
-		return effectiveConfig
+
+	invalidFields := make(map[string]struct{})
+	for _, fieldErr := range groupConfig.Validate() {
+		logrus.Warnf("Ignoring invalid group config override %s: %s", fieldErr.Field, fieldErr.Message)
+		invalidFields[fieldErr.Field] = struct{}{}
 	}
 
 	gcv := reflect.ValueOf(groupConfig)
 	ecv := reflect.ValueOf(&effectiveConfig).Elem()
 
-	for i := range gcv.NumField() {
-		groupField := gcv.Field(i)
+	for _, field := range models.GroupConfigFields() {
+		if _, invalid := invalidFields[field.Key]; invalid {
+			continue
+		}
+		groupField := gcv.FieldByIndex(field.Field.Index)
 		if groupField.Kind() == reflect.Ptr && !groupField.IsNil() {
 			groupFieldValue := groupField.Elem()
-			effectiveField := ecv.FieldByName(gcv.Type().Field(i).Name)
+			effectiveField := ecv.FieldByName(field.Field.Name)
 			if effectiveField.IsValid() && effectiveField.CanSet() {
 				if effectiveField.Type() == groupFieldValue.Type() {
 					effectiveField.Set(groupFieldValue)
@@ -245,7 +264,7 @@ func (sm *SystemSettingsManager) GetEffectiveConfig(groupConfigJSON datatypes.JS
 	return effectiveConfig
 }
 
-// ValidateSettings 验证系统配置的有效性
+// ValidateSettings 验证系统配置的有效性，返回字段级错误
 func (sm *SystemSettingsManager) ValidateSettings(settingsMap map[string]any) error {
 	tempSettings := utils.DefaultSystemSettings()
 	v := reflect.ValueOf(&tempSettings).Elem()
@@ -259,10 +278,12 @@ func (sm *SystemSettingsManager) ValidateSettings(settingsMap map[string]any) er
 		}
 	}
 
+	var errs app_errors.ValidationErrors
 	for key, value := range settingsMap {
 		field, ok := jsonToField[key]
 		if !ok {
-			return fmt.Errorf("invalid setting key: %s", key)
+			errs.Add(key, "unknown setting key")
+			continue
 		}
 
 		validateTag := field.Tag.Get("validate")
@@ -272,11 +293,13 @@ func (sm *SystemSettingsManager) ValidateSettings(settingsMap map[string]any) er
 		case reflect.Int:
 			floatVal, ok := value.(float64)
 			if !ok {
-				return fmt.Errorf("invalid type for %s: expected a number, got %T", key, value)
+				errs.Add(key, fmt.Sprintf("expected a number, got %T", value))
+				continue
 			}
 			intVal := int(floatVal)
 			if floatVal != float64(intVal) {
-				return fmt.Errorf("invalid value for %s: must be an integer", key)
+				errs.Add(key, "must be an integer")
+				continue
 			}
 
 			// The 'required' check is implicitly handled by the type assertion above.
@@ -286,107 +309,97 @@ func (sm *SystemSettingsManager) ValidateSettings(settingsMap map[string]any) er
 					minValStr := strings.TrimPrefix(trimmedRule, "min=")
 					minVal, _ := strconv.Atoi(minValStr)
 					if intVal < minVal {
-						return fmt.Errorf("value for %s (%d) is below minimum value (%d)", key, intVal, minVal)
+						errs.Add(key, fmt.Sprintf("must be at least %d, got %d", minVal, intVal))
 					}
 				}
 			}
 		case reflect.Bool:
 			if _, ok := value.(bool); !ok {
-				return fmt.Errorf("invalid type for %s: expected a boolean, got %T", key, value)
+				errs.Add(key, fmt.Sprintf("expected a boolean, got %T", value))
 			}
 		case reflect.String:
 			strVal, ok := value.(string)
 			if !ok {
-				return fmt.Errorf("invalid type for %s: expected a string, got %T", key, value)
+				errs.Add(key, fmt.Sprintf("expected a string, got %T", value))
+				continue
 			}
 			for _, rule := range rules {
 				trimmedRule := strings.TrimSpace(rule)
 				if trimmedRule == "required" {
 					if strVal == "" {
-						return fmt.Errorf("value for %s is required", key)
+						errs.Add(key, "is required")
+					}
+				}
+				if strings.HasPrefix(trimmedRule, "oneof=") {
+					options := strings.Fields(strings.TrimPrefix(trimmedRule, "oneof="))
+					if !slices.Contains(options, strVal) {
+						errs.Add(key, fmt.Sprintf("must be one of: %s", strings.Join(options, ", ")))
 					}
 				}
 			}
-		default:
-			return fmt.Errorf("unsupported type for setting key validation: %s", key)
-		}
-	}
-
-	return nil
-}
-
-// ValidateGroupConfigOverrides validates a map of group-level configuration overrides.
-func (sm *SystemSettingsManager) ValidateGroupConfigOverrides(configMap map[string]any) error {
-	tempSettings := types.SystemSettings{}
-	v := reflect.ValueOf(&tempSettings).Elem()
-	t := v.Type()
-	jsonToField := make(map[string]reflect.StructField)
-	for i := range t.NumField() {
-		field := t.Field(i)
-		jsonTag := strings.Split(field.Tag.Get("json"), ",")[0]
-		if jsonTag != "" {
-			jsonToField[jsonTag] = field
-		}
-	}
-
-	for key, value := range configMap {
-		if value == nil {
-			continue
-		}
-
-		field, ok := jsonToField[key]
-		if !ok {
-			return fmt.Errorf("invalid setting key: %s", key)
-		}
-
-		validateTag := field.Tag.Get("validate")
-		rules := strings.Split(validateTag, ",")
-
-		switch field.Type.Kind() {
-		case reflect.Int:
-			floatVal, ok := value.(float64)
-			if !ok {
-				continue
+			if key == "default_group_overrides" {
+				if _, err := utils.StringToMap(strVal, ",", ":"); err != nil {
+					errs.Add(key, err.Error())
+				}
 			}
-			intVal := int(floatVal)
-			if floatVal != float64(intVal) {
-				return fmt.Errorf("invalid value for %s: must be an integer", key)
+			if key == "path_prefix_routes" {
+				if _, err := utils.ParsePathPrefixRoutes(strVal); err != nil {
+					errs.Add(key, err.Error())
+				}
 			}
-
-			// The 'required' check is implicitly handled by the type assertion above.
-			for _, rule := range rules {
-				trimmedRule := strings.TrimSpace(rule)
-				if strings.HasPrefix(trimmedRule, "min=") {
-					minValStr := strings.TrimPrefix(trimmedRule, "min=")
-					minVal, _ := strconv.Atoi(minValStr)
-					if intVal < minVal {
-						return fmt.Errorf("value for %s (%d) is below minimum value (%d)", key, intVal, minVal)
-					}
+			if key == "notification_digest_overrides" || key == "notification_format_overrides" {
+				if err := validateNotificationOverrides(key, strVal); err != nil {
+					errs.Add(key, err.Error())
 				}
 			}
-		case reflect.String:
-			strVal, ok := value.(string)
-			if !ok {
-				continue
+			if key == "embeddings_allowed_dimensions" {
+				if _, err := models.ParseEmbeddingDimensions(strVal); err != nil {
+					errs.Add(key, err.Error())
+				}
 			}
-			for _, rule := range rules {
-				trimmedRule := strings.TrimSpace(rule)
-				if trimmedRule == "required" {
-					if strVal == "" {
-						return fmt.Errorf("value for %s is required", key)
-					}
+			if key == "retry_status_codes" {
+				if _, err := models.ParseRetryStatusCodes(strVal); err != nil {
+					errs.Add(key, err.Error())
 				}
 			}
-		case reflect.Bool:
-			_, ok := value.(bool)
-			if !ok {
-				return fmt.Errorf("invalid type for %s: expected boolean, got %T", key, value)
+			if key == "azure_deployments" {
+				if _, err := models.ParseAzureDeployments(strVal); err != nil {
+					errs.Add(key, err.Error())
+				}
 			}
 		default:
-			// Do not validate other types for group overrides
+			errs.Add(key, "unsupported setting type")
 		}
 	}
 
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return errs
+	}
+	return nil
+}
+
+// notificationChannels are the channels accepted in the notification override settings.
+var notificationChannels = []string{"pool_degraded", "upstream_quarantine", "payload_offload", "key_error_budget"}
+
+// validateNotificationOverrides checks a channel:value list of a notification override setting.
+func validateNotificationOverrides(key, value string) error {
+	overrides, err := utils.StringToMap(value, ",", ":")
+	if err != nil {
+		return err
+	}
+	for channel, override := range overrides {
+		if !slices.Contains(notificationChannels, channel) {
+			return fmt.Errorf("unknown channel %q, expected one of: %s", channel, strings.Join(notificationChannels, ", "))
+		}
+		if key == "notification_format_overrides" {
+			if override != "json" && override != "slack" {
+				return fmt.Errorf("format of %s must be json or slack", channel)
+			}
+		} else if minutes, err := strconv.Atoi(override); err != nil || minutes < 0 {
+			return fmt.Errorf("digest minutes of %s must be a non-negative integer", channel)
+		}
+	}
 	return nil
 }
 
@@ -396,6 +409,12 @@ func (sm *SystemSettingsManager) DisplaySystemConfig(settings types.SystemSettin
 	logrus.Info("========= System Settings =========")
 	logrus.Info("  --- Basic Settings ---")
 	logrus.Infof("    App URL: %s", settings.AppUrl)
+	if settings.DefaultGroup != "" {
+		logrus.Infof("    Default Group (/v1): %s", settings.DefaultGroup)
+	}
+	if settings.PathPrefixRoutes != "" {
+		logrus.Infof("    Path Prefix Routes: %s", settings.PathPrefixRoutes)
+	}
 	logrus.Infof("    Request Log Retention: %d days", settings.RequestLogRetentionDays)
 	logrus.Infof("    Request Log Write Interval: %d minutes", settings.RequestLogWriteIntervalMinutes)
 
@@ -406,11 +425,26 @@ func (sm *SystemSettingsManager) DisplaySystemConfig(settings types.SystemSettin
 	logrus.Infof("    Idle Connection Timeout: %d seconds", settings.IdleConnTimeout)
 	logrus.Infof("    Max Idle Connections: %d", settings.MaxIdleConns)
 	logrus.Infof("    Max Idle Connections Per Host: %d", settings.MaxIdleConnsPerHost)
+	if settings.GroupRateLimitRPM > 0 {
+		logrus.Infof("    Group Rate Limit: %d requests/minute", settings.GroupRateLimitRPM)
+	}
 
 	logrus.Info("  --- Key & Group Behavior ---")
 	logrus.Infof("    Max Retries: %d", settings.MaxRetries)
+	logrus.Infof("    Retry Backoff: %d ms", settings.RetryBackoffMs)
 	logrus.Infof("    Blacklist Threshold: %d", settings.BlacklistThreshold)
 	logrus.Infof("    Key Validation Interval: %d minutes", settings.KeyValidationIntervalMinutes)
+	if settings.KeyHealthCheckIntervalMinutes > 0 {
+		logrus.Infof("    Key Health Check: every %d minutes, disable after %d failures", settings.KeyHealthCheckIntervalMinutes, settings.KeyHealthCheckFailureThreshold)
+	}
+
+	logrus.Info("  --- Notifications ---")
+	if settings.NotificationDigestMinutes > 0 {
+		logrus.Infof("    Digest: every %d minutes (%s events and above sent immediately)", settings.NotificationDigestMinutes, settings.NotificationBypassSeverity)
+	} else {
+		logrus.Info("    Digest: disabled (events sent immediately)")
+	}
+	logrus.Infof("    Format: %s", settings.NotificationFormat)
 	logrus.Info("====================================")
 	logrus.Info("")
 }
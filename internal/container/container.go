@@ -4,16 +4,24 @@ package container
 import (
 	"gpt-load/internal/app"
 	"gpt-load/internal/channel"
+	"gpt-load/internal/clock"
 	"gpt-load/internal/config"
 	"gpt-load/internal/db"
 	"gpt-load/internal/handler"
+	"gpt-load/internal/hosthealth"
 	"gpt-load/internal/httpclient"
 	"gpt-load/internal/keypool"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/notify"
 	"gpt-load/internal/proxy"
 	"gpt-load/internal/router"
+	appruntime "gpt-load/internal/runtime"
 	"gpt-load/internal/services"
+	"gpt-load/internal/siem"
 	"gpt-load/internal/store"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/dig"
 )
 
@@ -22,21 +30,43 @@ func BuildContainer() (*dig.Container, error) {
 	container := dig.New()
 
 	// Infrastructure Services
+	if err := container.Provide(clock.New); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(config.NewManager); err != nil {
 		return nil, err
 	}
+	// 指标收集器注册到默认注册表，测试时可替换为新的注册表
+	if err := container.Provide(func() prometheus.Registerer { return prometheus.DefaultRegisterer }); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(metrics.NewMetrics); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(config.NewEnvFileWatcher); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(db.NewDB); err != nil {
 		return nil, err
 	}
 	if err := container.Provide(config.NewSystemSettingsManager); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(config.NewFeatureFlagManager); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(store.NewStore); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(appruntime.NewGoroutinePool); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(httpclient.NewHTTPClientManager); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(hosthealth.NewChecker); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(channel.NewFactory); err != nil {
 		return nil, err
 	}
@@ -57,21 +87,84 @@ func BuildContainer() (*dig.Container, error) {
 	if err := container.Provide(services.NewKeyDeleteService); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(services.NewStatsBackfillService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewRequestLogPartitionService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewPayloadOffloadService); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(services.NewLogService); err != nil {
 		return nil, err
 	}
 	if err := container.Provide(services.NewLogCleanupService); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(services.NewClickHouseExporter); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewRecordingService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewKeySyncService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewGroupDeletionService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewGroupRequestTracker); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(services.NewRequestLogService); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(services.NewStatsCounterService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewResponseSizeStats); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(services.NewGroupManager); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(siem.NewStreamer); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewAdminAuditService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(notify.NewNotifier); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewGeoRoutingService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewUpstreamHealthService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewProviderBreakerService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewGroupRateLimitService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewClientQuotaService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(keypool.NewPoolViabilityChecker); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(keypool.NewKeyEventStream); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(keypool.NewProvider); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(keypool.NewQuotaChecker); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(keypool.NewKeyValidator); err != nil {
 		return nil, err
 	}
@@ -88,6 +181,12 @@ func BuildContainer() (*dig.Container, error) {
 	}
 
 	// Proxy & Router
+	if err := container.Provide(middleware.NewInFlightTracker); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(middleware.NewProxyMetrics); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(proxy.NewProxyServer); err != nil {
 		return nil, err
 	}
@@ -2,14 +2,19 @@ package db
 
 import (
 	"fmt"
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
 	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -25,6 +30,10 @@ func NewDB(configManager types.ConfigManager) (*gorm.DB, error) {
 		return nil, fmt.Errorf("DATABASE_DSN is not configured")
 	}
 
+	if err := setupKeyEncryption(dbConfig); err != nil {
+		return nil, err
+	}
+
 	var newLogger logger.Interface
 	if configManager.GetLogConfig().Level == "debug" {
 		newLogger = logger.New(
@@ -57,7 +66,7 @@ func NewDB(configManager types.ConfigManager) (*gorm.DB, error) {
 		if err := os.MkdirAll(filepath.Dir(dsn), 0755); err != nil {
 			return nil, fmt.Errorf("failed to create database directory: %w", err)
 		}
-		dialector = sqlite.Open(dsn + "?_busy_timeout=5000")
+		dialector = sqlite.Open(sqliteDSN(dsn, dbConfig))
 	}
 
 	var err error
@@ -66,7 +75,7 @@ func NewDB(configManager types.ConfigManager) (*gorm.DB, error) {
 		PrepareStmt: true,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, utils.NewStartupError(utils.StartupErrDBUnreachable, fmt.Errorf("failed to connect to database: %w", err))
 	}
 
 	sqlDB, err := DB.DB()
@@ -78,5 +87,53 @@ func NewDB(configManager types.ConfigManager) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(500)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	if dbConfig.SQLiteWAL && utils.IsSQLiteDSN(dbConfig.DSN) {
+		var journalMode string
+		if err := DB.Raw("PRAGMA journal_mode").Scan(&journalMode).Error; err != nil {
+			logrus.Warnf("Failed to read SQLite journal mode: %v", err)
+		} else if !strings.EqualFold(journalMode, "wal") {
+			// 例如内存数据库不支持 WAL
+			logrus.Warnf("SQLite WAL mode requested but journal mode is %q", journalMode)
+		}
+	}
+
+	utils.EmitStartupEvent("db_connected", nil)
 	return DB, nil
 }
+
+// sqliteDSN adds the connection pragmas to a SQLite DSN. The driver runs each _pragma
+// on every new connection, so the busy timeout applies to the whole pool.
+func sqliteDSN(dsn string, dbConfig types.DatabaseConfig) string {
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", dbConfig.SQLiteBusyTimeoutMs))
+	if dbConfig.SQLiteWAL {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + params.Encode()
+}
+
+// setupKeyEncryption enables encryption of stored API keys when DB_ENCRYPTION_KEY is set.
+func setupKeyEncryption(dbConfig types.DatabaseConfig) error {
+	if dbConfig.EncryptionKey == "" {
+		models.SetKeyCiphers(nil, nil)
+		return nil
+	}
+
+	current, err := encryption.NewCipher(dbConfig.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("invalid DB_ENCRYPTION_KEY: %w", err)
+	}
+	var old *encryption.Cipher
+	if dbConfig.OldEncryptionKey != "" {
+		if old, err = encryption.NewCipher(dbConfig.OldEncryptionKey); err != nil {
+			return fmt.Errorf("invalid DB_OLD_ENCRYPTION_KEY: %w", err)
+		}
+	}
+	models.SetKeyCiphers(current, old)
+	return nil
+}
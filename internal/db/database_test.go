@@ -0,0 +1,69 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/types"
+)
+
+// stubConfigManager returns fixed database and log configuration. Other methods are not
+// implemented and panic when called.
+type stubConfigManager struct {
+	types.ConfigManager
+	database types.DatabaseConfig
+}
+
+func (m *stubConfigManager) GetDatabaseConfig() types.DatabaseConfig { return m.database }
+func (m *stubConfigManager) GetLogConfig() types.LogConfig           { return types.LogConfig{Level: "error"} }
+
+func TestNewDBSQLitePragmas(t *testing.T) {
+	tests := []struct {
+		name            string
+		wal             bool
+		busyTimeoutMs   int
+		wantJournalMode string
+	}{
+		{name: "wal enabled", wal: true, busyTimeoutMs: 5000, wantJournalMode: "wal"},
+		{name: "wal disabled", wal: false, busyTimeoutMs: 1234, wantJournalMode: "delete"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := filepath.Join(t.TempDir(), "data", "gpt-load.db")
+			db, err := NewDB(&stubConfigManager{database: types.DatabaseConfig{
+				DSN:                 dsn,
+				SQLiteWAL:           tt.wal,
+				SQLiteBusyTimeoutMs: tt.busyTimeoutMs,
+			}})
+			if err != nil {
+				t.Fatalf("NewDB() error = %v", err)
+			}
+			sqlDB, err := db.DB()
+			if err != nil {
+				t.Fatalf("DB() error = %v", err)
+			}
+			t.Cleanup(func() { sqlDB.Close() })
+
+			// 连接池中每个新连接都应用相同的 pragma，占用多个连接以覆盖新建的连接
+			sqlDB.SetMaxIdleConns(0)
+			for i := 0; i < 3; i++ {
+				var journalMode string
+				if err := db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error; err != nil {
+					t.Fatalf("PRAGMA journal_mode error = %v", err)
+				}
+				if !strings.EqualFold(journalMode, tt.wantJournalMode) {
+					t.Errorf("journal_mode = %q, want %q", journalMode, tt.wantJournalMode)
+				}
+				var busyTimeout int
+				if err := db.Raw("PRAGMA busy_timeout").Scan(&busyTimeout).Error; err != nil {
+					t.Fatalf("PRAGMA busy_timeout error = %v", err)
+				}
+				if busyTimeout != tt.busyTimeoutMs {
+					t.Errorf("busy_timeout = %d, want %d", busyTimeout, tt.busyTimeoutMs)
+				}
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ type APIError struct {
 	HTTPStatus int
 	Code       string
 	Message    string
+	Details    any
 }
 
 // Error implements the error interface.
@@ -24,20 +25,30 @@ func (e *APIError) Error() string {
 
 // Predefined API errors
 var (
-	ErrBadRequest         = &APIError{HTTPStatus: http.StatusBadRequest, Code: "BAD_REQUEST", Message: "Invalid request parameters"}
-	ErrInvalidJSON        = &APIError{HTTPStatus: http.StatusBadRequest, Code: "INVALID_JSON", Message: "Invalid JSON format"}
-	ErrValidation         = &APIError{HTTPStatus: http.StatusBadRequest, Code: "VALIDATION_FAILED", Message: "Input validation failed"}
-	ErrDuplicateResource  = &APIError{HTTPStatus: http.StatusConflict, Code: "DUPLICATE_RESOURCE", Message: "Resource already exists"}
-	ErrResourceNotFound   = &APIError{HTTPStatus: http.StatusNotFound, Code: "NOT_FOUND", Message: "Resource not found"}
-	ErrInternalServer     = &APIError{HTTPStatus: http.StatusInternalServerError, Code: "INTERNAL_SERVER_ERROR", Message: "An unexpected error occurred"}
-	ErrDatabase           = &APIError{HTTPStatus: http.StatusInternalServerError, Code: "DATABASE_ERROR", Message: "Database operation failed"}
-	ErrUnauthorized       = &APIError{HTTPStatus: http.StatusUnauthorized, Code: "UNAUTHORIZED", Message: "Authentication failed"}
-	ErrForbidden          = &APIError{HTTPStatus: http.StatusForbidden, Code: "FORBIDDEN", Message: "You do not have permission to access this resource"}
-	ErrTaskInProgress     = &APIError{HTTPStatus: http.StatusConflict, Code: "TASK_IN_PROGRESS", Message: "A task is already in progress"}
-	ErrBadGateway         = &APIError{HTTPStatus: http.StatusBadGateway, Code: "BAD_GATEWAY", Message: "Upstream service error"}
-	ErrNoActiveKeys       = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "NO_ACTIVE_KEYS", Message: "No active API keys available for this group"}
-	ErrMaxRetriesExceeded = &APIError{HTTPStatus: http.StatusBadGateway, Code: "MAX_RETRIES_EXCEEDED", Message: "Request failed after maximum retries"}
-	ErrNoKeysAvailable    = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "NO_KEYS_AVAILABLE", Message: "No API keys available to process the request"}
+	ErrBadRequest          = &APIError{HTTPStatus: http.StatusBadRequest, Code: "BAD_REQUEST", Message: "Invalid request parameters"}
+	ErrInvalidJSON         = &APIError{HTTPStatus: http.StatusBadRequest, Code: "INVALID_JSON", Message: "Invalid JSON format"}
+	ErrValidation          = &APIError{HTTPStatus: http.StatusBadRequest, Code: "VALIDATION_FAILED", Message: "Input validation failed"}
+	ErrDuplicateResource   = &APIError{HTTPStatus: http.StatusConflict, Code: "DUPLICATE_RESOURCE", Message: "Resource already exists"}
+	ErrResourceNotFound    = &APIError{HTTPStatus: http.StatusNotFound, Code: "NOT_FOUND", Message: "Resource not found"}
+	ErrInternalServer      = &APIError{HTTPStatus: http.StatusInternalServerError, Code: "INTERNAL_SERVER_ERROR", Message: "An unexpected error occurred"}
+	ErrDatabase            = &APIError{HTTPStatus: http.StatusInternalServerError, Code: "DATABASE_ERROR", Message: "Database operation failed"}
+	ErrUnauthorized        = &APIError{HTTPStatus: http.StatusUnauthorized, Code: "UNAUTHORIZED", Message: "Authentication failed"}
+	ErrForbidden           = &APIError{HTTPStatus: http.StatusForbidden, Code: "FORBIDDEN", Message: "You do not have permission to access this resource"}
+	ErrTaskInProgress      = &APIError{HTTPStatus: http.StatusConflict, Code: "TASK_IN_PROGRESS", Message: "A task is already in progress"}
+	ErrGroupHasTraffic     = &APIError{HTTPStatus: http.StatusConflict, Code: "GROUP_HAS_RECENT_TRAFFIC", Message: "Group has recent traffic"}
+	ErrGroupMaintenance    = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "GROUP_MAINTENANCE", Message: "Group is scheduled for deletion"}
+	ErrBadGateway          = &APIError{HTTPStatus: http.StatusBadGateway, Code: "BAD_GATEWAY", Message: "Upstream service error"}
+	ErrNoActiveKeys        = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "NO_ACTIVE_KEYS", Message: "No active API keys available for this group"}
+	ErrMaxRetriesExceeded  = &APIError{HTTPStatus: http.StatusBadGateway, Code: "MAX_RETRIES_EXCEEDED", Message: "Request failed after maximum retries"}
+	ErrNoKeysAvailable     = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "NO_KEYS_AVAILABLE", Message: "No API keys available to process the request"}
+	ErrPoolDegraded        = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "POOL_DEGRADED", Message: "Key pool is below its minimum viable size"}
+	ErrShuttingDown        = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "SHUTTING_DOWN", Message: "Server is shutting down"}
+	ErrNonceReused         = &APIError{HTTPStatus: http.StatusConflict, Code: "NONCE_REUSED", Message: "The X-Nonce value has already been used"}
+	ErrNoDefaultGroup      = &APIError{HTTPStatus: http.StatusNotFound, Code: "DEFAULT_GROUP_NOT_CONFIGURED", Message: "No default group is configured for /v1 requests; use /proxy/<group>/v1 or configure a default group"}
+	ErrClientQuotaExceeded = &APIError{HTTPStatus: http.StatusTooManyRequests, Code: "CLIENT_QUOTA_EXCEEDED", Message: "Monthly request quota exceeded for this proxy key"}
+	ErrRequestTooLarge     = &APIError{HTTPStatus: http.StatusRequestEntityTooLarge, Code: "REQUEST_TOO_LARGE", Message: "Request body is too large"}
+	ErrGroupRateLimited    = &APIError{HTTPStatus: http.StatusTooManyRequests, Code: "GROUP_RATE_LIMITED", Message: "Request rate limit exceeded for this group"}
+	ErrProviderUnavailable = &APIError{HTTPStatus: http.StatusServiceUnavailable, Code: "PROVIDER_UNAVAILABLE", Message: "Upstream provider is failing, requests are paused until a probe succeeds"}
 )
 
 // NewAPIError creates a new APIError with a custom message.
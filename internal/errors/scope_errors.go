@@ -0,0 +1,29 @@
+package errors
+
+import "strings"
+
+// scopeMismatchSubstrings identify OpenAI errors caused by a key's organization or project
+// headers not matching the key, rather than by the key itself being invalid.
+var scopeMismatchSubstrings = []string{
+	"mismatched_project",
+	"mismatched_organization",
+	"header should match project",
+	"header should match organization",
+}
+
+// IsScopeMismatch checks if the given error message reports an organization or project mismatch.
+func IsScopeMismatch(errorMsg string) bool {
+	if errorMsg == "" {
+		return false
+	}
+
+	errorLower := strings.ToLower(errorMsg)
+
+	for _, pattern := range scopeMismatchSubstrings {
+		if strings.Contains(errorLower, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
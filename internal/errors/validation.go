@@ -0,0 +1,47 @@
+package errors
+
+import (
+	"strings"
+)
+
+// FieldError describes a validation failure for a single field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is a list of field-level validation failures.
+type ValidationErrors []FieldError
+
+// Error implements the error interface.
+func (e ValidationErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add appends a new field error.
+func (e *ValidationErrors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// WithPrefix returns a copy of the errors with every field path prefixed, e.g. "config.request_timeout".
+func (e ValidationErrors) WithPrefix(prefix string) ValidationErrors {
+	prefixed := make(ValidationErrors, len(e))
+	for i, fe := range e {
+		prefixed[i] = FieldError{Field: prefix + "." + fe.Field, Message: fe.Message}
+	}
+	return prefixed
+}
+
+// NewValidationError creates an APIError carrying field-level details.
+func NewValidationError(errs ValidationErrors) *APIError {
+	return &APIError{
+		HTTPStatus: ErrValidation.HTTPStatus,
+		Code:       ErrValidation.Code,
+		Message:    errs.Error(),
+		Details:    errs,
+	}
+}
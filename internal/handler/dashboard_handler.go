@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"fmt"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -102,6 +106,18 @@ func (s *Server) Stats(c *gin.Context) {
 		},
 	}
 
+	if s.ClientQuota.Limit() > 0 {
+		clientQuotas, err := s.ClientQuota.Stats()
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, "failed to get client quotas"))
+			return
+		}
+		stats.ClientQuotas = clientQuotas
+	}
+	if s.HostHealth.Enabled() {
+		stats.UpstreamHosts = s.HostHealth.Stats()
+	}
+
 	response.Success(c, stats)
 }
 
@@ -168,6 +184,41 @@ func (s *Server) Chart(c *gin.Context) {
 	response.Success(c, chartData)
 }
 
+// GroupCountersResponse holds the aggregate counters of a single group.
+type GroupCountersResponse struct {
+	GroupID uint `json:"group_id"`
+	services.GroupCounters
+}
+
+// CountersResponse defines the aggregate request counters since the counters were first recorded.
+type CountersResponse struct {
+	TotalRequests int64                   `json:"total_requests"`
+	TotalFailures int64                   `json:"total_failures"`
+	Groups        []GroupCountersResponse `json:"groups"`
+}
+
+// Counters Get aggregate request counters
+func (s *Server) Counters(c *gin.Context) {
+	snapshot := s.StatsCounter.Snapshot()
+
+	resp := CountersResponse{Groups: make([]GroupCountersResponse, 0, len(snapshot))}
+	for groupID, counters := range snapshot {
+		resp.TotalRequests += counters.RequestCount
+		resp.TotalFailures += counters.FailureCount
+		resp.Groups = append(resp.Groups, GroupCountersResponse{GroupID: groupID, GroupCounters: counters})
+	}
+	sort.Slice(resp.Groups, func(i, j int) bool {
+		return resp.Groups[i].GroupID < resp.Groups[j].GroupID
+	})
+
+	response.Success(c, resp)
+}
+
+// ResponseSizes returns the per-model response body sizes against PROXY_BUFFER_THRESHOLD_BYTES.
+func (s *Server) ResponseSizes(c *gin.Context) {
+	response.Success(c, s.ResponseSizeStats.Report())
+}
+
 type hourlyStatResult struct {
 	TotalRequests int64
 	TotalFailures int64
@@ -192,7 +243,7 @@ func (s *Server) getRPMStats(now time.Time) (models.StatCard, error) {
 	twentyMinutesAgo := now.Add(-20 * time.Minute)
 
 	var result rpmStatResult
-	err := s.DB.Model(&models.RequestLog{}).
+	err := s.LogService.LogsBetween(twentyMinutesAgo, now).
 		Select("count(case when timestamp >= ? then 1 end) as current_requests, count(case when timestamp >= ? and timestamp < ? then 1 end) as previous_requests", tenMinutesAgo, twentyMinutesAgo, tenMinutesAgo).
 		Where("timestamp >= ? AND request_type = ?", twentyMinutesAgo, models.RequestTypeFinal).
 		Scan(&result).Error
@@ -220,3 +271,58 @@ func (s *Server) getRPMStats(now time.Time) (models.StatCard, error) {
 		TrendIsGrowth: rpmTrendIsGrowth,
 	}, nil
 }
+
+// BackfillStats rebuilds the hourly group rollups from the request logs between from and to
+// (RFC 3339, to defaults to now) as a background task. With verify=true it instead compares
+// the rollups of up to sample hours (default 24) against the raw logs and returns the rows
+// that differ.
+func (s *Server) BackfillStats(c *gin.Context) {
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "to must be an RFC 3339 time"))
+			return
+		}
+		to = parsed
+	}
+	value := c.Query("from")
+	if value == "" {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "from is required"))
+		return
+	}
+	from, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "from must be an RFC 3339 time"))
+		return
+	}
+	if _, _, err := services.NormalizeStatsRange(from, to); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if c.Query("verify") == "true" {
+		sample := 24
+		if value := c.Query("sample"); value != "" {
+			sample, err = strconv.Atoi(value)
+			if err != nil || sample <= 0 || sample > services.StatsVerifyMaxSample {
+				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("sample must be between 1 and %d", services.StatsVerifyMaxSample)))
+				return
+			}
+		}
+		result, err := s.StatsBackfill.VerifyRollups(from, to, sample)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, err.Error()))
+			return
+		}
+		response.Success(c, result)
+		return
+	}
+
+	taskStatus, err := s.StatsBackfill.StartBackfillTask(from, to)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrTaskInProgress, err.Error()))
+		return
+	}
+	response.Success(c, taskStatus)
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"gpt-load/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClickHouseSchemaResponse holds the DDL of the ClickHouse event table.
+type ClickHouseSchemaResponse struct {
+	Enabled bool   `json:"enabled"`
+	SQL     string `json:"sql"`
+}
+
+// GetClickHouseSchema returns the CREATE TABLE statement for the ClickHouse event exporter.
+func (s *Server) GetClickHouseSchema(c *gin.Context) {
+	response.Success(c, ClickHouseSchemaResponse{
+		Enabled: s.EventExporter.Enabled(),
+		SQL:     s.EventExporter.SchemaSQL(),
+	})
+}
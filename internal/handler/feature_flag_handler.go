@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// UpdateFeatureFlagRequest sets or clears a feature flag override.
+// GroupID 为 0 时修改全局值；Value 为 null 时清除覆盖，回退到上一级。
+type UpdateFeatureFlagRequest struct {
+	Name    string `json:"name"`
+	GroupID uint   `json:"group_id"`
+	Value   *bool  `json:"value"`
+}
+
+// ListFeatureFlags returns every known feature flag with its default, current value and source.
+func (s *Server) ListFeatureFlags(c *gin.Context) {
+	response.Success(c, s.FeatureFlags.ListFlags())
+}
+
+// UpdateFeatureFlag sets or clears a global or per-group feature flag override.
+func (s *Server) UpdateFeatureFlag(c *gin.Context) {
+	var req UpdateFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var errs app_errors.ValidationErrors
+	if req.Name == "" {
+		errs.Add("name", "is required")
+	} else if !s.FeatureFlags.IsKnownFlag(req.Name) {
+		errs.Add("name", fmt.Sprintf("unknown feature flag: %s", req.Name))
+	}
+	if len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	if req.GroupID != 0 {
+		var group models.Group
+		if err := s.DB.Select("id").First(&group, req.GroupID).Error; err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+	}
+
+	previous := s.FeatureFlags.IsEnabled(req.Name, req.GroupID)
+	if err := s.FeatureFlags.SetFlag(req.Name, req.GroupID, req.Value, c.ClientIP()); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, err.Error()))
+		return
+	}
+
+	fields := logrus.Fields{
+		"flag":     req.Name,
+		"groupID":  req.GroupID,
+		"previous": previous,
+		"clientIP": c.ClientIP(),
+	}
+	if req.Value != nil {
+		fields["value"] = *req.Value
+	} else {
+		fields["value"] = "cleared"
+	}
+	logrus.WithFields(fields).Warn("Feature flag updated")
+
+	response.Success(c, s.FeatureFlags.ListFlags())
+}
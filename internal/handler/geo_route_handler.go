@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countryCodePattern matches ISO 3166-1 alpha-2 country codes as reported by GeoLite2.
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// GeoRouteRequest defines the payload for creating or updating a geo route rule.
+type GeoRouteRequest struct {
+	CountryCode string `json:"country_code"`
+	KeyGroupID  uint   `json:"key_group_id"`
+}
+
+// validateGeoRouteRequest normalizes and validates a rule, checking that the target group exists.
+func (s *Server) validateGeoRouteRequest(req *GeoRouteRequest) app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	req.CountryCode = strings.ToUpper(strings.TrimSpace(req.CountryCode))
+	if !countryCodePattern.MatchString(req.CountryCode) {
+		errs.Add("country_code", "must be a two-letter ISO 3166-1 country code")
+	}
+	if req.KeyGroupID == 0 {
+		errs.Add("key_group_id", "is required")
+	} else {
+		var group models.Group
+		if err := s.DB.Select("id").First(&group, req.KeyGroupID).Error; err != nil {
+			errs.Add("key_group_id", "group does not exist")
+		}
+	}
+	return errs
+}
+
+// ListGeoRoutes returns all geo route rules.
+func (s *Server) ListGeoRoutes(c *gin.Context) {
+	rules, err := s.GeoRouting.ListRules()
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, rules)
+}
+
+// CreateGeoRoute adds a rule mapping a caller country to a group.
+func (s *Server) CreateGeoRoute(c *gin.Context) {
+	var req GeoRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if errs := s.validateGeoRouteRequest(&req); len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	rule := models.GeoRouteRule{CountryCode: req.CountryCode, KeyGroupID: req.KeyGroupID}
+	if err := s.GeoRouting.CreateRule(&rule); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, rule)
+}
+
+// UpdateGeoRoute changes the country or group of a geo route rule.
+func (s *Server) UpdateGeoRoute(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid geo route ID format"))
+		return
+	}
+
+	var req GeoRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if errs := s.validateGeoRouteRequest(&req); len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	var rule models.GeoRouteRule
+	if err := s.DB.First(&rule, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	rule.CountryCode = req.CountryCode
+	rule.KeyGroupID = req.KeyGroupID
+	if err := s.GeoRouting.UpdateRule(&rule); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, rule)
+}
+
+// DeleteGeoRoute removes a geo route rule.
+func (s *Server) DeleteGeoRoute(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid geo route ID format"))
+		return
+	}
+
+	if err := s.GeoRouting.DeleteRule(uint(id)); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, nil)
+}
@@ -3,6 +3,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -11,9 +12,11 @@ import (
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
 	"gpt-load/internal/utils"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -85,10 +88,35 @@ func isValidGroupName(name string) bool {
 		return false
 	}
 	// 允许使用小写字母、数字、下划线和中划线，长度在 3 到 30 个字符之间
+	// 长度限制同时排除了 "v1"，避免与 /v1 默认分组路由产生歧义
 	match, _ := regexp.MatchString("^[a-z0-9_-]{3,30}$", name)
 	return match
 }
 
+// validateGroupName checks a cleaned group name.
+func validateGroupName(name string) error {
+	if !isValidGroupName(name) {
+		return errors.New("无效的分组名称。只能包含小写字母、数字、中划线或下划线，长度3-30位")
+	}
+	return nil
+}
+
+// validateChannelType checks a cleaned channel type against the registered channels.
+func validateChannelType(channelType string) error {
+	if !isValidChannelType(channelType) {
+		return fmt.Errorf("Invalid channel type. Supported types are: %s", strings.Join(channel.GetChannels(), ", "))
+	}
+	return nil
+}
+
+// validateValidationEndpoint checks a cleaned validation endpoint.
+func validateValidationEndpoint(endpoint string) error {
+	if !isValidValidationEndpoint(endpoint) {
+		return errors.New("无效的测试路径。如果提供，必须是以 / 开头的有效路径，且不能是完整的URL。")
+	}
+	return nil
+}
+
 // isValidValidationEndpoint checks if the validation endpoint is a valid path.
 func isValidValidationEndpoint(endpoint string) bool {
 	if endpoint == "" {
@@ -103,47 +131,125 @@ func isValidValidationEndpoint(endpoint string) bool {
 	return true
 }
 
-// validateAndCleanConfig validates the group config against the GroupConfig struct and system-defined rules.
-func (s *Server) validateAndCleanConfig(configMap map[string]any) (map[string]any, error) {
-	if configMap == nil {
+// normalizeKeepaliveTimeout validates a group's keepalive timeout. Zero clears the setting,
+// so the group uses the global default.
+func normalizeKeepaliveTimeout(seconds *int) (*int, error) {
+	if seconds == nil || *seconds == 0 {
 		return nil, nil
 	}
+	if *seconds < 0 {
+		return nil, fmt.Errorf("keepalive_timeout_seconds cannot be negative")
+	}
+	return seconds, nil
+}
+
+// validateKeySyncSource checks that a non-empty key sync source uses a supported scheme.
+func validateKeySyncSource(source string) error {
+	if source == "" {
+		return nil
+	}
+	_, err := services.NewKeySyncSource(source)
+	return err
+}
+
+// normalizeRequiredHeaders validates required header definitions and returns them as JSON.
+func normalizeRequiredHeaders(headers []models.RequiredHeader) (datatypes.JSON, error) {
+	normalized := make([]models.RequiredHeader, 0, len(headers))
+	seenKeys := make(map[string]bool)
 
-	// 1. Check for unknown fields by comparing against the GroupConfig struct definition.
-	var tempGroupConfig models.GroupConfig
-	groupConfigType := reflect.TypeOf(tempGroupConfig)
-	validFields := make(map[string]bool)
-	for i := 0; i < groupConfigType.NumField(); i++ {
-		jsonTag := groupConfigType.Field(i).Tag.Get("json")
-		fieldName := strings.Split(jsonTag, ",")[0]
-		if fieldName != "" && fieldName != "-" {
-			validFields[fieldName] = true
+	for _, header := range headers {
+		key := strings.TrimSpace(header.Key)
+		if key == "" {
+			continue
+		}
+
+		canonicalKey := http.CanonicalHeaderKey(key)
+		if seenKeys[canonicalKey] {
+			return nil, fmt.Errorf("duplicate required header: %s", canonicalKey)
 		}
+		seenKeys[canonicalKey] = true
+
+		normalized = append(normalized, models.RequiredHeader{
+			Key:     canonicalKey,
+			Default: strings.TrimSpace(header.Default),
+		})
 	}
 
-	for key := range configMap {
-		if !validFields[key] {
-			return nil, fmt.Errorf("unknown config field: '%s'", key)
+	headersBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process required headers: %w", err)
+	}
+	return headersBytes, nil
+}
+
+// normalizeHeaderRules validates header rules and returns them as JSON, dropping rules without a key.
+func normalizeHeaderRules(rules []models.HeaderRule) (datatypes.JSON, error) {
+	if errs := models.HeaderRules(rules).Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	normalized := make([]models.HeaderRule, 0, len(rules))
+	for _, rule := range rules {
+		key := strings.TrimSpace(rule.Key)
+		if key == "" {
+			continue
 		}
+
+		// Normalize to canonical form
+		normalized = append(normalized, models.HeaderRule{
+			Key:    http.CanonicalHeaderKey(key),
+			Value:  rule.Value,
+			Action: rule.Action,
+		})
+	}
+
+	headerRulesBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process header rules: %w", err)
 	}
+	return headerRulesBytes, nil
+}
 
-	// 2. Validate the values of the provided fields using the central system settings validator.
-	if err := s.SettingsManager.ValidateGroupConfigOverrides(configMap); err != nil {
+// normalizeValidationProbe validates a custom validation probe and returns it as JSON.
+// An empty or null probe clears the custom probe, restoring the channel default.
+func normalizeValidationProbe(raw json.RawMessage) (datatypes.JSON, error) {
+	probe, err := models.ParseValidationProbe(datatypes.JSON(raw))
+	if err != nil || probe == nil {
 		return nil, err
 	}
+	probe.Normalize()
+	if errs := probe.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return json.Marshal(probe)
+}
 
-	// 3. Unmarshal and marshal back to clean the map and ensure correct types.
-	configBytes, err := json.Marshal(configMap)
+// validateAndCleanConfig parses the group config into its typed form and validates every concern.
+func (s *Server) validateAndCleanConfig(configMap map[string]any) (map[string]any, error) {
+	if configMap == nil {
+		return nil, nil
+	}
+
+	// 1. Decode into the typed config, rejecting unknown fields.
+	groupConfig, unknownFields, err := models.ParseGroupConfig(configMap)
+	if len(unknownFields) > 0 {
+		var errs app_errors.ValidationErrors
+		for _, key := range unknownFields {
+			errs.Add(key, "unknown config field")
+		}
+		return nil, errs
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal config map: %w", err)
+		return nil, err
 	}
 
-	var validatedConfig models.GroupConfig
-	if err := json.Unmarshal(configBytes, &validatedConfig); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal into validated config: %w", err)
+	// 2. Validate the values of each config concern.
+	if errs := groupConfig.Validate(); len(errs) > 0 {
+		return nil, errs
 	}
 
-	validatedBytes, err := json.Marshal(validatedConfig)
+	// 3. Marshal the typed config back to a map to store only known, correctly typed fields.
+	validatedBytes, err := json.Marshal(groupConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal validated config: %w", err)
 	}
@@ -155,20 +261,52 @@ func (s *Server) validateAndCleanConfig(configMap map[string]any) (map[string]an
 	return finalMap, nil
 }
 
+// newConfigValidationError converts a config validation error into an API error with field paths.
+func newConfigValidationError(err error) *app_errors.APIError {
+	var validationErrs app_errors.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return app_errors.NewValidationError(validationErrs.WithPrefix("config"))
+	}
+	return app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid config format: %v", err))
+}
+
+// newHeaderRulesValidationError converts a header rules validation error into an API error with field paths.
+func newHeaderRulesValidationError(err error) *app_errors.APIError {
+	var validationErrs app_errors.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return app_errors.NewValidationError(validationErrs.WithPrefix("header_rules"))
+	}
+	return app_errors.NewAPIError(app_errors.ErrValidation, err.Error())
+}
+
+// newProbeValidationError converts a validation probe error into an API error with field paths.
+func newProbeValidationError(err error) *app_errors.APIError {
+	var validationErrs app_errors.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return app_errors.NewValidationError(validationErrs.WithPrefix("validation_probe"))
+	}
+	return app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid validation probe: %v", err))
+}
+
 // GroupCreateRequest defines the payload for creating a group.
 type GroupCreateRequest struct {
-	Name               string              `json:"name"`
-	DisplayName        string              `json:"display_name"`
-	Description        string              `json:"description"`
-	Upstreams          json.RawMessage     `json:"upstreams"`
-	ChannelType        string              `json:"channel_type"`
-	Sort               int                 `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint string              `json:"validation_endpoint"`
-	ParamOverrides     map[string]any      `json:"param_overrides"`
-	Config             map[string]any      `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          string              `json:"proxy_keys"`
+	Name               string                  `json:"name"`
+	DisplayName        string                  `json:"display_name"`
+	Description        string                  `json:"description"`
+	Upstreams          json.RawMessage         `json:"upstreams"`
+	ChannelType        string                  `json:"channel_type"`
+	Sort               int                     `json:"sort"`
+	TestModel          string                  `json:"test_model"`
+	ValidationEndpoint string                  `json:"validation_endpoint"`
+	ValidationProbe    json.RawMessage         `json:"validation_probe"`
+	ParamOverrides     map[string]any          `json:"param_overrides"`
+	Config             map[string]any          `json:"config"`
+	HeaderRules        []models.HeaderRule     `json:"header_rules"`
+	RequiredHeaders    []models.RequiredHeader `json:"required_headers"`
+	ProxyKeys          string                  `json:"proxy_keys"`
+	KeySyncSource      string                  `json:"key_sync_source"`
+	// 上游空闲连接保持时长（秒），为空或 0 时使用全局默认值
+	KeepaliveTimeoutSeconds *int `json:"keepalive_timeout_seconds"`
 }
 
 // CreateGroup handles the creation of a new group.
@@ -181,15 +319,14 @@ func (s *Server) CreateGroup(c *gin.Context) {
 
 	// Data Cleaning and Validation
 	name := strings.TrimSpace(req.Name)
-	if !isValidGroupName(name) {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的分组名称。只能包含小写字母、数字、中划线或下划线，长度3-30位"))
+	if err := validateGroupName(name); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
 
 	channelType := strings.TrimSpace(req.ChannelType)
-	if !isValidChannelType(channelType) {
-		supported := strings.Join(channel.GetChannels(), ", ")
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid channel type. Supported types are: %s", supported)))
+	if err := validateChannelType(channelType); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
 
@@ -207,56 +344,45 @@ func (s *Server) CreateGroup(c *gin.Context) {
 
 	cleanedConfig, err := s.validateAndCleanConfig(req.Config)
 	if err != nil {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid config format: %v", err)))
+		response.Error(c, newConfigValidationError(err))
 		return
 	}
 
 	validationEndpoint := strings.TrimSpace(req.ValidationEndpoint)
-	if !isValidValidationEndpoint(validationEndpoint) {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的测试路径。如果提供，必须是以 / 开头的有效路径，且不能是完整的URL。"))
+	if err := validateValidationEndpoint(validationEndpoint); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
 
-	// Validate and normalize header rules if provided
-	var headerRulesJSON datatypes.JSON
-	if len(req.HeaderRules) > 0 {
-		normalizedHeaderRules := make([]models.HeaderRule, 0)
-		seenKeys := make(map[string]bool)
-
-		for _, rule := range req.HeaderRules {
-			key := strings.TrimSpace(rule.Key)
-			if key == "" {
-				continue
-			}
-
-			// Normalize to canonical form
-			canonicalKey := http.CanonicalHeaderKey(key)
+	validationProbe, err := normalizeValidationProbe(req.ValidationProbe)
+	if err != nil {
+		response.Error(c, newProbeValidationError(err))
+		return
+	}
 
-			// Check for duplicate keys
-			if seenKeys[canonicalKey] {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Duplicate header key: %s", canonicalKey)))
-				return
-			}
-			seenKeys[canonicalKey] = true
+	keySyncSource := strings.TrimSpace(req.KeySyncSource)
+	if err := validateKeySyncSource(keySyncSource); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
 
-			normalizedHeaderRules = append(normalizedHeaderRules, models.HeaderRule{
-				Key:    canonicalKey,
-				Value:  rule.Value,
-				Action: rule.Action,
-			})
-		}
+	keepaliveTimeout, err := normalizeKeepaliveTimeout(req.KeepaliveTimeoutSeconds)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
 
-		if len(normalizedHeaderRules) > 0 {
-			headerRulesBytes, err := json.Marshal(normalizedHeaderRules)
-			if err != nil {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to process header rules: %v", err)))
-				return
-			}
-			headerRulesJSON = headerRulesBytes
-		}
+	// Validate and normalize header rules if provided
+	headerRulesJSON, err := normalizeHeaderRules(req.HeaderRules)
+	if err != nil {
+		response.Error(c, newHeaderRulesValidationError(err))
+		return
 	}
-	if headerRulesJSON == nil {
-		headerRulesJSON = datatypes.JSON("[]")
+
+	requiredHeadersJSON, err := normalizeRequiredHeaders(req.RequiredHeaders)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
 	}
 
 	group := models.Group{
@@ -268,10 +394,15 @@ func (s *Server) CreateGroup(c *gin.Context) {
 		Sort:               req.Sort,
 		TestModel:          testModel,
 		ValidationEndpoint: validationEndpoint,
+		ValidationProbe:    validationProbe,
 		ParamOverrides:     req.ParamOverrides,
 		Config:             cleanedConfig,
 		HeaderRules:        headerRulesJSON,
+		RequiredHeaders:    requiredHeadersJSON,
 		ProxyKeys:          strings.TrimSpace(req.ProxyKeys),
+		KeySyncSource:      keySyncSource,
+
+		KeepaliveTimeoutSeconds: keepaliveTimeout,
 	}
 
 	if err := s.DB.Create(&group).Error; err != nil {
@@ -304,18 +435,23 @@ func (s *Server) ListGroups(c *gin.Context) {
 // GroupUpdateRequest defines the payload for updating a group.
 // Using a dedicated struct avoids issues with zero values being ignored by GORM's Update.
 type GroupUpdateRequest struct {
-	Name               *string             `json:"name,omitempty"`
-	DisplayName        *string             `json:"display_name,omitempty"`
-	Description        *string             `json:"description,omitempty"`
-	Upstreams          json.RawMessage     `json:"upstreams"`
-	ChannelType        *string             `json:"channel_type,omitempty"`
-	Sort               *int                `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint *string             `json:"validation_endpoint,omitempty"`
-	ParamOverrides     map[string]any      `json:"param_overrides"`
-	Config             map[string]any      `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          *string             `json:"proxy_keys,omitempty"`
+	Name               *string                 `json:"name,omitempty"`
+	DisplayName        *string                 `json:"display_name,omitempty"`
+	Description        *string                 `json:"description,omitempty"`
+	Upstreams          json.RawMessage         `json:"upstreams"`
+	ChannelType        *string                 `json:"channel_type,omitempty"`
+	Sort               *int                    `json:"sort"`
+	TestModel          string                  `json:"test_model"`
+	ValidationEndpoint *string                 `json:"validation_endpoint,omitempty"`
+	ValidationProbe    json.RawMessage         `json:"validation_probe"`
+	ParamOverrides     map[string]any          `json:"param_overrides"`
+	Config             map[string]any          `json:"config"`
+	HeaderRules        []models.HeaderRule     `json:"header_rules"`
+	RequiredHeaders    []models.RequiredHeader `json:"required_headers"`
+	ProxyKeys          *string                 `json:"proxy_keys,omitempty"`
+	KeySyncSource      *string                 `json:"key_sync_source,omitempty"`
+	// 设为 0 时清除分组的设置，恢复使用全局默认值
+	KeepaliveTimeoutSeconds *int `json:"keepalive_timeout_seconds,omitempty"`
 }
 
 // UpdateGroup handles updating an existing group.
@@ -349,8 +485,8 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	// Apply updates from the request, with cleaning and validation
 	if req.Name != nil {
 		cleanedName := strings.TrimSpace(*req.Name)
-		if !isValidGroupName(cleanedName) {
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的分组名称格式。只能包含小写字母、数字、中划线或下划线，长度3-30位"))
+		if err := validateGroupName(cleanedName); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 			return
 		}
 		group.Name = cleanedName
@@ -375,9 +511,8 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 
 	if req.ChannelType != nil {
 		cleanedChannelType := strings.TrimSpace(*req.ChannelType)
-		if !isValidChannelType(cleanedChannelType) {
-			supported := strings.Join(channel.GetChannels(), ", ")
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid channel type. Supported types are: %s", supported)))
+		if err := validateChannelType(cleanedChannelType); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 			return
 		}
 		group.ChannelType = cleanedChannelType
@@ -398,17 +533,26 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	}
 	if req.ValidationEndpoint != nil {
 		validationEndpoint := strings.TrimSpace(*req.ValidationEndpoint)
-		if !isValidValidationEndpoint(validationEndpoint) {
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的测试路径。如果提供，必须是以 / 开头的有效路径，且不能是完整的URL。"))
+		if err := validateValidationEndpoint(validationEndpoint); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 			return
 		}
 		group.ValidationEndpoint = validationEndpoint
 	}
 
+	if req.ValidationProbe != nil {
+		validationProbe, err := normalizeValidationProbe(req.ValidationProbe)
+		if err != nil {
+			response.Error(c, newProbeValidationError(err))
+			return
+		}
+		group.ValidationProbe = validationProbe
+	}
+
 	if req.Config != nil {
 		cleanedConfig, err := s.validateAndCleanConfig(req.Config)
 		if err != nil {
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid config format: %v", err)))
+			response.Error(c, newConfigValidationError(err))
 			return
 		}
 		group.Config = cleanedConfig
@@ -418,48 +562,43 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		group.ProxyKeys = strings.TrimSpace(*req.ProxyKeys)
 	}
 
-	// Handle header rules update
-	if req.HeaderRules != nil {
-		var headerRulesJSON datatypes.JSON
-		normalizedHeaderRules := make([]models.HeaderRule, 0)
-		seenKeys := make(map[string]bool)
-
-		for _, rule := range req.HeaderRules {
-			key := strings.TrimSpace(rule.Key)
-			if key == "" {
-				continue
-			}
-
-			// Normalize to canonical form
-			canonicalKey := http.CanonicalHeaderKey(key)
-
-			// Check for duplicate keys
-			if seenKeys[canonicalKey] {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Duplicate header key: %s", canonicalKey)))
-				return
-			}
-			seenKeys[canonicalKey] = true
+	if req.KeySyncSource != nil {
+		keySyncSource := strings.TrimSpace(*req.KeySyncSource)
+		if err := validateKeySyncSource(keySyncSource); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		group.KeySyncSource = keySyncSource
+	}
 
-			normalizedHeaderRules = append(normalizedHeaderRules, models.HeaderRule{
-				Key:    canonicalKey,
-				Value:  rule.Value,
-				Action: rule.Action,
-			})
+	if req.KeepaliveTimeoutSeconds != nil {
+		keepaliveTimeout, err := normalizeKeepaliveTimeout(req.KeepaliveTimeoutSeconds)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
 		}
+		group.KeepaliveTimeoutSeconds = keepaliveTimeout
+	}
 
-		if len(normalizedHeaderRules) > 0 {
-			headerRulesBytes, err := json.Marshal(normalizedHeaderRules)
-			if err != nil {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to process header rules: %v", err)))
-				return
-			}
-			headerRulesJSON = headerRulesBytes
-		} else {
-			headerRulesJSON = datatypes.JSON("[]")
+	// Handle header rules update
+	if req.HeaderRules != nil {
+		headerRulesJSON, err := normalizeHeaderRules(req.HeaderRules)
+		if err != nil {
+			response.Error(c, newHeaderRulesValidationError(err))
+			return
 		}
 		group.HeaderRules = headerRulesJSON
 	}
 
+	if req.RequiredHeaders != nil {
+		requiredHeadersJSON, err := normalizeRequiredHeaders(req.RequiredHeaders)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		group.RequiredHeaders = requiredHeadersJSON
+	}
+
 	// Save the updated group object
 	if err := tx.Save(&group).Error; err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
@@ -477,25 +616,49 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	response.Success(c, s.newGroupResponse(&group))
 }
 
+// SyncGroupKeys runs one key sync cycle for a group with a key sync source.
+func (s *Server) SyncGroupKeys(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+	if group.KeySyncSource == "" {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Group has no key sync source"))
+		return
+	}
+
+	result, err := s.KeySync.SyncGroup(group)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	response.Success(c, result)
+}
+
 // GroupResponse defines the structure for a group response, excluding sensitive or large fields.
 type GroupResponse struct {
-	ID                 uint                `json:"id"`
-	Name               string              `json:"name"`
-	Endpoint           string              `json:"endpoint"`
-	DisplayName        string              `json:"display_name"`
-	Description        string              `json:"description"`
-	Upstreams          datatypes.JSON      `json:"upstreams"`
-	ChannelType        string              `json:"channel_type"`
-	Sort               int                 `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint string              `json:"validation_endpoint"`
-	ParamOverrides     datatypes.JSONMap   `json:"param_overrides"`
-	Config             datatypes.JSONMap   `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          string              `json:"proxy_keys"`
-	LastValidatedAt    *time.Time          `json:"last_validated_at"`
-	CreatedAt          time.Time           `json:"created_at"`
-	UpdatedAt          time.Time           `json:"updated_at"`
+	ID                      uint                    `json:"id"`
+	Name                    string                  `json:"name"`
+	Endpoint                string                  `json:"endpoint"`
+	DisplayName             string                  `json:"display_name"`
+	Description             string                  `json:"description"`
+	Upstreams               datatypes.JSON          `json:"upstreams"`
+	ChannelType             string                  `json:"channel_type"`
+	Sort                    int                     `json:"sort"`
+	TestModel               string                  `json:"test_model"`
+	ValidationEndpoint      string                  `json:"validation_endpoint"`
+	ValidationProbe         *models.ValidationProbe `json:"validation_probe"`
+	ParamOverrides          datatypes.JSONMap       `json:"param_overrides"`
+	Config                  datatypes.JSONMap       `json:"config"`
+	HeaderRules             []models.HeaderRule     `json:"header_rules"`
+	RequiredHeaders         []models.RequiredHeader `json:"required_headers"`
+	ProxyKeys               string                  `json:"proxy_keys"`
+	KeySyncSource           string                  `json:"key_sync_source"`
+	KeepaliveTimeoutSeconds *int                    `json:"keepalive_timeout_seconds"`
+	DeleteAfter             *time.Time              `json:"delete_after"`
+	LastValidatedAt         *time.Time              `json:"last_validated_at"`
+	CreatedAt               time.Time               `json:"created_at"`
+	UpdatedAt               time.Time               `json:"updated_at"`
 }
 
 // newGroupResponse creates a new GroupResponse from a models.Group.
@@ -519,110 +682,121 @@ func (s *Server) newGroupResponse(group *models.Group) *GroupResponse {
 		}
 	}
 
+	requiredHeaders := make([]models.RequiredHeader, 0)
+	if len(group.RequiredHeaders) > 0 {
+		if err := json.Unmarshal(group.RequiredHeaders, &requiredHeaders); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal required headers")
+			requiredHeaders = make([]models.RequiredHeader, 0)
+		}
+	}
+
+	validationProbe, err := models.ParseValidationProbe(group.ValidationProbe)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to unmarshal validation probe")
+	}
+
 	return &GroupResponse{
-		ID:                 group.ID,
-		Name:               group.Name,
-		Endpoint:           endpoint,
-		DisplayName:        group.DisplayName,
-		Description:        group.Description,
-		Upstreams:          group.Upstreams,
-		ChannelType:        group.ChannelType,
-		Sort:               group.Sort,
-		TestModel:          group.TestModel,
-		ValidationEndpoint: group.ValidationEndpoint,
-		ParamOverrides:     group.ParamOverrides,
-		Config:             group.Config,
-		HeaderRules:        headerRules,
-		ProxyKeys:          group.ProxyKeys,
-		LastValidatedAt:    group.LastValidatedAt,
-		CreatedAt:          group.CreatedAt,
-		UpdatedAt:          group.UpdatedAt,
+		ID:                      group.ID,
+		Name:                    group.Name,
+		Endpoint:                endpoint,
+		DisplayName:             group.DisplayName,
+		Description:             group.Description,
+		Upstreams:               group.Upstreams,
+		ChannelType:             group.ChannelType,
+		Sort:                    group.Sort,
+		TestModel:               group.TestModel,
+		ValidationEndpoint:      group.ValidationEndpoint,
+		ValidationProbe:         validationProbe,
+		ParamOverrides:          group.ParamOverrides,
+		Config:                  group.Config,
+		HeaderRules:             headerRules,
+		RequiredHeaders:         requiredHeaders,
+		ProxyKeys:               group.ProxyKeys,
+		KeySyncSource:           group.KeySyncSource,
+		KeepaliveTimeoutSeconds: group.KeepaliveTimeoutSeconds,
+		DeleteAfter:             group.DeleteAfter,
+		LastValidatedAt:         group.LastValidatedAt,
+		CreatedAt:               group.CreatedAt,
+		UpdatedAt:               group.UpdatedAt,
 	}
 }
 
 // DeleteGroup handles deleting a group.
 func (s *Server) DeleteGroup(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid group ID format"))
+	group, ok := s.findGroup(c)
+	if !ok {
 		return
 	}
 
-	// First, get all API keys for this group to clean up from memory store
-	var apiKeys []models.APIKey
-	if err := s.DB.Where("group_id = ?", id).Find(&apiKeys).Error; err != nil {
+	traffic, err := s.GroupDeletion.RecentTraffic(group.ID)
+	if err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
 
-	// Extract key IDs for memory store cleanup
-	var keyIDs []uint
-	for _, key := range apiKeys {
-		keyIDs = append(keyIDs, key.ID)
-	}
-
-	// Use a transaction to ensure atomicity
-	tx := s.DB.Begin()
-	if tx.Error != nil {
-		response.Error(c, app_errors.ErrDatabase)
-		return
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// 定时删除：分组立即进入维护模式，到期后由后台服务删除，期间可取消
+	if deleteAfterStr := c.Query("delete_after"); deleteAfterStr != "" {
+		deleteAfter, err := time.Parse(time.RFC3339, deleteAfterStr)
+		if err != nil || !deleteAfter.After(time.Now()) {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "delete_after must be a future RFC3339 timestamp"))
+			return
 		}
-	}()
-
-	// First check if the group exists
-	var group models.Group
-	if err := tx.First(&group, id).Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ParseDBError(err))
+		if err := s.GroupDeletion.ScheduleDeletion(group.ID, deleteAfter); err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+		s.GroupDeletion.AuditLog("schedule_delete", group, traffic, c.ClientIP())
+		response.Success(c, gin.H{
+			"message":      "Group scheduled for deletion",
+			"delete_after": deleteAfter,
+			"traffic":      traffic,
+		})
 		return
 	}
 
-	// Delete associated API keys first due to foreign key constraint
-	if err := tx.Where("group_id = ?", id).Delete(&models.APIKey{}).Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ErrDatabase)
+	if traffic.RequestCount > 0 && c.Query("force") != "true" {
+		s.GroupDeletion.AuditLog("delete_refused", group, traffic, c.ClientIP())
+		clientKeys := make([]string, 0, len(traffic.TopClients))
+		for _, client := range traffic.TopClients {
+			clientKeys = append(clientKeys, fmt.Sprintf("%s (%d)", client.ClientKey, client.RequestCount))
+		}
+		apiErr := app_errors.NewAPIError(app_errors.ErrGroupHasTraffic, fmt.Sprintf(
+			"Group received %d requests in the last %d minutes (top clients: %s). Use force=true or delete_after to delete it.",
+			traffic.RequestCount, traffic.WindowMinutes, strings.Join(clientKeys, ", ")))
+		apiErr.Details = traffic
+		response.Error(c, apiErr)
 		return
 	}
 
-	// Then delete the group
-	if err := tx.Delete(&models.Group{}, id).Error; err != nil {
-		tx.Rollback()
+	if err := s.GroupDeletion.DeleteGroup(group.ID); err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
+	s.GroupDeletion.AuditLog("delete", group, traffic, c.ClientIP())
 
-	// Clean up memory store (Redis) within the transaction to ensure atomicity
-	// If Redis cleanup fails, the entire transaction will be rolled back
-	if len(keyIDs) > 0 {
-		if err := s.KeyService.KeyProvider.RemoveKeysFromStore(uint(id), keyIDs); err != nil {
-			tx.Rollback()
-			logrus.WithFields(logrus.Fields{
-				"groupID":  id,
-				"keyCount": len(keyIDs),
-				"error":    err,
-			}).Error("Failed to remove keys from memory store, rolling back transaction")
+	response.Success(c, gin.H{
+		"message":              "Group and associated keys deleted successfully",
+		"recent_request_count": traffic.RequestCount,
+	})
+}
 
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase,
-				"Failed to delete group: unable to clean up cache"))
-			return
-		}
+// CancelGroupDeletion cancels a pending scheduled deletion of a group.
+func (s *Server) CancelGroupDeletion(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
 	}
-
-	// Commit the transaction only if both DB and Redis operations succeed
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ErrDatabase)
+	if group.DeleteAfter == nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Group has no scheduled deletion"))
 		return
 	}
 
-	if err := s.GroupManager.Invalidate(); err != nil {
-		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to invalidate group cache")
+	if err := s.GroupDeletion.CancelScheduledDeletion(group.ID); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
 	}
-	response.Success(c, gin.H{"message": "Group and associated keys deleted successfully"})
+	s.GroupDeletion.AuditLog("cancel_scheduled_delete", group, nil, c.ClientIP())
+	response.Success(c, gin.H{"message": "Scheduled deletion cancelled"})
 }
 
 // ConfigOption represents a single configurable option for a group.
@@ -659,25 +833,15 @@ func (s *Server) GetGroupConfigOptions(c *gin.Context) {
 	}
 
 	// 3. Iterate over GroupConfig fields to maintain order and build the response
-	groupConfigType := reflect.TypeOf(models.GroupConfig{})
-
-	for i := 0; i < groupConfigType.NumField(); i++ {
-		field := groupConfigType.Field(i)
-		jsonTag := field.Tag.Get("json")
-		key := strings.Split(jsonTag, ",")[0]
-
-		if key == "" || key == "-" {
-			continue
-		}
-
-		if definition, ok := defMap[key]; ok {
+	for _, field := range models.GroupConfigFields() {
+		if definition, ok := defMap[field.Key]; ok {
 			var defaultValue any
-			if fieldName, ok := jsonToFieldMap[key]; ok {
+			if fieldName, ok := jsonToFieldMap[field.Key]; ok {
 				defaultValue = currentSettingsValue.FieldByName(fieldName).Interface()
 			}
 
 			option := ConfigOption{
-				Key:          key,
+				Key:          field.Key,
 				Name:         definition.Name,
 				Description:  definition.Description,
 				DefaultValue: defaultValue,
@@ -694,6 +858,8 @@ type KeyStats struct {
 	TotalKeys   int64 `json:"total_keys"`
 	ActiveKeys  int64 `json:"active_keys"`
 	InvalidKeys int64 `json:"invalid_keys"`
+	SuspectKeys int64 `json:"suspect_keys"`
+	FalseAlarms int64 `json:"false_alarms"`
 }
 
 // RequestStats defines the statistics for requests over a period.
@@ -750,7 +916,7 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		var totalKeys, activeKeys int64
+		var totalKeys, activeKeys, suspectKeys, falseAlarms int64
 
 		if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Count(&totalKeys).Error; err != nil {
 			mu.Lock()
@@ -764,12 +930,26 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 			mu.Unlock()
 			return
 		}
+		if err := s.DB.Model(&models.APIKey{}).Where("group_id = ? AND status = ?", groupID, models.KeyStatusSuspect).Count(&suspectKeys).Error; err != nil {
+			mu.Lock()
+			errors = append(errors, fmt.Errorf("failed to get suspect keys: %w", err))
+			mu.Unlock()
+			return
+		}
+		if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Select("COALESCE(SUM(false_alarm_count), 0)").Scan(&falseAlarms).Error; err != nil {
+			mu.Lock()
+			errors = append(errors, fmt.Errorf("failed to get false alarm count: %w", err))
+			mu.Unlock()
+			return
+		}
 
 		mu.Lock()
 		resp.KeyStats = KeyStats{
 			TotalKeys:   totalKeys,
 			ActiveKeys:  activeKeys,
-			InvalidKeys: totalKeys - activeKeys,
+			InvalidKeys: totalKeys - activeKeys - suspectKeys,
+			SuspectKeys: suspectKeys,
+			FalseAlarms: falseAlarms,
 		}
 		mu.Unlock()
 	}()
@@ -782,13 +962,13 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 		now := time.Now()
 		oneHourAgo := now.Add(-1 * time.Hour)
 
-		if err := s.DB.Model(&models.RequestLog{}).Where("group_id = ? AND timestamp BETWEEN ? AND ? AND request_type = ?", groupID, oneHourAgo, now, models.RequestTypeFinal).Count(&total).Error; err != nil {
+		if err := s.LogService.LogsBetween(oneHourAgo, now).Where("group_id = ? AND timestamp BETWEEN ? AND ? AND request_type = ?", groupID, oneHourAgo, now, models.RequestTypeFinal).Count(&total).Error; err != nil {
 			mu.Lock()
 			errors = append(errors, fmt.Errorf("failed to get hourly total requests: %w", err))
 			mu.Unlock()
 			return
 		}
-		if err := s.DB.Model(&models.RequestLog{}).Where("group_id = ? AND timestamp BETWEEN ? AND ? AND is_success = ? AND request_type = ?", groupID, oneHourAgo, now, false, models.RequestTypeFinal).Count(&failed).Error; err != nil {
+		if err := s.LogService.LogsBetween(oneHourAgo, now).Where("group_id = ? AND timestamp BETWEEN ? AND ? AND is_success = ? AND request_type = ?", groupID, oneHourAgo, now, false, models.RequestTypeFinal).Count(&failed).Error; err != nil {
 			mu.Lock()
 			errors = append(errors, fmt.Errorf("failed to get hourly failed requests: %w", err))
 			mu.Unlock()
@@ -867,6 +1047,156 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 	response.Success(c, resp)
 }
 
+// defaultKeySourceStatsRange 未指定开始时间时按来源统计的时间范围
+const defaultKeySourceStatsRange = 7 * 24 * time.Hour
+
+// KeySourceStats defines the usage statistics of the keys of one source in a group.
+type KeySourceStats struct {
+	Source         string           `json:"source"`
+	TotalKeys      int64            `json:"total_keys"`
+	ActiveKeys     int64            `json:"active_keys"`
+	RequestCount   int64            `json:"request_count"`
+	SuccessCount   int64            `json:"success_count"`
+	FailureCount   int64            `json:"failure_count"`
+	SuccessRate    float64          `json:"success_rate"`
+	DisableReasons map[string]int64 `json:"disable_reasons"`
+}
+
+// KeySourceStatsResponse defines the per-source statistics of a group over a time range.
+type KeySourceStatsResponse struct {
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Sources   []*KeySourceStats `json:"sources"`
+}
+
+// GetGroupKeysBySource aggregates the requests, success rate and disable reasons of a group's
+// keys per source between start_time and end_time (RFC 3339, default the last 7 days), from
+// hourly counters. Requests include retries, since each attempt is served by a key.
+func (s *Server) GetGroupKeysBySource(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	endTime := time.Now()
+	if value := c.Query("end_time"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "end_time must be an RFC 3339 time"))
+			return
+		}
+		endTime = parsed
+	}
+	startTime := endTime.Add(-defaultKeySourceStatsRange)
+	if value := c.Query("start_time"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "start_time must be an RFC 3339 time"))
+			return
+		}
+		startTime = parsed
+	}
+	if !startTime.Before(endTime) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "start_time must be before end_time"))
+		return
+	}
+
+	sources := make(map[string]*KeySourceStats)
+	sourceStats := func(source string) *KeySourceStats {
+		stats, ok := sources[source]
+		if !ok {
+			stats = &KeySourceStats{Source: source, DisableReasons: make(map[string]int64)}
+			sources[source] = stats
+		}
+		return stats
+	}
+
+	var keyCounts []struct {
+		Source     string
+		TotalKeys  int64
+		ActiveKeys int64
+	}
+	if err := s.DB.Model(&models.APIKey{}).
+		Select("source, COUNT(*) as total_keys, SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) as active_keys", models.KeyStatusActive).
+		Where("group_id = ? AND source <> ''", group.ID).
+		Group("source").
+		Scan(&keyCounts).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	for _, row := range keyCounts {
+		stats := sourceStats(row.Source)
+		stats.TotalKeys = row.TotalKeys
+		stats.ActiveKeys = row.ActiveKeys
+	}
+
+	// 包含开始时间所在的小时
+	hourStart := startTime.Truncate(time.Hour)
+
+	var requestCounts []struct {
+		Source       string
+		SuccessCount int64
+		FailureCount int64
+	}
+	if err := s.DB.Model(&models.KeySourceHourlyStat{}).
+		Select("source, SUM(success_count) as success_count, SUM(failure_count) as failure_count").
+		Where("group_id = ? AND time >= ? AND time < ?", group.ID, hourStart, endTime).
+		Group("source").
+		Scan(&requestCounts).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	for _, row := range requestCounts {
+		stats := sourceStats(row.Source)
+		stats.SuccessCount = row.SuccessCount
+		stats.FailureCount = row.FailureCount
+		stats.RequestCount = row.SuccessCount + row.FailureCount
+		if stats.RequestCount > 0 {
+			stats.SuccessRate, _ = strconv.ParseFloat(fmt.Sprintf("%.4f", float64(row.SuccessCount)/float64(stats.RequestCount)), 64)
+		}
+	}
+
+	var disableCounts []struct {
+		Source string
+		Reason string
+		Count  int64
+	}
+	if err := s.DB.Model(&models.KeySourceDisableStat{}).
+		Select("source, reason, SUM(count) as count").
+		Where("group_id = ? AND time >= ? AND time < ?", group.ID, hourStart, endTime).
+		Group("source, reason").
+		Scan(&disableCounts).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	for _, row := range disableCounts {
+		sourceStats(row.Source).DisableReasons[row.Reason] = row.Count
+	}
+
+	resp := KeySourceStatsResponse{StartTime: startTime, EndTime: endTime, Sources: make([]*KeySourceStats, 0, len(sources))}
+	for _, stats := range sources {
+		resp.Sources = append(resp.Sources, stats)
+	}
+	sort.Slice(resp.Sources, func(i, j int) bool { return resp.Sources[i].Source < resp.Sources[j].Source })
+
+	response.Success(c, resp)
+}
+
+// GetGroupUpstreamHealth returns the length mismatch counters and forced raw mode of each upstream of a group.
+func (s *Server) GetGroupUpstreamHealth(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	health, err := s.UpstreamHealth.GroupHealth(group)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	response.Success(c, health)
+}
+
 // GroupCopyRequest defines the payload for copying a group.
 type GroupCopyRequest struct {
 	CopyKeys string `json:"copy_keys"` // "none"|"valid_only"|"all"
@@ -1003,7 +1333,7 @@ func (s *Server) CopyGroup(c *gin.Context) {
 		keysText := strings.Join(sourceKeyValues, "\n")
 
 		// Directly reuse the AddMultipleKeysAsync logic from key_handler.go
-		if _, err := s.KeyImportService.StartImportTask(&newGroup, keysText); err != nil {
+		if _, err := s.KeyImportService.StartImportTask(&newGroup, keysText, ""); err != nil {
 			logrus.WithFields(logrus.Fields{
 				"groupId":  newGroup.ID,
 				"keyCount": len(sourceKeyValues),
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/models"
+)
+
+func TestNormalizeRequiredHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []models.RequiredHeader
+		want    []models.RequiredHeader
+		wantErr string
+	}{
+		{name: "nil", headers: nil, want: []models.RequiredHeader{}},
+		{
+			name:    "canonicalized and trimmed",
+			headers: []models.RequiredHeader{{Key: " x-tenant-id ", Default: " acme "}},
+			want:    []models.RequiredHeader{{Key: "X-Tenant-Id", Default: "acme"}},
+		},
+		{
+			name:    "blank keys skipped",
+			headers: []models.RequiredHeader{{Key: "  "}, {Key: "X-Region"}},
+			want:    []models.RequiredHeader{{Key: "X-Region"}},
+		},
+		{
+			name:    "order kept",
+			headers: []models.RequiredHeader{{Key: "X-B"}, {Key: "X-A", Default: "1"}},
+			want:    []models.RequiredHeader{{Key: "X-B"}, {Key: "X-A", Default: "1"}},
+		},
+		{
+			name:    "duplicates differing in case",
+			headers: []models.RequiredHeader{{Key: "X-Tenant"}, {Key: "x-tenant"}},
+			wantErr: "duplicate required header: X-Tenant",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := normalizeRequiredHeaders(tt.headers)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalizeRequiredHeaders() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeRequiredHeaders() error = %v", err)
+			}
+			var got []models.RequiredHeader
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatalf("invalid JSON %s: %v", raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeRequiredHeaders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Severities of group validation results. Errors would make the save fail; warnings are
+// saved as is but are likely mistakes.
+const (
+	GroupValidationError   = "error"
+	GroupValidationWarning = "warning"
+)
+
+// GroupValidationResult is one finding for a field of the group document.
+type GroupValidationResult struct {
+	Path     string `json:"path"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// GroupValidationResponse is the result of validating a group document.
+type GroupValidationResponse struct {
+	Valid   bool                    `json:"valid"`
+	Results []GroupValidationResult `json:"results"`
+}
+
+type groupValidation struct {
+	results []GroupValidationResult
+}
+
+func (v *groupValidation) add(path, severity, message string) {
+	v.results = append(v.results, GroupValidationResult{Path: path, Severity: severity, Message: message})
+}
+
+// addError adds err under path, expanding field-level validation errors into one result each.
+func (v *groupValidation) addError(path string, err error) {
+	var validationErrs app_errors.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, fe := range validationErrs.WithPrefix(path) {
+			v.add(fe.Field, GroupValidationError, fe.Message)
+		}
+		return
+	}
+	v.add(path, GroupValidationError, err.Error())
+}
+
+// ValidateGroup validates a full or partial group document with the validators of the save
+// path, without persisting anything, so that the group form can check fields on blur. Only
+// the fields present in the document are validated. ?id= names the group being edited.
+func (s *Server) ValidateGroup(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Failed to read request body"))
+		return
+	}
+	var req GroupUpdateRequest
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if err := json.Unmarshal(body, &present); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var existing *models.Group
+	if idParam := c.Query("id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid group ID format"))
+			return
+		}
+		var group models.Group
+		if err := s.DB.First(&group, id).Error; err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+		existing = &group
+	}
+
+	var v groupValidation
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if err := validateGroupName(name); err != nil {
+			v.addError("name", err)
+		} else {
+			query := s.DB.Model(&models.Group{}).Where("name = ?", name)
+			if existing != nil {
+				query = query.Where("id <> ?", existing.ID)
+			}
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				response.Error(c, app_errors.ParseDBError(err))
+				return
+			}
+			if count > 0 {
+				v.add("name", GroupValidationError, fmt.Sprintf("group name %q is already in use", name))
+			}
+		}
+	}
+
+	if req.ChannelType != nil {
+		channelType := strings.TrimSpace(*req.ChannelType)
+		if err := validateChannelType(channelType); err != nil {
+			v.addError("channel_type", err)
+		} else if existing != nil && existing.ChannelType != channelType {
+			var keyCount int64
+			if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", existing.ID).Count(&keyCount).Error; err != nil {
+				response.Error(c, app_errors.ParseDBError(err))
+				return
+			}
+			if keyCount > 0 {
+				v.add("channel_type", GroupValidationWarning, fmt.Sprintf("the group's %d keys were added for %s and may not be valid for %s", keyCount, existing.ChannelType, channelType))
+			}
+		}
+	}
+
+	if _, ok := present["test_model"]; ok && strings.TrimSpace(req.TestModel) == "" {
+		v.add("test_model", GroupValidationError, "Test model is required")
+	}
+
+	if req.Upstreams != nil {
+		if _, err := validateAndCleanUpstreams(req.Upstreams); err != nil {
+			v.addError("upstreams", err)
+		} else {
+			var defs []UpstreamDefinition
+			_ = json.Unmarshal(req.Upstreams, &defs)
+			seen := make(map[string]bool, len(defs))
+			for i, def := range defs {
+				upstream := strings.TrimRight(strings.TrimSpace(def.URL), "/")
+				if seen[upstream] {
+					v.add(fmt.Sprintf("upstreams.%d.url", i), GroupValidationWarning, fmt.Sprintf("upstream %s is listed more than once", upstream))
+				}
+				seen[upstream] = true
+			}
+		}
+	}
+
+	if req.ValidationEndpoint != nil {
+		if err := validateValidationEndpoint(strings.TrimSpace(*req.ValidationEndpoint)); err != nil {
+			v.addError("validation_endpoint", err)
+		}
+	}
+
+	if req.ValidationProbe != nil {
+		if _, err := normalizeValidationProbe(req.ValidationProbe); err != nil {
+			v.addError("validation_probe", err)
+		}
+	}
+
+	if req.Config != nil {
+		if _, err := s.validateAndCleanConfig(req.Config); err != nil {
+			v.addError("config", err)
+		}
+	}
+
+	if req.KeySyncSource != nil {
+		if err := validateKeySyncSource(strings.TrimSpace(*req.KeySyncSource)); err != nil {
+			v.addError("key_sync_source", err)
+		}
+	}
+
+	if req.KeepaliveTimeoutSeconds != nil {
+		if _, err := normalizeKeepaliveTimeout(req.KeepaliveTimeoutSeconds); err != nil {
+			v.addError("keepalive_timeout_seconds", err)
+		}
+	}
+
+	if req.HeaderRules != nil {
+		if _, err := normalizeHeaderRules(req.HeaderRules); err != nil {
+			v.addError("header_rules", err)
+		}
+	}
+
+	if req.RequiredHeaders != nil {
+		if _, err := normalizeRequiredHeaders(req.RequiredHeaders); err != nil {
+			v.addError("required_headers", err)
+		}
+	}
+
+	result := GroupValidationResponse{Valid: true, Results: v.results}
+	if result.Results == nil {
+		result.Results = []GroupValidationResult{}
+	}
+	for _, r := range result.Results {
+		if r.Severity == GroupValidationError {
+			result.Valid = false
+			break
+		}
+	}
+	response.Success(c, result)
+}
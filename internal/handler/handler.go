@@ -2,15 +2,19 @@
 package handler
 
 import (
-	"crypto/subtle"
+	"context"
 	"net/http"
 	"time"
 
 	"gpt-load/internal/config"
+	"gpt-load/internal/hosthealth"
 	"gpt-load/internal/services"
+	"gpt-load/internal/store"
 	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"go.uber.org/dig"
 	"gorm.io/gorm"
 )
@@ -20,6 +24,7 @@ type Server struct {
 	DB                         *gorm.DB
 	config                     types.ConfigManager
 	SettingsManager            *config.SystemSettingsManager
+	FeatureFlags               *config.FeatureFlagManager
 	GroupManager               *services.GroupManager
 	KeyManualValidationService *services.KeyManualValidationService
 	TaskService                *services.TaskService
@@ -27,6 +32,19 @@ type Server struct {
 	KeyImportService           *services.KeyImportService
 	KeyDeleteService           *services.KeyDeleteService
 	LogService                 *services.LogService
+	StatsCounter               *services.StatsCounterService
+	ResponseSizeStats          *services.ResponseSizeStats
+	StatsBackfill              *services.StatsBackfillService
+	EventExporter              *services.ClickHouseExporter
+	Recordings                 *services.RecordingService
+	KeySync                    *services.KeySyncService
+	GroupDeletion              *services.GroupDeletionService
+	GeoRouting                 *services.GeoRoutingService
+	UpstreamHealth             *services.UpstreamHealthService
+	ClientQuota                *services.ClientQuotaService
+	HostHealth                 *hosthealth.Checker
+	PayloadOffload             *services.PayloadOffloadService
+	Store                      store.Store
 	CommonHandler              *CommonHandler
 }
 
@@ -36,6 +54,7 @@ type NewServerParams struct {
 	DB                         *gorm.DB
 	Config                     types.ConfigManager
 	SettingsManager            *config.SystemSettingsManager
+	FeatureFlags               *config.FeatureFlagManager
 	GroupManager               *services.GroupManager
 	KeyManualValidationService *services.KeyManualValidationService
 	TaskService                *services.TaskService
@@ -43,6 +62,19 @@ type NewServerParams struct {
 	KeyImportService           *services.KeyImportService
 	KeyDeleteService           *services.KeyDeleteService
 	LogService                 *services.LogService
+	StatsCounter               *services.StatsCounterService
+	ResponseSizeStats          *services.ResponseSizeStats
+	StatsBackfill              *services.StatsBackfillService
+	EventExporter              *services.ClickHouseExporter
+	Recordings                 *services.RecordingService
+	KeySync                    *services.KeySyncService
+	GroupDeletion              *services.GroupDeletionService
+	GeoRouting                 *services.GeoRoutingService
+	UpstreamHealth             *services.UpstreamHealthService
+	ClientQuota                *services.ClientQuotaService
+	HostHealth                 *hosthealth.Checker
+	PayloadOffload             *services.PayloadOffloadService
+	Store                      store.Store
 	CommonHandler              *CommonHandler
 }
 
@@ -52,6 +84,7 @@ func NewServer(params NewServerParams) *Server {
 		DB:                         params.DB,
 		config:                     params.Config,
 		SettingsManager:            params.SettingsManager,
+		FeatureFlags:               params.FeatureFlags,
 		GroupManager:               params.GroupManager,
 		KeyManualValidationService: params.KeyManualValidationService,
 		TaskService:                params.TaskService,
@@ -59,6 +92,19 @@ func NewServer(params NewServerParams) *Server {
 		KeyImportService:           params.KeyImportService,
 		KeyDeleteService:           params.KeyDeleteService,
 		LogService:                 params.LogService,
+		StatsCounter:               params.StatsCounter,
+		ResponseSizeStats:          params.ResponseSizeStats,
+		StatsBackfill:              params.StatsBackfill,
+		EventExporter:              params.EventExporter,
+		Recordings:                 params.Recordings,
+		KeySync:                    params.KeySync,
+		GroupDeletion:              params.GroupDeletion,
+		GeoRouting:                 params.GeoRouting,
+		UpstreamHealth:             params.UpstreamHealth,
+		ClientQuota:                params.ClientQuota,
+		HostHealth:                 params.HostHealth,
+		PayloadOffload:             params.PayloadOffload,
+		Store:                      params.Store,
 		CommonHandler:              params.CommonHandler,
 	}
 }
@@ -85,9 +131,13 @@ func (s *Server) Login(c *gin.Context) {
 		return
 	}
 
-	authConfig := s.config.GetAuthConfig()
+	isValid, ipAllowed := utils.AuthorizeAdminKey(s.config.GetAuthConfig(), req.AuthKey, c.ClientIP())
 
-	isValid := subtle.ConstantTimeCompare([]byte(req.AuthKey), []byte(authConfig.Key)) == 1
+	// 与管理接口一致，密钥正确但来源 IP 不在该密钥的允许列表内时拒绝登录
+	if isValid && !ipAllowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "ip_not_allowed"})
+		return
+	}
 
 	if isValid {
 		c.JSON(http.StatusOK, LoginResponse{
@@ -117,3 +167,58 @@ func (s *Server) Health(c *gin.Context) {
 		"uptime":    uptime,
 	})
 }
+
+// readinessCheckTimeout 就绪检查中单个依赖的超时时间
+const readinessCheckTimeout = 2 * time.Second
+
+// DependencyStatus is the readiness of a single dependency.
+type DependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Livez reports that the HTTP server is up, without checking any dependency.
+func (s *Server) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Readyz reports whether the database and, when REDIS_DSN is set, Redis are reachable. It returns
+// 503 when any of them is not, with the status of each dependency.
+func (s *Server) Readyz(c *gin.Context) {
+	checks := map[string]DependencyStatus{
+		"database": s.checkDependency(c.Request.Context(), s.pingDatabase),
+		"redis":    {Status: "not_configured"},
+	}
+	if s.config.GetRedisDSN() != "" {
+		checks["redis"] = DependencyStatus{Status: "error", Error: "store does not support health checks"}
+		if pinger, ok := s.Store.(store.Pinger); ok {
+			checks["redis"] = s.checkDependency(c.Request.Context(), pinger.Ping)
+		}
+	}
+
+	status, code := "ready", http.StatusOK
+	for name, check := range checks {
+		if check.Status == "error" {
+			logrus.Warnf("Readiness check failed for %s: %s", name, check.Error)
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+func (s *Server) checkDependency(ctx context.Context, ping func(context.Context) error) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	if err := ping(ctx); err != nil {
+		return DependencyStatus{Status: "error", Error: err.Error()}
+	}
+	return DependencyStatus{Status: "ok"}
+}
+
+func (s *Server) pingDatabase(ctx context.Context) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
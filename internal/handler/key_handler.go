@@ -1,11 +1,17 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
+	"gpt-load/internal/channel"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/keypool"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
 	"log"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -58,6 +64,22 @@ type KeyTextRequest struct {
 	KeysText string `json:"keys_text" binding:"required"`
 }
 
+// AddKeysRequest defines the payload for importing keys, optionally attributing them to a source.
+// A source column in CSV text takes precedence over Source.
+type AddKeysRequest struct {
+	KeyTextRequest
+	Source string `json:"source"`
+}
+
+// validateKeySource trims and validates the source of keys.
+func validateKeySource(source *string) error {
+	*source = strings.TrimSpace(*source)
+	if len(*source) > keypool.MaxKeySourceLength {
+		return fmt.Errorf("source must be at most %d characters", keypool.MaxKeySourceLength)
+	}
+	return nil
+}
+
 // GroupIDRequest defines a generic payload for operations requiring only a group ID.
 type GroupIDRequest struct {
 	GroupID uint `json:"group_id" binding:"required"`
@@ -71,7 +93,7 @@ type ValidateGroupKeysRequest struct {
 
 // AddMultipleKeys handles creating new keys from a text block within a specific group.
 func (s *Server) AddMultipleKeys(c *gin.Context) {
-	var req KeyTextRequest
+	var req AddKeysRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
 		return
@@ -85,8 +107,12 @@ func (s *Server) AddMultipleKeys(c *gin.Context) {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
+	if err := validateKeySource(&req.Source); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
 
-	result, err := s.KeyService.AddMultipleKeys(req.GroupID, req.KeysText)
+	result, err := s.KeyService.AddMultipleKeys(req.GroupID, req.KeysText, req.Source)
 	if err != nil {
 		if strings.Contains(err.Error(), "batch size exceeds the limit") {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -103,7 +129,7 @@ func (s *Server) AddMultipleKeys(c *gin.Context) {
 
 // AddMultipleKeysAsync handles creating new keys from a text block within a specific group.
 func (s *Server) AddMultipleKeysAsync(c *gin.Context) {
-	var req KeyTextRequest
+	var req AddKeysRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
 		return
@@ -118,8 +144,12 @@ func (s *Server) AddMultipleKeysAsync(c *gin.Context) {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
+	if err := validateKeySource(&req.Source); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
 
-	taskStatus, err := s.KeyImportService.StartImportTask(group, req.KeysText)
+	taskStatus, err := s.KeyImportService.StartImportTask(group, req.KeysText, req.Source)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrTaskInProgress, err.Error()))
 		return
@@ -141,7 +171,9 @@ func (s *Server) ListKeysInGroup(c *gin.Context) {
 	}
 
 	statusFilter := c.Query("status")
-	if statusFilter != "" && statusFilter != models.KeyStatusActive && statusFilter != models.KeyStatusInvalid {
+	switch statusFilter {
+	case "", models.KeyStatusActive, models.KeyStatusInvalid, models.KeyStatusSuspect, models.KeyStatusStandby:
+	default:
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Invalid status filter"))
 		return
 	}
@@ -156,6 +188,9 @@ func (s *Server) ListKeysInGroup(c *gin.Context) {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
+	for i := range keys {
+		keys[i].ErrorBudgetRemainingPercent = s.KeyService.KeyProvider.ErrorBudgetRemaining(&keys[i])
+	}
 
 	response.Success(c, paginatedResult)
 }
@@ -289,9 +324,18 @@ func (s *Server) TestMultipleKeys(c *gin.Context) {
 		return
 	}
 
+	var probe *channel.ProbeRequest
+	if len(results) > 0 {
+		probe, err = s.KeyService.KeyValidator.DescribeProbe(group, results[0].KeyValue)
+		if err != nil {
+			log.Printf("Failed to describe validation probe: %v", err)
+		}
+	}
+
 	response.Success(c, gin.H{
 		"results":        results,
 		"total_duration": duration,
+		"probe":          probe,
 	})
 }
 
@@ -412,17 +456,521 @@ func (s *Server) ExportKeys(c *gin.Context) {
 		return
 	}
 
+	format := c.DefaultQuery("format", services.KeyExportFormatText)
+	if format != services.KeyExportFormatText && format != services.KeyExportFormatCSV {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Invalid export format"))
+		return
+	}
+
 	group, ok := s.findGroupByID(c, groupID)
 	if !ok {
 		return
 	}
 
-	filename := fmt.Sprintf("keys-%s-%s.txt", group.Name, statusFilter)
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", "text/plain; charset=utf-8")
+	if format == services.KeyExportFormatCSV {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=keys-%s-%s.csv", group.Name, statusFilter))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=keys-%s-%s.txt", group.Name, statusFilter))
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+	}
 
-	err = s.KeyService.StreamKeysToWriter(groupID, statusFilter, c.Writer)
+	err = s.KeyService.StreamKeysToWriter(groupID, statusFilter, format, c.Writer)
 	if err != nil {
 		log.Printf("Failed to stream keys: %v", err)
 	}
 }
+
+// UpdateKeyQuotaPrecheckRequest defines the payload for configuring a key's balance pre-check.
+type UpdateKeyQuotaPrecheckRequest struct {
+	Endpoint   string  `json:"quota_precheck_endpoint"`
+	MinBalance float64 `json:"quota_precheck_min_balance"`
+}
+
+// UpdateKeyQuotaPrecheck configures the upstream balance endpoint and minimum balance of a key.
+func (s *Server) UpdateKeyQuotaPrecheck(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req UpdateKeyQuotaPrecheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var errs app_errors.ValidationErrors
+	req.Endpoint = strings.TrimSpace(req.Endpoint)
+	if req.Endpoint != "" {
+		u, err := url.Parse(req.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add("quota_precheck_endpoint", "must be a valid http or https URL")
+		}
+	}
+	if req.MinBalance < 0 {
+		errs.Add("quota_precheck_min_balance", "must not be negative")
+	}
+	if len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.UpdateQuotaPrecheck(key.ID, req.Endpoint, req.MinBalance); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.QuotaPrecheckEndpoint = req.Endpoint
+	key.QuotaPrecheckMinBalance = req.MinBalance
+	response.Success(c, key)
+}
+
+// UpdateKeyErrorBudgetRequest defines the payload for configuring a key's error budget.
+type UpdateKeyErrorBudgetRequest struct {
+	Percent     float64 `json:"error_budget_percent"`
+	WindowHours int     `json:"error_budget_window_hours"`
+}
+
+// UpdateKeyErrorBudget configures the error budget of a key. The key is disabled when its error
+// rate over the window exceeds the budget; a percent of 0 turns the budget off.
+func (s *Server) UpdateKeyErrorBudget(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req UpdateKeyErrorBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var errs app_errors.ValidationErrors
+	if req.Percent < 0 || req.Percent > 100 {
+		errs.Add("error_budget_percent", "must be between 0 and 100")
+	}
+	if req.Percent > 0 && (req.WindowHours < 1 || req.WindowHours > keypool.MaxErrorBudgetWindowHours) {
+		errs.Add("error_budget_window_hours", fmt.Sprintf("must be between 1 and %d", keypool.MaxErrorBudgetWindowHours))
+	}
+	if len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+	if req.Percent == 0 {
+		req.WindowHours = 0
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.UpdateErrorBudget(key.ID, req.Percent, req.WindowHours); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.ErrorBudgetPercent = req.Percent
+	key.ErrorBudgetWindowHours = req.WindowHours
+	key.ErrorBudgetRemainingPercent = s.KeyService.KeyProvider.ErrorBudgetRemaining(&key)
+	response.Success(c, key)
+}
+
+// UpdateKeyExpiryRequest defines the payload for setting a key's expiry.
+type UpdateKeyExpiryRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// UpdateKeyExpiry sets the time after which a key is no longer used, or clears it with a null
+// expires_at. With KEY_EXPIRY_AUTO_EXTEND, keys still in use near their expiry are extended.
+func (s *Server) UpdateKeyExpiry(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req UpdateKeyExpiryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			var errs app_errors.ValidationErrors
+			errs.Add("expires_at", "must be in the future")
+			response.Error(c, app_errors.NewValidationError(errs))
+			return
+		}
+		// 密钥 HASH 中以秒保存过期时间
+		expiresAt := req.ExpiresAt.Truncate(time.Second)
+		req.ExpiresAt = &expiresAt
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.UpdateExpiry(key.ID, req.ExpiresAt); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.ExpiresAt = req.ExpiresAt
+	response.Success(c, key)
+}
+
+// maxKeyWeight 是密钥权重允许的最大值
+const maxKeyWeight = 1000
+
+// UpdateKeyWeightRequest defines the payload for setting a key's weight.
+type UpdateKeyWeightRequest struct {
+	Weight *int `json:"weight" binding:"required"`
+}
+
+// UpdateKeyWeight sets the weight of a key for groups using weighted round-robin selection.
+// A weight of 0 keeps the key active but excludes it from weighted selection.
+func (s *Server) UpdateKeyWeight(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req UpdateKeyWeightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if *req.Weight < 0 || *req.Weight > maxKeyWeight {
+		var errs app_errors.ValidationErrors
+		errs.Add("weight", fmt.Sprintf("must be between 0 and %d", maxKeyWeight))
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.UpdateWeight(key.GroupID, key.ID, *req.Weight); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.Weight = *req.Weight
+	response.Success(c, key)
+}
+
+// UpdateKeyStandbyRequest defines the payload for marking a key as a standby key.
+type UpdateKeyStandbyRequest struct {
+	StandbyOnly *bool `json:"standby_only" binding:"required"`
+}
+
+// UpdateKeyStandby marks or unmarks a key as standby only. Standby keys are kept out of
+// selection until their group falls below STANDBY_ACTIVATION_THRESHOLD healthy keys.
+func (s *Server) UpdateKeyStandby(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req UpdateKeyStandbyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	status, err := s.KeyService.KeyProvider.UpdateStandbyOnly(key.GroupID, key.ID, *req.StandbyOnly)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.StandbyOnly = *req.StandbyOnly
+	key.Status = status
+	response.Success(c, key)
+}
+
+// ResetKeyErrorBudget clears the error budget counters of a key, e.g. after the cause of its
+// errors has been fixed. It does not change the status of the key.
+func (s *Server) ResetKeyErrorBudget(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.ResetErrorBudget(key.ID); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	key.ErrorBudgetRemainingPercent = s.KeyService.KeyProvider.ErrorBudgetRemaining(&key)
+	response.Success(c, key)
+}
+
+// keyScopeIDPattern matches OpenAI organization and project IDs, e.g. org-xxx and proj_xxx.
+var keyScopeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// validateKeyScope trims and validates the OpenAI organization and project of a key.
+func validateKeyScope(scope *models.KeyScope) app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	scope.OrgID = strings.TrimSpace(scope.OrgID)
+	scope.ProjectID = strings.TrimSpace(scope.ProjectID)
+	if len(scope.OrgID) > 100 || !keyScopeIDPattern.MatchString(scope.OrgID) {
+		errs.Add("org_id", "must be at most 100 letters, digits, '-' or '_'")
+	}
+	if len(scope.ProjectID) > 100 || !keyScopeIDPattern.MatchString(scope.ProjectID) {
+		errs.Add("project_id", "must be at most 100 letters, digits, '-' or '_'")
+	}
+	return errs
+}
+
+// UpdateKeyScope sets the OpenAI organization and project sent with a key's requests.
+func (s *Server) UpdateKeyScope(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req models.KeyScope
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if errs := validateKeyScope(&req); len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.UpdateKeyScope([]uint{key.ID}, req); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.OrgID = req.OrgID
+	key.ProjectID = req.ProjectID
+	key.LastFailureReason = ""
+	response.Success(c, key)
+}
+
+// UpdateKeyScopesRequest defines the payload for setting the OpenAI organization and project of several keys.
+type UpdateKeyScopesRequest struct {
+	KeyTextRequest
+	models.KeyScope
+}
+
+// UpdateKeyScopes sets the same OpenAI organization and project on keys from a text block.
+func (s *Server) UpdateKeyScopes(c *gin.Context) {
+	var req UpdateKeyScopesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+		return
+	}
+
+	if err := validateKeysText(req.KeysText); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+	if errs := validateKeyScope(&req.KeyScope); len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	updatedCount, err := s.KeyService.UpdateKeyScopes(req.GroupID, req.KeysText, req.KeyScope)
+	if err != nil {
+		if strings.Contains(err.Error(), "batch size exceeds the limit") {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else if err.Error() == "no valid keys found in the input text" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else {
+			response.Error(c, app_errors.ParseDBError(err))
+		}
+		return
+	}
+
+	response.Success(c, gin.H{"updated_count": updatedCount})
+}
+
+// Limits of the model affinity of a key.
+const (
+	maxModelAffinityPatterns      = 20
+	maxModelAffinityPatternLength = 100
+)
+
+// UpdateKeyModelAffinityRequest defines the payload for setting a key's model affinity.
+type UpdateKeyModelAffinityRequest struct {
+	ModelAffinity []string `json:"model_affinity"`
+}
+
+// validateModelAffinity trims, deduplicates and validates the model patterns of a key.
+func validateModelAffinity(patterns []string) ([]string, app_errors.ValidationErrors) {
+	var errs app_errors.ValidationErrors
+	if len(patterns) > maxModelAffinityPatterns {
+		errs.Add("model_affinity", fmt.Sprintf("must have at most %d patterns", maxModelAffinityPatterns))
+		return nil, errs
+	}
+	cleaned := make([]string, 0, len(patterns))
+	seen := make(map[string]bool, len(patterns))
+	for i, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || len(pattern) > maxModelAffinityPatternLength {
+			errs.Add(fmt.Sprintf("model_affinity.%d", i), fmt.Sprintf("must be a model name or pattern of 1 to %d characters", maxModelAffinityPatternLength))
+			continue
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			cleaned = append(cleaned, pattern)
+		}
+	}
+	return cleaned, errs
+}
+
+// UpdateKeyModelAffinity sets the models a key is preferred for, e.g. ["gpt-4*", "o1-*"].
+// An empty list clears it.
+func (s *Server) UpdateKeyModelAffinity(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || keyID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var req UpdateKeyModelAffinityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	patterns, errs := validateModelAffinity(req.ModelAffinity)
+	if len(errs) > 0 {
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.First(&key, keyID).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.KeyService.KeyProvider.UpdateModelAffinity(key.GroupID, []uint{key.ID}, patterns); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	key.ModelAffinity = nil
+	if len(patterns) > 0 {
+		key.ModelAffinity, _ = json.Marshal(patterns)
+	}
+	response.Success(c, key)
+}
+
+// UpdateKeySourcesRequest defines the payload for setting the source of several keys.
+type UpdateKeySourcesRequest struct {
+	KeyTextRequest
+	Source string `json:"source"`
+}
+
+// UpdateKeySources sets the same source on keys from a text block. An empty source clears it.
+func (s *Server) UpdateKeySources(c *gin.Context) {
+	var req UpdateKeySourcesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+		return
+	}
+
+	if err := validateKeysText(req.KeysText); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+	if err := validateKeySource(&req.Source); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	updatedCount, err := s.KeyService.UpdateKeySources(req.GroupID, req.KeysText, req.Source)
+	if err != nil {
+		if strings.Contains(err.Error(), "batch size exceeds the limit") {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else if err.Error() == "no valid keys found in the input text" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else {
+			response.Error(c, app_errors.ParseDBError(err))
+		}
+		return
+	}
+
+	response.Success(c, gin.H{"updated_count": updatedCount})
+}
+
+// ReEncryptKeys re-encrypts every stored key with the current DB_ENCRYPTION_KEY,
+// migrating plaintext keys and keys encrypted with DB_OLD_ENCRYPTION_KEY, and then
+// the key values recorded in request logs.
+func (s *Server) ReEncryptKeys(c *gin.Context) {
+	if !models.KeyEncryptionEnabled() {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "DB_ENCRYPTION_KEY is not configured"))
+		return
+	}
+
+	result, err := s.KeyService.ReEncryptKeys()
+	if err != nil {
+		log.Printf("Failed to re-encrypt keys, all changes were rolled back: %v", err)
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	log.Printf("Re-encrypted %d of %d stored keys", result.ReEncryptedCount, result.TotalCount)
+
+	// 请求日志中的密钥在密钥之后单独更新，失败后可重新执行
+	result.ReEncryptedLogCount, err = s.LogService.ReEncryptLogKeys()
+	if err != nil {
+		log.Printf("Failed to re-encrypt request log keys after re-encrypting %d keys: %v", result.ReEncryptedCount, err)
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	log.Printf("Re-encrypted the key values of %d request logs", result.ReEncryptedLogCount)
+	response.Success(c, result)
+}
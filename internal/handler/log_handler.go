@@ -1,23 +1,41 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+	"gpt-load/internal/utils"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 // LogResponse defines the structure for log entries in the API response
 type LogResponse struct {
 	models.RequestLog
+	// 请求体存放在对象存储时的预签名下载地址（signed_url=true），或读取失败的原因
+	PayloadURL   string `json:"payload_url,omitempty"`
+	PayloadError string `json:"payload_error,omitempty"`
 }
 
-// GetLogs handles fetching request logs with filtering and pagination.
+// GetLogs handles fetching request logs with filtering and pagination. With a cursor parameter,
+// empty for the first page, logs are paginated by cursor instead of page number.
 func (s *Server) GetLogs(c *gin.Context) {
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		s.getLogsAfter(c, cursor)
+		return
+	}
+
 	query := s.LogService.GetLogsQuery(c)
 
 	var logs []models.RequestLog
@@ -32,6 +50,54 @@ func (s *Server) GetLogs(c *gin.Context) {
 	response.Success(c, pagination)
 }
 
+func (s *Server) getLogsAfter(c *gin.Context, cursor string) {
+	limit, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(response.DefaultPageSize)))
+	if err != nil || limit <= 0 {
+		limit = response.DefaultPageSize
+	}
+	limit = min(limit, response.MaxPageSize)
+
+	page, err := s.LogService.GetLogsAfter(c, cursor, limit)
+	if errors.Is(err, services.ErrInvalidLogCursor) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, page)
+}
+
+// GetLog handles fetching a single request log. A request body stored in object storage is read
+// back transparently, or with signed_url=true a presigned download URL is returned instead.
+func (s *Server) GetLog(c *gin.Context) {
+	requestLog, err := s.LogService.GetLog(c.Param("id"))
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	resp := LogResponse{RequestLog: *requestLog}
+	if requestLog.PayloadRef != "" {
+		if signed, _ := strconv.ParseBool(c.Query("signed_url")); signed {
+			signedURL, err := s.PayloadOffload.SignedURL(requestLog)
+			if err != nil {
+				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+				return
+			}
+			resp.PayloadURL = signedURL
+		} else if body, err := s.PayloadOffload.Fetch(c.Request.Context(), requestLog); err != nil {
+			logrus.WithError(err).Warnf("Failed to read the payload of request log %s from object storage", requestLog.ID)
+			resp.PayloadError = err.Error()
+		} else {
+			resp.RequestBody = body
+		}
+	}
+
+	response.Success(c, resp)
+}
+
 // ExportLogs handles exporting filtered log keys to a CSV file.
 func (s *Server) ExportLogs(c *gin.Context) {
 	filename := fmt.Sprintf("log_keys_export_%s.csv", time.Now().Format("20060102150405"))
@@ -46,3 +112,63 @@ func (s *Server) ExportLogs(c *gin.Context) {
 		return
 	}
 }
+
+// ReplayLog re-sends the request of a request log through the proxy pipeline as a new request of
+// the same group, authenticated with one of its proxy keys, and returns the proxy's response. The
+// request body must have been stored (request body logging), and must match the recorded body
+// hash, so a body truncated for storage is never replayed.
+func (s *Server) ReplayLog(engine *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestLog, err := s.LogService.GetLog(c.Param("id"))
+		if err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+
+		body := requestLog.RequestBody
+		if requestLog.PayloadRef != "" {
+			if body, err = s.PayloadOffload.Fetch(c.Request.Context(), requestLog); err != nil {
+				response.Error(c, app_errors.NewAPIError(app_errors.ErrBadGateway, fmt.Sprintf("Failed to read the request body from object storage: %v", err)))
+				return
+			}
+		}
+		if body == "" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "The request body of this log was not stored, enable request body logging to replay requests"))
+			return
+		}
+		if utils.SHA256Hex([]byte(body)) != requestLog.RequestBodyHash {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "The stored request body is incomplete and cannot be replayed"))
+			return
+		}
+
+		target, err := url.Parse(requestLog.RequestPath)
+		if err != nil || !strings.HasPrefix(target.Path, "/proxy/") {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "The request path of this log cannot be replayed"))
+			return
+		}
+		group, err := s.GroupManager.GetGroupByName(requestLog.GroupName)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrResourceNotFound, fmt.Sprintf("Group '%s' no longer exists", requestLog.GroupName)))
+			return
+		}
+		proxyKeys := append(utils.SplitAndTrim(group.ProxyKeys, ","), utils.SplitAndTrim(group.EffectiveConfig.ProxyKeys, ",")...)
+		if len(proxyKeys) == 0 {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Group '%s' has no proxy key to replay the request with", group.Name)))
+			return
+		}
+
+		logrus.Infof("Replaying request log %s of group %s", requestLog.ID, group.Name)
+		c.Request.Method = http.MethodPost
+		c.Request.URL = target
+		c.Request.RequestURI = target.RequestURI()
+		c.Request.Body = io.NopCloser(strings.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header = http.Header{
+			"Content-Type":  {"application/json"},
+			"Authorization": {"Bearer " + proxyKeys[0]},
+		}
+		engine.HandleContext(c)
+		// 代理路由已完成处理，停止执行其处理链中剩余的处理函数
+		c.Abort()
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RecordingStatusResponse is the recording and replay state of a group with its recordings.
+type RecordingStatusResponse struct {
+	Recording   bool                     `json:"recording"`
+	RecordUntil *time.Time               `json:"record_until,omitempty"`
+	Replaying   bool                     `json:"replaying"`
+	ReplayID    string                   `json:"replay_id,omitempty"`
+	Recordings  []services.RecordingInfo `json:"recordings"`
+}
+
+// StartRecordingRequest starts recording a group's upstream interactions.
+type StartRecordingRequest struct {
+	DurationMinutes int `json:"duration_minutes"`
+}
+
+// SetReplayRequest enables or disables replay mode for a group.
+// RecordingID 为空时，每个请求回放方法和路径匹配的最新录制。
+type SetReplayRequest struct {
+	Enabled     bool   `json:"enabled"`
+	RecordingID string `json:"recording_id"`
+}
+
+// findGroup loads the group referenced by the :id path parameter, writing an error response on failure.
+func (s *Server) findGroup(c *gin.Context) (*models.Group, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid group ID format"))
+		return nil, false
+	}
+	var group models.Group
+	if err := s.DB.First(&group, uint(id)).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return nil, false
+	}
+	return &group, true
+}
+
+// GetRecordings returns the recording state of a group and its recordings.
+func (s *Server) GetRecordings(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	recordings, err := s.Recordings.List(group.ID)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	state := s.Recordings.GetState(group.ID)
+	response.Success(c, RecordingStatusResponse{
+		Recording:   s.Recordings.IsRecording(group.ID),
+		RecordUntil: state.RecordUntil,
+		Replaying:   s.Recordings.IsReplaying(group.ID),
+		ReplayID:    state.ReplayID,
+		Recordings:  recordings,
+	})
+}
+
+// GetRecording returns a single recording of a group.
+func (s *Server) GetRecording(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	recording, err := s.Recordings.Load(group.ID, c.Param("recording_id"))
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrResourceNotFound, err.Error()))
+		return
+	}
+	response.Success(c, recording)
+}
+
+// StartRecording starts recording a group's upstream interactions for a bounded duration.
+func (s *Server) StartRecording(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	var req StartRecordingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if req.DurationMinutes < 1 {
+		var errs app_errors.ValidationErrors
+		errs.Add("duration_minutes", "must be at least 1")
+		response.Error(c, app_errors.NewValidationError(errs))
+		return
+	}
+
+	until, err := s.Recordings.StartRecording(group.ID, time.Duration(req.DurationMinutes)*time.Minute)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	logrus.WithFields(logrus.Fields{"group": group.Name, "until": until}).Info("Upstream recording started")
+	response.Success(c, gin.H{"record_until": until})
+}
+
+// StopRecording stops recording a group's upstream interactions.
+func (s *Server) StopRecording(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	if err := s.Recordings.StopRecording(group.ID); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	logrus.WithField("group", group.Name).Info("Upstream recording stopped")
+	response.Success(c, nil)
+}
+
+// SetReplay switches a group's upstream to its recordings, or back to the real upstream.
+func (s *Server) SetReplay(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	var req SetReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	if err := s.Recordings.SetReplay(group, req.Enabled, req.RecordingID); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, fmt.Sprintf("Failed to set replay mode: %v", err)))
+		return
+	}
+	logrus.WithFields(logrus.Fields{"group": group.Name, "enabled": req.Enabled, "recordingID": req.RecordingID}).Warn("Upstream replay mode changed")
+	response.Success(c, nil)
+}
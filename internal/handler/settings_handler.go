@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
@@ -62,6 +63,11 @@ func (s *Server) UpdateSettings(c *gin.Context) {
 
 	// 更新配置
 	if err := s.SettingsManager.UpdateSettings(settingsMap); err != nil {
+		var validationErrs app_errors.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			response.Error(c, app_errors.NewValidationError(validationErrs))
+			return
+		}
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, err.Error()))
 		return
 	}
@@ -0,0 +1,323 @@
+// Package hosthealth probes the upstream hosts of groups with several upstreams, so that
+// upstream selection can skip a dead host without taking the whole group down.
+package hosthealth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// hostHealthKeyPrefix 每个分组一个 hash，字段为上游主机，值为 JSON 编码的 UpstreamHostStat
+const hostHealthKeyPrefix = "host_health:"
+
+// Origin returns the scheme and host of an upstream URL, which identify the upstream host.
+func Origin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// Checker probes every upstream host of groups that have more than one upstream. The master
+// probes and writes the results to the store; every instance reads them back into a local
+// snapshot, which is what IsDown consults on the request path.
+type Checker struct {
+	db            *gorm.DB
+	store         store.Store
+	configManager types.ConfigManager
+	clock         clock.Clock
+	metrics       *metrics.Metrics
+	client        *http.Client
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+
+	mu    sync.RWMutex
+	hosts map[uint][]models.UpstreamHostStat
+	down  map[uint]map[string]bool
+}
+
+// NewChecker creates a new Checker.
+func NewChecker(db *gorm.DB, store store.Store, configManager types.ConfigManager, clk clock.Clock, appMetrics *metrics.Metrics) *Checker {
+	return &Checker{
+		db:            db,
+		store:         store,
+		configManager: configManager,
+		clock:         clk,
+		metrics:       appMetrics,
+		stopChan:      make(chan struct{}),
+		hosts:         make(map[uint][]models.UpstreamHostStat),
+		down:          make(map[uint]map[string]bool),
+	}
+}
+
+// Enabled reports whether host health probing is configured.
+func (c *Checker) Enabled() bool {
+	return c.configManager.GetProxyConfig().HostHealthCheckIntervalSeconds > 0
+}
+
+// Start starts probing (on the master) and refreshing the local snapshot.
+func (c *Checker) Start() {
+	if !c.Enabled() {
+		return
+	}
+	cfg := c.configManager.GetProxyConfig()
+	c.client = &http.Client{
+		Timeout: time.Duration(cfg.HostHealthCheckTimeoutSeconds) * time.Second,
+		// 探测只关心主机能否响应，不跟随重定向
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	c.wg.Add(1)
+	go c.runLoop()
+	logrus.Debug("Upstream host health checker started")
+}
+
+// Stop stops the checker.
+func (c *Checker) Stop(ctx context.Context) {
+	if !c.Enabled() {
+		return
+	}
+	close(c.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("Upstream host health checker stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("Upstream host health checker stop timed out.")
+	}
+}
+
+// IsDown reports whether the upstream host of the group is marked down.
+func (c *Checker) IsDown(groupID uint, origin string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.down[groupID][origin]
+}
+
+// Stats returns the probed state of every upstream host, ordered by group and upstream.
+func (c *Checker) Stats() []models.UpstreamHostStat {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var stats []models.UpstreamHostStat
+	for _, hosts := range c.hosts {
+		stats = append(stats, hosts...)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].GroupID != stats[j].GroupID {
+			return stats[i].GroupID < stats[j].GroupID
+		}
+		return stats[i].Upstream < stats[j].Upstream
+	})
+	return stats
+}
+
+func (c *Checker) runLoop() {
+	defer c.wg.Done()
+
+	c.tick()
+	ticker := c.clock.NewTicker(time.Duration(c.configManager.GetProxyConfig().HostHealthCheckIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			c.tick()
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+// tick probes the hosts on the master and then reloads the snapshot from the store.
+func (c *Checker) tick() {
+	var groups []models.Group
+	if err := c.db.Select("id", "name", "upstreams").Find(&groups).Error; err != nil {
+		logrus.WithError(err).Error("Host health checker: failed to load groups")
+		return
+	}
+
+	if c.configManager.IsMaster() {
+		for i := range groups {
+			c.probeGroup(&groups[i])
+		}
+	}
+	c.refresh(groups)
+}
+
+// groupOrigins returns the distinct upstream hosts of the group, or nil when it has fewer than two.
+func groupOrigins(group *models.Group) []string {
+	var defs []struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(group.Upstreams, &defs); err != nil {
+		return nil
+	}
+
+	var origins []string
+	seen := make(map[string]bool)
+	for _, def := range defs {
+		u, err := url.Parse(def.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if origin := Origin(u); !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) < 2 {
+		return nil
+	}
+	return origins
+}
+
+// probeGroup probes each upstream host of the group and stores the updated state.
+func (c *Checker) probeGroup(group *models.Group) {
+	key := hostHealthKeyPrefix + strconv.FormatUint(uint64(group.ID), 10)
+	origins := groupOrigins(group)
+	if origins == nil {
+		// 上游少于两个时无需探测，清除遗留的状态
+		if err := c.store.Delete(key); err != nil {
+			logrus.WithError(err).Warnf("Host health checker: failed to clear state of group %s", group.Name)
+		}
+		return
+	}
+
+	previous := c.load(key)
+	threshold := c.configManager.GetProxyConfig().HostHealthFailureThreshold
+
+	values := make(map[string]any, len(origins))
+	for _, origin := range origins {
+		stat, ok := previous[origin]
+		if !ok {
+			stat = models.UpstreamHostStat{Up: true}
+		}
+		stat.GroupID = group.ID
+		stat.GroupName = group.Name
+		stat.Upstream = origin
+		stat.LastCheckedAt = c.clock.Now()
+
+		if err := c.probe(origin); err != nil {
+			stat.ConsecutiveFailures++
+			stat.LastError = err.Error()
+			if stat.Up && stat.ConsecutiveFailures >= threshold {
+				stat.Up = false
+				logrus.WithFields(logrus.Fields{"group": group.Name, "upstream": origin, "failures": stat.ConsecutiveFailures}).
+					Warnf("Upstream host is down, skipping it for the group's requests: %v", err)
+			}
+		} else {
+			if !stat.Up {
+				logrus.WithFields(logrus.Fields{"group": group.Name, "upstream": origin}).Info("Upstream host is back up")
+			}
+			stat.Up = true
+			stat.ConsecutiveFailures = 0
+			stat.LastError = ""
+		}
+
+		data, err := json.Marshal(stat)
+		if err != nil {
+			continue
+		}
+		values[origin] = string(data)
+	}
+
+	// 先删除再写入，移除已不在上游列表中的主机
+	if err := c.store.Delete(key); err != nil {
+		logrus.WithError(err).Warnf("Host health checker: failed to reset state of group %s", group.Name)
+	}
+	if err := c.store.HSet(key, values); err != nil {
+		logrus.WithError(err).Warnf("Host health checker: failed to store state of group %s", group.Name)
+	}
+}
+
+// probe sends a GET to the host. Any response below 500 counts as up: the host is reachable
+// even if it rejects the unauthenticated request.
+func (c *Checker) probe(origin string) error {
+	resp, err := c.client.Get(origin)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// load reads the stored state of a group's hosts.
+func (c *Checker) load(key string) map[string]models.UpstreamHostStat {
+	fields, err := c.store.HGetAll(key)
+	if err != nil {
+		logrus.WithError(err).Warnf("Host health checker: failed to load %s", key)
+		return nil
+	}
+
+	stats := make(map[string]models.UpstreamHostStat, len(fields))
+	for origin, value := range fields {
+		var stat models.UpstreamHostStat
+		if err := json.Unmarshal([]byte(value), &stat); err == nil {
+			stats[origin] = stat
+		}
+	}
+	return stats
+}
+
+// refresh replaces the local snapshot with the stored state of the current groups.
+func (c *Checker) refresh(groups []models.Group) {
+	hosts := make(map[uint][]models.UpstreamHostStat)
+	down := make(map[uint]map[string]bool)
+	for i := range groups {
+		group := &groups[i]
+		stats := c.load(hostHealthKeyPrefix + strconv.FormatUint(uint64(group.ID), 10))
+		for origin, stat := range stats {
+			hosts[group.ID] = append(hosts[group.ID], stat)
+			if !stat.Up {
+				if down[group.ID] == nil {
+					down[group.ID] = make(map[string]bool)
+				}
+				down[group.ID][origin] = true
+			}
+		}
+	}
+
+	c.mu.Lock()
+	previous := c.hosts
+	c.hosts = hosts
+	c.down = down
+	c.mu.Unlock()
+
+	// 更新指标，已移除的主机删除对应的序列
+	for _, stats := range previous {
+		for _, stat := range stats {
+			c.metrics.UpstreamHostUp.DeleteLabelValues(stat.GroupName, stat.Upstream)
+		}
+	}
+	for _, stats := range hosts {
+		for _, stat := range stats {
+			value := 0.0
+			if stat.Up {
+				value = 1
+			}
+			c.metrics.UpstreamHostUp.WithLabelValues(stat.GroupName, stat.Upstream).Set(value)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package hosthealth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stubConfigManager returns a fixed proxy configuration. Other methods are not implemented and
+// panic when called.
+type stubConfigManager struct {
+	types.ConfigManager
+	proxy types.ProxyConfig
+}
+
+func (m *stubConfigManager) GetProxyConfig() types.ProxyConfig { return m.proxy }
+func (m *stubConfigManager) IsMaster() bool                    { return true }
+
+func TestGroupOrigins(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstreams string
+		want      []string
+	}{
+		{
+			name:      "single upstream",
+			upstreams: `[{"url":"https://a.example.com/v1"}]`,
+		},
+		{
+			name:      "two hosts",
+			upstreams: `[{"url":"https://a.example.com/v1"},{"url":"https://b.example.com"}]`,
+			want:      []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			name:      "same host with different paths",
+			upstreams: `[{"url":"https://a.example.com/v1"},{"url":"https://a.example.com/v2"}]`,
+		},
+		{
+			name:      "scheme and port distinguish hosts",
+			upstreams: `[{"url":"https://a.example.com"},{"url":"http://a.example.com"},{"url":"https://a.example.com:8443"}]`,
+			want:      []string{"https://a.example.com", "http://a.example.com", "https://a.example.com:8443"},
+		},
+		{
+			name:      "invalid urls are skipped",
+			upstreams: `[{"url":"https://a.example.com"},{"url":"not a url"},{"url":"https://b.example.com"}]`,
+			want:      []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			name:      "malformed json",
+			upstreams: `{`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupOrigins(&models.Group{Upstreams: []byte(tt.upstreams)})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupOrigins() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckerProbeGroup(t *testing.T) {
+	type step struct {
+		status       int
+		wantDown     bool
+		wantFailures int
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{
+			name:      "healthy host stays up",
+			threshold: 2,
+			steps: []step{
+				{status: http.StatusOK},
+				{status: http.StatusUnauthorized},
+			},
+		},
+		{
+			name:      "marked down at the threshold",
+			threshold: 2,
+			steps: []step{
+				{status: http.StatusBadGateway, wantFailures: 1},
+				{status: http.StatusServiceUnavailable, wantDown: true, wantFailures: 2},
+				{status: http.StatusInternalServerError, wantDown: true, wantFailures: 3},
+			},
+		},
+		{
+			name:      "success resets the failure count",
+			threshold: 2,
+			steps: []step{
+				{status: http.StatusBadGateway, wantFailures: 1},
+				{status: http.StatusOK},
+				{status: http.StatusBadGateway, wantFailures: 1},
+			},
+		},
+		{
+			name:      "recovers after one success",
+			threshold: 1,
+			steps: []step{
+				{status: http.StatusBadGateway, wantDown: true, wantFailures: 1},
+				{status: http.StatusNotFound},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := http.StatusOK
+			flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+			defer flaky.Close()
+			healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer healthy.Close()
+
+			clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			c := NewChecker(nil, store.NewMemoryStore(clk), &stubConfigManager{proxy: types.ProxyConfig{
+				HostHealthFailureThreshold: tt.threshold,
+			}}, clk, metrics.NewMetrics(prometheus.NewRegistry()))
+			c.client = &http.Client{Timeout: 5 * time.Second}
+			group := models.Group{
+				ID:        1,
+				Name:      "group",
+				Upstreams: []byte(`[{"url":"` + flaky.URL + `/v1"},{"url":"` + healthy.URL + `"}]`),
+			}
+
+			for i, s := range tt.steps {
+				status = s.status
+				c.probeGroup(&group)
+				c.refresh([]models.Group{group})
+
+				if got := c.IsDown(group.ID, flaky.URL); got != s.wantDown {
+					t.Errorf("step %d: IsDown(flaky) = %v, want %v", i, got, s.wantDown)
+				}
+				if c.IsDown(group.ID, healthy.URL) {
+					t.Errorf("step %d: healthy host marked down", i)
+				}
+				for _, stat := range c.Stats() {
+					if stat.Upstream == flaky.URL && stat.ConsecutiveFailures != s.wantFailures {
+						t.Errorf("step %d: ConsecutiveFailures = %d, want %d", i, stat.ConsecutiveFailures, s.wantFailures)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckerProbeGroupClearsSingleUpstream(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := NewChecker(nil, store.NewMemoryStore(clk), &stubConfigManager{proxy: types.ProxyConfig{HostHealthFailureThreshold: 1}}, clk, metrics.NewMetrics(prometheus.NewRegistry()))
+	c.client = &http.Client{Timeout: 5 * time.Second}
+	group := models.Group{ID: 1, Name: "group", Upstreams: []byte(`[{"url":"` + down.URL + `"},{"url":"` + up.URL + `"}]`)}
+	c.probeGroup(&group)
+	c.refresh([]models.Group{group})
+	if !c.IsDown(group.ID, down.URL) {
+		t.Fatal("host not marked down")
+	}
+
+	// 分组改为单个上游后遗留的状态被清除
+	group.Upstreams = []byte(`[{"url":"` + down.URL + `"}]`)
+	c.probeGroup(&group)
+	c.refresh([]models.Group{group})
+	if c.IsDown(group.ID, down.URL) {
+		t.Error("host of a single-upstream group still marked down")
+	}
+	if stats := c.Stats(); len(stats) != 0 {
+		t.Errorf("Stats() = %v, want none", stats)
+	}
+}
@@ -2,8 +2,10 @@ package keypool
 
 import (
 	"context"
+	"gpt-load/internal/clock"
 	"gpt-load/internal/config"
 	"gpt-load/internal/models"
+	appruntime "gpt-load/internal/runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,11 +14,18 @@ import (
 	"gorm.io/gorm"
 )
 
-// NewCronChecker is responsible for periodically validating invalid keys.
+// healthCheckTick 是检查哪些分组的可用密钥需要健康检查的周期
+const healthCheckTick = time.Minute
+
+// NewCronChecker is responsible for periodically validating invalid keys, and health checking
+// active keys of groups with a key health check interval.
 type CronChecker struct {
 	DB              *gorm.DB
 	SettingsManager *config.SystemSettingsManager
 	Validator       *KeyValidator
+	keyProvider     *KeyProvider
+	pool            *appruntime.GoroutinePool
+	clock           clock.Clock
 	stopChan        chan struct{}
 	wg              sync.WaitGroup
 }
@@ -26,11 +35,17 @@ func NewCronChecker(
 	db *gorm.DB,
 	settingsManager *config.SystemSettingsManager,
 	validator *KeyValidator,
+	keyProvider *KeyProvider,
+	pool *appruntime.GoroutinePool,
+	clk clock.Clock,
 ) *CronChecker {
 	return &CronChecker{
 		DB:              db,
 		SettingsManager: settingsManager,
 		Validator:       validator,
+		keyProvider:     keyProvider,
+		pool:            pool,
+		clock:           clk,
 		stopChan:        make(chan struct{}),
 	}
 }
@@ -66,14 +81,18 @@ func (s *CronChecker) runLoop() {
 
 	s.submitValidationJobs()
 
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := s.clock.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
+	healthTicker := s.clock.NewTicker(healthCheckTick)
+	defer healthTicker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			logrus.Debug("CronChecker: Running as Master, submitting validation jobs.")
 			s.submitValidationJobs()
+		case <-healthTicker.C():
+			s.submitHealthCheckJobs()
 		case <-s.stopChan:
 			return
 		}
@@ -88,7 +107,7 @@ func (s *CronChecker) submitValidationJobs() {
 		return
 	}
 
-	validationStartTime := time.Now()
+	validationStartTime := s.clock.Now()
 	var wg sync.WaitGroup
 
 	for i := range groups {
@@ -99,6 +118,7 @@ func (s *CronChecker) submitValidationJobs() {
 		if group.LastValidatedAt == nil || validationStartTime.Sub(*group.LastValidatedAt) > interval {
 			wg.Add(1)
 			g := group
+			// 分组任务只等待其验证 worker，不占用协程池名额，避免嵌套获取名额导致死锁
 			go func() {
 				defer wg.Done()
 				s.validateGroupKeys(g)
@@ -111,17 +131,18 @@ func (s *CronChecker) submitValidationJobs() {
 
 // validateGroupKeys validates all invalid keys for a single group concurrently.
 func (s *CronChecker) validateGroupKeys(group *models.Group) {
-	groupProcessStart := time.Now()
+	groupProcessStart := s.clock.Now()
 
 	var invalidKeys []models.APIKey
-	err := s.DB.Where("group_id = ? AND status = ?", group.ID, models.KeyStatusInvalid).Find(&invalidKeys).Error
+	// 同时包含 suspect 状态的密钥，避免其确认探测因重启等原因丢失后一直停留在该状态
+	err := s.DB.Where("group_id = ? AND status IN ?", group.ID, []string{models.KeyStatusInvalid, models.KeyStatusSuspect}).Find(&invalidKeys).Error
 	if err != nil {
 		logrus.Errorf("CronChecker: Failed to get invalid keys for group %s: %v", group.Name, err)
 		return
 	}
 
 	if len(invalidKeys) == 0 {
-		if err := s.DB.Model(group).Update("last_validated_at", time.Now()).Error; err != nil {
+		if err := s.DB.Model(group).Update("last_validated_at", s.clock.Now()).Error; err != nil {
 			logrus.Errorf("CronChecker: Failed to update last_validated_at for group %s: %v", group.Name, err)
 		}
 		logrus.Infof("CronChecker: Group '%s' has no invalid keys to check.", group.Name)
@@ -135,7 +156,7 @@ func (s *CronChecker) validateGroupKeys(group *models.Group) {
 	concurrency := group.EffectiveConfig.KeyValidationConcurrency
 	for range concurrency {
 		keyWg.Add(1)
-		go func() {
+		s.pool.Go(func() {
 			defer keyWg.Done()
 			for {
 				select {
@@ -151,7 +172,7 @@ func (s *CronChecker) validateGroupKeys(group *models.Group) {
 					return
 				}
 			}
-		}()
+		})
 	}
 
 DistributeLoop:
@@ -166,11 +187,11 @@ DistributeLoop:
 
 	keyWg.Wait()
 
-	if err := s.DB.Model(group).Update("last_validated_at", time.Now()).Error; err != nil {
+	if err := s.DB.Model(group).Update("last_validated_at", s.clock.Now()).Error; err != nil {
 		logrus.Errorf("CronChecker: Failed to update last_validated_at for group %s: %v", group.Name, err)
 	}
 
-	duration := time.Since(groupProcessStart)
+	duration := s.clock.Since(groupProcessStart)
 	logrus.Infof(
 		"CronChecker: Group '%s' validation finished. Total checked: %d, became valid: %d. Duration: %s.",
 		group.Name,
@@ -179,3 +200,95 @@ DistributeLoop:
 		duration.String(),
 	)
 }
+
+// submitHealthCheckJobs health checks the active keys that have not been checked within their
+// group's key health check interval.
+func (s *CronChecker) submitHealthCheckJobs() {
+	var groups []models.Group
+	if err := s.DB.Find(&groups).Error; err != nil {
+		logrus.Errorf("CronChecker: Failed to get groups: %v", err)
+		return
+	}
+
+	now := s.clock.Now()
+	var wg sync.WaitGroup
+	for i := range groups {
+		group := &groups[i]
+		group.EffectiveConfig = s.SettingsManager.GetEffectiveConfig(group.Config)
+		interval := time.Duration(group.EffectiveConfig.KeyHealthCheckIntervalMinutes) * time.Minute
+		if interval <= 0 || group.DeleteAfter != nil {
+			continue
+		}
+		// 留出半个周期的余量，上次检查略晚于周期开始的密钥不会被推迟到下一个周期
+		cutoff := now.Add(healthCheckTick/2 - interval)
+
+		var keys []models.APIKey
+		err := s.DB.Where("group_id = ? AND status = ?", group.ID, models.KeyStatusActive).
+			Where("last_checked_at IS NULL OR last_checked_at <= ?", cutoff).
+			Find(&keys).Error
+		if err != nil {
+			logrus.Errorf("CronChecker: Failed to get keys to health check for group %s: %v", group.Name, err)
+			continue
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.healthCheckGroupKeys(group, keys)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// healthCheckGroupKeys health checks the keys of a single group concurrently.
+func (s *CronChecker) healthCheckGroupKeys(group *models.Group, keys []models.APIKey) {
+	start := s.clock.Now()
+
+	var disabledCount int32
+	var keyWg sync.WaitGroup
+	jobs := make(chan *models.APIKey, len(keys))
+
+	for range group.EffectiveConfig.KeyValidationConcurrency {
+		keyWg.Add(1)
+		s.pool.Go(func() {
+			defer keyWg.Done()
+			for {
+				select {
+				case key, ok := <-jobs:
+					if !ok {
+						return
+					}
+					if s.keyProvider.CheckKeyHealth(key, group) {
+						atomic.AddInt32(&disabledCount, 1)
+					}
+				case <-s.stopChan:
+					return
+				}
+			}
+		})
+	}
+
+DistributeLoop:
+	for i := range keys {
+		select {
+		case jobs <- &keys[i]:
+		case <-s.stopChan:
+			break DistributeLoop
+		}
+	}
+	close(jobs)
+
+	keyWg.Wait()
+
+	logrus.Infof(
+		"CronChecker: Group '%s' health check finished. Total checked: %d, disabled: %d. Duration: %s.",
+		group.Name,
+		len(keys),
+		disabledCount,
+		s.clock.Since(start).String(),
+	)
+}
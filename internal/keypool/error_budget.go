@@ -0,0 +1,302 @@
+package keypool
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/notify"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MaxErrorBudgetWindowHours is the longest error budget window a key can have.
+const MaxErrorBudgetWindowHours = 720
+
+const (
+	// errorBudgetKeyPrefix 每个密钥一个 hash，保存窗口内的 requests、errors 合计及最近写入的小时 last_hour；
+	// 每小时的计数保存在 <prefix><keyID>:<hour> 中，滑出窗口时从合计中减去并删除
+	errorBudgetKeyPrefix = "key_error_budget:"
+	// errorBudgetRollLockTTL 滑动窗口的锁，同一小时只由一个请求移除过期的小时计数
+	errorBudgetRollLockTTL = time.Hour
+)
+
+// KeyErrorBudgetEvent is the webhook payload sent when a key exhausts its error budget.
+type KeyErrorBudgetEvent struct {
+	Event              string    `json:"event"`
+	KeyID              uint      `json:"key_id"`
+	GroupID            uint      `json:"group_id"`
+	GroupName          string    `json:"group_name"`
+	ErrorBudgetPercent float64   `json:"error_budget_percent"`
+	ErrorRatePercent   float64   `json:"error_rate_percent"`
+	Requests           int64     `json:"requests"`
+	Errors             int64     `json:"errors"`
+	WindowHours        int       `json:"window_hours"`
+	Timestamp          time.Time `json:"timestamp"`
+}
+
+// RecordErrorBudget 异步地将一次请求计入密钥的错误预算，窗口内错误率超出预算时禁用该密钥。
+// 未设置错误预算的密钥不做任何处理。
+func (p *KeyProvider) RecordErrorBudget(apiKey *models.APIKey, group *models.Group, success bool) {
+	if apiKey.ErrorBudgetPercent <= 0 || apiKey.ErrorBudgetWindowHours <= 0 {
+		return
+	}
+	p.pool.GoNoWait(func() {
+		if err := p.recordErrorBudget(apiKey, group, success); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to record key error budget")
+		}
+	})
+}
+
+func (p *KeyProvider) recordErrorBudget(apiKey *models.APIKey, group *models.Group, success bool) error {
+	hour := p.clock.Now().Unix() / 3600
+	if err := p.rollErrorBudget(apiKey.ID, apiKey.ErrorBudgetWindowHours, hour); err != nil {
+		return err
+	}
+
+	totalsKey := errorBudgetTotalsKey(apiKey.ID)
+	bucketKey := errorBudgetBucketKey(apiKey.ID, hour)
+	if _, err := p.store.HIncrBy(bucketKey, "requests", 1); err != nil {
+		return fmt.Errorf("failed to increment error budget bucket: %w", err)
+	}
+	requests, err := p.store.HIncrBy(totalsKey, "requests", 1)
+	if err != nil {
+		return fmt.Errorf("failed to increment error budget requests: %w", err)
+	}
+
+	var increment int64
+	if !success {
+		increment = 1
+		if _, err := p.store.HIncrBy(bucketKey, "errors", 1); err != nil {
+			return fmt.Errorf("failed to increment error budget bucket: %w", err)
+		}
+	}
+	errorCount, err := p.store.HIncrBy(totalsKey, "errors", increment)
+	if err != nil {
+		return fmt.Errorf("failed to increment error budget errors: %w", err)
+	}
+
+	if success || requests < int64(p.configManager.GetKeyPoolConfig().ErrorBudgetMinRequests) {
+		return nil
+	}
+	if float64(errorCount)*100 <= apiKey.ErrorBudgetPercent*float64(requests) {
+		return nil
+	}
+	return p.exhaustErrorBudget(apiKey, group, requests, errorCount)
+}
+
+// rollErrorBudget 在进入新的小时后，从合计中减去滑出窗口的小时计数。
+func (p *KeyProvider) rollErrorBudget(keyID uint, windowHours int, hour int64) error {
+	totalsKey := errorBudgetTotalsKey(keyID)
+	totals, err := p.store.HGetAll(totalsKey)
+	if err != nil {
+		return fmt.Errorf("failed to load error budget: %w", err)
+	}
+	lastHour, err := strconv.ParseInt(totals["last_hour"], 10, 64)
+	if err != nil {
+		return p.store.HSet(totalsKey, map[string]any{"last_hour": hour})
+	}
+	if lastHour >= hour {
+		return nil
+	}
+
+	locked, err := p.store.SetNX(fmt.Sprintf("%s:roll:%d", totalsKey, hour), []byte("1"), errorBudgetRollLockTTL)
+	if err != nil || !locked {
+		return err
+	}
+
+	// 上次写入时窗口内的小时为 (lastHour-windowHours, lastHour]，其中不晚于 hour-windowHours 的已滑出窗口
+	for h := lastHour - int64(windowHours) + 1; h <= min(lastHour, hour-int64(windowHours)); h++ {
+		bucketKey := errorBudgetBucketKey(keyID, h)
+		bucket, err := p.store.HGetAll(bucketKey)
+		if err != nil {
+			return fmt.Errorf("failed to load error budget bucket: %w", err)
+		}
+		if len(bucket) == 0 {
+			continue
+		}
+		requests, _ := strconv.ParseInt(bucket["requests"], 10, 64)
+		errorCount, _ := strconv.ParseInt(bucket["errors"], 10, 64)
+		if _, err := p.store.HIncrBy(totalsKey, "requests", -requests); err != nil {
+			return fmt.Errorf("failed to update error budget requests: %w", err)
+		}
+		if _, err := p.store.HIncrBy(totalsKey, "errors", -errorCount); err != nil {
+			return fmt.Errorf("failed to update error budget errors: %w", err)
+		}
+		if err := p.store.Delete(bucketKey); err != nil {
+			return fmt.Errorf("failed to delete error budget bucket: %w", err)
+		}
+	}
+	return p.store.HSet(totalsKey, map[string]any{"last_hour": hour})
+}
+
+// errorBudgetUsage returns the requests and errors of the key in its current window.
+func (p *KeyProvider) errorBudgetUsage(keyID uint, windowHours int) (int64, int64, error) {
+	if err := p.rollErrorBudget(keyID, windowHours, p.clock.Now().Unix()/3600); err != nil {
+		return 0, 0, err
+	}
+	totals, err := p.store.HGetAll(errorBudgetTotalsKey(keyID))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load error budget: %w", err)
+	}
+	requests, _ := strconv.ParseInt(totals["requests"], 10, 64)
+	errorCount, _ := strconv.ParseInt(totals["errors"], 10, 64)
+	return requests, errorCount, nil
+}
+
+// ErrorBudgetRemaining 返回密钥剩余的错误预算占预算的百分比（0-100），未设置错误预算时返回 nil。
+func (p *KeyProvider) ErrorBudgetRemaining(key *models.APIKey) *float64 {
+	if key.ErrorBudgetPercent <= 0 || key.ErrorBudgetWindowHours <= 0 {
+		return nil
+	}
+	requests, errorCount, err := p.errorBudgetUsage(key.ID, key.ErrorBudgetWindowHours)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Warn("Failed to load key error budget")
+		return nil
+	}
+	remaining := 100.0
+	if requests > 0 {
+		rate := float64(errorCount) * 100 / float64(requests)
+		remaining = max(0, min(100, 100*(1-rate/key.ErrorBudgetPercent)))
+	}
+	return &remaining
+}
+
+// errorBudgetExhausted reports whether the key is over its error budget, so that a key disabled
+// by its budget is not restored before the errors leave the window or the budget is reset.
+func (p *KeyProvider) errorBudgetExhausted(keyID uint, percent float64, windowHours int) bool {
+	if percent <= 0 || windowHours <= 0 {
+		return false
+	}
+	requests, errorCount, err := p.errorBudgetUsage(keyID, windowHours)
+	if err != nil || requests < int64(p.configManager.GetKeyPoolConfig().ErrorBudgetMinRequests) {
+		return false
+	}
+	return float64(errorCount)*100 > percent*float64(requests)
+}
+
+// exhaustErrorBudget 禁用错误率超出预算的密钥并发送通知。
+func (p *KeyProvider) exhaustErrorBudget(apiKey *models.APIKey, group *models.Group, requests, errorCount int64) error {
+	keyHashKey := fmt.Sprintf("key:%d", apiKey.ID)
+	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", group.ID)
+	rate := float64(errorCount) * 100 / float64(requests)
+	reason := fmt.Sprintf("error budget exhausted: %.2f%% errors in %d requests over %dh, budget %.2f%%",
+		rate, requests, apiKey.ErrorBudgetWindowHours, apiKey.ErrorBudgetPercent)
+
+	disabled := false
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		var key models.APIKey
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, apiKey.ID).Error; err != nil {
+			return fmt.Errorf("failed to lock key %d for update: %w", apiKey.ID, err)
+		}
+		// 已被禁用的密钥无需重复处理
+		if key.Status != models.KeyStatusActive {
+			return nil
+		}
+
+		updates := map[string]any{"status": models.KeyStatusInvalid, "last_failure_reason": reason}
+		if err := tx.Model(&key).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to disable key in DB: %w", err)
+		}
+		if err := p.store.LRem(activeKeysListKey, 0, apiKey.ID); err != nil {
+			return fmt.Errorf("failed to LRem key from active list: %w", err)
+		}
+		if err := p.store.HSet(keyHashKey, map[string]any{"status": models.KeyStatusInvalid}); err != nil {
+			return fmt.Errorf("failed to update key status in store: %w", err)
+		}
+		disabled = true
+		return nil
+	})
+	if err != nil || !disabled {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"keyID":       apiKey.ID,
+		"group":       group.Name,
+		"errorRate":   rate,
+		"budget":      apiKey.ErrorBudgetPercent,
+		"requests":    requests,
+		"errors":      errorCount,
+		"windowHours": apiKey.ErrorBudgetWindowHours,
+	}).Error("Key exhausted its error budget, disabling it")
+
+	p.keyStateChanged(apiKey.ID, models.KeyStatusInvalid)
+	p.CheckPoolViability()
+	p.recordKeysDisabled(group.ID, apiKey.Source, KeyDisableReasonErrorBudget, 1)
+
+	event := KeyErrorBudgetEvent{
+		Event:              "key_error_budget_exhausted",
+		KeyID:              apiKey.ID,
+		GroupID:            group.ID,
+		GroupName:          group.Name,
+		ErrorBudgetPercent: apiKey.ErrorBudgetPercent,
+		ErrorRatePercent:   rate,
+		Requests:           requests,
+		Errors:             errorCount,
+		WindowHours:        apiKey.ErrorBudgetWindowHours,
+		Timestamp:          p.clock.Now(),
+	}
+	p.notifier.Notify(notify.ChannelKeyErrorBudget, notify.Event{
+		Type:     event.Event,
+		Severity: notify.SeverityWarning,
+		Group:    group.Name,
+		Summary: fmt.Sprintf(":warning: Key %d of group %s exhausted its error budget (%.2f%% errors in %d requests, budget %.2f%%) and was disabled.",
+			apiKey.ID, group.Name, rate, requests, apiKey.ErrorBudgetPercent),
+		Timestamp: event.Timestamp,
+		Payload:   event,
+	})
+	return nil
+}
+
+// ResetErrorBudget 清空密钥错误预算的计数，不改变密钥状态。
+func (p *KeyProvider) ResetErrorBudget(keyID uint) error {
+	totalsKey := errorBudgetTotalsKey(keyID)
+	totals, err := p.store.HGetAll(totalsKey)
+	if err != nil {
+		return fmt.Errorf("failed to load error budget: %w", err)
+	}
+
+	keys := []string{totalsKey}
+	if lastHour, err := strconv.ParseInt(totals["last_hour"], 10, 64); err == nil {
+		for h := lastHour - MaxErrorBudgetWindowHours + 1; h <= lastHour; h++ {
+			keys = append(keys, errorBudgetBucketKey(keyID, h))
+		}
+	}
+	if err := p.store.Del(keys...); err != nil {
+		return fmt.Errorf("failed to reset error budget: %w", err)
+	}
+	return nil
+}
+
+// UpdateErrorBudget 更新密钥的错误预算，并清空之前的计数。percent 为 0 时关闭错误预算。
+func (p *KeyProvider) UpdateErrorBudget(keyID uint, percent float64, windowHours int) error {
+	updates := map[string]any{
+		"error_budget_percent":      percent,
+		"error_budget_window_hours": windowHours,
+	}
+
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id = ?", keyID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update error budget for key %d: %w", keyID, err)
+		}
+		if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), updates); err != nil {
+			return fmt.Errorf("failed to update error budget in store: %w", err)
+		}
+		return p.ResetErrorBudget(keyID)
+	})
+	if err == nil {
+		p.events.Publish(KeyEventUpdated, keyID, 0, "")
+	}
+	return err
+}
+
+func errorBudgetTotalsKey(keyID uint) string {
+	return errorBudgetKeyPrefix + strconv.FormatUint(uint64(keyID), 10)
+}
+
+func errorBudgetBucketKey(keyID uint, hour int64) string {
+	return fmt.Sprintf("%s%d:%d", errorBudgetKeyPrefix, keyID, hour)
+}
@@ -0,0 +1,108 @@
+package keypool
+
+import (
+	"fmt"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// RecordValidationResult 记录密钥最近一次验证的时间和错误，验证通过时 errorMsg 为空。
+func (p *KeyProvider) RecordValidationResult(keyID uint, errorMsg string) {
+	updates := map[string]any{
+		"last_checked_at":  p.clock.Now(),
+		"last_check_error": truncateReason(errorMsg),
+	}
+	if err := p.db.Model(&models.APIKey{}).Where("id = ?", keyID).Updates(updates).Error; err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "error": err}).Error("Failed to record key validation result")
+	}
+}
+
+// CheckKeyHealth 探测一个可用密钥并记录结果。连续失败达到分组的健康检查失败阈值时禁用密钥，
+// 之后由定时验证重新验证，通过后自动恢复。返回密钥是否被禁用。
+func (p *KeyProvider) CheckKeyHealth(apiKey *models.APIKey, group *models.Group) bool {
+	isValid, probeErr := p.runProbe(apiKey, group)
+	if !isValid && probeErr == nil {
+		probeErr = fmt.Errorf("key validation failed")
+	}
+
+	// 与请求失败一致，资源耗尽等不代表密钥失效的错误不计入失败次数
+	counted := !isValid && !app_errors.IsUnCounted(probeErr.Error())
+	threshold := group.EffectiveConfig.KeyHealthCheckFailureThreshold
+	reason := ""
+	if !isValid {
+		reason = truncateReason(probeErr.Error())
+	}
+
+	var failures int
+	disabled := false
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		var key models.APIKey
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, apiKey.ID).Error; err != nil {
+			return fmt.Errorf("failed to lock key %d for update: %w", apiKey.ID, err)
+		}
+
+		updates := map[string]any{"last_checked_at": p.clock.Now(), "last_check_error": reason}
+		failures = key.HealthCheckFailures
+		// 检查期间被禁用或移入备用的密钥只记录结果
+		if key.Status == models.KeyStatusActive {
+			switch {
+			case isValid:
+				failures = 0
+			case counted:
+				failures++
+			}
+			updates["health_check_failures"] = failures
+			if failures >= threshold {
+				// 禁用时清零计数，重新启用后重新开始计数
+				disabled = true
+				updates["health_check_failures"] = 0
+				updates["status"] = models.KeyStatusInvalid
+				updates["last_failure_reason"] = truncateReason(fmt.Sprintf("health check failed %d times in a row: %s", failures, reason))
+			}
+		}
+
+		if err := tx.Model(&key).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to record health check result: %w", err)
+		}
+		if disabled {
+			return p.setKeyPoolStatus(apiKey.ID, group.ID, models.KeyStatusInvalid)
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "group": group.Name, "error": err}).Error("Failed to apply key health check result")
+		return false
+	}
+
+	if !disabled {
+		if !isValid {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "group": group.Name, "failures": failures, "error": probeErr}).Debug("Key health check failed")
+		}
+		return false
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"keyID":     apiKey.ID,
+		"group":     group.Name,
+		"threshold": threshold,
+		"error":     probeErr,
+	}).Warn("Key has failed consecutive health checks, disabling it.")
+
+	p.keyStateChanged(apiKey.ID, models.KeyStatusInvalid)
+	p.CheckPoolViability()
+	p.recordKeysDisabled(group.ID, apiKey.Source, KeyDisableReasonHealthCheck, 1)
+	return true
+}
+
+// truncateReason 将原因截断到 varchar(255) 列的长度
+func truncateReason(reason string) string {
+	if len(reason) > maxFailureReasonLength {
+		reason = strings.ToValidUTF8(reason[:maxFailureReasonLength], "")
+	}
+	return reason
+}
@@ -0,0 +1,215 @@
+package keypool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Key pool event types written to the key event stream.
+const (
+	KeyEventAdded        = "added"
+	KeyEventRemoved      = "removed"
+	KeyEventUpdated      = "updated"
+	KeyEventStateChanged = "state_changed"
+)
+
+const (
+	// keyEventStreamMaxLen 流的大致长度上限，只需覆盖各实例读取的延迟
+	keyEventStreamMaxLen = 10000
+	keyEventReadCount    = 100
+	keyEventReadBlock    = 2 * time.Second
+	keyEventRetryDelay   = 5 * time.Second
+)
+
+// KeyEvent is a key pool mutation.
+type KeyEvent struct {
+	Type     string
+	KeyID    uint
+	GroupID  uint
+	Status   string
+	Instance string
+}
+
+// KeyEventStream writes key pool mutations to a Redis Stream and applies the mutations of
+// other instances to the local per-key state. The key pool itself lives in the shared store,
+// so only state held in process memory, such as the per-key metrics, needs to follow the events.
+// Without Redis there is a single instance and the stream is disabled.
+type KeyEventStream struct {
+	streams    store.StreamStore
+	stream     string
+	instanceID string
+	metrics    *metrics.Metrics
+
+	started  bool
+	stopChan chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewKeyEventStream creates a KeyEventStream, enabled when the store supports streams.
+func NewKeyEventStream(s store.Store, configManager types.ConfigManager, appMetrics *metrics.Metrics) *KeyEventStream {
+	ks := &KeyEventStream{
+		stream:     configManager.GetEffectiveServerConfig().KeySyncStreamName,
+		instanceID: instanceID(),
+		metrics:    appMetrics,
+		stopChan:   make(chan struct{}),
+	}
+	if streams, ok := s.(store.StreamStore); ok && ks.stream != "" {
+		ks.streams = streams
+	}
+	return ks
+}
+
+// instanceID identifies this process as hostname-PID. It names the consumer group of the instance.
+func instanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// Enabled reports whether key pool events are written to the stream.
+func (ks *KeyEventStream) Enabled() bool {
+	return ks != nil && ks.streams != nil
+}
+
+// Publish appends a key pool mutation to the stream. Failures are logged and otherwise ignored,
+// since the mutation itself has already been applied to the shared store.
+func (ks *KeyEventStream) Publish(eventType string, keyID, groupID uint, status string) {
+	if !ks.Enabled() {
+		return
+	}
+	values := map[string]any{
+		"type":     eventType,
+		"key_id":   keyID,
+		"group_id": groupID,
+		"status":   status,
+		"instance": ks.instanceID,
+	}
+	if err := ks.streams.XAdd(ks.stream, keyEventStreamMaxLen, values); err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "event": eventType, "error": err}).Warn("Failed to write key pool event to stream")
+	}
+}
+
+// Start creates the consumer group of this instance and starts reading events.
+func (ks *KeyEventStream) Start() error {
+	if !ks.Enabled() {
+		return nil
+	}
+	if err := ks.streams.XGroupCreate(ks.stream, ks.instanceID); err != nil {
+		return fmt.Errorf("failed to create key event consumer group: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ks.cancel = cancel
+	ks.started = true
+	ks.wg.Add(1)
+	go ks.runConsumer(ctx)
+	logrus.Debugf("Reading key pool events from stream %s as %s", ks.stream, ks.instanceID)
+	return nil
+}
+
+// Stop stops reading events and removes the consumer group of this instance,
+// since the next process gets a new instance ID.
+func (ks *KeyEventStream) Stop(ctx context.Context) {
+	if !ks.started {
+		return
+	}
+	close(ks.stopChan)
+	ks.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ks.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("KeyEventStream stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("KeyEventStream stop timed out.")
+	}
+
+	if err := ks.streams.XGroupDestroy(ks.stream, ks.instanceID); err != nil {
+		logrus.WithError(err).Warn("Failed to remove key event consumer group")
+	}
+}
+
+func (ks *KeyEventStream) runConsumer(ctx context.Context) {
+	defer ks.wg.Done()
+
+	for {
+		select {
+		case <-ks.stopChan:
+			return
+		default:
+		}
+
+		messages, err := ks.streams.XReadGroup(ctx, ks.stream, ks.instanceID, ks.instanceID, keyEventReadCount, keyEventReadBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.WithError(err).Error("Failed to read key pool events")
+			select {
+			case <-time.After(keyEventRetryDelay):
+			case <-ks.stopChan:
+				return
+			}
+			continue
+		}
+
+		ids := make([]string, 0, len(messages))
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+			event, err := parseKeyEvent(msg.Values)
+			if err != nil {
+				logrus.WithError(err).WithField("id", msg.ID).Warn("Ignoring malformed key pool event")
+				continue
+			}
+			if event.Instance != ks.instanceID {
+				ks.apply(event)
+			}
+		}
+		if err := ks.streams.XAck(ks.stream, ks.instanceID, ids...); err != nil {
+			logrus.WithError(err).Warn("Failed to acknowledge key pool events")
+		}
+	}
+}
+
+func parseKeyEvent(values map[string]string) (KeyEvent, error) {
+	keyID, err := strconv.ParseUint(values["key_id"], 10, 64)
+	if err != nil {
+		return KeyEvent{}, fmt.Errorf("invalid key_id: %w", err)
+	}
+	groupID, _ := strconv.ParseUint(values["group_id"], 10, 64)
+	return KeyEvent{
+		Type:     values["type"],
+		KeyID:    uint(keyID),
+		GroupID:  uint(groupID),
+		Status:   values["status"],
+		Instance: values["instance"],
+	}, nil
+}
+
+// apply updates the local state of a key changed by another instance.
+func (ks *KeyEventStream) apply(event KeyEvent) {
+	switch event.Type {
+	case KeyEventAdded, KeyEventStateChanged:
+		ks.metrics.TrackKey(event.KeyID, keyCircuitValue(event.Status))
+	case KeyEventRemoved:
+		ks.metrics.UntrackKey(event.KeyID)
+	}
+}
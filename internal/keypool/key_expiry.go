@@ -0,0 +1,154 @@
+package keypool
+
+import (
+	"fmt"
+	"time"
+
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// KeyExpired reports whether the key has an expiry time that has passed.
+func (p *KeyProvider) KeyExpired(apiKey *models.APIKey) bool {
+	return apiKey.ExpiresAt != nil && !p.clock.Now().Before(*apiKey.ExpiresAt)
+}
+
+// UpdateExpiry 设置密钥的过期时间，nil 表示永不过期。
+func (p *KeyProvider) UpdateExpiry(keyID uint, expiresAt *time.Time) error {
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id = ?", keyID).Update("expires_at", expiresAt).Error; err != nil {
+			return fmt.Errorf("failed to update expiry for key %d: %w", keyID, err)
+		}
+		if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), map[string]any{"expires_at": expiryField(expiresAt)}); err != nil {
+			return fmt.Errorf("failed to update key expiry in store: %w", err)
+		}
+		return nil
+	})
+	if err == nil {
+		p.events.Publish(KeyEventUpdated, keyID, 0, "")
+	}
+	return err
+}
+
+// ExpireKey 异步地禁用已过期的密钥，并将其移出可用列表。
+func (p *KeyProvider) ExpireKey(apiKey *models.APIKey, group *models.Group) {
+	p.pool.GoNoWait(func() {
+		if err := p.expireKey(apiKey, group); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to disable expired key")
+		}
+	})
+}
+
+func (p *KeyProvider) expireKey(apiKey *models.APIKey, group *models.Group) error {
+	reason := fmt.Sprintf("key expired at %s", apiKey.ExpiresAt.UTC().Format(time.RFC3339))
+
+	disabled := false
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		var key models.APIKey
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, apiKey.ID).Error; err != nil {
+			return fmt.Errorf("failed to lock key %d for update: %w", apiKey.ID, err)
+		}
+		// 已被禁用，或过期时间已被顺延或修改的密钥不做处理
+		if key.Status != models.KeyStatusActive || !p.KeyExpired(&key) {
+			return nil
+		}
+
+		updates := map[string]any{"status": models.KeyStatusInvalid, "last_failure_reason": reason}
+		if err := tx.Model(&key).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to disable key in DB: %w", err)
+		}
+		if err := p.store.LRem(fmt.Sprintf("group:%d:active_keys", group.ID), 0, apiKey.ID); err != nil {
+			return fmt.Errorf("failed to LRem key from active list: %w", err)
+		}
+		if err := p.store.HSet(fmt.Sprintf("key:%d", apiKey.ID), map[string]any{"status": models.KeyStatusInvalid}); err != nil {
+			return fmt.Errorf("failed to update key status in store: %w", err)
+		}
+		disabled = true
+		return nil
+	})
+	if err != nil || !disabled {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"keyID":     apiKey.ID,
+		"group":     group.Name,
+		"expiresAt": apiKey.ExpiresAt.Format(time.RFC3339),
+	}).Warn("Key has expired, disabling it")
+
+	p.keyStateChanged(apiKey.ID, models.KeyStatusInvalid)
+	p.CheckPoolViability()
+	p.recordKeysDisabled(group.ID, apiKey.Source, KeyDisableReasonExpired, 1)
+	return nil
+}
+
+// ExtendExpiry 在开启 KEY_EXPIRY_AUTO_EXTEND 时，异步地顺延临近过期且仍在成功使用的密钥的过期时间，
+// 闲置的密钥不会被顺延，仍按时过期。
+func (p *KeyProvider) ExtendExpiry(apiKey *models.APIKey, group *models.Group) {
+	perfConfig := p.configManager.GetPerformanceConfig()
+	if !perfConfig.KeyExpiryAutoExtend || apiKey.ExpiresAt == nil {
+		return
+	}
+	warnWindow := time.Duration(perfConfig.KeyExpiryWarnDays) * 24 * time.Hour
+	if apiKey.ExpiresAt.Sub(p.clock.Now()) > warnWindow {
+		return
+	}
+
+	extension := time.Duration(perfConfig.KeyExpiryExtendDays) * 24 * time.Hour
+	p.pool.GoNoWait(func() {
+		if err := p.extendExpiry(apiKey, group, extension); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to extend key expiry")
+		}
+	})
+}
+
+func (p *KeyProvider) extendExpiry(apiKey *models.APIKey, group *models.Group, extension time.Duration) error {
+	previous := *apiKey.ExpiresAt
+	expiresAt := previous.Add(extension)
+	now := p.clock.Now()
+
+	extended := false
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		var key models.APIKey
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, apiKey.ID).Error; err != nil {
+			return fmt.Errorf("failed to lock key %d for update: %w", apiKey.ID, err)
+		}
+		// 过期时间已被并发的请求顺延或被管理端修改时不再顺延，避免同一时刻的多个成功请求重复顺延
+		if key.ExpiresAt == nil || key.ExpiresAt.Unix() != previous.Unix() {
+			return nil
+		}
+
+		updates := map[string]any{"expires_at": expiresAt, "auto_extended_at": now}
+		if err := tx.Model(&key).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to extend key expiry in DB: %w", err)
+		}
+		if err := p.store.HSet(fmt.Sprintf("key:%d", apiKey.ID), map[string]any{"expires_at": expiresAt.Unix()}); err != nil {
+			return fmt.Errorf("failed to update key expiry in store: %w", err)
+		}
+		extended = true
+		return nil
+	})
+	if err != nil || !extended {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"keyID":             apiKey.ID,
+		"group":             group.Name,
+		"previousExpiresAt": previous.Format(time.RFC3339),
+		"expiresAt":         expiresAt.Format(time.RFC3339),
+	}).Info("Key is in use close to its expiry, extended its expiry")
+
+	p.events.Publish(KeyEventUpdated, apiKey.ID, 0, "")
+	return nil
+}
+
+// expiryField 返回过期时间在密钥 HASH 中的值，0 表示永不过期。
+func expiryField(expiresAt *time.Time) int64 {
+	if expiresAt == nil {
+		return 0
+	}
+	return expiresAt.Unix()
+}
@@ -0,0 +1,72 @@
+package keypool
+
+import (
+	"fmt"
+	"time"
+
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxKeySourceLength 与 source 列长度一致
+const MaxKeySourceLength = 100
+
+// Reasons a key was disabled, counted per key source.
+const (
+	KeyDisableReasonBlacklist   = "blacklist_threshold"
+	KeyDisableReasonErrorBudget = "error_budget"
+	KeyDisableReasonSyncRemoved = "sync_removed"
+	KeyDisableReasonExpired     = "expired"
+	KeyDisableReasonHealthCheck = "health_check"
+)
+
+// UpdateKeySource 设置密钥的来源，空字符串清除来源。
+func (p *KeyProvider) UpdateKeySource(keyIDs []uint, source string) error {
+	if len(keyIDs) == 0 {
+		return nil
+	}
+
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id IN ?", keyIDs).Update("source", source).Error; err != nil {
+			return fmt.Errorf("failed to update key source: %w", err)
+		}
+		for _, keyID := range keyIDs {
+			if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), map[string]any{"source": source}); err != nil {
+				return fmt.Errorf("failed to update key source in store: %w", err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, keyID := range keyIDs {
+			p.events.Publish(KeyEventUpdated, keyID, 0, "")
+		}
+	}
+	return err
+}
+
+// recordKeysDisabled 累计某个来源的密钥在当前小时因 reason 被禁用的次数。没有来源的密钥不统计。
+func (p *KeyProvider) recordKeysDisabled(groupID uint, source, reason string, count int64) {
+	if source == "" || count <= 0 {
+		return
+	}
+	err := p.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "time"}, {Name: "group_id"}, {Name: "source"}, {Name: "reason"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count":      gorm.Expr("key_source_disable_stats.count + ?", count),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&models.KeySourceDisableStat{
+		Time:    p.clock.Now().Truncate(time.Hour),
+		GroupID: groupID,
+		Source:  source,
+		Reason:  reason,
+		Count:   count,
+	}).Error
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"groupID": groupID, "source": source, "reason": reason, "error": err}).Error("Failed to record disabled key for its source")
+	}
+}
@@ -0,0 +1,29 @@
+package keypool
+
+import (
+	"fmt"
+
+	"gpt-load/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// UpdateWeight 设置密钥在加权轮询中的权重，0 表示在加权轮询中不使用该密钥。
+func (p *KeyProvider) UpdateWeight(groupID, keyID uint, weight int) error {
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id = ?", keyID).Update("weight", weight).Error; err != nil {
+			return fmt.Errorf("failed to update weight for key %d: %w", keyID, err)
+		}
+		if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), map[string]any{"weight": weight}); err != nil {
+			return fmt.Errorf("failed to update key weight in store: %w", err)
+		}
+		if err := p.store.HSet(fmt.Sprintf(keyWeightsIndexKey, groupID), map[string]any{fmt.Sprint(keyID): weight}); err != nil {
+			return fmt.Errorf("failed to update key weight index: %w", err)
+		}
+		return nil
+	})
+	if err == nil {
+		p.events.Publish(KeyEventUpdated, keyID, groupID, "")
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+package keypool
+
+import "gpt-load/internal/models"
+
+// gptload_key_circuit_state values. Key status stands in for a circuit breaker: suspect keys
+// are awaiting their confirmation probe, like a half-open circuit.
+const (
+	keyCircuitClosed   = 0
+	keyCircuitHalfOpen = 1
+	keyCircuitOpen     = 2
+)
+
+func keyCircuitValue(status string) float64 {
+	switch status {
+	case models.KeyStatusSuspect:
+		return keyCircuitHalfOpen
+	case models.KeyStatusInvalid:
+		return keyCircuitOpen
+	default:
+		return keyCircuitClosed
+	}
+}
@@ -1,42 +1,93 @@
 package keypool
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"gpt-load/internal/channel"
+	"gpt-load/internal/clock"
 	"gpt-load/internal/config"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/models"
+	"gpt-load/internal/notify"
+	appruntime "gpt-load/internal/runtime"
 	"gpt-load/internal/store"
+	"gpt-load/internal/types"
 	"math/rand"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
+// suspectProbeDelay 是密钥进入 suspect 状态后到执行确认探测之间的等待时间。
+const suspectProbeDelay = 5 * time.Second
+
+// modelAffinityIndexKey 是分组内各 Key 模型亲和模式的 HASH，字段为 Key ID，值为模式的 JSON 数组，空值表示没有亲和
+const modelAffinityIndexKey = "group:%d:model_affinity"
+
+// keyWeightsIndexKey 是分组内各 Key 权重的 HASH，字段为 Key ID，缺失或无法解析的值按权重 1 处理
+const keyWeightsIndexKey = "group:%d:key_weights"
+
+// weightedRotateStateKey 是分组平滑加权轮询的当前权重状态 HASH
+const weightedRotateStateKey = "group:%d:wrr_state"
+
 type KeyProvider struct {
 	db              *gorm.DB
 	store           store.Store
 	settingsManager *config.SystemSettingsManager
+	channelFactory  *channel.Factory
+	pool            *appruntime.GoroutinePool
+	featureFlags    *config.FeatureFlagManager
+	viability       *PoolViabilityChecker
+	events          *KeyEventStream
+	clock           clock.Clock
+	configManager   types.ConfigManager
+	notifier        *notify.Notifier
+	metrics         *metrics.Metrics
+	affinityCursor  atomic.Uint64
+	standbyMu       sync.Mutex
 }
 
 // NewProvider 创建一个新的 KeyProvider 实例。
-func NewProvider(db *gorm.DB, store store.Store, settingsManager *config.SystemSettingsManager) *KeyProvider {
+func NewProvider(db *gorm.DB, store store.Store, settingsManager *config.SystemSettingsManager, channelFactory *channel.Factory, pool *appruntime.GoroutinePool, featureFlags *config.FeatureFlagManager, viability *PoolViabilityChecker, events *KeyEventStream, clk clock.Clock, configManager types.ConfigManager, notifier *notify.Notifier, appMetrics *metrics.Metrics) *KeyProvider {
 	return &KeyProvider{
 		db:              db,
 		store:           store,
 		settingsManager: settingsManager,
+		channelFactory:  channelFactory,
+		pool:            pool,
+		featureFlags:    featureFlags,
+		viability:       viability,
+		events:          events,
+		clock:           clk,
+		configManager:   configManager,
+		notifier:        notifier,
+		metrics:         appMetrics,
 	}
 }
 
 // SelectKey 为指定的分组原子性地选择并轮换一个可用的 APIKey。
-func (p *KeyProvider) SelectKey(groupID uint) (*models.APIKey, error) {
+// strategy 为 weighted-round-robin 时按 Key 的权重平滑加权轮询，否则依次轮询。
+func (p *KeyProvider) SelectKey(groupID uint, strategy string) (*models.APIKey, error) {
 	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
 
 	// 1. Atomically rotate the key ID from the list
-	keyIDStr, err := p.store.Rotate(activeKeysListKey)
+	var keyIDStr string
+	var err error
+	if strategy == models.KeySelectionWeightedRoundRobin {
+		keyIDStr, err = p.store.WeightedRotate(activeKeysListKey, fmt.Sprintf(keyWeightsIndexKey, groupID), fmt.Sprintf(weightedRotateStateKey, groupID))
+	} else {
+		keyIDStr, err = p.store.Rotate(activeKeysListKey)
+	}
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			return nil, app_errors.ErrNoActiveKeys
@@ -57,24 +108,89 @@ func (p *KeyProvider) SelectKey(groupID uint) (*models.APIKey, error) {
 	}
 
 	// 3. Manually unmarshal the map into an APIKey struct
-	failureCount, _ := strconv.ParseInt(keyDetails["failure_count"], 10, 64)
-	createdAt, _ := strconv.ParseInt(keyDetails["created_at"], 10, 64)
+	return apiKeyFromMap(uint(keyID), groupID, keyDetails), nil
+}
 
-	apiKey := &models.APIKey{
-		ID:           uint(keyID),
-		KeyValue:     keyDetails["key_string"],
-		Status:       keyDetails["status"],
-		FailureCount: failureCount,
-		GroupID:      groupID,
-		CreatedAt:    time.Unix(createdAt, 0),
+// SelectAffinityKey selects an active key of the group whose model affinity matches the
+// model, rotating among the matching keys. It returns nil when no such key is available,
+// in which case the caller falls back to SelectKey.
+func (p *KeyProvider) SelectAffinityKey(groupID uint, model string) (*models.APIKey, error) {
+	affinities, err := p.store.HGetAll(fmt.Sprintf(modelAffinityIndexKey, groupID))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get model affinity of group %d: %w", groupID, err)
+	}
+
+	var candidates []uint64
+	for field, value := range affinities {
+		if value == "" {
+			continue
+		}
+		var patterns []string
+		if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+			continue
+		}
+		if !MatchesModelAffinity(patterns, model) {
+			continue
+		}
+		if keyID, err := strconv.ParseUint(field, 10, 64); err == nil {
+			candidates = append(candidates, keyID)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	slices.Sort(candidates)
+
+	// 在匹配的 Key 之间轮询，跳过当前不可用的 Key
+	start := p.affinityCursor.Add(1)
+	for i := range candidates {
+		keyID := candidates[(start+uint64(i))%uint64(len(candidates))]
+		keyDetails, err := p.store.HGetAll(fmt.Sprintf("key:%d", keyID))
+		if err != nil || keyDetails["status"] != models.KeyStatusActive {
+			continue
+		}
+		return apiKeyFromMap(uint(keyID), groupID, keyDetails), nil
+	}
+	return nil, nil
+}
+
+// MatchesModelAffinity reports whether the model matches one of the affinity patterns, in
+// which * matches any sequence of characters.
+func MatchesModelAffinity(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, model) {
+			return true
+		}
 	}
+	return false
+}
 
-	return apiKey, nil
+func matchWildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return strings.HasSuffix(s, last)
 }
 
 // UpdateStatus 异步地提交一个 Key 状态更新任务。
 func (p *KeyProvider) UpdateStatus(apiKey *models.APIKey, group *models.Group, isSuccess bool, errorMessage string) {
-	go func() {
+	p.pool.GoNoWait(func() {
 		keyHashKey := fmt.Sprintf("key:%d", apiKey.ID)
 		activeKeysListKey := fmt.Sprintf("group:%d:active_keys", group.ID)
 
@@ -89,12 +205,29 @@ func (p *KeyProvider) UpdateStatus(apiKey *models.APIKey, group *models.Group, i
 					"error": errorMessage,
 				}).Debug("Uncounted error, skipping failure handling")
 			} else {
+				if app_errors.IsScopeMismatch(errorMessage) {
+					p.recordFailureReason(apiKey.ID, errorMessage)
+				}
 				if err := p.handleFailure(apiKey, group, keyHashKey, activeKeysListKey); err != nil {
 					logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to handle key failure")
 				}
 			}
 		}
-	}()
+	})
+}
+
+// maxFailureReasonLength 与 last_failure_reason 列长度一致
+const maxFailureReasonLength = 255
+
+// recordFailureReason 记录 Key 最近一次可定位原因的失败，例如组织或项目与 Key 不匹配，
+// 使管理端能看到具体原因而非笼统的认证失败。
+func (p *KeyProvider) recordFailureReason(keyID uint, reason string) {
+	reason = truncateReason(reason)
+	if err := p.db.Model(&models.APIKey{}).Where("id = ?", keyID).Update("last_failure_reason", reason).Error; err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "error": err}).Error("Failed to record key failure reason")
+		return
+	}
+	logrus.WithFields(logrus.Fields{"keyID": keyID, "reason": reason}).Warn("Key organization or project does not match the upstream account")
 }
 
 // executeTransactionWithRetry wraps a database transaction with a retry mechanism.
@@ -129,6 +262,15 @@ func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey st
 	if err != nil {
 		return fmt.Errorf("failed to get key details from store: %w", err)
 	}
+	// 请求期间密钥已被删除（例如所在分组被删除），不再更新其状态
+	if len(keyDetails) == 0 {
+		return nil
+	}
+
+	// 备用状态的热备密钥只由热备检查启用
+	if keyDetails["status"] == models.KeyStatusStandby {
+		return nil
+	}
 
 	failureCount, _ := strconv.ParseInt(keyDetails["failure_count"], 10, 64)
 	isActive := keyDetails["status"] == models.KeyStatusActive
@@ -137,7 +279,21 @@ func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey st
 		return nil
 	}
 
-	return p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+	// 错误预算耗尽而被禁用的密钥，在错误滑出窗口或预算被重置前不恢复；已过期的密钥不恢复
+	if !isActive {
+		if expiresAt, _ := strconv.ParseInt(keyDetails["expires_at"], 10, 64); expiresAt > 0 && p.clock.Now().Unix() >= expiresAt {
+			logrus.WithField("keyID", keyID).Debug("Key has expired, keeping it disabled.")
+			return nil
+		}
+		budgetPercent, _ := strconv.ParseFloat(keyDetails["error_budget_percent"], 64)
+		budgetWindowHours, _ := strconv.Atoi(keyDetails["error_budget_window_hours"])
+		if p.errorBudgetExhausted(keyID, budgetPercent, budgetWindowHours) {
+			logrus.WithField("keyID", keyID).Debug("Key is still over its error budget, keeping it disabled.")
+			return nil
+		}
+	}
+
+	err = p.executeTransactionWithRetry(func(tx *gorm.DB) error {
 		var key models.APIKey
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, keyID).Error; err != nil {
 			return fmt.Errorf("failed to lock key %d for update: %w", keyID, err)
@@ -168,6 +324,11 @@ func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey st
 
 		return nil
 	})
+	if err == nil && !isActive {
+		p.keyStateChanged(keyID, models.KeyStatusActive)
+		p.CheckPoolViability()
+	}
+	return err
 }
 
 func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group, keyHashKey, activeKeysListKey string) error {
@@ -175,8 +336,12 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 	if err != nil {
 		return fmt.Errorf("failed to get key details from store: %w", err)
 	}
+	if len(keyDetails) == 0 {
+		return nil
+	}
 
-	if keyDetails["status"] == models.KeyStatusInvalid {
+	// suspect 状态的密钥由确认探测决定最终状态
+	if keyDetails["status"] == models.KeyStatusInvalid || keyDetails["status"] == models.KeyStatusSuspect {
 		return nil
 	}
 
@@ -184,8 +349,15 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 
 	// 获取该分组的有效配置
 	blacklistThreshold := group.EffectiveConfig.BlacklistThreshold
+	// 关闭探测确认时，达到阈值的密钥直接禁用
+	probeEnabled := p.featureFlags.IsEnabled(config.FlagSuspectProbe, group.ID)
+	disabledStatus := models.KeyStatusInvalid
+	if probeEnabled {
+		disabledStatus = models.KeyStatusSuspect
+	}
+	shouldSuspect := false
 
-	return p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+	err = p.executeTransactionWithRetry(func(tx *gorm.DB) error {
 		var key models.APIKey
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, apiKey.ID).Error; err != nil {
 			return fmt.Errorf("failed to lock key %d for update: %w", apiKey.ID, err)
@@ -194,9 +366,9 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 		newFailureCount := failureCount + 1
 
 		updates := map[string]any{"failure_count": newFailureCount}
-		shouldBlacklist := blacklistThreshold > 0 && newFailureCount >= int64(blacklistThreshold)
-		if shouldBlacklist {
-			updates["status"] = models.KeyStatusInvalid
+		shouldSuspect = blacklistThreshold > 0 && newFailureCount >= int64(blacklistThreshold)
+		if shouldSuspect {
+			updates["status"] = disabledStatus
 		}
 
 		if err := tx.Model(&key).Updates(updates).Error; err != nil {
@@ -207,18 +379,120 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 			return fmt.Errorf("failed to increment failure count in store: %w", err)
 		}
 
-		if shouldBlacklist {
-			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "threshold": blacklistThreshold}).Warn("Key has reached blacklist threshold, disabling.")
+		if shouldSuspect {
+			if probeEnabled {
+				logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "threshold": blacklistThreshold}).Warn("Key has reached blacklist threshold, marking as suspect pending confirmation probe.")
+			} else {
+				logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "threshold": blacklistThreshold}).Warn("Key has reached blacklist threshold, disabling it.")
+			}
 			if err := p.store.LRem(activeKeysListKey, 0, apiKey.ID); err != nil {
 				return fmt.Errorf("failed to LRem key from active list: %w", err)
 			}
-			if err := p.store.HSet(keyHashKey, map[string]any{"status": models.KeyStatusInvalid}); err != nil {
-				return fmt.Errorf("failed to update key status to invalid in store: %w", err)
+			if err := p.store.HSet(keyHashKey, map[string]any{"status": disabledStatus}); err != nil {
+				return fmt.Errorf("failed to update key status to %s in store: %w", disabledStatus, err)
 			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if shouldSuspect {
+		p.keyStateChanged(apiKey.ID, disabledStatus)
+		p.CheckPoolViability()
+		p.recordKeysDisabled(group.ID, apiKey.Source, KeyDisableReasonBlacklist, 1)
+	}
+	if shouldSuspect && probeEnabled {
+		p.clock.AfterFunc(suspectProbeDelay, func() {
+			p.pool.Go(func() {
+				p.probeSuspectKey(apiKey, group, keyHashKey, activeKeysListKey)
+			})
+		})
+	}
+	return nil
+}
+
+// probeSuspectKey 对 suspect 状态的密钥执行一次确认探测。
+// 探测失败则最终禁用密钥；探测成功则恢复密钥、重置失败计数并记录一次误报。
+func (p *KeyProvider) probeSuspectKey(apiKey *models.APIKey, group *models.Group, keyHashKey, activeKeysListKey string) {
+	logger := logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "group": group.Name})
+
+	isValid, probeErr := p.runProbe(apiKey, group)
+
+	now := p.clock.Now()
+	dbUpdates := map[string]any{"last_probe_at": now}
+	storeUpdates := map[string]any{}
+	if isValid {
+		dbUpdates["status"] = models.KeyStatusActive
+		dbUpdates["failure_count"] = 0
+		dbUpdates["last_probe_result"] = models.ProbeResultPassed
+		dbUpdates["false_alarm_count"] = gorm.Expr("false_alarm_count + 1")
+		storeUpdates["status"] = models.KeyStatusActive
+		storeUpdates["failure_count"] = 0
+	} else {
+		dbUpdates["status"] = models.KeyStatusInvalid
+		dbUpdates["last_probe_result"] = models.ProbeResultFailed
+		storeUpdates["status"] = models.KeyStatusInvalid
+	}
+
+	var skipped bool
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		// 只处理仍处于 suspect 状态的密钥，期间被删除或手动恢复的密钥保持不变
+		result := tx.Model(&models.APIKey{}).Where("id = ? AND status = ?", apiKey.ID, models.KeyStatusSuspect).Updates(dbUpdates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update suspect key in DB: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			skipped = true
+			return nil
+		}
+
+		if err := p.store.HSet(keyHashKey, storeUpdates); err != nil {
+			return fmt.Errorf("failed to update suspect key in store: %w", err)
+		}
+
+		if isValid {
+			if err := p.store.LRem(activeKeysListKey, 0, apiKey.ID); err != nil {
+				return fmt.Errorf("failed to LRem key before LPush on false alarm: %w", err)
+			}
+			if err := p.store.LPush(activeKeysListKey, apiKey.ID); err != nil {
+				return fmt.Errorf("failed to LPush key back to active list: %w", err)
+			}
+		}
+		return nil
+	})
+
+	if err == nil && !skipped {
+		p.keyStateChanged(apiKey.ID, storeUpdates["status"].(string))
+		if isValid {
+			p.CheckPoolViability()
+		}
+	}
+
+	switch {
+	case err != nil:
+		logger.WithError(err).Error("Failed to apply confirmation probe result")
+	case skipped:
+		logger.Debug("Key is no longer suspect, discarding confirmation probe result.")
+	case isValid:
+		logger.Warn("Suspect key passed confirmation probe, restoring it to the active pool (false alarm).")
+	default:
+		logger.WithError(probeErr).Warn("Suspect key failed confirmation probe, disabling.")
+	}
+}
+
+// runProbe 通过分组的渠道（包括其代理和验证端点配置）发送一次验证请求。
+func (p *KeyProvider) runProbe(apiKey *models.APIKey, group *models.Group) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(group.EffectiveConfig.KeyValidationTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	ch, err := p.channelFactory.GetChannel(group)
+	if err != nil {
+		return false, fmt.Errorf("failed to get channel for group %s: %w", group.Name, err)
+	}
+	return ch.ValidateKey(ctx, apiKey, group)
 }
 
 // LoadKeysFromDB 从数据库加载所有分组和密钥，并填充到 Store 中。
@@ -239,6 +513,8 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 
 	// 1. 分批从数据库加载并使用 Pipeline 写入 Redis
 	allActiveKeyIDs := make(map[uint][]any)
+	allModelAffinities := make(map[uint]map[string]any)
+	allKeyWeights := make(map[uint]map[string]any)
 	batchSize := 1000
 	var batchKeys []*models.APIKey
 
@@ -265,6 +541,19 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 			if key.Status == models.KeyStatusActive {
 				allActiveKeyIDs[key.GroupID] = append(allActiveKeyIDs[key.GroupID], key.ID)
 			}
+			if len(key.ModelAffinity) > 0 {
+				if allModelAffinities[key.GroupID] == nil {
+					allModelAffinities[key.GroupID] = make(map[string]any)
+				}
+				allModelAffinities[key.GroupID][fmt.Sprint(key.ID)] = string(key.ModelAffinity)
+			}
+			if key.Weight != 1 {
+				if allKeyWeights[key.GroupID] == nil {
+					allKeyWeights[key.GroupID] = make(map[string]any)
+				}
+				allKeyWeights[key.GroupID][fmt.Sprint(key.ID)] = key.Weight
+			}
+			p.metrics.TrackKey(key.ID, keyCircuitValue(key.Status))
 		}
 
 		if pipeline != nil {
@@ -291,6 +580,18 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 		}
 	}
 
+	for groupID, affinities := range allModelAffinities {
+		if err := p.store.HSet(fmt.Sprintf(modelAffinityIndexKey, groupID), affinities); err != nil {
+			logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to HSet model affinity for group")
+		}
+	}
+
+	for groupID, weights := range allKeyWeights {
+		if err := p.store.HSet(fmt.Sprintf(keyWeightsIndexKey, groupID), weights); err != nil {
+			logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to HSet key weights for group")
+		}
+	}
+
 	if err := p.store.Set(initFlagKey, []byte("1"), 0); err != nil {
 		logrus.WithField("flagKey", initFlagKey).Error("Failed to set initialization flag after loading keys")
 	}
@@ -298,6 +599,12 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 	return nil
 }
 
+// CheckPoolViability 在密钥状态发生变化后按需启用或停用热备密钥，并重新检查密钥池是否低于最小可用数量。
+func (p *KeyProvider) CheckPoolViability() {
+	p.rebalanceStandbyKeys()
+	p.viability.Check()
+}
+
 // AddKeys 批量添加新的 Key 到池和数据库中。
 func (p *KeyProvider) AddKeys(groupID uint, keys []models.APIKey) error {
 	if len(keys) == 0 {
@@ -318,6 +625,10 @@ func (p *KeyProvider) AddKeys(groupID uint, keys []models.APIKey) error {
 		return nil
 	})
 
+	if err == nil {
+		p.CheckPoolViability()
+	}
+
 	return err
 }
 
@@ -331,7 +642,7 @@ func (p *KeyProvider) RemoveKeys(groupID uint, keyValues []string) (int64, error
 	var deletedCount int64
 
 	err := p.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("group_id = ? AND key_value IN ?", groupID, keyValues).Find(&keysToDelete).Error; err != nil {
+		if err := tx.Where("group_id = ? AND key_value IN ?", groupID, models.KeyValueLookups(keyValues)).Find(&keysToDelete).Error; err != nil {
 			return err
 		}
 
@@ -357,9 +668,104 @@ func (p *KeyProvider) RemoveKeys(groupID uint, keyValues []string) (int64, error
 		return nil
 	})
 
+	if err == nil {
+		p.CheckPoolViability()
+	}
+
 	return deletedCount, err
 }
 
+// UpdateQuotaPrecheck 更新 Key 的余额预检查配置。
+func (p *KeyProvider) UpdateQuotaPrecheck(keyID uint, endpoint string, minBalance float64) error {
+	updates := map[string]any{
+		"quota_precheck_endpoint":    endpoint,
+		"quota_precheck_min_balance": minBalance,
+	}
+
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id = ?", keyID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update quota precheck for key %d: %w", keyID, err)
+		}
+		if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), updates); err != nil {
+			return fmt.Errorf("failed to update quota precheck in store: %w", err)
+		}
+		return p.store.Delete(fmt.Sprintf(quotaBalanceCacheKey, keyID))
+	})
+	if err == nil {
+		p.events.Publish(KeyEventUpdated, keyID, 0, "")
+	}
+	return err
+}
+
+// UpdateKeyScope 更新 Key 的 OpenAI 组织与项目。
+func (p *KeyProvider) UpdateKeyScope(keyIDs []uint, scope models.KeyScope) error {
+	if len(keyIDs) == 0 {
+		return nil
+	}
+	updates := map[string]any{
+		"org_id":     scope.OrgID,
+		"project_id": scope.ProjectID,
+	}
+
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		// 修改组织或项目后，之前记录的不匹配原因不再适用
+		dbUpdates := map[string]any{"last_failure_reason": ""}
+		for field, value := range updates {
+			dbUpdates[field] = value
+		}
+		if err := tx.Model(&models.APIKey{}).Where("id IN ?", keyIDs).Updates(dbUpdates).Error; err != nil {
+			return fmt.Errorf("failed to update key scope: %w", err)
+		}
+		for _, keyID := range keyIDs {
+			if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), updates); err != nil {
+				return fmt.Errorf("failed to update key scope in store: %w", err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, keyID := range keyIDs {
+			p.events.Publish(KeyEventUpdated, keyID, 0, "")
+		}
+	}
+	return err
+}
+
+// UpdateModelAffinity 更新 Key 的模型亲和模式，空列表表示清除。
+func (p *KeyProvider) UpdateModelAffinity(groupID uint, keyIDs []uint, patterns []string) error {
+	if len(keyIDs) == 0 {
+		return nil
+	}
+	var affinity datatypes.JSON
+	if len(patterns) > 0 {
+		encoded, err := json.Marshal(patterns)
+		if err != nil {
+			return fmt.Errorf("failed to encode model affinity: %w", err)
+		}
+		affinity = encoded
+	}
+
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).Where("id IN ?", keyIDs).Update("model_affinity", affinity).Error; err != nil {
+			return fmt.Errorf("failed to update model affinity: %w", err)
+		}
+		index := make(map[string]any, len(keyIDs))
+		for _, keyID := range keyIDs {
+			if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), map[string]any{"model_affinity": string(affinity)}); err != nil {
+				return fmt.Errorf("failed to update model affinity in store: %w", err)
+			}
+			index[fmt.Sprint(keyID)] = string(affinity)
+		}
+		return p.store.HSet(fmt.Sprintf(modelAffinityIndexKey, groupID), index)
+	})
+	if err == nil {
+		for _, keyID := range keyIDs {
+			p.events.Publish(KeyEventUpdated, keyID, groupID, "")
+		}
+	}
+	return err
+}
+
 // RestoreKeys 恢复组内所有无效的 Key。
 func (p *KeyProvider) RestoreKeys(groupID uint) (int64, error) {
 	var invalidKeys []models.APIKey
@@ -375,8 +781,9 @@ func (p *KeyProvider) RestoreKeys(groupID uint) (int64, error) {
 		}
 
 		updates := map[string]any{
-			"status":        models.KeyStatusActive,
-			"failure_count": 0,
+			"status":          models.KeyStatusActive,
+			"failure_count":   0,
+			"sync_removed_at": nil,
 		}
 		result := tx.Model(&models.APIKey{}).Where("group_id = ? AND status = ?", groupID, models.KeyStatusInvalid).Updates(updates)
 		if result.Error != nil {
@@ -395,6 +802,10 @@ func (p *KeyProvider) RestoreKeys(groupID uint) (int64, error) {
 		return nil
 	})
 
+	if err == nil {
+		p.CheckPoolViability()
+	}
+
 	return restoredCount, err
 }
 
@@ -409,7 +820,7 @@ func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int
 
 	err := p.db.Transaction(func(tx *gorm.DB) error {
 		// 1. 查找要恢复的密钥
-		if err := tx.Where("group_id = ? AND key_value IN ? AND status = ?", groupID, keyValues, models.KeyStatusInvalid).Find(&keysToRestore).Error; err != nil {
+		if err := tx.Where("group_id = ? AND key_value IN ? AND status = ?", groupID, models.KeyValueLookups(keyValues), models.KeyStatusInvalid).Find(&keysToRestore).Error; err != nil {
 			return err
 		}
 
@@ -421,8 +832,9 @@ func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int
 
 		// 2. 更新数据库中的状态
 		updates := map[string]any{
-			"status":        models.KeyStatusActive,
-			"failure_count": 0,
+			"status":          models.KeyStatusActive,
+			"failure_count":   0,
+			"sync_removed_at": nil,
 		}
 		result := tx.Model(&models.APIKey{}).Where("id IN ?", keyIDsToRestore).Updates(updates)
 		if result.Error != nil {
@@ -444,9 +856,71 @@ func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int
 		return nil
 	})
 
+	if err == nil {
+		p.CheckPoolViability()
+	}
+
 	return restoredCount, err
 }
 
+// DisableKeys 将指定的 Key 标记为被密钥同步移除，并将其设为无效状态。
+func (p *KeyProvider) DisableKeys(groupID uint, keyValues []string) (int64, error) {
+	if len(keyValues) == 0 {
+		return 0, nil
+	}
+
+	var keysToDisable []models.APIKey
+	var disabledCount int64
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND key_value IN ?", groupID, models.KeyValueLookups(keyValues)).Find(&keysToDisable).Error; err != nil {
+			return err
+		}
+
+		if len(keysToDisable) == 0 {
+			return nil
+		}
+
+		updates := map[string]any{
+			"status":          models.KeyStatusInvalid,
+			"sync_removed_at": p.clock.Now(),
+		}
+		result := tx.Model(&models.APIKey{}).Where("id IN ?", pluckIDs(keysToDisable)).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		disabledCount = result.RowsAffected
+
+		for _, key := range keysToDisable {
+			key.Status = models.KeyStatusInvalid
+			if err := p.store.LRem(fmt.Sprintf("group:%d:active_keys", groupID), 0, key.ID); err != nil {
+				return fmt.Errorf("failed to LRem key %d from active list: %w", key.ID, err)
+			}
+			if err := p.addKeyToStore(&key); err != nil {
+				logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Error("Failed to disable key in store after DB update")
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err == nil {
+		p.CheckPoolViability()
+
+		disabledBySource := make(map[string]int64)
+		for _, key := range keysToDisable {
+			if key.Status != models.KeyStatusInvalid {
+				disabledBySource[key.Source]++
+			}
+		}
+		for source, count := range disabledBySource {
+			p.recordKeysDisabled(groupID, source, KeyDisableReasonSyncRemoved, count)
+		}
+	}
+
+	return disabledCount, err
+}
+
 // RemoveInvalidKeys 移除组内所有无效的 Key。
 func (p *KeyProvider) RemoveInvalidKeys(groupID uint) (int64, error) {
 	return p.removeKeysByStatus(groupID, models.KeyStatusInvalid)
@@ -496,6 +970,10 @@ func (p *KeyProvider) removeKeysByStatus(groupID uint, status ...string) (int64,
 		return nil
 	})
 
+	if err == nil {
+		p.CheckPoolViability()
+	}
+
 	return removedCount, err
 }
 
@@ -517,6 +995,15 @@ func (p *KeyProvider) RemoveKeysFromStore(groupID uint, keyIDs []uint) error {
 		return err
 	}
 
+	if err := p.store.Delete(fmt.Sprintf(modelAffinityIndexKey, groupID)); err != nil {
+		logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to delete model affinity of group")
+	}
+	for _, indexKey := range []string{keyWeightsIndexKey, weightedRotateStateKey} {
+		if err := p.store.Delete(fmt.Sprintf(indexKey, groupID)); err != nil {
+			logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to delete key weights of group")
+		}
+	}
+
 	// 第二步：批量删除所有相关的key hash
 	for _, keyID := range keyIDs {
 		keyHashKey := fmt.Sprintf("key:%d", keyID)
@@ -526,6 +1013,11 @@ func (p *KeyProvider) RemoveKeysFromStore(groupID uint, keyIDs []uint) error {
 				"error": err,
 			}).Error("Failed to delete key hash")
 		}
+		if err := p.ResetErrorBudget(keyID); err != nil {
+			logrus.WithFields(logrus.Fields{"keyID": keyID, "error": err}).Warn("Failed to clear key error budget")
+		}
+		p.metrics.UntrackKey(keyID)
+		p.events.Publish(KeyEventRemoved, keyID, groupID, "")
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -545,6 +1037,18 @@ func (p *KeyProvider) addKeyToStore(key *models.APIKey) error {
 		return fmt.Errorf("failed to HSet key details for key %d: %w", key.ID, err)
 	}
 
+	if len(key.ModelAffinity) > 0 {
+		if err := p.store.HSet(fmt.Sprintf(modelAffinityIndexKey, key.GroupID), map[string]any{fmt.Sprint(key.ID): string(key.ModelAffinity)}); err != nil {
+			return fmt.Errorf("failed to HSet model affinity of key %d: %w", key.ID, err)
+		}
+	}
+	if err := p.store.HSet(fmt.Sprintf(keyWeightsIndexKey, key.GroupID), map[string]any{fmt.Sprint(key.ID): key.Weight}); err != nil {
+		return fmt.Errorf("failed to HSet weight of key %d: %w", key.ID, err)
+	}
+
+	p.metrics.TrackKey(key.ID, keyCircuitValue(key.Status))
+	p.events.Publish(KeyEventAdded, key.ID, key.GroupID, key.Status)
+
 	// 2. If active, add to the active LIST
 	if key.Status == models.KeyStatusActive {
 		activeKeysListKey := fmt.Sprintf("group:%d:active_keys", key.GroupID)
@@ -564,14 +1068,69 @@ func (p *KeyProvider) removeKeyFromStore(keyID, groupID uint) error {
 	if err := p.store.LRem(activeKeysListKey, 0, keyID); err != nil {
 		logrus.WithFields(logrus.Fields{"keyID": keyID, "groupID": groupID, "error": err}).Error("Failed to LRem key from active list")
 	}
+	if err := p.store.HSet(fmt.Sprintf(modelAffinityIndexKey, groupID), map[string]any{fmt.Sprint(keyID): ""}); err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "groupID": groupID, "error": err}).Error("Failed to clear key model affinity")
+	}
+	if err := p.store.HSet(fmt.Sprintf(keyWeightsIndexKey, groupID), map[string]any{fmt.Sprint(keyID): ""}); err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "groupID": groupID, "error": err}).Error("Failed to clear key weight")
+	}
 
 	keyHashKey := fmt.Sprintf("key:%d", keyID)
 	if err := p.store.Delete(keyHashKey); err != nil {
 		return fmt.Errorf("failed to delete key HASH for key %d: %w", keyID, err)
 	}
+	if err := p.ResetErrorBudget(keyID); err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "error": err}).Warn("Failed to clear key error budget")
+	}
+	p.metrics.UntrackKey(keyID)
+	p.events.Publish(KeyEventRemoved, keyID, groupID, "")
 	return nil
 }
 
+// keyStateChanged records a status change of a key in the pool.
+func (p *KeyProvider) keyStateChanged(keyID uint, status string) {
+	p.metrics.TrackKey(keyID, keyCircuitValue(status))
+	p.events.Publish(KeyEventStateChanged, keyID, 0, status)
+}
+
+// apiKeyFromMap converts the HASH fields of a key back to an APIKey model.
+func apiKeyFromMap(keyID, groupID uint, keyDetails map[string]string) *models.APIKey {
+	failureCount, _ := strconv.ParseInt(keyDetails["failure_count"], 10, 64)
+	createdAt, _ := strconv.ParseInt(keyDetails["created_at"], 10, 64)
+	quotaMinBalance, _ := strconv.ParseFloat(keyDetails["quota_precheck_min_balance"], 64)
+	errorBudgetPercent, _ := strconv.ParseFloat(keyDetails["error_budget_percent"], 64)
+	errorBudgetWindowHours, _ := strconv.Atoi(keyDetails["error_budget_window_hours"])
+	weight, err := strconv.Atoi(keyDetails["weight"])
+	if err != nil {
+		weight = 1
+	}
+
+	apiKey := &models.APIKey{
+		ID:                      keyID,
+		KeyValue:                keyDetails["key_string"],
+		Status:                  keyDetails["status"],
+		FailureCount:            failureCount,
+		GroupID:                 groupID,
+		CreatedAt:               time.Unix(createdAt, 0),
+		QuotaPrecheckEndpoint:   keyDetails["quota_precheck_endpoint"],
+		QuotaPrecheckMinBalance: quotaMinBalance,
+		OrgID:                   keyDetails["org_id"],
+		ProjectID:               keyDetails["project_id"],
+		ErrorBudgetPercent:      errorBudgetPercent,
+		ErrorBudgetWindowHours:  errorBudgetWindowHours,
+		Source:                  keyDetails["source"],
+		Weight:                  weight,
+	}
+	if affinity := keyDetails["model_affinity"]; affinity != "" {
+		apiKey.ModelAffinity = datatypes.JSON(affinity)
+	}
+	if expiresAt, _ := strconv.ParseInt(keyDetails["expires_at"], 10, 64); expiresAt > 0 {
+		t := time.Unix(expiresAt, 0)
+		apiKey.ExpiresAt = &t
+	}
+	return apiKey
+}
+
 // apiKeyToMap converts an APIKey model to a map for HSET.
 func (p *KeyProvider) apiKeyToMap(key *models.APIKey) map[string]any {
 	return map[string]any{
@@ -581,6 +1140,23 @@ func (p *KeyProvider) apiKeyToMap(key *models.APIKey) map[string]any {
 		"failure_count": key.FailureCount,
 		"group_id":      key.GroupID,
 		"created_at":    key.CreatedAt.Unix(),
+
+		"quota_precheck_endpoint":    key.QuotaPrecheckEndpoint,
+		"quota_precheck_min_balance": key.QuotaPrecheckMinBalance,
+
+		"org_id":     key.OrgID,
+		"project_id": key.ProjectID,
+
+		"error_budget_percent":      key.ErrorBudgetPercent,
+		"error_budget_window_hours": key.ErrorBudgetWindowHours,
+
+		"source": key.Source,
+
+		"model_affinity": string(key.ModelAffinity),
+
+		"expires_at": expiryField(key.ExpiresAt),
+
+		"weight": key.Weight,
 	}
 }
 
@@ -0,0 +1,176 @@
+package keypool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/channel"
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	quotaBalanceCacheKey = "quota_balance:%d"
+	quotaCheckTimeout    = 10 * time.Second
+)
+
+// balanceFields are the response fields checked, in order, for a numeric balance.
+var balanceFields = []string{"balance", "total_balance", "remaining", "remaining_credits", "available_balance", "credits"}
+
+// QuotaChecker checks a key's upstream balance before it is used for a request.
+type QuotaChecker struct {
+	store         store.Store
+	configManager types.ConfigManager
+	featureFlags  *config.FeatureFlagManager
+}
+
+// NewQuotaChecker creates a new QuotaChecker.
+func NewQuotaChecker(store store.Store, configManager types.ConfigManager, featureFlags *config.FeatureFlagManager) *QuotaChecker {
+	return &QuotaChecker{
+		store:         store,
+		configManager: configManager,
+		featureFlags:  featureFlags,
+	}
+}
+
+// HasSufficientBalance reports whether the key can be used. Keys without a precheck endpoint,
+// and keys whose balance cannot be determined, are always considered usable.
+func (q *QuotaChecker) HasSufficientBalance(ch channel.ChannelProxy, apiKey *models.APIKey, group *models.Group) bool {
+	proxyConfig := q.configManager.GetProxyConfig()
+	if !proxyConfig.QuotaPrecheckEnabled || apiKey.QuotaPrecheckEndpoint == "" || !q.featureFlags.IsEnabled(config.FlagQuotaPrecheck, group.ID) {
+		return true
+	}
+
+	balance, err := q.getBalance(ch, apiKey, group, time.Duration(proxyConfig.QuotaPrecheckCacheTTL)*time.Second)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"keyID": apiKey.ID,
+			"error": err,
+		}).Debug("Quota pre-check failed, using key without balance check")
+		return true
+	}
+
+	if balance < apiKey.QuotaPrecheckMinBalance {
+		logrus.WithFields(logrus.Fields{
+			"keyID":      apiKey.ID,
+			"key":        utils.MaskAPIKey(apiKey.KeyValue),
+			"group":      group.Name,
+			"balance":    balance,
+			"minBalance": apiKey.QuotaPrecheckMinBalance,
+		}).Warn("Skipping key due to insufficient upstream balance")
+		return false
+	}
+	return true
+}
+
+// getBalance returns the cached balance of a key, querying the precheck endpoint on a cache miss.
+func (q *QuotaChecker) getBalance(ch channel.ChannelProxy, apiKey *models.APIKey, group *models.Group, ttl time.Duration) (float64, error) {
+	cacheKey := fmt.Sprintf(quotaBalanceCacheKey, apiKey.ID)
+	if cached, err := q.store.Get(cacheKey); err == nil {
+		if balance, err := strconv.ParseFloat(string(cached), 64); err == nil {
+			return balance, nil
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return 0, fmt.Errorf("failed to read cached balance: %w", err)
+	}
+
+	balance, err := q.fetchBalance(ch, apiKey, group)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := q.store.Set(cacheKey, []byte(strconv.FormatFloat(balance, 'f', -1, 64)), ttl); err != nil {
+		logrus.WithField("keyID", apiKey.ID).Warnf("Failed to cache key balance: %v", err)
+	}
+	return balance, nil
+}
+
+// fetchBalance queries the key's precheck endpoint through the group's channel client.
+func (q *QuotaChecker) fetchBalance(ch channel.ChannelProxy, apiKey *models.APIKey, group *models.Group) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), quotaCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiKey.QuotaPrecheckEndpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create quota request: %w", err)
+	}
+	ch.ModifyRequest(req, apiKey, group)
+
+	resp, err := ch.GetHTTPClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query balance: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("balance endpoint returned status %d", resp.StatusCode)
+	}
+
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0, fmt.Errorf("failed to parse balance response: %w", err)
+	}
+
+	balance, ok := extractBalance(payload)
+	if !ok {
+		return 0, fmt.Errorf("no balance field found in response")
+	}
+	return balance, nil
+}
+
+// extractBalance searches a decoded JSON response for a balance value.
+// It understands total_credits/total_usage pairs as well as common balance field names.
+func extractBalance(payload any) (float64, bool) {
+	switch v := payload.(type) {
+	case map[string]any:
+		credits, hasCredits := toFloat(v["total_credits"])
+		usage, hasUsage := toFloat(v["total_usage"])
+		if hasCredits && hasUsage {
+			return credits - usage, true
+		}
+		for _, field := range balanceFields {
+			if balance, ok := toFloat(v[field]); ok {
+				return balance, true
+			}
+		}
+		for _, child := range v {
+			if balance, ok := extractBalance(child); ok {
+				return balance, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if balance, ok := extractBalance(child); ok {
+				return balance, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// toFloat converts a JSON number or numeric string to float64.
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,214 @@
+package keypool
+
+import (
+	"fmt"
+
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// standbyGroupCounts 是分组内与热备相关的密钥数量
+type standbyGroupCounts struct {
+	regular  int // 可用的非热备密钥
+	promoted int // 已启用的热备密钥
+	standby  int // 处于备用状态的热备密钥
+}
+
+// UpdateStandbyOnly 标记或取消密钥的热备属性。标记后可用的密钥转为 standby 状态，取消后 standby 状态的密钥恢复为可用，
+// 随后重新检查分组是否需要启用热备密钥。
+func (p *KeyProvider) UpdateStandbyOnly(groupID, keyID uint, standbyOnly bool) (string, error) {
+	var status string
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		var key models.APIKey
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, keyID).Error; err != nil {
+			return fmt.Errorf("failed to lock key %d for update: %w", keyID, err)
+		}
+
+		status = key.Status
+		switch {
+		case standbyOnly && key.Status == models.KeyStatusActive:
+			status = models.KeyStatusStandby
+		case !standbyOnly && key.Status == models.KeyStatusStandby:
+			status = models.KeyStatusActive
+		}
+
+		updates := map[string]any{"standby_only": standbyOnly, "status": status}
+		if err := tx.Model(&key).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update standby flag for key %d: %w", keyID, err)
+		}
+		if status != key.Status {
+			return p.setKeyPoolStatus(keyID, groupID, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	p.events.Publish(KeyEventUpdated, keyID, groupID, status)
+	p.CheckPoolViability()
+
+	// 重新检查后密钥可能已被启用或回到备用状态
+	var key models.APIKey
+	if err := p.db.Select("status").First(&key, keyID).Error; err == nil {
+		status = key.Status
+	}
+	return status, nil
+}
+
+// rebalanceStandbyKeys 检查有热备密钥的分组：可用密钥少于激活阈值时启用热备密钥补足，
+// 非热备的可用密钥达到停用阈值（或功能关闭）时将已启用的热备密钥放回备用状态。两个阈值之间保持不变。
+func (p *KeyProvider) rebalanceStandbyKeys() {
+	p.standbyMu.Lock()
+	defer p.standbyMu.Unlock()
+
+	cfg := p.configManager.GetKeyPoolConfig()
+	activation := cfg.StandbyActivationThreshold
+	deactivation := cfg.EffectiveStandbyDeactivationThreshold()
+
+	counts, err := p.standbyCounts()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to count standby keys")
+		return
+	}
+
+	var promotedTotal int
+	for groupID, c := range counts {
+		switch {
+		case activation <= 0 || c.regular >= deactivation:
+			if c.promoted > 0 {
+				demoted, err := p.demoteStandbyKeys(groupID)
+				if err != nil {
+					logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to return standby keys to standby")
+				} else if demoted > 0 {
+					logrus.WithFields(logrus.Fields{"groupID": groupID, "keys": demoted, "active_keys": c.regular, "threshold": deactivation}).
+						Warn("Group has recovered enough healthy keys, returning promoted standby keys to standby.")
+				}
+				c.promoted -= demoted
+			}
+		case c.regular+c.promoted < activation && c.standby > 0:
+			promoted, err := p.promoteStandbyKeys(groupID, activation-c.regular-c.promoted)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to activate standby keys")
+			} else if promoted > 0 {
+				logrus.WithFields(logrus.Fields{"groupID": groupID, "keys": promoted, "active_keys": c.regular + c.promoted, "threshold": activation}).
+					Warn("Group is below the standby activation threshold, activating standby keys.")
+			}
+			c.promoted += promoted
+		}
+		promotedTotal += c.promoted
+	}
+	p.metrics.StandbyKeysActive.Set(float64(promotedTotal))
+}
+
+// standbyCounts 统计含有热备密钥的分组中各类密钥的数量
+func (p *KeyProvider) standbyCounts() (map[uint]*standbyGroupCounts, error) {
+	var rows []struct {
+		GroupID     uint
+		Status      string
+		StandbyOnly bool
+		Count       int
+	}
+	groupsWithStandby := p.db.Model(&models.APIKey{}).Select("group_id").Where("standby_only = ?", true)
+	err := p.db.Model(&models.APIKey{}).
+		Select("group_id, status, standby_only, COUNT(*) as count").
+		Where("group_id IN (?)", groupsWithStandby).
+		Where("status IN ?", []string{models.KeyStatusActive, models.KeyStatusStandby}).
+		Group("group_id, status, standby_only").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]*standbyGroupCounts)
+	for _, row := range rows {
+		c := counts[row.GroupID]
+		if c == nil {
+			c = &standbyGroupCounts{}
+			counts[row.GroupID] = c
+		}
+		switch {
+		case row.Status == models.KeyStatusStandby:
+			c.standby += row.Count
+		case row.StandbyOnly:
+			c.promoted += row.Count
+		default:
+			c.regular += row.Count
+		}
+	}
+	return counts, nil
+}
+
+// promoteStandbyKeys 按 ID 顺序启用分组中最多 limit 个热备密钥
+func (p *KeyProvider) promoteStandbyKeys(groupID uint, limit int) (int, error) {
+	var keys []models.APIKey
+	if err := p.db.Where("group_id = ? AND status = ?", groupID, models.KeyStatusStandby).Order("id").Limit(limit).Find(&keys).Error; err != nil {
+		return 0, err
+	}
+	return p.changeStandbyStatus(groupID, pluckIDs(keys), models.KeyStatusStandby, models.KeyStatusActive)
+}
+
+// demoteStandbyKeys 将分组中所有已启用的热备密钥放回备用状态
+func (p *KeyProvider) demoteStandbyKeys(groupID uint) (int, error) {
+	var keys []models.APIKey
+	if err := p.db.Where("group_id = ? AND status = ? AND standby_only = ?", groupID, models.KeyStatusActive, true).Find(&keys).Error; err != nil {
+		return 0, err
+	}
+	return p.changeStandbyStatus(groupID, pluckIDs(keys), models.KeyStatusActive, models.KeyStatusStandby)
+}
+
+// changeStandbyStatus 将仍处于 from 状态的热备密钥改为 to 状态，并同步密钥池
+func (p *KeyProvider) changeStandbyStatus(groupID uint, keyIDs []uint, from, to string) (int, error) {
+	if len(keyIDs) == 0 {
+		return 0, nil
+	}
+
+	var changedIDs []uint
+	err := p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+		// 只修改仍处于 from 状态的密钥，期间状态已改变（例如被禁用）的密钥保持不变
+		var keys []models.APIKey
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id IN ? AND status = ? AND standby_only = ?", keyIDs, from, true).Find(&keys).Error; err != nil {
+			return fmt.Errorf("failed to lock standby keys for update: %w", err)
+		}
+		changedIDs = pluckIDs(keys)
+		if len(changedIDs) == 0 {
+			return nil
+		}
+		if err := tx.Model(&models.APIKey{}).Where("id IN ?", changedIDs).Update("status", to).Error; err != nil {
+			return fmt.Errorf("failed to update standby key status: %w", err)
+		}
+		for _, keyID := range changedIDs {
+			if err := p.setKeyPoolStatus(keyID, groupID, to); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, keyID := range changedIDs {
+		p.keyStateChanged(keyID, to)
+	}
+	return len(changedIDs), nil
+}
+
+// setKeyPoolStatus 更新缓存中密钥的状态，并相应地加入或移出分组的可用列表
+func (p *KeyProvider) setKeyPoolStatus(keyID, groupID uint, status string) error {
+	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
+	if err := p.store.HSet(fmt.Sprintf("key:%d", keyID), map[string]any{"status": status}); err != nil {
+		return fmt.Errorf("failed to update status of key %d in store: %w", keyID, err)
+	}
+	if err := p.store.LRem(activeKeysListKey, 0, keyID); err != nil {
+		return fmt.Errorf("failed to LRem key %d from active list: %w", keyID, err)
+	}
+	if status == models.KeyStatusActive {
+		if err := p.store.LPush(activeKeysListKey, keyID); err != nil {
+			return fmt.Errorf("failed to LPush key %d to active list: %w", keyID, err)
+		}
+	}
+	return nil
+}
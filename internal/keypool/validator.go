@@ -66,6 +66,7 @@ func (s *KeyValidator) ValidateSingleKey(key *models.APIKey, group *models.Group
 		errorMsg = validationErr.Error()
 	}
 	s.keypoolProvider.UpdateStatus(key, group, isValid, errorMsg)
+	s.keypoolProvider.RecordValidationResult(key.ID, errorMsg)
 
 	if !isValid {
 		logrus.WithFields(logrus.Fields{
@@ -84,13 +85,22 @@ func (s *KeyValidator) ValidateSingleKey(key *models.APIKey, group *models.Group
 	return true, nil
 }
 
+// DescribeProbe returns the validation request that would be sent for a key in the group.
+func (s *KeyValidator) DescribeProbe(group *models.Group, keyValue string) (*channel.ProbeRequest, error) {
+	ch, err := s.channelFactory.GetChannel(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel for group %s: %w", group.Name, err)
+	}
+	return ch.DescribeValidationProbe(&models.APIKey{KeyValue: keyValue, GroupID: group.ID}, group)
+}
+
 // TestMultipleKeys performs a synchronous validation for a list of key values within a specific group.
 func (s *KeyValidator) TestMultipleKeys(group *models.Group, keyValues []string) ([]KeyTestResult, error) {
 	results := make([]KeyTestResult, len(keyValues))
 
 	// Find which of the provided keys actually exist in the database for this group
 	var existingKeys []models.APIKey
-	if err := s.DB.Where("group_id = ? AND key_value IN ?", group.ID, keyValues).Find(&existingKeys).Error; err != nil {
+	if err := s.DB.Where("group_id = ? AND key_value IN ?", group.ID, models.KeyValueLookups(keyValues)).Find(&existingKeys).Error; err != nil {
 		return nil, fmt.Errorf("failed to query keys from DB: %w", err)
 	}
 	existingKeyMap := make(map[string]models.APIKey)
@@ -0,0 +1,98 @@
+package keypool
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/notify"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PoolViabilityEvent is the webhook payload sent when degraded mode is entered or exited.
+type PoolViabilityEvent struct {
+	Event         string    `json:"event"`
+	HealthyKeys   int64     `json:"healthy_keys"`
+	MinViableSize int       `json:"min_viable_size"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// PoolViabilityChecker 在密钥状态变化后统计可用（active）密钥总数，
+// 低于 MIN_VIABLE_POOL_SIZE 时进入降级模式，代理拒绝新的请求。
+type PoolViabilityChecker struct {
+	db            *gorm.DB
+	configManager types.ConfigManager
+	notifier      *notify.Notifier
+	degraded      atomic.Bool
+	mu            sync.Mutex
+}
+
+// NewPoolViabilityChecker creates a new PoolViabilityChecker.
+func NewPoolViabilityChecker(db *gorm.DB, configManager types.ConfigManager, notifier *notify.Notifier, appMetrics *metrics.Metrics) *PoolViabilityChecker {
+	c := &PoolViabilityChecker{
+		db:            db,
+		configManager: configManager,
+		notifier:      notifier,
+	}
+	appMetrics.RegisterPoolDegradedGauge(c.IsDegraded)
+	return c
+}
+
+// IsDegraded reports whether the key pool is below its minimum viable size.
+func (c *PoolViabilityChecker) IsDegraded() bool {
+	return c.degraded.Load()
+}
+
+// Check recounts the healthy keys and enters or exits degraded mode accordingly.
+func (c *PoolViabilityChecker) Check() {
+	minSize := c.configManager.GetKeyPoolConfig().MinViableSize
+	if minSize <= 0 {
+		c.degraded.Store(false)
+		return
+	}
+
+	// 串行化检查，保证进入/退出降级模式的事件按顺序只发送一次
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var healthyKeys int64
+	if err := c.db.Model(&models.APIKey{}).Where("status = ?", models.KeyStatusActive).Count(&healthyKeys).Error; err != nil {
+		logrus.WithError(err).Error("PoolViabilityChecker: failed to count healthy keys")
+		return
+	}
+
+	degraded := healthyKeys < int64(minSize)
+	if degraded == c.degraded.Load() {
+		return
+	}
+	c.degraded.Store(degraded)
+
+	event := PoolViabilityEvent{
+		HealthyKeys:   healthyKeys,
+		MinViableSize: minSize,
+		Timestamp:     time.Now(),
+	}
+	notification := notify.Event{Timestamp: event.Timestamp}
+	if degraded {
+		event.Event = "pool_degraded"
+		logrus.WithFields(logrus.Fields{"healthy_keys": healthyKeys, "min_viable_size": minSize}).
+			Error("Key pool is below its minimum viable size, entering degraded mode. New proxy requests will be rejected with 503.")
+		notification.Severity = notify.SeverityCritical
+		notification.Summary = fmt.Sprintf(":rotating_light: Key pool degraded: %d healthy keys, below the minimum of %d. New proxy requests are rejected with 503.", healthyKeys, minSize)
+	} else {
+		event.Event = "pool_recovered"
+		logrus.WithFields(logrus.Fields{"healthy_keys": healthyKeys, "min_viable_size": minSize}).
+			Info("Key pool has recovered, exiting degraded mode.")
+		notification.Severity = notify.SeverityInfo
+		notification.Summary = fmt.Sprintf("Key pool recovered: %d healthy keys (minimum %d).", healthyKeys, minSize)
+	}
+	notification.Type = event.Event
+	notification.Payload = event
+	c.notifier.Notify(notify.ChannelPoolDegraded, notification)
+}
@@ -0,0 +1,289 @@
+// Package metrics builds the Prometheus collectors of the application. The collectors are created
+// by NewMetrics and registered with the registerer the container injects, so tests can give each
+// instance its own registry.
+package metrics
+
+import (
+	goruntime "runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// keyMetricsGracePeriod 密钥移除后保留其指标的时长，便于最后一次抓取仍能看到最终值
+const keyMetricsGracePeriod = 5 * time.Minute
+
+// Metrics holds the collectors of the application other than the per-request proxy traffic
+// collectors of middleware.ProxyMetrics.
+type Metrics struct {
+	registerer prometheus.Registerer
+
+	// LoadShed counts requests rejected by load shedding before the concurrency limit is reached.
+	LoadShed prometheus.Counter
+	// 并发信号量的占用与容量，用于观察距离 MAX_CONCURRENT_REQUESTS 的余量
+	InFlightRequests      prometheus.Gauge
+	MaxConcurrentRequests prometheus.Gauge
+	ReservedSlotsInUse    prometheus.Gauge
+	ReservedProbeRequests prometheus.Counter
+
+	// 分组的上游连接错误率 = connection_errors_total / upstream_requests_total，用于调整空闲连接超时
+	GroupUpstreamRequests *prometheus.CounterVec
+	GroupConnectionErrors *prometheus.CounterVec
+	// UpstreamResponses 按上游统计每次尝试的响应状态码，用于计算各上游的错误率
+	UpstreamResponses *prometheus.CounterVec
+	ResponseBodyBytes *prometheus.HistogramVec
+	// UpstreamRawMode exposes which upstreams currently have raw mode forced.
+	UpstreamRawMode *prometheus.GaugeVec
+	// UpstreamHostUp exposes the probed state of each upstream host.
+	UpstreamHostUp          *prometheus.GaugeVec
+	GroupRateLimited        *prometheus.CounterVec
+	ProviderBreakerState    *prometheus.GaugeVec
+	ProviderBreakerRejected *prometheus.CounterVec
+
+	// PayloadOffloads counts request payloads written to object storage, by source and result.
+	PayloadOffloads *prometheus.CounterVec
+	// RequestLogsDropped counts request logs that were not written, by reason.
+	RequestLogsDropped *prometheus.CounterVec
+	SIEMEventsSent     prometheus.Counter
+	SIEMSendErrors     prometheus.Counter
+
+	// 每个密钥的指标以数据库 ID 作为标签，密钥删除后由 UntrackKey 移除
+	KeyRequests                *prometheus.CounterVec
+	KeyLatency                 *prometheus.HistogramVec
+	KeyCircuitState            *prometheus.GaugeVec
+	KeyAffinityHits            *prometheus.CounterVec
+	UpstreamIdempotencyReplays *prometheus.CounterVec
+	IntegrityCheckFailures     *prometheus.CounterVec
+	StandbyKeysActive          prometheus.Gauge
+
+	keyRemovalsMu sync.Mutex
+	keyRemovals   map[uint]*time.Timer
+}
+
+// NewMetrics creates the collectors and registers them with registerer.
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		registerer: registerer,
+		LoadShed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gptload_load_shed_total",
+			Help: "Requests rejected with 503 by load shedding while the number of in-flight requests was above LOAD_SHED_QUEUE_THRESHOLD.",
+		}),
+		InFlightRequests: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gptload_inflight_requests",
+			Help: "Requests currently holding a MAX_CONCURRENT_REQUESTS slot.",
+		}),
+		MaxConcurrentRequests: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gptload_max_concurrent_requests",
+			Help: "Configured MAX_CONCURRENT_REQUESTS.",
+		}),
+		ReservedSlotsInUse: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gptload_reserved_probe_slots_in_use",
+			Help: "Probe and test requests currently running in the slots reserved by RESERVED_PROBE_SLOTS.",
+		}),
+		ReservedProbeRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gptload_reserved_probe_requests_total",
+			Help: "Probe and test requests that ran in the reserved slots because MAX_CONCURRENT_REQUESTS was reached.",
+		}),
+		GroupUpstreamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_group_upstream_requests_total",
+			Help: "Number of requests sent to the upstream of each group.",
+		}, []string{"group"}),
+		GroupConnectionErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_group_connection_errors_total",
+			Help: "Number of upstream requests of each group that failed at the connection level, by reason.",
+		}, []string{"group", "reason"}),
+		UpstreamResponses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_upstream_responses_total",
+			Help: "Number of upstream attempts by group, upstream and status code, with code \"error\" when no response was received.",
+		}, []string{"group", "upstream", "code"}),
+		ResponseBodyBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gptload_response_body_bytes",
+			Help:    "Size of upstream response bodies relayed to clients, by model.",
+			Buckets: ResponseSizeBuckets,
+		}, []string{"model"}),
+		UpstreamRawMode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gptload_upstream_raw_mode",
+			Help: "Whether raw mode (no Content-Length, chunked to the client) is forced for an upstream of a group after repeated length mismatches.",
+		}, []string{"group", "upstream"}),
+		UpstreamHostUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gptload_upstream_host_up",
+			Help: "Whether an upstream host of a group passed its health probes (1) or is marked down (0).",
+		}, []string{"group", "upstream"}),
+		GroupRateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_group_rate_limited_total",
+			Help: "Proxy requests rejected with 429 because the group exceeded its requests per minute.",
+		}, []string{"group"}),
+		ProviderBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gptload_provider_breaker_state",
+			Help: "Circuit state of each channel type across all its groups: 0 closed, 1 half-open (probing), 2 open.",
+		}, []string{"channel_type"}),
+		ProviderBreakerRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_provider_breaker_rejected_total",
+			Help: "Proxy requests rejected with 503 because the circuit of their channel type was open.",
+		}, []string{"channel_type"}),
+		PayloadOffloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_payload_offloads_total",
+			Help: "Number of request log payloads written to object storage, by source (flush, migration) and result.",
+		}, []string{"source", "result"}),
+		RequestLogsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_request_logs_dropped_total",
+			Help: "Number of request logs dropped instead of written to the database, by reason (queue_full, write_failed).",
+		}, []string{"reason"}),
+		SIEMEventsSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gptload_siem_events_sent_total",
+			Help: "Total number of admin audit events delivered to the SIEM stream.",
+		}),
+		SIEMSendErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gptload_siem_send_errors_total",
+			Help: "Total number of failed attempts to deliver a batch of admin audit events to the SIEM stream.",
+		}),
+		KeyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_key_requests_total",
+			Help: "Number of upstream requests sent with each key, by outcome.",
+		}, []string{"key_id", "status"}),
+		KeyLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gptload_key_latency_seconds",
+			Help:    "Time until the upstream response headers were received, per key.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"key_id"}),
+		KeyCircuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gptload_key_circuit_state",
+			Help: "Key availability: 0 = closed (active), 1 = half-open (suspect, pending probe), 2 = open (invalid).",
+		}, []string{"key_id"}),
+		KeyAffinityHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_key_affinity_hits_total",
+			Help: "Number of requests that were sent with a key because its model affinity matched the requested model.",
+		}, []string{"key_id"}),
+		UpstreamIdempotencyReplays: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_upstream_idempotency_replays_total",
+			Help: "Number of upstream responses replayed by the provider for a repeated idempotency key.",
+		}, []string{"key_id"}),
+		IntegrityCheckFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_integrity_check_failures_total",
+			Help: "Number of upstream response bodies that did not match their Content-MD5 or X-Content-SHA256 header.",
+		}, []string{"key_id"}),
+		StandbyKeysActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gptload_standby_keys_active_total",
+			Help: "Number of standby keys currently promoted to active because their group ran short of healthy keys.",
+		}),
+		keyRemovals: make(map[uint]*time.Timer),
+	}
+
+	m.register(
+		m.LoadShed, m.InFlightRequests, m.MaxConcurrentRequests, m.ReservedSlotsInUse, m.ReservedProbeRequests,
+		m.GroupUpstreamRequests, m.GroupConnectionErrors, m.UpstreamResponses, m.ResponseBodyBytes,
+		m.UpstreamRawMode, m.UpstreamHostUp, m.GroupRateLimited, m.ProviderBreakerState, m.ProviderBreakerRejected,
+		m.PayloadOffloads, m.RequestLogsDropped, m.SIEMEventsSent, m.SIEMSendErrors,
+		m.KeyRequests, m.KeyLatency, m.KeyCircuitState, m.KeyAffinityHits, m.UpstreamIdempotencyReplays, m.IntegrityCheckFailures,
+		m.StandbyKeysActive,
+	)
+	return m
+}
+
+func (m *Metrics) register(collectors ...prometheus.Collector) {
+	for _, c := range collectors {
+		if err := m.registerer.Register(c); err != nil {
+			logrus.Warnf("Failed to register metrics: %v", err)
+		}
+	}
+}
+
+// RegisterGoroutineGauges exposes the goroutine count of the runtime and the number of
+// application-managed goroutines reported by managed.
+func (m *Metrics) RegisterGoroutineGauges(managed func() float64) {
+	m.register(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gptload_goroutines_total",
+			Help: "Total number of goroutines in the Go runtime.",
+		}, func() float64 {
+			return float64(goruntime.NumGoroutine())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gptload_managed_goroutines",
+			Help: "Number of application-managed goroutines currently holding a pool slot.",
+		}, managed),
+	)
+}
+
+// RegisterPoolDegradedGauge exposes the degraded flag of the key pool reported by degraded.
+func (m *Metrics) RegisterPoolDegradedGauge(degraded func() bool) {
+	m.register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gptload_pool_degraded",
+		Help: "Whether the key pool is in degraded mode (1) because healthy keys are below MIN_VIABLE_POOL_SIZE.",
+	}, func() float64 {
+		if degraded() {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// ObserveResponseBodySize records a fully received upstream response body of size bytes under the
+// model label, which must come from ModelLabel.
+func (m *Metrics) ObserveResponseBodySize(model string, size int64) {
+	m.ResponseBodyBytes.WithLabelValues(model).Observe(float64(size))
+}
+
+// ObserveKeyRequest records the outcome and latency of an upstream request sent with a key.
+func (m *Metrics) ObserveKeyRequest(keyID uint, success bool, latency time.Duration) {
+	label := KeyIDLabel(keyID)
+	status := "success"
+	if !success {
+		status = "failure"
+	}
+	m.KeyRequests.WithLabelValues(label, status).Inc()
+	m.KeyLatency.WithLabelValues(label).Observe(latency.Seconds())
+}
+
+// ObserveKeyAffinityHit records that a key was selected for a request by its model affinity.
+func (m *Metrics) ObserveKeyAffinityHit(keyID uint) {
+	m.KeyAffinityHits.WithLabelValues(KeyIDLabel(keyID)).Inc()
+}
+
+// TrackKey sets the circuit state of a key in the pool, cancelling any pending removal of its
+// metrics, e.g. when a deleted key is imported again.
+func (m *Metrics) TrackKey(keyID uint, circuitState float64) {
+	m.keyRemovalsMu.Lock()
+	if timer, ok := m.keyRemovals[keyID]; ok {
+		timer.Stop()
+		delete(m.keyRemovals, keyID)
+	}
+	m.keyRemovalsMu.Unlock()
+
+	m.KeyCircuitState.WithLabelValues(KeyIDLabel(keyID)).Set(circuitState)
+}
+
+// UntrackKey removes every series of a key removed from the pool after the grace period.
+func (m *Metrics) UntrackKey(keyID uint) {
+	m.keyRemovalsMu.Lock()
+	defer m.keyRemovalsMu.Unlock()
+
+	if _, ok := m.keyRemovals[keyID]; ok {
+		return
+	}
+	m.keyRemovals[keyID] = time.AfterFunc(keyMetricsGracePeriod, func() {
+		m.keyRemovalsMu.Lock()
+		delete(m.keyRemovals, keyID)
+		m.keyRemovalsMu.Unlock()
+
+		m.deleteKey(keyID)
+	})
+}
+
+// deleteKey deletes the series of every per-key collector for the key.
+func (m *Metrics) deleteKey(keyID uint) {
+	labels := prometheus.Labels{"key_id": KeyIDLabel(keyID)}
+	for _, vec := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{m.KeyRequests, m.KeyLatency, m.KeyCircuitState, m.KeyAffinityHits, m.UpstreamIdempotencyReplays, m.IntegrityCheckFailures} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// KeyIDLabel returns the key_id label value of a key.
+func KeyIDLabel(keyID uint) string {
+	return strconv.FormatUint(uint64(keyID), 10)
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeleteKeyRemovesEverySeries(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	for _, keyID := range []uint{1, 2} {
+		m.TrackKey(keyID, 0)
+		m.ObserveKeyRequest(keyID, true, time.Second)
+		m.ObserveKeyAffinityHit(keyID)
+		m.UpstreamIdempotencyReplays.WithLabelValues(KeyIDLabel(keyID)).Inc()
+		m.IntegrityCheckFailures.WithLabelValues(KeyIDLabel(keyID)).Inc()
+	}
+
+	m.deleteKey(1)
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+	}{
+		{name: "requests", collector: m.KeyRequests},
+		{name: "latency", collector: m.KeyLatency},
+		{name: "circuit state", collector: m.KeyCircuitState},
+		{name: "affinity hits", collector: m.KeyAffinityHits},
+		{name: "idempotency replays", collector: m.UpstreamIdempotencyReplays},
+		{name: "integrity check failures", collector: m.IntegrityCheckFailures},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 只剩下密钥 2 的序列
+			if got := testutil.CollectAndCount(tt.collector); got != 1 {
+				t.Errorf("series after deleting key 1 = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestTrackKeyCancelsRemoval(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	m.TrackKey(1, 0)
+	m.UntrackKey(1)
+
+	m.keyRemovalsMu.Lock()
+	_, pending := m.keyRemovals[1]
+	m.keyRemovalsMu.Unlock()
+	if !pending {
+		t.Fatal("removal not scheduled after UntrackKey")
+	}
+
+	m.TrackKey(1, 2)
+	m.keyRemovalsMu.Lock()
+	_, pending = m.keyRemovals[1]
+	m.keyRemovalsMu.Unlock()
+	if pending {
+		t.Error("removal still scheduled after the key was tracked again")
+	}
+	if got := testutil.ToFloat64(m.KeyCircuitState.WithLabelValues("1")); got != 2 {
+		t.Errorf("circuit state = %v, want 2", got)
+	}
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import "gpt-load/internal/models"
+
+// OtherModel is the model label of requests for models their group does not configure.
+const OtherModel = "other"
+
+// ResponseSizeBuckets are the upper bounds of the response body size histogram: 1KB, 10KB, 100KB, 1MB and 10MB.
+var ResponseSizeBuckets = []float64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+
+// ModelLabel returns the model label of a request to group. The model name comes from the client,
+// so only the group's configured models (its test model and Azure deployment mappings) keep their
+// name; every other model is labeled OtherModel, which bounds the number of series.
+func ModelLabel(group *models.Group, model string) string {
+	if model == "" {
+		return OtherModel
+	}
+	if model == group.TestModel {
+		return model
+	}
+	// 配置校验时已确认映射合法
+	deployments, _ := models.ParseAzureDeployments(group.EffectiveConfig.AzureDeployments)
+	if _, ok := deployments[model]; ok {
+		return model
+	}
+	return OtherModel
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"gpt-load/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestModelLabel(t *testing.T) {
+	group := &models.Group{TestModel: "gpt-4o-mini"}
+	group.EffectiveConfig.AzureDeployments = "gpt-4o:prod-gpt4o, o1:prod-o1"
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{model: "gpt-4o-mini", want: "gpt-4o-mini"},
+		{model: "gpt-4o", want: "gpt-4o"},
+		{model: "o1", want: "o1"},
+		{model: "prod-gpt4o", want: OtherModel},
+		{model: "random-model-1234", want: OtherModel},
+		{model: "", want: OtherModel},
+	}
+	for _, tt := range tests {
+		if got := ModelLabel(group, tt.model); got != tt.want {
+			t.Errorf("ModelLabel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestObserveResponseBodySize(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+	m.ObserveResponseBodySize("observe-model", 512)
+	m.ObserveResponseBodySize("observe-model", 2<<20)
+
+	want := `
+# HELP gptload_response_body_bytes Size of upstream response bodies relayed to clients, by model.
+# TYPE gptload_response_body_bytes histogram
+gptload_response_body_bytes_bucket{model="observe-model",le="1024"} 1
+gptload_response_body_bytes_bucket{model="observe-model",le="10240"} 1
+gptload_response_body_bytes_bucket{model="observe-model",le="102400"} 1
+gptload_response_body_bytes_bucket{model="observe-model",le="1.048576e+06"} 1
+gptload_response_body_bytes_bucket{model="observe-model",le="1.048576e+07"} 2
+gptload_response_body_bytes_bucket{model="observe-model",le="+Inf"} 2
+gptload_response_body_bytes_sum{model="observe-model"} 2.097664e+06
+gptload_response_body_bytes_count{model="observe-model"} 2
+`
+	if err := testutil.CollectAndCompare(m.ResponseBodyBytes, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
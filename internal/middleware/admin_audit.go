@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAudit records every admin API call that can change state, including rejected ones,
+// in the admin audit log. Read-only requests are not recorded.
+func AdminAudit(audit *services.AdminAuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		entry := &models.AdminAuditLog{
+			Timestamp:  start,
+			Action:     c.Request.Method + " " + route,
+			Actor:      c.ClientIP(),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			StatusCode: c.Writer.Status(),
+		}
+		if len(c.Errors) > 0 {
+			entry.Detail = c.Errors.String()
+		}
+		audit.Record(entry)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminBodyLimit rejects admin API requests whose body exceeds maxBytes with 413.
+// overrides maps a route path (as registered, e.g. /api/keys/add-async) to its own limit.
+func AdminBodyLimit(maxBytes int64, overrides map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		limit := maxBytes
+		if override, ok := overrides[c.FullPath()]; ok {
+			limit = override
+		}
+
+		if c.Request.ContentLength > limit {
+			abortRequestTooLarge(c)
+			return
+		}
+
+		// 读取整个请求体，确保分块传输的超限请求同样返回 413
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				abortRequestTooLarge(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		c.Next()
+	}
+}
+
+func abortRequestTooLarge(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request_too_large"})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		adminLimit      = 16
+		bulkImportLimit = 64
+	)
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		chunked    bool
+		wantStatus int
+	}{
+		{name: "empty body", path: "/api/groups", body: "", wantStatus: http.StatusOK},
+		{name: "within admin limit", path: "/api/groups", body: strings.Repeat("a", adminLimit), wantStatus: http.StatusOK},
+		{name: "over admin limit", path: "/api/groups", body: strings.Repeat("a", adminLimit+1), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked over admin limit", path: "/api/groups", body: strings.Repeat("a", adminLimit+1), chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "bulk import within its limit", path: "/api/keys/add-async", body: strings.Repeat("a", bulkImportLimit), wantStatus: http.StatusOK},
+		{name: "bulk import over its limit", path: "/api/keys/add-async", body: strings.Repeat("a", bulkImportLimit+1), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "bulk delete over admin limit", path: "/api/keys/delete-async", body: strings.Repeat("a", adminLimit*2), chunked: true, wantStatus: http.StatusOK},
+	}
+
+	router := gin.New()
+	router.Use(AdminBodyLimit(adminLimit, map[string]int64{
+		"/api/keys/add-async":    bulkImportLimit,
+		"/api/keys/delete-async": bulkImportLimit,
+	}))
+	var received string
+	handler := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		received = string(body)
+		c.Status(http.StatusOK)
+	}
+	router.POST("/api/groups", handler)
+	router.POST("/api/keys/add-async", handler)
+	router.POST("/api/keys/delete-async", handler)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && received != tt.body {
+				t.Errorf("handler received %d bytes, want %d", len(received), len(tt.body))
+			}
+		})
+	}
+}
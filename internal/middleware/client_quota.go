@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"strconv"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const clientQuotaRemainingHeader = "X-Client-Quota-Remaining"
+
+// ClientQuota enforces the monthly request quota of the client proxy key, across all groups.
+// It runs after ProxyAuth. When the counters can't be reached, requests are let through.
+func ClientQuota(quota *services.ClientQuotaService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if quota.Limit() <= 0 {
+			c.Next()
+			return
+		}
+
+		stat, allowed, err := quota.Consume(c.GetString("clientKey"))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to check client quota")
+			c.Next()
+			return
+		}
+
+		c.Header(clientQuotaRemainingHeader, strconv.FormatInt(stat.Remaining, 10))
+		if !allowed {
+			response.Error(c, app_errors.ErrClientQuotaExceeded)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,14 @@
+package middleware
+
+import "gpt-load/internal/types"
+
+// stubConfigManager returns fixed configuration sections. Methods for sections a test does not
+// set are not implemented and panic when called.
+type stubConfigManager struct {
+	types.ConfigManager
+	auth    types.AuthConfig
+	metrics types.MetricsConfig
+}
+
+func (m *stubConfigManager) GetAuthConfig() types.AuthConfig       { return m.auth }
+func (m *stubConfigManager) GetMetricsConfig() types.MetricsConfig { return m.metrics }
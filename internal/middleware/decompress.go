@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// DecompressRequestBody transparently decompresses gzip-encoded request bodies,
+// so upstreams that don't accept compressed input receive plain content. Bodies that
+// decompress to more than DecompressMaxBodyBytes are rejected with 413.
+func DecompressRequestBody(config types.PerformanceConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.DecompressRequestBody || !strings.EqualFold(strings.TrimSpace(c.GetHeader("Content-Encoding")), "gzip") {
+			c.Next()
+			return
+		}
+
+		reader, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			logrus.Debugf("Failed to open gzip request body: %v", err)
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid gzip request body"))
+			c.Abort()
+			return
+		}
+		// 多读一个字节以判断是否超过上限
+		limit := int64(config.DecompressMaxBodyBytes)
+		body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+		reader.Close()
+		c.Request.Body.Close()
+		if err == nil && int64(len(body)) > limit {
+			logrus.Debugf("Decompressed request body exceeds %d bytes", limit)
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrRequestTooLarge, fmt.Sprintf("Decompressed request body exceeds the limit of %d bytes", limit)))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			logrus.Debugf("Failed to decompress gzip request body: %v", err)
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid gzip request body"))
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+		c.Next()
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const limit = 64
+	tests := []struct {
+		name            string
+		disabled        bool
+		body            []byte
+		contentEncoding string
+		wantStatus      int
+		wantBody        string
+		wantEncoding    string
+	}{
+		{
+			name:       "uncompressed body is passed through",
+			body:       []byte(`{"model":"gpt-4o"}`),
+			wantStatus: http.StatusOK,
+			wantBody:   `{"model":"gpt-4o"}`,
+		},
+		{
+			name:            "gzip body is decompressed",
+			body:            gzipBytes(t, `{"model":"gpt-4o"}`),
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusOK,
+			wantBody:        `{"model":"gpt-4o"}`,
+		},
+		{
+			name:            "content encoding is case insensitive",
+			body:            gzipBytes(t, "hello"),
+			contentEncoding: " GZIP ",
+			wantStatus:      http.StatusOK,
+			wantBody:        "hello",
+		},
+		{
+			name:            "body at the limit is accepted",
+			body:            gzipBytes(t, strings.Repeat("a", limit)),
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusOK,
+			wantBody:        strings.Repeat("a", limit),
+		},
+		{
+			name:            "body over the limit is rejected",
+			body:            gzipBytes(t, strings.Repeat("a", limit+1)),
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:            "highly compressible body over the limit is rejected",
+			body:            gzipBytes(t, strings.Repeat("a", 10*1024*1024)),
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:            "invalid gzip header",
+			body:            []byte("not gzip"),
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusBadRequest,
+		},
+		{
+			name:            "truncated gzip body",
+			body:            gzipBytes(t, strings.Repeat("abc", 10))[:20],
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusBadRequest,
+		},
+		{
+			name:            "disabled leaves the body compressed",
+			disabled:        true,
+			body:            []byte("compressed"),
+			contentEncoding: "gzip",
+			wantStatus:      http.StatusOK,
+			wantBody:        "compressed",
+			wantEncoding:    "gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := types.PerformanceConfig{DecompressRequestBody: !tt.disabled, DecompressMaxBodyBytes: limit}
+
+			var gotBody, gotEncoding string
+			var gotLength int64
+			router := gin.New()
+			router.Use(DecompressRequestBody(config))
+			router.POST("/", func(c *gin.Context) {
+				body, _ := io.ReadAll(c.Request.Body)
+				gotBody = string(body)
+				gotEncoding = c.GetHeader("Content-Encoding")
+				gotLength = c.Request.ContentLength
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if gotBody != tt.wantBody {
+				t.Errorf("body = %q, want %q", gotBody, tt.wantBody)
+			}
+			if gotEncoding != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", gotEncoding, tt.wantEncoding)
+			}
+			if gotLength != int64(len(tt.wantBody)) {
+				t.Errorf("ContentLength = %d, want %d", gotLength, len(tt.wantBody))
+			}
+		})
+	}
+}
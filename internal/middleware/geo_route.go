@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"strings"
+
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GeoRoute sends proxy requests to the group mapped to the caller's country, so its keys
+// and upstreams are preferred. Requests keep their requested group when no rule matches,
+// when the mapped group has a different channel type and couldn't serve the request format, or when
+// the mapped group is drained for deletion. A drained requested group then gets the usual 503.
+// It runs after ProxyAuth, so callers are authorized against the group they requested.
+func GeoRoute(geo *services.GeoRoutingService, gm *services.GroupManager) gin.HandlerFunc {
+	if !geo.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		groupName := c.Param("group_name")
+		group, err := gm.GetGroupByName(groupName)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		country, mappedGroupID, ok := geo.Route(c.ClientIP())
+		if !ok || mappedGroupID == group.ID {
+			c.Next()
+			return
+		}
+
+		target, err := gm.GetGroupByID(mappedGroupID)
+		if err != nil || target.ChannelType != group.ChannelType || target.DeleteAfter != nil {
+			logrus.WithFields(logrus.Fields{
+				"country":     country,
+				"group":       group.Name,
+				"mappedGroup": mappedGroupID,
+			}).Debug("Geo route target unavailable, using requested group")
+			c.Next()
+			return
+		}
+
+		for i := range c.Params {
+			if c.Params[i].Key == "group_name" {
+				c.Params[i].Value = target.Name
+			}
+		}
+		c.Request.URL.Path = "/proxy/" + target.Name + strings.TrimPrefix(c.Request.URL.Path, "/proxy/"+groupName)
+		c.Request.URL.RawPath = ""
+
+		logrus.WithFields(logrus.Fields{
+			"country":     country,
+			"group":       group.Name,
+			"targetGroup": target.Name,
+		}).Debug("Request geo-routed")
+		c.Next()
+	}
+}
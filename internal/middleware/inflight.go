@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InFlightTracker counts in-flight proxy and admin requests so shutdown can drain them separately.
+// It also tracks streaming responses, which may outlast the drain phase and are closed forcibly.
+type InFlightTracker struct {
+	proxy sync.WaitGroup
+	admin sync.WaitGroup
+
+	streams      sync.WaitGroup
+	draining     atomic.Bool
+	closeStreams chan struct{}
+	closeOnce    sync.Once
+}
+
+// NewInFlightTracker creates a new InFlightTracker.
+func NewInFlightTracker() *InFlightTracker {
+	return &InFlightTracker{closeStreams: make(chan struct{})}
+}
+
+// TrackProxy tracks proxy requests. It runs inside RateLimiter, so a drained proxy
+// WaitGroup means every proxy request has finished and is releasing its semaphore slot.
+func (t *InFlightTracker) TrackProxy() gin.HandlerFunc {
+	return track(&t.proxy)
+}
+
+// TrackAdmin tracks admin API requests.
+func (t *InFlightTracker) TrackAdmin() gin.HandlerFunc {
+	return track(&t.admin)
+}
+
+// WaitProxy waits for in-flight proxy requests, returning false on timeout.
+func (t *InFlightTracker) WaitProxy(timeout time.Duration) bool {
+	return waitTimeout(&t.proxy, timeout)
+}
+
+// WaitAdmin waits for in-flight admin requests, returning false on timeout.
+func (t *InFlightTracker) WaitAdmin(timeout time.Duration) bool {
+	return waitTimeout(&t.admin, timeout)
+}
+
+// BeginDraining marks the server as shutting down; new streaming requests are refused from now on.
+func (t *InFlightTracker) BeginDraining() {
+	t.draining.Store(true)
+}
+
+// Draining reports whether the server is shutting down.
+func (t *InFlightTracker) Draining() bool {
+	return t.draining.Load()
+}
+
+// TrackStream registers an active streaming response. The returned channel is closed when
+// the stream must be force-closed; done must be called once the stream has ended.
+func (t *InFlightTracker) TrackStream() (closing <-chan struct{}, done func()) {
+	t.streams.Add(1)
+	return t.closeStreams, t.streams.Done
+}
+
+// CloseStreams asks every active stream to close, then waits for them up to timeout.
+func (t *InFlightTracker) CloseStreams(timeout time.Duration) bool {
+	t.closeOnce.Do(func() { close(t.closeStreams) })
+	return waitTimeout(&t.streams, timeout)
+}
+
+func track(wg *sync.WaitGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wg.Add(1)
+		defer wg.Done()
+		c.Next()
+	}
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInFlightTrackerCloseStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		streams  int
+		ignoring int // 不响应关闭信号的流
+		want     bool
+	}{
+		{name: "no streams", want: true},
+		{name: "streams close when asked", streams: 3, want: true},
+		{name: "stream ignores close", streams: 2, ignoring: 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewInFlightTracker()
+			if tracker.Draining() {
+				t.Fatal("new tracker is draining")
+			}
+			tracker.BeginDraining()
+			if !tracker.Draining() {
+				t.Fatal("tracker is not draining after BeginDraining")
+			}
+
+			var stuck []func()
+			for i := 0; i < tt.streams; i++ {
+				closing, done := tracker.TrackStream()
+				if i < tt.ignoring {
+					stuck = append(stuck, done)
+					continue
+				}
+				go func() {
+					<-closing
+					done()
+				}()
+			}
+
+			if got := tracker.CloseStreams(100 * time.Millisecond); got != tt.want {
+				t.Errorf("CloseStreams() = %v, want %v", got, tt.want)
+			}
+			for _, done := range stuck {
+				done()
+			}
+			// 再次调用不会重复关闭通道
+			if !tracker.CloseStreams(time.Second) {
+				t.Error("second CloseStreams() did not return true once all streams ended")
+			}
+		})
+	}
+}
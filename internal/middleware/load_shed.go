@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/http"
+
+	"gpt-load/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldShed decides whether to reject a new request at the given depth. The rejection
+// probability grows linearly from 0 at the threshold to 1 at capacity.
+func shouldShed(depth, threshold, capacity int64) bool {
+	if threshold <= 0 || depth <= threshold {
+		return false
+	}
+	if depth >= capacity {
+		return true
+	}
+	return rand.Float64() < float64(depth-threshold)/float64(capacity-threshold)
+}
+
+// shed rejects the request as load shedding.
+func shed(c *gin.Context, m *metrics.Metrics, depth int64) {
+	m.LoadShed.Inc()
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "load_shedding", "queue_depth": depth})
+}
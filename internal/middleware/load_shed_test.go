@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimiterInFlightGauges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		capacity     int
+		held         int // 已占用并发槽位的请求数
+		wantInFlight float64
+	}{
+		{name: "idle", capacity: 3, held: 0, wantInFlight: 0},
+		{name: "one held", capacity: 3, held: 1, wantInFlight: 1},
+		{name: "full", capacity: 2, held: 2, wantInFlight: 2},
+		{name: "rejected request not counted", capacity: 1, held: 2, wantInFlight: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			done := make(chan struct{}, tt.held)
+			m := metrics.NewMetrics(prometheus.NewRegistry())
+			router := gin.New()
+			router.Use(RateLimiter(types.PerformanceConfig{MaxConcurrentRequests: tt.capacity}, m))
+			router.GET("/api/groups", func(c *gin.Context) {
+				done <- struct{}{}
+				<-release
+				c.Status(http.StatusOK)
+			})
+
+			if got := testutil.ToFloat64(m.MaxConcurrentRequests); got != float64(tt.capacity) {
+				t.Errorf("max concurrent requests = %v, want %d", got, tt.capacity)
+			}
+
+			var wg sync.WaitGroup
+			for range tt.held {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/groups", nil))
+					if w.Code != http.StatusOK {
+						// 超出并发上限的请求被拒绝，不会进入处理函数
+						done <- struct{}{}
+					}
+				}()
+			}
+			for range tt.held {
+				<-done
+			}
+
+			if got := testutil.ToFloat64(m.InFlightRequests); got != tt.wantInFlight {
+				t.Errorf("in-flight requests = %v, want %v", got, tt.wantInFlight)
+			}
+			close(release)
+			wg.Wait()
+			if got := testutil.ToFloat64(m.InFlightRequests); got != 0 {
+				t.Errorf("in-flight requests after completion = %v, want 0", got)
+			}
+		})
+	}
+}
@@ -2,20 +2,28 @@
 package middleware
 
 import (
-	"crypto/subtle"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"gpt-load/internal/config"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/response"
 	"gpt-load/internal/services"
 	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// UpstreamRequestIDContextKey is the gin context key under which the proxy handler records
+// the request ID returned by the upstream, so the access log can include it.
+const UpstreamRequestIDContextKey = "upstreamRequestID"
+
 // Logger creates a high-performance logging middleware
 func Logger(config types.LogConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -42,16 +50,26 @@ func Logger(config types.LogConfig) gin.HandlerFunc {
 
 		// Get key information (if exists)
 		keyInfo := ""
-		if keyIndex, exists := c.Get("keyIndex"); exists {
-			if keyPreview, exists := c.Get("keyPreview"); exists {
-				keyInfo = fmt.Sprintf(" - Key[%v] %v", keyIndex, keyPreview)
+		retryInfo := ""
+		if config.IncludeSelection {
+			if groupName, exists := c.Get("groupName"); exists {
+				keyInfo = fmt.Sprintf(" - Group[%v]", groupName)
+			}
+			if keyIndex, exists := c.Get("keyIndex"); exists {
+				if keyPreview, exists := c.Get("keyPreview"); exists {
+					keyInfo += fmt.Sprintf(" - Key[%v] %v", keyIndex, keyPreview)
+				}
+			}
+
+			// Get retry information (if exists)
+			if retryCount, exists := c.Get("retryCount"); exists {
+				retryInfo = fmt.Sprintf(" - Retry[%d]", retryCount)
 			}
 		}
 
-		// Get retry information (if exists)
-		retryInfo := ""
-		if retryCount, exists := c.Get("retryCount"); exists {
-			retryInfo = fmt.Sprintf(" - Retry[%d]", retryCount)
+		// 上游请求 ID 用于与服务商的工单关联，不受 IncludeSelection 控制
+		if upstreamRequestID := c.GetString(UpstreamRequestIDContextKey); upstreamRequestID != "" {
+			retryInfo += fmt.Sprintf(" - UpstreamRequestID[%s]", upstreamRequestID)
 		}
 
 		// Filter health check and other monitoring endpoint logs to reduce noise
@@ -75,8 +93,10 @@ func Logger(config types.LogConfig) gin.HandlerFunc {
 }
 
 // CORS creates a CORS middleware
-func CORS(config types.CORSConfig) gin.HandlerFunc {
+func CORS(configManager types.ConfigManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 每次请求读取配置，重新加载后立即生效
+		config := configManager.GetCORSConfig()
 		if !config.Enabled {
 			c.Next()
 			return
@@ -125,13 +145,16 @@ func Auth(authConfig types.AuthConfig) gin.HandlerFunc {
 			return
 		}
 
-		key := extractAuthKey(c)
-
-		isValid := key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(authConfig.Key)) == 1
+		isValid, ipAllowed := utils.AuthorizeAdminKey(authConfig, extractAuthKey(c), c.ClientIP())
 
 		if !isValid {
-			response.Error(c, app_errors.ErrUnauthorized)
-			c.Abort()
+			abortUnauthorized(c)
+			return
+		}
+
+		// 密钥有效但来源 IP 不在该密钥的允许列表内
+		if !ipAllowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "ip_not_allowed"})
 			return
 		}
 
@@ -145,8 +168,7 @@ func ProxyAuth(gm *services.GroupManager) gin.HandlerFunc {
 		// Check key
 		key := extractAuthKey(c)
 		if key == "" {
-			response.Error(c, app_errors.ErrUnauthorized)
-			c.Abort()
+			abortUnauthorized(c)
 			return
 		}
 
@@ -157,20 +179,84 @@ func ProxyAuth(gm *services.GroupManager) gin.HandlerFunc {
 			return
 		}
 
-		// Check both key collections to prevent timing attacks
-		_, existsInEffective := group.EffectiveConfig.ProxyKeysMap[key]
-		_, existsInGroup := group.ProxyKeysMap[key]
-
-		if existsInEffective || existsInGroup {
+		// 以常量时间比较全局与分组的全部代理密钥，避免通过响应时间推测密钥
+		if utils.MatchesAnyKeyInSet(key, group.EffectiveConfig.ProxyKeysMap, group.ProxyKeysMap) {
+			c.Set("clientKey", key)
 			c.Next()
 			return
 		}
 
-		response.Error(c, app_errors.ErrUnauthorized)
-		c.Abort()
+		abortUnauthorized(c)
 	}
 }
 
+// DefaultGroupRoute routes requests to the OpenAI-compatible /v1 root to a default group, for
+// tools that hard-code /v1/... paths. A per-proxy-key override takes precedence over the
+// global default group. The request is rewritten to /proxy/<group>/v1/... so the rest of
+// the proxy pipeline handles it exactly like a path-routed request.
+func DefaultGroupRoute(settingsManager *config.SystemSettingsManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupName := defaultGroupFor(settingsManager.GetSettings(), extractAuthKey(c))
+		if groupName == "" {
+			response.Error(c, app_errors.ErrNoDefaultGroup)
+			c.Abort()
+			return
+		}
+
+		c.Params = append(c.Params, gin.Param{Key: "group_name", Value: groupName})
+		c.Request.URL.Path = "/proxy/" + groupName + c.Request.URL.Path
+		c.Request.URL.RawPath = ""
+		c.Next()
+	}
+}
+
+// defaultGroupFor returns the default group of requests made with proxy key authKey.
+func defaultGroupFor(settings types.SystemSettings, authKey string) string {
+	if override, ok := settings.DefaultGroupOverridesMap[authKey]; ok {
+		return override
+	}
+	return settings.DefaultGroup
+}
+
+// PathPrefixRouting rewrites requests under a prefix of the path_prefix_routes setting, e.g.
+// /openai/v1/chat/completions, to /proxy/<group>/v1/chat/completions with the prefix stripped.
+// It wraps the engine because gin picks the route before running any middleware. With
+// path_prefix_unmatched_to_default, other requests carrying a proxy key that no built-in route
+// serves go to the default group with their path unchanged.
+func PathPrefixRouting(next http.Handler, settingsManager *config.SystemSettingsManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := settingsManager.GetSettings()
+		if groupName, rest, ok := utils.MatchPathPrefix(settings.PathPrefixRoutesMap, r.URL.Path); ok {
+			r.URL.Path = "/proxy/" + groupName + rest
+			r.URL.RawPath = ""
+		} else if settings.PathPrefixUnmatchedToDefault && !utils.IsReservedPath(r.URL.Path) {
+			// 不携带代理密钥的请求（如管理端页面）保持原样
+			if key := ProxyKeyFromRequest(r); key != "" {
+				if groupName := defaultGroupFor(settings, key); groupName != "" {
+					r.URL.Path = "/proxy/" + groupName + r.URL.Path
+					r.URL.RawPath = ""
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProxyKeyFromRequest returns the proxy key carried in the query or headers of r, without
+// removing it from the request.
+func ProxyKeyFromRequest(r *http.Request) string {
+	if key := r.URL.Query().Get("key"); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && key != "" {
+		return key
+	}
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	return r.Header.Get("X-Goog-Api-Key")
+}
+
 // Recovery creates a recovery middleware with custom error handling
 func Recovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
@@ -180,17 +266,41 @@ func Recovery() gin.HandlerFunc {
 	})
 }
 
-// RateLimiter creates a simple rate limiting middleware
-func RateLimiter(config types.PerformanceConfig) gin.HandlerFunc {
+// RateLimiter creates a simple rate limiting middleware. Above LOAD_SHED_QUEUE_THRESHOLD
+// in-flight requests, new requests are rejected with a probability that reaches 100% at
+// MAX_CONCURRENT_REQUESTS, so that overload degrades gradually. Health probes, metrics and key
+// tests are not shed, and once the limit is reached they run in the RESERVED_PROBE_SLOTS slots.
+func RateLimiter(config types.PerformanceConfig, m *metrics.Metrics) gin.HandlerFunc {
 	// Simple semaphore-based rate limiting
 	semaphore := make(chan struct{}, config.MaxConcurrentRequests)
+	reserved := make(chan struct{}, config.ReservedProbeSlots)
+	// 与信号量同步增减，读取时无需加锁
+	var depth atomic.Int64
+	threshold := int64(config.LoadShedQueueThreshold)
+	capacity := int64(config.MaxConcurrentRequests)
+	m.MaxConcurrentRequests.Set(float64(capacity))
 
 	return func(c *gin.Context) {
+		probe := isProbeRequest(c)
+		if current := depth.Load(); !probe && shouldShed(current, threshold, capacity) {
+			shed(c, m, current)
+			return
+		}
+
 		select {
 		case semaphore <- struct{}{}:
-			defer func() { <-semaphore }()
+			depth.Add(1)
+			m.InFlightRequests.Inc()
+			defer func() {
+				m.InFlightRequests.Dec()
+				depth.Add(-1)
+				<-semaphore
+			}()
 			c.Next()
 		default:
+			if probe && runInReservedSlot(c, m, reserved) {
+				return
+			}
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, "Too many concurrent requests"))
 			c.Abort()
 		}
@@ -221,7 +331,7 @@ func ErrorHandler() gin.HandlerFunc {
 
 // isMonitoringEndpoint checks if the path is a monitoring endpoint
 func isMonitoringEndpoint(path string) bool {
-	monitoringPaths := []string{"/health"}
+	monitoringPaths := []string{"/health", "/livez", "/readyz", "/metrics"}
 	for _, monitoringPath := range monitoringPaths {
 		if path == monitoringPath {
 			return true
@@ -230,13 +340,23 @@ func isMonitoringEndpoint(path string) bool {
 	return false
 }
 
+// authKeyContextKey is the gin context key caching a client key that was removed from the
+// request (query string or WebSocket subprotocol) once extracted.
+const authKeyContextKey = "authKey"
+
 // extractAuthKey extracts a auth key.
 func extractAuthKey(c *gin.Context) string {
+	// 查询参数和 WebSocket 子协议中的密钥提取后会被移除，缓存结果供后续中间件复用
+	if key := c.GetString(authKeyContextKey); key != "" {
+		return key
+	}
+
 	// Query key
 	if key := c.Query("key"); key != "" {
 		query := c.Request.URL.Query()
 		query.Del("key")
 		c.Request.URL.RawQuery = query.Encode()
+		c.Set(authKeyContextKey, key)
 		return key
 	}
 
@@ -259,6 +379,12 @@ func extractAuthKey(c *gin.Context) string {
 		return key
 	}
 
+	// WebSocket subprotocol
+	if key := extractWebSocketKey(c); key != "" {
+		c.Set(authKeyContextKey, key)
+		return key
+	}
+
 	return ""
 }
 
@@ -276,6 +402,20 @@ func StaticCache() gin.HandlerFunc {
 	}
 }
 
+// UIVersionMismatchHeader tells the UI that it is older or newer than the backend serving it.
+const UIVersionMismatchHeader = "X-GPT-Load-UI-Version-Mismatch"
+
+// UIVersionMismatch adds the mismatch header to the UI and admin API responses, so that the
+// UI can show a banner. Proxy responses are left untouched.
+func UIVersionMismatch(value string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.Request.URL.Path, "/proxy/") {
+			c.Header(UIVersionMismatchHeader, value)
+		}
+		c.Next()
+	}
+}
+
 // isStaticResource 判断是否为静态资源
 func isStaticResource(path string) bool {
 	staticPrefixes := []string{"/assets/"}
@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoggerSelectionInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	logger := logrus.StandardLogger()
+	output, formatter, level := logger.Out, logger.Formatter, logger.GetLevel()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+	logger.SetLevel(logrus.InfoLevel)
+	t.Cleanup(func() {
+		logger.SetOutput(output)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(level)
+	})
+
+	selected := map[string]any{"groupName": "openai", "keyIndex": uint(7), "keyPreview": "sk-a****wxyz", "retryCount": 2}
+	tests := []struct {
+		name             string
+		includeSelection bool
+		context          map[string]any
+		status           int
+		want             []string
+		notWant          []string
+	}{
+		{
+			name:             "selection logged",
+			includeSelection: true,
+			context:          selected,
+			status:           http.StatusOK,
+			want:             []string{"Group[openai]", "Key[7] sk-a****wxyz", "Retry[2]", "level=info"},
+		},
+		{
+			name:             "selection disabled",
+			includeSelection: false,
+			context:          selected,
+			status:           http.StatusOK,
+			notWant:          []string{"Group[", "Key[", "Retry["},
+		},
+		{
+			name:             "no key selected",
+			includeSelection: true,
+			context:          map[string]any{"groupName": "openai"},
+			status:           http.StatusServiceUnavailable,
+			want:             []string{"Group[openai]", "level=error"},
+			notWant:          []string{"Key[", "Retry["},
+		},
+		{
+			name:             "upstream request id logged without selection",
+			includeSelection: false,
+			context:          map[string]any{UpstreamRequestIDContextKey: "req_123"},
+			status:           http.StatusTooManyRequests,
+			want:             []string{"UpstreamRequestID[req_123]", "level=warning"},
+			notWant:          []string{"Group["},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			router := gin.New()
+			router.Use(Logger(types.LogConfig{IncludeSelection: tt.includeSelection}))
+			router.POST("/proxy/openai/v1/chat/completions", func(c *gin.Context) {
+				for key, value := range tt.context {
+					c.Set(key, value)
+				}
+				c.Status(tt.status)
+			})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/proxy/openai/v1/chat/completions", nil))
+
+			line := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(line, want) {
+					t.Errorf("access log %q does not contain %q", line, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(line, notWant) {
+					t.Errorf("access log %q contains %q", line, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultGroupFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	settings := types.SystemSettings{
+		DefaultGroup:             "openai",
+		DefaultGroupOverridesMap: map[string]string{"sk-team-a": "azure"},
+	}
+	tests := []struct {
+		name     string
+		settings types.SystemSettings
+		header   string
+		value    string
+		query    string
+		want     string
+	}{
+		{name: "global default", settings: settings, header: "Authorization", value: "Bearer sk-other", want: "openai"},
+		{name: "override by bearer token", settings: settings, header: "Authorization", value: "Bearer sk-team-a", want: "azure"},
+		{name: "override by x-api-key", settings: settings, header: "X-Api-Key", value: "sk-team-a", want: "azure"},
+		{name: "override by query key", settings: settings, query: "?key=sk-team-a", want: "azure"},
+		{name: "no key uses default", settings: settings, want: "openai"},
+		{name: "no default configured", settings: types.SystemSettings{}, header: "Authorization", value: "Bearer sk-team-a", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions"+tt.query, nil)
+			if tt.header != "" {
+				c.Request.Header.Set(tt.header, tt.value)
+			}
+			if got := defaultGroupFor(tt.settings, extractAuthKey(c)); got != tt.want {
+				t.Errorf("defaultGroupFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUIVersionMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const mismatch = "ui=0.0.1; backend=1.0.0"
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "ui page", path: "/", want: mismatch},
+		{name: "admin api", path: "/api/groups", want: mismatch},
+		{name: "proxy request", path: "/proxy/openai/v1/chat/completions", want: ""},
+	}
+
+	router := gin.New()
+	router.Use(UIVersionMismatch(mismatch))
+	router.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := w.Header().Get(UIVersionMismatchHeader); got != tt.want {
+				t.Errorf("%s = %q, want %q", UIVersionMismatchHeader, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthPerKeyIPAllowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	office, _ := utils.ParseIPAllowlist([]string{"10.0.0.0/8"})
+	authConfig := types.AuthConfig{
+		Keys: []string{"admin-key-office", "admin-key-anywhere"},
+		Entries: []types.AuthKeyEntry{
+			{Key: "admin-key-office", AllowedIPs: []string{"10.0.0.0/8"}, AllowedNets: office},
+			{Key: "admin-key-anywhere"},
+		},
+	}
+	router := gin.New()
+	router.Use(Auth(authConfig))
+	router.GET("/api/groups", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		key        string
+		remoteAddr string
+		wantStatus int
+	}{
+		{name: "restricted key from allowed network", key: "admin-key-office", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "restricted key from elsewhere", key: "admin-key-office", remoteAddr: "192.0.2.10:1234", wantStatus: http.StatusForbidden},
+		{name: "unrestricted key from elsewhere", key: "admin-key-anywhere", remoteAddr: "192.0.2.10:1234", wantStatus: http.StatusOK},
+		{name: "invalid key", key: "admin-key-unknown", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/groups", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(w.Body.String(), "ip_not_allowed") {
+				t.Errorf("body = %s, want ip_not_allowed", w.Body.String())
+			}
+		})
+	}
+}
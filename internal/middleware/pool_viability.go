@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PoolViability rejects new proxy requests with 503 while the key pool is in degraded mode.
+// Requests already past this middleware keep being served.
+func PoolViability(checker *keypool.PoolViabilityChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checker.IsDegraded() {
+			response.Error(c, app_errors.ErrPoolDegraded)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
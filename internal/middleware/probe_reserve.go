@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"strings"
+
+	"gpt-load/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probeRoutes are the routes of internal probe and test traffic that may use the reserved
+// slots: health and readiness checks, metrics and key tests, which monitoring relies on during saturation.
+var probeRoutes = map[string]bool{
+	"/health":                          true,
+	"/livez":                           true,
+	"/readyz":                          true,
+	"/metrics":                         true,
+	"/api/groups/:id/upstreams/health": true,
+	"/api/keys/test-multiple":          true,
+	"/api/keys/validate-group":         true,
+}
+
+// isProbeRequest reports whether the request belongs to the probe and test traffic class.
+// Proxy requests never do, whatever their priority.
+func isProbeRequest(c *gin.Context) bool {
+	if strings.HasPrefix(c.Request.URL.Path, "/proxy/") {
+		return false
+	}
+	return probeRoutes[c.FullPath()]
+}
+
+// runInReservedSlot runs a probe request in a reserved slot, reporting false when all of
+// them are in use.
+func runInReservedSlot(c *gin.Context, m *metrics.Metrics, reserved chan struct{}) bool {
+	select {
+	case reserved <- struct{}{}:
+	default:
+		return false
+	}
+	m.ReservedSlotsInUse.Inc()
+	m.ReservedProbeRequests.Inc()
+	defer func() {
+		m.ReservedSlotsInUse.Dec()
+		<-reserved
+	}()
+	c.Next()
+	return true
+}
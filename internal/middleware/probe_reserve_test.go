@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRateLimiterReservedProbeSlots(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		reservedSlots int
+		holdProbe     bool // 预留槽位已被一个探测请求占用
+		method        string
+		path          string
+		wantStatus    int
+	}{
+		{name: "proxy request", reservedSlots: 1, method: http.MethodPost, path: "/proxy/openai/v1/chat/completions", wantStatus: http.StatusInternalServerError},
+		{name: "admin request", reservedSlots: 1, method: http.MethodGet, path: "/api/groups", wantStatus: http.StatusInternalServerError},
+		{name: "health check", reservedSlots: 1, method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+		{name: "metrics", reservedSlots: 1, method: http.MethodGet, path: "/metrics", wantStatus: http.StatusOK},
+		{name: "key test", reservedSlots: 1, method: http.MethodPost, path: "/api/keys/test-multiple", wantStatus: http.StatusOK},
+		{name: "upstream health", reservedSlots: 1, method: http.MethodGet, path: "/api/groups/1/upstreams/health", wantStatus: http.StatusOK},
+		{name: "reserved slots in use", reservedSlots: 1, holdProbe: true, method: http.MethodGet, path: "/health", wantStatus: http.StatusInternalServerError},
+		{name: "no reserved slots", reservedSlots: 0, method: http.MethodGet, path: "/health", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			started := make(chan struct{}, 2)
+			handler := func(c *gin.Context) {
+				if c.GetHeader("X-Block") != "" {
+					started <- struct{}{}
+					<-release
+				}
+				c.Status(http.StatusOK)
+			}
+
+			router := gin.New()
+			router.Use(RateLimiter(types.PerformanceConfig{MaxConcurrentRequests: 1, ReservedProbeSlots: tt.reservedSlots}, metrics.NewMetrics(prometheus.NewRegistry())))
+			router.Any("/proxy/:group_name/*path", handler)
+			router.GET("/api/groups", handler)
+			router.GET("/health", handler)
+			router.GET("/metrics", handler)
+			router.POST("/api/keys/test-multiple", handler)
+			router.GET("/api/groups/:id/upstreams/health", handler)
+
+			var wg sync.WaitGroup
+			hold := func(method, path string) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req := httptest.NewRequest(method, path, nil)
+					req.Header.Set("X-Block", "1")
+					router.ServeHTTP(httptest.NewRecorder(), req)
+				}()
+				<-started
+			}
+			defer func() {
+				close(release)
+				wg.Wait()
+			}()
+
+			// 占满并发上限
+			hold(http.MethodPost, "/proxy/openai/v1/chat/completions")
+			if tt.holdProbe {
+				hold(http.MethodGet, "/metrics")
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body: %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/services"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// ChannelTypeContextKey is the gin context key under which the proxy handler records the
+// channel type of the group that served the request.
+const ChannelTypeContextKey = "channelType"
+
+// ProxyMetrics holds the Prometheus collectors of proxy traffic, per group and channel type.
+// Per-request metrics are recorded once by its Middleware around the proxy handler.
+type ProxyMetrics struct {
+	groupManager  *services.GroupManager
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	retries       *prometheus.CounterVec
+	activeStreams *prometheus.GaugeVec
+}
+
+// NewProxyMetrics creates the proxy traffic collectors and registers them with registerer,
+// which the container provides as the default Prometheus registerer.
+func NewProxyMetrics(configManager types.ConfigManager, groupManager *services.GroupManager, registerer prometheus.Registerer) *ProxyMetrics {
+	m := &ProxyMetrics{
+		groupManager: groupManager,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_proxy_requests_total",
+			Help: "Number of proxy requests, by group, channel type and final status code.",
+		}, []string{"group", "channel_type", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gptload_proxy_request_duration_seconds",
+			Help:    "Time to serve a proxy request including retries, by group and channel type.",
+			Buckets: configManager.GetMetricsConfig().LatencyBuckets,
+		}, []string{"group", "channel_type"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gptload_proxy_retries_total",
+			Help: "Number of upstream retries made for proxy requests, by group and channel type.",
+		}, []string{"group", "channel_type"}),
+		activeStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gptload_proxy_active_streams",
+			Help: "Number of streaming responses currently being relayed, by group and channel type.",
+		}, []string{"group", "channel_type"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.requests, m.duration, m.retries, m.activeStreams} {
+		if err := registerer.Register(c); err != nil {
+			logrus.Warnf("Failed to register proxy traffic metrics: %v", err)
+		}
+	}
+	return m
+}
+
+// Middleware records the count, status code, duration and retries of each proxy request.
+// Requests rejected by a middleware before the proxy handler are attributed to the group in
+// the route, and counted under an empty group when that group does not exist.
+func (m *ProxyMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		group, channelType := m.requestGroup(c)
+		m.requests.WithLabelValues(group, channelType, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(group, channelType).Observe(time.Since(start).Seconds())
+		if retries := c.GetInt("retryCount"); retries > 0 {
+			m.retries.WithLabelValues(group, channelType).Add(float64(retries))
+		}
+	}
+}
+
+// requestGroup 返回请求所属分组及其渠道类型。只使用已存在的分组名作为标签，避免任意路径撑大指标基数
+func (m *ProxyMetrics) requestGroup(c *gin.Context) (string, string) {
+	if group := c.GetString("groupName"); group != "" {
+		return group, c.GetString(ChannelTypeContextKey)
+	}
+	if group, err := m.groupManager.GetGroupByName(c.Param("group_name")); err == nil {
+		return group.Name, group.ChannelType
+	}
+	return "", ""
+}
+
+// TrackStream counts a streaming response as active until the returned function is called.
+func (m *ProxyMetrics) TrackStream(group, channelType string) (done func()) {
+	gauge := m.activeStreams.WithLabelValues(group, channelType)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// MetricsAuth protects the metrics endpoint with METRICS_AUTH, or any AUTH_KEY when it is not set.
+// With METRICS_ALLOWED_IPS other sources are rejected, and allowed sources need no token unless
+// METRICS_AUTH is set. The configuration is read on every request, so it follows reloads.
+func MetricsAuth(configManager types.ConfigManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		metricsConfig := configManager.GetMetricsConfig()
+		// 配置校验时已确认列表合法
+		if allowedIPs, _ := utils.ParseIPAllowlist(metricsConfig.AllowedIPs); len(allowedIPs) > 0 {
+			if !utils.IPInAllowlist(c.ClientIP(), allowedIPs) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "ip_not_allowed"})
+				return
+			}
+			if metricsConfig.Auth == "" {
+				c.Next()
+				return
+			}
+		}
+
+		tokens := configManager.GetAuthConfig().Keys
+		if token := metricsConfig.Auth; token != "" {
+			tokens = []string{token}
+		}
+
+		if !utils.MatchesAnyKey(extractAuthKey(c), tokens) {
+			abortUnauthorized(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		auth       string
+		allowedIPs []string
+		remoteAddr string
+		token      string
+		wantStatus int
+	}{
+		{name: "auth key accepted", remoteAddr: "203.0.113.9:1234", token: "admin-key", wantStatus: http.StatusOK},
+		{name: "auth key required", remoteAddr: "203.0.113.9:1234", wantStatus: http.StatusUnauthorized},
+		{name: "metrics token accepted", auth: "metrics-token", remoteAddr: "203.0.113.9:1234", token: "metrics-token", wantStatus: http.StatusOK},
+		{name: "auth key rejected with metrics token", auth: "metrics-token", remoteAddr: "203.0.113.9:1234", token: "admin-key", wantStatus: http.StatusUnauthorized},
+		{name: "allowed ip without token", allowedIPs: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "allowed single ip", allowedIPs: []string{"10.1.2.3"}, remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "ip not allowed", allowedIPs: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.9:1234", token: "admin-key", wantStatus: http.StatusForbidden},
+		{name: "allowed ip still needs metrics token", auth: "metrics-token", allowedIPs: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusUnauthorized},
+		{name: "allowed ip with metrics token", auth: "metrics-token", allowedIPs: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:1234", token: "metrics-token", wantStatus: http.StatusOK},
+		{name: "ip not allowed with metrics token", auth: "metrics-token", allowedIPs: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.9:1234", token: "metrics-token", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configManager := &stubConfigManager{
+				auth:    types.AuthConfig{Keys: []string{"admin-key"}},
+				metrics: types.MetricsConfig{Auth: tt.auth, AllowedIPs: tt.allowedIPs},
+			}
+			engine := gin.New()
+			engine.GET("/metrics", MetricsAuth(configManager), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/config"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	nonceHeader         = "X-Nonce"
+	nonceTTLHeader      = "X-Idempotency-TTL"
+	nonceKeyPrefix      = "nonce:"
+	maxNonceHeaderBytes = 128
+)
+
+// ReplayProtection rejects proxy requests whose X-Nonce was already used within the TTL window.
+// It only applies to groups where the replay_protection feature flag is enabled, since clients
+// must send a fresh nonce with every request. It runs after ProxyAuth.
+func ReplayProtection(s store.Store, featureFlags *config.FeatureFlagManager, gm *services.GroupManager, proxyConfig types.ProxyConfig) gin.HandlerFunc {
+	defaultTTL := time.Duration(proxyConfig.NonceTTLSeconds) * time.Second
+	maxTTL := time.Duration(proxyConfig.NonceMaxTTLSeconds) * time.Second
+
+	return func(c *gin.Context) {
+		group, err := gm.GetGroupByName(c.Param("group_name"))
+		if err != nil || !featureFlags.IsEnabled(config.FlagReplayProtection, group.ID) {
+			c.Next()
+			return
+		}
+
+		if verifyNonce(c, s, defaultTTL, maxTTL) {
+			c.Next()
+		}
+	}
+}
+
+// verifyNonce records the request's X-Nonce for the TTL window and removes the nonce headers so
+// they are not forwarded upstream. A missing or reused nonce aborts the request.
+func verifyNonce(c *gin.Context, s store.Store, defaultTTL, maxTTL time.Duration) bool {
+	nonce := c.GetHeader(nonceHeader)
+	if nonce == "" || len(nonce) > maxNonceHeaderBytes {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "A unique X-Nonce header (at most 128 bytes) is required"))
+		c.Abort()
+		return false
+	}
+
+	ttl := nonceTTL(c.GetHeader(nonceTTLHeader), defaultTTL, maxTTL)
+	fresh, err := s.SetNX(nonceKeyPrefix+nonce, []byte("1"), ttl)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to record request nonce")
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, "Failed to verify request nonce"))
+		c.Abort()
+		return false
+	}
+	if !fresh {
+		response.Error(c, app_errors.ErrNonceReused)
+		c.Abort()
+		return false
+	}
+
+	// nonce 仅供网关校验，不转发到上游
+	c.Request.Header.Del(nonceHeader)
+	c.Request.Header.Del(nonceTTLHeader)
+	return true
+}
+
+// nonceTTL returns the dedup window requested in seconds by X-Idempotency-TTL. Values above the
+// maximum are clamped to it; a missing, malformed or non-positive value uses the default.
+func nonceTTL(header string, defaultTTL, maxTTL time.Duration) time.Duration {
+	header = strings.TrimSpace(header)
+	seconds, err := strconv.ParseInt(header, 10, 64)
+	if errors.Is(err, strconv.ErrRange) && !strings.HasPrefix(header, "-") {
+		return maxTTL
+	}
+	if err != nil || seconds < 1 {
+		return defaultTTL
+	}
+	// 先按秒比较，避免换算为 Duration 时溢出
+	if seconds >= int64(maxTTL/time.Second) {
+		return maxTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
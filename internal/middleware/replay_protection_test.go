@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerifyNonce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const defaultTTL, maxTTL = 5 * time.Minute, time.Hour
+	type step struct {
+		nonce      string
+		ttl        string        // X-Idempotency-TTL 请求头
+		advance    time.Duration // 发送请求前推进的时间
+		wantStatus int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{name: "fresh nonce", steps: []step{{nonce: "n-1", wantStatus: http.StatusOK}}},
+		{name: "missing nonce", steps: []step{{nonce: "", wantStatus: http.StatusBadRequest}}},
+		{name: "oversized nonce", steps: []step{{nonce: strings.Repeat("n", maxNonceHeaderBytes+1), wantStatus: http.StatusBadRequest}}},
+		{name: "nonce at size limit", steps: []step{{nonce: strings.Repeat("n", maxNonceHeaderBytes), wantStatus: http.StatusOK}}},
+		{
+			name: "reused within window",
+			steps: []step{
+				{nonce: "n-1", wantStatus: http.StatusOK},
+				{nonce: "n-1", advance: defaultTTL - time.Second, wantStatus: http.StatusConflict},
+			},
+		},
+		{
+			name: "reusable after window",
+			steps: []step{
+				{nonce: "n-1", wantStatus: http.StatusOK},
+				{nonce: "n-1", advance: defaultTTL, wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "client window extends dedup",
+			steps: []step{
+				{nonce: "n-1", ttl: "1800", wantStatus: http.StatusOK},
+				{nonce: "n-1", advance: 30*time.Minute - time.Second, wantStatus: http.StatusConflict},
+			},
+		},
+		{
+			name: "client window shortens dedup",
+			steps: []step{
+				{nonce: "n-1", ttl: "10", wantStatus: http.StatusOK},
+				{nonce: "n-1", advance: 10 * time.Second, wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "client window clamped to maximum",
+			steps: []step{
+				{nonce: "n-1", ttl: "86400", wantStatus: http.StatusOK},
+				{nonce: "n-1", advance: maxTTL, wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "distinct nonces",
+			steps: []step{
+				{nonce: "n-1", wantStatus: http.StatusOK},
+				{nonce: "n-2", wantStatus: http.StatusOK},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			s := store.NewMemoryStore(clk)
+			var forwarded http.Header
+			router := gin.New()
+			router.POST("/proxy/test/v1/chat/completions", func(c *gin.Context) {
+				if verifyNonce(c, s, defaultTTL, maxTTL) {
+					forwarded = c.Request.Header.Clone()
+					c.Status(http.StatusOK)
+				}
+			})
+
+			for i, step := range tt.steps {
+				clk.Advance(step.advance)
+				forwarded = nil
+				req := httptest.NewRequest(http.MethodPost, "/proxy/test/v1/chat/completions", nil)
+				if step.nonce != "" {
+					req.Header.Set(nonceHeader, step.nonce)
+				}
+				req.Header.Set(nonceTTLHeader, step.ttl)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != step.wantStatus {
+					t.Fatalf("step %d: status = %d, want %d (body: %s)", i, w.Code, step.wantStatus, w.Body.String())
+				}
+				if forwarded != nil && (forwarded.Get(nonceHeader) != "" || len(forwarded.Values(nonceTTLHeader)) > 0) {
+					t.Errorf("step %d: nonce headers were not removed: %v", i, forwarded)
+				}
+			}
+		})
+	}
+}
+
+func TestNonceTTL(t *testing.T) {
+	const defaultTTL, maxTTL = 5 * time.Minute, time.Hour
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "missing", header: "", want: defaultTTL},
+		{name: "seconds", header: "30", want: 30 * time.Second},
+		{name: "surrounding spaces", header: " 30 ", want: 30 * time.Second},
+		{name: "at maximum", header: "3600", want: maxTTL},
+		{name: "above maximum", header: "3601", want: maxTTL},
+		{name: "overflows duration", header: "9223372036854775807", want: maxTTL},
+		{name: "overflows int64", header: "99999999999999999999", want: maxTTL},
+		{name: "zero", header: "0", want: defaultTTL},
+		{name: "negative", header: "-30", want: defaultTTL},
+		{name: "negative overflow", header: "-99999999999999999999", want: defaultTTL},
+		{name: "fraction", header: "1.5", want: defaultTTL},
+		{name: "duration syntax", header: "30s", want: defaultTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nonceTTL(tt.header, defaultTTL, maxTTL); got != tt.want {
+				t.Errorf("nonceTTL(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// websocketKeyProtocolPrefix marks the Sec-WebSocket-Protocol entry that carries the client key,
+// following the OpenAI Realtime convention for browser clients, which cannot set headers on a
+// WebSocket handshake.
+const websocketKeyProtocolPrefix = "openai-insecure-api-key."
+
+// isWebSocketUpgrade reports whether the request is a WebSocket handshake.
+func isWebSocketUpgrade(c *gin.Context) bool {
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range c.Request.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extractWebSocketKey takes the client key from the subprotocols of a WebSocket handshake.
+// The key entry is removed from the header so it is neither forwarded upstream nor
+// negotiated back to the client.
+func extractWebSocketKey(c *gin.Context) string {
+	if !isWebSocketUpgrade(c) {
+		return ""
+	}
+
+	var key string
+	var protocols []string
+	for _, value := range c.Request.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if candidate, ok := strings.CutPrefix(protocol, websocketKeyProtocolPrefix); ok {
+				if key == "" {
+					key = candidate
+				}
+				continue
+			}
+			if protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	if key == "" {
+		return ""
+	}
+
+	c.Request.Header.Del("Sec-WebSocket-Protocol")
+	if len(protocols) > 0 {
+		c.Request.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+	return key
+}
+
+// abortUnauthorized rejects the request with 401. For a WebSocket handshake this happens before
+// any upgrade, and the connection is closed so the client does not reuse a half-negotiated one.
+func abortUnauthorized(c *gin.Context) {
+	if isWebSocketUpgrade(c) {
+		c.Header("Connection", "close")
+	}
+	response.Error(c, app_errors.ErrUnauthorized)
+	c.Abort()
+}
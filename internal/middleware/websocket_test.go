@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExtractWebSocketKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upgrade := map[string]string{"Upgrade": "websocket", "Connection": "Upgrade"}
+	with := func(headers map[string]string, extra map[string]string) map[string]string {
+		merged := make(map[string]string, len(headers)+len(extra))
+		for k, v := range headers {
+			merged[k] = v
+		}
+		for k, v := range extra {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	tests := []struct {
+		name          string
+		headers       map[string]string
+		wantKey       string
+		wantProtocols string
+	}{
+		{
+			name:          "key and realtime protocol",
+			headers:       with(upgrade, map[string]string{"Sec-WebSocket-Protocol": "realtime, openai-insecure-api-key.sk-abc"}),
+			wantKey:       "sk-abc",
+			wantProtocols: "realtime",
+		},
+		{
+			name:          "key only",
+			headers:       with(upgrade, map[string]string{"Sec-WebSocket-Protocol": "openai-insecure-api-key.sk-abc"}),
+			wantKey:       "sk-abc",
+			wantProtocols: "",
+		},
+		{
+			name:          "first key wins and every key entry is removed",
+			headers:       with(upgrade, map[string]string{"Sec-WebSocket-Protocol": "openai-insecure-api-key.sk-1, realtime, openai-insecure-api-key.sk-2"}),
+			wantKey:       "sk-1",
+			wantProtocols: "realtime",
+		},
+		{
+			name:          "connection header with several tokens",
+			headers:       map[string]string{"Upgrade": "WebSocket", "Connection": "keep-alive, Upgrade", "Sec-WebSocket-Protocol": "openai-insecure-api-key.sk-abc"},
+			wantKey:       "sk-abc",
+			wantProtocols: "",
+		},
+		{
+			name:          "no key protocol",
+			headers:       with(upgrade, map[string]string{"Sec-WebSocket-Protocol": "realtime"}),
+			wantProtocols: "realtime",
+		},
+		{
+			name:          "not an upgrade",
+			headers:       map[string]string{"Sec-WebSocket-Protocol": "openai-insecure-api-key.sk-abc"},
+			wantProtocols: "openai-insecure-api-key.sk-abc",
+		},
+		{
+			name:          "upgrade without connection upgrade",
+			headers:       map[string]string{"Upgrade": "websocket", "Connection": "keep-alive", "Sec-WebSocket-Protocol": "openai-insecure-api-key.sk-abc"},
+			wantProtocols: "openai-insecure-api-key.sk-abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/proxy/openai/v1/realtime", nil)
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+
+			if key := extractWebSocketKey(c); key != tt.wantKey {
+				t.Errorf("extractWebSocketKey() = %q, want %q", key, tt.wantKey)
+			}
+			if protocols := c.Request.Header.Get("Sec-WebSocket-Protocol"); protocols != tt.wantProtocols {
+				t.Errorf("Sec-WebSocket-Protocol = %q, want %q", protocols, tt.wantProtocols)
+			}
+		})
+	}
+}
+
+func TestAbortUnauthorizedClosesWebSocketHandshake(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		websocket     bool
+		wantConnClose bool
+	}{
+		{name: "websocket handshake", websocket: true, wantConnClose: true},
+		{name: "plain request", websocket: false, wantConnClose: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/proxy/openai/v1/realtime", nil)
+			if tt.websocket {
+				c.Request.Header.Set("Upgrade", "websocket")
+				c.Request.Header.Set("Connection", "Upgrade")
+			}
+
+			abortUnauthorized(c)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if got := w.Header().Get("Connection") == "close"; got != tt.wantConnClose {
+				t.Errorf("Connection: close = %v, want %v", got, tt.wantConnClose)
+			}
+			if !c.IsAborted() {
+				t.Error("request was not aborted")
+			}
+		})
+	}
+}
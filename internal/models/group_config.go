@@ -0,0 +1,456 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+)
+
+// TimeoutConfig 分组的超时配置
+type TimeoutConfig struct {
+	RequestTimeout        *int `json:"request_timeout,omitempty"`
+	IdleConnTimeout       *int `json:"idle_conn_timeout,omitempty"`
+	ConnectTimeout        *int `json:"connect_timeout,omitempty"`
+	ResponseHeaderTimeout *int `json:"response_header_timeout,omitempty"`
+}
+
+// Validate checks the timeout overrides.
+func (c TimeoutConfig) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "request_timeout", c.RequestTimeout, 1)
+	validateMin(&errs, "idle_conn_timeout", c.IdleConnTimeout, 1)
+	validateMin(&errs, "connect_timeout", c.ConnectTimeout, 1)
+	validateMin(&errs, "response_header_timeout", c.ResponseHeaderTimeout, 1)
+	return errs
+}
+
+// ConnectionConfig 分组的上游连接池配置
+type ConnectionConfig struct {
+	MaxIdleConns        *int    `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost *int    `json:"max_idle_conns_per_host,omitempty"`
+	ProxyURL            *string `json:"proxy_url,omitempty"`
+}
+
+// Validate checks the connection overrides.
+func (c ConnectionConfig) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "max_idle_conns", c.MaxIdleConns, 1)
+	validateMin(&errs, "max_idle_conns_per_host", c.MaxIdleConnsPerHost, 1)
+	if c.ProxyURL != nil && *c.ProxyURL != "" {
+		u, err := url.Parse(*c.ProxyURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs.Add("proxy_url", "must be a valid URL such as http://host:port")
+		}
+	}
+	return errs
+}
+
+// RetryPolicy 分组的重试与拉黑策略
+type RetryPolicy struct {
+	MaxRetries                   *int    `json:"max_retries,omitempty"`
+	RetryBackoffMs               *int    `json:"retry_backoff_ms,omitempty"`
+	BlacklistThreshold           *int    `json:"blacklist_threshold,omitempty"`
+	RetriesRequireIdempotencyKey *bool   `json:"retries_require_idempotency_key,omitempty"`
+	RetryBackoffMaxMs            *int    `json:"retry_backoff_max_ms,omitempty"`
+	RetryStatusCodes             *string `json:"retry_status_codes,omitempty"`
+	RetryMaxBodyBytes            *int    `json:"retry_max_body_bytes,omitempty"`
+}
+
+// Validate checks the retry overrides.
+func (c RetryPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "max_retries", c.MaxRetries, 0)
+	validateMin(&errs, "retry_backoff_ms", c.RetryBackoffMs, 0)
+	validateMin(&errs, "blacklist_threshold", c.BlacklistThreshold, 0)
+	validateMin(&errs, "retry_backoff_max_ms", c.RetryBackoffMaxMs, 0)
+	validateMin(&errs, "retry_max_body_bytes", c.RetryMaxBodyBytes, 0)
+	if c.RetryStatusCodes != nil {
+		if _, err := ParseRetryStatusCodes(*c.RetryStatusCodes); err != nil {
+			errs.Add("retry_status_codes", err.Error())
+		}
+	}
+	return errs
+}
+
+// ParseRetryStatusCodes parses a comma-separated list of HTTP error status codes.
+func ParseRetryStatusCodes(s string) ([]int, error) {
+	var codes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 400 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q, must be between 400 and 599", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// KeyValidationConfig 分组的密钥后台验证配置
+type KeyValidationConfig struct {
+	KeyValidationIntervalMinutes *int `json:"key_validation_interval_minutes,omitempty"`
+	KeyValidationConcurrency     *int `json:"key_validation_concurrency,omitempty"`
+	KeyValidationTimeoutSeconds  *int `json:"key_validation_timeout_seconds,omitempty"`
+
+	KeyHealthCheckIntervalMinutes  *int `json:"key_health_check_interval_minutes,omitempty"`
+	KeyHealthCheckFailureThreshold *int `json:"key_health_check_failure_threshold,omitempty"`
+}
+
+// Validate checks the key validation overrides.
+func (c KeyValidationConfig) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "key_validation_interval_minutes", c.KeyValidationIntervalMinutes, 1)
+	validateMin(&errs, "key_validation_concurrency", c.KeyValidationConcurrency, 1)
+	validateMin(&errs, "key_validation_timeout_seconds", c.KeyValidationTimeoutSeconds, 1)
+	validateMin(&errs, "key_health_check_interval_minutes", c.KeyHealthCheckIntervalMinutes, 0)
+	validateMin(&errs, "key_health_check_failure_threshold", c.KeyHealthCheckFailureThreshold, 1)
+	return errs
+}
+
+// LoggingConfig 分组的请求日志配置
+type LoggingConfig struct {
+	EnableRequestBodyLogging *bool `json:"enable_request_body_logging,omitempty"`
+}
+
+// Validate checks the logging overrides.
+func (c LoggingConfig) Validate() app_errors.ValidationErrors {
+	return nil
+}
+
+// 未知查询参数的处理方式
+const (
+	QueryParamModePassthrough = "passthrough"
+	QueryParamModeStrip       = "strip"
+	QueryParamModeReject      = "reject"
+)
+
+// QueryParamPolicy 分组的代理查询参数过滤配置
+type QueryParamPolicy struct {
+	UnknownQueryParams *string `json:"unknown_query_params,omitempty"`
+	AllowedQueryParams *string `json:"allowed_query_params,omitempty"`
+}
+
+// Validate checks the query parameter overrides.
+func (c QueryParamPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	if c.UnknownQueryParams != nil {
+		switch *c.UnknownQueryParams {
+		case QueryParamModePassthrough, QueryParamModeStrip, QueryParamModeReject:
+		default:
+			errs.Add("unknown_query_params", fmt.Sprintf("must be one of: %s, %s, %s", QueryParamModePassthrough, QueryParamModeStrip, QueryParamModeReject))
+		}
+	}
+	return errs
+}
+
+// OpenAI 格式请求中无法转换到目标渠道的参数的处理方式
+const (
+	UnsupportedParamModeDropSilently = "drop_silently"
+	UnsupportedParamModeWarnHeader   = "warn_header"
+	UnsupportedParamModeReject       = "reject"
+)
+
+// ParamCompatPolicy 分组的 OpenAI 请求参数兼容配置
+type ParamCompatPolicy struct {
+	UnsupportedParams *string `json:"unsupported_params,omitempty"`
+}
+
+// Validate checks the parameter compatibility overrides.
+func (c ParamCompatPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	if c.UnsupportedParams != nil {
+		switch *c.UnsupportedParams {
+		case UnsupportedParamModeDropSilently, UnsupportedParamModeWarnHeader, UnsupportedParamModeReject:
+		default:
+			errs.Add("unsupported_params", fmt.Sprintf("must be one of: %s, %s, %s", UnsupportedParamModeDropSilently, UnsupportedParamModeWarnHeader, UnsupportedParamModeReject))
+		}
+	}
+	return errs
+}
+
+// EmbeddingsPolicy 分组的 embeddings 请求限制与自动拆分配置
+type EmbeddingsPolicy struct {
+	EmbeddingsMaxInputs         *int    `json:"embeddings_max_inputs,omitempty"`
+	EmbeddingsMaxInputChars     *int    `json:"embeddings_max_input_chars,omitempty"`
+	EmbeddingsAllowedDimensions *string `json:"embeddings_allowed_dimensions,omitempty"`
+	EmbeddingsAutoSplit         *bool   `json:"embeddings_auto_split,omitempty"`
+	EmbeddingsMaxSubRequests    *int    `json:"embeddings_max_sub_requests,omitempty"`
+}
+
+// Validate checks the embeddings overrides.
+func (c EmbeddingsPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "embeddings_max_inputs", c.EmbeddingsMaxInputs, 0)
+	validateMin(&errs, "embeddings_max_input_chars", c.EmbeddingsMaxInputChars, 0)
+	validateMin(&errs, "embeddings_max_sub_requests", c.EmbeddingsMaxSubRequests, 1)
+	if c.EmbeddingsAllowedDimensions != nil {
+		if _, err := ParseEmbeddingDimensions(*c.EmbeddingsAllowedDimensions); err != nil {
+			errs.Add("embeddings_allowed_dimensions", err.Error())
+		}
+	}
+	return errs
+}
+
+// ParseEmbeddingDimensions parses a comma-separated list of allowed embedding dimensions.
+func ParseEmbeddingDimensions(s string) ([]int, error) {
+	var dimensions []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid dimension %q, must be a positive integer", part)
+		}
+		dimensions = append(dimensions, n)
+	}
+	return dimensions, nil
+}
+
+// RateLimitPolicy 分组的总请求速率限制
+type RateLimitPolicy struct {
+	GroupRateLimitRPM *int `json:"group_rate_limit_rpm,omitempty"`
+}
+
+// Validate checks the rate limit overrides.
+func (c RateLimitPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "group_rate_limit_rpm", c.GroupRateLimitRPM, 0)
+	return errs
+}
+
+// 分组内选择密钥的策略
+const (
+	KeySelectionRoundRobin         = "round-robin"
+	KeySelectionWeightedRoundRobin = "weighted-round-robin"
+)
+
+// KeySelectionPolicy 分组的密钥选择策略
+type KeySelectionPolicy struct {
+	KeySelectionStrategy *string `json:"key_selection_strategy,omitempty"`
+}
+
+// Validate checks the key selection overrides.
+func (c KeySelectionPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	if c.KeySelectionStrategy != nil {
+		switch *c.KeySelectionStrategy {
+		case KeySelectionRoundRobin, KeySelectionWeightedRoundRobin:
+		default:
+			errs.Add("key_selection_strategy", fmt.Sprintf("must be one of: %s, %s", KeySelectionRoundRobin, KeySelectionWeightedRoundRobin))
+		}
+	}
+	return errs
+}
+
+// RequestCompressionPolicy 分组的上游请求压缩配置
+type RequestCompressionPolicy struct {
+	RequestCompression         *bool `json:"request_compression,omitempty"`
+	RequestCompressionMinBytes *int  `json:"request_compression_min_bytes,omitempty"`
+}
+
+// Validate checks the request compression overrides.
+func (c RequestCompressionPolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	validateMin(&errs, "request_compression_min_bytes", c.RequestCompressionMinBytes, 0)
+	return errs
+}
+
+// AzurePolicy 分组的 Azure OpenAI 渠道配置
+type AzurePolicy struct {
+	AzureAPIVersion  *string `json:"azure_api_version,omitempty"`
+	AzureDeployments *string `json:"azure_deployments,omitempty"`
+}
+
+// Validate checks the Azure OpenAI overrides.
+func (c AzurePolicy) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	if c.AzureAPIVersion != nil && strings.TrimSpace(*c.AzureAPIVersion) == "" {
+		errs.Add("azure_api_version", "must not be empty")
+	}
+	if c.AzureDeployments != nil {
+		if _, err := ParseAzureDeployments(*c.AzureDeployments); err != nil {
+			errs.Add("azure_deployments", err.Error())
+		}
+	}
+	return errs
+}
+
+// ParseAzureDeployments parses a comma-separated list of model:deployment pairs. Each pair is
+// split at the last colon, so model names may contain colons.
+func ParseAzureDeployments(s string) (map[string]string, error) {
+	deployments := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		idx := strings.LastIndex(part, ":")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid deployment mapping %q, expected model:deployment", part)
+		}
+		model, deployment := strings.TrimSpace(part[:idx]), strings.TrimSpace(part[idx+1:])
+		if model == "" || deployment == "" {
+			return nil, fmt.Errorf("invalid deployment mapping %q, expected model:deployment", part)
+		}
+		deployments[model] = deployment
+	}
+	return deployments, nil
+}
+
+// 请求头规则的操作
+const (
+	HeaderRuleActionSet    = "set"
+	HeaderRuleActionRemove = "remove"
+)
+
+// HeaderRules 分组的请求头改写规则，与其他配置分开存储在 header_rules 字段
+type HeaderRules []HeaderRule
+
+// Validate checks the action of every rule and rejects rules for the same header.
+// Rules without a key are ignored, since they are dropped when saved.
+func (r HeaderRules) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	seen := make(map[string]int)
+	for i, rule := range r {
+		key := strings.TrimSpace(rule.Key)
+		if key == "" {
+			continue
+		}
+		field := strconv.Itoa(i)
+		canonicalKey := http.CanonicalHeaderKey(key)
+		if first, ok := seen[canonicalKey]; ok {
+			errs.Add(field+".key", fmt.Sprintf("duplicate header %s, already set by rule %d", canonicalKey, first))
+		} else {
+			seen[canonicalKey] = i
+		}
+		switch rule.Action {
+		case HeaderRuleActionSet, HeaderRuleActionRemove:
+		default:
+			errs.Add(field+".action", fmt.Sprintf("must be one of: %s, %s", HeaderRuleActionSet, HeaderRuleActionRemove))
+		}
+	}
+	return errs
+}
+
+// GroupConfig 存储特定于分组的配置，按关注点拆分为多个类型化结构。
+// 内嵌结构在 JSON 中保持扁平，与已存储的配置格式兼容。
+type GroupConfig struct {
+	TimeoutConfig
+	ConnectionConfig
+	RetryPolicy
+	KeySelectionPolicy
+	KeyValidationConfig
+	LoggingConfig
+	QueryParamPolicy
+	ParamCompatPolicy
+	EmbeddingsPolicy
+	RateLimitPolicy
+	RequestCompressionPolicy
+	AzurePolicy
+}
+
+// Validate runs the validation of every config concern.
+func (gc GroupConfig) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+	errs = append(errs, gc.TimeoutConfig.Validate()...)
+	errs = append(errs, gc.ConnectionConfig.Validate()...)
+	errs = append(errs, gc.RetryPolicy.Validate()...)
+	errs = append(errs, gc.KeySelectionPolicy.Validate()...)
+	errs = append(errs, gc.KeyValidationConfig.Validate()...)
+	errs = append(errs, gc.LoggingConfig.Validate()...)
+	errs = append(errs, gc.QueryParamPolicy.Validate()...)
+	errs = append(errs, gc.ParamCompatPolicy.Validate()...)
+	errs = append(errs, gc.EmbeddingsPolicy.Validate()...)
+	errs = append(errs, gc.RateLimitPolicy.Validate()...)
+	errs = append(errs, gc.RequestCompressionPolicy.Validate()...)
+	errs = append(errs, gc.AzurePolicy.Validate()...)
+	return errs
+}
+
+// GroupConfigField describes a single overridable group setting.
+type GroupConfigField struct {
+	Key   string
+	Field reflect.StructField
+}
+
+// GroupConfigFields returns the overridable fields of GroupConfig in declaration order.
+func GroupConfigFields() []GroupConfigField {
+	var fields []GroupConfigField
+	for _, f := range reflect.VisibleFields(reflect.TypeOf(GroupConfig{})) {
+		if f.Anonymous {
+			continue
+		}
+		key := strings.Split(f.Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		fields = append(fields, GroupConfigField{Key: key, Field: f})
+	}
+	return fields
+}
+
+// ParseGroupConfig decodes a stored or submitted config map into a GroupConfig.
+// Keys matching no field are returned as unknown instead of failing the decode.
+func ParseGroupConfig(raw map[string]any) (GroupConfig, []string, error) {
+	var gc GroupConfig
+	if len(raw) == 0 {
+		return gc, nil, nil
+	}
+
+	known := make(map[string]bool)
+	for _, f := range GroupConfigFields() {
+		known[f.Key] = true
+	}
+
+	normalized := make(map[string]any, len(raw))
+	var unknown []string
+	for key, value := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+			continue
+		}
+		normalized[key] = value
+	}
+	sort.Strings(unknown)
+
+	configBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return gc, unknown, fmt.Errorf("failed to marshal group config: %w", err)
+	}
+	if err := json.Unmarshal(configBytes, &gc); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			field := typeErr.Field
+			if idx := strings.LastIndex(field, "."); idx >= 0 {
+				field = field[idx+1:]
+			}
+			return gc, unknown, app_errors.ValidationErrors{{
+				Field:   field,
+				Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value),
+			}}
+		}
+		return gc, unknown, fmt.Errorf("failed to unmarshal group config: %w", err)
+	}
+
+	return gc, unknown, nil
+}
+
+// validateMin records an error if an overridden int is below the minimum.
+func validateMin(errs *app_errors.ValidationErrors, field string, value *int, minValue int) {
+	if value != nil && *value < minValue {
+		errs.Add(field, fmt.Sprintf("must be at least %d, got %d", minValue, *value))
+	}
+}
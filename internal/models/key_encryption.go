@@ -0,0 +1,119 @@
+package models
+
+import (
+	"errors"
+
+	"gpt-load/internal/encryption"
+
+	"gorm.io/gorm"
+)
+
+// keyCipher encrypts api_keys.key_value and request_logs.key_value at rest when DB_ENCRYPTION_KEY is set.
+// oldKeyCipher is DB_OLD_ENCRYPTION_KEY, still accepted for reads during key rotation.
+var (
+	keyCipher    *encryption.Cipher
+	oldKeyCipher *encryption.Cipher
+)
+
+// SetKeyCiphers configures encryption of key values. It must be called before the database is used.
+func SetKeyCiphers(current, old *encryption.Cipher) {
+	keyCipher = current
+	oldKeyCipher = old
+}
+
+// KeyEncryptionEnabled reports whether key values are encrypted at rest.
+func KeyEncryptionEnabled() bool {
+	return keyCipher != nil
+}
+
+// EncryptKeyValue returns the stored form of a key value.
+func EncryptKeyValue(value string) string {
+	if keyCipher == nil || value == "" {
+		return value
+	}
+	return keyCipher.Encrypt(value)
+}
+
+// DecryptKeyValue returns the plaintext of a stored key value, trying the old key during rotation.
+func DecryptKeyValue(value string) (string, error) {
+	if !encryption.IsEncrypted(value) {
+		return value, nil
+	}
+	if keyCipher == nil {
+		return "", errors.New("key value is encrypted but DB_ENCRYPTION_KEY is not set")
+	}
+
+	plaintext, err := keyCipher.Decrypt(value)
+	if err != nil && oldKeyCipher != nil {
+		plaintext, err = oldKeyCipher.Decrypt(value)
+	}
+	return plaintext, err
+}
+
+// KeyValueLookups returns the stored forms to match when querying api_keys by key value.
+// The plaintext form and the form under the old key are included too, so rows written
+// before encryption was enabled or rotated are still found until they are re-encrypted.
+func KeyValueLookups(values []string) []string {
+	if keyCipher == nil {
+		return values
+	}
+	lookups := make([]string, 0, len(values)*3)
+	for _, value := range values {
+		lookups = append(lookups, value, keyCipher.Encrypt(value))
+		if oldKeyCipher != nil {
+			lookups = append(lookups, oldKeyCipher.Encrypt(value))
+		}
+	}
+	return lookups
+}
+
+// BeforeSave encrypts the key value before it is written.
+func (k *APIKey) BeforeSave(tx *gorm.DB) error {
+	k.KeyValue = EncryptKeyValue(k.KeyValue)
+	return nil
+}
+
+// AfterSave restores the plaintext key value, so callers keep using the saved struct as before.
+func (k *APIKey) AfterSave(tx *gorm.DB) error {
+	return k.decryptKeyValue()
+}
+
+// AfterFind decrypts the key value after it is read.
+func (k *APIKey) AfterFind(tx *gorm.DB) error {
+	return k.decryptKeyValue()
+}
+
+func (k *APIKey) decryptKeyValue() error {
+	plaintext, err := DecryptKeyValue(k.KeyValue)
+	if err != nil {
+		return err
+	}
+	k.KeyValue = plaintext
+	return nil
+}
+
+// BeforeSave encrypts the key value of a request log before it is written. Encrypted values
+// are kept as is, so a batch insert that failed can be retried.
+func (l *RequestLog) BeforeSave(tx *gorm.DB) error {
+	l.KeyValue = EncryptKeyValue(l.KeyValue)
+	return nil
+}
+
+// AfterSave restores the plaintext key value, which the key request counts are updated from.
+func (l *RequestLog) AfterSave(tx *gorm.DB) error {
+	return l.decryptKeyValue()
+}
+
+// AfterFind decrypts the key value after it is read.
+func (l *RequestLog) AfterFind(tx *gorm.DB) error {
+	return l.decryptKeyValue()
+}
+
+func (l *RequestLog) decryptKeyValue() error {
+	plaintext, err := DecryptKeyValue(l.KeyValue)
+	if err != nil {
+		return err
+	}
+	l.KeyValue = plaintext
+	return nil
+}
@@ -11,6 +11,14 @@ import (
 const (
 	KeyStatusActive  = "active"
 	KeyStatusInvalid = "invalid"
+	KeyStatusSuspect = "suspect" // 达到拉黑阈值，等待确认探测
+	KeyStatusStandby = "standby" // 热备密钥，分组可用密钥不足时才被启用
+)
+
+// 确认探测结果
+const (
+	ProbeResultPassed = "passed"
+	ProbeResultFailed = "failed"
 )
 
 // SystemSetting 对应 system_settings 表
@@ -23,21 +31,36 @@ type SystemSetting struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
-// GroupConfig 存储特定于分组的配置
-type GroupConfig struct {
-	RequestTimeout               *int    `json:"request_timeout,omitempty"`
-	IdleConnTimeout              *int    `json:"idle_conn_timeout,omitempty"`
-	ConnectTimeout               *int    `json:"connect_timeout,omitempty"`
-	MaxIdleConns                 *int    `json:"max_idle_conns,omitempty"`
-	MaxIdleConnsPerHost          *int    `json:"max_idle_conns_per_host,omitempty"`
-	ResponseHeaderTimeout        *int    `json:"response_header_timeout,omitempty"`
-	ProxyURL                     *string `json:"proxy_url,omitempty"`
-	MaxRetries                   *int    `json:"max_retries,omitempty"`
-	BlacklistThreshold           *int    `json:"blacklist_threshold,omitempty"`
-	KeyValidationIntervalMinutes *int    `json:"key_validation_interval_minutes,omitempty"`
-	KeyValidationConcurrency     *int    `json:"key_validation_concurrency,omitempty"`
-	KeyValidationTimeoutSeconds  *int    `json:"key_validation_timeout_seconds,omitempty"`
-	EnableRequestBodyLogging     *bool   `json:"enable_request_body_logging,omitempty"`
+// FeatureFlagOverride 功能开关覆盖值，GroupID 为 0 表示全局覆盖
+type FeatureFlagOverride struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FlagName  string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_flag_group" json:"flag_name"`
+	GroupID   uint      `gorm:"not null;default:0;uniqueIndex:idx_flag_group" json:"group_id"`
+	Enabled   bool      `gorm:"not null" json:"enabled"`
+	UpdatedBy string    `gorm:"type:varchar(100)" json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GeoRouteRule 将调用方所在国家映射到优先使用的分组
+type GeoRouteRule struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CountryCode string    `gorm:"type:varchar(2);not null;uniqueIndex" json:"country_code"`
+	KeyGroupID  uint      `gorm:"not null;index" json:"key_group_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AdminAuditLog 管理操作审计日志，Actor 为操作来源的客户端 IP（定时任务为 "scheduler"）
+type AdminAuditLog struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Timestamp  time.Time `gorm:"not null;index" json:"timestamp"`
+	Action     string    `gorm:"type:varchar(255);not null;index" json:"action"`
+	Actor      string    `gorm:"type:varchar(64)" json:"actor"`
+	Method     string    `gorm:"type:varchar(10)" json:"method"`
+	Path       string    `gorm:"type:varchar(500)" json:"path"`
+	StatusCode int       `json:"status_code"`
+	Detail     string    `gorm:"type:text" json:"detail"`
 }
 
 // HeaderRule defines a single rule for header manipulation.
@@ -47,6 +70,12 @@ type HeaderRule struct {
 	Action string `json:"action"` // "set" or "remove"
 }
 
+// RequiredHeader defines a header the client must send, with an optional default injected when it is omitted.
+type RequiredHeader struct {
+	Key     string `json:"key"`
+	Default string `json:"default"`
+}
+
 // Group 对应 groups 表
 type Group struct {
 	ID                 uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -64,14 +93,21 @@ type Group struct {
 	ParamOverrides     datatypes.JSONMap    `gorm:"type:json" json:"param_overrides"`
 	Config             datatypes.JSONMap    `gorm:"type:json" json:"config"`
 	HeaderRules        datatypes.JSON       `gorm:"type:json" json:"header_rules"`
-	APIKeys            []APIKey             `gorm:"foreignKey:GroupID" json:"api_keys"`
-	LastValidatedAt    *time.Time           `json:"last_validated_at"`
-	CreatedAt          time.Time            `json:"created_at"`
-	UpdatedAt          time.Time            `json:"updated_at"`
+	RequiredHeaders    datatypes.JSON       `gorm:"type:json" json:"required_headers"`
+	ValidationProbe    datatypes.JSON       `gorm:"type:json" json:"validation_probe"`
+	KeySyncSource      string               `gorm:"type:varchar(500)" json:"key_sync_source"`
+	// 上游空闲连接的保持时长（秒），为空时使用全局默认值
+	KeepaliveTimeoutSeconds *int       `json:"keepalive_timeout_seconds"`
+	DeleteAfter             *time.Time `gorm:"index" json:"delete_after"`
+	APIKeys                 []APIKey   `gorm:"foreignKey:GroupID" json:"api_keys"`
+	LastValidatedAt         *time.Time `json:"last_validated_at"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
 
 	// For cache
-	ProxyKeysMap   map[string]struct{} `gorm:"-" json:"-"`
-	HeaderRuleList []HeaderRule        `gorm:"-" json:"-"`
+	ProxyKeysMap       map[string]struct{} `gorm:"-" json:"-"`
+	HeaderRuleList     []HeaderRule        `gorm:"-" json:"-"`
+	RequiredHeaderList []RequiredHeader    `gorm:"-" json:"-"`
 }
 
 // APIKey 对应 api_keys 表
@@ -85,12 +121,63 @@ type APIKey struct {
 	LastUsedAt   *time.Time `json:"last_used_at"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
+
+	FalseAlarmCount int64      `gorm:"not null;default:0" json:"false_alarm_count"`
+	LastProbeResult string     `gorm:"type:varchar(20)" json:"last_probe_result"`
+	LastProbeAt     *time.Time `json:"last_probe_at"`
+
+	QuotaPrecheckEndpoint   string  `gorm:"type:varchar(500)" json:"quota_precheck_endpoint"`
+	QuotaPrecheckMinBalance float64 `gorm:"not null;default:0" json:"quota_precheck_min_balance"`
+
+	// OpenAI 项目级密钥所属的组织与项目，代理请求和验证时作为请求头发送
+	OrgID     string `gorm:"type:varchar(100)" json:"org_id"`
+	ProjectID string `gorm:"type:varchar(100)" json:"project_id"`
+
+	LastFailureReason string `gorm:"type:varchar(255)" json:"last_failure_reason"`
+
+	// 最近一次验证或健康检查的时间和错误，以及健康检查连续失败的次数
+	LastCheckedAt       *time.Time `json:"last_checked_at"`
+	LastCheckError      string     `gorm:"type:varchar(255)" json:"last_check_error"`
+	HealthCheckFailures int        `gorm:"not null;default:0" json:"health_check_failures"`
+
+	// 密钥来源（例如贡献者），用于按来源统计密钥的使用情况
+	Source string `gorm:"type:varchar(100);not null;default:'';index" json:"source"`
+
+	// 模型亲和：匹配这些模式（支持 * 通配）的模型优先使用该 Key，没有可用的亲和 Key 时仍使用其他 Key
+	ModelAffinity datatypes.JSON `gorm:"type:json" json:"model_affinity"`
+
+	// 错误预算：窗口内错误率超过该百分比时自动禁用，0 表示不启用
+	ErrorBudgetPercent     float64 `gorm:"not null;default:0" json:"error_budget_percent"`
+	ErrorBudgetWindowHours int     `gorm:"not null;default:0" json:"error_budget_window_hours"`
+	// 剩余的错误预算占预算的百分比，仅在列表接口中返回
+	ErrorBudgetRemainingPercent *float64 `gorm:"-" json:"error_budget_remaining_percent,omitempty"`
+
+	SyncRemovedAt *time.Time `json:"sync_removed_at"`
+
+	// 过期时间，到期后密钥不再被选用并被禁用；为空表示永不过期
+	ExpiresAt *time.Time `json:"expires_at"`
+	// 最近一次因临近过期仍在使用而自动顺延过期时间的时间
+	AutoExtendedAt *time.Time `json:"auto_extended_at"`
+
+	// 加权轮询策略下的权重，权重为 0 的密钥不会被选用；轮询策略下不生效
+	Weight int `gorm:"not null;default:1" json:"weight"`
+
+	// 热备密钥平时处于 standby 状态不参与选用，分组可用密钥低于 STANDBY_ACTIVATION_THRESHOLD 时被启用
+	StandbyOnly bool `gorm:"not null;default:false" json:"standby_only"`
+}
+
+// KeyScope is the OpenAI organization and project a key is scoped to.
+type KeyScope struct {
+	OrgID     string `json:"org_id"`
+	ProjectID string `json:"project_id"`
 }
 
 // RequestType 请求类型常量
 const (
 	RequestTypeRetry = "retry"
 	RequestTypeFinal = "final"
+	// 客户端声明的截止时间已到，请求被取消
+	RequestTypeClientDeadlineExceeded = "client_deadline_exceeded"
 )
 
 // RequestLog 对应 request_logs 表
@@ -103,15 +190,36 @@ type RequestLog struct {
 	Model        string    `gorm:"type:varchar(255);index" json:"model"`
 	IsSuccess    bool      `gorm:"not null" json:"is_success"`
 	SourceIP     string    `gorm:"type:varchar(64)" json:"source_ip"`
+	ClientKey    string    `gorm:"type:varchar(64)" json:"client_key"`
 	StatusCode   int       `gorm:"not null" json:"status_code"`
 	RequestPath  string    `gorm:"type:varchar(500)" json:"request_path"`
 	Duration     int64     `gorm:"not null" json:"duration_ms"`
 	ErrorMessage string    `gorm:"type:text" json:"error_message"`
 	UserAgent    string    `gorm:"type:varchar(512)" json:"user_agent"`
-	RequestType  string    `gorm:"type:varchar(20);not null;default:'final';index" json:"request_type"`
+	RequestType  string    `gorm:"type:varchar(32);not null;default:'final';index" json:"request_type"`
 	UpstreamAddr string    `gorm:"type:varchar(500)" json:"upstream_addr"`
 	IsStream     bool      `gorm:"not null" json:"is_stream"`
 	RequestBody  string    `gorm:"type:text" json:"request_body"`
+	// 请求体的 SHA-256，未记录请求体时同样写入，用于查找相同请求及校验重放的请求体是否完整
+	RequestBodyHash string `gorm:"type:varchar(64);index" json:"request_body_hash"`
+	// 请求体已写入对象存储时为其对象键，此时 RequestBody 为空
+	PayloadRef string `gorm:"type:varchar(255)" json:"payload_ref"`
+	// 本次请求关闭重试的原因：caller（请求头 X-GPT-Load-No-Retry）或 missing_idempotency_key
+	RetryDisabled string `gorm:"type:varchar(32)" json:"retry_disabled"`
+	// 上游响应中的请求 ID（如 OpenAI 的 x-request-id），用于向服务商提交工单时关联请求
+	UpstreamRequestID string `gorm:"type:varchar(128);index" json:"upstream_request_id"`
+	// 所用密钥的 SHA-256，用于在不暴露密钥的情况下按密钥审计请求
+	KeyHash string `gorm:"type:varchar(64);index" json:"key_hash"`
+	// 请求体及返回给调用方的响应体字节数
+	RequestBytes  int64 `gorm:"not null;default:0" json:"request_bytes"`
+	ResponseBytes int64 `gorm:"not null;default:0" json:"response_bytes"`
+	// 所用密钥的来源，仅用于写入时累计按来源的统计，不写入日志表
+	KeySource string `gorm:"-" json:"key_source,omitempty"`
+
+	// 请求各阶段耗时（毫秒），仅用于事件导出，不写入数据库
+	SetupDuration    int64 `gorm:"-" json:"-"`
+	UpstreamDuration int64 `gorm:"-" json:"-"`
+	TransferDuration int64 `gorm:"-" json:"-"`
 }
 
 // StatCard 用于仪表盘的单个统计卡片数据
@@ -129,6 +237,31 @@ type DashboardStatsResponse struct {
 	RPM          StatCard `json:"rpm"`
 	RequestCount StatCard `json:"request_count"`
 	ErrorRate    StatCard `json:"error_rate"`
+	// 客户端代理密钥本月的请求额度，仅在设置了 CLIENT_MONTHLY_QUOTA 时返回
+	ClientQuotas []ClientQuotaStat `json:"client_quotas,omitempty"`
+	// 多上游分组各上游主机的探测状态，仅在开启 HOST_HEALTH_CHECK_INTERVAL_SECONDS 时返回
+	UpstreamHosts []UpstreamHostStat `json:"upstream_hosts,omitempty"`
+}
+
+// UpstreamHostStat 分组中单个上游主机的健康探测状态
+type UpstreamHostStat struct {
+	GroupID             uint      `json:"group_id"`
+	GroupName           string    `json:"group_name"`
+	Upstream            string    `json:"upstream"`
+	Up                  bool      `json:"up"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastCheckedAt       time.Time `json:"last_checked_at"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// ClientQuotaStat 客户端代理密钥本月的请求额度
+type ClientQuotaStat struct {
+	Client      string    `json:"client"`
+	Fingerprint string    `json:"fingerprint"`
+	Used        int64     `json:"used"`
+	Limit       int64     `json:"limit"`
+	Remaining   int64     `json:"remaining"`
+	ResetAt     time.Time `json:"reset_at"`
 }
 
 // ChartDataset 用于图表的数据集
@@ -154,3 +287,35 @@ type GroupHourlyStat struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
+
+// KeySourceHourlyStat 对应 key_source_hourly_stats 表，按分组和密钥来源存储每小时的请求统计，包含重试请求
+type KeySourceHourlyStat struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Time         time.Time `gorm:"not null;uniqueIndex:idx_key_source_time" json:"time"` // 整点时间
+	GroupID      uint      `gorm:"not null;uniqueIndex:idx_key_source_time" json:"group_id"`
+	Source       string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_key_source_time" json:"source"`
+	SuccessCount int64     `gorm:"not null;default:0" json:"success_count"`
+	FailureCount int64     `gorm:"not null;default:0" json:"failure_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// KeySourceDisableStat 对应 key_source_disable_stats 表，按分组、密钥来源和原因存储每小时被禁用的密钥数
+type KeySourceDisableStat struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Time      time.Time `gorm:"not null;uniqueIndex:idx_key_source_disable" json:"time"` // 整点时间
+	GroupID   uint      `gorm:"not null;uniqueIndex:idx_key_source_disable" json:"group_id"`
+	Source    string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_key_source_disable" json:"source"`
+	Reason    string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_key_source_disable" json:"reason"`
+	Count     int64     `gorm:"not null;default:0" json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GroupStatCounter 对应 group_stat_counters 表，用于持久化每个分组的累计请求计数
+type GroupStatCounter struct {
+	GroupID      uint      `gorm:"primaryKey;autoIncrement:false" json:"group_id"`
+	RequestCount int64     `gorm:"not null;default:0" json:"request_count"`
+	FailureCount int64     `gorm:"not null;default:0" json:"failure_count"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
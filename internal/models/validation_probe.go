@@ -0,0 +1,171 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	app_errors "gpt-load/internal/errors"
+
+	"gorm.io/datatypes"
+)
+
+// ValidationProbeModelPlaceholder 在探测路径和请求体模板中替换为分组的测试模型
+const ValidationProbeModelPlaceholder = "${MODEL}"
+
+var probePlaceholderRegex = regexp.MustCompile(`\$\{[^}]*\}?`)
+
+// ValidationProbe 分组自定义的密钥验证探测请求。
+// ExpectedStatuses 为空时（仅渠道默认探测），任意 2xx 状态码视为有效。
+type ValidationProbe struct {
+	Method           string `json:"method"`
+	Path             string `json:"path"`
+	BodyTemplate     string `json:"body_template,omitempty"`
+	ExpectedStatuses []int  `json:"expected_statuses"`
+	ResponseJSONPath string `json:"response_json_path,omitempty"`
+}
+
+// ParseValidationProbe decodes a stored probe, returning nil if the group has none.
+func ParseValidationProbe(raw datatypes.JSON) (*ValidationProbe, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" || trimmed == "{}" {
+		return nil, nil
+	}
+	var probe ValidationProbe
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse validation probe: %w", err)
+	}
+	return &probe, nil
+}
+
+// Normalize trims the probe fields and upper-cases the method.
+func (p *ValidationProbe) Normalize() {
+	p.Method = strings.ToUpper(strings.TrimSpace(p.Method))
+	p.Path = strings.TrimSpace(p.Path)
+	p.BodyTemplate = strings.TrimSpace(p.BodyTemplate)
+	p.ResponseJSONPath = strings.TrimSpace(p.ResponseJSONPath)
+}
+
+// Validate checks a custom probe configuration.
+func (p ValidationProbe) Validate() app_errors.ValidationErrors {
+	var errs app_errors.ValidationErrors
+
+	switch p.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodHead:
+	default:
+		errs.Add("method", "must be one of: GET, POST, PUT, HEAD")
+	}
+
+	if !strings.HasPrefix(p.Path, "/") || strings.Contains(p.Path, "://") {
+		errs.Add("path", "must be a path starting with /")
+	} else if err := checkProbePlaceholders(p.Path); err != nil {
+		errs.Add("path", err.Error())
+	}
+
+	if p.BodyTemplate != "" {
+		if p.Method == http.MethodGet || p.Method == http.MethodHead {
+			errs.Add("body_template", fmt.Sprintf("is not allowed for %s requests", p.Method))
+		} else if err := checkProbePlaceholders(p.BodyTemplate); err != nil {
+			errs.Add("body_template", err.Error())
+		} else if !json.Valid([]byte(p.RenderBody("model"))) {
+			errs.Add("body_template", "must be valid JSON after substituting "+ValidationProbeModelPlaceholder)
+		}
+	}
+
+	if len(p.ExpectedStatuses) == 0 {
+		errs.Add("expected_statuses", "must contain at least one status code")
+	}
+	for _, status := range p.ExpectedStatuses {
+		if status < 100 || status > 599 {
+			errs.Add("expected_statuses", fmt.Sprintf("invalid status code %d", status))
+		}
+	}
+
+	if p.ResponseJSONPath != "" {
+		if _, err := parseJSONPath(p.ResponseJSONPath); err != nil {
+			errs.Add("response_json_path", err.Error())
+		}
+	}
+
+	return errs
+}
+
+// RenderBody substitutes the model into the body template as a JSON string fragment.
+func (p ValidationProbe) RenderBody(model string) string {
+	quoted, _ := json.Marshal(model)
+	return strings.ReplaceAll(p.BodyTemplate, ValidationProbeModelPlaceholder, string(quoted[1:len(quoted)-1]))
+}
+
+// IsExpectedStatus reports whether a response status counts as a valid key.
+func (p ValidationProbe) IsExpectedStatus(status int) bool {
+	if len(p.ExpectedStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, expected := range p.ExpectedStatuses {
+		if status == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProbePlaceholders rejects any placeholder other than ${MODEL}.
+func checkProbePlaceholders(template string) error {
+	for _, placeholder := range probePlaceholderRegex.FindAllString(template, -1) {
+		if placeholder != ValidationProbeModelPlaceholder {
+			return fmt.Errorf("unsupported placeholder %q, only %s is allowed", placeholder, ValidationProbeModelPlaceholder)
+		}
+	}
+	return nil
+}
+
+// JSONPathExists reports whether the JSON document contains a value at the path.
+// Supported syntax: $.data[0].id, data.0.id
+func JSONPathExists(body []byte, path string) bool {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return false
+	}
+	var current any
+	if err := json.Unmarshal(body, &current); err != nil {
+		return false
+	}
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[segment]
+			if !ok {
+				return false
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return false
+			}
+			current = node[index]
+		default:
+			return false
+		}
+	}
+	return current != nil
+}
+
+// parseJSONPath splits a JSONPath expression into object keys and array indexes.
+func parseJSONPath(path string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("must reference a field")
+	}
+	trimmed = strings.ReplaceAll(strings.ReplaceAll(trimmed, "[", "."), "]", "")
+	segments := strings.Split(trimmed, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return segments, nil
+}
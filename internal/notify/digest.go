@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/store"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 汇总状态按渠道保存在 store 的 hash 中，计数使用 HIncrBy，多个实例可同时累加：
+//
+//	count|<类型>              事件次数
+//	first|<类型>, last|<类型> 首次、最近一次发生时间
+//	group|<类型>|<分组>       各分组的事件次数
+//
+// 汇总周期的开始时间由第一个事件通过 SetNX 写入单独的 <key>:since。
+const (
+	digestSinceSuffix = ":since"
+	digestLockSuffix  = ":lock"
+	digestFieldCount  = "count|"
+	digestFieldFirst  = "first|"
+	digestFieldLast   = "last|"
+	digestFieldGroup  = "group|"
+)
+
+// Digest is the summary of the events of a channel over one digest period.
+type Digest struct {
+	Event       string        `json:"event"`
+	Channel     string        `json:"channel"`
+	PeriodStart time.Time     `json:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end"`
+	Total       int64         `json:"total"`
+	Events      []DigestEntry `json:"events"`
+}
+
+// DigestEntry summarizes the events of one type in a digest.
+type DigestEntry struct {
+	Type    string           `json:"type"`
+	Count   int64            `json:"count"`
+	Groups  map[string]int64 `json:"groups,omitempty"`
+	FirstAt time.Time        `json:"first_at"`
+	LastAt  time.Time        `json:"last_at"`
+}
+
+// addToDigest records the event in the channel's pending digest.
+func (n *Notifier) addToDigest(channel string, event Event) error {
+	key := digestKeyPrefix + channel
+	at := strconv.FormatInt(event.Timestamp.UnixMilli(), 10)
+
+	count, err := n.store.HIncrBy(key, digestFieldCount+event.Type, 1)
+	if err != nil {
+		return err
+	}
+	values := map[string]any{digestFieldLast + event.Type: at}
+	if count == 1 {
+		values[digestFieldFirst+event.Type] = at
+	}
+	if err := n.store.HSet(key, values); err != nil {
+		return err
+	}
+	if event.Group != "" {
+		if _, err := n.store.HIncrBy(key, digestFieldGroup+event.Type+"|"+event.Group, 1); err != nil {
+			return err
+		}
+	}
+	_, err = n.store.SetNX(key+digestSinceSuffix, []byte(at), 0)
+	return err
+}
+
+func (n *Notifier) runDigestLoop() {
+	defer n.wg.Done()
+
+	ticker := n.clock.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n.flushDueDigests()
+		select {
+		case <-ticker.C():
+		case <-n.stopChan:
+			return
+		}
+	}
+}
+
+// flushDueDigests sends the digests whose period has ended. Digests of channels no longer in
+// digest mode are sent right away.
+func (n *Notifier) flushDueDigests() {
+	settings := n.settingsManager.GetSettings()
+	now := n.clock.Now()
+	for _, channel := range Channels {
+		key := digestKeyPrefix + channel
+		value, err := n.store.Get(key + digestSinceSuffix)
+		if err != nil {
+			if err != store.ErrNotFound {
+				logrus.WithError(err).Warnf("Notifier: failed to load the %s digest", channel)
+			}
+			continue
+		}
+		sinceMs, _ := strconv.ParseInt(string(value), 10, 64)
+		since := time.UnixMilli(sinceMs)
+		if now.Sub(since) < digestPeriod(settings, channel) {
+			continue
+		}
+
+		acquired, err := n.store.SetNX(key+digestLockSuffix, []byte("1"), digestFlushLockTTL)
+		if err != nil || !acquired {
+			continue
+		}
+		// 读取后立即删除，缩小与并发写入之间的窗口
+		fields, err := n.store.HGetAll(key)
+		if err == nil {
+			err = n.store.Del(key, key+digestSinceSuffix)
+		}
+		if err != nil {
+			logrus.WithError(err).Warnf("Notifier: failed to take the %s digest", channel)
+			_ = n.store.Delete(key + digestLockSuffix)
+			continue
+		}
+
+		digest := buildDigest(channel, since, fields, now)
+		if digest.Total > 0 && n.webhookURL(channel) != "" {
+			if err := n.send(channel, formatDigest(channelFormat(settings, channel), digest)); err != nil {
+				logrus.WithError(err).Warnf("Notifier: failed to send the %s digest of %d events", channel, digest.Total)
+			}
+		}
+		_ = n.store.Delete(key + digestLockSuffix)
+	}
+}
+
+// buildDigest summarizes the stored digest fields of a channel.
+func buildDigest(channel string, since time.Time, fields map[string]string, now time.Time) Digest {
+	digest := Digest{Event: "digest", Channel: channel, PeriodStart: since, PeriodEnd: now}
+
+	entries := make(map[string]*DigestEntry)
+	entry := func(eventType string) *DigestEntry {
+		if e, ok := entries[eventType]; ok {
+			return e
+		}
+		e := &DigestEntry{Type: eventType}
+		entries[eventType] = e
+		return e
+	}
+	parseTime := func(value string) time.Time {
+		ms, _ := strconv.ParseInt(value, 10, 64)
+		return time.UnixMilli(ms)
+	}
+
+	for field, value := range fields {
+		switch {
+		case strings.HasPrefix(field, digestFieldCount):
+			count, _ := strconv.ParseInt(value, 10, 64)
+			entry(strings.TrimPrefix(field, digestFieldCount)).Count = count
+			digest.Total += count
+		case strings.HasPrefix(field, digestFieldFirst):
+			entry(strings.TrimPrefix(field, digestFieldFirst)).FirstAt = parseTime(value)
+		case strings.HasPrefix(field, digestFieldLast):
+			entry(strings.TrimPrefix(field, digestFieldLast)).LastAt = parseTime(value)
+		case strings.HasPrefix(field, digestFieldGroup):
+			eventType, group, ok := strings.Cut(strings.TrimPrefix(field, digestFieldGroup), "|")
+			if !ok {
+				continue
+			}
+			count, _ := strconv.ParseInt(value, 10, 64)
+			e := entry(eventType)
+			if e.Groups == nil {
+				e.Groups = make(map[string]int64)
+			}
+			e.Groups[group] = count
+		}
+	}
+
+	for _, e := range entries {
+		digest.Events = append(digest.Events, *e)
+	}
+	sort.Slice(digest.Events, func(i, j int) bool {
+		if digest.Events[i].Count != digest.Events[j].Count {
+			return digest.Events[i].Count > digest.Events[j].Count
+		}
+		return digest.Events[i].Type < digest.Events[j].Type
+	})
+	return digest
+}
+
+// formatDigest builds the webhook payload of a digest: the digest itself in the json format,
+// or a compact text message in the slack format.
+func formatDigest(format string, digest Digest) any {
+	if format != FormatSlack {
+		return digest
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*gpt-load %s digest*: %d events from %s to %s",
+		digest.Channel, digest.Total, digest.PeriodStart.Format("01-02 15:04"), digest.PeriodEnd.Format("01-02 15:04"))
+	for _, e := range digest.Events {
+		fmt.Fprintf(&b, "\n• `%s` ×%d", e.Type, e.Count)
+		if len(e.Groups) > 0 {
+			groups := make([]string, 0, len(e.Groups))
+			for group, count := range e.Groups {
+				groups = append(groups, fmt.Sprintf("%s (%d)", group, count))
+			}
+			sort.Strings(groups)
+			fmt.Fprintf(&b, " in %s", strings.Join(groups, ", "))
+		}
+		fmt.Fprintf(&b, ", first %s, last %s", e.FirstAt.Format("15:04:05"), e.LastAt.Format("15:04:05"))
+	}
+	return map[string]string{"text": b.String()}
+}
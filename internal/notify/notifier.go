@@ -0,0 +1,223 @@
+// Package notify delivers admin notifications to webhooks, either as each event happens or
+// summarized in periodic digests.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/config"
+	appruntime "gpt-load/internal/runtime"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notification channels, each delivered to its own webhook URL.
+const (
+	ChannelPoolDegraded       = "pool_degraded"
+	ChannelUpstreamQuarantine = "upstream_quarantine"
+	ChannelPayloadOffload     = "payload_offload"
+	ChannelKeyErrorBudget     = "key_error_budget"
+)
+
+// Channels lists the notification channels.
+var Channels = []string{ChannelPoolDegraded, ChannelUpstreamQuarantine, ChannelPayloadOffload, ChannelKeyErrorBudget}
+
+// Event severities, from least to most severe.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Webhook payload formats.
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+const (
+	webhookTimeout      = 10 * time.Second
+	digestCheckInterval = 30 * time.Second
+	// digestFlushLockTTL 汇总发送锁的有效期，避免多个实例重复发送同一份汇总
+	digestFlushLockTTL = time.Minute
+	digestKeyPrefix    = "notify:digest:"
+)
+
+// Event is an admin notification.
+type Event struct {
+	Type     string
+	Severity string
+	Group    string
+	// Summary is the one-line text of the event in Slack messages.
+	Summary   string
+	Timestamp time.Time
+	// Payload is the JSON body of the event when it is delivered on its own in the json format.
+	Payload any
+}
+
+// Notifier sends events to the webhook of their channel. A channel with a digest period
+// accumulates its events in the store and sends one summary per period instead, except for
+// events at or above the bypass severity, which are still sent immediately.
+type Notifier struct {
+	store           store.Store
+	configManager   types.ConfigManager
+	settingsManager *config.SystemSettingsManager
+	clock           clock.Clock
+	pool            *appruntime.GoroutinePool
+	httpClient      *http.Client
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewNotifier creates a new, unstarted Notifier.
+func NewNotifier(
+	store store.Store,
+	configManager types.ConfigManager,
+	settingsManager *config.SystemSettingsManager,
+	clk clock.Clock,
+	pool *appruntime.GoroutinePool,
+) *Notifier {
+	return &Notifier{
+		store:           store,
+		configManager:   configManager,
+		settingsManager: settingsManager,
+		clock:           clk,
+		pool:            pool,
+		httpClient:      &http.Client{Timeout: webhookTimeout},
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Start starts sending the digests that are due, including those left over from before a restart.
+func (n *Notifier) Start() {
+	n.wg.Add(1)
+	go n.runDigestLoop()
+}
+
+// Stop stops sending digests. Pending digests stay in the store and are sent after the next start.
+func (n *Notifier) Stop(ctx context.Context) {
+	close(n.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("Notifier stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("Notifier stop timed out.")
+	}
+}
+
+// Notify sends the event to the channel's webhook, or adds it to the channel's digest.
+// Channels without a webhook URL drop their events.
+func (n *Notifier) Notify(channel string, event Event) {
+	if n.webhookURL(channel) == "" {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = n.clock.Now()
+	}
+
+	settings := n.settingsManager.GetSettings()
+	if digestPeriod(settings, channel) > 0 && !bypassesDigest(settings.NotificationBypassSeverity, event.Severity) {
+		err := n.addToDigest(channel, event)
+		if err == nil {
+			return
+		}
+		logrus.WithError(err).Warnf("Notifier: failed to add %s event to the digest, sending it now", event.Type)
+	}
+
+	n.pool.GoNoWait(func() {
+		if err := n.send(channel, formatEvent(channelFormat(settings, channel), event)); err != nil {
+			logrus.WithError(err).Warnf("Notifier: failed to send %s webhook", event.Type)
+		}
+	})
+}
+
+// webhookURL returns the webhook URL of a channel.
+func (n *Notifier) webhookURL(channel string) string {
+	switch channel {
+	case ChannelPoolDegraded:
+		return n.configManager.GetKeyPoolConfig().DegradedWebhookURL
+	case ChannelUpstreamQuarantine:
+		return n.configManager.GetProxyConfig().QuarantineWebhookURL
+	case ChannelKeyErrorBudget:
+		return n.configManager.GetKeyPoolConfig().ErrorBudgetWebhookURL
+	case ChannelPayloadOffload:
+		return n.configManager.GetPayloadOffloadConfig().AlertWebhookURL
+	default:
+		return ""
+	}
+}
+
+// send posts a JSON payload to the channel's webhook.
+func (n *Notifier) send(channel string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.httpClient.Post(n.webhookURL(channel), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// digestPeriod returns the digest period of a channel, 0 when events are sent immediately.
+func digestPeriod(settings types.SystemSettings, channel string) time.Duration {
+	minutes := settings.NotificationDigestMinutes
+	if overrides, _ := utils.StringToMap(settings.NotificationDigestOverrides, ",", ":"); overrides != nil {
+		if value, ok := overrides[channel]; ok {
+			if parsed, err := strconv.Atoi(value); err == nil {
+				minutes = parsed
+			}
+		}
+	}
+	return time.Duration(max(minutes, 0)) * time.Minute
+}
+
+// channelFormat returns the webhook payload format of a channel.
+func channelFormat(settings types.SystemSettings, channel string) string {
+	if overrides, _ := utils.StringToMap(settings.NotificationFormatOverrides, ",", ":"); overrides != nil {
+		if format, ok := overrides[channel]; ok {
+			return format
+		}
+	}
+	return settings.NotificationFormat
+}
+
+// bypassesDigest reports whether an event of the severity is sent immediately even in digest mode.
+func bypassesDigest(bypassSeverity, severity string) bool {
+	levels := []string{SeverityInfo, SeverityWarning, SeverityCritical}
+	threshold := slices.Index(levels, bypassSeverity)
+	return threshold >= 0 && slices.Index(levels, severity) >= threshold
+}
+
+// formatEvent builds the webhook payload of a single event.
+func formatEvent(format string, event Event) any {
+	if format == FormatSlack {
+		return map[string]string{"text": event.Summary}
+	}
+	return event.Payload
+}
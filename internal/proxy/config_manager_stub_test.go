@@ -0,0 +1,16 @@
+package proxy
+
+import "gpt-load/internal/types"
+
+// stubConfigManager returns fixed configuration sections. Methods for sections a test does not
+// set are not implemented and panic when called.
+type stubConfigManager struct {
+	types.ConfigManager
+	server  types.ServerConfig
+	metrics types.MetricsConfig
+	proxy   types.ProxyConfig
+}
+
+func (m *stubConfigManager) GetEffectiveServerConfig() types.ServerConfig { return m.server }
+func (m *stubConfigManager) GetMetricsConfig() types.MetricsConfig        { return m.metrics }
+func (m *stubConfigManager) GetProxyConfig() types.ProxyConfig            { return m.proxy }
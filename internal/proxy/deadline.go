@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers a client can use to declare how long it will wait for the response.
+const (
+	requestTimeoutHeader   = "X-Request-Timeout-Ms"
+	grpcTimeoutHeader      = "Grpc-Timeout"
+	stainlessTimeoutHeader = "X-Stainless-Timeout" // OpenAI / Anthropic SDK，单位为秒
+)
+
+// grpcTimeoutUnits maps the unit suffix of a grpc-timeout value to its duration.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// maxClientTimeout caps a declared timeout when no total timeout is configured. It is far
+// below the range of time.Duration, so converting a declared value can't overflow.
+const maxClientTimeout = 24 * time.Hour
+
+// clientTimeout returns the timeout the client declared for the request, or 0 when it
+// declared none or the value is malformed. Values above limit are clamped to it before
+// being converted, so huge values can't wrap around to a negative or tiny timeout.
+func clientTimeout(header http.Header, limit time.Duration) time.Duration {
+	if value := strings.TrimSpace(header.Get(requestTimeoutHeader)); value != "" {
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+			if ms > limit.Milliseconds() {
+				return limit
+			}
+			return time.Duration(ms) * time.Millisecond
+		}
+		return 0
+	}
+	if value := strings.TrimSpace(header.Get(grpcTimeoutHeader)); value != "" {
+		return parseGRPCTimeout(value, limit)
+	}
+	if value := strings.TrimSpace(header.Get(stainlessTimeoutHeader)); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			if seconds > limit.Seconds() {
+				return limit
+			}
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: at most 8 digits followed by a unit.
+// Values above limit are clamped to it.
+func parseGRPCTimeout(value string, limit time.Duration) time.Duration {
+	if len(value) < 2 || len(value) > 9 {
+		return 0
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0
+	}
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || amount <= 0 {
+		return 0
+	}
+	if amount > int64(limit/unit) {
+		return limit
+	}
+	return time.Duration(amount) * unit
+}
+
+// clientDeadline returns when the client will stop waiting for the response, less the
+// configured safety margin so that the error still reaches it. The declared timeout is
+// clamped to the total timeout budget, which bounds the request anyway. The margin is at most
+// half of the timeout, so a short declared timeout never yields a deadline that has already passed.
+func (ps *ProxyServer) clientDeadline(c *gin.Context, startTime time.Time) (time.Time, bool) {
+	proxyConfig := ps.configManager.GetProxyConfig()
+	limit := maxClientTimeout
+	if proxyConfig.TotalTimeout > 0 {
+		limit = min(limit, time.Duration(proxyConfig.TotalTimeout)*time.Second)
+	}
+	timeout := clientTimeout(c.Request.Header, limit)
+	if timeout <= 0 {
+		return time.Time{}, false
+	}
+	margin := min(time.Duration(proxyConfig.ClientDeadlineMarginMs)*time.Millisecond, timeout/2)
+	return startTime.Add(timeout - margin), true
+}
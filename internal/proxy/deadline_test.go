@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+	}{
+		{name: "no header", want: 0},
+		{name: "milliseconds", headers: map[string]string{requestTimeoutHeader: "1500"}, want: 1500 * time.Millisecond},
+		{name: "milliseconds with spaces", headers: map[string]string{requestTimeoutHeader: " 1500 "}, want: 1500 * time.Millisecond},
+		{name: "zero milliseconds", headers: map[string]string{requestTimeoutHeader: "0"}, want: 0},
+		{name: "malformed milliseconds", headers: map[string]string{requestTimeoutHeader: "1.5s"}, want: 0},
+		{
+			name:    "malformed milliseconds shadows other headers",
+			headers: map[string]string{requestTimeoutHeader: "soon", grpcTimeoutHeader: "5S"},
+			want:    0,
+		},
+		{
+			name:    "milliseconds take precedence",
+			headers: map[string]string{requestTimeoutHeader: "1000", grpcTimeoutHeader: "5S", stainlessTimeoutHeader: "30"},
+			want:    time.Second,
+		},
+		{name: "grpc timeout", headers: map[string]string{grpcTimeoutHeader: "5S"}, want: 5 * time.Second},
+		{
+			name:    "grpc timeout takes precedence over stainless",
+			headers: map[string]string{grpcTimeoutHeader: "200m", stainlessTimeoutHeader: "30"},
+			want:    200 * time.Millisecond,
+		},
+		{name: "stainless seconds", headers: map[string]string{stainlessTimeoutHeader: "30"}, want: 30 * time.Second},
+		{name: "stainless fractional seconds", headers: map[string]string{stainlessTimeoutHeader: "0.5"}, want: 500 * time.Millisecond},
+		{name: "stainless negative", headers: map[string]string{stainlessTimeoutHeader: "-1"}, want: 0},
+		{name: "milliseconds at limit", headers: map[string]string{requestTimeoutHeader: "60000"}, want: time.Minute},
+		{name: "milliseconds above limit", headers: map[string]string{requestTimeoutHeader: "60001"}, want: time.Minute},
+		{name: "max int64 milliseconds", headers: map[string]string{requestTimeoutHeader: "9223372036854775807"}, want: time.Minute},
+		{name: "milliseconds overflowing int64", headers: map[string]string{requestTimeoutHeader: "9223372036854775808"}, want: 0},
+		{name: "grpc hours above limit", headers: map[string]string{grpcTimeoutHeader: "99999999H"}, want: time.Minute},
+		{name: "stainless seconds above limit", headers: map[string]string{stainlessTimeoutHeader: "1e300"}, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.headers {
+				header.Set(k, v)
+			}
+			if got := clientTimeout(header, time.Minute); got != tt.want {
+				t.Errorf("clientTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "1H", want: time.Hour},
+		{value: "2M", want: 2 * time.Minute},
+		{value: "3S", want: 3 * time.Second},
+		{value: "4m", want: 4 * time.Millisecond},
+		{value: "5u", want: 5 * time.Microsecond},
+		{value: "6n", want: 6 * time.Nanosecond},
+		{value: "99999999S", want: maxClientTimeout},
+		{value: "86400S", want: maxClientTimeout},
+		{value: "86399S", want: 86399 * time.Second},
+		{value: "99999999H", want: maxClientTimeout}, // 未限制时会溢出 time.Duration
+		{value: "100000000S", want: 0},               // 超过 8 位数字
+		{value: "S", want: 0},
+		{value: "10", want: 0},
+		{value: "10s", want: 0},
+		{value: "0S", want: 0},
+		{value: "-1S", want: 0},
+		{value: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseGRPCTimeout(tt.value, maxClientTimeout); got != tt.want {
+				t.Errorf("parseGRPCTimeout(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		header       string
+		marginMs     int
+		totalTimeout int
+		want         time.Time
+		wantOK       bool
+	}{
+		{name: "no declared timeout", header: "", marginMs: 250},
+		{name: "declared timeout", header: "10000", want: start.Add(10 * time.Second), wantOK: true},
+		{name: "margin subtracted", header: "10000", marginMs: 250, want: start.Add(9750 * time.Millisecond), wantOK: true},
+		{name: "margin above timeout", header: "100", marginMs: 250, want: start.Add(50 * time.Millisecond), wantOK: true},
+		{name: "margin equal to timeout", header: "250", marginMs: 250, want: start.Add(125 * time.Millisecond), wantOK: true},
+		{name: "margin above half of timeout", header: "400", marginMs: 250, want: start.Add(200 * time.Millisecond), wantOK: true},
+		{name: "clamped to total timeout", header: "9223372036854775807", marginMs: 250, totalTimeout: 30, want: start.Add(29750 * time.Millisecond), wantOK: true},
+		{name: "within total timeout", header: "10000", totalTimeout: 30, want: start.Add(10 * time.Second), wantOK: true},
+		{name: "clamped without total timeout", header: "9223372036854775807", want: start.Add(maxClientTimeout), wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &ProxyServer{configManager: &stubConfigManager{proxy: types.ProxyConfig{ClientDeadlineMarginMs: tt.marginMs, TotalTimeout: tt.totalTimeout}}}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/proxy/test/v1/chat/completions", nil)
+			if tt.header != "" {
+				c.Request.Header.Set(requestTimeoutHeader, tt.header)
+			}
+
+			got, ok := ps.clientDeadline(c, start)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("clientDeadline() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
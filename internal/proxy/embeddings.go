@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gpt-load/internal/channel"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// embeddingsSubRequestKey marks a context serving one part of a split embeddings request.
+// Its final request log is skipped, since the split request is logged once as a whole.
+const embeddingsSubRequestKey = "embeddingsSubRequest"
+
+// embeddingsRequest is the part of an OpenAI embeddings request checked against the group limits.
+type embeddingsRequest struct {
+	Input      json.RawMessage `json:"input"`
+	Dimensions *int            `json:"dimensions"`
+}
+
+// isEmbeddingsPath reports whether the path targets an OpenAI embeddings endpoint.
+func isEmbeddingsPath(path string) bool {
+	return strings.HasSuffix(strings.TrimRight(path, "/"), "/embeddings")
+}
+
+// planEmbeddings validates an embeddings request against the group's limits. It returns the
+// bodies of the upstream requests to send when the input must be split, or nil to send the
+// request unchanged. Requests that aren't embeddings requests are not checked.
+func planEmbeddings(path string, body []byte, cfg types.SystemSettings) ([][]byte, error) {
+	if !isEmbeddingsPath(path) {
+		return nil, nil
+	}
+	if cfg.EmbeddingsMaxInputs == 0 && cfg.EmbeddingsMaxInputChars == 0 && cfg.EmbeddingsAllowedDimensions == "" {
+		return nil, nil
+	}
+
+	var req embeddingsRequest
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Input) == 0 {
+		// 无法识别的请求交由上游校验
+		return nil, nil
+	}
+
+	if req.Dimensions != nil && cfg.EmbeddingsAllowedDimensions != "" {
+		allowed, _ := models.ParseEmbeddingDimensions(cfg.EmbeddingsAllowedDimensions)
+		if len(allowed) > 0 && !slices.Contains(allowed, *req.Dimensions) {
+			return nil, fmt.Errorf("dimensions %d is not allowed, allowed values: %s", *req.Dimensions, cfg.EmbeddingsAllowedDimensions)
+		}
+	}
+
+	inputs, batched := splitEmbeddingsInput(req.Input)
+	if cfg.EmbeddingsMaxInputChars > 0 {
+		for i, input := range inputs {
+			var text string
+			if json.Unmarshal(input, &text) != nil {
+				continue
+			}
+			if n := utf8.RuneCountInString(text); n > cfg.EmbeddingsMaxInputChars {
+				return nil, fmt.Errorf("input[%d] has %d characters, the limit is %d", i, n, cfg.EmbeddingsMaxInputChars)
+			}
+		}
+	}
+
+	maxInputs := cfg.EmbeddingsMaxInputs
+	if maxInputs == 0 || len(inputs) <= maxInputs {
+		return nil, nil
+	}
+	if !cfg.EmbeddingsAutoSplit || !batched {
+		return nil, fmt.Errorf("input has %d items, the limit is %d per request", len(inputs), maxInputs)
+	}
+
+	parts := (len(inputs) + maxInputs - 1) / maxInputs
+	if parts > cfg.EmbeddingsMaxSubRequests {
+		return nil, fmt.Errorf("input has %d items, which would need %d requests of at most %d items, the limit is %d requests", len(inputs), parts, maxInputs, cfg.EmbeddingsMaxSubRequests)
+	}
+
+	var requestData map[string]json.RawMessage
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return nil, nil
+	}
+	bodies := make([][]byte, 0, parts)
+	for start := 0; start < len(inputs); start += maxInputs {
+		end := min(start+maxInputs, len(inputs))
+		chunk, err := json.Marshal(inputs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		requestData["input"] = chunk
+		partBody, err := json.Marshal(requestData)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, partBody)
+	}
+	return bodies, nil
+}
+
+// splitEmbeddingsInput returns the individual inputs of an embeddings request, and whether the
+// input is a batch that can be split. A single string or a single token array is one input.
+func splitEmbeddingsInput(input json.RawMessage) ([]json.RawMessage, bool) {
+	var items []json.RawMessage
+	if json.Unmarshal(input, &items) != nil || len(items) == 0 {
+		return []json.RawMessage{input}, false
+	}
+	// 整数数组是单条 token 输入，而不是多条输入
+	if first := bytes.TrimSpace(items[0]); len(first) > 0 && first[0] != '"' && first[0] != '[' {
+		return []json.RawMessage{input}, false
+	}
+	return items, true
+}
+
+// embeddingsResponse is an OpenAI embeddings response.
+type embeddingsResponse struct {
+	Object string           `json:"object"`
+	Data   []map[string]any `json:"data"`
+	Model  string           `json:"model"`
+	Usage  map[string]any   `json:"usage,omitempty"`
+}
+
+// mergeEmbeddingsResponses combines the responses of a split request, shifting each embedding's
+// index by the offset of its part so the result matches the original input order, and summing usage.
+func mergeEmbeddingsResponses(responses [][]byte, offsets []int) ([]byte, error) {
+	merged := embeddingsResponse{Object: "list"}
+	for i, body := range responses {
+		var part embeddingsResponse
+		if err := json.Unmarshal(body, &part); err != nil {
+			return nil, fmt.Errorf("invalid embeddings response for part %d: %w", i+1, err)
+		}
+		if merged.Model == "" {
+			merged.Model = part.Model
+		}
+		for _, item := range part.Data {
+			index, _ := item["index"].(float64)
+			item["index"] = int(index) + offsets[i]
+			merged.Data = append(merged.Data, item)
+		}
+		for field, value := range part.Usage {
+			n, ok := value.(float64)
+			if !ok {
+				continue
+			}
+			if merged.Usage == nil {
+				merged.Usage = make(map[string]any)
+			}
+			total, _ := merged.Usage[field].(float64)
+			merged.Usage[field] = total + n
+		}
+	}
+	sort.SliceStable(merged.Data, func(a, b int) bool {
+		return merged.Data[a]["index"].(int) < merged.Data[b]["index"].(int)
+	})
+	return json.Marshal(merged)
+}
+
+// bufferedResponseWriter captures the response of one part of a split request
+// instead of writing it to the client.
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedResponseWriter(w gin.ResponseWriter) *bufferedResponseWriter {
+	return &bufferedResponseWriter{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header               { return w.header }
+func (w *bufferedResponseWriter) WriteHeader(code int)              { w.status = code }
+func (w *bufferedResponseWriter) WriteHeaderNow()                   {}
+func (w *bufferedResponseWriter) Write(b []byte) (int, error)       { return w.body.Write(b) }
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+func (w *bufferedResponseWriter) Status() int                       { return w.status }
+func (w *bufferedResponseWriter) Size() int                         { return w.body.Len() }
+func (w *bufferedResponseWriter) Written() bool                     { return w.body.Len() > 0 }
+func (w *bufferedResponseWriter) Flush()                            {}
+
+// embeddingsPartResponse is the buffered response to one part of a split embeddings request.
+type embeddingsPartResponse struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// runSplitEmbeddings sends the parts in order with send and merges their responses. When a part
+// fails, its response is returned with the error and the remaining parts are not sent, so the
+// client never receives a partial result.
+func runSplitEmbeddings(parts [][]byte, send func(part []byte) embeddingsPartResponse) ([]byte, *embeddingsPartResponse, error) {
+	responses := make([][]byte, 0, len(parts))
+	offsets := make([]int, 0, len(parts))
+	offset := 0
+	for i, part := range parts {
+		resp := send(part)
+		if resp.status >= http.StatusBadRequest {
+			return nil, &resp, fmt.Errorf("embeddings part %d/%d failed: %s", i+1, len(parts), utils.TruncateString(string(resp.body), 500))
+		}
+
+		var inputs struct {
+			Input []json.RawMessage `json:"input"`
+		}
+		_ = json.Unmarshal(part, &inputs)
+		responses = append(responses, resp.body)
+		offsets = append(offsets, offset)
+		offset += len(inputs.Input)
+	}
+
+	merged, err := mergeEmbeddingsResponses(responses, offsets)
+	return merged, nil, err
+}
+
+// executeSplitEmbeddings sends the parts of a split embeddings request one after another, each with
+// the usual key selection and retries, and responds with the merged result. If a part still fails
+// after its retries, its error is returned to the client and the remaining parts are not sent.
+// retryDisabled is the reason retries are disabled for the whole request, if any.
+func (ps *ProxyServer) executeSplitEmbeddings(
+	c *gin.Context,
+	channelHandler channel.ChannelProxy,
+	group *models.Group,
+	originalBody []byte,
+	parts [][]byte,
+	startTime time.Time,
+	retryDisabled string,
+) {
+	clientWriter := c.Writer
+	// 由传输层自动解压，便于合并各部分的响应
+	c.Request.Header.Del("Accept-Encoding")
+	c.Set(embeddingsSubRequestKey, true)
+
+	var firstTiming upstreamTiming
+	merged, failed, err := runSplitEmbeddings(parts, func(part []byte) embeddingsPartResponse {
+		writer := newBufferedResponseWriter(clientWriter)
+		c.Writer = writer
+		ps.executeRequestWithRetry(c, channelHandler, group, part, false, startTime, 0)
+		c.Writer = clientWriter
+
+		if value, exists := c.Get(upstreamTimingKey); exists && firstTiming.SentAt.IsZero() {
+			firstTiming, _ = value.(upstreamTiming)
+		}
+		return embeddingsPartResponse{status: writer.status, contentType: writer.header.Get("Content-Type"), body: writer.body.Bytes()}
+	})
+
+	if failed != nil {
+		if retryDisabled != "" {
+			c.Header(retriesDisabledHeader, retryDisabled)
+		}
+		c.Data(failed.status, failed.contentType, failed.body)
+		ps.logSplitEmbeddings(c, group, channelHandler, originalBody, startTime, firstTiming, failed.status, err)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("Failed to merge split embeddings responses for group %s: %v", group.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": err.Error(), "type": "upstream_error"}})
+		ps.logSplitEmbeddings(c, group, channelHandler, originalBody, startTime, firstTiming, http.StatusBadGateway, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", merged)
+	ps.logSplitEmbeddings(c, group, channelHandler, originalBody, startTime, firstTiming, http.StatusOK, nil)
+}
+
+// logSplitEmbeddings records a split embeddings request as a single final request log,
+// timed from the first part being sent to the last part's response.
+func (ps *ProxyServer) logSplitEmbeddings(
+	c *gin.Context,
+	group *models.Group,
+	channelHandler channel.ChannelProxy,
+	originalBody []byte,
+	startTime time.Time,
+	firstTiming upstreamTiming,
+	statusCode int,
+	finalError error,
+) {
+	if value, exists := c.Get(upstreamTimingKey); exists {
+		if last, ok := value.(upstreamTiming); ok && !firstTiming.SentAt.IsZero() {
+			c.Set(upstreamTimingKey, upstreamTiming{SentAt: firstTiming.SentAt, ReceivedAt: last.ReceivedAt})
+		}
+	}
+	c.Set(embeddingsSubRequestKey, false)
+	ps.logRequest(c, group, nil, startTime, statusCode, finalError, false, "", channelHandler, originalBody, models.RequestTypeFinal)
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/types"
+)
+
+// embeddingsPartBody answers one part of a split request the way an upstream does, with one
+// embedding per input indexed from 0 within the part, optionally listed in reverse order.
+func embeddingsPartBody(t *testing.T, part []byte, reversed bool, usage map[string]int) []byte {
+	t.Helper()
+	var req struct {
+		Input []string `json:"input"`
+	}
+	if err := json.Unmarshal(part, &req); err != nil {
+		t.Fatalf("part body is not an embeddings request: %v", err)
+	}
+	data := make([]map[string]any, 0, len(req.Input))
+	for i, input := range req.Input {
+		item := map[string]any{"object": "embedding", "index": i, "embedding": []string{input}}
+		if reversed {
+			data = append([]map[string]any{item}, data...)
+		} else {
+			data = append(data, item)
+		}
+	}
+	body, err := json.Marshal(map[string]any{"object": "list", "data": data, "model": "text-embedding-3-small", "usage": usage})
+	if err != nil {
+		t.Fatalf("marshal part response: %v", err)
+	}
+	return body
+}
+
+func TestRunSplitEmbeddings(t *testing.T) {
+	cfg := types.SystemSettings{EmbeddingsMaxInputs: 2, EmbeddingsAutoSplit: true, EmbeddingsMaxSubRequests: 8}
+
+	tests := []struct {
+		name       string
+		inputs     []string
+		reversed   bool
+		usage      map[string]int
+		fail       map[int]embeddingsPartResponse // 按部分序号返回的失败响应
+		wantSent   int
+		wantUsage  map[string]float64
+		wantStatus int
+		wantErr    string
+	}{
+		{
+			name:      "two parts in order",
+			inputs:    []string{"a", "b", "c", "d"},
+			usage:     map[string]int{"prompt_tokens": 2, "total_tokens": 2},
+			wantSent:  2,
+			wantUsage: map[string]float64{"prompt_tokens": 4, "total_tokens": 4},
+		},
+		{
+			name:      "uneven last part",
+			inputs:    []string{"a", "b", "c", "d", "e"},
+			usage:     map[string]int{"prompt_tokens": 3, "total_tokens": 5},
+			wantSent:  3,
+			wantUsage: map[string]float64{"prompt_tokens": 9, "total_tokens": 15},
+		},
+		{
+			name:      "parts answered out of order",
+			inputs:    []string{"a", "b", "c", "d", "e", "f"},
+			reversed:  true,
+			usage:     map[string]int{"prompt_tokens": 1, "total_tokens": 1},
+			wantSent:  3,
+			wantUsage: map[string]float64{"prompt_tokens": 3, "total_tokens": 3},
+		},
+		{
+			name:       "first part fails",
+			inputs:     []string{"a", "b", "c", "d"},
+			fail:       map[int]embeddingsPartResponse{0: {status: http.StatusTooManyRequests, contentType: "application/json", body: []byte(`{"error":{"message":"rate limited"}}`)}},
+			wantSent:   1,
+			wantStatus: http.StatusTooManyRequests,
+			wantErr:    "embeddings part 1/2 failed",
+		},
+		{
+			name:       "middle part fails with upstream status",
+			inputs:     []string{"a", "b", "c", "d", "e", "f"},
+			fail:       map[int]embeddingsPartResponse{1: {status: http.StatusServiceUnavailable, contentType: "application/json", body: []byte(`{"error":{"message":"overloaded"}}`)}},
+			wantSent:   2,
+			wantStatus: http.StatusServiceUnavailable,
+			wantErr:    "embeddings part 2/3 failed",
+		},
+		{
+			// 传输错误在重试耗尽后以代理自身的错误响应返回
+			name:       "last part fails with transport error",
+			inputs:     []string{"a", "b", "c", "d"},
+			fail:       map[int]embeddingsPartResponse{1: {status: http.StatusInternalServerError, contentType: "application/json", body: []byte(`{"code":"UPSTREAM_ERROR","message":"connection reset by peer"}`)}},
+			wantSent:   2,
+			wantStatus: http.StatusInternalServerError,
+			wantErr:    "connection reset by peer",
+		},
+		{
+			name:     "invalid part response",
+			inputs:   []string{"a", "b", "c", "d"},
+			fail:     map[int]embeddingsPartResponse{1: {status: http.StatusOK, contentType: "text/plain", body: []byte("not json")}},
+			wantSent: 2,
+			wantErr:  "invalid embeddings response for part 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(tt.inputs)
+			parts, err := planEmbeddings("/v1/embeddings", fmt.Appendf(nil, `{"model":"text-embedding-3-small","input":%s}`, input), cfg)
+			if err != nil || len(parts) == 0 {
+				t.Fatalf("planEmbeddings() = %d parts, %v, want a split request", len(parts), err)
+			}
+
+			sent := 0
+			merged, failed, err := runSplitEmbeddings(parts, func(part []byte) embeddingsPartResponse {
+				defer func() { sent++ }()
+				if resp, ok := tt.fail[sent]; ok {
+					return resp
+				}
+				return embeddingsPartResponse{status: http.StatusOK, contentType: "application/json", body: embeddingsPartBody(t, part, tt.reversed, tt.usage)}
+			})
+
+			if sent != tt.wantSent {
+				t.Errorf("sent %d parts, want %d", sent, tt.wantSent)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				// 任一部分失败时不返回部分合并的结果
+				if merged != nil {
+					t.Errorf("merged = %s, want no result", merged)
+				}
+				if tt.wantStatus != 0 && (failed == nil || failed.status != tt.wantStatus) {
+					t.Errorf("failed part = %+v, want status %d", failed, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil || failed != nil {
+				t.Fatalf("runSplitEmbeddings() failed part = %+v, error = %v", failed, err)
+			}
+
+			var resp struct {
+				Object string `json:"object"`
+				Data   []struct {
+					Index     int      `json:"index"`
+					Embedding []string `json:"embedding"`
+				} `json:"data"`
+				Usage map[string]float64 `json:"usage"`
+			}
+			if err := json.Unmarshal(merged, &resp); err != nil {
+				t.Fatalf("merged response is not JSON: %v", err)
+			}
+			if len(resp.Data) != len(tt.inputs) {
+				t.Fatalf("merged %d embeddings, want %d", len(resp.Data), len(tt.inputs))
+			}
+			for i, item := range resp.Data {
+				if item.Index != i || len(item.Embedding) != 1 || item.Embedding[0] != tt.inputs[i] {
+					t.Errorf("data[%d] = index %d for input %v, want index %d for input %q", i, item.Index, item.Embedding, i, tt.inputs[i])
+				}
+			}
+			if fmt.Sprint(resp.Usage) != fmt.Sprint(tt.wantUsage) {
+				t.Errorf("usage = %v, want %v", resp.Usage, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestMergeEmbeddingsResponses(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		offsets   []int
+		wantIndex []int
+		wantUsage string
+	}{
+		{
+			name:      "offsets applied per part",
+			responses: []string{`{"data":[{"index":0},{"index":1}],"usage":{"total_tokens":2}}`, `{"data":[{"index":0}],"usage":{"total_tokens":1}}`},
+			offsets:   []int{0, 2},
+			wantIndex: []int{0, 1, 2},
+			wantUsage: `{"total_tokens":3}`,
+		},
+		{
+			name:      "unordered items sorted",
+			responses: []string{`{"data":[{"index":1},{"index":0}]}`, `{"data":[{"index":1},{"index":0}]}`},
+			offsets:   []int{0, 2},
+			wantIndex: []int{0, 1, 2, 3},
+		},
+		{
+			name:      "non-numeric usage ignored",
+			responses: []string{`{"data":[{"index":0}],"usage":{"prompt_tokens":5,"note":"x"}}`, `{"data":[{"index":0}],"usage":{"prompt_tokens":7}}`},
+			offsets:   []int{0, 1},
+			wantIndex: []int{0, 1},
+			wantUsage: `{"prompt_tokens":12}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := make([][]byte, len(tt.responses))
+			for i, r := range tt.responses {
+				responses[i] = []byte(r)
+			}
+			merged, err := mergeEmbeddingsResponses(responses, tt.offsets)
+			if err != nil {
+				t.Fatalf("mergeEmbeddingsResponses() error = %v", err)
+			}
+			var resp struct {
+				Data []struct {
+					Index int `json:"index"`
+				} `json:"data"`
+				Usage json.RawMessage `json:"usage"`
+			}
+			if err := json.Unmarshal(merged, &resp); err != nil {
+				t.Fatalf("merged response is not JSON: %v", err)
+			}
+			var indexes []int
+			for _, item := range resp.Data {
+				indexes = append(indexes, item.Index)
+			}
+			if fmt.Sprint(indexes) != fmt.Sprint(tt.wantIndex) {
+				t.Errorf("indexes = %v, want %v", indexes, tt.wantIndex)
+			}
+			if string(resp.Usage) != tt.wantUsage {
+				t.Errorf("usage = %s, want %s", resp.Usage, tt.wantUsage)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	contentMD5Header    = "Content-MD5"
+	contentSHA256Header = "X-Content-SHA256"
+)
+
+// errIntegrityCheckFailed is recorded in the request log when a response body does not match its checksum.
+var errIntegrityCheckFailed = errors.New("integrity_check_failed")
+
+// integrityFailureEvent is the final SSE event sent when a stream does not match its checksum.
+const integrityFailureEvent = "event: error\ndata: {\"error\":\"integrity_check_failed\"}\n\n"
+
+// checksumVerifier hashes an upstream response body as it is read, to compare it with the
+// checksum the upstream declared in Content-MD5 or X-Content-SHA256.
+type checksumVerifier struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+	header   string
+	keyID    uint
+	metrics  *metrics.Metrics
+	failed   bool
+}
+
+// newChecksumVerifier wraps the response body if the upstream declared a checksum, or returns nil.
+// X-Content-SHA256 takes precedence. A body the transport decompressed itself no longer matches
+// the checksum of what the upstream sent, so it is not verified.
+func newChecksumVerifier(resp *http.Response, keyID uint, appMetrics *metrics.Metrics) *checksumVerifier {
+	if resp.Uncompressed {
+		return nil
+	}
+
+	v := &checksumVerifier{ReadCloser: resp.Body, keyID: keyID, metrics: appMetrics}
+	if value := resp.Header.Get(contentSHA256Header); value != "" {
+		v.hash, v.header, v.expected = sha256.New(), contentSHA256Header, decodeChecksum(value, sha256.Size)
+	} else if value := resp.Header.Get(contentMD5Header); value != "" {
+		v.hash, v.header, v.expected = md5.New(), contentMD5Header, decodeChecksum(value, md5.Size)
+	}
+	if v.hash == nil {
+		return nil
+	}
+	if v.expected == nil {
+		logrus.Debugf("Ignoring malformed %s response header", v.header)
+		return nil
+	}
+	resp.Body = v
+	return v
+}
+
+// decodeChecksum decodes a base64 (RFC 1864) or hex digest of the given size, or returns nil.
+func decodeChecksum(value string, size int) []byte {
+	value = strings.TrimSpace(value)
+	if sum, err := base64.StdEncoding.DecodeString(value); err == nil && len(sum) == size {
+		return sum
+	}
+	if sum, err := hex.DecodeString(value); err == nil && len(sum) == size {
+		return sum
+	}
+	return nil
+}
+
+func (v *checksumVerifier) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.hash.Write(p[:n])
+	return n, err
+}
+
+// verify compares the hash of the body read so far with the declared checksum. It must only be
+// called once the body has been read to EOF.
+func (v *checksumVerifier) verify() bool {
+	if bytes.Equal(v.hash.Sum(nil), v.expected) {
+		return true
+	}
+	v.failed = true
+	v.metrics.IntegrityCheckFailures.WithLabelValues(metrics.KeyIDLabel(v.keyID)).Inc()
+	logrus.Warnf("Upstream response body does not match its %s header (key %d)", v.header, v.keyID)
+	return false
+}
+
+// bufferVerifiedBody reads a non-streaming response body and verifies it before anything is sent
+// to the client. On success the buffered body replaces the response body. If the body cannot be
+// read completely it is not verified; the bytes read so far and the error are passed on as is.
+func bufferVerifiedBody(resp *http.Response, v *checksumVerifier) bool {
+	data, err := io.ReadAll(v)
+	v.ReadCloser.Close()
+	var rest io.Reader = bytes.NewReader(data)
+	if err != nil {
+		rest = io.MultiReader(rest, errReader{err})
+	}
+	resp.Body = io.NopCloser(rest)
+	if err != nil {
+		return true
+	}
+	return v.verify()
+}
+
+// errReader returns err on every read.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
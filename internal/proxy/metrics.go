@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	upstreamIdempotencyHeader         = "Idempotency-Key"
+	upstreamIdempotencyReplayedHeader = "Idempotency-Replayed"
+)
+
+// observeUpstreamConnection counts an upstream request of the group, and its connection error if any.
+// Errors caused by the client going away are not connection errors of the upstream.
+func (ps *ProxyServer) observeUpstreamConnection(group string, err error, clientGone bool) {
+	ps.metrics.GroupUpstreamRequests.WithLabelValues(group).Inc()
+	if err == nil || clientGone {
+		return
+	}
+	if reason := connectionErrorReason(err); reason != "" {
+		ps.metrics.GroupConnectionErrors.WithLabelValues(group, reason).Inc()
+	}
+}
+
+// observeUpstreamResponse counts an upstream attempt by the upstream's origin and status code.
+// Attempts abandoned because the client went away are not counted against the upstream.
+func (ps *ProxyServer) observeUpstreamResponse(group, upstreamURL string, resp *http.Response, err error, clientGone bool) {
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	} else if clientGone {
+		return
+	}
+	upstream := upstreamURL
+	if u, parseErr := url.Parse(upstreamURL); parseErr == nil {
+		upstream = u.Scheme + "://" + u.Host
+	}
+	ps.metrics.UpstreamResponses.WithLabelValues(group, upstream, code).Inc()
+}
+
+// connectionErrorReason classifies a transport error. "closed" and "eof" usually mean the provider
+// closed an idle connection before the transport did, i.e. the keep-alive timeout is too long.
+func connectionErrorReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, net.ErrClosed) || strings.Contains(err.Error(), "use of closed network connection"):
+		return "closed"
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return "eof"
+	case errors.Is(err, syscall.ECONNRESET) || strings.Contains(err.Error(), "connection reset by peer"):
+		return "reset"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, new(*net.OpError)):
+		return "other"
+	default:
+		return ""
+	}
+}
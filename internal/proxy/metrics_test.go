@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"gpt-load/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveUpstreamResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		upstreamURL  string
+		resp         *http.Response
+		err          error
+		clientGone   bool
+		wantUpstream string
+		wantCode     string // 为空时不计数
+	}{
+		{name: "status code", upstreamURL: "https://api.example.com/v1/chat/completions", resp: &http.Response{StatusCode: http.StatusOK}, wantUpstream: "https://api.example.com", wantCode: "200"},
+		{name: "error status", upstreamURL: "https://api.example.com:8443/v1", resp: &http.Response{StatusCode: http.StatusTooManyRequests}, wantUpstream: "https://api.example.com:8443", wantCode: "429"},
+		{name: "no response", upstreamURL: "http://10.0.0.1/v1", err: errors.New("connection refused"), wantUpstream: "http://10.0.0.1", wantCode: "error"},
+		{name: "response after client gone", upstreamURL: "https://api.example.com/v1", resp: &http.Response{StatusCode: http.StatusBadGateway}, clientGone: true, wantUpstream: "https://api.example.com", wantCode: "502"},
+		{name: "client gone without response", upstreamURL: "https://api.example.com/v1", err: context.Canceled, clientGone: true, wantUpstream: "https://api.example.com"},
+	}
+
+	ps := &ProxyServer{metrics: metrics.NewMetrics(prometheus.NewRegistry())}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := "observe-" + tt.name
+			ps.observeUpstreamResponse(group, tt.upstreamURL, tt.resp, tt.err, tt.clientGone)
+
+			for _, code := range []string{"200", "429", "502", "error"} {
+				want := 0.0
+				if code == tt.wantCode {
+					want = 1
+				}
+				if got := testutil.ToFloat64(ps.metrics.UpstreamResponses.WithLabelValues(group, tt.wantUpstream, code)); got != want {
+					t.Errorf("upstream responses with code %s = %v, want %v", code, got, want)
+				}
+			}
+		})
+	}
+}
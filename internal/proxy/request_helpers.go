@@ -4,11 +4,21 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"gpt-load/internal/channel"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
@@ -30,6 +40,171 @@ func (ps *ProxyServer) applyParamOverrides(bodyBytes []byte, group *models.Group
 	return json.Marshal(requestData)
 }
 
+// applyRequiredHeaders injects defaults for omitted required headers.
+// It returns the name of the first required header that is missing and has no default.
+func applyRequiredHeaders(req *http.Request, group *models.Group) string {
+	for _, header := range group.RequiredHeaderList {
+		if req.Header.Get(header.Key) != "" {
+			continue
+		}
+		if header.Default == "" {
+			return header.Key
+		}
+		req.Header.Set(header.Key, header.Default)
+	}
+	return ""
+}
+
+// applyQueryParamPolicy filters query parameters that are not in the group's allowlist.
+// In strip mode unknown parameters are removed; in reject mode the name of the first
+// unknown parameter is returned and the request is left unchanged.
+func applyQueryParamPolicy(req *http.Request, group *models.Group) string {
+	mode := group.EffectiveConfig.UnknownQueryParams
+	if mode != models.QueryParamModeStrip && mode != models.QueryParamModeReject {
+		return ""
+	}
+
+	allowed := utils.StringToSet(group.EffectiveConfig.AllowedQueryParams, ",")
+	query := req.URL.Query()
+	var unknown []string
+	for name := range query {
+		if _, ok := allowed[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return ""
+	}
+	sort.Strings(unknown)
+
+	if mode == models.QueryParamModeReject {
+		return unknown[0]
+	}
+
+	for _, name := range unknown {
+		query.Del(name)
+	}
+	req.URL.RawQuery = query.Encode()
+	logrus.Debugf("Stripped unknown query parameters for group %s: %v", group.Name, unknown)
+	return ""
+}
+
+// requestDeadline returns the deadline bounding all attempts of a request: startTime plus the
+// total timeout budget, or the client's declared deadline when it is earlier. A budget of 0 means
+// no limit. clientBound reports whether the client's deadline is the one that applies.
+func requestDeadline(startTime time.Time, budget time.Duration, clientDeadline time.Time, hasClientDeadline bool) (deadline time.Time, hasDeadline, clientBound bool) {
+	deadline = startTime.Add(budget)
+	hasDeadline = budget > 0
+	// 客户端声明的超时早于总预算时以其为准，客户端放弃等待后不再请求上游
+	if hasClientDeadline && (!hasDeadline || clientDeadline.Before(deadline)) {
+		return clientDeadline, true, true
+	}
+	return deadline, hasDeadline, false
+}
+
+// attemptTimeout returns the timeout of a non-streaming attempt: the group's request timeout,
+// shortened to the time remaining until the request deadline.
+func attemptTimeout(requestTimeout, remaining time.Duration, hasDeadline bool) time.Duration {
+	if hasDeadline && remaining < requestTimeout {
+		return remaining
+	}
+	return requestTimeout
+}
+
+// retryDisabledReason returns why retries and key failover are disabled for the request, or "" when
+// they are allowed. Any caller may disable them, since doing so only reduces what the proxy does.
+func retryDisabledReason(c *gin.Context, group *models.Group, dedupHeader string) string {
+	if noRetry, err := strconv.ParseBool(c.GetHeader(noRetryHeader)); err == nil && noRetry {
+		return retryDisabledByCaller
+	}
+	if group.EffectiveConfig.RetriesRequireIdempotencyKey {
+		if c.GetHeader(upstreamIdempotencyHeader) == "" && (dedupHeader == "" || c.GetHeader(dedupHeader) == "") {
+			return retryDisabledNoIdempotencyKey
+		}
+	}
+	return ""
+}
+
+// readRetryableBody reads the request body so that it can be replayed on retries, buffering at most
+// maxBytes of it; 0 means no limit. It returns the whole body and true when the body fits, or the
+// bytes read so far and false when it is larger, leaving the rest of the body unread.
+func readRetryableBody(body io.Reader, maxBytes int) ([]byte, bool, error) {
+	if maxBytes <= 0 {
+		data, err := io.ReadAll(body)
+		return data, true, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, false, err
+	}
+	return data, len(data) <= maxBytes, nil
+}
+
+// retryDisabledMessage explains in the final error why the request was not retried.
+func retryDisabledMessage(reason string) string {
+	switch reason {
+	case retryDisabledByCaller:
+		return "retries were disabled by the caller (" + noRetryHeader + ")"
+	case retryDisabledBodyTooLarge:
+		return "retries were disabled because the request body exceeds the retry size limit"
+	default:
+		return "retries were disabled because the request has no " + upstreamIdempotencyHeader + " header"
+	}
+}
+
+// isRetryableStatus reports whether an upstream error status may be retried with another key.
+// Without a configured list every error status is retryable.
+func isRetryableStatus(cfg types.SystemSettings, statusCode int) bool {
+	codes, err := models.ParseRetryStatusCodes(cfg.RetryStatusCodes)
+	if err != nil || len(codes) == 0 {
+		return true
+	}
+	return slices.Contains(codes, statusCode)
+}
+
+// retryBackoff returns the wait before the next attempt. With a maximum above the base interval
+// the wait doubles on every retry up to the maximum, with jitter so that concurrent requests
+// failing together do not retry in lockstep; otherwise the base interval is used as is.
+func retryBackoff(cfg types.SystemSettings, retryCount int) time.Duration {
+	backoff := time.Duration(cfg.RetryBackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(cfg.RetryBackoffMaxMs) * time.Millisecond
+	if backoff <= 0 || maxBackoff <= backoff {
+		return backoff
+	}
+	for i := 0; i < retryCount && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxBackoff)
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// buildUpstreamURL constructs the upstream URL, routing by model for channels that need it.
+func buildUpstreamURL(channelHandler channel.ChannelProxy, originalURL *url.URL, group *models.Group, model string) (string, error) {
+	if router, ok := channelHandler.(channel.ModelRouter); ok {
+		return router.BuildModelUpstreamURL(originalURL, group, model)
+	}
+	return channelHandler.BuildUpstreamURL(originalURL, group)
+}
+
+// translateChatParams adapts OpenAI chat parameters for channels whose compatibility endpoint
+// lacks them. It returns the translated body and the parameters that could not be fully translated.
+func translateChatParams(channelHandler channel.ChannelProxy, path string, bodyBytes []byte) ([]byte, []string) {
+	translator, ok := channelHandler.(channel.ChatParamTranslator)
+	if !ok || len(bodyBytes) == 0 {
+		return bodyBytes, nil
+	}
+
+	translation, err := translator.TranslateChatParams(path, bodyBytes)
+	if err != nil {
+		logrus.Warnf("failed to translate chat parameters, passing through: %v", err)
+		return bodyBytes, nil
+	}
+	if translation == nil {
+		return bodyBytes, nil
+	}
+	return translation.Body, translation.Dropped
+}
+
 // logUpstreamError provides a centralized way to log errors from upstream interactions.
 func logUpstreamError(context string, err error) {
 	if err == nil {
@@ -42,6 +217,31 @@ func logUpstreamError(context string, err error) {
 	}
 }
 
+// compressUpstreamBody gzips the request body for groups with request compression enabled.
+// Streaming requests, bodies below the threshold, bodies the client already encoded and bodies
+// that would not shrink are sent unchanged; the second result reports whether it was compressed.
+func compressUpstreamBody(group *models.Group, header http.Header, bodyBytes []byte, isStream bool) ([]byte, bool) {
+	cfg := group.EffectiveConfig
+	if !cfg.RequestCompression || isStream || len(bodyBytes) == 0 || len(bodyBytes) < cfg.RequestCompressionMinBytes || header.Get("Content-Encoding") != "" {
+		return bodyBytes, false
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(bodyBytes); err != nil {
+		logrus.Warnf("Failed to compress upstream request body, sending it uncompressed: %v", err)
+		return bodyBytes, false
+	}
+	if err := writer.Close(); err != nil {
+		logrus.Warnf("Failed to compress upstream request body, sending it uncompressed: %v", err)
+		return bodyBytes, false
+	}
+	if buf.Len() >= len(bodyBytes) {
+		return bodyBytes, false
+	}
+	return buf.Bytes(), true
+}
+
 // handleGzipCompression checks for gzip encoding and decompresses the body if necessary.
 func handleGzipCompression(resp *http.Response, bodyBytes []byte) []byte {
 	if resp.Header.Get("Content-Encoding") == "gzip" {
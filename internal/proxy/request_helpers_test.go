@@ -0,0 +1,379 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+)
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestReadRetryableBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		maxBytes      int
+		wantBody      string
+		wantRetryable bool
+	}{
+		{name: "no limit", body: strings.Repeat("a", 100), maxBytes: 0, wantBody: strings.Repeat("a", 100), wantRetryable: true},
+		{name: "empty", body: "", maxBytes: 10, wantBody: "", wantRetryable: true},
+		{name: "under limit", body: "hello", maxBytes: 10, wantBody: "hello", wantRetryable: true},
+		{name: "at limit", body: "0123456789", maxBytes: 10, wantBody: "0123456789", wantRetryable: true},
+		{name: "one over limit", body: "0123456789x", maxBytes: 10, wantBody: "0123456789x", wantRetryable: false},
+		{name: "far over limit", body: strings.Repeat("b", 1000), maxBytes: 10, wantBody: strings.Repeat("b", 11), wantRetryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &countingReader{r: strings.NewReader(tt.body)}
+			got, retryable, err := readRetryableBody(reader, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("readRetryableBody() error = %v", err)
+			}
+			if retryable != tt.wantRetryable {
+				t.Errorf("retryable = %v, want %v", retryable, tt.wantRetryable)
+			}
+			if string(got) != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if tt.maxBytes > 0 && reader.n > tt.maxBytes+1 {
+				t.Errorf("read %d bytes from the body, want at most %d", reader.n, tt.maxBytes+1)
+			}
+
+			// 超过上限时已读部分与剩余部分拼接后应得到完整请求体
+			rest, err := io.ReadAll(io.MultiReader(bytes.NewReader(got), reader))
+			if err != nil {
+				t.Fatalf("reading the rest of the body: %v", err)
+			}
+			if string(rest) != tt.body {
+				t.Errorf("reassembled body has %d bytes, want %d", len(rest), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestReadRetryableBodyError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	for _, maxBytes := range []int{0, 10} {
+		_, _, err := readRetryableBody(io.MultiReader(strings.NewReader("abc"), errReader{readErr}), maxBytes)
+		if !errors.Is(err, readErr) {
+			t.Errorf("maxBytes %d: error = %v, want %v", maxBytes, err, readErr)
+		}
+	}
+}
+
+func TestApplyRequiredHeaders(t *testing.T) {
+	required := []models.RequiredHeader{
+		{Key: "X-Tenant"},
+		{Key: "X-Region", Default: "us-east"},
+	}
+	tests := []struct {
+		name        string
+		required    []models.RequiredHeader
+		headers     map[string]string
+		wantMissing string
+		wantHeaders map[string]string
+	}{
+		{name: "no required headers", wantHeaders: map[string]string{"X-Tenant": ""}},
+		{name: "all present", required: required, headers: map[string]string{"X-Tenant": "acme", "X-Region": "eu"}, wantHeaders: map[string]string{"X-Tenant": "acme", "X-Region": "eu"}},
+		{name: "default injected", required: required, headers: map[string]string{"X-Tenant": "acme"}, wantHeaders: map[string]string{"X-Tenant": "acme", "X-Region": "us-east"}},
+		{name: "missing without default", required: required, headers: map[string]string{"X-Region": "eu"}, wantMissing: "X-Tenant"},
+		{name: "case insensitive", required: required, headers: map[string]string{"x-tenant": "acme"}, wantHeaders: map[string]string{"X-Tenant": "acme", "X-Region": "us-east"}},
+		{name: "empty value counts as missing", required: required, headers: map[string]string{"X-Tenant": ""}, wantMissing: "X-Tenant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/proxy/test/v1/chat/completions", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			group := &models.Group{RequiredHeaderList: tt.required}
+
+			if missing := applyRequiredHeaders(req, group); missing != tt.wantMissing {
+				t.Fatalf("applyRequiredHeaders() = %q, want %q", missing, tt.wantMissing)
+			}
+			for key, want := range tt.wantHeaders {
+				if got := req.Header.Get(key); got != want {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		budget            time.Duration
+		clientDeadline    time.Time
+		hasClientDeadline bool
+		wantDeadline      time.Time
+		wantHasDeadline   bool
+		wantClientBound   bool
+	}{
+		{name: "no budget", budget: 0, wantHasDeadline: false},
+		{name: "budget", budget: 30 * time.Second, wantDeadline: start.Add(30 * time.Second), wantHasDeadline: true},
+		{
+			name:              "client deadline without budget",
+			clientDeadline:    start.Add(10 * time.Second),
+			hasClientDeadline: true,
+			wantDeadline:      start.Add(10 * time.Second),
+			wantHasDeadline:   true,
+			wantClientBound:   true,
+		},
+		{
+			name:              "client deadline before budget",
+			budget:            30 * time.Second,
+			clientDeadline:    start.Add(10 * time.Second),
+			hasClientDeadline: true,
+			wantDeadline:      start.Add(10 * time.Second),
+			wantHasDeadline:   true,
+			wantClientBound:   true,
+		},
+		{
+			name:              "client deadline after budget",
+			budget:            30 * time.Second,
+			clientDeadline:    start.Add(time.Minute),
+			hasClientDeadline: true,
+			wantDeadline:      start.Add(30 * time.Second),
+			wantHasDeadline:   true,
+		},
+		{
+			name:              "client deadline already passed",
+			budget:            30 * time.Second,
+			clientDeadline:    start.Add(-time.Second),
+			hasClientDeadline: true,
+			wantDeadline:      start.Add(-time.Second),
+			wantHasDeadline:   true,
+			wantClientBound:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadline, hasDeadline, clientBound := requestDeadline(start, tt.budget, tt.clientDeadline, tt.hasClientDeadline)
+			if hasDeadline != tt.wantHasDeadline || clientBound != tt.wantClientBound {
+				t.Fatalf("requestDeadline() hasDeadline = %v, clientBound = %v, want %v, %v", hasDeadline, clientBound, tt.wantHasDeadline, tt.wantClientBound)
+			}
+			if hasDeadline && !deadline.Equal(tt.wantDeadline) {
+				t.Errorf("deadline = %v, want %v", deadline, tt.wantDeadline)
+			}
+		})
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestTimeout time.Duration
+		remaining      time.Duration
+		hasDeadline    bool
+		want           time.Duration
+	}{
+		{name: "no deadline", requestTimeout: 60 * time.Second, remaining: -time.Second, want: 60 * time.Second},
+		{name: "budget longer than timeout", requestTimeout: 60 * time.Second, remaining: 90 * time.Second, hasDeadline: true, want: 60 * time.Second},
+		{name: "budget shortens timeout", requestTimeout: 60 * time.Second, remaining: 5 * time.Second, hasDeadline: true, want: 5 * time.Second},
+		{name: "budget exhausted", requestTimeout: 60 * time.Second, remaining: -time.Second, hasDeadline: true, want: -time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attemptTimeout(tt.requestTimeout, tt.remaining, tt.hasDeadline); got != tt.want {
+				t.Errorf("attemptTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyQueryParamPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		allowed     string
+		query       string
+		wantUnknown string
+		wantQuery   string
+	}{
+		{name: "passthrough by default", mode: "", allowed: "", query: "a=1&debug=true", wantQuery: "a=1&debug=true"},
+		{name: "passthrough ignores allowlist", mode: models.QueryParamModePassthrough, allowed: "a", query: "a=1&debug=true", wantQuery: "a=1&debug=true"},
+		{name: "strip unknown", mode: models.QueryParamModeStrip, allowed: "api-version", query: "api-version=2024-02-01&debug=true&trace=1", wantQuery: "api-version=2024-02-01"},
+		{name: "strip keeps repeated allowed values", mode: models.QueryParamModeStrip, allowed: "tag, alt", query: "tag=a&tag=b&x=1", wantQuery: "tag=a&tag=b"},
+		{name: "strip with nothing unknown leaves query as is", mode: models.QueryParamModeStrip, allowed: "b,a", query: "b=2&a=1", wantQuery: "b=2&a=1"},
+		{name: "strip everything without allowlist", mode: models.QueryParamModeStrip, allowed: "", query: "debug=true", wantQuery: ""},
+		{name: "reject unknown", mode: models.QueryParamModeReject, allowed: "api-version", query: "api-version=1&debug=true", wantUnknown: "debug", wantQuery: "api-version=1&debug=true"},
+		{name: "reject allows known", mode: models.QueryParamModeReject, allowed: "api-version", query: "api-version=1", wantQuery: "api-version=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/proxy/test/v1/chat/completions?"+tt.query, nil)
+			group := &models.Group{Name: "test"}
+			group.EffectiveConfig.UnknownQueryParams = tt.mode
+			group.EffectiveConfig.AllowedQueryParams = tt.allowed
+
+			if unknown := applyQueryParamPolicy(req, group); unknown != tt.wantUnknown {
+				t.Fatalf("applyQueryParamPolicy() = %q, want %q", unknown, tt.wantUnknown)
+			}
+			if req.URL.RawQuery != tt.wantQuery {
+				t.Errorf("query = %q, want %q", req.URL.RawQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		backoffMs  int
+		maxMs      int
+		retryCount int
+		wantMin    time.Duration
+		wantMax    time.Duration
+	}{
+		{name: "no backoff", retryCount: 3},
+		{name: "fixed interval", backoffMs: 200, retryCount: 3, wantMin: 200 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{name: "maximum not above interval", backoffMs: 200, maxMs: 200, retryCount: 3, wantMin: 200 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{name: "first retry", backoffMs: 100, maxMs: 1000, retryCount: 0, wantMin: 50 * time.Millisecond, wantMax: 100 * time.Millisecond},
+		{name: "doubles per retry", backoffMs: 100, maxMs: 1000, retryCount: 2, wantMin: 200 * time.Millisecond, wantMax: 400 * time.Millisecond},
+		{name: "capped at maximum", backoffMs: 100, maxMs: 1000, retryCount: 10, wantMin: 500 * time.Millisecond, wantMax: time.Second},
+		{name: "large retry count", backoffMs: 100, maxMs: 1000, retryCount: 1000, wantMin: 500 * time.Millisecond, wantMax: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := types.SystemSettings{RetryBackoffMs: tt.backoffMs, RetryBackoffMaxMs: tt.maxMs}
+			// 抖动是随机的，多次取样检查范围
+			for i := 0; i < 100; i++ {
+				if got := retryBackoff(cfg, tt.retryCount); got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("retryBackoff() = %v, want within [%v, %v]", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestWaitRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel bool
+		want   bool
+	}{
+		{name: "backoff elapses", want: true},
+		{name: "client cancels", cancel: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			ps := &ProxyServer{clock: clk}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan bool, 1)
+			go func() { done <- ps.waitRetryBackoff(ctx, time.Second) }()
+			for clk.Waiters() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			if tt.cancel {
+				cancel()
+			} else {
+				clk.Advance(time.Second)
+			}
+			select {
+			case got := <-done:
+				if got != tt.want {
+					t.Errorf("waitRetryBackoff() = %v, want %v", got, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitRetryBackoff did not return")
+			}
+		})
+	}
+}
+
+func TestCompressUpstreamBody(t *testing.T) {
+	compressible := []byte(`{"model":"gpt-4o-mini","input":"` + strings.Repeat("hello ", 400) + `"}`)
+	// 随机字节无法被 gzip 压缩
+	incompressible := make([]byte, 2048)
+	rand.NewChaCha8([32]byte{}).Read(incompressible)
+
+	tests := []struct {
+		name           string
+		enabled        bool
+		minBytes       int
+		contentEncode  string
+		isStream       bool
+		body           []byte
+		wantCompressed bool
+	}{
+		{name: "disabled", enabled: false, body: compressible},
+		{name: "compressed", enabled: true, minBytes: 1024, body: compressible, wantCompressed: true},
+		{name: "at threshold", enabled: true, minBytes: len(compressible), body: compressible, wantCompressed: true},
+		{name: "below threshold", enabled: true, minBytes: len(compressible) + 1, body: compressible},
+		{name: "no threshold", enabled: true, minBytes: 0, body: compressible, wantCompressed: true},
+		{name: "streaming request", enabled: true, isStream: true, body: compressible},
+		{name: "client encoded body", enabled: true, contentEncode: "br", body: compressible},
+		{name: "empty body", enabled: true, body: nil},
+		{name: "would not shrink", enabled: true, minBytes: 1024, body: incompressible},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := &models.Group{}
+			group.EffectiveConfig.RequestCompression = tt.enabled
+			group.EffectiveConfig.RequestCompressionMinBytes = tt.minBytes
+			header := http.Header{}
+			if tt.contentEncode != "" {
+				header.Set("Content-Encoding", tt.contentEncode)
+			}
+
+			got, compressed := compressUpstreamBody(group, header, tt.body, tt.isStream)
+			if compressed != tt.wantCompressed {
+				t.Fatalf("compressed = %v, want %v", compressed, tt.wantCompressed)
+			}
+			if !compressed {
+				if !bytes.Equal(got, tt.body) {
+					t.Error("uncompressed body was changed")
+				}
+				return
+			}
+			if len(got) >= len(tt.body) {
+				t.Errorf("compressed body is %d bytes, not smaller than %d", len(got), len(tt.body))
+			}
+			reader, err := gzip.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+			plain, err := io.ReadAll(reader)
+			if err != nil || !bytes.Equal(plain, tt.body) {
+				t.Errorf("decompressed body does not match the original (err: %v)", err)
+			}
+		})
+	}
+}
@@ -1,14 +1,24 @@
 package proxy
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"gpt-load/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Response) {
+// handleStreamingResponse relays an SSE stream. If verifier is set, the stream is checked against
+// the upstream's checksum once complete, and an error event is appended when it does not match.
+func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Response, verifier *checksumVerifier) {
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
@@ -17,20 +27,44 @@ func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Respon
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
 		logrus.Error("Streaming unsupported by the writer, falling back to normal response")
-		ps.handleNormalResponse(c, resp)
+		ps.handleNormalResponse(c, resp, nil)
 		return
 	}
+	streamDone := ps.proxyMetrics.TrackStream(c.GetString("groupName"), c.GetString(middleware.ChannelTypeContextKey))
+	defer streamDone()
+
+	// 关机排空超时后关闭上游响应体，使阻塞中的读取立即返回
+	closing, done := ps.inFlight.TrackStream()
+	defer done()
+	finished := make(chan struct{})
+	defer close(finished)
+	var forceClosed atomic.Bool
+	go func() {
+		select {
+		case <-closing:
+			forceClosed.Store(true)
+			resp.Body.Close()
+		case <-finished:
+		}
+	}()
 
 	buf := make([]byte, 4*1024)
 	for {
 		n, err := resp.Body.Read(buf)
-		if n > 0 {
+		if n > 0 && !forceClosed.Load() {
 			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
 				logUpstreamError("writing stream to client", writeErr)
 				return
 			}
 			flusher.Flush()
 		}
+		if forceClosed.Load() {
+			logrus.Warn("Closing active stream because the shutdown drain timeout has been reached")
+			if ps.configManager.GetEffectiveServerConfig().ShutdownStreamErrorEvent {
+				writeShutdownEvent(c, flusher)
+			}
+			return
+		}
 		if err == io.EOF {
 			break
 		}
@@ -39,10 +73,204 @@ func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Respon
 			return
 		}
 	}
+
+	if verifier != nil && !verifier.verify() {
+		if _, err := io.WriteString(c.Writer, integrityFailureEvent); err != nil {
+			logUpstreamError("writing integrity failure event to client", err)
+			return
+		}
+		flusher.Flush()
+	}
 }
 
-func (ps *ProxyServer) handleNormalResponse(c *gin.Context, resp *http.Response) {
+// shutdownEvent is the final SSE event sent to a stream that is force-closed during shutdown.
+const shutdownEvent = "event: error\ndata: {\"error\":{\"message\":\"Server is shutting down, the stream was closed before completion\",\"type\":\"server_shutdown\",\"code\":\"SHUTTING_DOWN\"}}\n\n"
+
+// writeShutdownEvent tells the client the stream was cut short so it can retry elsewhere.
+func writeShutdownEvent(c *gin.Context, flusher http.Flusher) {
+	if _, err := io.WriteString(c.Writer, shutdownEvent); err != nil {
+		logUpstreamError("writing shutdown event to client", err)
+		return
+	}
+	flusher.Flush()
+}
+
+// proxyMetadata holds the fields injected into non-streaming JSON responses.
+type proxyMetadata struct {
+	Key       string `json:"key"`
+	Region    string `json:"region,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+func (ps *ProxyServer) handleNormalResponse(c *gin.Context, resp *http.Response, metadata *proxyMetadata) {
+	proxyConfig := ps.configManager.GetProxyConfig()
+	if metadata != nil && proxyConfig.InjectMetadata && isPlainJSONResponse(resp) {
+		// 超过缓冲阈值的响应不注入元数据，已读取的部分与剩余内容直接转发
+		threshold := proxyConfig.BufferThresholdBytes
+		reader := io.Reader(resp.Body)
+		if threshold > 0 {
+			reader = io.LimitReader(resp.Body, threshold+1)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			logUpstreamError("reading response body", err)
+			return
+		}
+		if threshold > 0 && int64(len(body)) > threshold {
+			logrus.Debugf("Skipping proxy metadata injection: response body exceeds the buffer threshold of %d bytes", threshold)
+			if _, err := c.Writer.Write(body); err != nil {
+				logUpstreamError("writing response body", err)
+				return
+			}
+			if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+				logUpstreamError("copying response body", err)
+			}
+			return
+		}
+
+		metadata.Region = proxyConfig.Region
+		if injected, err := injectMetadata(body, proxyConfig.MetadataPath, metadata); err != nil {
+			logrus.Debugf("Skipping proxy metadata injection: %v", err)
+		} else {
+			body = injected
+		}
+
+		c.Writer.Header().Del("Content-Length")
+		if _, err := c.Writer.Write(body); err != nil {
+			logUpstreamError("writing response body", err)
+		}
+		return
+	}
+
 	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
 		logUpstreamError("copying response body", err)
 	}
 }
+
+// handleRawResponse copies a response body to the client as it arrives, flushing each read.
+// It is used for upstreams in raw mode, whose Content-Length is not forwarded.
+func handleRawResponse(c *gin.Context, resp *http.Response) {
+	flusher, _ := c.Writer.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				logUpstreamError("writing raw response to client", writeErr)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			logUpstreamError("reading raw response from upstream", err)
+			return
+		}
+	}
+}
+
+// upstreamBody records the first error reading an upstream response body, so a body that
+// ended before its declared length can be told apart from a failure writing to the client.
+// It also counts the bytes read for the response size statistics.
+type upstreamBody struct {
+	io.ReadCloser
+	err error
+	n   int64
+}
+
+func (b *upstreamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// isLengthMismatch reports whether a body read error means the upstream sent less than its
+// Content-Length or broke off its chunked encoding.
+func isLengthMismatch(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "malformed chunked encoding")
+}
+
+// contentTypeSniffBytes is how much of a response body is read to infer its content type.
+const contentTypeSniffBytes = 512
+
+// inferContentType sets the Content-Type of an upstream response that has none, from the start of
+// its body: JSON for a body starting with an object or array, SSE for one starting with an event
+// field or comment. Compressed bodies and anything else are left untouched.
+func inferContentType(resp *http.Response) {
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return
+	}
+
+	// 只读取一次已到达的数据，避免流式响应在凑满缓冲区前被阻塞
+	head := make([]byte, contentTypeSniffBytes)
+	n, _ := resp.Body.Read(head)
+	head = head[:n]
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	if contentType := sniffContentType(head); contentType != "" {
+		resp.Header.Set("Content-Type", contentType)
+	}
+}
+
+// sniffContentType returns the content type a response body looks like, or "" if unknown.
+func sniffContentType(head []byte) string {
+	trimmed := bytes.TrimLeft(head, " \t\r\n")
+	if len(trimmed) == 0 {
+		return ""
+	}
+	switch trimmed[0] {
+	case '{', '[':
+		return "application/json"
+	case ':':
+		return "text/event-stream"
+	}
+	for _, field := range []string{"data:", "event:", "id:", "retry:"} {
+		if bytes.HasPrefix(trimmed, []byte(field)) {
+			return "text/event-stream"
+		}
+	}
+	return ""
+}
+
+// isPlainJSONResponse reports whether the response is an uncompressed JSON document.
+func isPlainJSONResponse(resp *http.Response) bool {
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	return strings.Contains(resp.Header.Get("Content-Type"), "application/json")
+}
+
+// injectMetadata merges the metadata into a JSON object body at a dot-separated path.
+func injectMetadata(body []byte, path string, metadata *proxyMetadata) ([]byte, error) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("response body is not a JSON object: %w", err)
+	}
+
+	segments := strings.Split(path, ".")
+	target := payload
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := target[segment].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			target[segment] = next
+		}
+		target = next
+	}
+	target[segments[len(segments)-1]] = metadata
+
+	return json.Marshal(payload)
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandleStreamingResponseShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		errorEvent bool
+	}{
+		{name: "error event sent", errorEvent: true},
+		{name: "closed silently", errorEvent: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configManager := &stubConfigManager{server: types.ServerConfig{ShutdownStreamErrorEvent: tt.errorEvent}}
+			ps := &ProxyServer{
+				configManager: configManager,
+				inFlight:      middleware.NewInFlightTracker(),
+				proxyMetrics:  middleware.NewProxyMetrics(configManager, nil, prometheus.NewRegistry()),
+			}
+
+			// 上游发送一个事件后不再结束，模拟关机时仍在进行的流
+			upstream, upstreamWriter := io.Pipe()
+			resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: upstream}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/proxy/test/v1/chat/completions", nil)
+
+			finished := make(chan struct{})
+			go func() {
+				defer close(finished)
+				ps.handleStreamingResponse(c, resp, nil)
+			}()
+			if _, err := io.WriteString(upstreamWriter, "data: {\"id\":1}\n\n"); err != nil {
+				t.Fatalf("write upstream event: %v", err)
+			}
+
+			if !ps.inFlight.CloseStreams(5 * time.Second) {
+				t.Fatal("stream was not closed before the timeout")
+			}
+			<-finished
+
+			body := w.Body.String()
+			if got := strings.HasSuffix(body, shutdownEvent); got != tt.errorEvent {
+				t.Errorf("body ends with the shutdown event = %v, want %v (body: %q)", got, tt.errorEvent, body)
+			}
+		})
+	}
+}
+
+func TestInferContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     string
+		want     string
+	}{
+		{name: "json object", body: `{"id":"chatcmpl-1"}`, want: "application/json"},
+		{name: "json array with leading whitespace", body: "\n  [1,2]", want: "application/json"},
+		{name: "sse data", body: "data: {\"id\":1}\n\n", want: "text/event-stream"},
+		{name: "sse event", body: "event: message\ndata: x\n\n", want: "text/event-stream"},
+		{name: "sse comment", body: ": keep-alive\n\n", want: "text/event-stream"},
+		{name: "sse id", body: "id: 1\ndata: x\n\n", want: "text/event-stream"},
+		{name: "sse retry", body: "retry: 1000\n\n", want: "text/event-stream"},
+		{name: "plain text", body: "upstream error", want: ""},
+		{name: "empty body", body: "", want: ""},
+		{name: "compressed body untouched", encoding: "gzip", body: `{"id":1}`, want: ""},
+		{name: "identity encoding sniffed", encoding: "identity", body: `{"id":1}`, want: "application/json"},
+		{name: "body longer than sniff window", body: "{" + strings.Repeat(" ", contentTypeSniffBytes*2) + "}", want: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}
+			if tt.encoding != "" {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			inferContentType(resp)
+
+			if got := resp.Header.Get("Content-Type"); got != tt.want {
+				t.Errorf("Content-Type = %q, want %q", got, tt.want)
+			}
+			// 嗅探读取的数据必须仍然转发给客户端
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("read body: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
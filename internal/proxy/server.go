@@ -8,51 +8,119 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"gpt-load/internal/channel"
+	"gpt-load/internal/clock"
 	"gpt-load/internal/config"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/keypool"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
 	"gpt-load/internal/services"
+	"gpt-load/internal/types"
 	"gpt-load/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// upstreamTimingKey is the gin context key holding the upstream timing of the current attempt.
+const upstreamTimingKey = "upstream_timing"
+
+// 关闭重试的请求头及原因；原因保存在 gin context 中并记录到请求日志
+const (
+	noRetryHeader                 = "X-GPT-Load-No-Retry"
+	retriesDisabledHeader         = "X-GPT-Load-Retries-Disabled"
+	retryDisabledKey              = "retryDisabled"
+	retryDisabledByCaller         = "caller"
+	retryDisabledNoIdempotencyKey = "missing_idempotency_key"
+	retryDisabledBodyTooLarge     = "body_too_large"
+)
+
+// upstreamTiming records when the upstream request was sent and when its response headers arrived.
+type upstreamTiming struct {
+	SentAt     time.Time
+	ReceivedAt time.Time
+}
+
 // ProxyServer represents the proxy server
 type ProxyServer struct {
 	keyProvider       *keypool.KeyProvider
+	quotaChecker      *keypool.QuotaChecker
 	groupManager      *services.GroupManager
 	settingsManager   *config.SystemSettingsManager
+	configManager     types.ConfigManager
 	channelFactory    *channel.Factory
 	requestLogService *services.RequestLogService
+	statsCounter      *services.StatsCounterService
+	responseSizes     *services.ResponseSizeStats
+	featureFlags      *config.FeatureFlagManager
+	recordings        *services.RecordingService
+	inFlight          *middleware.InFlightTracker
+	upstreamHealth    *services.UpstreamHealthService
+	providerBreaker   *services.ProviderBreakerService
+	groupRateLimit    *services.GroupRateLimitService
+	proxyMetrics      *middleware.ProxyMetrics
+	metrics           *metrics.Metrics
+	groupRequests     *services.GroupRequestTracker
+	clock             clock.Clock
 }
 
 // NewProxyServer creates a new proxy server
 func NewProxyServer(
 	keyProvider *keypool.KeyProvider,
+	quotaChecker *keypool.QuotaChecker,
 	groupManager *services.GroupManager,
 	settingsManager *config.SystemSettingsManager,
+	configManager types.ConfigManager,
 	channelFactory *channel.Factory,
 	requestLogService *services.RequestLogService,
+	statsCounter *services.StatsCounterService,
+	responseSizes *services.ResponseSizeStats,
+	featureFlags *config.FeatureFlagManager,
+	recordings *services.RecordingService,
+	inFlight *middleware.InFlightTracker,
+	upstreamHealth *services.UpstreamHealthService,
+	providerBreaker *services.ProviderBreakerService,
+	groupRateLimit *services.GroupRateLimitService,
+	proxyMetrics *middleware.ProxyMetrics,
+	appMetrics *metrics.Metrics,
+	groupRequests *services.GroupRequestTracker,
+	clk clock.Clock,
 ) (*ProxyServer, error) {
 	return &ProxyServer{
 		keyProvider:       keyProvider,
+		quotaChecker:      quotaChecker,
 		groupManager:      groupManager,
 		settingsManager:   settingsManager,
+		configManager:     configManager,
 		channelFactory:    channelFactory,
 		requestLogService: requestLogService,
+		statsCounter:      statsCounter,
+		responseSizes:     responseSizes,
+		featureFlags:      featureFlags,
+		recordings:        recordings,
+		inFlight:          inFlight,
+		upstreamHealth:    upstreamHealth,
+		providerBreaker:   providerBreaker,
+		groupRateLimit:    groupRateLimit,
+		proxyMetrics:      proxyMetrics,
+		metrics:           appMetrics,
+		groupRequests:     groupRequests,
+		clock:             clk,
 	}, nil
 }
 
 // HandleProxy is the main entry point for proxy requests, refactored based on the stable .bak logic.
 func (ps *ProxyServer) HandleProxy(c *gin.Context) {
-	startTime := time.Now()
+	startTime := ps.clock.Now()
 	groupName := c.Param("group_name")
 
 	group, err := ps.groupManager.GetGroupByName(groupName)
@@ -61,18 +129,74 @@ func (ps *ProxyServer) HandleProxy(c *gin.Context) {
 		return
 	}
 
+	// 已计划删除的分组处于维护模式，拒绝新请求
+	if group.DeleteAfter != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrGroupMaintenance, fmt.Sprintf("Group '%s' is scheduled for deletion at %s", groupName, group.DeleteAfter.Format(time.RFC3339))))
+		return
+	}
+
+	// 正在删除的分组拒绝新请求，删除前等待已登记的请求完成
+	releaseGroup, ok := ps.groupRequests.Acquire(group.ID)
+	if !ok {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrGroupMaintenance, fmt.Sprintf("Group '%s' is being deleted", groupName)))
+		return
+	}
+	defer releaseGroup()
+
+	c.Set("groupName", group.Name)
+	c.Set(middleware.ChannelTypeContextKey, group.ChannelType)
+
 	channelHandler, err := ps.channelFactory.GetChannel(group)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to get channel for group '%s': %v", groupName, err)))
 		return
 	}
 
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	// 先校验请求，无效的请求不占用熔断探测名额和分组速率配额
+	if missingHeader := applyRequiredHeaders(c.Request, group); missingHeader != "" {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, fmt.Sprintf("Missing required header: %s", missingHeader)))
+		return
+	}
+
+	if unknownParam := applyQueryParamPolicy(c.Request, group); unknownParam != "" {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, fmt.Sprintf("Unknown query parameter: %s", unknownParam)))
+		return
+	}
+
+	// 该渠道类型的上游整体故障时快速失败，等待探测请求成功
+	if !ps.providerBreaker.Allow(group.ChannelType) {
+		response.Error(c, app_errors.ErrProviderUnavailable)
+		return
+	}
+
+	// 分组的总请求速率超过限制时在选择密钥前拒绝，与各密钥是否仍有余量无关
+	if allowed, retryAfter, err := ps.groupRateLimit.Allow(group); err != nil {
+		logrus.WithError(err).Warn("Failed to check group rate limit")
+	} else if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrGroupRateLimited, fmt.Sprintf("Group '%s' exceeded its limit of %d requests per minute", group.Name, group.EffectiveConfig.GroupRateLimitRPM)))
+		return
+	}
+
+	// 文件上传不缓冲请求体，直接流式转发
+	if isMultipartUpload(c.Request) {
+		ps.executeMultipartUpload(c, channelHandler, group, startTime)
+		return
+	}
+
+	// 只缓冲不超过重试上限的请求体，更大的请求体不重试，边读边转发
+	bodyBytes, retryable, err := readRetryableBody(c.Request.Body, group.EffectiveConfig.RetryMaxBodyBytes)
 	if err != nil {
 		logrus.Errorf("Failed to read request body: %v", err)
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Failed to read request body"))
 		return
 	}
+	if !retryable {
+		c.Set(retryDisabledKey, retryDisabledBodyTooLarge)
+		logBody := fmt.Appendf(nil, "[request body over the retry limit of %d bytes, not buffered]", group.EffectiveConfig.RetryMaxBodyBytes)
+		ps.executeUnbufferedRequest(c, channelHandler, group, startTime, io.MultiReader(bytes.NewReader(bodyBytes), c.Request.Body), 0, logBody)
+		return
+	}
 	c.Request.Body.Close()
 
 	finalBodyBytes, err := ps.applyParamOverrides(bodyBytes, group)
@@ -81,8 +205,44 @@ func (ps *ProxyServer) HandleProxy(c *gin.Context) {
 		return
 	}
 
+	finalBodyBytes, droppedParams := translateChatParams(channelHandler, c.Request.URL.Path, finalBodyBytes)
+	if len(droppedParams) > 0 {
+		switch group.EffectiveConfig.UnsupportedParams {
+		case models.UnsupportedParamModeReject:
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, fmt.Sprintf("Unsupported parameters for %s channel: %s", group.ChannelType, strings.Join(droppedParams, ", "))))
+			return
+		case models.UnsupportedParamModeWarnHeader:
+			c.Header("X-GPT-Load-Dropped-Params", strings.Join(droppedParams, ","))
+		default:
+			logrus.Debugf("Dropped unsupported parameters for group %s: %v", group.Name, droppedParams)
+		}
+	}
+
+	embeddingsParts, err := planEmbeddings(c.Request.URL.Path, finalBodyBytes, group.EffectiveConfig)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, fmt.Sprintf("Invalid embeddings request: %v", err)))
+		return
+	}
+
+	// 拆分后的各部分请求遵循与原请求相同的重试策略
+	retryDisabled := retryDisabledReason(c, group, ps.configManager.GetProxyConfig().DedupHeader)
+	if retryDisabled != "" {
+		c.Set(retryDisabledKey, retryDisabled)
+	}
+
+	if len(embeddingsParts) > 0 {
+		ps.executeSplitEmbeddings(c, channelHandler, group, finalBodyBytes, embeddingsParts, startTime, retryDisabled)
+		return
+	}
+
 	isStream := channelHandler.IsStreamRequest(c, bodyBytes)
 
+	// 关机期间不再建立新的流式连接，避免其超出排空时长
+	if isStream && ps.inFlight.Draining() {
+		response.Error(c, app_errors.ErrShuttingDown)
+		return
+	}
+
 	ps.executeRequestWithRetry(c, channelHandler, group, finalBodyBytes, isStream, startTime, 0)
 }
 
@@ -98,15 +258,35 @@ func (ps *ProxyServer) executeRequestWithRetry(
 ) {
 	cfg := group.EffectiveConfig
 
-	apiKey, err := ps.keyProvider.SelectKey(group.ID)
+	// 总超时预算覆盖所有重试，为 0 时不限制
+	budget := time.Duration(ps.configManager.GetProxyConfig().TotalTimeout) * time.Second
+	clientDeadline, hasClientDeadline := ps.clientDeadline(c, startTime)
+	deadline, hasDeadline, clientBound := requestDeadline(startTime, budget, clientDeadline, hasClientDeadline)
+
+	model := channelHandler.ExtractModel(c, bodyBytes)
+	apiKey, err := ps.selectKey(channelHandler, group, model)
 	if err != nil {
 		logrus.Errorf("Failed to select a key for group %s on attempt %d: %v", group.Name, retryCount+1, err)
-		response.Error(c, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
+		if ps.groupRequests.Deleting(group.ID) {
+			err = fmt.Errorf("group '%s' was deleted while the request was in progress", group.Name)
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrGroupMaintenance, err.Error()))
+		} else {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
+		}
 		ps.logRequest(c, group, nil, startTime, http.StatusServiceUnavailable, err, isStream, "", channelHandler, bodyBytes, models.RequestTypeFinal)
 		return
 	}
 
-	upstreamURL, err := channelHandler.BuildUpstreamURL(c.Request.URL, group)
+	// 供访问日志记录本次请求最终使用的密钥和重试次数
+	c.Set("keyIndex", apiKey.ID)
+	c.Set("keyPreview", utils.MaskAPIKey(apiKey.KeyValue))
+	c.Set("retryCount", retryCount)
+
+	upstreamURL, err := buildUpstreamURL(channelHandler, c.Request.URL, group, model)
+	if errors.Is(err, channel.ErrModelRequired) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build upstream URL: %v", err)))
 		return
@@ -114,28 +294,51 @@ func (ps *ProxyServer) executeRequestWithRetry(
 
 	var ctx context.Context
 	var cancel context.CancelFunc
+	var budgetTimer clock.Timer
 	if isStream {
 		ctx, cancel = context.WithCancel(c.Request.Context())
+		// 流式请求仅在收到响应头之前受总预算约束，避免中断正在传输的流
+		if hasDeadline {
+			budgetTimer = ps.clock.AfterFunc(ps.clock.Until(deadline), cancel)
+		}
 	} else {
-		timeout := time.Duration(cfg.RequestTimeout) * time.Second
+		timeout := attemptTimeout(time.Duration(cfg.RequestTimeout)*time.Second, ps.clock.Until(deadline), hasDeadline)
 		ctx, cancel = context.WithTimeout(c.Request.Context(), timeout)
 	}
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, c.Request.Method, upstreamURL, bytes.NewReader(bodyBytes))
+	requestBody, compressed := compressUpstreamBody(group, c.Request.Header, bodyBytes, isStream)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, upstreamURL, bytes.NewReader(requestBody))
 	if err != nil {
 		logrus.Errorf("Failed to create upstream request: %v", err)
 		response.Error(c, app_errors.ErrInternalServer)
 		return
 	}
-	req.ContentLength = int64(len(bodyBytes))
+	req.ContentLength = int64(len(requestBody))
 
 	req.Header = c.Request.Header.Clone()
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
 	// Clean up client auth key
 	req.Header.Del("Authorization")
 	req.Header.Del("X-Api-Key")
 	req.Header.Del("X-Goog-Api-Key")
+	req.Header.Del(noRetryHeader)
+
+	// 将剩余时间继续传递给上游，使链式部署的代理同样遵守客户端的截止时间
+	if hasDeadline && req.Header.Get(requestTimeoutHeader) != "" {
+		req.Header.Set(requestTimeoutHeader, strconv.FormatInt(max(ps.clock.Until(deadline).Milliseconds(), 1), 10))
+	}
+
+	// 将客户端的幂等键转发给上游，利用上游自身的幂等支持
+	if dedupHeader := ps.configManager.GetProxyConfig().DedupHeader; dedupHeader != "" {
+		if idempotencyKey := c.GetHeader(dedupHeader); idempotencyKey != "" {
+			req.Header.Del(dedupHeader)
+			req.Header.Set(upstreamIdempotencyHeader, idempotencyKey)
+		}
+	}
 
 	// Apply custom header rules
 	if len(group.HeaderRuleList) > 0 {
@@ -153,13 +356,48 @@ func (ps *ProxyServer) executeRequestWithRetry(
 		client = channelHandler.GetHTTPClient()
 	}
 
-	resp, err := client.Do(req)
+	upstreamSentAt := ps.clock.Now()
+	var resp *http.Response
+	replaying := ps.recordings.IsReplaying(group.ID)
+	if replaying {
+		// 回放模式下由录制内容代替上游，回放失败不计入密钥失败
+		resp, err = ps.recordings.Replay(group, req)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadGateway, fmt.Sprintf("Replay failed: %v", err)))
+			return
+		}
+	} else {
+		resp, err = client.Do(req)
+		ps.observeUpstreamConnection(group.Name, err, c.Request.Context().Err() != nil)
+		ps.observeUpstreamResponse(group.Name, upstreamURL, resp, err, c.Request.Context().Err() != nil)
+		if resp != nil && ps.recordings.IsRecording(group.ID) {
+			ps.recordings.Capture(group, req, bodyBytes, resp, upstreamSentAt)
+		}
+	}
+	c.Set(upstreamTimingKey, upstreamTiming{SentAt: upstreamSentAt, ReceivedAt: ps.clock.Now()})
+	ps.captureUpstreamRequestID(c, resp)
+	if budgetTimer != nil {
+		budgetTimer.Stop()
+	}
+	budgetExhausted := hasDeadline && !ps.clock.Now().Before(deadline)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 
 	// Unified error handling for retries. Exclude 404 from being a retryable error.
-	if err != nil || (resp != nil && resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound) {
+	failed := err != nil || (resp != nil && resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound)
+	if err == nil || !app_errors.IsIgnorableError(err) {
+		ps.metrics.ObserveKeyRequest(apiKey.ID, !failed, ps.clock.Since(upstreamSentAt))
+	}
+	if !failed {
+		ps.keyProvider.RecordErrorBudget(apiKey, group, true)
+		ps.keyProvider.ExtendExpiry(apiKey, group)
+	}
+	// 只有网络错误与 5xx 说明上游本身故障，超时预算耗尽与客户端断开不计入
+	if !replaying && (err == nil || (!budgetExhausted && !app_errors.IsIgnorableError(err))) {
+		ps.providerBreaker.Record(group.ChannelType, err == nil && resp.StatusCode < http.StatusInternalServerError)
+	}
+	if failed {
 		if err != nil && app_errors.IsIgnorableError(err) {
 			logrus.Debugf("Client-side ignorable error for key %s, aborting retries: %v", utils.MaskAPIKey(apiKey.KeyValue), err)
 			ps.logRequest(c, group, apiKey, startTime, 499, err, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
@@ -170,10 +408,18 @@ func (ps *ProxyServer) executeRequestWithRetry(
 		var errorMessage string
 		var parsedError string
 
+		// 由总超时预算或客户端截止时间导致的失败不计入密钥的失败次数
+		countFailure := true
+		clientDeadlineExceeded := false
 		if err != nil {
 			statusCode = 500
 			errorMessage = err.Error()
 			parsedError = errorMessage
+			if budgetExhausted && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) {
+				statusCode = http.StatusGatewayTimeout
+				countFailure = false
+				clientDeadlineExceeded = clientBound
+			}
 			logrus.Debugf("Request failed (attempt %d/%d) for key %s: %v", retryCount+1, cfg.MaxRetries, utils.MaskAPIKey(apiKey.KeyValue), err)
 		} else {
 			// HTTP-level error (status >= 400)
@@ -191,12 +437,29 @@ func (ps *ProxyServer) executeRequestWithRetry(
 		}
 
 		// 使用解析后的错误信息更新密钥状态
-		ps.keyProvider.UpdateStatus(apiKey, group, false, parsedError)
+		if countFailure {
+			ps.keyProvider.UpdateStatus(apiKey, group, false, parsedError)
+			ps.keyProvider.RecordErrorBudget(apiKey, group, false)
+		}
 
-		// 判断是否为最后一次尝试
-		isLastAttempt := retryCount >= cfg.MaxRetries
+		// 判断是否为最后一次尝试，总超时预算耗尽或请求关闭了重试时即使还有重试次数也不再重试
+		// 上游返回不在可重试列表中的状态码时同样直接返回
+		retryDisabled := c.GetString(retryDisabledKey)
+		backoff := retryBackoff(cfg, retryCount)
+		backoffExceedsBudget := backoff > 0 && hasDeadline && ps.clock.Until(deadline) <= backoff
+		nonRetryableStatus := err == nil && !isRetryableStatus(cfg, statusCode)
+		isLastAttempt := retryCount >= cfg.MaxRetries || budgetExhausted || backoffExceedsBudget || nonRetryableStatus || retryDisabled != "" || ps.providerBreaker.IsOpen(group.ChannelType)
+		if budgetExhausted && retryCount < cfg.MaxRetries {
+			if clientBound {
+				logrus.Debugf("Client deadline passed for group %s after %d attempts, returning last error", group.Name, retryCount+1)
+			} else {
+				logrus.Debugf("Total timeout budget of %v exhausted for group %s after %d attempts, returning last error", budget, group.Name, retryCount+1)
+			}
+		}
 		requestType := models.RequestTypeRetry
-		if isLastAttempt {
+		if clientDeadlineExceeded {
+			requestType = models.RequestTypeClientDeadlineExceeded
+		} else if isLastAttempt {
 			requestType = models.RequestTypeFinal
 		}
 
@@ -204,15 +467,32 @@ func (ps *ProxyServer) executeRequestWithRetry(
 
 		// 如果是最后一次尝试，直接返回错误，不再递归
 		if isLastAttempt {
+			if retryDisabled != "" {
+				c.Header(retriesDisabledHeader, retryDisabled)
+			}
 			var errorJSON map[string]any
 			if err := json.Unmarshal([]byte(errorMessage), &errorJSON); err == nil {
+				// 保持上游错误结构不变，另附关闭重试的说明
+				if retryDisabled != "" {
+					errorJSON["gpt_load_retries_disabled"] = retryDisabledMessage(retryDisabled)
+				}
 				c.JSON(statusCode, errorJSON)
 			} else {
+				if retryDisabled != "" {
+					errorMessage = fmt.Sprintf("%s (%s)", errorMessage, retryDisabledMessage(retryDisabled))
+				}
 				response.Error(c, app_errors.NewAPIErrorWithUpstream(statusCode, "UPSTREAM_ERROR", errorMessage))
 			}
 			return
 		}
 
+		// 重试间隔期间客户端断开时立即放弃，不再请求上游
+		if backoff > 0 && !ps.waitRetryBackoff(c.Request.Context(), backoff) {
+			logrus.Debugf("Client canceled during the retry backoff for group %s after %d attempts, aborting retries", group.Name, retryCount+1)
+			ps.logRequest(c, group, apiKey, startTime, 499, c.Request.Context().Err(), isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
+			return
+		}
+
 		ps.executeRequestWithRetry(c, channelHandler, group, bodyBytes, isStream, startTime, retryCount+1)
 		return
 	}
@@ -220,7 +500,35 @@ func (ps *ProxyServer) executeRequestWithRetry(
 	// ps.keyProvider.UpdateStatus(apiKey, group, true) // 请求成功不再重置成功次数，减少IO消耗
 	logrus.Debugf("Request for group %s succeeded on attempt %d with key %s", group.Name, retryCount+1, utils.MaskAPIKey(apiKey.KeyValue))
 
+	if resp.StatusCode == http.StatusOK && strings.EqualFold(resp.Header.Get(upstreamIdempotencyReplayedHeader), "true") {
+		logrus.Debugf("Upstream replayed an idempotent response for group %s with key %s", group.Name, utils.MaskAPIKey(apiKey.KeyValue))
+		ps.metrics.UpstreamIdempotencyReplays.WithLabelValues(metrics.KeyIDLabel(apiKey.ID)).Inc()
+	}
+
+	body := &upstreamBody{ReadCloser: resp.Body}
+	resp.Body = body
+
+	if resp.Header.Get("Content-Type") == "" && ps.featureFlags.IsEnabled(config.FlagInferContentType, group.ID) {
+		inferContentType(resp)
+	}
+
+	// 非流式响应先完整读取并校验，校验失败时不向客户端转发任何上游内容
+	var verifier *checksumVerifier
+	if ps.configManager.GetPerformanceConfig().VerifyResponseChecksum {
+		verifier = newChecksumVerifier(resp, apiKey.ID, ps.metrics)
+	}
+	if verifier != nil && !isStream && !bufferVerifiedBody(resp, verifier) {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "integrity_check_failed"})
+		ps.logRequest(c, group, apiKey, startTime, http.StatusBadGateway, errIntegrityCheckFailed, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
+		return
+	}
+
+	// 频繁出现长度不符的上游不再转发 Content-Length，改为分块传输给客户端
+	rawMode := ps.upstreamHealth.IsRawMode(group, upstreamURL)
 	for key, values := range resp.Header {
+		if rawMode && key == "Content-Length" {
+			continue
+		}
 		for _, value := range values {
 			c.Header(key, value)
 		}
@@ -228,12 +536,85 @@ func (ps *ProxyServer) executeRequestWithRetry(
 	c.Status(resp.StatusCode)
 
 	if isStream {
-		ps.handleStreamingResponse(c, resp)
+		ps.handleStreamingResponse(c, resp, verifier)
+	} else if rawMode {
+		handleRawResponse(c, resp)
 	} else {
-		ps.handleNormalResponse(c, resp)
+		var metadata *proxyMetadata
+		if ps.featureFlags.IsEnabled(config.FlagMetadataInjection, group.ID) {
+			metadata = &proxyMetadata{
+				Key:       utils.MaskAPIKey(apiKey.KeyValue),
+				LatencyMs: ps.clock.Since(startTime).Milliseconds(),
+			}
+		}
+		ps.handleNormalResponse(c, resp, metadata)
+	}
+
+	if isLengthMismatch(body.err) {
+		ps.upstreamHealth.RecordLengthMismatch(group, upstreamURL)
 	}
+	// 只统计完整接收的响应体
+	if body.err == nil {
+		ps.responseSizes.Observe(group, channelHandler.ExtractModel(c, bodyBytes), body.n)
+	}
+
+	var finalErr error
+	if verifier != nil && verifier.failed {
+		finalErr = errIntegrityCheckFailed
+	}
+	ps.logRequest(c, group, apiKey, startTime, resp.StatusCode, finalErr, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
+}
+
+// waitRetryBackoff waits for the retry backoff, returning false if the request context is
+// canceled first.
+func (ps *ProxyServer) waitRetryBackoff(ctx context.Context, backoff time.Duration) bool {
+	select {
+	case <-ps.clock.After(backoff):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// selectKey rotates to the next active key, skipping expired keys and keys whose upstream balance is
+// below their minimum. Keys whose model affinity matches the model are preferred; without a usable
+// one any key is used, in the order of the group's key selection strategy.
+func (ps *ProxyServer) selectKey(channelHandler channel.ChannelProxy, group *models.Group, model string) (*models.APIKey, error) {
+	strategy := group.EffectiveConfig.KeySelectionStrategy
+	if model != "" {
+		apiKey, err := ps.keyProvider.SelectAffinityKey(group.ID, model)
+		if err != nil {
+			logrus.Warnf("Failed to select an affinity key for model %s in group %s: %v", model, group.Name, err)
+		} else if apiKey != nil && (strategy != models.KeySelectionWeightedRoundRobin || apiKey.Weight > 0) && ps.keyUsable(channelHandler, apiKey, group) {
+			ps.metrics.ObserveKeyAffinityHit(apiKey.ID)
+			return apiKey, nil
+		}
+	}
+
+	skipped := make(map[uint]struct{})
+	for {
+		apiKey, err := ps.keyProvider.SelectKey(group.ID, strategy)
+		if err != nil {
+			return nil, err
+		}
+		if ps.keyUsable(channelHandler, apiKey, group) {
+			return apiKey, nil
+		}
+		if _, ok := skipped[apiKey.ID]; ok {
+			return nil, fmt.Errorf("no active unexpired keys with sufficient balance in group %s", group.Name)
+		}
+		skipped[apiKey.ID] = struct{}{}
+	}
+}
 
-	ps.logRequest(c, group, apiKey, startTime, resp.StatusCode, nil, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
+// keyUsable reports whether a selected key can serve the request. An expired key is disabled
+// in the background, so it drops out of the rotation.
+func (ps *ProxyServer) keyUsable(channelHandler channel.ChannelProxy, apiKey *models.APIKey, group *models.Group) bool {
+	if ps.keyProvider.KeyExpired(apiKey) {
+		ps.keyProvider.ExpireKey(apiKey, group)
+		return false
+	}
+	return ps.quotaChecker.HasSufficientBalance(channelHandler, apiKey, group)
 }
 
 // logRequest is a helper function to create and record a request log.
@@ -250,6 +631,15 @@ func (ps *ProxyServer) logRequest(
 	bodyBytes []byte,
 	requestType string,
 ) {
+	// 拆分后的 embeddings 请求在全部完成后统一记录一次
+	if requestType == models.RequestTypeFinal && c.GetBool(embeddingsSubRequestKey) {
+		return
+	}
+
+	if ps.statsCounter != nil && requestType != models.RequestTypeRetry {
+		ps.statsCounter.Record(group.ID, finalError == nil && statusCode < 400)
+	}
+
 	if ps.requestLogService == nil {
 		return
 	}
@@ -261,21 +651,34 @@ func (ps *ProxyServer) logRequest(
 		userAgent = c.Request.UserAgent()
 	}
 
-	duration := time.Since(startTime).Milliseconds()
+	duration := ps.clock.Since(startTime).Milliseconds()
 
 	logEntry := &models.RequestLog{
-		GroupID:      group.ID,
-		GroupName:    group.Name,
-		IsSuccess:    finalError == nil && statusCode < 400,
-		SourceIP:     c.ClientIP(),
-		StatusCode:   statusCode,
-		RequestPath:  utils.TruncateString(c.Request.URL.String(), 500),
-		Duration:     duration,
-		UserAgent:    userAgent,
-		RequestType:  requestType,
-		IsStream:     isStream,
-		UpstreamAddr: utils.TruncateString(upstreamAddr, 500),
-		RequestBody:  requestBodyToLog,
+		GroupID:       group.ID,
+		GroupName:     group.Name,
+		IsSuccess:     finalError == nil && statusCode < 400,
+		SourceIP:      c.ClientIP(),
+		ClientKey:     utils.MaskAPIKey(c.GetString("clientKey")),
+		StatusCode:    statusCode,
+		RequestPath:   utils.TruncateString(c.Request.URL.String(), 500),
+		Duration:      duration,
+		UserAgent:     userAgent,
+		RequestType:   requestType,
+		IsStream:      isStream,
+		UpstreamAddr:  utils.TruncateString(upstreamAddr, 500),
+		RequestBody:   requestBodyToLog,
+		RetryDisabled: c.GetString(retryDisabledKey),
+
+		UpstreamRequestID: c.GetString(middleware.UpstreamRequestIDContextKey),
+	}
+
+	if len(bodyBytes) > 0 {
+		logEntry.RequestBodyHash = utils.SHA256Hex(bodyBytes)
+		logEntry.RequestBytes = int64(len(bodyBytes))
+	}
+	// 重试请求的响应不返回给调用方，只有最终请求记录响应大小
+	if requestType != models.RequestTypeRetry && c.Writer.Size() > 0 {
+		logEntry.ResponseBytes = int64(c.Writer.Size())
 	}
 
 	if channelHandler != nil && bodyBytes != nil {
@@ -284,6 +687,16 @@ func (ps *ProxyServer) logRequest(
 
 	if apiKey != nil {
 		logEntry.KeyValue = apiKey.KeyValue
+		logEntry.KeyHash = utils.SHA256Hex([]byte(apiKey.KeyValue))
+		logEntry.KeySource = apiKey.Source
+	}
+
+	if value, exists := c.Get(upstreamTimingKey); exists {
+		if timing, ok := value.(upstreamTiming); ok {
+			logEntry.SetupDuration = timing.SentAt.Sub(startTime).Milliseconds()
+			logEntry.UpstreamDuration = timing.ReceivedAt.Sub(timing.SentAt).Milliseconds()
+			logEntry.TransferDuration = duration - logEntry.SetupDuration - logEntry.UpstreamDuration
+		}
 	}
 
 	if finalError != nil {
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/channel"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// uploadPathSegments are the OpenAI endpoints that take file uploads.
+var uploadPathSegments = []string{"/files", "/uploads", "/fine_tuning/", "/fine-tunes"}
+
+// isMultipartUpload reports whether the request uploads a file as multipart/form-data to an
+// OpenAI files, uploads or fine-tuning endpoint.
+func isMultipartUpload(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return false
+	}
+	path := r.URL.Path
+	for _, segment := range uploadPathSegments {
+		if strings.Contains(path, segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadLogBody stands in for the request body in the request log, since uploads aren't buffered.
+func uploadLogBody(r *http.Request) []byte {
+	return fmt.Appendf(nil, "[multipart upload, %d bytes, %s]", r.ContentLength, r.Header.Get("Content-Type"))
+}
+
+// executeMultipartUpload streams a multipart upload to the upstream without buffering it, keeping
+// the original Content-Type and its boundary. The body skips the JSON rewrites, and since it can
+// only be read once, the upload is sent with a single key and isn't retried. Uploads are neither
+// recorded nor replayed.
+func (ps *ProxyServer) executeMultipartUpload(c *gin.Context, channelHandler channel.ChannelProxy, group *models.Group, startTime time.Time) {
+	limit := int64(ps.configManager.GetProxyConfig().UploadMaxBodyBytes)
+	if c.Request.ContentLength > limit {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrRequestTooLarge, fmt.Sprintf("Upload exceeds the limit of %d bytes", limit)))
+		return
+	}
+	ps.executeUnbufferedRequest(c, channelHandler, group, startTime, c.Request.Body, limit, uploadLogBody(c.Request))
+}
+
+// executeUnbufferedRequest streams body to the upstream with a single key, without the JSON
+// rewrites and without retries, since the body can only be read once. Bodies over limit abort the
+// upstream request with 413; a limit of 0 means no limit. logBody stands in for the body in the
+// request log.
+func (ps *ProxyServer) executeUnbufferedRequest(c *gin.Context, channelHandler channel.ChannelProxy, group *models.Group, startTime time.Time, body io.Reader, limit int64, logBody []byte) {
+	apiKey, err := ps.selectKey(channelHandler, group, "")
+	if err != nil {
+		logrus.Errorf("Failed to select a key for unbuffered request to group %s: %v", group.Name, err)
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
+		ps.logRequest(c, group, nil, startTime, http.StatusServiceUnavailable, err, false, "", channelHandler, logBody, models.RequestTypeFinal)
+		return
+	}
+	c.Set("keyIndex", apiKey.ID)
+	c.Set("keyPreview", utils.MaskAPIKey(apiKey.KeyValue))
+	c.Set("retryCount", 0)
+
+	upstreamURL, err := channelHandler.BuildUpstreamURL(c.Request.URL, group)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build upstream URL: %v", err)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(group.EffectiveConfig.RequestTimeout)*time.Second)
+	defer cancel()
+
+	// 通过管道边读边发，超出上限时中断上游请求
+	pr, pw := io.Pipe()
+	var tooLarge atomic.Bool
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		if limit <= 0 {
+			_, err := io.Copy(pw, body)
+			pw.CloseWithError(err)
+			return
+		}
+		n, err := io.Copy(pw, io.LimitReader(body, limit+1))
+		if err == nil && n > limit {
+			tooLarge.Store(true)
+			err = fmt.Errorf("request body exceeds the limit of %d bytes", limit)
+		}
+		pw.CloseWithError(err)
+	}()
+	defer func() {
+		pr.Close()
+		<-copied
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, upstreamURL, pr)
+	if err != nil {
+		logrus.Errorf("Failed to create unbuffered upstream request: %v", err)
+		response.Error(c, app_errors.ErrInternalServer)
+		return
+	}
+	req.ContentLength = c.Request.ContentLength
+	req.Header = c.Request.Header.Clone()
+	req.Header.Del("Authorization")
+	req.Header.Del("X-Api-Key")
+	req.Header.Del("X-Goog-Api-Key")
+	if len(group.HeaderRuleList) > 0 {
+		utils.ApplyHeaderRules(req, group.HeaderRuleList, utils.NewHeaderVariableContextFromGin(c, group, apiKey))
+	}
+	channelHandler.ModifyRequest(req, apiKey, group)
+
+	upstreamSentAt := ps.clock.Now()
+	resp, err := channelHandler.GetHTTPClient().Do(req)
+	ps.observeUpstreamConnection(group.Name, err, c.Request.Context().Err() != nil)
+	c.Set(upstreamTimingKey, upstreamTiming{SentAt: upstreamSentAt, ReceivedAt: ps.clock.Now()})
+	ps.captureUpstreamRequestID(c, resp)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	if tooLarge.Load() {
+		err = fmt.Errorf("request body exceeds the limit of %d bytes", limit)
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrRequestTooLarge, err.Error()))
+		ps.logRequest(c, group, apiKey, startTime, http.StatusRequestEntityTooLarge, err, false, upstreamURL, channelHandler, logBody, models.RequestTypeFinal)
+		return
+	}
+
+	if err != nil {
+		if app_errors.IsIgnorableError(err) {
+			ps.logRequest(c, group, apiKey, startTime, 499, err, false, upstreamURL, channelHandler, logBody, models.RequestTypeFinal)
+			return
+		}
+		ps.metrics.ObserveKeyRequest(apiKey.ID, false, ps.clock.Since(upstreamSentAt))
+		ps.providerBreaker.Record(group.ChannelType, false)
+		ps.keyProvider.UpdateStatus(apiKey, group, false, err.Error())
+		ps.keyProvider.RecordErrorBudget(apiKey, group, false)
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadGateway, fmt.Sprintf("Upstream request failed: %v", err)))
+		ps.logRequest(c, group, apiKey, startTime, http.StatusBadGateway, err, false, upstreamURL, channelHandler, logBody, models.RequestTypeFinal)
+		return
+	}
+
+	failed := resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound
+	ps.metrics.ObserveKeyRequest(apiKey.ID, !failed, ps.clock.Since(upstreamSentAt))
+	ps.keyProvider.RecordErrorBudget(apiKey, group, !failed)
+	if !failed {
+		ps.keyProvider.ExtendExpiry(apiKey, group)
+	}
+	ps.providerBreaker.Record(group.ChannelType, resp.StatusCode < http.StatusInternalServerError)
+	if failed {
+		errorBody, readErr := io.ReadAll(resp.Body)
+		if readErr != nil {
+			errorBody = []byte("Failed to read error body")
+		}
+		errorBody = handleGzipCompression(resp, errorBody)
+		parsedError := app_errors.ParseUpstreamError(errorBody)
+		ps.keyProvider.UpdateStatus(apiKey, group, false, parsedError)
+		ps.logRequest(c, group, apiKey, startTime, resp.StatusCode, errors.New(parsedError), false, upstreamURL, channelHandler, logBody, models.RequestTypeFinal)
+
+		if retryDisabled := c.GetString(retryDisabledKey); retryDisabled != "" {
+			c.Header(retriesDisabledHeader, retryDisabled)
+		}
+		var errorJSON map[string]any
+		if json.Unmarshal(errorBody, &errorJSON) == nil {
+			c.JSON(resp.StatusCode, errorJSON)
+		} else {
+			response.Error(c, app_errors.NewAPIErrorWithUpstream(resp.StatusCode, "UPSTREAM_ERROR", string(errorBody)))
+		}
+		return
+	}
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+	isStream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if isStream {
+		ps.handleStreamingResponse(c, resp, nil)
+	} else {
+		ps.handleNormalResponse(c, resp, nil)
+	}
+
+	ps.logRequest(c, group, apiKey, startTime, resp.StatusCode, nil, isStream, upstreamURL, channelHandler, logBody, models.RequestTypeFinal)
+}
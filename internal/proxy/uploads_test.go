@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsMultipartUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		want        bool
+	}{
+		{name: "files", path: "/proxy/openai/v1/files", contentType: "multipart/form-data; boundary=abc", want: true},
+		{name: "uploads parts", path: "/proxy/openai/v1/uploads/upload_1/parts", contentType: "multipart/form-data; boundary=abc", want: true},
+		{name: "fine tuning", path: "/proxy/openai/v1/fine_tuning/jobs", contentType: "multipart/form-data; boundary=abc", want: true},
+		{name: "legacy fine-tunes", path: "/proxy/openai/v1/fine-tunes", contentType: "Multipart/Form-Data; boundary=abc", want: true},
+		{name: "json to files", path: "/proxy/openai/v1/files", contentType: "application/json", want: false},
+		{name: "multipart to chat", path: "/proxy/openai/v1/chat/completions", contentType: "multipart/form-data; boundary=abc", want: false},
+		{name: "multipart to audio", path: "/proxy/openai/v1/audio/transcriptions", contentType: "multipart/form-data; boundary=abc", want: false},
+		{name: "no content type", path: "/proxy/openai/v1/files", contentType: "", want: false},
+		{name: "malformed content type", path: "/proxy/openai/v1/files", contentType: "multipart/form-data; boundary", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if got := isMultipartUpload(req); got != tt.want {
+				t.Errorf("isMultipartUpload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
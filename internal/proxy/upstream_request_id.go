@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamRequestIDHeader carries the upstream request ID back to the client when
+// ECHO_UPSTREAM_REQUEST_ID is enabled.
+const upstreamRequestIDHeader = "X-Upstream-Request-Id"
+
+// upstreamRequestID returns the value of the first configured header present on the
+// upstream response, or an empty string when there is none.
+func upstreamRequestID(header http.Header, names []string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(header.Get(name)); value != "" {
+			return utils.TruncateString(value, 128)
+		}
+	}
+	return ""
+}
+
+// captureUpstreamRequestID records the upstream request ID of the current attempt for the
+// request and access logs. It is reset when the attempt got no response, so a retry never
+// reports the ID of an earlier attempt.
+func (ps *ProxyServer) captureUpstreamRequestID(c *gin.Context, resp *http.Response) {
+	proxyConfig := ps.configManager.GetProxyConfig()
+	requestID := ""
+	if resp != nil {
+		requestID = upstreamRequestID(resp.Header, proxyConfig.UpstreamRequestIDHeaders)
+	}
+	c.Set(middleware.UpstreamRequestIDContextKey, requestID)
+
+	if !proxyConfig.EchoUpstreamRequestID {
+		return
+	}
+	if requestID != "" {
+		c.Header(upstreamRequestIDHeader, requestID)
+	} else {
+		c.Writer.Header().Del(upstreamRequestIDHeader)
+	}
+}
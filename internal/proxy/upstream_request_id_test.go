@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpstreamRequestID(t *testing.T) {
+	defaultNames := []string{"x-request-id", "request-id"}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		names   []string
+		want    string
+	}{
+		{name: "first header", headers: map[string]string{"X-Request-Id": "req_1"}, names: defaultNames, want: "req_1"},
+		{name: "second header", headers: map[string]string{"Request-Id": "req_2"}, names: defaultNames, want: "req_2"},
+		{name: "first header wins", headers: map[string]string{"X-Request-Id": "req_1", "Request-Id": "req_2"}, names: defaultNames, want: "req_1"},
+		{name: "blank header skipped", headers: map[string]string{"X-Request-Id": " ", "Request-Id": "req_2"}, names: defaultNames, want: "req_2"},
+		{name: "trimmed", headers: map[string]string{"X-Request-Id": " req_1 "}, names: defaultNames, want: "req_1"},
+		{name: "custom header", headers: map[string]string{"Cf-Ray": "ray_1", "X-Request-Id": "req_1"}, names: []string{"cf-ray"}, want: "ray_1"},
+		{name: "no header", headers: map[string]string{"X-Other": "x"}, names: defaultNames, want: ""},
+		{name: "disabled", headers: map[string]string{"X-Request-Id": "req_1"}, names: nil, want: ""},
+		{name: "truncated", headers: map[string]string{"X-Request-Id": strings.Repeat("r", 200)}, names: defaultNames, want: strings.Repeat("r", 128)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.headers {
+				header.Set(k, v)
+			}
+			if got := upstreamRequestID(header, tt.names); got != tt.want {
+				t.Errorf("upstreamRequestID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureUpstreamRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	withID := &http.Response{Header: http.Header{"X-Request-Id": []string{"req_2"}}}
+	withoutID := &http.Response{Header: http.Header{}}
+	tests := []struct {
+		name       string
+		echo       bool
+		attempts   []*http.Response // 依次捕获的各次尝试的响应，nil 表示没有收到响应
+		wantLogged string
+		wantEcho   string
+	}{
+		{name: "recorded", attempts: []*http.Response{withID}, wantLogged: "req_2"},
+		{name: "echoed", echo: true, attempts: []*http.Response{withID}, wantLogged: "req_2", wantEcho: "req_2"},
+		{name: "retry without response resets", echo: true, attempts: []*http.Response{withID, nil}},
+		{name: "retry without id resets", echo: true, attempts: []*http.Response{withID, withoutID}},
+		{name: "retry with id replaces", echo: true, attempts: []*http.Response{withoutID, withID}, wantLogged: "req_2", wantEcho: "req_2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &ProxyServer{configManager: &stubConfigManager{proxy: types.ProxyConfig{
+				UpstreamRequestIDHeaders: []string{"x-request-id"},
+				EchoUpstreamRequestID:    tt.echo,
+			}}}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/proxy/test/v1/chat/completions", nil)
+
+			for _, resp := range tt.attempts {
+				ps.captureUpstreamRequestID(c, resp)
+			}
+
+			if got := c.GetString(middleware.UpstreamRequestIDContextKey); got != tt.wantLogged {
+				t.Errorf("logged request ID = %q, want %q", got, tt.wantLogged)
+			}
+			if got := w.Header().Get(upstreamRequestIDHeader); got != tt.wantEcho {
+				t.Errorf("%s = %q, want %q", upstreamRequestIDHeader, got, tt.wantEcho)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ type SuccessResponse struct {
 type ErrorResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
 }
 
 // Success sends a standardized success response.
@@ -35,5 +36,6 @@ func Error(c *gin.Context, apiErr *app_errors.APIError) {
 	c.JSON(apiErr.HTTPStatus, ErrorResponse{
 		Code:    apiErr.Code,
 		Message: apiErr.Message,
+		Details: apiErr.Details,
 	})
 }
@@ -2,13 +2,20 @@ package router
 
 import (
 	"embed"
+	"fmt"
+	"gpt-load/internal/config"
 	"gpt-load/internal/handler"
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/middleware"
 	"gpt-load/internal/proxy"
 	"gpt-load/internal/services"
+	"gpt-load/internal/store"
 	"gpt-load/internal/types"
+	"gpt-load/internal/version"
 	"io/fs"
 	"net/http"
+	"net/http/pprof"
 	"strings"
 	"time"
 
@@ -16,6 +23,8 @@ import (
 	"github.com/gin-contrib/static"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 )
 
 type embedFileSystem struct {
@@ -42,6 +51,16 @@ func NewRouter(
 	proxyServer *proxy.ProxyServer,
 	configManager types.ConfigManager,
 	groupManager *services.GroupManager,
+	settingsManager *config.SystemSettingsManager,
+	featureFlags *config.FeatureFlagManager,
+	storage store.Store,
+	geoRouting *services.GeoRoutingService,
+	clientQuota *services.ClientQuotaService,
+	adminAudit *services.AdminAuditService,
+	poolViability *keypool.PoolViabilityChecker,
+	inFlight *middleware.InFlightTracker,
+	proxyMetrics *middleware.ProxyMetrics,
+	appMetrics *metrics.Metrics,
 	buildFS embed.FS,
 	indexPage []byte,
 ) *gin.Engine {
@@ -53,26 +72,66 @@ func NewRouter(
 	router.Use(middleware.Recovery())
 	router.Use(middleware.ErrorHandler())
 	router.Use(middleware.Logger(configManager.GetLogConfig()))
-	router.Use(middleware.CORS(configManager.GetCORSConfig()))
-	router.Use(middleware.RateLimiter(configManager.GetPerformanceConfig()))
+	router.Use(middleware.CORS(configManager))
+	router.Use(middleware.RateLimiter(configManager.GetPerformanceConfig(), appMetrics))
 	startTime := time.Now()
 	router.Use(func(c *gin.Context) {
 		c.Set("serverStartTime", startTime)
 		c.Next()
 	})
+	if serverConfig := configManager.GetEffectiveServerConfig(); serverConfig.UIVersionCheck {
+		if mismatch := checkUIVersion(indexPage); mismatch != "" && serverConfig.UIVersionMismatchHeader {
+			router.Use(middleware.UIVersionMismatch(mismatch))
+		}
+	}
 
 	// 注册路由
-	registerSystemRoutes(router, serverHandler)
-	registerAPIRoutes(router, serverHandler, configManager)
-	registerProxyRoutes(router, proxyServer, groupManager)
+	registerSystemRoutes(router, serverHandler, configManager)
+	registerAPIRoutes(router, serverHandler, configManager, adminAudit, inFlight)
+	registerProxyRoutes(router, proxyServer, configManager, groupManager, settingsManager, featureFlags, storage, geoRouting, clientQuota, poolViability, inFlight, proxyMetrics)
 	registerFrontendRoutes(router, buildFS, indexPage)
 
 	return router
 }
 
+// checkUIVersion 比较内嵌前端构建时的版本与后端版本，不一致时记录警告并返回响应头的内容
+func checkUIVersion(indexPage []byte) string {
+	uiVersion := version.UIVersion(indexPage)
+	if uiVersion == "" {
+		logrus.Warn("UI version check: the embedded UI carries no version, build it with VITE_VERSION set to enable the check")
+		return ""
+	}
+	if uiVersion == version.Version {
+		logrus.Debugf("UI version check: the embedded UI matches backend version %s", version.Version)
+		return ""
+	}
+	logrus.Warnf("The embedded UI (web/dist) was built for version %s but the backend is version %s, it may not match the API. Rebuild the UI with VITE_VERSION=%s.",
+		uiVersion, version.Version, version.Version)
+	return fmt.Sprintf("ui=%s; backend=%s", uiVersion, version.Version)
+}
+
 // registerSystemRoutes 注册系统级路由
-func registerSystemRoutes(router *gin.Engine, serverHandler *handler.Server) {
+func registerSystemRoutes(router *gin.Engine, serverHandler *handler.Server, configManager types.ConfigManager) {
 	router.GET("/health", serverHandler.Health)
+	router.GET("/livez", serverHandler.Livez)
+	router.GET("/readyz", serverHandler.Readyz)
+	router.GET("/metrics", middleware.MetricsAuth(configManager), gin.WrapH(promhttp.Handler()))
+	if configManager.GetPprofConfig().Enabled {
+		registerPprofRoutes(router, configManager.GetAuthConfig())
+	}
+}
+
+// registerPprofRoutes 注册运行时性能分析路由，与管理 API 使用相同的认证
+func registerPprofRoutes(router *gin.Engine, authConfig types.AuthConfig) {
+	debug := router.Group("/debug/pprof", middleware.Auth(authConfig))
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	// 其余具名分析（heap、goroutine、allocs、mutex、block 等）由 pprof.Index 按路径分发
+	debug.GET("/:profile", gin.WrapF(pprof.Index))
 }
 
 // registerAPIRoutes 注册API路由
@@ -80,10 +139,21 @@ func registerAPIRoutes(
 	router *gin.Engine,
 	serverHandler *handler.Server,
 	configManager types.ConfigManager,
+	adminAudit *services.AdminAuditService,
+	inFlight *middleware.InFlightTracker,
 ) {
 	api := router.Group("/api")
+	api.Use(inFlight.TrackAdmin())
 	authConfig := configManager.GetAuthConfig()
 
+	serverConfig := configManager.GetEffectiveServerConfig()
+	bulkImportLimit := int64(serverConfig.KeyBulkImportMaxBodyBytes)
+	api.Use(middleware.AdminBodyLimit(int64(serverConfig.AdminMaxRequestBodyBytes), map[string]int64{
+		"/api/keys/add-async":    bulkImportLimit,
+		"/api/keys/delete-async": bulkImportLimit,
+	}))
+	api.Use(middleware.AdminAudit(adminAudit))
+
 	// 公开
 	registerPublicAPIRoutes(api, serverHandler)
 
@@ -91,6 +161,8 @@ func registerAPIRoutes(
 	protectedAPI := api.Group("")
 	protectedAPI.Use(middleware.Auth(authConfig))
 	registerProtectedAPIRoutes(protectedAPI, serverHandler)
+	// 重放日志中的请求时在同一路由上重新分发到代理路由
+	protectedAPI.POST("/logs/:id/replay", serverHandler.ReplayLog(router))
 }
 
 // registerPublicAPIRoutes 公开API路由
@@ -108,10 +180,20 @@ func registerProtectedAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Ser
 		groups.GET("", serverHandler.ListGroups)
 		groups.GET("/list", serverHandler.List)
 		groups.GET("/config-options", serverHandler.GetGroupConfigOptions)
+		groups.POST("/validate", serverHandler.ValidateGroup)
 		groups.PUT("/:id", serverHandler.UpdateGroup)
 		groups.DELETE("/:id", serverHandler.DeleteGroup)
+		groups.DELETE("/:id/scheduled-deletion", serverHandler.CancelGroupDeletion)
 		groups.GET("/:id/stats", serverHandler.GetGroupStats)
+		groups.GET("/:id/keys/by-source", serverHandler.GetGroupKeysBySource)
+		groups.GET("/:id/upstreams/health", serverHandler.GetGroupUpstreamHealth)
 		groups.POST("/:id/copy", serverHandler.CopyGroup)
+		groups.GET("/:id/recordings", serverHandler.GetRecordings)
+		groups.GET("/:id/recordings/:recording_id", serverHandler.GetRecording)
+		groups.POST("/:id/recording", serverHandler.StartRecording)
+		groups.DELETE("/:id/recording", serverHandler.StopRecording)
+		groups.PUT("/:id/replay", serverHandler.SetReplay)
+		groups.POST("/:id/key-sync", serverHandler.SyncGroupKeys)
 	}
 
 	// Key Management Routes
@@ -129,6 +211,16 @@ func registerProtectedAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Ser
 		keys.POST("/clear-all", serverHandler.ClearAllKeys)
 		keys.POST("/validate-group", serverHandler.ValidateGroupKeys)
 		keys.POST("/test-multiple", serverHandler.TestMultipleKeys)
+		keys.PUT("/:id/quota-precheck", serverHandler.UpdateKeyQuotaPrecheck)
+		keys.PUT("/:id/error-budget", serverHandler.UpdateKeyErrorBudget)
+		keys.POST("/:id/reset-error-budget", serverHandler.ResetKeyErrorBudget)
+		keys.PUT("/:id/expiry", serverHandler.UpdateKeyExpiry)
+		keys.PUT("/:id/weight", serverHandler.UpdateKeyWeight)
+		keys.PUT("/:id/standby", serverHandler.UpdateKeyStandby)
+		keys.PUT("/:id/openai-scope", serverHandler.UpdateKeyScope)
+		keys.POST("/openai-scope", serverHandler.UpdateKeyScopes)
+		keys.PUT("/:id/model-affinity", serverHandler.UpdateKeyModelAffinity)
+		keys.POST("/source", serverHandler.UpdateKeySources)
 	}
 
 	// Tasks
@@ -139,6 +231,8 @@ func registerProtectedAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Ser
 	{
 		dashboard.GET("/stats", serverHandler.Stats)
 		dashboard.GET("/chart", serverHandler.Chart)
+		dashboard.GET("/counters", serverHandler.Counters)
+		dashboard.GET("/response-sizes", serverHandler.ResponseSizes)
 	}
 
 	// 日志
@@ -146,27 +240,73 @@ func registerProtectedAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Ser
 	{
 		logs.GET("", serverHandler.GetLogs)
 		logs.GET("/export", serverHandler.ExportLogs)
+		logs.GET("/:id", serverHandler.GetLog)
 	}
 
+	// 事件导出
+	api.GET("/exporters/clickhouse/schema", serverHandler.GetClickHouseSchema)
+
 	// 设置
 	settings := api.Group("/settings")
 	{
 		settings.GET("", serverHandler.GetSettings)
 		settings.PUT("", serverHandler.UpdateSettings)
 	}
+
+	// 功能开关与运维操作
+	admin := api.Group("/admin")
+	{
+		admin.GET("/flags", serverHandler.ListFeatureFlags)
+		admin.PUT("/flags", serverHandler.UpdateFeatureFlag)
+		admin.POST("/keys/re-encrypt", serverHandler.ReEncryptKeys)
+		admin.POST("/stats/backfill", serverHandler.BackfillStats)
+		admin.GET("/geo-routes", serverHandler.ListGeoRoutes)
+		admin.POST("/geo-routes", serverHandler.CreateGeoRoute)
+		admin.PUT("/geo-routes/:id", serverHandler.UpdateGeoRoute)
+		admin.DELETE("/geo-routes/:id", serverHandler.DeleteGeoRoute)
+	}
 }
 
 // registerProxyRoutes 注册代理路由
 func registerProxyRoutes(
 	router *gin.Engine,
 	proxyServer *proxy.ProxyServer,
+	configManager types.ConfigManager,
 	groupManager *services.GroupManager,
+	settingsManager *config.SystemSettingsManager,
+	featureFlags *config.FeatureFlagManager,
+	storage store.Store,
+	geoRouting *services.GeoRoutingService,
+	clientQuota *services.ClientQuotaService,
+	poolViability *keypool.PoolViabilityChecker,
+	inFlight *middleware.InFlightTracker,
+	proxyMetrics *middleware.ProxyMetrics,
 ) {
+	proxyMiddleware := []gin.HandlerFunc{
+		proxyMetrics.Middleware(),
+		middleware.ProxyAuth(groupManager),
+		middleware.ClientQuota(clientQuota),
+		middleware.ReplayProtection(storage, featureFlags, groupManager, configManager.GetProxyConfig()),
+		middleware.GeoRoute(geoRouting, groupManager),
+		middleware.PoolViability(poolViability),
+		middleware.DecompressRequestBody(configManager.GetPerformanceConfig()),
+	}
+
 	proxyGroup := router.Group("/proxy")
 
-	proxyGroup.Use(middleware.ProxyAuth(groupManager))
+	proxyGroup.Use(inFlight.TrackProxy())
+	proxyGroup.Use(proxyMiddleware...)
 
 	proxyGroup.Any("/:group_name/*path", proxyServer.HandleProxy)
+
+	// OpenAI 兼容的 /v1 根路径，按代理密钥或全局设置路由到默认分组
+	v1Group := router.Group("/v1")
+
+	v1Group.Use(inFlight.TrackProxy())
+	v1Group.Use(middleware.DefaultGroupRoute(settingsManager))
+	v1Group.Use(proxyMiddleware...)
+
+	v1Group.Any("/*path", proxyServer.HandleProxy)
 }
 
 // registerFrontendRoutes 注册前端路由
@@ -181,7 +321,8 @@ func registerFrontendRoutes(router *gin.Engine, buildFS embed.FS, indexPage []by
 
 	router.Use(static.Serve("/", EmbedFolder(buildFS, "web/dist")))
 	router.NoRoute(func(c *gin.Context) {
-		if strings.HasPrefix(c.Request.RequestURI, "/api") || strings.HasPrefix(c.Request.RequestURI, "/proxy") {
+		// 携带代理密钥的请求是调用方的 API 请求，未匹配时同样返回 JSON 404 而不是管理端页面
+		if strings.HasPrefix(c.Request.RequestURI, "/api") || strings.HasPrefix(c.Request.RequestURI, "/proxy") || middleware.ProxyKeyFromRequest(c.Request) != "" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
 			return
 		}
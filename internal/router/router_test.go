@@ -0,0 +1,31 @@
+package router
+
+import (
+	"testing"
+
+	"gpt-load/internal/version"
+)
+
+func TestCheckUIVersion(t *testing.T) {
+	meta := func(v string) []byte {
+		return []byte(`<meta name="gpt-load-version" content="` + v + `" />`)
+	}
+	tests := []struct {
+		name      string
+		indexPage []byte
+		want      string
+	}{
+		{name: "matching version", indexPage: meta(version.Version), want: ""},
+		{name: "different version", indexPage: meta("0.0.1"), want: "ui=0.0.1; backend=" + version.Version},
+		{name: "built without version", indexPage: meta("%VITE_VERSION%"), want: ""},
+		{name: "no meta tag", indexPage: []byte("<html></html>"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkUIVersion(tt.indexPage); got != tt.want {
+				t.Errorf("checkUIVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
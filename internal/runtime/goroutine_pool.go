@@ -0,0 +1,137 @@
+// Package runtime provides management of application-level goroutines.
+package runtime
+
+import (
+	"context"
+	goruntime "runtime"
+	"sync"
+	"time"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+const alarmCheckInterval = 30 * time.Second
+
+// GoroutinePool limits the number of short-lived worker goroutines started by application
+// components. A worker acquires a slot before it starts and releases it when it returns.
+// Long-lived loops run in plain goroutines so they do not hold slots for the life of the
+// process, and a worker never acquires a slot while holding one.
+type GoroutinePool struct {
+	sem            chan struct{}
+	alarmThreshold int
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+}
+
+// NewGoroutinePool creates a new GoroutinePool sized from the performance configuration.
+func NewGoroutinePool(configManager types.ConfigManager, m *metrics.Metrics) *GoroutinePool {
+	perfConfig := configManager.GetPerformanceConfig()
+	p := &GoroutinePool{
+		sem:            make(chan struct{}, perfConfig.MaxManagedGoroutines),
+		alarmThreshold: perfConfig.GoroutineAlarmThreshold,
+		stopChan:       make(chan struct{}),
+	}
+	m.RegisterGoroutineGauges(func() float64 { return float64(p.InUse()) })
+	return p
+}
+
+// Go runs fn in a new goroutine, blocking until a slot is available.
+func (p *GoroutinePool) Go(fn func()) {
+	p.sem <- struct{}{}
+	go func() {
+		defer func() { <-p.sem }()
+		fn()
+	}()
+}
+
+// GoNoWait runs fn in the pool if a slot is immediately available, and otherwise in a goroutine
+// outside the pool. It never blocks, for callers on the request path.
+func (p *GoroutinePool) GoNoWait(fn func()) {
+	if !p.TryGo(fn) {
+		go fn()
+	}
+}
+
+// TryGo runs fn in a new goroutine if a slot is immediately available and reports whether it did.
+func (p *GoroutinePool) TryGo(fn func()) bool {
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return false
+	}
+	go func() {
+		defer func() { <-p.sem }()
+		fn()
+	}()
+	return true
+}
+
+// InUse returns the number of goroutines currently running in the pool.
+func (p *GoroutinePool) InUse() int {
+	return len(p.sem)
+}
+
+// Capacity returns the maximum number of goroutines the pool allows.
+func (p *GoroutinePool) Capacity() int {
+	return cap(p.sem)
+}
+
+// Start starts the goroutine count alarm monitor.
+func (p *GoroutinePool) Start() {
+	if p.alarmThreshold <= 0 {
+		return
+	}
+	p.wg.Add(1)
+	go p.monitor()
+}
+
+// Stop stops the alarm monitor.
+func (p *GoroutinePool) Stop(ctx context.Context) {
+	close(p.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Debug("GoroutinePool monitor stopped.")
+	case <-ctx.Done():
+		logrus.Warn("GoroutinePool monitor stop timed out.")
+	}
+}
+
+func (p *GoroutinePool) monitor() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(alarmCheckInterval)
+	defer ticker.Stop()
+
+	alarming := false
+	for {
+		select {
+		case <-ticker.C:
+			total := goruntime.NumGoroutine()
+			if total > p.alarmThreshold {
+				if !alarming {
+					logrus.WithFields(logrus.Fields{
+						"goroutines": total,
+						"threshold":  p.alarmThreshold,
+						"managed":    p.InUse(),
+					}).Warn("Goroutine count exceeds alarm threshold.")
+				}
+				alarming = true
+			} else if alarming {
+				logrus.WithField("goroutines", total).Info("Goroutine count is back below alarm threshold.")
+				alarming = false
+			}
+		case <-p.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPool(size int) *GoroutinePool {
+	return &GoroutinePool{sem: make(chan struct{}, size), stopChan: make(chan struct{})}
+}
+
+func TestTryGoFailsWhenPoolIsFull(t *testing.T) {
+	p := newTestPool(1)
+	release := make(chan struct{})
+	if !p.TryGo(func() { <-release }) {
+		t.Fatal("TryGo on an empty pool = false, want true")
+	}
+	if p.TryGo(func() {}) {
+		t.Fatal("TryGo on a full pool = true, want false")
+	}
+	close(release)
+}
+
+func TestGoNoWaitDoesNotBlockWhenPoolIsFull(t *testing.T) {
+	p := newTestPool(1)
+	release := make(chan struct{})
+	p.Go(func() { <-release })
+	defer close(release)
+
+	ran := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		p.GoNoWait(func() { close(ran) })
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("GoNoWait blocked on a full pool")
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("GoNoWait did not run fn outside the full pool")
+	}
+	if got := p.InUse(); got != 1 {
+		t.Fatalf("InUse() = %d, want 1 (the overflow goroutine must not take a slot)", got)
+	}
+}
+
+func TestGoReleasesSlotWhenDone(t *testing.T) {
+	p := newTestPool(2)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		p.Go(func() { wg.Done() })
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for p.InUse() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("InUse() = %d after all workers returned, want 0", p.InUse())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
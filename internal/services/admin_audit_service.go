@@ -0,0 +1,44 @@
+package services
+
+import (
+	"encoding/json"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/siem"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AdminAuditService writes the admin audit log to the database and, when SIEM_STREAM_URL is set,
+// streams every entry to the SIEM as well.
+type AdminAuditService struct {
+	db   *gorm.DB
+	siem *siem.Streamer
+}
+
+// NewAdminAuditService creates a new AdminAuditService.
+func NewAdminAuditService(db *gorm.DB, streamer *siem.Streamer) *AdminAuditService {
+	return &AdminAuditService{
+		db:   db,
+		siem: streamer,
+	}
+}
+
+// Record writes an audit entry. A failed database write is logged and does not stop the entry
+// from being streamed to the SIEM.
+func (s *AdminAuditService) Record(entry *models.AdminAuditLog) {
+	if err := s.db.Create(entry).Error; err != nil {
+		logrus.WithError(err).WithField("action", entry.Action).Error("Failed to write admin audit log")
+	}
+	s.siem.Enqueue(*entry)
+}
+
+// detailJSON encodes structured audit details for the Detail column.
+func detailJSON(detail map[string]any) string {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	clickHouseRequestTimeout = 30 * time.Second
+	defaultClickHouseTable   = "request_events"
+)
+
+// clickHouseEvent is a single request event row in JSONEachRow format.
+type clickHouseEvent struct {
+	ID           string `json:"id"`
+	Timestamp    string `json:"timestamp"`
+	GroupID      uint   `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	KeyHash      string `json:"key_hash"`
+	KeyMasked    string `json:"key_masked"`
+	Model        string `json:"model"`
+	IsSuccess    bool   `json:"is_success"`
+	SourceIP     string `json:"source_ip"`
+	StatusCode   int    `json:"status_code"`
+	RequestPath  string `json:"request_path"`
+	Duration     int64  `json:"duration_ms"`
+	ErrorMessage string `json:"error_message"`
+	UserAgent    string `json:"user_agent"`
+	RequestType  string `json:"request_type"`
+	UpstreamAddr string `json:"upstream_addr"`
+	IsStream     bool   `json:"is_stream"`
+	RequestBody  string `json:"request_body"`
+	SetupMs      int64  `json:"setup_ms"`
+	UpstreamMs   int64  `json:"upstream_ms"`
+	TransferMs   int64  `json:"transfer_ms"`
+}
+
+// ClickHouseExporter exports request events to ClickHouse in batches over its HTTP interface.
+// It has its own bounded queue, so a slow or unavailable ClickHouse never blocks request logging.
+// Batches that fail to deliver are spooled to disk and replayed once ClickHouse recovers.
+type ClickHouseExporter struct {
+	config       types.ClickHouseConfig
+	featureFlags *config.FeatureFlagManager
+	client       *http.Client
+	queue        chan clickHouseEvent
+	dropped      atomic.Int64
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewClickHouseExporter creates a new ClickHouseExporter. The exporter is disabled when no DSN is configured.
+func NewClickHouseExporter(configManager types.ConfigManager, featureFlags *config.FeatureFlagManager) *ClickHouseExporter {
+	chConfig := configManager.GetClickHouseConfig()
+	e := &ClickHouseExporter{
+		config:       chConfig,
+		featureFlags: featureFlags,
+		client:       &http.Client{Timeout: clickHouseRequestTimeout},
+		stopChan:     make(chan struct{}),
+	}
+	if e.Enabled() {
+		e.queue = make(chan clickHouseEvent, chConfig.QueueSize)
+	}
+	return e
+}
+
+// Enabled reports whether the exporter is configured.
+func (e *ClickHouseExporter) Enabled() bool {
+	return e.config.DSN != ""
+}
+
+// Start starts the batch export loop.
+func (e *ClickHouseExporter) Start() {
+	if !e.Enabled() {
+		return
+	}
+	if err := os.MkdirAll(e.config.SpoolDir, 0755); err != nil {
+		logrus.Errorf("ClickHouseExporter: failed to create spool directory %s: %v", e.config.SpoolDir, err)
+	}
+	e.wg.Add(1)
+	go e.runLoop()
+	logrus.Debug("ClickHouse exporter started")
+}
+
+// Stop stops the export loop after flushing the queued events.
+func (e *ClickHouseExporter) Stop(ctx context.Context) {
+	if !e.Enabled() {
+		return
+	}
+	close(e.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("ClickHouseExporter stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("ClickHouseExporter stop timed out.")
+	}
+}
+
+// Enqueue submits a request log for export without blocking. Events are dropped when the queue is full.
+func (e *ClickHouseExporter) Enqueue(log *models.RequestLog) {
+	if !e.Enabled() || !e.featureFlags.IsEnabled(config.FlagClickHouseExport, log.GroupID) {
+		return
+	}
+	select {
+	case e.queue <- newClickHouseEvent(log):
+	default:
+		if dropped := e.dropped.Add(1); dropped%1000 == 1 {
+			logrus.Warnf("ClickHouseExporter: queue is full, %d events dropped so far", dropped)
+		}
+	}
+}
+
+// table returns the configured event table, falling back to the default name.
+func (e *ClickHouseExporter) table() string {
+	if e.config.Table == "" {
+		return defaultClickHouseTable
+	}
+	return e.config.Table
+}
+
+// SchemaSQL returns the CREATE TABLE statement for the configured event table.
+func (e *ClickHouseExporter) SchemaSQL() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+(
+    id            String,
+    timestamp     DateTime64(3, 'UTC'),
+    group_id      UInt32,
+    group_name    LowCardinality(String),
+    key_hash      String,
+    key_masked    String,
+    model         LowCardinality(String),
+    is_success    Bool,
+    source_ip     String,
+    status_code   UInt16,
+    request_path  String,
+    duration_ms   Int64,
+    error_message String,
+    user_agent    String,
+    request_type  LowCardinality(String),
+    upstream_addr String,
+    is_stream     Bool,
+    request_body  String,
+    setup_ms      Int64,
+    upstream_ms   Int64,
+    transfer_ms   Int64
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (group_id, timestamp);
+`, e.table())
+}
+
+func (e *ClickHouseExporter) runLoop() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(e.config.FlushIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	batch := make([]clickHouseEvent, 0, e.config.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			e.deliver(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case event := <-e.queue:
+			batch = append(batch, event)
+			if len(batch) >= e.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			e.replaySpool()
+		case <-e.stopChan:
+			for {
+				select {
+				case event := <-e.queue:
+					batch = append(batch, event)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends a batch to ClickHouse, spooling it to disk on failure.
+func (e *ClickHouseExporter) deliver(batch []clickHouseEvent) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range batch {
+		if err := encoder.Encode(&batch[i]); err != nil {
+			logrus.Warnf("ClickHouseExporter: failed to encode event %s: %v", batch[i].ID, err)
+		}
+	}
+	payload := buf.Bytes()
+
+	if err := e.insert(payload); err != nil {
+		logrus.Warnf("ClickHouseExporter: failed to insert %d events, spooling to disk: %v", len(batch), err)
+		e.spool(payload)
+		return
+	}
+	logrus.Debugf("ClickHouseExporter: exported %d events", len(batch))
+}
+
+// insert posts a JSONEachRow payload to the ClickHouse HTTP interface.
+func (e *ClickHouseExporter) insert(payload []byte) error {
+	u, err := url.Parse(e.config.DSN)
+	if err != nil {
+		return fmt.Errorf("invalid CLICKHOUSE_DSN: %w", err)
+	}
+
+	var username, password string
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+		u.User = nil
+	}
+
+	query := u.Query()
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", e.table()))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("clickhouse returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// spool writes a failed payload to the spool directory, evicting the oldest files beyond the size limit.
+func (e *ClickHouseExporter) spool(payload []byte) {
+	name := filepath.Join(e.config.SpoolDir, fmt.Sprintf("%d.jsonl", time.Now().UnixNano()))
+	if err := os.WriteFile(name, payload, 0644); err != nil {
+		logrus.Errorf("ClickHouseExporter: failed to write spool file, events lost: %v", err)
+		return
+	}
+
+	files, total := e.spoolFiles()
+	maxBytes := int64(e.config.SpoolMaxMB) * 1024 * 1024
+	for len(files) > 0 && total > maxBytes {
+		oldest := files[0]
+		files = files[1:]
+		if err := os.Remove(oldest.path); err != nil {
+			logrus.Warnf("ClickHouseExporter: failed to evict spool file %s: %v", oldest.path, err)
+			continue
+		}
+		total -= oldest.size
+		logrus.Warnf("ClickHouseExporter: spool exceeds %d MB, dropped oldest file %s", e.config.SpoolMaxMB, filepath.Base(oldest.path))
+	}
+}
+
+// replaySpool re-sends spooled payloads oldest first and stops at the first failure.
+func (e *ClickHouseExporter) replaySpool() {
+	files, _ := e.spoolFiles()
+	for _, f := range files {
+		payload, err := os.ReadFile(f.path)
+		if err != nil {
+			logrus.Warnf("ClickHouseExporter: failed to read spool file %s: %v", f.path, err)
+			continue
+		}
+		if err := e.insert(payload); err != nil {
+			logrus.Debugf("ClickHouseExporter: ClickHouse still unavailable, keeping %d spool files: %v", len(files), err)
+			return
+		}
+		if err := os.Remove(f.path); err != nil {
+			logrus.Warnf("ClickHouseExporter: failed to remove replayed spool file %s: %v", f.path, err)
+		}
+		logrus.Infof("ClickHouseExporter: replayed spool file %s", filepath.Base(f.path))
+	}
+}
+
+type spoolFile struct {
+	path string
+	size int64
+}
+
+// spoolFiles lists the spool files sorted from oldest to newest along with their total size.
+func (e *ClickHouseExporter) spoolFiles() ([]spoolFile, int64) {
+	entries, err := os.ReadDir(e.config.SpoolDir)
+	if err != nil {
+		return nil, 0
+	}
+
+	var files []spoolFile
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{path: filepath.Join(e.config.SpoolDir, entry.Name()), size: info.Size()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, total
+}
+
+// newClickHouseEvent converts a request log into an export event. The key is exported only as
+// its SHA-256 hash and masked form, never in plaintext.
+func newClickHouseEvent(log *models.RequestLog) clickHouseEvent {
+	keyHash := log.KeyHash
+	if keyHash == "" && log.KeyValue != "" {
+		keyHash = utils.SHA256Hex([]byte(log.KeyValue))
+	}
+	return clickHouseEvent{
+		ID:           log.ID,
+		Timestamp:    log.Timestamp.UTC().Format("2006-01-02 15:04:05.000"),
+		GroupID:      log.GroupID,
+		GroupName:    log.GroupName,
+		KeyHash:      keyHash,
+		KeyMasked:    utils.RedactAPIKey(log.KeyValue),
+		Model:        log.Model,
+		IsSuccess:    log.IsSuccess,
+		SourceIP:     log.SourceIP,
+		StatusCode:   log.StatusCode,
+		RequestPath:  log.RequestPath,
+		Duration:     log.Duration,
+		ErrorMessage: log.ErrorMessage,
+		UserAgent:    log.UserAgent,
+		RequestType:  log.RequestType,
+		UpstreamAddr: log.UpstreamAddr,
+		IsStream:     log.IsStream,
+		RequestBody:  log.RequestBody,
+		SetupMs:      log.SetupDuration,
+		UpstreamMs:   log.UpstreamDuration,
+		TransferMs:   log.TransferDuration,
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+)
+
+func TestNewClickHouseEventDoesNotExportPlaintextKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyValue   string
+		keyHash    string
+		wantMasked string
+	}{
+		{name: "long key", keyValue: "sk-abcdefghijklmnop", wantMasked: "sk-a****mnop"},
+		{name: "short key", keyValue: "shortkey", wantMasked: "****"},
+		{name: "stored hash", keyValue: "sk-abcdefghijklmnop", keyHash: "precomputed", wantMasked: "sk-a****mnop"},
+		{name: "no key", keyValue: "", wantMasked: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &models.RequestLog{
+				ID:        "log-1",
+				Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				KeyValue:  tt.keyValue,
+				KeyHash:   tt.keyHash,
+			}
+			event := newClickHouseEvent(log)
+
+			if event.KeyMasked != tt.wantMasked {
+				t.Errorf("KeyMasked = %q, want %q", event.KeyMasked, tt.wantMasked)
+			}
+			wantHash := tt.keyHash
+			if wantHash == "" && tt.keyValue != "" {
+				wantHash = utils.SHA256Hex([]byte(tt.keyValue))
+			}
+			if event.KeyHash != wantHash {
+				t.Errorf("KeyHash = %q, want %q", event.KeyHash, wantHash)
+			}
+
+			line, err := json.Marshal(event)
+			if err != nil {
+				t.Fatalf("marshal event: %v", err)
+			}
+			if tt.keyValue != "" && strings.Contains(string(line), tt.keyValue) {
+				t.Errorf("exported event contains the plaintext key: %s", line)
+			}
+			if strings.Contains(string(line), `"key_value"`) {
+				t.Errorf("exported event still has a key_value field: %s", line)
+			}
+		})
+	}
+}
+
+func TestClickHouseSchemaMatchesEventFields(t *testing.T) {
+	schema := (&ClickHouseExporter{}).SchemaSQL()
+	if strings.Contains(schema, "key_value") {
+		t.Errorf("schema still has a key_value column")
+	}
+
+	line, err := json.Marshal(clickHouseEvent{})
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(line, &fields); err != nil {
+		t.Fatalf("unmarshal event: %v", err)
+	}
+	for field := range fields {
+		if !strings.Contains(schema, "    "+field+" ") {
+			t.Errorf("schema has no column for event field %q", field)
+		}
+	}
+}
+
+func TestClickHouseExporterTableName(t *testing.T) {
+	tests := []struct {
+		name      string
+		table     string
+		wantTable string
+	}{
+		{name: "configured table", table: "events_v2", wantTable: "events_v2"},
+		{name: "empty table uses default", table: "", wantTable: "request_events"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query().Get("query")
+			}))
+			defer server.Close()
+
+			e := &ClickHouseExporter{
+				config: types.ClickHouseConfig{DSN: server.URL, Table: tt.table},
+				client: server.Client(),
+			}
+			if err := e.insert([]byte("{}\n")); err != nil {
+				t.Fatalf("insert() error = %v", err)
+			}
+
+			// 建表语句与写入语句必须使用同一张表
+			if want := "INSERT INTO " + tt.wantTable + " FORMAT JSONEachRow"; query != want {
+				t.Errorf("insert query = %q, want %q", query, want)
+			}
+			if want := "CREATE TABLE IF NOT EXISTS " + tt.wantTable + "\n"; !strings.HasPrefix(e.SchemaSQL(), want) {
+				t.Errorf("schema does not create table %q", tt.wantTable)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// clientQuotaKeyPrefix 每月一个 hash，字段为客户端代理密钥的指纹，值为本月请求数
+const clientQuotaKeyPrefix = "client_quota:"
+
+// ClientQuotaService counts the requests of each client proxy key per calendar month, across
+// all groups, and enforces the monthly limit. Months follow the local time zone (TZ).
+// Counters are kept in the store, so they are shared between instances when Redis is used.
+type ClientQuotaService struct {
+	store           store.Store
+	configManager   types.ConfigManager
+	settingsManager *config.SystemSettingsManager
+	groupManager    *GroupManager
+	clock           clock.Clock
+
+	mu         sync.Mutex
+	lastPeriod string
+}
+
+// NewClientQuotaService creates a new ClientQuotaService.
+func NewClientQuotaService(
+	store store.Store,
+	configManager types.ConfigManager,
+	settingsManager *config.SystemSettingsManager,
+	groupManager *GroupManager,
+	clk clock.Clock,
+) *ClientQuotaService {
+	return &ClientQuotaService{
+		store:           store,
+		configManager:   configManager,
+		settingsManager: settingsManager,
+		groupManager:    groupManager,
+		clock:           clk,
+	}
+}
+
+// Limit returns the monthly request limit per client proxy key, or 0 when unlimited.
+func (s *ClientQuotaService) Limit() int64 {
+	return int64(s.configManager.GetProxyConfig().ClientMonthlyQuota)
+}
+
+// ClientKeyFingerprint identifies a client proxy key without storing the key itself.
+func ClientKeyFingerprint(clientKey string) string {
+	sum := sha256.Sum256([]byte(clientKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Consume counts a request of the client key against this month's quota. It returns false,
+// without counting the request, when the quota is already used up.
+func (s *ClientQuotaService) Consume(clientKey string) (models.ClientQuotaStat, bool, error) {
+	limit := s.Limit()
+	period, resetAt := s.period()
+	fingerprint := ClientKeyFingerprint(clientKey)
+	stat := models.ClientQuotaStat{
+		Client:      utils.MaskAPIKey(clientKey),
+		Fingerprint: fingerprint,
+		Limit:       limit,
+		ResetAt:     resetAt,
+	}
+
+	used, err := s.store.HIncrBy(clientQuotaKeyPrefix+period, fingerprint, 1)
+	if err != nil {
+		return stat, true, fmt.Errorf("failed to count client request: %w", err)
+	}
+	if used > limit {
+		if _, err := s.store.HIncrBy(clientQuotaKeyPrefix+period, fingerprint, -1); err != nil {
+			logrus.WithError(err).Warn("Failed to roll back rejected client request count")
+		}
+		stat.Used = limit
+		return stat, false, nil
+	}
+
+	stat.Used = used
+	stat.Remaining = limit - used
+	return stat, true, nil
+}
+
+// Stats returns this month's usage of every configured client proxy key, global and per group.
+func (s *ClientQuotaService) Stats() ([]models.ClientQuotaStat, error) {
+	limit := s.Limit()
+	period, resetAt := s.period()
+
+	counts, err := s.store.HGetAll(clientQuotaKeyPrefix + period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client request counts: %w", err)
+	}
+
+	clientKeys := make(map[string]struct{})
+	for key := range s.settingsManager.GetSettings().ProxyKeysMap {
+		clientKeys[key] = struct{}{}
+	}
+	groups, err := s.groupManager.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		for key := range group.ProxyKeysMap {
+			clientKeys[key] = struct{}{}
+		}
+	}
+
+	stats := make([]models.ClientQuotaStat, 0, len(clientKeys))
+	for key := range clientKeys {
+		fingerprint := ClientKeyFingerprint(key)
+		used, _ := strconv.ParseInt(counts[fingerprint], 10, 64)
+		stats = append(stats, models.ClientQuotaStat{
+			Client:      utils.MaskAPIKey(key),
+			Fingerprint: fingerprint,
+			Used:        used,
+			Limit:       limit,
+			Remaining:   max(limit-used, 0),
+			ResetAt:     resetAt,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Used != stats[j].Used {
+			return stats[i].Used > stats[j].Used
+		}
+		return stats[i].Client < stats[j].Client
+	})
+	return stats, nil
+}
+
+// period returns the current month, in the local time zone, and when it ends.
+// The counters of the previous month are removed once the month has changed.
+func (s *ClientQuotaService) period() (string, time.Time) {
+	now := s.clock.Now().In(time.Local)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	period := start.Format("2006-01")
+
+	s.mu.Lock()
+	previous := s.lastPeriod
+	s.lastPeriod = period
+	s.mu.Unlock()
+
+	if previous != "" && previous != period {
+		if err := s.store.Delete(clientQuotaKeyPrefix + previous); err != nil {
+			logrus.WithError(err).Warn("Failed to remove last month's client request counts")
+		}
+	}
+	return period, start.AddDate(0, 1, 0)
+}
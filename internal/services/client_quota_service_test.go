@@ -0,0 +1,92 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+)
+
+func TestClientQuotaServiceConsume(t *testing.T) {
+	const clientA, clientB = "sk-client-aaaaaaaaaaaa", "sk-client-bbbbbbbbbbbb"
+	start := time.Date(2026, 3, 30, 12, 0, 0, 0, time.Local)
+	type request struct {
+		client        string
+		advance       time.Duration
+		wantAllowed   bool
+		wantUsed      int64
+		wantRemaining int64
+	}
+	tests := []struct {
+		name     string
+		limit    int
+		requests []request
+	}{
+		{
+			name:  "within quota",
+			limit: 3,
+			requests: []request{
+				{client: clientA, wantAllowed: true, wantUsed: 1, wantRemaining: 2},
+				{client: clientA, wantAllowed: true, wantUsed: 2, wantRemaining: 1},
+				{client: clientA, wantAllowed: true, wantUsed: 3, wantRemaining: 0},
+			},
+		},
+		{
+			name:  "rejected requests are not counted",
+			limit: 1,
+			requests: []request{
+				{client: clientA, wantAllowed: true, wantUsed: 1, wantRemaining: 0},
+				{client: clientA, wantAllowed: false, wantUsed: 1, wantRemaining: 0},
+				{client: clientA, wantAllowed: false, wantUsed: 1, wantRemaining: 0},
+			},
+		},
+		{
+			name:  "clients counted separately",
+			limit: 1,
+			requests: []request{
+				{client: clientA, wantAllowed: true, wantUsed: 1},
+				{client: clientB, wantAllowed: true, wantUsed: 1},
+				{client: clientA, wantAllowed: false, wantUsed: 1},
+			},
+		},
+		{
+			name:  "quota resets next month",
+			limit: 1,
+			requests: []request{
+				{client: clientA, wantAllowed: true, wantUsed: 1},
+				{client: clientA, wantAllowed: false, wantUsed: 1},
+				{client: clientA, advance: 3 * 24 * time.Hour, wantAllowed: true, wantUsed: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(start)
+			configManager := &stubConfigManager{proxy: types.ProxyConfig{ClientMonthlyQuota: tt.limit}}
+			service := NewClientQuotaService(store.NewMemoryStore(clk), configManager, nil, nil, clk)
+
+			for i, req := range tt.requests {
+				clk.Advance(req.advance)
+				stat, allowed, err := service.Consume(req.client)
+				if err != nil {
+					t.Fatalf("request %d: Consume() error = %v", i, err)
+				}
+				if allowed != req.wantAllowed || stat.Used != req.wantUsed || stat.Remaining != req.wantRemaining {
+					t.Errorf("request %d: allowed = %v, used = %d, remaining = %d, want %v, %d, %d",
+						i, allowed, stat.Used, stat.Remaining, req.wantAllowed, req.wantUsed, req.wantRemaining)
+				}
+				if stat.Fingerprint != ClientKeyFingerprint(req.client) || stat.Client == req.client {
+					t.Errorf("request %d: stat identifies the client as %q / %q", i, stat.Client, stat.Fingerprint)
+				}
+				now := clk.Now().In(time.Local)
+				wantReset := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.Local)
+				if !stat.ResetAt.Equal(wantReset) {
+					t.Errorf("request %d: ResetAt = %v, want %v", i, stat.ResetAt, wantReset)
+				}
+			}
+		})
+	}
+}
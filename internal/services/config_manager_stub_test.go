@@ -0,0 +1,18 @@
+package services
+
+import "gpt-load/internal/types"
+
+// stubConfigManager returns fixed configuration sections. Methods for sections a test does not
+// set are not implemented and panic when called.
+type stubConfigManager struct {
+	types.ConfigManager
+	proxy     types.ProxyConfig
+	log       types.LogConfig
+	recording types.RecordingConfig
+}
+
+func (m *stubConfigManager) GetProxyConfig() types.ProxyConfig { return m.proxy }
+func (m *stubConfigManager) GetLogConfig() types.LogConfig     { return m.log }
+func (m *stubConfigManager) GetRecordingConfig() types.RecordingConfig {
+	return m.recording
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/syncer"
+	"gpt-load/internal/types"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	GeoRoutesUpdateChannel = "geo_routes:updated"
+
+	geoIPUpdateInterval = 7 * 24 * time.Hour
+	geoIPUpdateTimeout  = 10 * time.Minute
+	geoIPDownloadURL    = "https://download.maxmind.com/app/geoip_download"
+	geoIPEdition        = "GeoLite2-Country"
+)
+
+// GeoRoutingService resolves caller IPs to countries with a MaxMind GeoLite2 database
+// and maps them to the group whose keys should be preferred.
+type GeoRoutingService struct {
+	db            *gorm.DB
+	store         store.Store
+	configManager types.ConfigManager
+	httpClient    *http.Client
+
+	syncer *syncer.CacheSyncer[map[string]uint]
+
+	readerMu sync.RWMutex
+	reader   *geoip2.Reader
+
+	started  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewGeoRoutingService creates a new, unstarted GeoRoutingService.
+func NewGeoRoutingService(db *gorm.DB, store store.Store, configManager types.ConfigManager) *GeoRoutingService {
+	return &GeoRoutingService{
+		db:            db,
+		store:         store,
+		configManager: configManager,
+		httpClient:    &http.Client{Timeout: geoIPUpdateTimeout},
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Enabled reports whether geo-routing is turned on.
+func (s *GeoRoutingService) Enabled() bool {
+	return s.configManager.GetGeoRoutingConfig().Enabled
+}
+
+// Start loads the route rules and the GeoLite2 database, and starts the weekly database update.
+// It does nothing when geo-routing is disabled.
+func (s *GeoRoutingService) Start() error {
+	if !s.Enabled() {
+		logrus.Debug("Geo routing disabled.")
+		return nil
+	}
+	cfg := s.configManager.GetGeoRoutingConfig()
+
+	loader := func() (map[string]uint, error) {
+		var rules []models.GeoRouteRule
+		if err := s.db.Find(&rules).Error; err != nil {
+			return nil, fmt.Errorf("failed to load geo route rules from db: %w", err)
+		}
+		routes := make(map[string]uint, len(rules))
+		for _, rule := range rules {
+			routes[rule.CountryCode] = rule.KeyGroupID
+		}
+		return routes, nil
+	}
+	rulesSyncer, err := syncer.NewCacheSyncer(
+		loader,
+		s.store,
+		GeoRoutesUpdateChannel,
+		logrus.WithField("syncer", "geo_routes"),
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create geo routes syncer: %w", err)
+	}
+	s.syncer = rulesSyncer
+	s.started = true
+
+	if err := s.openReader(cfg.DBPath); err != nil {
+		logrus.Warnf("GeoIP database not loaded, geo routing inactive until it is available: %v", err)
+	}
+	if cfg.AutoUpdate {
+		s.wg.Add(1)
+		go s.runUpdateLoop(cfg)
+	}
+	return nil
+}
+
+// Stop stops the rules syncer and the database update loop, and closes the database.
+func (s *GeoRoutingService) Stop(ctx context.Context) {
+	if !s.started {
+		return
+	}
+	close(s.stopChan)
+	s.syncer.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("GeoRoutingService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("GeoRoutingService stop timed out.")
+	}
+
+	s.readerMu.Lock()
+	defer s.readerMu.Unlock()
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+}
+
+// Route returns the country of the caller IP and the group mapped to it.
+// ok is false when geo-routing is inactive, the IP can't be resolved or no rule matches.
+func (s *GeoRoutingService) Route(clientIP string) (country string, groupID uint, ok bool) {
+	if s.syncer == nil {
+		return "", 0, false
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return "", 0, false
+	}
+
+	s.readerMu.RLock()
+	if s.reader == nil {
+		s.readerMu.RUnlock()
+		return "", 0, false
+	}
+	record, err := s.reader.Country(ip)
+	s.readerMu.RUnlock()
+	if err != nil {
+		logrus.WithError(err).WithField("ip", clientIP).Debug("GeoIP lookup failed")
+		return "", 0, false
+	}
+
+	country = record.Country.IsoCode
+	if country == "" {
+		return "", 0, false
+	}
+	groupID, ok = s.syncer.Get()[country]
+	return country, groupID, ok
+}
+
+// ListRules returns all geo route rules ordered by country code.
+func (s *GeoRoutingService) ListRules() ([]models.GeoRouteRule, error) {
+	var rules []models.GeoRouteRule
+	if err := s.db.Order("country_code ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreateRule adds a geo route rule.
+func (s *GeoRoutingService) CreateRule(rule *models.GeoRouteRule) error {
+	if err := s.db.Create(rule).Error; err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// UpdateRule changes the country or group of a geo route rule.
+func (s *GeoRoutingService) UpdateRule(rule *models.GeoRouteRule) error {
+	if err := s.db.Model(rule).Select("country_code", "key_group_id").Updates(rule).Error; err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// DeleteRule removes a geo route rule.
+func (s *GeoRoutingService) DeleteRule(id uint) error {
+	result := s.db.Delete(&models.GeoRouteRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// invalidate reloads the route rules on all instances. Rules are only cached while geo-routing is enabled.
+func (s *GeoRoutingService) invalidate() {
+	if s.syncer == nil {
+		return
+	}
+	if err := s.syncer.Invalidate(); err != nil {
+		logrus.WithError(err).Error("Failed to invalidate geo routes cache")
+	}
+}
+
+func (s *GeoRoutingService) runUpdateLoop(cfg types.GeoRoutingConfig) {
+	defer s.wg.Done()
+
+	// 数据库缺失或超过一周未更新时立即下载，否则等待下一个周期
+	if info, err := os.Stat(cfg.DBPath); err != nil || time.Since(info.ModTime()) >= geoIPUpdateInterval {
+		s.updateDatabase(cfg)
+	}
+
+	ticker := time.NewTicker(geoIPUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.updateDatabase(cfg)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// updateDatabase downloads the latest GeoLite2 Country database and swaps it in.
+func (s *GeoRoutingService) updateDatabase(cfg types.GeoRoutingConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), geoIPUpdateTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.downloadDatabase(ctx, cfg); err != nil {
+		logrus.Errorf("GeoRoutingService: failed to update GeoIP database: %v", err)
+		return
+	}
+	if err := s.openReader(cfg.DBPath); err != nil {
+		logrus.Errorf("GeoRoutingService: failed to load updated GeoIP database: %v", err)
+		return
+	}
+	logrus.Info("GeoRoutingService: GeoIP database updated")
+}
+
+func (s *GeoRoutingService) downloadDatabase(ctx context.Context, cfg types.GeoRoutingConfig) error {
+	query := url.Values{
+		"edition_id":  {geoIPEdition},
+		"license_key": {cfg.LicenseKey},
+		"suffix":      {"tar.gz"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, geoIPDownloadURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// url.Error 中的 URL 含有授权密钥，只记录底层错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("download request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return fmt.Errorf("archive does not contain a .mmdb file")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasSuffix(header.Name, ".mmdb") {
+			return writeFileAtomically(cfg.DBPath, archive)
+		}
+	}
+}
+
+// openReader opens the database at path and replaces the current one.
+func (s *GeoRoutingService) openReader(path string) error {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+
+	s.readerMu.Lock()
+	previous := s.reader
+	s.reader = reader
+	s.readerMu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// writeFileAtomically writes to a temporary file next to path and renames it into place,
+// so a failed download never leaves a truncated database behind.
+func writeFileAtomically(path string, r io.Reader) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	reader, err := geoip2.Open(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("downloaded database is invalid: %w", err)
+	}
+	reader.Close()
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	groupDeletionCheckInterval = time.Minute
+	groupTrafficTopClients     = 5
+)
+
+// ClientTraffic is the number of recent requests made with one client key (masked).
+type ClientTraffic struct {
+	ClientKey    string `json:"client_key"`
+	RequestCount int64  `json:"request_count"`
+}
+
+// GroupTraffic is the recent traffic of a group, used as evidence before deleting it.
+type GroupTraffic struct {
+	WindowMinutes int             `json:"window_minutes"`
+	RequestCount  int64           `json:"request_count"`
+	TopClients    []ClientTraffic `json:"top_clients"`
+}
+
+// GroupDeletionService deletes groups, checks their recent traffic, and
+// executes scheduled deletions once their delete_after time has passed.
+type GroupDeletionService struct {
+	db              *gorm.DB
+	settingsManager *config.SystemSettingsManager
+	groupManager    *GroupManager
+	keyProvider     *keypool.KeyProvider
+	partitions      *RequestLogPartitionService
+	geoRouting      *GeoRoutingService
+	audit           *AdminAuditService
+	requests        *GroupRequestTracker
+	stopCh          chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewGroupDeletionService creates a new GroupDeletionService.
+func NewGroupDeletionService(db *gorm.DB, settingsManager *config.SystemSettingsManager, groupManager *GroupManager, keyProvider *keypool.KeyProvider, partitions *RequestLogPartitionService, geoRouting *GeoRoutingService, audit *AdminAuditService, requests *GroupRequestTracker) *GroupDeletionService {
+	return &GroupDeletionService{
+		db:              db,
+		settingsManager: settingsManager,
+		groupManager:    groupManager,
+		keyProvider:     keyProvider,
+		partitions:      partitions,
+		geoRouting:      geoRouting,
+		audit:           audit,
+		requests:        requests,
+		stopCh:          make(chan struct{}),
+	}
+}
+
+// Start starts executing scheduled group deletions.
+func (s *GroupDeletionService) Start() {
+	s.wg.Add(1)
+	go s.run()
+	logrus.Debug("Group deletion service started")
+}
+
+// Stop gracefully stops the GroupDeletionService.
+func (s *GroupDeletionService) Stop(ctx context.Context) {
+	close(s.stopCh)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("GroupDeletionService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("GroupDeletionService stop timed out.")
+	}
+}
+
+func (s *GroupDeletionService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(groupDeletionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteDueGroups()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// deleteDueGroups deletes every group whose scheduled deletion time has passed.
+func (s *GroupDeletionService) deleteDueGroups() {
+	var groups []models.Group
+	if err := s.db.Where("delete_after IS NOT NULL AND delete_after <= ?", time.Now()).Find(&groups).Error; err != nil {
+		logrus.Errorf("GroupDeletionService: failed to load scheduled deletions: %v", err)
+		return
+	}
+
+	for _, group := range groups {
+		traffic, err := s.RecentTraffic(group.ID)
+		if err != nil {
+			logrus.WithField("group", group.Name).Errorf("GroupDeletionService: failed to load recent traffic: %v", err)
+		}
+		if err := s.DeleteGroup(group.ID); err != nil {
+			logrus.WithField("group", group.Name).Errorf("GroupDeletionService: scheduled deletion failed: %v", err)
+			continue
+		}
+		s.AuditLog("scheduled_delete", &group, traffic, "scheduler")
+	}
+}
+
+// RecentTraffic returns the requests made to a group within the configured traffic window.
+func (s *GroupDeletionService) RecentTraffic(groupID uint) (*GroupTraffic, error) {
+	traffic := &GroupTraffic{
+		WindowMinutes: s.settingsManager.GetSettings().DeleteTrafficWindowMinutes,
+		TopClients:    []ClientTraffic{},
+	}
+	if traffic.WindowMinutes <= 0 {
+		return traffic, nil
+	}
+
+	since := time.Now().Add(-time.Duration(traffic.WindowMinutes) * time.Minute)
+	recentLogs := func() *gorm.DB {
+		return s.partitions.Query(since, time.Time{}).Where("group_id = ? AND timestamp >= ? AND request_type = ?", groupID, since, models.RequestTypeFinal)
+	}
+
+	if err := recentLogs().Count(&traffic.RequestCount).Error; err != nil {
+		return nil, err
+	}
+	if traffic.RequestCount == 0 {
+		return traffic, nil
+	}
+
+	if err := recentLogs().Select("client_key, COUNT(*) as request_count").
+		Group("client_key").
+		Order("request_count DESC").
+		Limit(groupTrafficTopClients).
+		Scan(&traffic.TopClients).Error; err != nil {
+		return nil, err
+	}
+
+	return traffic, nil
+}
+
+// ScheduleDeletion puts a group into maintenance mode and deletes it at deleteAfter.
+func (s *GroupDeletionService) ScheduleDeletion(groupID uint, deleteAfter time.Time) error {
+	if err := s.db.Model(&models.Group{}).Where("id = ?", groupID).Update("delete_after", deleteAfter).Error; err != nil {
+		return err
+	}
+	return s.groupManager.Invalidate()
+}
+
+// CancelScheduledDeletion cancels a pending scheduled deletion, taking the group out of maintenance mode.
+func (s *GroupDeletionService) CancelScheduledDeletion(groupID uint) error {
+	if err := s.db.Model(&models.Group{}).Where("id = ?", groupID).Update("delete_after", nil).Error; err != nil {
+		return err
+	}
+	return s.groupManager.Invalidate()
+}
+
+// DeleteGroup deletes a group with its keys, from both the database and the key store.
+// New requests for the group are rejected from the start, and its in-flight requests on this
+// node are given up to delete_drain_timeout_seconds to finish before the keys are removed.
+func (s *GroupDeletionService) DeleteGroup(groupID uint) error {
+	s.requests.BeginDeletion(groupID)
+	defer s.requests.EndDeletion(groupID)
+
+	if timeout := time.Duration(s.settingsManager.GetSettings().DeleteDrainTimeoutSeconds) * time.Second; timeout > 0 {
+		if !s.requests.WaitIdle(groupID, timeout) {
+			logrus.WithField("groupID", groupID).Warnf("Group still has in-flight requests after %s, deleting it anyway", timeout)
+		}
+	}
+
+	// First, get all API keys for this group to clean up from memory store
+	var keyIDs []uint
+	if err := s.db.Model(&models.APIKey{}).Where("group_id = ?", groupID).Pluck("id", &keyIDs).Error; err != nil {
+		return err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// First check if the group exists
+		var group models.Group
+		if err := tx.First(&group, groupID).Error; err != nil {
+			return err
+		}
+
+		// Delete associated API keys first due to foreign key constraint
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.APIKey{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("key_group_id = ?", groupID).Delete(&models.GeoRouteRule{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.KeySourceHourlyStat{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.KeySourceDisableStat{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&models.Group{}, groupID).Error; err != nil {
+			return err
+		}
+
+		// Clean up memory store (Redis) within the transaction to ensure atomicity
+		// If Redis cleanup fails, the entire transaction will be rolled back
+		if len(keyIDs) > 0 {
+			if err := s.keyProvider.RemoveKeysFromStore(groupID, keyIDs); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"groupID":  groupID,
+					"keyCount": len(keyIDs),
+					"error":    err,
+				}).Error("Failed to remove keys from memory store, rolling back transaction")
+				return fmt.Errorf("unable to clean up cache: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.groupManager.Invalidate(); err != nil {
+		logrus.WithError(err).Error("failed to invalidate group cache")
+	}
+	s.geoRouting.invalidate()
+	s.keyProvider.CheckPoolViability()
+	return nil
+}
+
+// AuditLog records a group deletion decision together with the traffic evidence at decision time.
+func (s *GroupDeletionService) AuditLog(action string, group *models.Group, traffic *GroupTraffic, actor string) {
+	fields := logrus.Fields{
+		"audit":      "group_deletion",
+		"action":     action,
+		"group_id":   group.ID,
+		"group_name": group.Name,
+		"actor":      actor,
+	}
+	if traffic != nil {
+		fields["window_minutes"] = traffic.WindowMinutes
+		fields["recent_requests"] = traffic.RequestCount
+		fields["top_clients"] = traffic.TopClients
+	}
+	logrus.WithFields(fields).Warn("Group deletion audit")
+
+	delete(fields, "audit")
+	delete(fields, "action")
+	delete(fields, "actor")
+	s.audit.Record(&models.AdminAuditLog{
+		Timestamp: time.Now(),
+		Action:    "group_deletion." + action,
+		Actor:     actor,
+		Detail:    detailJSON(fields),
+	})
+}
@@ -61,6 +61,15 @@ func (gm *GroupManager) Initialize() error {
 				g.HeaderRuleList = []models.HeaderRule{}
 			}
 
+			if len(group.RequiredHeaders) > 0 {
+				if err := json.Unmarshal(group.RequiredHeaders, &g.RequiredHeaderList); err != nil {
+					logrus.WithError(err).WithField("group_name", g.Name).Warn("Failed to parse required headers for group")
+					g.RequiredHeaderList = []models.RequiredHeader{}
+				}
+			} else {
+				g.RequiredHeaderList = []models.RequiredHeader{}
+			}
+
 			groupMap[g.Name] = &g
 			logrus.WithFields(logrus.Fields{
 				"group_name":         g.Name,
@@ -100,6 +109,34 @@ func (gm *GroupManager) GetGroupByName(name string) (*models.Group, error) {
 	return group, nil
 }
 
+// GetGroupByID retrieves a single group by its ID from the cache.
+func (gm *GroupManager) GetGroupByID(id uint) (*models.Group, error) {
+	if gm.syncer == nil {
+		return nil, fmt.Errorf("GroupManager is not initialized")
+	}
+
+	for _, group := range gm.syncer.Get() {
+		if group.ID == id {
+			return group, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListGroups returns all groups from the cache.
+func (gm *GroupManager) ListGroups() ([]*models.Group, error) {
+	if gm.syncer == nil {
+		return nil, fmt.Errorf("GroupManager is not initialized")
+	}
+
+	groups := gm.syncer.Get()
+	result := make([]*models.Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	return result, nil
+}
+
 // Invalidate triggers a cache reload across all instances.
 func (gm *GroupManager) Invalidate() error {
 	if gm.syncer == nil {
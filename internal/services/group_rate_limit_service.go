@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/sirupsen/logrus"
+)
+
+// groupRateLimitKeyPrefix 每分钟一个 hash，字段为分组 ID，值为该分钟内的请求数
+const groupRateLimitKeyPrefix = "group_rate:"
+
+// GroupRateLimitService limits the requests per minute of each group across all its keys,
+// for upstream accounts whose rate limit is shared by every key of the organization.
+// Requests are counted in fixed one-minute windows in the store, so the limit is shared
+// between instances when Redis is used.
+type GroupRateLimitService struct {
+	store   store.Store
+	clock   clock.Clock
+	metrics *metrics.Metrics
+
+	mu         sync.Mutex
+	lastWindow int64
+}
+
+// NewGroupRateLimitService creates a new GroupRateLimitService.
+func NewGroupRateLimitService(store store.Store, clk clock.Clock, appMetrics *metrics.Metrics) *GroupRateLimitService {
+	return &GroupRateLimitService{store: store, clock: clk, metrics: appMetrics}
+}
+
+// Allow counts a request of the group against the current minute. It returns false, without
+// counting the request, when the group's limit is reached, along with the time until the
+// window resets.
+func (s *GroupRateLimitService) Allow(group *models.Group) (bool, time.Duration, error) {
+	limit := int64(group.EffectiveConfig.GroupRateLimitRPM)
+	if limit <= 0 {
+		return true, 0, nil
+	}
+
+	now := s.clock.Now()
+	window := s.window(now)
+	key := groupRateLimitKeyPrefix + strconv.FormatInt(window, 10)
+	field := strconv.FormatUint(uint64(group.ID), 10)
+
+	count, err := s.store.HIncrBy(key, field, 1)
+	if err != nil {
+		return true, 0, fmt.Errorf("failed to count group request: %w", err)
+	}
+	if count <= limit {
+		return true, 0, nil
+	}
+
+	if _, err := s.store.HIncrBy(key, field, -1); err != nil {
+		logrus.WithError(err).Warn("Failed to roll back rejected group request count")
+	}
+	s.metrics.GroupRateLimited.WithLabelValues(group.Name).Inc()
+	return false, time.Unix((window+1)*60, 0).Sub(now), nil
+}
+
+// window returns the current minute. The counters of the previous window are removed once
+// the minute has changed.
+func (s *GroupRateLimitService) window(now time.Time) int64 {
+	window := now.Unix() / 60
+
+	s.mu.Lock()
+	previous := s.lastWindow
+	s.lastWindow = window
+	s.mu.Unlock()
+
+	if previous != 0 && previous != window {
+		if err := s.store.Delete(groupRateLimitKeyPrefix + strconv.FormatInt(previous, 10)); err != nil {
+			logrus.WithError(err).Warn("Failed to remove the previous group rate limit window")
+		}
+	}
+	return window
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGroupRateLimitWindowReset(t *testing.T) {
+	// 从一分钟的第 50 秒开始，10 秒后进入下一个窗口
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 50, 0, time.UTC))
+	s := NewGroupRateLimitService(store.NewMemoryStore(fake), fake, metrics.NewMetrics(prometheus.NewRegistry()))
+	group := &models.Group{ID: 1, Name: "limited"}
+	group.EffectiveConfig.GroupRateLimitRPM = 2
+	other := &models.Group{ID: 2, Name: "other"}
+	other.EffectiveConfig.GroupRateLimitRPM = 2
+
+	steps := []struct {
+		name           string
+		advance        time.Duration
+		group          *models.Group
+		wantAllowed    bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "first request", group: group, wantAllowed: true},
+		{name: "second request", advance: 2 * time.Second, group: group, wantAllowed: true},
+		{name: "over the limit", advance: 3 * time.Second, group: group, wantAllowed: false, wantRetryAfter: 5 * time.Second},
+		{name: "rejected request is not counted", advance: time.Second, group: group, wantAllowed: false, wantRetryAfter: 4 * time.Second},
+		{name: "other group has its own budget", group: other, wantAllowed: true},
+		{name: "budget resets in the next minute", advance: 4 * time.Second, group: group, wantAllowed: true},
+		{name: "second request in the new minute", group: group, wantAllowed: true},
+		{name: "over the limit in the new minute", advance: 30 * time.Second, group: group, wantAllowed: false, wantRetryAfter: 30 * time.Second},
+	}
+
+	for _, step := range steps {
+		fake.Advance(step.advance)
+		allowed, retryAfter, err := s.Allow(step.group)
+		if err != nil {
+			t.Fatalf("%s: Allow: %v", step.name, err)
+		}
+		if allowed != step.wantAllowed || retryAfter != step.wantRetryAfter {
+			t.Errorf("%s: Allow = (%v, %v), want (%v, %v)", step.name, allowed, retryAfter, step.wantAllowed, step.wantRetryAfter)
+		}
+	}
+}
+
+func TestGroupRateLimitDisabled(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewGroupRateLimitService(store.NewMemoryStore(fake), fake, metrics.NewMetrics(prometheus.NewRegistry()))
+	group := &models.Group{ID: 1, Name: "unlimited"}
+
+	for i := 0; i < 100; i++ {
+		if allowed, _, err := s.Allow(group); err != nil || !allowed {
+			t.Fatalf("request %d: Allow = (%v, %v), want allowed", i, allowed, err)
+		}
+	}
+}
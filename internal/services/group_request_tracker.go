@@ -0,0 +1,90 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// groupDrainPollInterval 是等待分组请求完成时检查计数的间隔
+const groupDrainPollInterval = 50 * time.Millisecond
+
+// GroupRequestTracker counts the in-flight proxy requests of each group on this node, so a
+// group being deleted stops accepting requests and drains them before its keys are removed.
+type GroupRequestTracker struct {
+	mu       sync.Mutex
+	inFlight map[uint]int
+	deleting map[uint]struct{}
+}
+
+// NewGroupRequestTracker creates a new GroupRequestTracker.
+func NewGroupRequestTracker() *GroupRequestTracker {
+	return &GroupRequestTracker{
+		inFlight: make(map[uint]int),
+		deleting: make(map[uint]struct{}),
+	}
+}
+
+// Acquire registers a request for the group and returns the function that releases it. It
+// returns false without registering the request when the group is being deleted.
+func (t *GroupRequestTracker) Acquire(groupID uint) (release func(), ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, deleting := t.deleting[groupID]; deleting {
+		return nil, false
+	}
+	t.inFlight[groupID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.inFlight[groupID]--; t.inFlight[groupID] <= 0 {
+				delete(t.inFlight, groupID)
+			}
+		})
+	}, true
+}
+
+// Deleting reports whether the group is being deleted.
+func (t *GroupRequestTracker) Deleting(groupID uint) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, deleting := t.deleting[groupID]
+	return deleting
+}
+
+// BeginDeletion marks the group as being deleted, so new requests for it are rejected.
+func (t *GroupRequestTracker) BeginDeletion(groupID uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deleting[groupID] = struct{}{}
+}
+
+// EndDeletion clears the deletion mark once the group is gone or its deletion failed.
+func (t *GroupRequestTracker) EndDeletion(groupID uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.deleting, groupID)
+}
+
+// WaitIdle waits until the group has no in-flight requests, returning false on timeout.
+func (t *GroupRequestTracker) WaitIdle(groupID uint, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if t.inFlightCount(groupID) == 0 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(groupDrainPollInterval)
+	}
+}
+
+func (t *GroupRequestTracker) inFlightCount(groupID uint) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inFlight[groupID]
+}
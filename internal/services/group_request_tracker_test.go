@@ -0,0 +1,172 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupRequestTracker(t *testing.T) {
+	type step struct {
+		op       string // acquire, release, release-again, begin or end
+		wantOK   bool   // acquire 是否成功
+		wantIdle bool   // 该步骤之后分组 1 是否没有请求
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "acquire and release",
+			steps: []step{
+				{op: "acquire", wantOK: true},
+				{op: "release", wantIdle: true},
+			},
+		},
+		{
+			name: "release is idempotent",
+			steps: []step{
+				{op: "acquire", wantOK: true},
+				{op: "acquire", wantOK: true},
+				{op: "release"},
+				{op: "release-again"},
+				{op: "release", wantIdle: true},
+			},
+		},
+		{
+			name: "deleting group rejects new requests",
+			steps: []step{
+				{op: "begin", wantIdle: true},
+				{op: "acquire", wantOK: false, wantIdle: true},
+			},
+		},
+		{
+			name: "in-flight requests outlive the deletion mark",
+			steps: []step{
+				{op: "acquire", wantOK: true},
+				{op: "begin"},
+				{op: "acquire", wantOK: false},
+				{op: "release", wantIdle: true},
+			},
+		},
+		{
+			name: "requests accepted again after deletion ends",
+			steps: []step{
+				{op: "begin", wantIdle: true},
+				{op: "end", wantIdle: true},
+				{op: "acquire", wantOK: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewGroupRequestTracker()
+			var releases []func()
+			var released func()
+			for i, s := range tt.steps {
+				switch s.op {
+				case "acquire":
+					release, ok := tracker.Acquire(1)
+					if ok != s.wantOK {
+						t.Fatalf("step %d: Acquire ok = %v, want %v", i, ok, s.wantOK)
+					}
+					if ok {
+						releases = append(releases, release)
+					}
+				case "release":
+					released = releases[0]
+					releases = releases[1:]
+					released()
+				case "release-again":
+					// 重复调用已执行过的 release 不影响计数
+					released()
+				case "begin":
+					tracker.BeginDeletion(1)
+				case "end":
+					tracker.EndDeletion(1)
+				}
+				if idle := tracker.inFlightCount(1) == 0; idle != s.wantIdle {
+					t.Fatalf("step %d (%s): idle = %v, want %v", i, s.op, idle, s.wantIdle)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupRequestTrackerWaitIdle(t *testing.T) {
+	tests := []struct {
+		name       string
+		releaseIn  time.Duration // 请求完成的时间，0 表示没有请求
+		timeout    time.Duration
+		wantIdle   bool
+		maxElapsed time.Duration
+	}{
+		{name: "no requests", timeout: time.Second, wantIdle: true, maxElapsed: 100 * time.Millisecond},
+		{name: "request finishes in time", releaseIn: 100 * time.Millisecond, timeout: 5 * time.Second, wantIdle: true, maxElapsed: 2 * time.Second},
+		{name: "request outlives timeout", releaseIn: time.Hour, timeout: 150 * time.Millisecond, wantIdle: false, maxElapsed: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewGroupRequestTracker()
+			if tt.releaseIn > 0 {
+				release, _ := tracker.Acquire(1)
+				timer := time.AfterFunc(tt.releaseIn, release)
+				defer timer.Stop()
+			}
+
+			start := time.Now()
+			if got := tracker.WaitIdle(1, tt.timeout); got != tt.wantIdle {
+				t.Errorf("WaitIdle = %v, want %v", got, tt.wantIdle)
+			}
+			if elapsed := time.Since(start); elapsed > tt.maxElapsed {
+				t.Errorf("WaitIdle took %v, want at most %v", elapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+func TestGroupRequestTrackerConcurrentDeletion(t *testing.T) {
+	tracker := NewGroupRequestTracker()
+	const workers = 50
+
+	// 删除开始后，已登记的请求都完成前 WaitIdle 不返回，新请求全部被拒绝
+	var wg sync.WaitGroup
+	acquired := make(chan func(), workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, ok := tracker.Acquire(1); ok {
+				acquired <- release
+			}
+		}()
+	}
+	wg.Wait()
+	close(acquired)
+	tracker.BeginDeletion(1)
+
+	for i := 0; i < workers; i++ {
+		if _, ok := tracker.Acquire(1); ok {
+			t.Fatal("request accepted while the group is being deleted")
+		}
+	}
+
+	var releaseWG sync.WaitGroup
+	for release := range acquired {
+		releaseWG.Add(1)
+		go func(release func()) {
+			defer releaseWG.Done()
+			time.Sleep(10 * time.Millisecond)
+			release()
+		}(release)
+	}
+	if !tracker.WaitIdle(1, 5*time.Second) {
+		t.Fatal("group not idle after every request finished")
+	}
+	releaseWG.Wait()
+	if n := tracker.inFlightCount(1); n != 0 {
+		t.Errorf("in-flight count = %d after drain, want 0", n)
+	}
+}
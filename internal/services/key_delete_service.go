@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"gpt-load/internal/models"
+	appruntime "gpt-load/internal/runtime"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -23,13 +24,15 @@ type KeyDeleteResult struct {
 type KeyDeleteService struct {
 	TaskService *TaskService
 	KeyService  *KeyService
+	Pool        *appruntime.GoroutinePool
 }
 
 // NewKeyDeleteService creates a new KeyDeleteService.
-func NewKeyDeleteService(taskService *TaskService, keyService *KeyService) *KeyDeleteService {
+func NewKeyDeleteService(taskService *TaskService, keyService *KeyService, pool *appruntime.GoroutinePool) *KeyDeleteService {
 	return &KeyDeleteService{
 		TaskService: taskService,
 		KeyService:  keyService,
+		Pool:        pool,
 	}
 }
 
@@ -45,7 +48,7 @@ func (s *KeyDeleteService) StartDeleteTask(group *models.Group, keysText string)
 		return nil, err
 	}
 
-	go s.runDelete(group, keys)
+	s.Pool.GoNoWait(func() { s.runDelete(group, keys) })
 
 	return initialStatus, nil
 }
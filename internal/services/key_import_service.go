@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"gpt-load/internal/models"
+	appruntime "gpt-load/internal/runtime"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -23,18 +24,21 @@ type KeyImportResult struct {
 type KeyImportService struct {
 	TaskService *TaskService
 	KeyService  *KeyService
+	Pool        *appruntime.GoroutinePool
 }
 
 // NewKeyImportService creates a new KeyImportService.
-func NewKeyImportService(taskService *TaskService, keyService *KeyService) *KeyImportService {
+func NewKeyImportService(taskService *TaskService, keyService *KeyService, pool *appruntime.GoroutinePool) *KeyImportService {
 	return &KeyImportService{
 		TaskService: taskService,
 		KeyService:  keyService,
+		Pool:        pool,
 	}
 }
 
-// StartImportTask initiates a new asynchronous key import task.
-func (s *KeyImportService) StartImportTask(group *models.Group, keysText string) (*TaskStatus, error) {
+// StartImportTask initiates a new asynchronous key import task. source is the source of keys
+// without a source column in the text, empty for none.
+func (s *KeyImportService) StartImportTask(group *models.Group, keysText string, source string) (*TaskStatus, error) {
 	keys := s.KeyService.ParseKeysFromText(keysText)
 	if len(keys) == 0 {
 		return nil, fmt.Errorf("no valid keys found in the input text")
@@ -45,12 +49,14 @@ func (s *KeyImportService) StartImportTask(group *models.Group, keysText string)
 		return nil, err
 	}
 
-	go s.runImport(group, keys)
+	scopes := s.KeyService.ParseKeyScopesFromText(keysText)
+	sources := s.KeyService.ParseKeySourcesFromText(keysText, keys, source)
+	s.Pool.GoNoWait(func() { s.runImport(group, keys, scopes, sources) })
 
 	return initialStatus, nil
 }
 
-func (s *KeyImportService) runImport(group *models.Group, keys []string) {
+func (s *KeyImportService) runImport(group *models.Group, keys []string, scopes map[string]models.KeyScope, sources map[string]string) {
 	progressCallback := func(processed int) {
 		if err := s.TaskService.UpdateProgress(processed); err != nil {
 			logrus.Warnf("Failed to update task progress for group %d: %v", group.ID, err)
@@ -64,6 +70,22 @@ func (s *KeyImportService) runImport(group *models.Group, keys []string) {
 		}
 		return
 	}
+	if len(scopes) > 0 {
+		if _, err := s.KeyService.ApplyKeyScopes(group.ID, scopes); err != nil {
+			if endErr := s.TaskService.EndTask(nil, err); endErr != nil {
+				logrus.Errorf("Failed to end task with error for group %d: %v (original error: %v)", group.ID, endErr, err)
+			}
+			return
+		}
+	}
+	if len(sources) > 0 {
+		if _, err := s.KeyService.ApplyKeySources(group.ID, sources); err != nil {
+			if endErr := s.TaskService.EndTask(nil, err); endErr != nil {
+				logrus.Errorf("Failed to end task with error for group %d: %v (original error: %v)", group.ID, endErr, err)
+			}
+			return
+		}
+	}
 
 	result := KeyImportResult{
 		AddedCount:   addedCount,
@@ -5,6 +5,7 @@ import (
 	"gpt-load/internal/config"
 	"gpt-load/internal/keypool"
 	"gpt-load/internal/models"
+	appruntime "gpt-load/internal/runtime"
 	"gpt-load/internal/types"
 	"sync"
 	"time"
@@ -27,16 +28,18 @@ type KeyManualValidationService struct {
 	TaskService     *TaskService
 	SettingsManager *config.SystemSettingsManager
 	ConfigManager   types.ConfigManager
+	Pool            *appruntime.GoroutinePool
 }
 
 // NewKeyManualValidationService creates a new KeyManualValidationService.
-func NewKeyManualValidationService(db *gorm.DB, validator *keypool.KeyValidator, taskService *TaskService, settingsManager *config.SystemSettingsManager, configManager types.ConfigManager) *KeyManualValidationService {
+func NewKeyManualValidationService(db *gorm.DB, validator *keypool.KeyValidator, taskService *TaskService, settingsManager *config.SystemSettingsManager, configManager types.ConfigManager, pool *appruntime.GoroutinePool) *KeyManualValidationService {
 	return &KeyManualValidationService{
 		DB:              db,
 		Validator:       validator,
 		TaskService:     taskService,
 		SettingsManager: settingsManager,
 		ConfigManager:   configManager,
+		Pool:            pool,
 	}
 }
 
@@ -62,7 +65,7 @@ func (s *KeyManualValidationService) StartValidationTask(group *models.Group, st
 		return nil, err
 	}
 
-	// Run the validation in a separate goroutine
+	// Run the validation in a separate goroutine. It only waits on its workers, which take the pool slots.
 	go s.runValidation(group, keys, status)
 
 	return taskStatus, nil
@@ -86,7 +89,7 @@ func (s *KeyManualValidationService) runValidation(group *models.Group, keys []m
 	var wg sync.WaitGroup
 	for range concurrency {
 		wg.Add(1)
-		go s.validationWorker(&wg, group, jobs, results)
+		s.Pool.Go(func() { s.validationWorker(&wg, group, jobs, results) })
 	}
 
 	for _, key := range keys {
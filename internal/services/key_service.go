@@ -1,6 +1,7 @@
 package services
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"gpt-load/internal/keypool"
@@ -17,6 +18,12 @@ const (
 	chunkSize      = 1000
 )
 
+// Key export formats.
+const (
+	KeyExportFormatText = "text"
+	KeyExportFormatCSV  = "csv"
+)
+
 // AddKeysResult holds the result of adding multiple keys.
 type AddKeysResult struct {
 	AddedCount   int   `json:"added_count"`
@@ -55,8 +62,9 @@ func NewKeyService(db *gorm.DB, keyProvider *keypool.KeyProvider, keyValidator *
 }
 
 // AddMultipleKeys handles the business logic of creating new keys from a text block.
+// source is the source of keys without a source column in the text, empty for none.
 // deprecated: use KeyImportService for large imports
-func (s *KeyService) AddMultipleKeys(groupID uint, keysText string) (*AddKeysResult, error) {
+func (s *KeyService) AddMultipleKeys(groupID uint, keysText string, source string) (*AddKeysResult, error) {
 	keys := s.ParseKeysFromText(keysText)
 	if len(keys) > maxRequestKeys {
 		return nil, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keys))
@@ -69,6 +77,16 @@ func (s *KeyService) AddMultipleKeys(groupID uint, keysText string) (*AddKeysRes
 	if err != nil {
 		return nil, err
 	}
+	if scopes := s.ParseKeyScopesFromText(keysText); len(scopes) > 0 {
+		if _, err := s.ApplyKeyScopes(groupID, scopes); err != nil {
+			return nil, err
+		}
+	}
+	if sources := s.ParseKeySourcesFromText(keysText, keys, source); len(sources) > 0 {
+		if _, err := s.ApplyKeySources(groupID, sources); err != nil {
+			return nil, err
+		}
+	}
 
 	var totalInGroup int64
 	if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Count(&totalInGroup).Error; err != nil {
@@ -147,6 +165,10 @@ func (s *KeyService) processAndCreateKeys(
 // ParseKeysFromText parses a string of keys from various formats into a string slice.
 // This function is exported to be shared with the handler layer.
 func (s *KeyService) ParseKeysFromText(text string) []string {
+	if keys, _, _, ok := parseKeyColumns(text); ok {
+		return s.filterValidKeys(keys)
+	}
+
 	var keys []string
 
 	// First, try to parse as a JSON array of strings
@@ -168,6 +190,189 @@ func (s *KeyService) ParseKeysFromText(text string) []string {
 	return s.filterValidKeys(keys)
 }
 
+// ParseKeyScopesFromText returns the OpenAI organization and project of each key when the
+// text is CSV with a header row naming the key, org_id and project_id columns.
+// Keys without either value are omitted.
+func (s *KeyService) ParseKeyScopesFromText(text string) map[string]models.KeyScope {
+	_, scopes, _, _ := parseKeyColumns(text)
+	return scopes
+}
+
+// ParseKeySourcesFromText returns the source of each of the parsed keys: the value of the
+// source column when the text is CSV with one, otherwise defaultSource. Keys without a
+// source are omitted.
+func (s *KeyService) ParseKeySourcesFromText(text string, keys []string, defaultSource string) map[string]string {
+	_, _, columnSources, _ := parseKeyColumns(text)
+	sources := make(map[string]string)
+	for _, key := range keys {
+		if source := columnSources[key]; source != "" {
+			sources[key] = source
+		} else if defaultSource != "" {
+			sources[key] = defaultSource
+		}
+	}
+	return sources
+}
+
+// parseKeyColumns parses CSV text whose first line is a header with a key column
+// ("key" or "key_value") and at least one of org_id, project_id and source.
+func parseKeyColumns(text string) ([]string, map[string]models.KeyScope, map[string]string, bool) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimSpace(text)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	keyCol, orgCol, projectCol, sourceCol := -1, -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "key", "key_value":
+			keyCol = i
+		case "org_id":
+			orgCol = i
+		case "project_id":
+			projectCol = i
+		case "source":
+			sourceCol = i
+		}
+	}
+	if keyCol < 0 || (orgCol < 0 && projectCol < 0 && sourceCol < 0) {
+		return nil, nil, nil, false
+	}
+
+	column := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var keys []string
+	scopes := make(map[string]models.KeyScope)
+	sources := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, false
+		}
+		key := column(record, keyCol)
+		if key == "" {
+			continue
+		}
+		keys = append(keys, key)
+		scope := models.KeyScope{OrgID: column(record, orgCol), ProjectID: column(record, projectCol)}
+		if scope.OrgID != "" || scope.ProjectID != "" {
+			scopes[key] = scope
+		}
+		if source := column(record, sourceCol); source != "" {
+			// 超出列长度的来源截断保存
+			if len(source) > keypool.MaxKeySourceLength {
+				source = strings.ToValidUTF8(source[:keypool.MaxKeySourceLength], "")
+			}
+			sources[key] = source
+		}
+	}
+	return keys, scopes, sources, true
+}
+
+// ApplyKeyScopes sets the OpenAI organization and project of existing keys in a group.
+func (s *KeyService) ApplyKeyScopes(groupID uint, scopes map[string]models.KeyScope) (int, error) {
+	keysByScope := make(map[models.KeyScope][]string)
+	for key, scope := range scopes {
+		keysByScope[scope] = append(keysByScope[scope], key)
+	}
+
+	updatedCount := 0
+	for scope, keys := range keysByScope {
+		for i := 0; i < len(keys); i += chunkSize {
+			end := i + chunkSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+			var keyIDs []uint
+			if err := s.DB.Model(&models.APIKey{}).
+				Where("group_id = ? AND key_value IN ?", groupID, models.KeyValueLookups(keys[i:end])).
+				Pluck("id", &keyIDs).Error; err != nil {
+				return updatedCount, err
+			}
+			if err := s.KeyProvider.UpdateKeyScope(keyIDs, scope); err != nil {
+				return updatedCount, err
+			}
+			updatedCount += len(keyIDs)
+		}
+	}
+	return updatedCount, nil
+}
+
+// UpdateKeyScopes sets the same OpenAI organization and project on the keys in a text block.
+// Empty values clear them.
+func (s *KeyService) UpdateKeyScopes(groupID uint, keysText string, scope models.KeyScope) (int, error) {
+	keys := s.ParseKeysFromText(keysText)
+	if len(keys) > maxRequestKeys {
+		return 0, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keys))
+	}
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("no valid keys found in the input text")
+	}
+
+	scopes := make(map[string]models.KeyScope, len(keys))
+	for _, key := range keys {
+		scopes[key] = scope
+	}
+	return s.ApplyKeyScopes(groupID, scopes)
+}
+
+// ApplyKeySources sets the source of existing keys in a group.
+func (s *KeyService) ApplyKeySources(groupID uint, sources map[string]string) (int, error) {
+	keysBySource := make(map[string][]string)
+	for key, source := range sources {
+		keysBySource[source] = append(keysBySource[source], key)
+	}
+
+	updatedCount := 0
+	for source, keys := range keysBySource {
+		for i := 0; i < len(keys); i += chunkSize {
+			end := i + chunkSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+			var keyIDs []uint
+			if err := s.DB.Model(&models.APIKey{}).
+				Where("group_id = ? AND key_value IN ?", groupID, models.KeyValueLookups(keys[i:end])).
+				Pluck("id", &keyIDs).Error; err != nil {
+				return updatedCount, err
+			}
+			if err := s.KeyProvider.UpdateKeySource(keyIDs, source); err != nil {
+				return updatedCount, err
+			}
+			updatedCount += len(keyIDs)
+		}
+	}
+	return updatedCount, nil
+}
+
+// UpdateKeySources sets the same source on the keys in a text block. An empty source clears it.
+func (s *KeyService) UpdateKeySources(groupID uint, keysText string, source string) (int, error) {
+	keys := s.ParseKeysFromText(keysText)
+	if len(keys) > maxRequestKeys {
+		return 0, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keys))
+	}
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("no valid keys found in the input text")
+	}
+
+	sources := make(map[string]string, len(keys))
+	for _, key := range keys {
+		sources[key] = source
+	}
+	return s.ApplyKeySources(groupID, sources)
+}
+
 // filterValidKeys validates and filters potential API keys
 func (s *KeyService) filterValidKeys(keys []string) []string {
 	var validKeys []string
@@ -295,7 +500,12 @@ func (s *KeyService) ListKeysInGroupQuery(groupID uint, statusFilter string, sea
 	}
 
 	if searchKeyword != "" {
-		query = query.Where("key_value LIKE ?", "%"+searchKeyword+"%")
+		if models.KeyEncryptionEnabled() {
+			// 加密后的密钥无法模糊匹配，仅能按完整密钥查找；未迁移的明文密钥仍支持模糊搜索
+			query = query.Where("key_value LIKE ? OR key_value IN ?", "%"+searchKeyword+"%", models.KeyValueLookups([]string{searchKeyword}))
+		} else {
+			query = query.Where("key_value LIKE ?", "%"+searchKeyword+"%")
+		}
 	}
 
 	query = query.Order("last_used_at desc, updated_at desc")
@@ -331,8 +541,10 @@ func (s *KeyService) TestMultipleKeys(group *models.Group, keysText string) ([]k
 }
 
 // StreamKeysToWriter fetches keys from the database in batches and writes them to the provided writer.
-func (s *KeyService) StreamKeysToWriter(groupID uint, statusFilter string, writer io.Writer) error {
-	query := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Select("id, key_value")
+// The csv format writes a header row and the source, organization and project of each key,
+// which importing the file restores.
+func (s *KeyService) StreamKeysToWriter(groupID uint, statusFilter string, format string, writer io.Writer) error {
+	query := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Select("id, key_value, source, org_id, project_id")
 
 	switch statusFilter {
 	case models.KeyStatusActive, models.KeyStatusInvalid:
@@ -342,6 +554,28 @@ func (s *KeyService) StreamKeysToWriter(groupID uint, statusFilter string, write
 		return fmt.Errorf("invalid status filter: %s", statusFilter)
 	}
 
+	if format == KeyExportFormatCSV {
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write([]string{"key", "source", "org_id", "project_id"}); err != nil {
+			return err
+		}
+		var keys []models.APIKey
+		err := query.FindInBatches(&keys, chunkSize, func(tx *gorm.DB, batch int) error {
+			for _, key := range keys {
+				if err := csvWriter.Write([]string{key.KeyValue, key.Source, key.OrgID, key.ProjectID}); err != nil {
+					return err
+				}
+			}
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}).Error
+		if err != nil {
+			return err
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+
 	var keys []models.APIKey
 	err := query.FindInBatches(&keys, chunkSize, func(tx *gorm.DB, batch int) error {
 		for _, key := range keys {
@@ -354,3 +588,53 @@ func (s *KeyService) StreamKeysToWriter(groupID uint, statusFilter string, write
 
 	return err
 }
+
+// ReEncryptKeysResult holds the result of re-encrypting the stored keys.
+type ReEncryptKeysResult struct {
+	TotalCount       int `json:"total_count"`
+	ReEncryptedCount int `json:"re_encrypted_count"`
+	// 密钥值被重新加密的请求日志数
+	ReEncryptedLogCount int64 `json:"re_encrypted_log_count"`
+}
+
+// ReEncryptKeys rewrites every stored key value with the current DB_ENCRYPTION_KEY.
+// Values encrypted with DB_OLD_ENCRYPTION_KEY are decrypted with it, and plaintext values
+// written before encryption was enabled are encrypted. It runs in a single transaction,
+// so any failure leaves every key unchanged.
+func (s *KeyService) ReEncryptKeys() (*ReEncryptKeysResult, error) {
+	if !models.KeyEncryptionEnabled() {
+		return nil, fmt.Errorf("DB_ENCRYPTION_KEY is not configured")
+	}
+
+	result := &ReEncryptKeysResult{}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// 跳过模型钩子，直接读写数据库中的存储形式
+		raw := tx.Session(&gorm.Session{SkipHooks: true})
+
+		var batch []models.APIKey
+		return raw.Model(&models.APIKey{}).Select("id, key_value").FindInBatches(&batch, chunkSize, func(_ *gorm.DB, _ int) error {
+			for _, key := range batch {
+				result.TotalCount++
+				plaintext, err := models.DecryptKeyValue(key.KeyValue)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt key %d: %w", key.ID, err)
+				}
+
+				encrypted := models.EncryptKeyValue(plaintext)
+				if encrypted == key.KeyValue {
+					continue
+				}
+				if err := raw.Model(&models.APIKey{}).Where("id = ?", key.ID).UpdateColumn("key_value", encrypted).Error; err != nil {
+					return fmt.Errorf("failed to update key %d: %w", key.ID, err)
+				}
+				result.ReEncryptedCount++
+			}
+			return nil
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
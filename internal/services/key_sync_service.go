@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const keySyncFetchTimeout = time.Minute
+
+// KeySyncSource lists the keys currently offered by a provider.
+type KeySyncSource interface {
+	FetchKeys(ctx context.Context) (string, error)
+}
+
+// KeySyncSourceFactory creates a KeySyncSource from a source URI.
+type KeySyncSourceFactory func(source *url.URL) (KeySyncSource, error)
+
+var keySyncSources = map[string]KeySyncSourceFactory{
+	"file": newFileKeySyncSource,
+}
+
+// RegisterKeySyncSource registers a key sync source for a URI scheme.
+func RegisterKeySyncSource(scheme string, factory KeySyncSourceFactory) {
+	keySyncSources[scheme] = factory
+}
+
+// NewKeySyncSource creates the key sync source for a URI such as file:///data/keys.txt.
+func NewKeySyncSource(uri string) (KeySyncSource, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key sync source: %w", err)
+	}
+	factory, ok := keySyncSources[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key sync source scheme: %q", u.Scheme)
+	}
+	return factory(u)
+}
+
+// fileKeySyncSource reads keys from a local file, in any format accepted by key import.
+type fileKeySyncSource struct {
+	path string
+}
+
+func newFileKeySyncSource(source *url.URL) (KeySyncSource, error) {
+	path := source.Host + source.Path
+	if source.Opaque != "" {
+		path = source.Opaque
+	}
+	if path == "" {
+		return nil, fmt.Errorf("file key sync source requires a path")
+	}
+	return &fileKeySyncSource{path: path}, nil
+}
+
+func (s *fileKeySyncSource) FetchKeys(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key file %s: %w", s.path, err)
+	}
+	return string(data), nil
+}
+
+// KeySyncResult is the outcome of one sync cycle of a group.
+type KeySyncResult struct {
+	Added    int   `json:"added"`
+	Disabled int64 `json:"disabled"`
+	Restored int64 `json:"restored"`
+}
+
+// KeySyncService periodically syncs the keys of groups with a key sync source:
+// new keys are added, keys no longer offered are disabled, and returning keys are restored.
+type KeySyncService struct {
+	db            *gorm.DB
+	configManager types.ConfigManager
+	keyService    *KeyService
+	keyProvider   *keypool.KeyProvider
+	started       bool
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewKeySyncService creates a new KeySyncService.
+func NewKeySyncService(db *gorm.DB, configManager types.ConfigManager, keyService *KeyService, keyProvider *keypool.KeyProvider) *KeySyncService {
+	return &KeySyncService{
+		db:            db,
+		configManager: configManager,
+		keyService:    keyService,
+		keyProvider:   keyProvider,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Start starts the periodic sync. It does nothing when the sync interval is 0.
+func (s *KeySyncService) Start() {
+	interval := time.Duration(s.configManager.GetKeySyncConfig().IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		logrus.Debug("Key sync disabled.")
+		return
+	}
+
+	s.started = true
+	s.wg.Add(1)
+	go s.runLoop(interval)
+}
+
+// Stop gracefully stops the KeySyncService.
+func (s *KeySyncService) Stop(ctx context.Context) {
+	if !s.started {
+		return
+	}
+	close(s.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("KeySyncService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("KeySyncService stop timed out.")
+	}
+}
+
+func (s *KeySyncService) runLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	s.syncAll()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.syncAll()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// syncAll runs one sync cycle for every group with a key sync source.
+func (s *KeySyncService) syncAll() {
+	var groups []models.Group
+	if err := s.db.Where("key_sync_source <> ''").Find(&groups).Error; err != nil {
+		logrus.Errorf("KeySyncService: failed to load groups: %v", err)
+		return
+	}
+
+	for i := range groups {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+
+		group := &groups[i]
+		result, err := s.SyncGroup(group)
+		if err != nil {
+			logrus.WithField("group", group.Name).Errorf("KeySyncService: sync failed: %v", err)
+			continue
+		}
+		if result.Added > 0 || result.Disabled > 0 || result.Restored > 0 {
+			logrus.WithFields(logrus.Fields{
+				"group":    group.Name,
+				"added":    result.Added,
+				"disabled": result.Disabled,
+				"restored": result.Restored,
+			}).Info("KeySyncService: keys synced")
+		}
+	}
+}
+
+// SyncGroup runs one sync cycle for a group.
+func (s *KeySyncService) SyncGroup(group *models.Group) (*KeySyncResult, error) {
+	source, err := NewKeySyncSource(group.KeySyncSource)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keySyncFetchTimeout)
+	defer cancel()
+	text, err := source.FetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	offered := make(map[string]struct{})
+	for _, key := range s.keyService.filterValidKeys(s.keyService.ParseKeysFromText(text)) {
+		offered[key] = struct{}{}
+	}
+	// 同步源返回空列表通常是配置或源异常，不据此禁用全部密钥
+	if len(offered) == 0 {
+		return nil, fmt.Errorf("key sync source returned no keys")
+	}
+
+	var existing []models.APIKey
+	if err := s.db.Where("group_id = ?", group.ID).Select("key_value", "status", "sync_removed_at").Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to load existing keys: %w", err)
+	}
+
+	existingKeys := make(map[string]struct{}, len(existing))
+	var toDisable, toRestore []string
+	for _, key := range existing {
+		existingKeys[key.KeyValue] = struct{}{}
+		_, stillOffered := offered[key.KeyValue]
+		switch {
+		case !stillOffered && key.SyncRemovedAt == nil:
+			toDisable = append(toDisable, key.KeyValue)
+		case stillOffered && key.SyncRemovedAt != nil:
+			toRestore = append(toRestore, key.KeyValue)
+		}
+	}
+
+	var toAdd []string
+	for key := range offered {
+		if _, ok := existingKeys[key]; !ok {
+			toAdd = append(toAdd, key)
+		}
+	}
+
+	result := &KeySyncResult{}
+	if len(toAdd) > 0 {
+		added, _, err := s.keyService.processAndCreateKeys(group.ID, toAdd, nil)
+		result.Added = added
+		if err != nil {
+			return result, fmt.Errorf("failed to add synced keys: %w", err)
+		}
+	}
+
+	if result.Disabled, err = s.keyProvider.DisableKeys(group.ID, toDisable); err != nil {
+		return result, fmt.Errorf("failed to disable removed keys: %w", err)
+	}
+
+	if result.Restored, err = s.keyProvider.RestoreMultipleKeys(group.ID, toRestore); err != nil {
+		return result, fmt.Errorf("failed to restore returning keys: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type staticKeySyncSource string
+
+func (s staticKeySyncSource) FetchKeys(ctx context.Context) (string, error) { return string(s), nil }
+
+func TestNewKeySyncSource(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("sk-one\nsk-two\n"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	RegisterKeySyncSource("static-test", func(source *url.URL) (KeySyncSource, error) {
+		return staticKeySyncSource(source.Query().Get("keys")), nil
+	})
+	t.Cleanup(func() { delete(keySyncSources, "static-test") })
+
+	tests := []struct {
+		name     string
+		uri      string
+		wantKeys string
+		wantErr  string
+	}{
+		{name: "absolute file", uri: "file://" + keyFile, wantKeys: "sk-one\nsk-two\n"},
+		{name: "opaque file path", uri: "file:" + keyFile, wantKeys: "sk-one\nsk-two\n"},
+		{name: "registered scheme", uri: "static-test://?keys=sk-three", wantKeys: "sk-three"},
+		{name: "missing file", uri: "file://" + filepath.Join(dir, "missing.txt"), wantErr: "failed to read key file"},
+		{name: "file without path", uri: "file://", wantErr: "requires a path"},
+		{name: "unsupported scheme", uri: "ftp://example.com/keys.txt", wantErr: `unsupported key sync source scheme: "ftp"`},
+		{name: "no scheme", uri: "/data/keys.txt", wantErr: `unsupported key sync source scheme: ""`},
+		{name: "invalid uri", uri: "file://%zz", wantErr: "invalid key sync source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewKeySyncSource(tt.uri)
+			var keys string
+			if err == nil {
+				keys, err = source.FetchKeys(context.Background())
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if keys != tt.wantKeys {
+				t.Errorf("FetchKeys() = %q, want %q", keys, tt.wantKeys)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"gpt-load/internal/config"
-	"gpt-load/internal/models"
 	"sync"
 	"time"
 
@@ -15,15 +14,17 @@ import (
 type LogCleanupService struct {
 	db              *gorm.DB
 	settingsManager *config.SystemSettingsManager
+	partitions      *RequestLogPartitionService
 	stopCh          chan struct{}
 	wg              sync.WaitGroup
 }
 
 // NewLogCleanupService 创建新的日志清理服务
-func NewLogCleanupService(db *gorm.DB, settingsManager *config.SystemSettingsManager) *LogCleanupService {
+func NewLogCleanupService(db *gorm.DB, settingsManager *config.SystemSettingsManager, partitions *RequestLogPartitionService) *LogCleanupService {
 	return &LogCleanupService{
 		db:              db,
 		settingsManager: settingsManager,
+		partitions:      partitions,
 		stopCh:          make(chan struct{}),
 	}
 }
@@ -86,20 +87,28 @@ func (s *LogCleanupService) cleanupExpiredLogs() {
 	// 计算过期时间点
 	cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
 
-	// 执行删除操作
-	result := s.db.Where("timestamp < ?", cutoffTime).Delete(&models.RequestLog{})
-	if result.Error != nil {
-		logrus.WithError(result.Error).Error("Failed to cleanup expired request logs")
+	// 执行删除操作，启用分区时整体删除过期的分区
+	deletedCount, droppedPartitions, err := s.partitions.DeleteBefore(cutoffTime)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to cleanup expired request logs")
 		return
 	}
 
-	if result.RowsAffected > 0 {
+	if len(droppedPartitions) > 0 {
 		logrus.WithFields(logrus.Fields{
-			"deleted_count":  result.RowsAffected,
+			"partitions":     droppedPartitions,
+			"cutoff_time":    cutoffTime.Format(time.RFC3339),
+			"retention_days": retentionDays,
+		}).Info("Dropped expired request log partitions")
+	}
+
+	if deletedCount > 0 {
+		logrus.WithFields(logrus.Fields{
+			"deleted_count":  deletedCount,
 			"cutoff_time":    cutoffTime.Format(time.RFC3339),
 			"retention_days": retentionDays,
 		}).Info("Successfully cleaned up expired request logs")
-	} else {
+	} else if len(droppedPartitions) == 0 {
 		logrus.Debug("No expired request logs found to cleanup")
 	}
 }
@@ -1,13 +1,17 @@
 package services
 
 import (
+	"encoding/base64"
 	"encoding/csv"
+	"errors"
 	"fmt"
-	"gpt-load/internal/models"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
+	"gpt-load/internal/models"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -19,14 +23,25 @@ type ExportableLogKey struct {
 	StatusCode int    `gorm:"column:status_code"`
 }
 
+// ErrInvalidLogCursor is returned for a pagination cursor that was not issued by GetLogsAfter.
+var ErrInvalidLogCursor = errors.New("invalid cursor")
+
+// LogCursorPage is a page of request logs read with cursor pagination.
+type LogCursorPage struct {
+	Items []models.RequestLog `json:"items"`
+	// 下一页的游标，为空时表示没有更多日志
+	NextCursor string `json:"next_cursor"`
+}
+
 // LogService provides services related to request logs.
 type LogService struct {
-	DB *gorm.DB
+	DB         *gorm.DB
+	partitions *RequestLogPartitionService
 }
 
 // NewLogService creates a new LogService.
-func NewLogService(db *gorm.DB) *LogService {
-	return &LogService{DB: db}
+func NewLogService(db *gorm.DB, partitions *RequestLogPartitionService) *LogService {
+	return &LogService{DB: db, partitions: partitions}
 }
 
 // logFiltersScope returns a GORM scope function that applies filters from the Gin context.
@@ -36,7 +51,12 @@ func logFiltersScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
 			db = db.Where("group_name LIKE ?", "%"+groupName+"%")
 		}
 		if keyValue := c.Query("key_value"); keyValue != "" {
-			db = db.Where("key_value LIKE ?", "%"+keyValue+"%")
+			if models.KeyEncryptionEnabled() {
+				// 与密钥列表一致，加密后的密钥仅能按完整密钥查找
+				db = db.Where("key_value LIKE ? OR key_value IN ?", "%"+keyValue+"%", models.KeyValueLookups([]string{keyValue}))
+			} else {
+				db = db.Where("key_value LIKE ?", "%"+keyValue+"%")
+			}
 		}
 		if model := c.Query("model"); model != "" {
 			db = db.Where("model LIKE ?", "%"+model+"%")
@@ -57,26 +77,147 @@ func logFiltersScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
 		if sourceIP := c.Query("source_ip"); sourceIP != "" {
 			db = db.Where("source_ip = ?", sourceIP)
 		}
+		if upstreamRequestID := c.Query("upstream_request_id"); upstreamRequestID != "" {
+			db = db.Where("upstream_request_id = ?", upstreamRequestID)
+		}
+		if clientKey := c.Query("client_key"); clientKey != "" {
+			db = db.Where("client_key = ?", clientKey)
+		}
+		if keyHash := c.Query("key_hash"); keyHash != "" {
+			db = db.Where("key_hash = ?", keyHash)
+		}
+		if bodyHash := c.Query("request_body_hash"); bodyHash != "" {
+			db = db.Where("request_body_hash = ?", bodyHash)
+		}
 		if errorContains := c.Query("error_contains"); errorContains != "" {
 			db = db.Where("error_message LIKE ?", "%"+errorContains+"%")
 		}
-		if startTimeStr := c.Query("start_time"); startTimeStr != "" {
-			if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
-				db = db.Where("timestamp >= ?", startTime)
-			}
+		startTime, endTime := logTimeRange(c)
+		if !startTime.IsZero() {
+			db = db.Where("timestamp >= ?", startTime)
 		}
-		if endTimeStr := c.Query("end_time"); endTimeStr != "" {
-			if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
-				db = db.Where("timestamp <= ?", endTime)
-			}
+		if !endTime.IsZero() {
+			db = db.Where("timestamp <= ?", endTime)
 		}
 		return db
 	}
 }
 
+// logTimeRange returns the start_time and end_time filters, zero when absent or invalid.
+func logTimeRange(c *gin.Context) (startTime, endTime time.Time) {
+	if startTimeStr := c.Query("start_time"); startTimeStr != "" {
+		startTime, _ = time.Parse(time.RFC3339, startTimeStr)
+	}
+	if endTimeStr := c.Query("end_time"); endTimeStr != "" {
+		endTime, _ = time.Parse(time.RFC3339, endTimeStr)
+	}
+	return startTime, endTime
+}
+
+// LogsBetween returns a query over the request logs between start and end, reading only
+// the partitions covering that range when request log partitioning is enabled.
+func (s *LogService) LogsBetween(start, end time.Time) *gorm.DB {
+	return s.partitions.Query(start, end)
+}
+
 // GetLogsQuery returns a GORM query for fetching logs with filters.
 func (s *LogService) GetLogsQuery(c *gin.Context) *gorm.DB {
-	return s.DB.Model(&models.RequestLog{}).Scopes(logFiltersScope(c))
+	return s.LogsBetween(logTimeRange(c)).Scopes(logFiltersScope(c))
+}
+
+// GetLogsAfter returns up to limit filtered logs, newest first, starting after the log the cursor
+// points to, or from the newest log when the cursor is empty. Unlike page numbers, a cursor stays
+// stable while new logs are being written.
+func (s *LogService) GetLogsAfter(c *gin.Context, cursor string, limit int) (*LogCursorPage, error) {
+	query := s.GetLogsQuery(c)
+	if cursor != "" {
+		timestamp, id, err := decodeLogCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("timestamp < ? OR (timestamp = ? AND id < ?)", timestamp, timestamp, id)
+	}
+
+	var logs []models.RequestLog
+	if err := query.Order("timestamp desc, id desc").Limit(limit + 1).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+
+	page := &LogCursorPage{Items: logs}
+	if len(logs) > limit {
+		page.Items = logs[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeLogCursor(last.Timestamp, last.ID)
+	}
+	return page, nil
+}
+
+// ReEncryptLogKeys rewrites the key values stored in request logs with the current
+// DB_ENCRYPTION_KEY, like KeyService.ReEncryptKeys does for api_keys, and returns the number
+// of logs updated. Each distinct stored value is updated with a single statement.
+func (s *LogService) ReEncryptLogKeys() (int64, error) {
+	if !models.KeyEncryptionEnabled() {
+		return 0, fmt.Errorf("DB_ENCRYPTION_KEY is not configured")
+	}
+
+	tables, err := s.partitions.Tables()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list request log tables: %w", err)
+	}
+
+	var updated int64
+	for _, table := range tables {
+		var storedValues []string
+		if err := s.DB.Table(table).Distinct("key_value").Where("key_value <> ''").Pluck("key_value", &storedValues).Error; err != nil {
+			return updated, fmt.Errorf("failed to read key values from %s: %w", table, err)
+		}
+		for _, storedValue := range storedValues {
+			plaintext, err := models.DecryptKeyValue(storedValue)
+			if err != nil {
+				return updated, fmt.Errorf("failed to decrypt a key value in %s: %w", table, err)
+			}
+			encrypted := models.EncryptKeyValue(plaintext)
+			if encrypted == storedValue {
+				continue
+			}
+			result := s.DB.Table(table).Where("key_value = ?", storedValue).UpdateColumn("key_value", encrypted)
+			if result.Error != nil {
+				return updated, fmt.Errorf("failed to update key values in %s: %w", table, result.Error)
+			}
+			updated += result.RowsAffected
+		}
+	}
+	return updated, nil
+}
+
+// encodeLogCursor 游标由最后一条日志的时间和 ID 组成，时间保留原时区，与数据库中存储的格式一致
+func encodeLogCursor(timestamp time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(timestamp.Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeLogCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidLogCursor
+	}
+	timestampStr, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidLogCursor
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampStr)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidLogCursor
+	}
+	return timestamp, id, nil
+}
+
+// GetLog returns the request log with the given ID.
+func (s *LogService) GetLog(id string) (*models.RequestLog, error) {
+	var log models.RequestLog
+	if err := s.LogsBetween(time.Time{}, time.Time{}).Where("id = ?", id).First(&log).Error; err != nil {
+		return nil, err
+	}
+	return &log, nil
 }
 
 // StreamLogKeysToCSV fetches unique keys from logs based on filters and streams them as a CSV.
@@ -93,7 +234,7 @@ func (s *LogService) StreamLogKeysToCSV(c *gin.Context, writer io.Writer) error
 
 	var results []ExportableLogKey
 
-	baseQuery := s.DB.Model(&models.RequestLog{}).Scopes(logFiltersScope(c))
+	baseQuery := s.GetLogsQuery(c)
 
 	// 使用窗口函数获取每个key_value的最新记录
 	err := s.DB.Raw(`
@@ -117,10 +258,20 @@ func (s *LogService) StreamLogKeysToCSV(c *gin.Context, writer io.Writer) error
 		return fmt.Errorf("failed to fetch log keys: %w", err)
 	}
 
-	// 写入CSV数据
+	// 写入CSV数据。同一密钥的明文和加密形式在重新加密前分属不同分组，解密后只保留一条
+	written := make(map[string]struct{}, len(results))
 	for _, record := range results {
+		keyValue, err := models.DecryptKeyValue(record.KeyValue)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt log key: %w", err)
+		}
+		if _, ok := written[keyValue]; ok {
+			continue
+		}
+		written[keyValue] = struct{}{}
+
 		csvRecord := []string{
-			record.KeyValue,
+			keyValue,
 			record.GroupName,
 			strconv.Itoa(record.StatusCode),
 		}
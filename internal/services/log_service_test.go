@@ -0,0 +1,235 @@
+package services
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	testEncryptionKey    = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testOldEncryptionKey = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+)
+
+func newTestLogService(t *testing.T) *LogService {
+	t.Helper()
+	db := newTestDB(t, &models.RequestLog{})
+	partitions := &RequestLogPartitionService{db: db, dialect: db.Dialector.Name(), known: make(map[string]struct{})}
+	return NewLogService(db, partitions)
+}
+
+func setTestKeyCiphers(t *testing.T, current, old string) (*encryption.Cipher, *encryption.Cipher) {
+	t.Helper()
+	var currentCipher, oldCipher *encryption.Cipher
+	var err error
+	if current != "" {
+		if currentCipher, err = encryption.NewCipher(current); err != nil {
+			t.Fatalf("new cipher: %v", err)
+		}
+	}
+	if old != "" {
+		if oldCipher, err = encryption.NewCipher(old); err != nil {
+			t.Fatalf("new old cipher: %v", err)
+		}
+	}
+	models.SetKeyCiphers(currentCipher, oldCipher)
+	t.Cleanup(func() { models.SetKeyCiphers(nil, nil) })
+	return currentCipher, oldCipher
+}
+
+// storedKeyValues 绕过模型钩子读取数据库中 key_value 的存储形式
+func storedKeyValues(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+	var rows []struct {
+		ID       string
+		KeyValue string
+	}
+	if err := db.Table(requestLogTable).Select("id, key_value").Scan(&rows).Error; err != nil {
+		t.Fatalf("read stored key values: %v", err)
+	}
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		values[row.ID] = row.KeyValue
+	}
+	return values
+}
+
+func TestRequestLogKeyValueIsEncryptedAtRest(t *testing.T) {
+	tests := []struct {
+		name          string
+		encryptionKey string
+		wantEncrypted bool
+	}{
+		{name: "encryption disabled", encryptionKey: "", wantEncrypted: false},
+		{name: "encryption enabled", encryptionKey: testEncryptionKey, wantEncrypted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestLogService(t)
+			setTestKeyCiphers(t, tt.encryptionKey, "")
+
+			const key = "sk-plaintext-upstream-key"
+			log := &models.RequestLog{ID: "log-1", Timestamp: time.Now(), KeyValue: key}
+			if err := s.partitions.Insert(s.DB, []*models.RequestLog{log}); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+			if log.KeyValue != key {
+				t.Errorf("KeyValue after insert = %q, want the plaintext key restored", log.KeyValue)
+			}
+
+			stored := storedKeyValues(t, s.DB)["log-1"]
+			if got := encryption.IsEncrypted(stored); got != tt.wantEncrypted {
+				t.Errorf("stored value %q encrypted = %v, want %v", stored, got, tt.wantEncrypted)
+			}
+
+			found, err := s.GetLog("log-1")
+			if err != nil {
+				t.Fatalf("get log: %v", err)
+			}
+			if found.KeyValue != key {
+				t.Errorf("KeyValue read back = %q, want %q", found.KeyValue, key)
+			}
+		})
+	}
+}
+
+func TestLogFiltersMatchEncryptedKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestLogService(t)
+	setTestKeyCiphers(t, testEncryptionKey, "")
+
+	logs := []*models.RequestLog{
+		{ID: "log-1", Timestamp: time.Now(), KeyValue: "sk-first-upstream-key"},
+		{ID: "log-2", Timestamp: time.Now(), KeyValue: "sk-second-upstream-key"},
+	}
+	if err := s.partitions.Insert(s.DB, logs); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		filter  string
+		wantIDs []string
+	}{
+		{name: "full key", filter: "sk-first-upstream-key", wantIDs: []string{"log-1"}},
+		{name: "partial key does not match ciphertext", filter: "first", wantIDs: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/logs?key_value="+url.QueryEscape(tt.filter), nil)
+
+			var found []models.RequestLog
+			if err := s.GetLogsQuery(c).Order("id").Find(&found).Error; err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			var ids []string
+			for _, log := range found {
+				ids = append(ids, log.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("matched logs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestReEncryptLogKeys(t *testing.T) {
+	s := newTestLogService(t)
+	current, old := setTestKeyCiphers(t, testEncryptionKey, testOldEncryptionKey)
+
+	const key = "sk-re-encrypted-upstream-key"
+	tests := []struct {
+		id          string
+		storedValue string
+	}{
+		{id: "plaintext", storedValue: key},
+		{id: "old-key", storedValue: old.Encrypt(key)},
+		{id: "current-key", storedValue: current.Encrypt(key)},
+		{id: "no-key", storedValue: ""},
+	}
+	raw := s.DB.Session(&gorm.Session{SkipHooks: true})
+	for _, tt := range tests {
+		log := &models.RequestLog{ID: tt.id, Timestamp: time.Now(), KeyValue: tt.storedValue}
+		if err := raw.Create(log).Error; err != nil {
+			t.Fatalf("create %s: %v", tt.id, err)
+		}
+	}
+
+	updated, err := s.ReEncryptLogKeys()
+	if err != nil {
+		t.Fatalf("re-encrypt: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("updated = %d, want 2", updated)
+	}
+
+	stored := storedKeyValues(t, s.DB)
+	for _, tt := range tests {
+		want := current.Encrypt(key)
+		if tt.storedValue == "" {
+			want = ""
+		}
+		if stored[tt.id] != want {
+			t.Errorf("%s: stored value = %q, want %q", tt.id, stored[tt.id], want)
+		}
+	}
+
+	// 再次执行没有需要更新的日志
+	if updated, err := s.ReEncryptLogKeys(); err != nil || updated != 0 {
+		t.Errorf("second run = (%d, %v), want (0, nil)", updated, err)
+	}
+}
+
+func TestLogFiltersUpstreamRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestLogService(t)
+
+	logs := []*models.RequestLog{
+		{ID: "log-1", Timestamp: time.Now(), UpstreamRequestID: "req_1"},
+		{ID: "log-2", Timestamp: time.Now(), UpstreamRequestID: "req_12"},
+		{ID: "log-3", Timestamp: time.Now()},
+	}
+	if err := s.partitions.Insert(s.DB, logs); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []string
+	}{
+		{name: "exact match", query: "upstream_request_id=req_1", wantIDs: []string{"log-1"}},
+		{name: "no match", query: "upstream_request_id=req_9", wantIDs: nil},
+		{name: "no filter", query: "", wantIDs: []string{"log-1", "log-2", "log-3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/logs?"+tt.query, nil)
+
+			var found []models.RequestLog
+			if err := s.GetLogsQuery(c).Order("id").Find(&found).Error; err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			var ids []string
+			for _, log := range found {
+				ids = append(ids, log.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("matched logs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/notify"
+	"gpt-load/internal/objectstore"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	payloadMigrationInterval  = 10 * time.Minute
+	payloadMigrationBatchSize = 100
+	payloadUploadTimeout      = 30 * time.Second
+	payloadContentType        = "application/json"
+)
+
+// PayloadOffloadEvent is the alert sent when writing payloads to object storage starts failing or recovers.
+type PayloadOffloadEvent struct {
+	Event     string    `json:"event"`
+	Bucket    string    `json:"bucket"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PayloadOffloadService stores large or old request log bodies in S3-compatible object storage
+// instead of the database. Bodies that cannot be uploaded stay in the database, so a storage
+// outage degrades to local storage instead of dropping payloads.
+type PayloadOffloadService struct {
+	configManager types.ConfigManager
+	partitions    *RequestLogPartitionService
+	notifier      *notify.Notifier
+	clock         clock.Clock
+	metrics       *metrics.Metrics
+	client        *objectstore.Client
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+
+	mu      sync.Mutex
+	failing bool
+}
+
+// NewPayloadOffloadService creates a new PayloadOffloadService. Offload is disabled unless
+// PAYLOAD_OFFLOAD_ENDPOINT and PAYLOAD_OFFLOAD_BUCKET are set.
+func NewPayloadOffloadService(
+	configManager types.ConfigManager,
+	partitions *RequestLogPartitionService,
+	notifier *notify.Notifier,
+	clk clock.Clock,
+	appMetrics *metrics.Metrics,
+) (*PayloadOffloadService, error) {
+	s := &PayloadOffloadService{
+		configManager: configManager,
+		partitions:    partitions,
+		notifier:      notifier,
+		clock:         clk,
+		metrics:       appMetrics,
+		stopChan:      make(chan struct{}),
+	}
+
+	cfg := configManager.GetPayloadOffloadConfig()
+	if cfg.Endpoint == "" {
+		return s, nil
+	}
+	client, err := objectstore.NewClient(objectstore.Config{
+		Endpoint:        cfg.Endpoint,
+		Bucket:          cfg.Bucket,
+		Region:          cfg.Region,
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		PathStyle:       cfg.PathStyle,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payload offload client: %w", err)
+	}
+	s.client = client
+	return s, nil
+}
+
+// Enabled reports whether payloads are offloaded to object storage.
+func (s *PayloadOffloadService) Enabled() bool {
+	return s.client != nil
+}
+
+// Start starts migrating existing payloads to object storage. Master only.
+func (s *PayloadOffloadService) Start() {
+	if !s.Enabled() {
+		return
+	}
+	s.wg.Add(1)
+	go s.runMigration()
+	logrus.Info("Payload offload migration started.")
+}
+
+// Stop stops the migration. It resumes from the remaining rows after the next start.
+func (s *PayloadOffloadService) Stop(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+	close(s.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("PayloadOffloadService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("PayloadOffloadService stop timed out.")
+	}
+}
+
+// Offload uploads the bodies of logs that are about to be written and that reach the size
+// threshold, replacing them with a reference. After the first failed upload the remaining
+// bodies of the batch are kept in the database without trying.
+func (s *PayloadOffloadService) Offload(logs []*models.RequestLog) {
+	if !s.Enabled() {
+		return
+	}
+	minBytes := s.configManager.GetPayloadOffloadConfig().MinBytes
+	for _, log := range logs {
+		if log.RequestBody == "" || log.PayloadRef != "" || len(log.RequestBody) < minBytes {
+			continue
+		}
+		key, err := s.upload(log)
+		if err != nil {
+			s.metrics.PayloadOffloads.WithLabelValues("flush", "error").Inc()
+			s.setFailing(err)
+			return
+		}
+		s.metrics.PayloadOffloads.WithLabelValues("flush", "success").Inc()
+		s.setFailing(nil)
+		log.PayloadRef = key
+		log.RequestBody = ""
+	}
+}
+
+// Fetch returns the body of the log, reading it from object storage if it was offloaded.
+func (s *PayloadOffloadService) Fetch(ctx context.Context, log *models.RequestLog) (string, error) {
+	if log.PayloadRef == "" {
+		return log.RequestBody, nil
+	}
+	if !s.Enabled() {
+		return "", fmt.Errorf("payload %s is in object storage but payload offload is not configured", log.PayloadRef)
+	}
+	data, err := s.client.Get(ctx, log.PayloadRef)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SignedURL returns a presigned download URL of an offloaded body.
+func (s *PayloadOffloadService) SignedURL(log *models.RequestLog) (string, error) {
+	ttl := s.configManager.GetPayloadOffloadConfig().SignedURLTTLSeconds
+	switch {
+	case !s.Enabled():
+		return "", fmt.Errorf("payload offload is not configured")
+	case ttl == 0:
+		return "", fmt.Errorf("signed URLs are disabled, set PAYLOAD_OFFLOAD_SIGNED_URL_TTL_SECONDS")
+	case log.PayloadRef == "":
+		return "", fmt.Errorf("the payload of this log is stored in the database")
+	}
+	return s.client.PresignGet(log.PayloadRef, time.Duration(ttl)*time.Second), nil
+}
+
+// upload writes the body of the log to object storage and returns its key.
+func (s *PayloadOffloadService) upload(log *models.RequestLog) (string, error) {
+	cfg := s.configManager.GetPayloadOffloadConfig()
+	key := fmt.Sprintf("%s%s/%s", cfg.Prefix, log.Timestamp.UTC().Format("2006/01/02"), log.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), payloadUploadTimeout)
+	defer cancel()
+	if err := s.client.Put(ctx, key, []byte(log.RequestBody), payloadContentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// setFailing records the outcome of an upload, alerting when uploads start failing and when they recover.
+func (s *PayloadOffloadService) setFailing(err error) {
+	s.mu.Lock()
+	changed := s.failing != (err != nil)
+	s.failing = err != nil
+	s.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	cfg := s.configManager.GetPayloadOffloadConfig()
+	event := PayloadOffloadEvent{Event: "payload_offload_recovered", Bucket: cfg.Bucket, Timestamp: s.clock.Now()}
+	notification := notify.Event{
+		Type:      event.Event,
+		Severity:  notify.SeverityInfo,
+		Summary:   fmt.Sprintf("Request payloads are written to bucket %s again.", cfg.Bucket),
+		Timestamp: event.Timestamp,
+	}
+	if err != nil {
+		event.Event = "payload_offload_failing"
+		event.Error = err.Error()
+		notification.Type = event.Event
+		notification.Severity = notify.SeverityWarning
+		notification.Summary = fmt.Sprintf(":warning: Writing request payloads to bucket %s failed, keeping them in the database: %v", cfg.Bucket, err)
+		logrus.WithError(err).Error("Payload offload failed, keeping request payloads in the database")
+	} else {
+		logrus.Info("Payload offload recovered")
+	}
+	notification.Payload = event
+	s.notifier.Notify(notify.ChannelPayloadOffload, notification)
+}
+
+func (s *PayloadOffloadService) runMigration() {
+	defer s.wg.Done()
+
+	s.migrate()
+
+	ticker := s.clock.NewTicker(payloadMigrationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.migrate()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// migrate moves bodies that reach the size threshold or the age limit from the database to
+// object storage, at most MigrationRatePerSecond per second. Each log is updated as soon as its
+// body is uploaded, so the job resumes where it stopped. It gives up until the next run on the
+// first failed upload.
+func (s *PayloadOffloadService) migrate() {
+	cfg := s.configManager.GetPayloadOffloadConfig()
+	interval := time.Second / time.Duration(cfg.MigrationRatePerSecond)
+
+	migrated := 0
+	defer func() {
+		if migrated > 0 {
+			logrus.Infof("Moved %d request payloads to object storage.", migrated)
+		}
+	}()
+
+	for {
+		query := s.partitions.Query(time.Time{}, time.Time{}).
+			Where("payload_ref = '' OR payload_ref IS NULL").
+			Where("request_body <> ''")
+		if cfg.AfterDays > 0 {
+			query = query.Where("LENGTH(request_body) >= ? OR timestamp < ?", cfg.MinBytes, s.clock.Now().AddDate(0, 0, -cfg.AfterDays))
+		} else {
+			query = query.Where("LENGTH(request_body) >= ?", cfg.MinBytes)
+		}
+
+		var logs []*models.RequestLog
+		if err := query.Order("timestamp ASC").Limit(payloadMigrationBatchSize).Find(&logs).Error; err != nil {
+			logrus.WithError(err).Error("Failed to query request payloads to migrate")
+			return
+		}
+		if len(logs) == 0 {
+			return
+		}
+
+		for _, log := range logs {
+			select {
+			case <-s.stopChan:
+				return
+			case <-s.clock.After(interval):
+			}
+
+			key, err := s.upload(log)
+			if err != nil {
+				s.metrics.PayloadOffloads.WithLabelValues("migration", "error").Inc()
+				s.setFailing(err)
+				return
+			}
+			s.metrics.PayloadOffloads.WithLabelValues("migration", "success").Inc()
+			s.setFailing(nil)
+
+			if err := s.partitions.Update(log, map[string]any{"payload_ref": key, "request_body": ""}); err != nil {
+				logrus.WithError(err).Errorf("Failed to record the offloaded payload of request log %s", log.ID)
+				return
+			}
+			migrated++
+		}
+	}
+}
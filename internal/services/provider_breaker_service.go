@@ -0,0 +1,155 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// gptload_provider_breaker_state values, the same as gptload_key_circuit_state.
+const (
+	providerBreakerClosed   = 0
+	providerBreakerHalfOpen = 1
+	providerBreakerOpen     = 2
+)
+
+type providerBreakerState struct {
+	windowStart time.Time
+	requests    int
+	failures    int
+	// 熔断开始时间，为零值时处于闭合状态
+	openedAt time.Time
+	// 探测请求放行的时间，为零值时尚未放行
+	probeStartedAt time.Time
+}
+
+// ProviderBreakerService is a circuit breaker per channel type. It counts upstream failures
+// (network errors and 5xx) across all groups of the channel type and opens when the error
+// rate in the window reaches the threshold, so that a provider that is down is not hammered
+// by every group and every retry. While open, requests fail fast; after the open period one
+// request is let through as the probe, and its outcome closes or reopens the circuit.
+// The state is kept per instance.
+type ProviderBreakerService struct {
+	configManager types.ConfigManager
+	clock         clock.Clock
+	metrics       *metrics.Metrics
+
+	mu     sync.Mutex
+	states map[string]*providerBreakerState
+}
+
+// NewProviderBreakerService creates a new ProviderBreakerService.
+func NewProviderBreakerService(configManager types.ConfigManager, clk clock.Clock, appMetrics *metrics.Metrics) *ProviderBreakerService {
+	return &ProviderBreakerService{
+		configManager: configManager,
+		clock:         clk,
+		metrics:       appMetrics,
+		states:        make(map[string]*providerBreakerState),
+	}
+}
+
+// Allow reports whether a request of the channel type may be sent upstream. It is false
+// while the circuit is open, except for the single probe once the open period has passed.
+func (s *ProviderBreakerService) Allow(channelType string) bool {
+	cfg := s.configManager.GetProxyConfig()
+	if cfg.ProviderBreakerErrorPercent <= 0 {
+		return true
+	}
+
+	now := s.clock.Now()
+	openPeriod := time.Duration(cfg.ProviderBreakerOpenSeconds) * time.Second
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[channelType]
+	if !ok || state.openedAt.IsZero() {
+		return true
+	}
+	if now.Sub(state.openedAt) < openPeriod {
+		s.metrics.ProviderBreakerRejected.WithLabelValues(channelType).Inc()
+		return false
+	}
+	// 探测请求没有返回结果（如无可用密钥）时，过一个熔断时长后再放行下一个
+	if state.probeStartedAt.IsZero() || now.Sub(state.probeStartedAt) >= openPeriod {
+		state.probeStartedAt = now
+		s.metrics.ProviderBreakerState.WithLabelValues(channelType).Set(providerBreakerHalfOpen)
+		logrus.WithField("channel_type", channelType).Info("Provider circuit breaker half-open, sending a probe request upstream")
+		return true
+	}
+	s.metrics.ProviderBreakerRejected.WithLabelValues(channelType).Inc()
+	return false
+}
+
+// IsOpen reports whether the circuit of the channel type is open or probing, in which case
+// a failed request is not retried.
+func (s *ProviderBreakerService) IsOpen(channelType string) bool {
+	if s.configManager.GetProxyConfig().ProviderBreakerErrorPercent <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[channelType]
+	return ok && !state.openedAt.IsZero()
+}
+
+// Record records the outcome of an upstream request of the channel type. success is false
+// only for failures of the upstream itself, not for errors caused by the key or the request.
+func (s *ProviderBreakerService) Record(channelType string, success bool) {
+	cfg := s.configManager.GetProxyConfig()
+	if cfg.ProviderBreakerErrorPercent <= 0 {
+		return
+	}
+
+	now := s.clock.Now()
+	log := logrus.WithField("channel_type", channelType)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[channelType]
+	if !ok {
+		state = &providerBreakerState{windowStart: now}
+		s.states[channelType] = state
+	}
+
+	if !state.openedAt.IsZero() {
+		// 熔断期间只有探测请求的结果决定是否恢复，熔断前发出的请求的结果不计入
+		if state.probeStartedAt.IsZero() {
+			return
+		}
+		if success {
+			log.Info("Provider circuit breaker probe succeeded, closing the circuit")
+			*state = providerBreakerState{windowStart: now}
+			s.metrics.ProviderBreakerState.WithLabelValues(channelType).Set(providerBreakerClosed)
+		} else {
+			log.Warn("Provider circuit breaker probe failed, keeping the circuit open")
+			state.openedAt = now
+			state.probeStartedAt = time.Time{}
+			s.metrics.ProviderBreakerState.WithLabelValues(channelType).Set(providerBreakerOpen)
+		}
+		return
+	}
+
+	if now.Sub(state.windowStart) >= time.Duration(cfg.ProviderBreakerWindowSeconds)*time.Second {
+		state.windowStart = now
+		state.requests = 0
+		state.failures = 0
+	}
+	state.requests++
+	if !success {
+		state.failures++
+	}
+
+	if state.requests >= cfg.ProviderBreakerMinRequests && state.failures*100 >= cfg.ProviderBreakerErrorPercent*state.requests {
+		log.WithFields(logrus.Fields{"requests": state.requests, "failures": state.failures}).
+			Errorf("Upstream error rate of the provider reached %d%%, opening the circuit for %ds", cfg.ProviderBreakerErrorPercent, cfg.ProviderBreakerOpenSeconds)
+		state.openedAt = now
+		state.probeStartedAt = time.Time{}
+		s.metrics.ProviderBreakerState.WithLabelValues(channelType).Set(providerBreakerOpen)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestProviderBreaker() (*ProviderBreakerService, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cfg := &stubConfigManager{proxy: types.ProxyConfig{
+		ProviderBreakerErrorPercent:  50,
+		ProviderBreakerMinRequests:   4,
+		ProviderBreakerWindowSeconds: 60,
+		ProviderBreakerOpenSeconds:   30,
+	}}
+	return NewProviderBreakerService(cfg, fake, metrics.NewMetrics(prometheus.NewRegistry())), fake
+}
+
+func TestProviderBreakerOpensAtErrorRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []bool
+		wantOpen bool
+	}{
+		{name: "below min requests", outcomes: []bool{false, false, false}, wantOpen: false},
+		{name: "error rate below threshold", outcomes: []bool{true, true, true, false}, wantOpen: false},
+		{name: "error rate at threshold", outcomes: []bool{true, true, false, false}, wantOpen: true},
+		{name: "all failures", outcomes: []bool{false, false, false, false}, wantOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestProviderBreaker()
+			for _, success := range tt.outcomes {
+				s.Record("openai", success)
+			}
+			if got := s.IsOpen("openai"); got != tt.wantOpen {
+				t.Errorf("IsOpen = %v, want %v", got, tt.wantOpen)
+			}
+			if got := s.Allow("openai"); got == tt.wantOpen {
+				t.Errorf("Allow = %v, want %v", got, !tt.wantOpen)
+			}
+			if !s.Allow("anthropic") {
+				t.Error("another channel type is rejected")
+			}
+		})
+	}
+}
+
+func TestProviderBreakerWindowResets(t *testing.T) {
+	s, fake := newTestProviderBreaker()
+	s.Record("openai", false)
+	s.Record("openai", false)
+	s.Record("openai", false)
+
+	// 窗口结束后重新计数，之前的失败不再计入
+	fake.Advance(60 * time.Second)
+	s.Record("openai", false)
+	s.Record("openai", true)
+	s.Record("openai", true)
+	s.Record("openai", true)
+	if s.IsOpen("openai") {
+		t.Error("circuit opened from failures of the previous window")
+	}
+}
+
+func TestProviderBreakerCooldown(t *testing.T) {
+	tests := []struct {
+		name         string
+		probeSuccess bool
+		wantClosed   bool
+	}{
+		{name: "successful probe closes the circuit", probeSuccess: true, wantClosed: true},
+		{name: "failed probe reopens the circuit", probeSuccess: false, wantClosed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := newTestProviderBreaker()
+			for i := 0; i < 4; i++ {
+				s.Record("openai", false)
+			}
+			if !s.IsOpen("openai") {
+				t.Fatal("circuit did not open")
+			}
+
+			// 熔断期间快速失败
+			fake.Advance(29 * time.Second)
+			if s.Allow("openai") {
+				t.Fatal("request allowed during the open period")
+			}
+
+			// 熔断时长结束后只放行一个探测请求
+			fake.Advance(time.Second)
+			if !s.Allow("openai") {
+				t.Fatal("probe not allowed after the open period")
+			}
+			if s.Allow("openai") {
+				t.Fatal("second request allowed while probing")
+			}
+
+			s.Record("openai", tt.probeSuccess)
+			if got := s.IsOpen("openai"); got == tt.wantClosed {
+				t.Errorf("IsOpen after probe = %v, want %v", got, !tt.wantClosed)
+			}
+			if got := s.Allow("openai"); got != tt.wantClosed {
+				t.Errorf("Allow after probe = %v, want %v", got, tt.wantClosed)
+			}
+			if !tt.wantClosed {
+				// 探测失败后重新开始完整的熔断时长
+				fake.Advance(30 * time.Second)
+				if !s.Allow("openai") {
+					t.Error("probe not allowed after the reopened period")
+				}
+			}
+		})
+	}
+}
+
+func TestProviderBreakerProbeWithoutOutcome(t *testing.T) {
+	s, fake := newTestProviderBreaker()
+	for i := 0; i < 4; i++ {
+		s.Record("openai", false)
+	}
+	fake.Advance(30 * time.Second)
+	if !s.Allow("openai") {
+		t.Fatal("probe not allowed")
+	}
+
+	// 探测请求没有返回结果时，过一个熔断时长再放行下一个
+	fake.Advance(29 * time.Second)
+	if s.Allow("openai") {
+		t.Fatal("next probe allowed too early")
+	}
+	fake.Advance(time.Second)
+	if !s.Allow("openai") {
+		t.Error("next probe not allowed after the open period")
+	}
+}
+
+func TestProviderBreakerDisabled(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewProviderBreakerService(&stubConfigManager{proxy: types.ProxyConfig{
+		ProviderBreakerMinRequests:   1,
+		ProviderBreakerWindowSeconds: 60,
+		ProviderBreakerOpenSeconds:   30,
+	}}, fake, metrics.NewMetrics(prometheus.NewRegistry()))
+	for i := 0; i < 10; i++ {
+		s.Record("openai", false)
+	}
+	if s.IsOpen("openai") || !s.Allow("openai") {
+		t.Error("disabled breaker opened")
+	}
+}
+
+func TestProviderBreakerIgnoresOutcomesWhileOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []bool
+	}{
+		{name: "late successes", outcomes: []bool{true, true, true, true}},
+		{name: "late failures", outcomes: []bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := newTestProviderBreaker()
+			for i := 0; i < 4; i++ {
+				s.Record("openai", false)
+			}
+
+			// 熔断前发出的请求在熔断后才返回，其结果不关闭也不延长熔断
+			for _, success := range tt.outcomes {
+				s.Record("openai", success)
+			}
+			if !s.IsOpen("openai") {
+				t.Fatal("late outcome closed the circuit")
+			}
+			fake.Advance(30 * time.Second)
+			if !s.Allow("openai") {
+				t.Error("late outcome extended the open period")
+			}
+		})
+	}
+}
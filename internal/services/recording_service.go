@@ -0,0 +1,511 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/syncer"
+	"gpt-load/internal/types"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RecordingStateKey           = "recording_state"
+	RecordingStateUpdateChannel = "recording_state:updated"
+	replayLatest                = "latest"
+)
+
+// ErrNoRecording is returned when no recording matches a replayed request.
+var ErrNoRecording = errors.New("no recording matches the request")
+
+var recordingIDPattern = regexp.MustCompile(`^[0-9]+-[0-9a-f]{8}$`)
+
+// sensitiveHeaders 录制时需要脱敏的请求头
+var sensitiveHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "Api-Key"}
+
+// GroupRecordingState is the recording and replay state of a group.
+type GroupRecordingState struct {
+	RecordUntil *time.Time `json:"record_until,omitempty"`
+	ReplayID    string     `json:"replay_id,omitempty"`
+}
+
+// RecordedChunk is one read from the upstream response body and its offset from the response headers.
+type RecordedChunk struct {
+	OffsetMs int64  `json:"offset_ms"`
+	Data     []byte `json:"data"`
+}
+
+// RecordedRequest is the upstream request of a recording, with keys masked.
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
+// RecordedResponse is the upstream response of a recording.
+type RecordedResponse struct {
+	StatusCode int             `json:"status_code"`
+	Headers    http.Header     `json:"headers"`
+	HeaderMs   int64           `json:"header_ms"`
+	Chunks     []RecordedChunk `json:"chunks"`
+}
+
+// Recording is a captured upstream request/response pair.
+type Recording struct {
+	ID          string           `json:"id"`
+	GroupID     uint             `json:"group_id"`
+	GroupName   string           `json:"group_name"`
+	ChannelType string           `json:"channel_type"`
+	RecordedAt  time.Time        `json:"recorded_at"`
+	Request     RecordedRequest  `json:"request"`
+	Response    RecordedResponse `json:"response"`
+}
+
+// RecordingInfo summarizes a recording for listing.
+type RecordingInfo struct {
+	ID         string    `json:"id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code"`
+	Chunks     int       `json:"chunks"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// RecordingService captures upstream interactions of groups in recording mode to disk,
+// and serves them back in place of the upstream for groups in replay mode.
+type RecordingService struct {
+	config types.RecordingConfig
+	store  store.Store
+	syncer *syncer.CacheSyncer[map[uint]GroupRecordingState]
+	mu     sync.Mutex
+}
+
+// NewRecordingService creates a new RecordingService.
+func NewRecordingService(configManager types.ConfigManager, store store.Store) *RecordingService {
+	return &RecordingService{
+		config: configManager.GetRecordingConfig(),
+		store:  store,
+	}
+}
+
+// Start loads the recording state and subscribes to updates from other instances.
+func (s *RecordingService) Start() error {
+	cs, err := syncer.NewCacheSyncer(
+		s.loadStates,
+		s.store,
+		RecordingStateUpdateChannel,
+		logrus.WithField("syncer", "recording_state"),
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create recording state syncer: %w", err)
+	}
+	s.syncer = cs
+	return nil
+}
+
+// loadStates reads the recording state of all groups from the store.
+func (s *RecordingService) loadStates() (map[uint]GroupRecordingState, error) {
+	states := make(map[uint]GroupRecordingState)
+	data, err := s.store.Get(RecordingStateKey)
+	if errors.Is(err, store.ErrNotFound) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recording state: %w", err)
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse recording state: %w", err)
+	}
+	return states, nil
+}
+
+// Stop stops the background syncer.
+func (s *RecordingService) Stop(ctx context.Context) {
+	if s.syncer != nil {
+		s.syncer.Stop()
+	}
+}
+
+// GetState returns the recording state of a group.
+func (s *RecordingService) GetState(groupID uint) GroupRecordingState {
+	if s.syncer == nil {
+		return GroupRecordingState{}
+	}
+	return s.syncer.Get()[groupID]
+}
+
+// IsRecording reports whether upstream interactions of a group are currently recorded.
+func (s *RecordingService) IsRecording(groupID uint) bool {
+	state := s.GetState(groupID)
+	return state.RecordUntil != nil && time.Now().Before(*state.RecordUntil)
+}
+
+// IsReplaying reports whether a group's upstream is replaced by its recordings.
+func (s *RecordingService) IsReplaying(groupID uint) bool {
+	return s.GetState(groupID).ReplayID != ""
+}
+
+// StartRecording enables recording for a group for the given duration, capped by RECORDING_MAX_DURATION_MINUTES.
+func (s *RecordingService) StartRecording(groupID uint, duration time.Duration) (time.Time, error) {
+	if maxDuration := time.Duration(s.config.MaxDurationMinutes) * time.Minute; duration <= 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+	until := time.Now().Add(duration)
+	err := s.updateState(groupID, func(state *GroupRecordingState) {
+		state.RecordUntil = &until
+	})
+	return until, err
+}
+
+// StopRecording disables recording for a group.
+func (s *RecordingService) StopRecording(groupID uint) error {
+	return s.updateState(groupID, func(state *GroupRecordingState) {
+		state.RecordUntil = nil
+	})
+}
+
+// SetReplay enables replay mode for a group. An empty recording ID replays the latest
+// recording matching each request; disabled turns replay mode off.
+func (s *RecordingService) SetReplay(group *models.Group, enabled bool, recordingID string) error {
+	replayID := ""
+	if enabled {
+		replayID = replayLatest
+		if recordingID != "" {
+			if _, err := s.Load(group.ID, recordingID); err != nil {
+				return err
+			}
+			replayID = recordingID
+		}
+	}
+	return s.updateState(group.ID, func(state *GroupRecordingState) {
+		state.ReplayID = replayID
+	})
+}
+
+// updateState applies a change to a group's state and notifies all instances. The state is read
+// from the store rather than the cache, and the local cache is reloaded before returning, so
+// consecutive updates do not overwrite each other and are visible to this instance immediately.
+func (s *RecordingService) updateState(groupID uint, update func(state *GroupRecordingState)) error {
+	if s.syncer == nil {
+		return errors.New("recording service is not started")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states, err := s.loadStates()
+	if err != nil {
+		return err
+	}
+	state := states[groupID]
+	update(&state)
+	if state.RecordUntil == nil && state.ReplayID == "" {
+		delete(states, groupID)
+	} else {
+		states[groupID] = state
+	}
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording state: %w", err)
+	}
+	if err := s.store.Set(RecordingStateKey, data, 0); err != nil {
+		return fmt.Errorf("failed to save recording state: %w", err)
+	}
+	if err := s.syncer.Reload(); err != nil {
+		return err
+	}
+	return s.syncer.Invalidate()
+}
+
+// Capture wraps the response body so the interaction is written to disk once the body is closed.
+func (s *RecordingService) Capture(group *models.Group, req *http.Request, reqBody []byte, resp *http.Response, sentAt time.Time) {
+	now := time.Now()
+	recording := &Recording{
+		ID:          fmt.Sprintf("%d-%s", now.UnixNano(), uuid.NewString()[:8]),
+		GroupID:     group.ID,
+		GroupName:   group.Name,
+		ChannelType: group.ChannelType,
+		RecordedAt:  now,
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     maskURL(req.URL),
+			Headers: maskHeaders(req.Header),
+			Body:    string(reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header.Clone(),
+			HeaderMs:   now.Sub(sentAt).Milliseconds(),
+		},
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		start:      now,
+		recording:  recording,
+		save:       s.save,
+	}
+}
+
+// save writes a recording to the group's directory and enforces the retention cap.
+func (s *RecordingService) save(recording *Recording) {
+	dir := s.groupDir(recording.GroupID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logrus.Errorf("RecordingService: failed to create recording directory %s: %v", dir, err)
+		return
+	}
+
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		logrus.Errorf("RecordingService: failed to marshal recording %s: %v", recording.ID, err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, recording.ID+".json"), data, 0644); err != nil {
+		logrus.Errorf("RecordingService: failed to write recording %s: %v", recording.ID, err)
+		return
+	}
+	logrus.Debugf("RecordingService: recorded %s %s for group %s", recording.Request.Method, recording.Request.URL, recording.GroupName)
+
+	ids := s.recordingIDs(recording.GroupID)
+	for len(ids) > s.config.MaxFilesPerGroup {
+		if err := os.Remove(filepath.Join(dir, ids[0]+".json")); err != nil {
+			logrus.Warnf("RecordingService: failed to remove old recording %s: %v", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+}
+
+// List returns the recordings of a group, newest first.
+func (s *RecordingService) List(groupID uint) ([]RecordingInfo, error) {
+	ids := s.recordingIDs(groupID)
+	infos := make([]RecordingInfo, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		recording, err := s.Load(groupID, ids[i])
+		if err != nil {
+			logrus.Warnf("RecordingService: skipping unreadable recording %s: %v", ids[i], err)
+			continue
+		}
+		infos = append(infos, recording.info())
+	}
+	return infos, nil
+}
+
+// Load reads a single recording of a group.
+func (s *RecordingService) Load(groupID uint, id string) (*Recording, error) {
+	if !recordingIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid recording id: %s", id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.groupDir(groupID), id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording %s: %w", id, err)
+	}
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, fmt.Errorf("failed to parse recording %s: %w", id, err)
+	}
+	return &recording, nil
+}
+
+// Replay serves a recorded response in place of the upstream, reproducing the original
+// chunk boundaries and timing. In "latest" mode the newest recording with the same
+// method and path is used.
+func (s *RecordingService) Replay(group *models.Group, req *http.Request) (*http.Response, error) {
+	replayID := s.GetState(group.ID).ReplayID
+
+	var recording *Recording
+	if replayID != replayLatest {
+		r, err := s.Load(group.ID, replayID)
+		if err != nil {
+			return nil, err
+		}
+		recording = r
+	} else {
+		ids := s.recordingIDs(group.ID)
+		for i := len(ids) - 1; i >= 0 && recording == nil; i-- {
+			r, err := s.Load(group.ID, ids[i])
+			if err != nil {
+				continue
+			}
+			if r.Request.Method == req.Method && recordedPath(r.Request.URL) == req.URL.Path {
+				recording = r
+			}
+		}
+		if recording == nil {
+			return nil, ErrNoRecording
+		}
+	}
+
+	select {
+	case <-time.After(time.Duration(recording.Response.HeaderMs) * time.Millisecond):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", recording.Response.StatusCode, http.StatusText(recording.Response.StatusCode)),
+		StatusCode: recording.Response.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     recording.Response.Headers.Clone(),
+		Body: &replayBody{
+			chunks: recording.Response.Chunks,
+			start:  time.Now(),
+			done:   req.Context().Done(),
+		},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+func (s *RecordingService) groupDir(groupID uint) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("group_%d", groupID))
+}
+
+// recordingIDs lists the recording IDs of a group, oldest first.
+func (s *RecordingService) recordingIDs(groupID uint) []string {
+	entries, err := os.ReadDir(s.groupDir(groupID))
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !entry.IsDir() && ok && recordingIDPattern.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (r *Recording) info() RecordingInfo {
+	return RecordingInfo{
+		ID:         r.ID,
+		Method:     r.Request.Method,
+		Path:       recordedPath(r.Request.URL),
+		StatusCode: r.Response.StatusCode,
+		Chunks:     len(r.Response.Chunks),
+		RecordedAt: r.RecordedAt,
+	}
+}
+
+// recordingBody records every read of the upstream body and saves the recording on close.
+type recordingBody struct {
+	io.ReadCloser
+	start     time.Time
+	recording *Recording
+	save      func(*Recording)
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.recording.Response.Chunks = append(b.recording.Response.Chunks, RecordedChunk{
+			OffsetMs: time.Since(b.start).Milliseconds(),
+			Data:     append([]byte(nil), p[:n]...),
+		})
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.save(b.recording) })
+	return err
+}
+
+// replayBody returns recorded chunks one at a time, waiting until each chunk's original offset.
+type replayBody struct {
+	chunks  []RecordedChunk
+	current []byte
+	start   time.Time
+	done    <-chan struct{}
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	if len(b.current) == 0 {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if wait := time.Until(b.start.Add(time.Duration(chunk.OffsetMs) * time.Millisecond)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-b.done:
+				return 0, io.ErrUnexpectedEOF
+			}
+		}
+		b.current = chunk.Data
+	}
+	n := copy(p, b.current)
+	b.current = b.current[n:]
+	return n, nil
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
+
+// maskHeaders returns a copy of the headers with credentials masked.
+func maskHeaders(headers http.Header) http.Header {
+	masked := headers.Clone()
+	for _, name := range sensitiveHeaders {
+		values := masked.Values(name)
+		for i, value := range values {
+			scheme, token, found := strings.Cut(value, " ")
+			if found {
+				values[i] = scheme + " " + maskSecret(token)
+			} else {
+				values[i] = maskSecret(value)
+			}
+		}
+	}
+	return masked
+}
+
+// maskURL returns the URL with the key query parameter masked.
+func maskURL(u *url.URL) string {
+	masked := *u
+	query := masked.Query()
+	if key := query.Get("key"); key != "" {
+		query.Set("key", maskSecret(key))
+		masked.RawQuery = query.Encode()
+	}
+	return masked.String()
+}
+
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:4] + "****" + secret[len(secret)-4:]
+}
+
+func recordedPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
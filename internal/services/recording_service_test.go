@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+)
+
+func TestRecordingStateUpdatesVisibleImmediately(t *testing.T) {
+	s := NewRecordingService(&stubConfigManager{recording: types.RecordingConfig{MaxDurationMinutes: 10}}, store.NewMemoryStore(clock.NewFake(time.Now())))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	group := &models.Group{ID: 1}
+	// 连续的更新都基于最新状态，且立即对本实例可见
+	if _, err := s.StartRecording(group.ID, time.Minute); err != nil {
+		t.Fatalf("StartRecording() error = %v", err)
+	}
+	if err := s.SetReplay(group, true, ""); err != nil {
+		t.Fatalf("SetReplay() error = %v", err)
+	}
+	if !s.IsRecording(group.ID) || !s.IsReplaying(group.ID) {
+		t.Fatalf("recording = %v, replaying = %v, want both after consecutive updates", s.IsRecording(group.ID), s.IsReplaying(group.ID))
+	}
+
+	if err := s.SetReplay(group, false, ""); err != nil {
+		t.Fatalf("SetReplay() error = %v", err)
+	}
+	if err := s.StopRecording(group.ID); err != nil {
+		t.Fatalf("StopRecording() error = %v", err)
+	}
+	if s.IsRecording(group.ID) || s.IsReplaying(group.ID) {
+		t.Errorf("recording = %v, replaying = %v, want neither after disabling both", s.IsRecording(group.ID), s.IsReplaying(group.ID))
+	}
+}
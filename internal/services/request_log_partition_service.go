@@ -0,0 +1,570 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// requestLogTable 是未分区的原始日志表，启用分区后仅作为结构模板和待回填数据的来源
+	requestLogTable = "request_logs"
+	// requestLogPartitionedTable 是 Postgres 上的声明式分区父表
+	requestLogPartitionedTable = "request_logs_partitioned"
+
+	partitionMaintenanceInterval = time.Hour
+	partitionMonthsAhead         = 1
+	partitionListCacheTTL        = time.Minute
+	partitionBackfillPause       = 200 * time.Millisecond
+	partitionBackfillRetryDelay  = time.Minute
+)
+
+var requestLogPartitionRegex = regexp.MustCompile(`^request_logs_(\d{6})$`)
+
+// RequestLogPartitionService 按月对请求日志分区：Postgres 使用原生声明式分区，
+// MySQL/SQLite 使用按月建表并在查询时按时间范围路由。
+// 主节点负责提前创建分区，并将旧的单表数据在线回填到分区中。
+type RequestLogPartitionService struct {
+	db            *gorm.DB
+	enabled       bool
+	dialect       string
+	batchSize     int
+	columns       []string
+	indexes       []*schema.Index
+	clock         clock.Clock
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+	mu            sync.Mutex
+	known         map[string]struct{}
+	listedAt      time.Time
+	legacyAt      time.Time
+	legacyHasRows bool
+}
+
+// NewRequestLogPartitionService creates a new RequestLogPartitionService.
+func NewRequestLogPartitionService(db *gorm.DB, configManager types.ConfigManager, clk clock.Clock) (*RequestLogPartitionService, error) {
+	dbConfig := configManager.GetDatabaseConfig()
+	s := &RequestLogPartitionService{
+		db:        db,
+		enabled:   dbConfig.PartitionRequestLogs,
+		dialect:   db.Dialector.Name(),
+		batchSize: dbConfig.PartitionBackfillBatchSize,
+		clock:     clk,
+		stopCh:    make(chan struct{}),
+		known:     make(map[string]struct{}),
+	}
+	if !s.enabled {
+		return s, nil
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&models.RequestLog{}); err != nil {
+		return nil, fmt.Errorf("failed to parse request log schema: %w", err)
+	}
+	s.columns = stmt.Schema.DBNames
+	for _, idx := range stmt.Schema.ParseIndexes() {
+		s.indexes = append(s.indexes, idx)
+	}
+	sort.Slice(s.indexes, func(i, j int) bool { return s.indexes[i].Name < s.indexes[j].Name })
+	return s, nil
+}
+
+// Enabled reports whether request logs are partitioned by month.
+func (s *RequestLogPartitionService) Enabled() bool {
+	return s.enabled
+}
+
+// Start creates upcoming partitions and backfills the legacy table. Master only.
+func (s *RequestLogPartitionService) Start() {
+	if !s.enabled {
+		logrus.Debug("Request log partitioning is disabled.")
+		return
+	}
+
+	s.wg.Add(2)
+	go s.runMaintenance()
+	go s.runBackfill()
+	logrus.Infof("Request log partitioning enabled (%s).", s.dialect)
+}
+
+// Stop gracefully stops the partition maintenance and backfill jobs.
+func (s *RequestLogPartitionService) Stop(ctx context.Context) {
+	if !s.enabled {
+		return
+	}
+	close(s.stopCh)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("RequestLogPartitionService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("RequestLogPartitionService stop timed out.")
+	}
+}
+
+func (s *RequestLogPartitionService) runMaintenance() {
+	defer s.wg.Done()
+
+	s.maintainPartitions()
+
+	ticker := s.clock.NewTicker(partitionMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.maintainPartitions()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// maintainPartitions creates the current and upcoming partitions and brings
+// existing partitions up to date with columns added to the request log model.
+func (s *RequestLogPartitionService) maintainPartitions() {
+	month := partitionMonth(s.clock.Now())
+	for i := 0; i <= partitionMonthsAhead; i++ {
+		if err := s.ensurePartition(month.AddDate(0, i, 0)); err != nil {
+			logrus.WithError(err).Error("Failed to create request log partition")
+			return
+		}
+	}
+
+	tables := []string{requestLogPartitionedTable}
+	if s.dialect != "postgres" {
+		var err error
+		if tables, err = s.listPartitions(true); err != nil {
+			logrus.WithError(err).Error("Failed to list request log partitions")
+			return
+		}
+	}
+	for _, table := range tables {
+		if err := s.syncColumns(table); err != nil {
+			logrus.WithError(err).Errorf("Failed to sync columns of %s", table)
+		}
+	}
+}
+
+func (s *RequestLogPartitionService) runBackfill() {
+	defer s.wg.Done()
+
+	for {
+		moved, err := s.backfillBatch()
+		delay := partitionBackfillPause
+		switch {
+		case err != nil:
+			logrus.WithError(err).Error("Request log backfill batch failed, will retry")
+			delay = partitionBackfillRetryDelay
+		case moved == 0:
+			logrus.Info("Request log backfill completed, legacy table is empty.")
+			return
+		default:
+			logrus.Debugf("Backfilled %d request logs into partitions.", moved)
+		}
+
+		select {
+		case <-s.clock.After(delay):
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// backfillBatch moves the oldest batch of rows from the legacy table into partitions.
+func (s *RequestLogPartitionService) backfillBatch() (int, error) {
+	var logs []*models.RequestLog
+	if err := s.db.Table(requestLogTable).Order("timestamp ASC").Limit(s.batchSize).Find(&logs).Error; err != nil {
+		return 0, err
+	}
+	if len(logs) == 0 {
+		s.mu.Lock()
+		s.legacyHasRows = false
+		s.legacyAt = s.clock.Now()
+		s.mu.Unlock()
+		return 0, nil
+	}
+
+	if err := s.EnsurePartitionsFor(logs); err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, len(logs))
+	for i, log := range logs {
+		ids[i] = log.ID
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for table, batch := range s.groupByTable(logs) {
+			if err := tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(batch, len(batch)).Error; err != nil {
+				return fmt.Errorf("failed to copy request logs into %s: %w", table, err)
+			}
+		}
+		return tx.Table(requestLogTable).Where("id IN ?", ids).Delete(&models.RequestLog{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(logs), nil
+}
+
+// EnsurePartitionsFor creates the partitions the given logs will be written to.
+// It must run outside of the insert transaction, as it may execute DDL.
+func (s *RequestLogPartitionService) EnsurePartitionsFor(logs []*models.RequestLog) error {
+	if !s.enabled {
+		return nil
+	}
+	for _, log := range logs {
+		if err := s.ensurePartition(partitionMonth(log.Timestamp)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert writes request logs to their partitions, or to the request log table when partitioning is disabled.
+func (s *RequestLogPartitionService) Insert(tx *gorm.DB, logs []*models.RequestLog) error {
+	if !s.enabled {
+		return tx.CreateInBatches(logs, len(logs)).Error
+	}
+	for table, batch := range s.groupByTable(logs) {
+		if err := tx.Table(table).CreateInBatches(batch, len(batch)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update sets columns of a stored request log, in its partition when partitioning is enabled,
+// or in the legacy table while the log has not been backfilled yet.
+func (s *RequestLogPartitionService) Update(log *models.RequestLog, updates map[string]any) error {
+	if !s.enabled {
+		return s.db.Model(&models.RequestLog{}).Where("id = ?", log.ID).Updates(updates).Error
+	}
+
+	table := requestLogPartitionedTable
+	if s.dialect != "postgres" {
+		table = partitionName(partitionMonth(log.Timestamp))
+	}
+	result := s.db.Table(table).Where("id = ?", log.ID).Updates(updates)
+	if result.Error != nil || result.RowsAffected > 0 || !s.legacyPending() {
+		return result.Error
+	}
+	return s.db.Table(requestLogTable).Where("id = ?", log.ID).Updates(updates).Error
+}
+
+// groupByTable groups logs by the table their inserts go to.
+func (s *RequestLogPartitionService) groupByTable(logs []*models.RequestLog) map[string][]*models.RequestLog {
+	tables := make(map[string][]*models.RequestLog)
+	for _, log := range logs {
+		table := requestLogPartitionedTable
+		if s.dialect != "postgres" {
+			table = partitionName(partitionMonth(log.Timestamp))
+		}
+		tables[table] = append(tables[table], log)
+	}
+	return tables
+}
+
+// Query returns a query over the request logs between start and end (zero means unbounded).
+// With partitioning enabled, only the partitions overlapping the range are read, plus the
+// legacy table while its backfill is still pending.
+func (s *RequestLogPartitionService) Query(start, end time.Time) *gorm.DB {
+	if !s.enabled {
+		return s.db.Model(&models.RequestLog{})
+	}
+
+	var sources []string
+	if s.dialect == "postgres" {
+		// Postgres 根据时间条件自动裁剪分区
+		sources = append(sources, requestLogPartitionedTable)
+	} else {
+		partitions, err := s.listPartitions(false)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to list request log partitions, falling back to the legacy table")
+		}
+		for _, table := range partitions {
+			month, _ := time.Parse("200601", requestLogPartitionRegex.FindStringSubmatch(table)[1])
+			if !start.IsZero() && !month.AddDate(0, 1, 0).After(start) {
+				continue
+			}
+			if !end.IsZero() && month.After(end) {
+				continue
+			}
+			sources = append(sources, table)
+		}
+	}
+	if s.legacyPending() || len(sources) == 0 {
+		sources = append(sources, requestLogTable)
+	}
+
+	if len(sources) == 1 {
+		return s.db.Table(s.quote(sources[0]) + " AS " + requestLogTable)
+	}
+
+	quotedColumns := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		quotedColumns[i] = s.quote(column)
+	}
+	selects := make([]string, len(sources))
+	for i, source := range sources {
+		selects[i] = fmt.Sprintf("SELECT %s FROM %s", strings.Join(quotedColumns, ", "), s.quote(source))
+	}
+	return s.db.Table("(" + strings.Join(selects, " UNION ALL ") + ") AS " + requestLogTable)
+}
+
+// Tables returns every table request logs are stored in: the request log table, and with
+// partitioning enabled the partitions, or the partitioned table on Postgres.
+func (s *RequestLogPartitionService) Tables() ([]string, error) {
+	tables := []string{requestLogTable}
+	if !s.enabled {
+		return tables, nil
+	}
+	if s.dialect == "postgres" {
+		return append(tables, requestLogPartitionedTable), nil
+	}
+	partitions, err := s.listPartitions(true)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(partitions)
+	return append(tables, partitions...), nil
+}
+
+// DeleteBefore removes request logs older than cutoff. Partitions that lie entirely
+// before the cutoff are dropped as a whole; only the boundary partition is deleted row by row.
+func (s *RequestLogPartitionService) DeleteBefore(cutoff time.Time) (int64, []string, error) {
+	if !s.enabled {
+		result := s.db.Where("timestamp < ?", cutoff).Delete(&models.RequestLog{})
+		return result.RowsAffected, nil, result.Error
+	}
+
+	partitions, err := s.listPartitions(true)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var dropped []string
+	var deleted int64
+	for _, table := range partitions {
+		month, _ := time.Parse("200601", requestLogPartitionRegex.FindStringSubmatch(table)[1])
+		switch {
+		case !month.AddDate(0, 1, 0).After(cutoff):
+			if err := s.db.Exec("DROP TABLE IF EXISTS " + s.quote(table)).Error; err != nil {
+				return deleted, dropped, fmt.Errorf("failed to drop partition %s: %w", table, err)
+			}
+			s.forget(table)
+			dropped = append(dropped, table)
+		case month.Before(cutoff):
+			result := s.db.Table(table).Where("timestamp < ?", cutoff).Delete(&models.RequestLog{})
+			if result.Error != nil {
+				return deleted, dropped, result.Error
+			}
+			deleted += result.RowsAffected
+		}
+	}
+
+	if s.legacyPending() {
+		result := s.db.Table(requestLogTable).Where("timestamp < ?", cutoff).Delete(&models.RequestLog{})
+		if result.Error != nil {
+			return deleted, dropped, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	return deleted, dropped, nil
+}
+
+// ensurePartition creates the partition of the given month if it doesn't exist yet.
+func (s *RequestLogPartitionService) ensurePartition(month time.Time) error {
+	name := partitionName(month)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.known[name]; ok {
+		return nil
+	}
+
+	var err error
+	switch s.dialect {
+	case "postgres":
+		err = s.createPostgresPartition(name, month)
+	case "mysql":
+		err = s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", s.quote(name), s.quote(requestLogTable))).Error
+	default:
+		err = s.createSQLitePartition(name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create request log partition %s: %w", name, err)
+	}
+
+	s.known[name] = struct{}{}
+	return nil
+}
+
+// createPostgresPartition creates the partitioned parent table on first use, then the monthly partition.
+func (s *RequestLogPartitionService) createPostgresPartition(name string, month time.Time) error {
+	if !s.db.Migrator().HasTable(requestLogPartitionedTable) {
+		// 分区表的主键必须包含分区键
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (%s)",
+				s.quote(requestLogPartitionedTable), s.quote(requestLogTable), s.quote("timestamp"))).Error; err != nil {
+				return err
+			}
+			return tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s, %s)",
+				s.quote(requestLogPartitionedTable), s.quote("id"), s.quote("timestamp"))).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, idx := range s.indexes {
+		columns := make([]string, len(idx.Fields))
+		for i, field := range idx.Fields {
+			columns[i] = s.quote(field.DBName)
+		}
+		indexName := strings.Replace(idx.Name, requestLogTable, requestLogPartitionedTable, 1)
+		if err := s.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			s.quote(indexName), s.quote(requestLogPartitionedTable), strings.Join(columns, ", "))).Error; err != nil {
+			return err
+		}
+	}
+
+	// DDL 不支持参数绑定，分区边界直接写入语句
+	return s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		s.quote(name), s.quote(requestLogPartitionedTable), month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))).Error
+}
+
+// createSQLitePartition clones the legacy table definition, including its indexes, for a monthly table.
+func (s *RequestLogPartitionService) createSQLitePartition(name string) error {
+	var statements []string
+	if err := s.db.Raw("SELECT sql FROM sqlite_master WHERE tbl_name = ? AND sql IS NOT NULL ORDER BY type DESC", requestLogTable).
+		Scan(&statements).Error; err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return fmt.Errorf("table %s not found", requestLogTable)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			statement = strings.ReplaceAll(statement, requestLogTable, name)
+			for _, prefix := range []string{"CREATE TABLE ", "CREATE INDEX ", "CREATE UNIQUE INDEX "} {
+				if strings.HasPrefix(statement, prefix) {
+					statement = prefix + "IF NOT EXISTS " + strings.TrimPrefix(statement, prefix)
+					break
+				}
+			}
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// syncColumns adds columns that were added to the request log model after the table was created.
+func (s *RequestLogPartitionService) syncColumns(table string) error {
+	migrator := s.db.Table(table).Migrator()
+	for _, column := range s.columns {
+		if migrator.HasColumn(&models.RequestLog{}, column) {
+			continue
+		}
+		if err := migrator.AddColumn(&models.RequestLog{}, column); err != nil {
+			return err
+		}
+		logrus.Infof("Added column %s to request log partition %s.", column, table)
+	}
+	return nil
+}
+
+// listPartitions returns the existing monthly tables in ascending order.
+// The result is cached briefly unless refresh is set, as other instances may create partitions.
+func (s *RequestLogPartitionService) listPartitions(refresh bool) ([]string, error) {
+	s.mu.Lock()
+	cached := !refresh && s.clock.Since(s.listedAt) < partitionListCacheTTL
+	s.mu.Unlock()
+
+	if !cached {
+		tables, err := s.db.Migrator().GetTables()
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		for _, table := range tables {
+			if requestLogPartitionRegex.MatchString(table) {
+				s.known[table] = struct{}{}
+			}
+		}
+		s.listedAt = s.clock.Now()
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	partitions := make([]string, 0, len(s.known))
+	for table := range s.known {
+		partitions = append(partitions, table)
+	}
+	sort.Strings(partitions)
+	return partitions, nil
+}
+
+func (s *RequestLogPartitionService) forget(table string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.known, table)
+}
+
+// legacyPending reports whether the legacy table still holds rows awaiting backfill.
+func (s *RequestLogPartitionService) legacyPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clock.Since(s.legacyAt) < partitionListCacheTTL {
+		return s.legacyHasRows
+	}
+
+	var ids []string
+	if err := s.db.Table(requestLogTable).Limit(1).Pluck("id", &ids).Error; err != nil {
+		logrus.WithError(err).Warn("Failed to check legacy request log table")
+		return true
+	}
+	s.legacyHasRows = len(ids) > 0
+	s.legacyAt = s.clock.Now()
+	return s.legacyHasRows
+}
+
+func (s *RequestLogPartitionService) quote(name string) string {
+	var b strings.Builder
+	s.db.Dialector.QuoteTo(&b, name)
+	return b.String()
+}
+
+// partitionMonth returns the first instant of the UTC month containing t.
+func partitionMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(month time.Time) string {
+	return requestLogTable + "_" + month.Format("200601")
+}
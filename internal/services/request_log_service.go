@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"gpt-load/internal/config"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/models"
 	"gpt-load/internal/store"
+	"gpt-load/internal/types"
 	"strings"
 	"sync"
 	"time"
@@ -21,24 +23,42 @@ const (
 	RequestLogCachePrefix    = "request_log:"
 	PendingLogKeysSet        = "pending_log_keys"
 	DefaultLogFlushBatchSize = 200
+	// requestLogQueueFlushInterval 实时写入模式下队列中的日志不足一批时的最长等待时间
+	requestLogQueueFlushInterval = time.Second
 )
 
 // RequestLogService is responsible for managing request logs.
 type RequestLogService struct {
 	db              *gorm.DB
 	store           store.Store
+	configManager   types.ConfigManager
 	settingsManager *config.SystemSettingsManager
+	exporter        *ClickHouseExporter
+	partitions      *RequestLogPartitionService
+	offload         *PayloadOffloadService
+	metrics         *metrics.Metrics
+	queue           chan *models.RequestLog
+	queueStop       chan struct{}
+	queueDone       chan struct{}
 	stopChan        chan struct{}
 	wg              sync.WaitGroup
 	ticker          *time.Ticker
 }
 
 // NewRequestLogService creates a new RequestLogService instance
-func NewRequestLogService(db *gorm.DB, store store.Store, sm *config.SystemSettingsManager) *RequestLogService {
+func NewRequestLogService(db *gorm.DB, store store.Store, configManager types.ConfigManager, sm *config.SystemSettingsManager, exporter *ClickHouseExporter, partitions *RequestLogPartitionService, offload *PayloadOffloadService, appMetrics *metrics.Metrics) *RequestLogService {
 	return &RequestLogService{
 		db:              db,
 		store:           store,
+		configManager:   configManager,
 		settingsManager: sm,
+		exporter:        exporter,
+		partitions:      partitions,
+		offload:         offload,
+		metrics:         appMetrics,
+		queue:           make(chan *models.RequestLog, configManager.GetLogConfig().RequestLogQueueSize),
+		queueStop:       make(chan struct{}),
+		queueDone:       make(chan struct{}),
 		stopChan:        make(chan struct{}),
 	}
 }
@@ -49,6 +69,24 @@ func (s *RequestLogService) Start() {
 	go s.runLoop()
 }
 
+// StartQueueWriter starts writing the logs recorded in immediate write mode. Unlike the cache
+// flush, it runs on every node, since each node queues the logs of its own requests.
+func (s *RequestLogService) StartQueueWriter() {
+	go s.runQueueWriter()
+}
+
+// StopQueueWriter writes the logs left in the queue and stops the queue writer.
+func (s *RequestLogService) StopQueueWriter(ctx context.Context) {
+	close(s.queueStop)
+
+	select {
+	case <-s.queueDone:
+		logrus.Info("Request log queue writer stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warnf("Request log queue writer stop timed out, %d queued logs were not written.", len(s.queue))
+	}
+}
+
 func (s *RequestLogService) runLoop() {
 	defer s.wg.Done()
 
@@ -105,8 +143,11 @@ func (s *RequestLogService) Record(log *models.RequestLog) error {
 	log.ID = uuid.NewString()
 	log.Timestamp = time.Now()
 
+	s.exporter.Enqueue(log)
+
 	if s.settingsManager.GetSettings().RequestLogWriteIntervalMinutes == 0 {
-		return s.writeLogsToDB([]*models.RequestLog{log})
+		s.enqueue(log)
+		return nil
 	}
 
 	cacheKey := RequestLogCachePrefix + log.ID
@@ -124,6 +165,63 @@ func (s *RequestLogService) Record(log *models.RequestLog) error {
 	return s.store.SAdd(PendingLogKeysSet, cacheKey)
 }
 
+// enqueue 将日志放入实时写入队列，队列已满（数据库写入跟不上）时丢弃日志而不阻塞请求
+func (s *RequestLogService) enqueue(log *models.RequestLog) {
+	select {
+	case s.queue <- log:
+	default:
+		s.metrics.RequestLogsDropped.WithLabelValues("queue_full").Inc()
+		logrus.WithField("group", log.GroupName).Debug("Request log queue is full, dropping log.")
+	}
+}
+
+// runQueueWriter 批量写入实时写入队列中的日志，达到一批或等待超过 requestLogQueueFlushInterval 时写入，
+// 停止时写入队列中剩余的日志
+func (s *RequestLogService) runQueueWriter() {
+	defer close(s.queueDone)
+
+	ticker := time.NewTicker(requestLogQueueFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.RequestLog, 0, DefaultLogFlushBatchSize)
+	for {
+		select {
+		case log := <-s.queue:
+			batch = append(batch, log)
+			if len(batch) >= DefaultLogFlushBatchSize {
+				batch = s.writeQueuedLogs(batch)
+			}
+		case <-ticker.C:
+			batch = s.writeQueuedLogs(batch)
+		case <-s.queueStop:
+			for {
+				select {
+				case log := <-s.queue:
+					batch = append(batch, log)
+					if len(batch) >= DefaultLogFlushBatchSize {
+						batch = s.writeQueuedLogs(batch)
+					}
+				default:
+					s.writeQueuedLogs(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeQueuedLogs 写入一批队列中的日志并返回清空后的切片，写入失败的日志被丢弃，避免队列无限积压
+func (s *RequestLogService) writeQueuedLogs(batch []*models.RequestLog) []*models.RequestLog {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := s.writeLogsToDB(batch); err != nil {
+		s.metrics.RequestLogsDropped.WithLabelValues("write_failed").Add(float64(len(batch)))
+		logrus.Errorf("Failed to write %d queued request logs, dropping them: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
 // flush data from cache to database
 func (s *RequestLogService) flush() {
 	if s.settingsManager.GetSettings().RequestLogWriteIntervalMinutes == 0 {
@@ -202,9 +300,22 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 		return nil
 	}
 
+	// 关闭请求日志存储时只更新统计
+	storeLogs := s.configManager.GetLogConfig().StoreRequestLogs
+	if storeLogs {
+		if err := s.partitions.EnsurePartitionsFor(logs); err != nil {
+			return err
+		}
+
+		// 达到大小阈值的请求体写入对象存储，上传失败的仍写入数据库
+		s.offload.Offload(logs)
+	}
+
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.CreateInBatches(logs, len(logs)).Error; err != nil {
-			return fmt.Errorf("failed to batch insert request logs: %w", err)
+		if storeLogs {
+			if err := s.partitions.Insert(tx, logs); err != nil {
+				return fmt.Errorf("failed to batch insert request logs: %w", err)
+			}
 		}
 
 		keyStats := make(map[string]int64)
@@ -219,8 +330,11 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 			var keyValues []string
 			caseStmt.WriteString("CASE key_value ")
 			for keyValue, count := range keyStats {
-				caseStmt.WriteString(fmt.Sprintf("WHEN '%s' THEN request_count + %d ", keyValue, count))
-				keyValues = append(keyValues, keyValue)
+				// 同时匹配加密与明文形式，兼容尚未重新加密的密钥
+				for _, storedValue := range models.KeyValueLookups([]string{keyValue}) {
+					caseStmt.WriteString(fmt.Sprintf("WHEN '%s' THEN request_count + %d ", storedValue, count))
+					keyValues = append(keyValues, storedValue)
+				}
 			}
 			caseStmt.WriteString("END")
 
@@ -279,6 +393,52 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 			}
 		}
 
+		// 按密钥来源累计每小时的请求数，包含重试请求，没有来源的密钥不统计
+		sourceStats := make(map[struct {
+			Time    time.Time
+			GroupID uint
+			Source  string
+		}]struct{ Success, Failure int64 })
+		for _, log := range logs {
+			if log.KeySource == "" {
+				continue
+			}
+			key := struct {
+				Time    time.Time
+				GroupID uint
+				Source  string
+			}{Time: log.Timestamp.Truncate(time.Hour), GroupID: log.GroupID, Source: log.KeySource}
+
+			counts := sourceStats[key]
+			if log.IsSuccess {
+				counts.Success++
+			} else {
+				counts.Failure++
+			}
+			sourceStats[key] = counts
+		}
+
+		for key, counts := range sourceStats {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "time"}, {Name: "group_id"}, {Name: "source"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"success_count": gorm.Expr("key_source_hourly_stats.success_count + ?", counts.Success),
+					"failure_count": gorm.Expr("key_source_hourly_stats.failure_count + ?", counts.Failure),
+					"updated_at":    time.Now(),
+				}),
+			}).Create(&models.KeySourceHourlyStat{
+				Time:         key.Time,
+				GroupID:      key.GroupID,
+				Source:       key.Source,
+				SuccessCount: counts.Success,
+				FailureCount: counts.Failure,
+			}).Error
+
+			if err != nil {
+				return fmt.Errorf("failed to upsert key source hourly stat: %w", err)
+			}
+		}
+
 		return nil
 	})
 }
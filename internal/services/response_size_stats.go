@@ -0,0 +1,134 @@
+package services
+
+import (
+	"sort"
+	"sync"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+)
+
+const (
+	// 超出该数量后其余模型计入 metrics.OtherModel
+	maxResponseSizeModels = 200
+	// 至少有该数量的响应后才给出缓冲阈值建议
+	responseSizeMinSamples = 20
+	// 超过缓冲阈值的响应占比高于该值时建议调大阈值
+	responseSizeSuggestRatio = 0.5
+	// 建议的阈值覆盖该比例的响应
+	responseSizeSuggestCoverage = 0.9
+)
+
+// ModelResponseSize summarizes the response body sizes of a model against the buffer threshold.
+type ModelResponseSize struct {
+	Model              string  `json:"model"`
+	Responses          int64   `json:"responses"`
+	OverThreshold      int64   `json:"over_threshold"`
+	OverThresholdRatio float64 `json:"over_threshold_ratio"`
+	// SuggestRaise is set when more than half of the responses exceed the threshold.
+	SuggestRaise bool `json:"suggest_raise"`
+	// 覆盖 90% 响应的直方图桶上限，超过最大的桶时为 0
+	SuggestedThresholdBytes int64 `json:"suggested_threshold_bytes,omitempty"`
+}
+
+// ResponseSizeReport is the per-model response size summary shown on the dashboard.
+type ResponseSizeReport struct {
+	ThresholdBytes int64               `json:"threshold_bytes"`
+	Models         []ModelResponseSize `json:"models"`
+}
+
+type modelResponseSizes struct {
+	buckets       []int64 // 各直方图桶（不累计）的响应数，最后一项为超过最大桶的响应
+	count         int64
+	overThreshold int64
+}
+
+// ResponseSizeStats records upstream response body sizes per model, in the metrics histogram
+// and as in-memory counts used to suggest PROXY_BUFFER_THRESHOLD_BYTES. The in-memory counts
+// start over when the threshold changes.
+type ResponseSizeStats struct {
+	configManager types.ConfigManager
+	metrics       *metrics.Metrics
+	mu            sync.Mutex
+	threshold     int64
+	models        map[string]*modelResponseSizes
+}
+
+// NewResponseSizeStats creates a new ResponseSizeStats.
+func NewResponseSizeStats(configManager types.ConfigManager, appMetrics *metrics.Metrics) *ResponseSizeStats {
+	return &ResponseSizeStats{
+		configManager: configManager,
+		metrics:       appMetrics,
+		threshold:     configManager.GetProxyConfig().BufferThresholdBytes,
+		models:        make(map[string]*modelResponseSizes),
+	}
+}
+
+// Observe records a response body of size bytes for a request to group for model. Models the
+// group does not configure are counted together, see metrics.ModelLabel.
+func (s *ResponseSizeStats) Observe(group *models.Group, model string, size int64) {
+	model = metrics.ModelLabel(group, model)
+	threshold := s.configManager.GetProxyConfig().BufferThresholdBytes
+
+	s.mu.Lock()
+	if threshold != s.threshold {
+		s.threshold = threshold
+		s.models = make(map[string]*modelResponseSizes)
+	}
+	stats, ok := s.models[model]
+	if !ok {
+		if len(s.models) >= maxResponseSizeModels {
+			model = metrics.OtherModel
+			stats = s.models[model]
+		}
+		if stats == nil {
+			stats = &modelResponseSizes{buckets: make([]int64, len(metrics.ResponseSizeBuckets)+1)}
+			s.models[model] = stats
+		}
+	}
+	stats.count++
+	stats.buckets[sort.SearchFloat64s(metrics.ResponseSizeBuckets, float64(size))]++
+	if threshold > 0 && size > threshold {
+		stats.overThreshold++
+	}
+	s.mu.Unlock()
+
+	s.metrics.ObserveResponseBodySize(model, size)
+}
+
+// Report returns the response size summary of every model, ordered by model name.
+func (s *ResponseSizeStats) Report() ResponseSizeReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ResponseSizeReport{ThresholdBytes: s.threshold, Models: make([]ModelResponseSize, 0, len(s.models))}
+	for model, stats := range s.models {
+		entry := ModelResponseSize{
+			Model:              model,
+			Responses:          stats.count,
+			OverThreshold:      stats.overThreshold,
+			OverThresholdRatio: float64(stats.overThreshold) / float64(stats.count),
+		}
+		if stats.count >= responseSizeMinSamples && entry.OverThresholdRatio > responseSizeSuggestRatio {
+			entry.SuggestRaise = true
+			entry.SuggestedThresholdBytes = stats.coveringBucket(responseSizeSuggestCoverage)
+		}
+		report.Models = append(report.Models, entry)
+	}
+	sort.Slice(report.Models, func(i, j int) bool { return report.Models[i].Model < report.Models[j].Model })
+	return report
+}
+
+// coveringBucket returns the smallest bucket bound that at least ratio of the responses fit in,
+// or 0 if that is beyond the largest bucket.
+func (m *modelResponseSizes) coveringBucket(ratio float64) int64 {
+	var cumulative int64
+	for i, bound := range metrics.ResponseSizeBuckets {
+		cumulative += m.buckets[i]
+		if float64(cumulative) >= ratio*float64(m.count) {
+			return int64(bound)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gpt-load/internal/models"
+	appruntime "gpt-load/internal/runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// statsBackfillBatchPause 每处理完一个小时的日志后暂停的时间，避免回填长时间占满数据库
+	statsBackfillBatchPause = 100 * time.Millisecond
+	statsBackfillTimeout    = 6 * time.Hour
+	// StatsBackfillMaxRange 单次回填允许的最大时间范围
+	StatsBackfillMaxRange = 366 * 24 * time.Hour
+	// StatsVerifyMaxSample 校验模式最多抽样的小时数
+	StatsVerifyMaxSample = 168
+)
+
+// StatsBackfillProgress is the running detail reported while a backfill task is in progress.
+type StatsBackfillProgress struct {
+	RowsScanned int64 `json:"rows_scanned"`
+	UpdatedRows int64 `json:"updated_rows"`
+}
+
+// StatsBackfillResult holds the result of a backfill task.
+type StatsBackfillResult struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Hours       int       `json:"hours"`
+	RowsScanned int64     `json:"rows_scanned"`
+	UpdatedRows int64     `json:"updated_rows"`
+}
+
+// StatsDiscrepancy describes an hourly rollup row that does not match the raw request logs.
+type StatsDiscrepancy struct {
+	Time          time.Time `json:"time"`
+	GroupID       uint      `json:"group_id"`
+	RollupSuccess int64     `json:"rollup_success"`
+	RollupFailure int64     `json:"rollup_failure"`
+	RawSuccess    int64     `json:"raw_success"`
+	RawFailure    int64     `json:"raw_failure"`
+}
+
+// StatsVerifyResult holds the result of comparing sampled rollups against raw request logs.
+type StatsVerifyResult struct {
+	From          time.Time          `json:"from"`
+	To            time.Time          `json:"to"`
+	SampledHours  []time.Time        `json:"sampled_hours"`
+	CheckedRows   int                `json:"checked_rows"`
+	Discrepancies []StatsDiscrepancy `json:"discrepancies"`
+}
+
+type hourlyCounts struct {
+	Success int64
+	Failure int64
+}
+
+// StatsBackfillService rebuilds group_hourly_stats from existing request logs, for deployments
+// that stored logs before the rollup existed. Key source rollups cannot be rebuilt, since the
+// key source is not stored on request logs.
+type StatsBackfillService struct {
+	DB          *gorm.DB
+	LogService  *LogService
+	TaskService *TaskService
+	Pool        *appruntime.GoroutinePool
+}
+
+// NewStatsBackfillService creates a new StatsBackfillService.
+func NewStatsBackfillService(db *gorm.DB, logService *LogService, taskService *TaskService, pool *appruntime.GoroutinePool) *StatsBackfillService {
+	return &StatsBackfillService{
+		DB:          db,
+		LogService:  logService,
+		TaskService: taskService,
+		Pool:        pool,
+	}
+}
+
+// NormalizeStatsRange 将时间范围对齐到整点，并把结束时间限制在当前小时之前，当前小时仍由实时写入维护
+func NormalizeStatsRange(from, to time.Time) (time.Time, time.Time, error) {
+	from = from.Truncate(time.Hour)
+	to = to.Truncate(time.Hour)
+	if currentHour := time.Now().Truncate(time.Hour); to.After(currentHour) {
+		to = currentHour
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("the range must cover at least one completed hour")
+	}
+	if to.Sub(from) > StatsBackfillMaxRange {
+		return from, to, fmt.Errorf("the range must not exceed %d days", int(StatsBackfillMaxRange/(24*time.Hour)))
+	}
+	return from, to, nil
+}
+
+// StartBackfillTask starts an asynchronous backfill of the hourly rollups between from and to.
+func (s *StatsBackfillService) StartBackfillTask(from, to time.Time) (*TaskStatus, error) {
+	from, to, err := NormalizeStatsRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := int(to.Sub(from) / time.Hour)
+	initialStatus, err := s.TaskService.StartTask(TaskTypeStatsBackfill, "", hours, statsBackfillTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Pool.GoNoWait(func() { s.runBackfill(from, to, hours) })
+
+	return initialStatus, nil
+}
+
+func (s *StatsBackfillService) runBackfill(from, to time.Time, hours int) {
+	result := &StatsBackfillResult{From: from, To: to, Hours: hours}
+	processed := 0
+	for hour := from; hour.Before(to); hour = hour.Add(time.Hour) {
+		counts, scanned, err := s.rawHourlyCounts(hour)
+		if err == nil {
+			err = s.mergeHourlyCounts(hour, counts)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to backfill stats for %s: %w", hour.Format(time.RFC3339), err)
+			if endErr := s.TaskService.EndTask(nil, err); endErr != nil {
+				logrus.Errorf("Failed to end stats backfill task: %v (original error: %v)", endErr, err)
+			}
+			return
+		}
+
+		result.RowsScanned += scanned
+		result.UpdatedRows += int64(len(counts))
+		processed++
+		progress := StatsBackfillProgress{RowsScanned: result.RowsScanned, UpdatedRows: result.UpdatedRows}
+		if err := s.TaskService.UpdateProgressDetail(processed, progress); err != nil {
+			logrus.Warnf("Failed to update stats backfill progress: %v", err)
+		}
+
+		time.Sleep(statsBackfillBatchPause)
+	}
+
+	logrus.Infof("Stats backfill finished: %d hours, %d logs scanned, %d rollup rows merged", hours, result.RowsScanned, result.UpdatedRows)
+	if err := s.TaskService.EndTask(result, nil); err != nil {
+		logrus.Errorf("Failed to end stats backfill task: %v", err)
+	}
+}
+
+// rawHourlyCounts 按分组统计某小时内的原始请求日志，与实时写入一致排除重试请求，同时返回扫描的日志数
+func (s *StatsBackfillService) rawHourlyCounts(hour time.Time) (map[uint]hourlyCounts, int64, error) {
+	var rows []struct {
+		GroupID   uint
+		IsSuccess bool
+		Count     int64
+	}
+	err := s.LogService.LogsBetween(hour, hour.Add(time.Hour)).
+		Select("group_id, is_success, COUNT(*) as count").
+		Where("timestamp >= ? AND timestamp < ?", hour, hour.Add(time.Hour)).
+		Where("request_type != ?", models.RequestTypeRetry).
+		Group("group_id, is_success").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counts := make(map[uint]hourlyCounts)
+	var scanned int64
+	for _, row := range rows {
+		c := counts[row.GroupID]
+		if row.IsSuccess {
+			c.Success += row.Count
+		} else {
+			c.Failure += row.Count
+		}
+		counts[row.GroupID] = c
+		scanned += row.Count
+	}
+	return counts, scanned, nil
+}
+
+// mergeHourlyCounts 将重新计算的结果合并到统计表。每个计数取已有值与重新计算值中的较大者，
+// 因此重复回填不会重复累加，日志已被清理的小时也不会被改小。
+func (s *StatsBackfillService) mergeHourlyCounts(hour time.Time, counts map[uint]hourlyCounts) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for groupID, c := range counts {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "time"}, {Name: "group_id"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"success_count": gorm.Expr("CASE WHEN group_hourly_stats.success_count > ? THEN group_hourly_stats.success_count ELSE ? END", c.Success, c.Success),
+					"failure_count": gorm.Expr("CASE WHEN group_hourly_stats.failure_count > ? THEN group_hourly_stats.failure_count ELSE ? END", c.Failure, c.Failure),
+					"updated_at":    time.Now(),
+				}),
+			}).Create(&models.GroupHourlyStat{
+				Time:         hour,
+				GroupID:      groupID,
+				SuccessCount: c.Success,
+				FailureCount: c.Failure,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to merge group hourly stat: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// VerifyRollups compares the rollups of up to sample hours, evenly spread between from and to,
+// against counts recomputed from the raw request logs, and reports every row that differs.
+func (s *StatsBackfillService) VerifyRollups(from, to time.Time, sample int) (*StatsVerifyResult, error) {
+	from, to, err := NormalizeStatsRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if sample <= 0 || sample > StatsVerifyMaxSample {
+		return nil, fmt.Errorf("sample must be between 1 and %d", StatsVerifyMaxSample)
+	}
+
+	hours := int(to.Sub(from) / time.Hour)
+	if sample > hours {
+		sample = hours
+	}
+	result := &StatsVerifyResult{From: from, To: to, Discrepancies: []StatsDiscrepancy{}}
+	for i := 0; i < sample; i++ {
+		hour := from.Add(time.Duration(i*hours/sample) * time.Hour)
+		result.SampledHours = append(result.SampledHours, hour)
+
+		raw, _, err := s.rawHourlyCounts(hour)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count request logs for %s: %w", hour.Format(time.RFC3339), err)
+		}
+		var rollups []models.GroupHourlyStat
+		if err := s.DB.Where("time = ?", hour).Find(&rollups).Error; err != nil {
+			return nil, fmt.Errorf("failed to load rollups for %s: %w", hour.Format(time.RFC3339), err)
+		}
+
+		seen := make(map[uint]bool, len(rollups))
+		for _, rollup := range rollups {
+			seen[rollup.GroupID] = true
+			c := raw[rollup.GroupID]
+			result.CheckedRows++
+			if rollup.SuccessCount != c.Success || rollup.FailureCount != c.Failure {
+				result.Discrepancies = append(result.Discrepancies, StatsDiscrepancy{
+					Time:          hour,
+					GroupID:       rollup.GroupID,
+					RollupSuccess: rollup.SuccessCount,
+					RollupFailure: rollup.FailureCount,
+					RawSuccess:    c.Success,
+					RawFailure:    c.Failure,
+				})
+			}
+		}
+		for groupID, c := range raw {
+			if seen[groupID] {
+				continue
+			}
+			result.CheckedRows++
+			result.Discrepancies = append(result.Discrepancies, StatsDiscrepancy{
+				Time:       hour,
+				GroupID:    groupID,
+				RawSuccess: c.Success,
+				RawFailure: c.Failure,
+			})
+		}
+	}
+
+	return result, nil
+}
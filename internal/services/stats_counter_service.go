@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GroupCounters holds the aggregate request counters of a group.
+type GroupCounters struct {
+	RequestCount int64 `json:"request_count"`
+	FailureCount int64 `json:"failure_count"`
+}
+
+// StatsCounterService keeps aggregate request counters in memory and, when enabled,
+// periodically persists them to the database so they survive restarts.
+type StatsCounterService struct {
+	db            *gorm.DB
+	configManager types.ConfigManager
+	mu            sync.Mutex
+	totals        map[uint]GroupCounters
+	pending       map[uint]GroupCounters
+	started       bool
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewStatsCounterService creates a new StatsCounterService instance
+func NewStatsCounterService(db *gorm.DB, configManager types.ConfigManager) *StatsCounterService {
+	return &StatsCounterService{
+		db:            db,
+		configManager: configManager,
+		totals:        make(map[uint]GroupCounters),
+		pending:       make(map[uint]GroupCounters),
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Start loads persisted counters and starts the periodic persist routine.
+// It does nothing when persistence is disabled.
+func (s *StatsCounterService) Start() {
+	interval := time.Duration(s.configManager.GetStatsConfig().PersistIntervalSeconds) * time.Second
+	if interval <= 0 {
+		logrus.Debug("Stats persistence disabled, counters are kept in memory only.")
+		return
+	}
+
+	if err := s.Load(); err != nil {
+		logrus.Errorf("Failed to load persisted stats counters: %v", err)
+	}
+
+	s.started = true
+	s.wg.Add(1)
+	go s.runLoop(interval)
+}
+
+func (s *StatsCounterService) runLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Persist(); err != nil {
+				logrus.Errorf("Failed to persist stats counters, will retry next time: %v", err)
+			}
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Stop gracefully stops the StatsCounterService and persists the remaining counters.
+func (s *StatsCounterService) Stop(ctx context.Context) {
+	if !s.started {
+		return
+	}
+	close(s.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if err := s.Persist(); err != nil {
+			logrus.Errorf("Failed to persist stats counters on shutdown: %v", err)
+		}
+		logrus.Info("StatsCounterService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("StatsCounterService stop timed out.")
+	}
+}
+
+// Record increments the counters of a group for one finished request.
+func (s *StatsCounterService) Record(groupID uint, isSuccess bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := s.totals[groupID]
+	delta := s.pending[groupID]
+	total.RequestCount++
+	delta.RequestCount++
+	if !isSuccess {
+		total.FailureCount++
+		delta.FailureCount++
+	}
+	s.totals[groupID] = total
+	s.pending[groupID] = delta
+}
+
+// Snapshot returns a copy of the current counters of every group.
+func (s *StatsCounterService) Snapshot() map[uint]GroupCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[uint]GroupCounters, len(s.totals))
+	for groupID, counters := range s.totals {
+		snapshot[groupID] = counters
+	}
+	return snapshot
+}
+
+// Load adds the persisted counters to the in-memory totals.
+func (s *StatsCounterService) Load() error {
+	var rows []models.GroupStatCounter
+	if err := s.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to query stats counters: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range rows {
+		total := s.totals[row.GroupID]
+		total.RequestCount += row.RequestCount
+		total.FailureCount += row.FailureCount
+		s.totals[row.GroupID] = total
+	}
+	logrus.Debugf("Loaded persisted stats counters for %d groups.", len(rows))
+	return nil
+}
+
+// Persist writes the counter increments accumulated since the last persist to the database.
+// Increments are added to the stored values, so multiple nodes can share the same table.
+func (s *StatsCounterService) Persist() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[uint]GroupCounters)
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for groupID, delta := range pending {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "group_id"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"request_count": gorm.Expr("group_stat_counters.request_count + ?", delta.RequestCount),
+					"failure_count": gorm.Expr("group_stat_counters.failure_count + ?", delta.FailureCount),
+					"updated_at":    time.Now(),
+				}),
+			}).Create(&models.GroupStatCounter{
+				GroupID:      groupID,
+				RequestCount: delta.RequestCount,
+				FailureCount: delta.FailureCount,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to upsert stats counter for group %d: %w", groupID, err)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		// 写入失败时将增量合并回待持久化队列，下次重试
+		s.mu.Lock()
+		for groupID, delta := range pending {
+			current := s.pending[groupID]
+			current.RequestCount += delta.RequestCount
+			current.FailureCount += delta.FailureCount
+			s.pending[groupID] = current
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	logrus.Debugf("Persisted stats counters for %d groups.", len(pending))
+	return nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"gpt-load/internal/models"
+)
+
+type statsRecord struct {
+	groupID uint
+	success bool
+}
+
+func TestStatsCounterServicePersistAcrossRestart(t *testing.T) {
+	tests := []struct {
+		name   string
+		rounds [][]statsRecord
+		want   map[uint]GroupCounters
+	}{
+		{
+			name:   "nothing recorded",
+			rounds: [][]statsRecord{nil},
+			want:   map[uint]GroupCounters{},
+		},
+		{
+			name:   "single round",
+			rounds: [][]statsRecord{{{1, true}, {1, false}, {2, true}}},
+			want:   map[uint]GroupCounters{1: {RequestCount: 2, FailureCount: 1}, 2: {RequestCount: 1}},
+		},
+		{
+			name: "increments added across restarts",
+			rounds: [][]statsRecord{
+				{{1, true}, {1, true}},
+				{{1, false}, {3, false}},
+				{},
+			},
+			want: map[uint]GroupCounters{1: {RequestCount: 3, FailureCount: 1}, 3: {RequestCount: 1, FailureCount: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &models.GroupStatCounter{})
+			for _, round := range tt.rounds {
+				// 每一轮模拟一次进程启动：加载持久化的计数，记录请求后持久化
+				service := NewStatsCounterService(db, nil)
+				if err := service.Load(); err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				for _, record := range round {
+					service.Record(record.groupID, record.success)
+				}
+				if err := service.Persist(); err != nil {
+					t.Fatalf("Persist() error = %v", err)
+				}
+			}
+
+			restarted := NewStatsCounterService(db, nil)
+			if err := restarted.Load(); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := restarted.Snapshot(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counters after restart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsCounterServiceRetriesFailedPersist(t *testing.T) {
+	db := newTestDB(t, &models.GroupStatCounter{})
+	service := NewStatsCounterService(db, nil)
+	service.Record(1, true)
+	service.Record(1, false)
+
+	if err := db.Migrator().DropTable(&models.GroupStatCounter{}); err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+	if err := service.Persist(); err == nil {
+		t.Fatal("Persist() succeeded without the table")
+	}
+
+	// 失败的增量合并回待持久化队列，与之后的记录一起写入
+	if err := db.AutoMigrate(&models.GroupStatCounter{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	service.Record(1, true)
+	if err := service.Persist(); err != nil {
+		t.Fatalf("Persist() error = %v", err)
+	}
+
+	var row models.GroupStatCounter
+	if err := db.First(&row, "group_id = ?", 1).Error; err != nil {
+		t.Fatalf("query counter: %v", err)
+	}
+	if row.RequestCount != 3 || row.FailureCount != 1 {
+		t.Errorf("persisted counters = %d requests, %d failures, want 3 and 1", row.RequestCount, row.FailureCount)
+	}
+}
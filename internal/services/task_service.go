@@ -17,6 +17,7 @@ const (
 	TaskTypeKeyValidation = "KEY_VALIDATION"
 	TaskTypeKeyImport     = "KEY_IMPORT"
 	TaskTypeKeyDelete     = "KEY_DELETE"
+	TaskTypeStatsBackfill = "STATS_BACKFILL"
 )
 
 // TaskStatus represents the full lifecycle of a long-running task.
@@ -26,11 +27,14 @@ type TaskStatus struct {
 	GroupName       string     `json:"group_name,omitempty"`
 	Processed       int        `json:"processed"`
 	Total           int        `json:"total"`
+	Detail          any        `json:"detail,omitempty"`
 	Result          any        `json:"result,omitempty"`
 	Error           string     `json:"error,omitempty"`
 	StartedAt       time.Time  `json:"started_at"`
 	FinishedAt      *time.Time `json:"finished_at,omitempty"`
 	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+	// 按已处理进度的平均速度估算的完成时间，仅在任务运行中且已有进度时返回
+	EstimatedFinishAt *time.Time `json:"estimated_finish_at,omitempty"`
 }
 
 // TaskService manages the state of a single, global, long-running task using the store interface.
@@ -94,12 +98,24 @@ func (s *TaskService) GetTaskStatus() (*TaskStatus, error) {
 	if !status.IsRunning && status.FinishedAt != nil {
 		status.DurationSeconds = status.FinishedAt.Sub(status.StartedAt).Seconds()
 	}
+	if status.IsRunning && status.Processed > 0 && status.Processed < status.Total {
+		elapsed := time.Since(status.StartedAt)
+		remaining := time.Duration(float64(elapsed) * float64(status.Total-status.Processed) / float64(status.Processed))
+		eta := time.Now().Add(remaining)
+		status.EstimatedFinishAt = &eta
+	}
 
 	return &status, nil
 }
 
 // UpdateProgress updates the progress of the current task.
 func (s *TaskService) UpdateProgress(processed int) error {
+	return s.UpdateProgressDetail(processed, nil)
+}
+
+// UpdateProgressDetail updates the progress of the current task along with task specific
+// details, such as the number of rows scanned. A nil detail keeps the previous one.
+func (s *TaskService) UpdateProgressDetail(processed int, detail any) error {
 	status, err := s.GetTaskStatus()
 	if err != nil {
 		return err
@@ -109,6 +125,10 @@ func (s *TaskService) UpdateProgress(processed int) error {
 	}
 
 	status.Processed = processed
+	if detail != nil {
+		status.Detail = detail
+	}
+	status.EstimatedFinishAt = nil
 	statusBytes, err := json.Marshal(status)
 	if err != nil {
 		return fmt.Errorf("failed to serialize updated status: %w", err)
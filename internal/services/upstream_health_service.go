@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"gpt-load/internal/clock"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/notify"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// UpstreamHealth is the health of one upstream of a group, as shown in the group's upstream health view.
+type UpstreamHealth struct {
+	Upstream string `json:"upstream"`
+	// 当前窗口内以及自上次恢复以来的长度不符次数
+	WindowLengthMismatches int        `json:"window_length_mismatches"`
+	TotalLengthMismatches  int64      `json:"total_length_mismatches"`
+	LastLengthMismatchAt   *time.Time `json:"last_length_mismatch_at"`
+	RawMode                bool       `json:"raw_mode"`
+	RawModeSince           *time.Time `json:"raw_mode_since"`
+}
+
+// UpstreamQuarantineEvent is the webhook payload sent when raw mode is forced or cleared for an upstream.
+type UpstreamQuarantineEvent struct {
+	Event      string    `json:"event"`
+	Group      string    `json:"group"`
+	Upstream   string    `json:"upstream"`
+	Mismatches int       `json:"mismatches"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type upstreamHealthState struct {
+	mismatches     []time.Time
+	total          int64
+	lastMismatchAt time.Time
+	rawModeSince   time.Time
+}
+
+// UpstreamHealthService tracks responses whose body does not match their Content-Length or
+// transfer encoding. These are recorded against the upstream rather than the key, and an upstream
+// that keeps sending them is switched to raw mode until it has been clean for a while.
+// The state is kept per instance.
+type UpstreamHealthService struct {
+	configManager types.ConfigManager
+	clock         clock.Clock
+	notifier      *notify.Notifier
+	metrics       *metrics.Metrics
+
+	mu     sync.Mutex
+	states map[string]*upstreamHealthState
+}
+
+// NewUpstreamHealthService creates a new UpstreamHealthService.
+func NewUpstreamHealthService(configManager types.ConfigManager, clk clock.Clock, notifier *notify.Notifier, appMetrics *metrics.Metrics) *UpstreamHealthService {
+	return &UpstreamHealthService{
+		configManager: configManager,
+		clock:         clk,
+		notifier:      notifier,
+		metrics:       appMetrics,
+		states:        make(map[string]*upstreamHealthState),
+	}
+}
+
+// UpstreamOrigin returns the scheme and host of an upstream URL, which identify the upstream.
+func UpstreamOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// RecordLengthMismatch records a response of the upstream whose body ended before its declared
+// length, and forces raw mode once the threshold is reached within the window.
+func (s *UpstreamHealthService) RecordLengthMismatch(group *models.Group, upstreamURL string) {
+	cfg := s.configManager.GetProxyConfig()
+	origin := UpstreamOrigin(upstreamURL)
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	state := s.refresh(group.Name, stateKey(group.ID, origin), origin, now, true)
+	state.mismatches = append(state.mismatches, now)
+	state.total++
+	state.lastMismatchAt = now
+
+	count := len(state.mismatches)
+	triggered := cfg.LengthMismatchThreshold > 0 && count >= cfg.LengthMismatchThreshold && state.rawModeSince.IsZero()
+	if triggered {
+		state.rawModeSince = now
+	}
+	s.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{"group": group.Name, "upstream": origin, "window_mismatches": count}).
+		Warn("Upstream response body did not match its Content-Length or encoding")
+	if triggered {
+		logrus.WithFields(logrus.Fields{"group": group.Name, "upstream": origin, "mismatches": count}).
+			Error("Upstream exceeded the length mismatch threshold, forcing raw mode for its responses")
+		s.metrics.UpstreamRawMode.WithLabelValues(group.Name, origin).Set(1)
+		s.notify(UpstreamQuarantineEvent{Event: "upstream_raw_mode_forced", Group: group.Name, Upstream: origin, Mismatches: count, Timestamp: now})
+	}
+}
+
+// IsRawMode reports whether raw mode is forced for the upstream of the group.
+func (s *UpstreamHealthService) IsRawMode(group *models.Group, upstreamURL string) bool {
+	origin := UpstreamOrigin(upstreamURL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.refresh(group.Name, stateKey(group.ID, origin), origin, s.clock.Now(), false)
+	return state != nil && !state.rawModeSince.IsZero()
+}
+
+// GroupHealth returns the health of each configured upstream of the group.
+func (s *UpstreamHealthService) GroupHealth(group *models.Group) ([]UpstreamHealth, error) {
+	var defs []struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(group.Upstreams, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse upstreams: %w", err)
+	}
+
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]UpstreamHealth, 0, len(defs))
+	seen := make(map[string]struct{}, len(defs))
+	for _, def := range defs {
+		origin := UpstreamOrigin(def.URL)
+		if _, ok := seen[origin]; ok {
+			continue
+		}
+		seen[origin] = struct{}{}
+
+		health := UpstreamHealth{Upstream: origin}
+		if state := s.refresh(group.Name, stateKey(group.ID, origin), origin, now, false); state != nil {
+			health.WindowLengthMismatches = len(state.mismatches)
+			health.TotalLengthMismatches = state.total
+			if !state.lastMismatchAt.IsZero() {
+				lastMismatchAt := state.lastMismatchAt
+				health.LastLengthMismatchAt = &lastMismatchAt
+			}
+			if !state.rawModeSince.IsZero() {
+				rawModeSince := state.rawModeSince
+				health.RawMode = true
+				health.RawModeSince = &rawModeSince
+			}
+		}
+		result = append(result, health)
+	}
+	return result, nil
+}
+
+// refresh drops mismatches outside the window and resets the upstream once it has been clean
+// for the clean period. It returns nil for an unknown upstream unless create is set.
+// The caller holds s.mu.
+func (s *UpstreamHealthService) refresh(groupName, key, origin string, now time.Time, create bool) *upstreamHealthState {
+	state, ok := s.states[key]
+	if !ok {
+		if !create {
+			return nil
+		}
+		state = &upstreamHealthState{}
+		s.states[key] = state
+		return state
+	}
+
+	cfg := s.configManager.GetProxyConfig()
+	if cleanPeriod := time.Duration(cfg.RawModeCleanPeriodSeconds) * time.Second; now.Sub(state.lastMismatchAt) >= cleanPeriod {
+		if !state.rawModeSince.IsZero() {
+			logrus.WithFields(logrus.Fields{"group": groupName, "upstream": origin}).Info("Upstream has been clean, clearing forced raw mode")
+			s.metrics.UpstreamRawMode.WithLabelValues(groupName, origin).Set(0)
+			s.notify(UpstreamQuarantineEvent{Event: "upstream_raw_mode_cleared", Group: groupName, Upstream: origin, Timestamp: now})
+		}
+		delete(s.states, key)
+		if !create {
+			return nil
+		}
+		state = &upstreamHealthState{}
+		s.states[key] = state
+		return state
+	}
+
+	window := time.Duration(cfg.LengthMismatchWindowSeconds) * time.Second
+	kept := state.mismatches[:0]
+	for _, at := range state.mismatches {
+		if now.Sub(at) < window {
+			kept = append(kept, at)
+		}
+	}
+	state.mismatches = kept
+	return state
+}
+
+// notify sends the event to the upstream quarantine channel.
+func (s *UpstreamHealthService) notify(event UpstreamQuarantineEvent) {
+	notification := notify.Event{
+		Type:      event.Event,
+		Severity:  notify.SeverityInfo,
+		Group:     event.Group,
+		Summary:   fmt.Sprintf("Raw mode cleared for upstream %s of group %s.", event.Upstream, event.Group),
+		Timestamp: event.Timestamp,
+		Payload:   event,
+	}
+	if event.Event == "upstream_raw_mode_forced" {
+		notification.Severity = notify.SeverityWarning
+		notification.Summary = fmt.Sprintf(":warning: Raw mode forced for upstream %s of group %s after %d length mismatches.", event.Upstream, event.Group, event.Mismatches)
+	}
+	s.notifier.Notify(notify.ChannelUpstreamQuarantine, notification)
+}
+
+func stateKey(groupID uint, origin string) string {
+	return fmt.Sprintf("%d|%s", groupID, origin)
+}
@@ -0,0 +1,170 @@
+// Package siem streams admin audit events to an external SIEM over HTTP.
+package siem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/version"
+)
+
+// Supported stream formats.
+const (
+	FormatJSONLines = "json_lines"
+	FormatCEF       = "cef"
+	FormatLEEF      = "leef"
+)
+
+const (
+	vendor  = "gpt-load"
+	product = "gpt-load"
+	// leefTimeFormat is the default LEEF devTime format (MMM dd yyyy HH:mm:ss.SSS zzz).
+	leefTimeFormat = "Jan 02 2006 15:04:05.000 MST"
+)
+
+// Encode renders the events in the given format, one event per line, and returns the
+// payload with its content type.
+func Encode(format string, events []models.AdminAuditLog) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSONLines:
+		encoder := json.NewEncoder(&buf)
+		for i := range events {
+			if err := encoder.Encode(&events[i]); err != nil {
+				return nil, "", fmt.Errorf("failed to encode audit event %d: %w", events[i].ID, err)
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	case FormatCEF:
+		for i := range events {
+			buf.WriteString(formatCEF(&events[i]))
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "text/plain; charset=utf-8", nil
+	case FormatLEEF:
+		for i := range events {
+			buf.WriteString(formatLEEF(&events[i]))
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "text/plain; charset=utf-8", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported SIEM stream format %q", format)
+	}
+}
+
+// outcome classifies the event by its status code. Events without a status code, such as
+// scheduler actions, are successful.
+func outcome(event *models.AdminAuditLog) string {
+	if event.StatusCode >= 400 {
+		return "failure"
+	}
+	return "success"
+}
+
+// cefSeverity maps the status code to a CEF severity (0-10).
+func cefSeverity(event *models.AdminAuditLog) int {
+	switch {
+	case event.StatusCode == 401 || event.StatusCode == 403:
+		return 7
+	case event.StatusCode >= 500:
+		return 6
+	case event.StatusCode >= 400:
+		return 5
+	default:
+		return 3
+	}
+}
+
+// formatCEF renders an event as an ArcSight Common Event Format line:
+// CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+func formatCEF(event *models.AdminAuditLog) string {
+	header := []string{
+		"CEF:0",
+		cefHeader(vendor),
+		cefHeader(product),
+		cefHeader(version.Version),
+		cefHeader(event.Action),
+		cefHeader("Admin API audit: " + event.Action),
+		strconv.Itoa(cefSeverity(event)),
+	}
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(event.Timestamp.UnixMilli(), 10),
+		"externalId=" + strconv.FormatUint(uint64(event.ID), 10),
+		"src=" + cefValue(event.Actor),
+		"act=" + cefValue(event.Action),
+		"outcome=" + outcome(event),
+	}
+	if event.Method != "" {
+		ext = append(ext, "requestMethod="+cefValue(event.Method), "request="+cefValue(event.Path))
+	}
+	if event.StatusCode != 0 {
+		ext = append(ext, "cn1Label=statusCode", "cn1="+strconv.Itoa(event.StatusCode))
+	}
+	if event.Detail != "" {
+		ext = append(ext, "msg="+cefValue(event.Detail))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func cefHeader(value string) string {
+	return cefHeaderEscaper.Replace(value)
+}
+
+func cefValue(value string) string {
+	return cefValueEscaper.Replace(value)
+}
+
+// formatLEEF renders an event as an IBM QRadar LEEF 1.0 line with tab separated attributes:
+// LEEF:1.0|Vendor|Product|Version|EventID|attributes
+func formatLEEF(event *models.AdminAuditLog) string {
+	header := []string{
+		"LEEF:1.0",
+		leefHeader(vendor),
+		leefHeader(product),
+		leefHeader(version.Version),
+		leefHeader(event.Action),
+	}
+
+	attrs := []string{
+		"devTime=" + event.Timestamp.UTC().Format(leefTimeFormat),
+		"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS zzz",
+		"cat=admin_audit",
+		"sev=" + strconv.Itoa(cefSeverity(event)),
+		"src=" + leefValue(event.Actor),
+		"outcome=" + outcome(event),
+		"auditId=" + strconv.FormatUint(uint64(event.ID), 10),
+	}
+	if event.Method != "" {
+		attrs = append(attrs, "method="+leefValue(event.Method), "url="+leefValue(event.Path))
+	}
+	if event.StatusCode != 0 {
+		attrs = append(attrs, "statusCode="+strconv.Itoa(event.StatusCode))
+	}
+	if event.Detail != "" {
+		attrs = append(attrs, "msg="+leefValue(event.Detail))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(attrs, "\t")
+}
+
+var (
+	leefHeaderEscaper = strings.NewReplacer(`|`, `\|`, "\t", " ", "\r", " ", "\n", " ")
+	leefValueEscaper  = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+func leefHeader(value string) string {
+	return leefHeaderEscaper.Replace(value)
+}
+
+func leefValue(value string) string {
+	return leefValueEscaper.Replace(value)
+}
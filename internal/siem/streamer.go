@@ -0,0 +1,205 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// bufferSize is the number of events kept locally while the SIEM is slow or unavailable.
+	bufferSize     = 10000
+	batchSize      = 100
+	flushInterval  = 5 * time.Second
+	requestTimeout = 10 * time.Second
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 1 * time.Minute
+)
+
+// Streamer posts admin audit events to the SIEM in batches. Events are buffered locally so the
+// audit log writer never blocks on the SIEM; failed batches are retried with exponential backoff
+// while new events keep accumulating in the buffer, and events beyond the buffer are dropped.
+type Streamer struct {
+	url      string
+	format   string
+	client   *http.Client
+	metrics  *metrics.Metrics
+	queue    chan models.AdminAuditLog
+	dropped  atomic.Int64
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewStreamer creates a new Streamer. The streamer is disabled when SIEM_STREAM_URL is not set.
+func NewStreamer(configManager types.ConfigManager, appMetrics *metrics.Metrics) *Streamer {
+	serverConfig := configManager.GetEffectiveServerConfig()
+	s := &Streamer{
+		url:      serverConfig.SIEMStreamURL,
+		format:   serverConfig.SIEMStreamFormat,
+		client:   &http.Client{Timeout: requestTimeout},
+		metrics:  appMetrics,
+		stopChan: make(chan struct{}),
+	}
+	if s.Enabled() {
+		s.queue = make(chan models.AdminAuditLog, bufferSize)
+	}
+	return s
+}
+
+// Enabled reports whether the SIEM stream is configured.
+func (s *Streamer) Enabled() bool {
+	return s.url != ""
+}
+
+// Start starts the batch delivery loop.
+func (s *Streamer) Start() {
+	if !s.Enabled() {
+		return
+	}
+	s.wg.Add(1)
+	go s.runLoop()
+	logrus.Debugf("SIEM streamer started (%s)", s.format)
+}
+
+// Stop stops the delivery loop after a final attempt to deliver the buffered events.
+func (s *Streamer) Stop(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+	close(s.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("SIEM streamer stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("SIEM streamer stop timed out.")
+	}
+}
+
+// Enqueue submits an audit event for delivery without blocking. Events are dropped when the buffer is full.
+func (s *Streamer) Enqueue(event models.AdminAuditLog) {
+	if !s.Enabled() {
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		if dropped := s.dropped.Add(1); dropped%1000 == 1 {
+			logrus.Warnf("SIEM streamer: buffer is full, %d audit events dropped so far", dropped)
+		}
+	}
+}
+
+func (s *Streamer) runLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.AdminAuditLog, 0, batchSize)
+	flush := func(retry bool) {
+		if len(batch) > 0 {
+			s.deliver(batch, retry)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush(true)
+			}
+		case <-ticker.C:
+			flush(true)
+		case <-s.stopChan:
+			// 关闭时每批只尝试一次，不再退避重试
+			for {
+				select {
+				case event := <-s.queue:
+					batch = append(batch, event)
+					if len(batch) >= batchSize {
+						flush(false)
+					}
+				default:
+					flush(false)
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver posts a batch to the SIEM. With retry set, failed attempts are retried with exponential
+// backoff until they succeed or the streamer is stopped.
+func (s *Streamer) deliver(batch []models.AdminAuditLog, retry bool) {
+	payload, contentType, err := Encode(s.format, batch)
+	if err != nil {
+		logrus.Warnf("SIEM streamer: failed to encode %d audit events: %v", len(batch), err)
+		return
+	}
+
+	backoff := initialBackoff
+	for {
+		err := s.post(payload, contentType)
+		if err == nil {
+			s.metrics.SIEMEventsSent.Add(float64(len(batch)))
+			logrus.Debugf("SIEM streamer: delivered %d audit events", len(batch))
+			return
+		}
+		s.metrics.SIEMSendErrors.Inc()
+
+		if !retry {
+			logrus.Warnf("SIEM streamer: failed to deliver %d audit events, dropping them: %v", len(batch), err)
+			return
+		}
+		logrus.Warnf("SIEM streamer: failed to deliver %d audit events, retrying in %s: %v", len(batch), backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-s.stopChan:
+			retry = false
+			continue
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// post sends one payload to the SIEM endpoint.
+func (s *Streamer) post(payload []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"fmt"
+	"gpt-load/internal/clock"
 	"gpt-load/internal/types"
 
 	"github.com/redis/go-redis/v9"
@@ -10,7 +11,7 @@ import (
 )
 
 // NewStore creates a new store based on the application configuration.
-func NewStore(cfg types.ConfigManager) (Store, error) {
+func NewStore(cfg types.ConfigManager, clk clock.Clock) (Store, error) {
 	redisDSN := cfg.GetRedisDSN()
 	if redisDSN != "" {
 		opts, err := redis.ParseURL(redisDSN)
@@ -28,5 +29,5 @@ func NewStore(cfg types.ConfigManager) (Store, error) {
 	}
 
 	logrus.Info("Redis DSN not configured, falling back to in-memory store.")
-	return NewMemoryStore(), nil
+	return NewMemoryStore(clk), nil
 }
@@ -5,6 +5,8 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"gpt-load/internal/clock"
 )
 
 // memoryStoreItem holds the value and expiration timestamp for a key.
@@ -15,6 +17,7 @@ type memoryStoreItem struct {
 
 // MemoryStore is an in-memory key-value store that is safe for concurrent use.
 type MemoryStore struct {
+	clock         clock.Clock
 	mu            sync.RWMutex
 	data          map[string]any
 	muSubscribers sync.RWMutex
@@ -22,8 +25,9 @@ type MemoryStore struct {
 }
 
 // NewMemoryStore creates and returns a new MemoryStore instance.
-func NewMemoryStore() *MemoryStore {
+func NewMemoryStore(clk clock.Clock) *MemoryStore {
 	s := &MemoryStore{
+		clock:       clk,
 		data:        make(map[string]any),
 		subscribers: make(map[string]map[chan *Message]struct{}),
 	}
@@ -42,7 +46,7 @@ func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
 
 	var expiresAt int64
 	if ttl > 0 {
-		expiresAt = time.Now().UnixNano() + ttl.Nanoseconds()
+		expiresAt = s.clock.Now().UnixNano() + ttl.Nanoseconds()
 	}
 
 	s.data[key] = memoryStoreItem{
@@ -67,7 +71,7 @@ func (s *MemoryStore) Get(key string) ([]byte, error) {
 		return nil, fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
 	}
 
-	if item.expiresAt > 0 && time.Now().UnixNano() > item.expiresAt {
+	if item.expiresAt > 0 && s.clock.Now().UnixNano() > item.expiresAt {
 		s.mu.Lock()
 		delete(s.data, key)
 		s.mu.Unlock()
@@ -106,7 +110,7 @@ func (s *MemoryStore) Exists(key string) (bool, error) {
 	}
 
 	if item, ok := rawItem.(memoryStoreItem); ok {
-		if item.expiresAt > 0 && time.Now().UnixNano() > item.expiresAt {
+		if item.expiresAt > 0 && s.clock.Now().UnixNano() > item.expiresAt {
 			s.mu.Lock()
 			delete(s.data, key)
 			s.mu.Unlock()
@@ -125,7 +129,7 @@ func (s *MemoryStore) SetNX(key string, value []byte, ttl time.Duration) (bool,
 	rawItem, exists := s.data[key]
 	if exists {
 		if item, ok := rawItem.(memoryStoreItem); ok {
-			if item.expiresAt == 0 || time.Now().UnixNano() < item.expiresAt {
+			if item.expiresAt == 0 || s.clock.Now().UnixNano() < item.expiresAt {
 				return false, nil
 			}
 		} else {
@@ -137,7 +141,7 @@ func (s *MemoryStore) SetNX(key string, value []byte, ttl time.Duration) (bool,
 	// Key does not exist or is expired, so we can set it.
 	var expiresAt int64
 	if ttl > 0 {
-		expiresAt = time.Now().UnixNano() + ttl.Nanoseconds()
+		expiresAt = s.clock.Now().UnixNano() + ttl.Nanoseconds()
 	}
 	s.data[key] = memoryStoreItem{
 		value:     value,
@@ -219,20 +223,38 @@ func (s *MemoryStore) HIncrBy(key, field string, incr int64) (int64, error) {
 
 // --- LIST operations ---
 
+// memoryList is a ring of list items whose logical order is items[head:] followed by items[:head].
+// Rotate only moves the head, so key selection stays O(1) however many keys a group has.
+type memoryList struct {
+	items []string
+	head  int
+}
+
+// values returns the items in logical order.
+func (l *memoryList) values() []string {
+	return append(append(make([]string, 0, len(l.items)), l.items[l.head:]...), l.items[:l.head]...)
+}
+
+// getList returns the list stored at key. Must be called with s.mu held.
+func (s *MemoryStore) getList(key string) (*memoryList, error) {
+	rawList, exists := s.data[key]
+	if !exists {
+		return nil, nil
+	}
+	list, ok := rawList.(*memoryList)
+	if !ok {
+		return nil, fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
+	}
+	return list, nil
+}
+
 func (s *MemoryStore) LPush(key string, values ...any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var list []string
-	rawList, exists := s.data[key]
-	if !exists {
-		list = make([]string, 0)
-	} else {
-		var ok bool
-		list, ok = rawList.([]string)
-		if !ok {
-			return fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
-		}
+	list, err := s.getList(key)
+	if err != nil {
+		return err
 	}
 
 	strValues := make([]string, len(values))
@@ -240,7 +262,10 @@ func (s *MemoryStore) LPush(key string, values ...any) error {
 		strValues[i] = fmt.Sprint(v)
 	}
 
-	s.data[key] = append(strValues, list...) // Prepend
+	if list != nil {
+		strValues = append(strValues, list.values()...) // Prepend
+	}
+	s.data[key] = &memoryList{items: strValues}
 	return nil
 }
 
@@ -248,29 +273,23 @@ func (s *MemoryStore) LRem(key string, count int64, value any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rawList, exists := s.data[key]
-	if !exists {
-		return nil
-	}
-
-	list, ok := rawList.([]string)
-	if !ok {
-		return fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
+	list, err := s.getList(key)
+	if err != nil || list == nil {
+		return err
 	}
 
-	strValue := fmt.Sprint(value)
-	newList := make([]string, 0, len(list))
-
 	if count != 0 {
 		return fmt.Errorf("LRem with non-zero count is not implemented in MemoryStore")
 	}
 
-	for _, item := range list {
+	strValue := fmt.Sprint(value)
+	newList := make([]string, 0, len(list.items))
+	for _, item := range list.values() {
 		if item != strValue {
 			newList = append(newList, item)
 		}
 	}
-	s.data[key] = newList
+	s.data[key] = &memoryList{items: newList}
 	return nil
 }
 
@@ -278,28 +297,65 @@ func (s *MemoryStore) Rotate(key string) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rawList, exists := s.data[key]
-	if !exists {
+	list, err := s.getList(key)
+	if err != nil {
+		return "", err
+	}
+	if list == nil || len(list.items) == 0 {
 		return "", ErrNotFound
 	}
 
-	list, ok := rawList.([]string)
-	if !ok {
-		return "", fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
-	}
+	// Equivalent to RPOPLPUSH on the same list: the last item becomes the first.
+	list.head = (list.head + len(list.items) - 1) % len(list.items)
+	return list.items[list.head], nil
+}
 
-	if len(list) == 0 {
+// WeightedRotate picks an item of the list by smooth weighted round-robin under the store lock.
+func (s *MemoryStore) WeightedRotate(listKey, weightsKey, stateKey string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.getList(listKey)
+	if err != nil {
+		return "", err
+	}
+	if list == nil || len(list.items) == 0 {
 		return "", ErrNotFound
 	}
 
-	lastIndex := len(list) - 1
-	item := list[lastIndex]
+	weights, _ := s.data[weightsKey].(map[string]string)
+	state, _ := s.data[stateKey].(map[string]string)
 
-	// "LPUSH"
-	newList := append([]string{item}, list[:lastIndex]...)
-	s.data[key] = newList
+	// 仅保留列表中仍存在的项，已移除的项的累计权重随之丢弃
+	next := make(map[string]string, len(list.items))
+	var best string
+	var bestCurrent, total int64
+	for _, item := range list.values() {
+		if _, seen := next[item]; seen {
+			continue
+		}
+		weight, err := strconv.ParseInt(weights[item], 10, 64)
+		if err != nil {
+			weight = 1
+		}
+		if weight <= 0 {
+			continue
+		}
+		current, _ := strconv.ParseInt(state[item], 10, 64)
+		current += weight
+		total += weight
+		next[item] = strconv.FormatInt(current, 10)
+		if best == "" || current > bestCurrent {
+			best, bestCurrent = item, current
+		}
+	}
+	if best == "" {
+		return "", ErrNotFound
+	}
 
-	return item, nil
+	next[best] = strconv.FormatInt(bestCurrent-total, 10)
+	s.data[stateKey] = next
+	return best, nil
 }
 
 // --- SET operations ---
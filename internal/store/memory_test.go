@@ -0,0 +1,342 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/clock"
+)
+
+func TestMemoryStoreTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		advance    time.Duration
+		wantExists bool
+	}{
+		{name: "no ttl never expires", ttl: 0, advance: 24 * time.Hour, wantExists: true},
+		{name: "before expiry", ttl: time.Minute, advance: 59 * time.Second, wantExists: true},
+		{name: "at expiry", ttl: time.Minute, advance: time.Minute, wantExists: true},
+		{name: "after expiry", ttl: time.Minute, advance: time.Minute + time.Nanosecond, wantExists: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			s := NewMemoryStore(fake)
+			if err := s.Set("key", []byte("value"), tt.ttl); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			fake.Advance(tt.advance)
+
+			exists, err := s.Exists("key")
+			if err != nil {
+				t.Fatalf("Exists: %v", err)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("Exists = %v, want %v", exists, tt.wantExists)
+			}
+			value, err := s.Get("key")
+			if tt.wantExists {
+				if err != nil || string(value) != "value" {
+					t.Errorf("Get = (%q, %v), want (\"value\", nil)", value, err)
+				}
+			} else if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSetNXAfterExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewMemoryStore(fake)
+
+	steps := []struct {
+		advance time.Duration
+		wantSet bool
+	}{
+		{advance: 0, wantSet: true},
+		{advance: 30 * time.Second, wantSet: false},
+		{advance: 31 * time.Second, wantSet: true},
+	}
+	for i, step := range steps {
+		fake.Advance(step.advance)
+		set, err := s.SetNX("lock", []byte("owner"), time.Minute)
+		if err != nil {
+			t.Fatalf("step %d: SetNX: %v", i, err)
+		}
+		if set != step.wantSet {
+			t.Errorf("step %d: SetNX = %v, want %v", i, set, step.wantSet)
+		}
+	}
+}
+
+// sliceList is the plain slice behaviour the ring-backed list must match: LPush prepends the
+// values in order, LRem with count 0 removes every occurrence and Rotate moves the last item
+// to the front and returns it, like RPOPLPUSH on the same list.
+type sliceList []string
+
+func (l *sliceList) lpush(values ...string) {
+	*l = append(append([]string{}, values...), *l...)
+}
+
+func (l *sliceList) lrem(value string) {
+	kept := (*l)[:0:0]
+	for _, item := range *l {
+		if item != value {
+			kept = append(kept, item)
+		}
+	}
+	*l = kept
+}
+
+func (l *sliceList) rotate() string {
+	last := (*l)[len(*l)-1]
+	*l = append([]string{last}, (*l)[:len(*l)-1]...)
+	return last
+}
+
+func TestMemoryStoreRotateStaysConsistentAfterUpdates(t *testing.T) {
+	type op struct {
+		kind  string // push, rem or rotate
+		value string
+	}
+	tests := []struct {
+		name string
+		ops  []op
+	}{
+		{
+			name: "rotate cycles through every key",
+			ops: []op{
+				{kind: "push", value: "k1"}, {kind: "push", value: "k2"}, {kind: "push", value: "k3"},
+				{kind: "rotate"}, {kind: "rotate"}, {kind: "rotate"}, {kind: "rotate"},
+			},
+		},
+		{
+			name: "key disabled mid rotation",
+			ops: []op{
+				{kind: "push", value: "k1"}, {kind: "push", value: "k2"}, {kind: "push", value: "k3"}, {kind: "push", value: "k4"},
+				{kind: "rotate"}, {kind: "rem", value: "k2"}, {kind: "rotate"}, {kind: "rotate"}, {kind: "rotate"},
+			},
+		},
+		{
+			name: "key restored after being disabled",
+			ops: []op{
+				{kind: "push", value: "k1"}, {kind: "push", value: "k2"}, {kind: "push", value: "k3"},
+				{kind: "rotate"}, {kind: "rem", value: "k1"}, {kind: "rotate"}, {kind: "push", value: "k1"},
+				{kind: "rotate"}, {kind: "rotate"}, {kind: "rotate"},
+			},
+		},
+		{
+			name: "removing the head key",
+			ops: []op{
+				{kind: "push", value: "k1"}, {kind: "push", value: "k2"}, {kind: "push", value: "k3"},
+				{kind: "rotate"}, {kind: "rotate"}, {kind: "rem", value: "k3"}, {kind: "rotate"}, {kind: "rotate"},
+			},
+		},
+		{
+			name: "all keys removed and readded",
+			ops: []op{
+				{kind: "push", value: "k1"}, {kind: "push", value: "k2"}, {kind: "rotate"},
+				{kind: "rem", value: "k1"}, {kind: "rem", value: "k2"}, {kind: "rotate"},
+				{kind: "push", value: "k2"}, {kind: "rotate"}, {kind: "rotate"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(clock.New())
+			var want sliceList
+			for i, op := range tt.ops {
+				switch op.kind {
+				case "push":
+					if err := s.LPush("active", op.value); err != nil {
+						t.Fatalf("op %d: LPush: %v", i, err)
+					}
+					want.lpush(op.value)
+				case "rem":
+					if err := s.LRem("active", 0, op.value); err != nil {
+						t.Fatalf("op %d: LRem: %v", i, err)
+					}
+					want.lrem(op.value)
+				case "rotate":
+					got, err := s.Rotate("active")
+					if len(want) == 0 {
+						if !errors.Is(err, ErrNotFound) {
+							t.Fatalf("op %d: Rotate on empty list = (%q, %v), want ErrNotFound", i, got, err)
+						}
+						continue
+					}
+					if err != nil {
+						t.Fatalf("op %d: Rotate: %v", i, err)
+					}
+					if wantKey := want.rotate(); got != wantKey {
+						t.Fatalf("op %d: Rotate = %q, want %q", i, got, wantKey)
+					}
+				}
+
+				s.mu.RLock()
+				list, _ := s.getList("active")
+				var values []string
+				if list != nil {
+					values = list.values()
+				}
+				s.mu.RUnlock()
+				if strings.Join(values, ",") != strings.Join(want, ",") {
+					t.Fatalf("op %d (%s %s): list = %v, want %v", i, op.kind, op.value, values, []string(want))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMemoryStoreRotate shows that selecting the next key takes the same time however many
+// keys the group has.
+func BenchmarkMemoryStoreRotate(b *testing.B) {
+	for _, keys := range []int{10, 1000, 100000} {
+		b.Run(fmt.Sprintf("keys=%d", keys), func(b *testing.B) {
+			s := NewMemoryStore(clock.New())
+			values := make([]any, keys)
+			for i := range values {
+				values[i] = i
+			}
+			if err := s.LPush("active", values...); err != nil {
+				b.Fatalf("LPush: %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Rotate("active"); err != nil {
+					b.Fatalf("Rotate: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreWeightedRotate(t *testing.T) {
+	tests := []struct {
+		name      string
+		items     []string
+		weights   map[string]any
+		wantCount map[string]int // 每个周期（权重之和次选择）中各项被选中的次数
+		wantErr   error
+	}{
+		{
+			name:      "missing weights weigh 1",
+			items:     []string{"k1", "k2", "k3"},
+			wantCount: map[string]int{"k1": 1, "k2": 1, "k3": 1},
+		},
+		{
+			name:      "weights set the share",
+			items:     []string{"k1", "k2", "k3"},
+			weights:   map[string]any{"k1": 5, "k2": 1, "k3": 2},
+			wantCount: map[string]int{"k1": 5, "k2": 1, "k3": 2},
+		},
+		{
+			name:      "zero weight is never selected",
+			items:     []string{"k1", "k2", "k3"},
+			weights:   map[string]any{"k1": 0, "k2": 3},
+			wantCount: map[string]int{"k2": 3, "k3": 1},
+		},
+		{
+			name:      "non-numeric weight weighs 1",
+			items:     []string{"k1", "k2"},
+			weights:   map[string]any{"k1": "", "k2": 2},
+			wantCount: map[string]int{"k1": 1, "k2": 2},
+		},
+		{
+			name:    "all weights zero",
+			items:   []string{"k1", "k2"},
+			weights: map[string]any{"k1": 0, "k2": 0},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "empty list",
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(clock.New())
+			for _, item := range tt.items {
+				if err := s.LPush("active", item); err != nil {
+					t.Fatalf("LPush: %v", err)
+				}
+			}
+			if len(tt.weights) > 0 {
+				if err := s.HSet("weights", tt.weights); err != nil {
+					t.Fatalf("HSet: %v", err)
+				}
+			}
+
+			total := 0
+			for _, n := range tt.wantCount {
+				total += n
+			}
+			if tt.wantErr != nil {
+				if _, err := s.WeightedRotate("active", "weights", "state"); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("WeightedRotate error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			// 平滑加权轮询以权重之和为周期，每个周期的分布相同
+			for cycle := 0; cycle < 3; cycle++ {
+				got := make(map[string]int)
+				for i := 0; i < total; i++ {
+					item, err := s.WeightedRotate("active", "weights", "state")
+					if err != nil {
+						t.Fatalf("WeightedRotate: %v", err)
+					}
+					got[item]++
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tt.wantCount) {
+					t.Fatalf("cycle %d: selections = %v, want %v", cycle, got, tt.wantCount)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreWeightedRotateDropsRemovedItems(t *testing.T) {
+	s := NewMemoryStore(clock.New())
+	for _, item := range []string{"k1", "k2"} {
+		if err := s.LPush("active", item); err != nil {
+			t.Fatalf("LPush: %v", err)
+		}
+	}
+	if err := s.HSet("weights", map[string]any{"k1": 3}); err != nil {
+		t.Fatalf("HSet: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.WeightedRotate("active", "weights", "state"); err != nil {
+			t.Fatalf("WeightedRotate: %v", err)
+		}
+	}
+
+	if err := s.LRem("active", 0, "k1"); err != nil {
+		t.Fatalf("LRem: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		item, err := s.WeightedRotate("active", "weights", "state")
+		if err != nil || item != "k2" {
+			t.Fatalf("WeightedRotate = %q, %v, want k2", item, err)
+		}
+	}
+	state, err := s.HGetAll("state")
+	if err != nil {
+		t.Fatalf("HGetAll: %v", err)
+	}
+	if _, ok := state["k1"]; ok {
+		t.Errorf("state of the removed item was kept: %v", state)
+	}
+}
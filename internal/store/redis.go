@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -69,6 +70,11 @@ func (s *RedisStore) Close() error {
 	return s.client.Close()
 }
 
+// Ping checks that Redis is reachable.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 // --- HASH operations ---
 
 func (s *RedisStore) HSet(key string, values map[string]any) error {
@@ -104,6 +110,58 @@ func (s *RedisStore) Rotate(key string) (string, error) {
 	return val, nil
 }
 
+// weightedRotateScript implements smooth weighted round-robin over the list KEYS[1], with the
+// weights in the HASH KEYS[2] and the running weights in the HASH KEYS[3].
+var weightedRotateScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+local weights = {}
+local raw = redis.call('HGETALL', KEYS[2])
+for i = 1, #raw, 2 do weights[raw[i]] = raw[i + 1] end
+local state = {}
+raw = redis.call('HGETALL', KEYS[3])
+for i = 1, #raw, 2 do state[raw[i]] = raw[i + 1] end
+
+local best, bestCurrent, total = nil, 0, 0
+local next = {}
+for _, item in ipairs(items) do
+  local weight = tonumber(weights[item]) or 1
+  if weight > 0 and next[item] == nil then
+    local current = (tonumber(state[item]) or 0) + weight
+    total = total + weight
+    next[item] = current
+    if best == nil or current > bestCurrent then
+      best, bestCurrent = item, current
+    end
+  end
+end
+if best == nil then
+  return false
+end
+next[best] = bestCurrent - total
+
+redis.call('DEL', KEYS[3])
+local args = {}
+for item, current in pairs(next) do
+  args[#args + 1] = item
+  args[#args + 1] = current
+end
+redis.call('HSET', KEYS[3], unpack(args))
+return best
+`)
+
+// WeightedRotate picks an item of the list by smooth weighted round-robin in a Lua script,
+// so concurrent selections from several instances stay consistent.
+func (s *RedisStore) WeightedRotate(listKey, weightsKey, stateKey string) (string, error) {
+	val, err := weightedRotateScript.Run(context.Background(), s.client, []string{listKey, weightsKey, stateKey}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return val, nil
+}
+
 // --- SET operations ---
 
 func (s *RedisStore) SAdd(key string, members ...any) error {
@@ -138,6 +196,69 @@ func (s *RedisStore) Pipeline() Pipeliner {
 	}
 }
 
+// --- Stream operations ---
+
+// XAdd appends an entry to a stream.
+func (s *RedisStore) XAdd(stream string, maxLen int64, values map[string]any) error {
+	args := &redis.XAddArgs{Stream: stream, Values: values}
+	if maxLen > 0 {
+		args.MaxLen = maxLen
+		args.Approx = true
+	}
+	return s.client.XAdd(context.Background(), args).Err()
+}
+
+// XGroupCreate creates a consumer group starting at new entries.
+func (s *RedisStore) XGroupCreate(stream, group string) error {
+	err := s.client.XGroupCreateMkStream(context.Background(), stream, group, "$").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// XGroupDestroy removes a consumer group.
+func (s *RedisStore) XGroupDestroy(stream, group string) error {
+	return s.client.XGroupDestroy(context.Background(), stream, group).Err()
+}
+
+// XReadGroup reads new entries for a consumer of a group.
+func (s *RedisStore) XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var messages []StreamMessage
+	for _, st := range streams {
+		for _, msg := range st.Messages {
+			values := make(map[string]string, len(msg.Values))
+			for field, value := range msg.Values {
+				values[field] = fmt.Sprint(value)
+			}
+			messages = append(messages, StreamMessage{ID: msg.ID, Values: values})
+		}
+	}
+	return messages, nil
+}
+
+// XAck acknowledges processed entries.
+func (s *RedisStore) XAck(stream, group string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.client.XAck(context.Background(), stream, group, ids...).Err()
+}
+
 // --- Pub/Sub operations ---
 
 // redisSubscription wraps the redis.PubSub to implement the Subscription interface.
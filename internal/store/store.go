@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -49,6 +50,11 @@ type Store interface {
 	LPush(key string, values ...any) error
 	LRem(key string, count int64, value any) error
 	Rotate(key string) (string, error)
+	// WeightedRotate atomically picks an item of the list by smooth weighted round-robin.
+	// Item weights are read from the weightsKey HASH, where a missing or non-numeric field
+	// weighs 1 and a weight of 0 excludes the item; the running weights are kept in the
+	// stateKey HASH. It returns ErrNotFound when no item has a positive weight.
+	WeightedRotate(listKey, weightsKey, stateKey string) (string, error)
 
 	// SET operations
 	SAdd(key string, members ...any) error
@@ -74,3 +80,36 @@ type Pipeliner interface {
 type RedisPipeliner interface {
 	Pipeline() Pipeliner
 }
+
+// Pinger is an optional interface that a Store backed by an external service implements to
+// check that the service is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// StreamMessage is an entry read from a stream.
+type StreamMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// StreamStore is an optional interface that a Store can implement to provide append-only
+// streams read through consumer groups, as Redis Streams do.
+type StreamStore interface {
+	// XAdd appends an entry, trimming the stream to about maxLen entries when maxLen is positive.
+	XAdd(stream string, maxLen int64, values map[string]any) error
+
+	// XGroupCreate creates a consumer group that reads entries added from now on, creating the
+	// stream if needed. It succeeds if the group already exists.
+	XGroupCreate(stream, group string) error
+
+	// XGroupDestroy removes a consumer group.
+	XGroupDestroy(stream, group string) error
+
+	// XReadGroup reads up to count new entries for the consumer, waiting up to block for one to arrive.
+	// It returns no entries and no error when none arrived in time.
+	XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error)
+
+	// XAck acknowledges entries processed by the group.
+	XAck(stream, group string, ids ...string) error
+}
@@ -66,6 +66,12 @@ func (s *CacheSyncer[T]) Invalidate() error {
 	return s.store.Publish(s.channelName, []byte("reload"))
 }
 
+// Reload reloads the local cache synchronously, so that a change just written to the source
+// of truth is visible to Get before Invalidate reaches the other instances.
+func (s *CacheSyncer[T]) Reload() error {
+	return s.reload()
+}
+
 // Stop gracefully shuts down the syncer's background goroutine.
 func (s *CacheSyncer[T]) Stop() {
 	close(s.stopChan)
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthorizeAdminKey matches key against the admin keys and checks the source IP allowlist of
+// the matched entry. Every key is compared in constant time. A valid key used from a source
+// outside its allowlist is logged with the key's label, and reported as valid but not allowed.
+func AuthorizeAdminKey(authConfig types.AuthConfig, key, clientIP string) (valid, ipAllowed bool) {
+	if key == "" {
+		return false, false
+	}
+	matched := -1
+	for i, entry := range authConfig.Entries {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(entry.Key)) == 1 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return false, false
+	}
+
+	entry := authConfig.Entries[matched]
+	if len(entry.AllowedNets) == 0 || IPInAllowlist(clientIP, entry.AllowedNets) {
+		return true, true
+	}
+	logrus.WithFields(logrus.Fields{
+		"source_ip":  clientIP,
+		"key":        adminKeyLabel(matched, len(authConfig.Entries)),
+		"key_masked": RedactAPIKey(key),
+	}).Warn("Rejected a valid admin key used from an IP outside its allowed IPs")
+	return true, false
+}
+
+// adminKeyLabel 返回密钥在 AUTH_KEY 中的位置，轮换期间配置了多个密钥时可区分新旧密钥
+func adminKeyLabel(index, count int) string {
+	if count == 1 {
+		return "AUTH_KEY"
+	}
+	return fmt.Sprintf("AUTH_KEY[%d]", index)
+}
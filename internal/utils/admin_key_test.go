@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthorizeAdminKey(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.StandardLogger()
+	output, formatter, level := logger.Out, logger.Formatter, logger.GetLevel()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+	logger.SetLevel(logrus.InfoLevel)
+	t.Cleanup(func() {
+		logger.SetOutput(output)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(level)
+	})
+
+	entry := func(key string, allowedIPs ...string) types.AuthKeyEntry {
+		nets, err := ParseIPAllowlist(allowedIPs)
+		if err != nil {
+			t.Fatalf("ParseIPAllowlist(%v) error = %v", allowedIPs, err)
+		}
+		return types.AuthKeyEntry{Key: key, AllowedIPs: allowedIPs, AllowedNets: nets}
+	}
+	single := types.AuthConfig{Entries: []types.AuthKeyEntry{entry("admin-key-current", "10.0.0.0/8")}}
+	rotated := types.AuthConfig{Entries: []types.AuthKeyEntry{
+		entry("admin-key-current"),
+		entry("admin-key-previous", "10.0.0.0/8", "192.168.1.10"),
+	}}
+
+	tests := []struct {
+		name          string
+		authConfig    types.AuthConfig
+		key           string
+		clientIP      string
+		wantValid     bool
+		wantIPAllowed bool
+		wantLog       []string // 为空时不应记录日志
+	}{
+		{name: "empty key", authConfig: single, clientIP: "10.0.0.1"},
+		{name: "unknown key", authConfig: single, key: "admin-key-other", clientIP: "10.0.0.1"},
+		{name: "allowed source", authConfig: single, key: "admin-key-current", clientIP: "10.0.0.1", wantValid: true, wantIPAllowed: true},
+		{
+			name: "single key from elsewhere", authConfig: single, key: "admin-key-current", clientIP: "192.0.2.10", wantValid: true,
+			wantLog: []string{"key=AUTH_KEY ", `key_masked="admi****rent"`, "source_ip=192.0.2.10"},
+		},
+		{name: "unrestricted entry", authConfig: rotated, key: "admin-key-current", clientIP: "192.0.2.10", wantValid: true, wantIPAllowed: true},
+		{name: "restricted entry from allowed address", authConfig: rotated, key: "admin-key-previous", clientIP: "192.168.1.10", wantValid: true, wantIPAllowed: true},
+		{
+			name: "restricted entry from elsewhere", authConfig: rotated, key: "admin-key-previous", clientIP: "192.168.1.11", wantValid: true,
+			wantLog: []string{`key="AUTH_KEY[1]"`, `key_masked="admi****ious"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			valid, ipAllowed := AuthorizeAdminKey(tt.authConfig, tt.key, tt.clientIP)
+			if valid != tt.wantValid || ipAllowed != tt.wantIPAllowed {
+				t.Errorf("AuthorizeAdminKey() = %v, %v, want %v, %v", valid, ipAllowed, tt.wantValid, tt.wantIPAllowed)
+			}
+
+			line := buf.String()
+			if len(tt.wantLog) == 0 && line != "" {
+				t.Errorf("unexpected log %q", line)
+			}
+			for _, want := range tt.wantLog {
+				if !strings.Contains(line, want) {
+					t.Errorf("log %q does not contain %q", line, want)
+				}
+			}
+			if tt.key != "" && strings.Contains(line, tt.key) {
+				t.Errorf("log %q contains the key", line)
+			}
+		})
+	}
+}
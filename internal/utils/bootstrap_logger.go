@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxBootstrapEntries 是启动阶段保留的日志条数上限，超出后丢弃最早的条目
+const maxBootstrapEntries = 200
+
+// bootstrapLog 保存 SetupLogger 接管前记录的日志，接管后写入配置的日志文件
+var bootstrapLog struct {
+	sync.Mutex
+	active  bool
+	entries []*logrus.Entry
+}
+
+// SetupBootstrapLogger configures logging for startup, before the configuration is loaded. Entries
+// go to stderr regardless of SILENT_MODE, so early failures such as an invalid configuration are
+// always visible, and are kept until SetupLogger hands off to the configured logger, which
+// copies them into the log file when file logging is enabled.
+// 配置尚未加载，日志级别和格式只读取进程环境变量中的 LOG_LEVEL 和 LOG_FORMAT
+func SetupBootstrapLogger() {
+	level, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+	logrus.SetFormatter(logFormatter(strings.ToLower(os.Getenv("LOG_FORMAT"))))
+	logrus.SetOutput(os.Stderr)
+
+	bootstrapLog.Lock()
+	bootstrapLog.active = true
+	bootstrapLog.entries = nil
+	bootstrapLog.Unlock()
+	logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	logrus.AddHook(bootstrapHook{})
+}
+
+// BootstrapLoggerActive reports whether logging is still handled by the bootstrap logger.
+func BootstrapLoggerActive() bool {
+	bootstrapLog.Lock()
+	defer bootstrapLog.Unlock()
+	return bootstrapLog.active
+}
+
+// bootstrapHook 记录启动阶段的日志条目
+type bootstrapHook struct{}
+
+func (bootstrapHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (bootstrapHook) Fire(entry *logrus.Entry) error {
+	bootstrapLog.Lock()
+	defer bootstrapLog.Unlock()
+	if !bootstrapLog.active {
+		return nil
+	}
+	if len(bootstrapLog.entries) >= maxBootstrapEntries {
+		bootstrapLog.entries = bootstrapLog.entries[1:]
+	}
+	// Dup 不复制级别和消息
+	dup := entry.Dup()
+	dup.Level = entry.Level
+	dup.Message = entry.Message
+	bootstrapLog.entries = append(bootstrapLog.entries, dup)
+	return nil
+}
+
+// handOffBootstrapLog ends the bootstrap phase. The entries recorded during it are written to
+// fileWriter with the configured formatter, or dropped when file logging is disabled, since
+// they have already been written to stderr.
+func handOffBootstrapLog(fileWriter io.Writer) {
+	bootstrapLog.Lock()
+	entries := bootstrapLog.entries
+	bootstrapLog.active = false
+	bootstrapLog.entries = nil
+	bootstrapLog.Unlock()
+
+	if fileWriter == nil {
+		return
+	}
+	formatter := logrus.StandardLogger().Formatter
+	level := logrus.GetLevel()
+	for _, entry := range entries {
+		if entry.Level > level {
+			continue
+		}
+		line, err := formatter.Format(entry)
+		if err != nil {
+			continue
+		}
+		fileWriter.Write(line)
+	}
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// useBootstrapLogger starts the bootstrap phase on the standard logger with its output
+// discarded, and restores the logger when the test ends.
+func useBootstrapLogger(t *testing.T) {
+	t.Helper()
+	logger := logrus.StandardLogger()
+	output, formatter, level := logger.Out, logger.Formatter, logger.GetLevel()
+	hooks := make(logrus.LevelHooks)
+	for lvl, levelHooks := range logger.Hooks {
+		hooks[lvl] = append(hooks[lvl], levelHooks...)
+	}
+	t.Cleanup(func() {
+		handOffBootstrapLog(nil)
+		logger.SetOutput(output)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(level)
+		logger.ReplaceHooks(hooks)
+	})
+
+	SetupBootstrapLogger()
+	logger.SetOutput(io.Discard)
+}
+
+func TestSetupBootstrapLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantLevel logrus.Level
+		wantJSON  bool
+	}{
+		{name: "defaults", wantLevel: logrus.InfoLevel},
+		{name: "debug level", level: "debug", wantLevel: logrus.DebugLevel},
+		{name: "invalid level", level: "loud", wantLevel: logrus.InfoLevel},
+		{name: "json format", format: "JSON", wantLevel: logrus.InfoLevel, wantJSON: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", tt.level)
+			t.Setenv("LOG_FORMAT", tt.format)
+			useBootstrapLogger(t)
+
+			if !BootstrapLoggerActive() {
+				t.Error("bootstrap logger is not active")
+			}
+			if got := logrus.GetLevel(); got != tt.wantLevel {
+				t.Errorf("level = %v, want %v", got, tt.wantLevel)
+			}
+			if _, isJSON := logrus.StandardLogger().Formatter.(*logrus.JSONFormatter); isJSON != tt.wantJSON {
+				t.Errorf("JSON formatter = %v, want %v", isJSON, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestHandOffBootstrapLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     logrus.Level // 交接时配置的日志级别
+		toFile    bool
+		wantLines []string
+	}{
+		{name: "file logging at info", level: logrus.InfoLevel, toFile: true, wantLines: []string{"bootstrap info", "bootstrap warn"}},
+		{name: "file logging at warn", level: logrus.WarnLevel, toFile: true, wantLines: []string{"bootstrap warn"}},
+		{name: "file logging at debug", level: logrus.DebugLevel, toFile: true, wantLines: []string{"bootstrap debug", "bootstrap info", "bootstrap warn"}},
+		{name: "file logging disabled", level: logrus.InfoLevel, toFile: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", "debug")
+			t.Setenv("LOG_FORMAT", "")
+			useBootstrapLogger(t)
+
+			logrus.Debug("bootstrap debug")
+			logrus.Info("bootstrap info")
+			logrus.Warn("bootstrap warn")
+
+			logrus.SetLevel(tt.level)
+			logrus.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+			var file bytes.Buffer
+			var fileWriter io.Writer
+			if tt.toFile {
+				fileWriter = &file
+			}
+			handOffBootstrapLog(fileWriter)
+
+			if BootstrapLoggerActive() {
+				t.Error("bootstrap logger is still active after hand-off")
+			}
+			logrus.Warn("after hand-off")
+
+			var gotLines []string
+			for _, line := range strings.Split(strings.TrimSpace(file.String()), "\n") {
+				if line != "" {
+					gotLines = append(gotLines, line)
+				}
+			}
+			if len(gotLines) != len(tt.wantLines) {
+				t.Fatalf("file got %d lines, want %d:\n%s", len(gotLines), len(tt.wantLines), file.String())
+			}
+			for i, want := range tt.wantLines {
+				if !strings.Contains(gotLines[i], `msg="`+want+`"`) {
+					t.Errorf("line %d = %q, want message %q", i, gotLines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBootstrapLogDropsOldestEntries(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("LOG_FORMAT", "")
+	useBootstrapLogger(t)
+
+	const extra = 5
+	for i := range maxBootstrapEntries + extra {
+		logrus.WithField("n", i).Info(fmt.Sprintf("entry %d", i))
+	}
+
+	logrus.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+	var file bytes.Buffer
+	handOffBootstrapLog(&file)
+
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	if len(lines) != maxBootstrapEntries {
+		t.Fatalf("kept %d entries, want %d", len(lines), maxBootstrapEntries)
+	}
+	if first := fmt.Sprintf(`msg="entry %d" n=%d`, extra, extra); !strings.Contains(lines[0], first) {
+		t.Errorf("first kept entry = %q, want %q", lines[0], first)
+	}
+	if last := fmt.Sprintf(`msg="entry %d"`, maxBootstrapEntries+extra-1); !strings.Contains(lines[len(lines)-1], last) {
+		t.Errorf("last kept entry = %q, want %q", lines[len(lines)-1], last)
+	}
+}
@@ -1,11 +1,13 @@
 package utils
 
 import (
+	"crypto/tls"
 	"fmt"
 	"gpt-load/internal/models"
 	"gpt-load/internal/types"
 	"os"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -163,6 +165,42 @@ func ParseArray(value string, defaultValue []string) []string {
 	return result
 }
 
+// ParseFloatArray parses a comma-separated list of numbers, returning defaultValue for an empty value.
+func ParseFloatArray(value string, defaultValue []float64) ([]float64, error) {
+	parts := ParseArray(value, nil)
+	if len(parts) == 0 {
+		return defaultValue, nil
+	}
+
+	result := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		parsed, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", part)
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2" into its tls.Version* constant. An empty
+// value returns 0, which leaves the choice to crypto/tls.
+func ParseTLSVersion(value string) (uint16, error) {
+	switch strings.TrimSpace(value) {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("%q must be one of: 1.0, 1.1, 1.2, 1.3", value)
+}
+
 // GetEnvOrDefault gets environment variable or default value
 func GetEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -170,3 +208,47 @@ func GetEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetEnvOrFile gets a secret from the file named by <key>_FILE or from the environment variable.
+// 两者同时设置时以文件为准，并输出警告日志说明实际生效的来源。
+func GetEnvOrFile(key, defaultValue string) (string, error) {
+	fileKey := key + "_FILE"
+	filePath := os.Getenv(fileKey)
+	if filePath == "" {
+		return GetEnvOrDefault(key, defaultValue), nil
+	}
+
+	if os.Getenv(key) != "" {
+		logrus.Warnf("Both %s and %s are set; using %s (%s) and ignoring %s", key, fileKey, fileKey, filePath, key)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", fileKey, err)
+	}
+	if value := strings.TrimSpace(string(content)); value != "" {
+		return value, nil
+	}
+	return defaultValue, nil
+}
+
+// envPlaceholderPattern 匹配 ${VAR_NAME} 与 ${VAR_NAME:-default}
+var envPlaceholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ExpandVariables replaces ${VAR_NAME} and ${VAR_NAME:-default} placeholders in input with the
+// values returned by lookup. As in the shell, the default is used when the value is empty.
+func ExpandVariables(input string, lookup func(string) string) string {
+	return envPlaceholderPattern.ReplaceAllStringFunc(input, func(placeholder string) string {
+		match := envPlaceholderPattern.FindStringSubmatch(placeholder)
+		if value := lookup(match[1]); value != "" {
+			return value
+		}
+		return match[2]
+	})
+}
+
+// IsSQLiteDSN reports whether a DATABASE_DSN selects SQLite, i.e. it is neither a
+// PostgreSQL URL nor a MySQL DSN.
+func IsSQLiteDSN(dsn string) bool {
+	return !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") && !strings.Contains(dsn, "@tcp")
+}
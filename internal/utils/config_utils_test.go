@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetEnvOrFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	dsnFile := writeFile("dsn", "postgres://user:secret@db/app\n")
+	blankFile := writeFile("blank", " \n")
+
+	const defaultValue = "./data/gpt-load.db"
+	tests := []struct {
+		name    string
+		env     string
+		fileEnv string
+		want    string
+		wantErr string
+	}{
+		{name: "default", want: defaultValue},
+		{name: "env only", env: "mysql://env", want: "mysql://env"},
+		{name: "file only, trimmed", fileEnv: dsnFile, want: "postgres://user:secret@db/app"},
+		{name: "file takes precedence over env", env: "mysql://env", fileEnv: dsnFile, want: "postgres://user:secret@db/app"},
+		{name: "blank file falls back to default", env: "mysql://env", fileEnv: blankFile, want: defaultValue},
+		{name: "missing file", fileEnv: filepath.Join(dir, "missing"), wantErr: "failed to read TEST_DSN_FILE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DSN", tt.env)
+			t.Setenv("TEST_DSN_FILE", tt.fileEnv)
+
+			got, err := GetEnvOrFile("TEST_DSN", defaultValue)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetEnvOrFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetEnvOrFile() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetEnvOrFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
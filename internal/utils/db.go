@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Database dialects selected by DATABASE_DSN.
+const (
+	DialectSQLite   = "sqlite"
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+)
+
+// mysqlLikeDSN matches "user:pass@host/db" style DSNs that were meant for MySQL but lack
+// the protocol segment, so they would otherwise be opened as a SQLite file.
+var mysqlLikeDSN = regexp.MustCompile(`^[^/@]+@[^/]*/`)
+
+// ValidateDSN detects the dialect of a DATABASE_DSN the same way the database connection
+// does and checks that the DSN is well formed for it, so that a typo fails at startup with
+// a descriptive error instead of a raw driver error.
+func ValidateDSN(dsn string) (string, error) {
+	dsn = strings.TrimSpace(dsn)
+	switch {
+	case dsn == "":
+		return "", errors.New("DATABASE_DSN is required and cannot be empty")
+	case strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://"):
+		return DialectPostgres, validatePostgresDSN(dsn)
+	case strings.Contains(dsn, "@tcp"):
+		return DialectMySQL, validateMySQLDSN(dsn)
+	case strings.HasPrefix(dsn, "mysql://"):
+		return DialectMySQL, errors.New("invalid MySQL DSN: use the user:password@tcp(host:port)/dbname format instead of a mysql:// URL")
+	case mysqlLikeDSN.MatchString(dsn):
+		return DialectMySQL, errors.New("invalid MySQL DSN: missing @tcp(...) segment")
+	default:
+		return DialectSQLite, validateSQLiteDSN(dsn)
+	}
+}
+
+func validatePostgresDSN(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// url.Error 会带上完整 URL（含密码），只保留原因
+		return fmt.Errorf("invalid PostgreSQL URL: %w", errors.Unwrap(err))
+	}
+	if u.Hostname() == "" {
+		return errors.New("invalid PostgreSQL URL: missing host")
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return errors.New("invalid PostgreSQL URL: missing database name")
+	}
+	return nil
+}
+
+func validateMySQLDSN(dsn string) error {
+	start := strings.Index(dsn, "@tcp")
+	rest := dsn[start+len("@tcp"):]
+	if !strings.HasPrefix(rest, "(") {
+		return errors.New("invalid MySQL DSN: missing @tcp(...) segment")
+	}
+	end := strings.Index(rest, ")")
+	if end < 0 {
+		return errors.New("invalid MySQL DSN: unclosed @tcp(...) segment")
+	}
+	if strings.TrimSpace(rest[1:end]) == "" {
+		return errors.New("invalid MySQL DSN: empty address in @tcp(...) segment")
+	}
+	if !strings.HasPrefix(rest[end+1:], "/") {
+		return errors.New("invalid MySQL DSN: missing /dbname after @tcp(...)")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("invalid MySQL DSN: %w", err)
+	}
+	if cfg.DBName == "" {
+		return errors.New("invalid MySQL DSN: missing database name")
+	}
+	return nil
+}
+
+// validateSQLiteDSN checks that the database file can be created: the path must not be a
+// directory, and when the file does not exist yet its nearest existing parent directory
+// must be writable.
+func validateSQLiteDSN(dsn string) error {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == "" {
+		return errors.New("invalid SQLite DSN: missing database file path")
+	}
+	// 内存数据库无需检查文件
+	if path == ":memory:" || strings.Contains(dsn, "mode=memory") {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("invalid SQLite DSN: %s is a directory", path)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("invalid SQLite DSN: %w", err)
+	}
+
+	// 目录尚不存在时，启动时会逐级创建，检查最近一级已存在的目录
+	dir := filepath.Dir(path)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("invalid SQLite DSN: %s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("invalid SQLite DSN: %w", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".gpt-load-dsn-check-*")
+	if err != nil {
+		return fmt.Errorf("invalid SQLite DSN: directory %s is not writable", dir)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import "testing"
+
+func TestParseIPAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string // 解析后的网段
+		wantErr bool
+	}{
+		{name: "empty", entries: nil, want: []string{}},
+		{name: "ipv4 address", entries: []string{"10.0.0.1"}, want: []string{"10.0.0.1/32"}},
+		{name: "ipv6 address", entries: []string{"::1"}, want: []string{"::1/128"}},
+		{name: "cidr", entries: []string{"192.168.1.0/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "cidr host bits cleared", entries: []string{"192.168.1.7/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "blank entries skipped", entries: []string{" ", " 10.0.0.1 "}, want: []string{"10.0.0.1/32"}},
+		{name: "invalid address", entries: []string{"10.0.0.256"}, wantErr: true},
+		{name: "invalid cidr", entries: []string{"10.0.0.0/33"}, wantErr: true},
+		{name: "hostname", entries: []string{"prometheus.local"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := ParseIPAllowlist(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, 0, len(nets))
+			for _, n := range nets {
+				got = append(got, n.String())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseIPAllowlist() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseIPAllowlist() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIPInAllowlist(t *testing.T) {
+	nets, err := ParseIPAllowlist([]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseIPAllowlist: %v", err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "10.1.2.3", want: true},
+		{ip: "192.168.1.5", want: true},
+		{ip: "192.168.1.6", want: false},
+		{ip: "::ffff:10.1.2.3", want: true},
+		{ip: "fd12::1", want: true},
+		{ip: "fe80::1", want: false},
+		{ip: "not-an-ip", want: false},
+		{ip: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IPInAllowlist(tt.ip, nets); got != tt.want {
+				t.Errorf("IPInAllowlist(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// rotatedFileCompressWait 等待轮转文件压缩完成的最长时间，超时后仍以未压缩的路径执行命令
+	rotatedFileCompressWait = time.Minute
+	rotatedFilePollInterval = 500 * time.Millisecond
+)
+
+// rotatingLogWriter writes to a lumberjack logger and rotates it itself once the file would
+// exceed its maximum size, so that the post-rotation command runs for every rotated file.
+type rotatingLogWriter struct {
+	mu       sync.Mutex
+	logger   *lumberjack.Logger
+	maxBytes int64
+	size     int64
+	postCmd  string
+}
+
+// newRotatingLogWriter opens the log file of the configuration with size-based rotation.
+func newRotatingLogWriter(logConfig types.LogConfig) *rotatingLogWriter {
+	w := &rotatingLogWriter{
+		logger: &lumberjack.Logger{
+			Filename:   logConfig.FilePath,
+			MaxSize:    logConfig.MaxSizeMB,
+			MaxBackups: logConfig.MaxBackups,
+			MaxAge:     logConfig.MaxAgeDays,
+			LocalTime:  logConfig.LocalTime,
+			Compress:   logConfig.CompressBackups,
+		},
+		maxBytes: int64(logConfig.MaxSizeMB) * 1024 * 1024,
+		postCmd:  logConfig.RotatePostCmd,
+	}
+	if info, err := os.Stat(logConfig.FilePath); err == nil {
+		w.size = info.Size()
+	}
+	return w
+}
+
+// Close closes the log file.
+func (w *rotatingLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.logger.Close()
+}
+
+func (w *rotatingLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		w.rotate()
+	}
+
+	n, err := w.logger.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate starts a new log file and runs the post-rotation command for the backup it created.
+// The caller holds w.mu.
+func (w *rotatingLogWriter) rotate() {
+	var before map[string]struct{}
+	if w.postCmd != "" {
+		before = logBackups(w.logger.Filename)
+	}
+	if err := w.logger.Rotate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+		return
+	}
+	w.size = 0
+	if w.postCmd == "" {
+		return
+	}
+
+	// 轮转时同步重命名，新出现的备份即为本次轮转的文件
+	for name := range logBackups(w.logger.Filename) {
+		if _, ok := before[name]; !ok {
+			rotated := filepath.Join(filepath.Dir(w.logger.Filename), name)
+			go runPostRotateCommand(w.postCmd, rotated, w.logger.Compress)
+			return
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Log rotated, but the rotated file was not found; skipping LOG_ROTATE_POST_CMD")
+}
+
+// runPostRotateCommand runs the shell command with the path of the rotated file in $ROTATED_FILE.
+// When backups are compressed, it waits for the compressed file.
+func runPostRotateCommand(command, rotated string, compressed bool) {
+	if compressed {
+		deadline := time.Now().Add(rotatedFileCompressWait)
+		for time.Now().Before(deadline) {
+			if _, err := os.Stat(rotated + ".gz"); err == nil {
+				if _, err := os.Stat(rotated); os.IsNotExist(err) {
+					rotated += ".gz"
+					break
+				}
+			}
+			time.Sleep(rotatedFilePollInterval)
+		}
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "ROTATED_FILE="+rotated)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		logrus.WithFields(logrus.Fields{"file": rotated, "output": TruncateString(string(output), 1000)}).
+			WithError(err).Error("LOG_ROTATE_POST_CMD failed")
+		return
+	}
+	logrus.WithField("file", rotated).Debug("LOG_ROTATE_POST_CMD finished")
+}
+
+// logBackups returns the names of the backups of the log file, named name-<timestamp>.ext by
+// lumberjack, without the .gz suffix of compressed backups.
+func logBackups(filename string) map[string]struct{} {
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filepath.Base(filename), ext) + "-"
+	backups := make(map[string]struct{})
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		return backups
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".gz")
+		if !entry.IsDir() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ext) {
+			backups[name] = struct{}{}
+		}
+	}
+	return backups
+}
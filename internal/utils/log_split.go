@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// levelSplitHook writes each entry to the console, entries at or above the split level to
+// stderr and the others to stdout, so that process managers can alert on stderr.
+type levelSplitHook struct {
+	mu         sync.Mutex
+	splitLevel logrus.Level
+	stdout     io.Writer
+	stderr     io.Writer
+}
+
+func newLevelSplitHook(splitLevel logrus.Level, stdout, stderr io.Writer) *levelSplitHook {
+	return &levelSplitHook{splitLevel: splitLevel, stdout: stdout, stderr: stderr}
+}
+
+func (h *levelSplitHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *levelSplitHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	// logrus 中越严重的级别数值越小
+	out := h.stdout
+	if entry.Level <= h.splitLevel {
+		out = h.stderr
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = out.Write(line)
+	return err
+}
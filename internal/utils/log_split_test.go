@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLevelSplitHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		splitLevel logrus.Level
+		level      logrus.Level
+		wantStderr bool
+	}{
+		{name: "error above warn split", splitLevel: logrus.WarnLevel, level: logrus.ErrorLevel, wantStderr: true},
+		{name: "warn at warn split", splitLevel: logrus.WarnLevel, level: logrus.WarnLevel, wantStderr: true},
+		{name: "info below warn split", splitLevel: logrus.WarnLevel, level: logrus.InfoLevel, wantStderr: false},
+		{name: "debug below warn split", splitLevel: logrus.WarnLevel, level: logrus.DebugLevel, wantStderr: false},
+		{name: "warn below error split", splitLevel: logrus.ErrorLevel, level: logrus.WarnLevel, wantStderr: false},
+		{name: "info at info split", splitLevel: logrus.InfoLevel, level: logrus.InfoLevel, wantStderr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			logger := logrus.New()
+			logger.SetOutput(&bytes.Buffer{})
+			logger.SetLevel(logrus.TraceLevel)
+			logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+			logger.AddHook(newLevelSplitHook(tt.splitLevel, &stdout, &stderr))
+
+			logger.Log(tt.level, "split message")
+
+			wantOut, otherOut := &stdout, &stderr
+			if tt.wantStderr {
+				wantOut, otherOut = &stderr, &stdout
+			}
+			if !strings.Contains(wantOut.String(), "msg=\"split message\"") {
+				t.Errorf("entry not written to the expected stream: stdout=%q stderr=%q", stdout.String(), stderr.String())
+			}
+			if otherOut.Len() != 0 {
+				t.Errorf("entry also written to the other stream: %q", otherOut.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogFacilities maps the facility names accepted by LOG_SYSLOG_FACILITY to their facility codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// IsValidSyslogFacility reports whether name is a known syslog facility.
+func IsValidSyslogFacility(name string) bool {
+	_, ok := syslogFacilities[name]
+	return ok
+}
+
+// ParseSyslogAddr parses LOG_SYSLOG_ADDR into the network and address for dialing syslog.
+// "local" uses the local syslog daemon; otherwise the address is "udp://host:port",
+// "tcp://host:port", "unix:///dev/log" or a bare "host:port", which uses UDP.
+func ParseSyslogAddr(addr string) (network, raddr string, err error) {
+	if addr == "local" {
+		return "", "", nil
+	}
+	if !strings.Contains(addr, "://") {
+		if addr == "" {
+			return "", "", fmt.Errorf("empty syslog address")
+		}
+		return "udp", addr, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("missing host in syslog address %q", addr)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("missing socket path in syslog address %q", addr)
+		}
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("unsupported syslog network %q", u.Scheme)
+	}
+}
+
+// setupSyslog adds the syslog hook and returns its connection. When syslog can't be reached,
+// the existing output is kept.
+func setupSyslog(logConfig types.LogConfig) io.Closer {
+	hook, closer, err := newSyslogHook(logConfig)
+	if err != nil {
+		logrus.Warnf("Failed to connect to syslog at %s, keeping the console/file log output: %v", logConfig.SyslogAddr, err)
+		return nil
+	}
+	logrus.AddHook(hook)
+
+	// 仅输出到 syslog 时丢弃控制台和文件输出
+	if logConfig.SyslogOnly {
+		logrus.SetOutput(io.Discard)
+	}
+	return closer
+}
@@ -0,0 +1,18 @@
+//go:build windows || plan9
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newSyslogHook reports that syslog is not available on this platform.
+func newSyslogHook(types.LogConfig) (logrus.Hook, io.Closer, error) {
+	return nil, nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
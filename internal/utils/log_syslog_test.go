@@ -0,0 +1,123 @@
+//go:build !windows && !plan9
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	logrus_syslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// stubLogConfigManager returns a fixed log configuration. Other methods are not implemented
+// and panic when called.
+type stubLogConfigManager struct {
+	types.ConfigManager
+	log types.LogConfig
+}
+
+func (m *stubLogConfigManager) GetLogConfig() types.LogConfig { return m.log }
+
+// hasSyslogHook reports whether the standard logger sends entries of level to syslog.
+func hasSyslogHook(level logrus.Level) bool {
+	for _, hook := range logrus.StandardLogger().Hooks[level] {
+		if _, ok := hook.(*logrus_syslog.SyslogHook); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetupLoggerSyslog(t *testing.T) {
+	// 本地 UDP 监听代替系统 syslog
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	t.Setenv("SILENT_MODE", "false")
+	t.Cleanup(func() {
+		SetupLogger(&stubLogConfigManager{log: types.LogConfig{Level: "info"}})
+	})
+
+	tests := []struct {
+		name       string
+		addr       string
+		syslogOnly bool
+		wantHook   bool
+	}{
+		{name: "udp address", addr: "udp://" + listener.LocalAddr().String(), wantHook: true},
+		{name: "bare address uses udp", addr: listener.LocalAddr().String(), wantHook: true},
+		{name: "syslog only", addr: "udp://" + listener.LocalAddr().String(), syslogOnly: true, wantHook: true},
+		{name: "unreachable", addr: "tcp://127.0.0.1:1", wantHook: false},
+		{name: "invalid address", addr: "http://127.0.0.1:514", wantHook: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetupLogger(&stubLogConfigManager{log: types.LogConfig{
+				Level:          "info",
+				SyslogAddr:     tt.addr,
+				SyslogFacility: "local3",
+				SyslogTag:      "gpt-load-test",
+				SyslogOnly:     tt.syslogOnly,
+			}})
+
+			if got := hasSyslogHook(logrus.InfoLevel); got != tt.wantHook {
+				t.Fatalf("syslog hook registered = %v, want %v", got, tt.wantHook)
+			}
+			if !tt.wantHook {
+				if logrus.StandardLogger().Out == io.Discard {
+					t.Error("console output discarded without a syslog connection")
+				}
+				return
+			}
+			if discarded := logrus.StandardLogger().Out == io.Discard; discarded != tt.syslogOnly {
+				t.Errorf("console output discarded = %v, want %v", discarded, tt.syslogOnly)
+			}
+
+			message := fmt.Sprintf("syslog message %d", time.Now().UnixNano())
+			logrus.Info(message)
+
+			buf := make([]byte, 4096)
+			for {
+				listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := listener.ReadFrom(buf)
+				if err != nil {
+					t.Fatalf("no syslog message received: %v", err)
+				}
+				packet := string(buf[:n])
+				if !strings.Contains(packet, message) {
+					continue
+				}
+				// local3 (19) * 8 + info (6)
+				if !strings.HasPrefix(packet, "<158>") {
+					t.Errorf("priority of %q, want <158> for local3.info", packet)
+				}
+				if !strings.Contains(packet, "gpt-load-test[") {
+					t.Errorf("tag missing from %q", packet)
+				}
+				break
+			}
+		})
+	}
+}
+
+func TestSetupLoggerWithoutSyslog(t *testing.T) {
+	t.Setenv("SILENT_MODE", "false")
+	SetupLogger(&stubLogConfigManager{log: types.LogConfig{Level: "info"}})
+
+	for _, level := range logrus.AllLevels {
+		if hasSyslogHook(level) {
+			t.Errorf("syslog hook registered for %s without LOG_SYSLOG_ADDR", level)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows && !plan9
+
+package utils
+
+import (
+	"io"
+	"log/syslog"
+
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	logrus_syslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// newSyslogHook dials syslog with the configured facility and tag. The closer closes the connection.
+func newSyslogHook(logConfig types.LogConfig) (logrus.Hook, io.Closer, error) {
+	network, raddr, err := ParseSyslogAddr(logConfig.SyslogAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	priority := syslog.Priority(syslogFacilities[logConfig.SyslogFacility]<<3) | syslog.LOG_INFO
+	hook, err := logrus_syslog.NewSyslogHook(network, raddr, priority, logConfig.SyslogTag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hook, hook.Writer, nil
+}
@@ -5,14 +5,37 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
-// SetupLogger configures the logging system based on the provided configuration.
+// loggerOutputs 是当前日志配置打开的日志文件和 syslog 连接，重新配置时替换后关闭
+var loggerOutputs struct {
+	sync.Mutex
+	closers []io.Closer
+}
+
+// SetupLogger configures the logging system based on the provided configuration. It can be
+// called again after a configuration reload; the previous log file and syslog connection
+// are closed.
 func SetupLogger(configManager types.ConfigManager) {
 	logConfig := configManager.GetLogConfig()
 
+	loggerOutputs.Lock()
+	defer loggerOutputs.Unlock()
+	var closers []io.Closer
+	// 启动阶段的日志在配置完成后写入日志文件
+	var fileWriter io.Writer
+	defer func() { handOffBootstrapLog(fileWriter) }()
+	defer func() {
+		for _, closer := range loggerOutputs.closers {
+			closer.Close()
+		}
+		loggerOutputs.closers = closers
+	}()
+	logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
 	// Set log level
 	level, err := logrus.ParseLevel(logConfig.Level)
 	if err != nil {
@@ -21,16 +44,11 @@ func SetupLogger(configManager types.ConfigManager) {
 	logrus.SetLevel(level)
 
 	// Set log format
-	if logConfig.Format == "json" {
-		logrus.SetFormatter(&logrus.JSONFormatter{
-			TimestampFormat: "2006-01-02T15:04:05.000Z07:00", // ISO 8601 format
-		})
-	} else {
-		logrus.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp:   true,
-			TimestampFormat: "2006-01-02 15:04:05",
-		})
-	}
+	logrus.SetFormatter(logFormatter(logConfig.Format))
+
+	// 设置 LOG_SPLIT_LEVEL 时控制台输出由 hook 按级别分到 stdout 和 stderr，静默模式下同样输出，文件仍接收所有级别
+	splitLevel, splitErr := logrus.ParseLevel(logConfig.SplitLevel)
+	split := logConfig.SplitLevel != "" && splitErr == nil
 
 	// 检查是否启用了静默模式
 	if os.Getenv("SILENT_MODE") == "true" {
@@ -40,13 +58,11 @@ func SetupLogger(configManager types.ConfigManager) {
 			if err := os.MkdirAll(logDir, 0755); err != nil {
 				// 不输出警告日志
 			} else {
-				logFile, err := os.OpenFile(logConfig.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-				if err != nil {
-					// 不输出警告日志
-				} else {
-					// 只输出到文件，不输出到控制台
-					logrus.SetOutput(logFile)
-				}
+				// 只输出到文件，不输出到控制台
+				writer := newRotatingLogWriter(logConfig)
+				logrus.SetOutput(writer)
+				closers = append(closers, writer)
+				fileWriter = writer
 			}
 		} else {
 			// 如果没有启用文件日志，则完全禁用日志输出
@@ -59,13 +75,44 @@ func SetupLogger(configManager types.ConfigManager) {
 			if err := os.MkdirAll(logDir, 0755); err != nil {
 				logrus.Warnf("Failed to create log directory: %v", err)
 			} else {
-				logFile, err := os.OpenFile(logConfig.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-				if err != nil {
-					logrus.Warnf("Failed to open log file: %v", err)
+				writer := newRotatingLogWriter(logConfig)
+				if split {
+					logrus.SetOutput(writer)
 				} else {
-					logrus.SetOutput(io.MultiWriter(os.Stdout, logFile))
+					logrus.SetOutput(io.MultiWriter(os.Stdout, writer))
 				}
+				closers = append(closers, writer)
+				fileWriter = writer
 			}
+		} else if split {
+			logrus.SetOutput(io.Discard)
+		} else {
+			logrus.SetOutput(os.Stderr)
 		}
 	}
+
+	syslogOnly := false
+	if logConfig.SyslogAddr != "" {
+		if closer := setupSyslog(logConfig); closer != nil {
+			closers = append(closers, closer)
+			syslogOnly = logConfig.SyslogOnly
+		}
+	}
+
+	if split && !syslogOnly {
+		logrus.AddHook(newLevelSplitHook(splitLevel, os.Stdout, os.Stderr))
+	}
+}
+
+// logFormatter returns the formatter for LOG_FORMAT: json, or text for anything else.
+func logFormatter(format string) logrus.Formatter {
+	if format == "json" {
+		return &logrus.JSONFormatter{
+			TimestampFormat: "2006-01-02T15:04:05.000Z07:00", // ISO 8601 format
+		}
+	}
+	return &logrus.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: "2006-01-02 15:04:05",
+	}
 }
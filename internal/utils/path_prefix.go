@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReservedPathPrefixes are the prefixes of the built-in routes. They cannot be used as path
+// prefix routes, and requests under them are never routed to the default group.
+var ReservedPathPrefixes = []string{"/api", "/proxy", "/v1", "/health", "/livez", "/readyz", "/metrics", "/debug"}
+
+// ParsePathPrefixRoutes parses a comma-separated list of prefix:group entries, e.g.
+// "/openai:group-a,/anthropic:group-b", into a map from the normalized prefix to the group name.
+func ParsePathPrefixRoutes(value string) (map[string]string, error) {
+	entries, err := StringToMap(value, ",", ":")
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]string, len(entries))
+	for prefix, group := range entries {
+		normalized := "/" + strings.Trim(prefix, "/")
+		if normalized == "/" || strings.ContainsAny(normalized, " ?#*") {
+			return nil, fmt.Errorf("invalid path prefix %q", prefix)
+		}
+		if IsReservedPath(normalized) {
+			return nil, fmt.Errorf("path prefix %q conflicts with a built-in route", prefix)
+		}
+		if _, exists := routes[normalized]; exists {
+			return nil, fmt.Errorf("duplicate path prefix %q", normalized)
+		}
+		routes[normalized] = group
+	}
+	return routes, nil
+}
+
+// IsReservedPath reports whether path is under one of the ReservedPathPrefixes.
+func IsReservedPath(path string) bool {
+	for _, prefix := range ReservedPathPrefixes {
+		if HasPathPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPathPrefix reports whether path equals prefix or is below it, matching whole segments only.
+func HasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// MatchPathPrefix returns the group of the longest prefix in routes that path is under,
+// and the rest of the path with the prefix stripped.
+func MatchPathPrefix(routes map[string]string, path string) (group, rest string, ok bool) {
+	matched := ""
+	for prefix := range routes {
+		if len(prefix) > len(matched) && HasPathPrefix(path, prefix) {
+			matched = prefix
+		}
+	}
+	if matched == "" {
+		return "", "", false
+	}
+	return routes[matched], strings.TrimPrefix(path, matched), true
+}
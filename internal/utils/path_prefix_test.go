@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathPrefixRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: map[string]string{}},
+		{name: "routes", value: "/openai:group-a,/anthropic:group-b", want: map[string]string{"/openai": "group-a", "/anthropic": "group-b"}},
+		{name: "slashes normalized", value: "openai/:group-a,/team/gemini/:group-b", want: map[string]string{"/openai": "group-a", "/team/gemini": "group-b"}},
+		{name: "root prefix", value: "/:group-a", wantErr: true},
+		{name: "prefix with space", value: "/open ai:group-a", wantErr: true},
+		{name: "prefix with wildcard", value: "/openai*:group-a", wantErr: true},
+		{name: "built-in route", value: "/api:group-a", wantErr: true},
+		{name: "below built-in route", value: "/v1/openai:group-a", wantErr: true},
+		{name: "duplicate after normalization", value: "/openai:group-a,openai/:group-b", wantErr: true},
+		{name: "missing group", value: "/openai", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePathPrefixRoutes(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePathPrefixRoutes(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePathPrefixRoutes(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReservedPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/api", want: true},
+		{path: "/api/groups", want: true},
+		{path: "/proxy/openai/v1/models", want: true},
+		{path: "/v1/chat/completions", want: true},
+		{path: "/health", want: true},
+		{path: "/apis", want: false},
+		{path: "/openai/v1/chat/completions", want: false},
+		{path: "/", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := IsReservedPath(tt.path); got != tt.want {
+				t.Errorf("IsReservedPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPathPrefix(t *testing.T) {
+	routes := map[string]string{"/openai": "group-a", "/openai/beta": "group-b", "/anthropic": "group-c"}
+	tests := []struct {
+		path      string
+		wantGroup string
+		wantRest  string
+		wantOK    bool
+	}{
+		{path: "/openai/v1/chat/completions", wantGroup: "group-a", wantRest: "/v1/chat/completions", wantOK: true},
+		{path: "/openai", wantGroup: "group-a", wantRest: "", wantOK: true},
+		{path: "/openai/beta/v1/models", wantGroup: "group-b", wantRest: "/v1/models", wantOK: true},
+		{path: "/openai/betas/v1/models", wantGroup: "group-a", wantRest: "/betas/v1/models", wantOK: true},
+		{path: "/anthropic/v1/messages", wantGroup: "group-c", wantRest: "/v1/messages", wantOK: true},
+		{path: "/openaix/v1/models", wantOK: false},
+		{path: "/gemini/v1beta/models", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			group, rest, ok := MatchPathPrefix(routes, tt.path)
+			if ok != tt.wantOK || group != tt.wantGroup || rest != tt.wantRest {
+				t.Errorf("MatchPathPrefix(%q) = (%q, %q, %v), want (%q, %q, %v)", tt.path, group, rest, ok, tt.wantGroup, tt.wantRest, tt.wantOK)
+			}
+		})
+	}
+}
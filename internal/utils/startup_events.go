@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// 启动失败事件中的错误代码，供编排工具识别
+const (
+	StartupErrInvalidConfig = "invalid_config"
+	StartupErrDBUnreachable = "db_unreachable"
+	StartupErrPortInUse     = "port_in_use"
+	StartupErrListenFailed  = "listen_failed"
+	StartupErrFailed        = "startup_failed"
+)
+
+// StartupError is a startup failure tagged with a stable error code.
+type StartupError struct {
+	Code string
+	Err  error
+}
+
+func (e *StartupError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// NewStartupError tags err with a startup error code.
+func NewStartupError(code string, err error) error {
+	return &StartupError{Code: code, Err: err}
+}
+
+// StartupErrorCode returns the code of the StartupError in err's chain, or fallback if there is none.
+func StartupErrorCode(err error, fallback string) string {
+	var startupErr *StartupError
+	if errors.As(err, &startupErr) {
+		return startupErr.Code
+	}
+	return fallback
+}
+
+// StartupEventsJSON reports whether lifecycle events are emitted as JSON (STARTUP_EVENTS=json).
+// 启动事件可能早于配置加载，因此直接读取环境变量
+func StartupEventsJSON() bool {
+	return strings.EqualFold(os.Getenv("STARTUP_EVENTS"), "json")
+}
+
+// EmitStartupEvent writes a lifecycle event as a single JSON line to stderr when
+// STARTUP_EVENTS=json, and does nothing otherwise.
+func EmitStartupEvent(event string, fields map[string]any) {
+	if !StartupEventsJSON() {
+		return
+	}
+
+	payload := make(map[string]any, len(fields)+2)
+	for key, value := range fields {
+		payload[key] = value
+	}
+	payload["event"] = event
+	payload["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	line, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	os.Stderr.Write(append(line, '\n'))
+}
+
+// EmitStartupError writes an error event carrying code and the error message.
+func EmitStartupError(code string, err error) {
+	EmitStartupEvent("error", map[string]any{"code": code, "message": err.Error()})
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"strings"
 )
@@ -14,6 +17,53 @@ func MaskAPIKey(key string) string {
 	return fmt.Sprintf("%s****%s", key[:4], key[length-4:])
 }
 
+// RedactAPIKey masks an API key like MaskAPIKey, but also hides keys too short to keep a
+// prefix and suffix, for values that are stored or sent outside the process.
+// 已经脱敏的值再次脱敏结果不变
+func RedactAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "****"
+	}
+	return MaskAPIKey(key)
+}
+
+// MatchesAnyKey reports whether key equals one of keys. Every key is compared in constant time,
+// so the timing does not reveal which key matched.
+func MatchesAnyKey(key string, keys []string) bool {
+	if key == "" {
+		return false
+	}
+	matched := 0
+	for _, k := range keys {
+		matched |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+	}
+	return matched == 1
+}
+
+// MatchesAnyKeyInSet is MatchesAnyKey over the keys of one or more sets, such as parsed proxy
+// key lists. Every key of every set is compared, so the timing reveals neither the key nor the set.
+func MatchesAnyKeyInSet(key string, sets ...map[string]struct{}) bool {
+	if key == "" {
+		return false
+	}
+	matched := 0
+	for _, set := range sets {
+		for k := range set {
+			matched |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+		}
+	}
+	return matched == 1
+}
+
+// SHA256Hex returns the hex-encoded SHA-256 digest of data.
+func SHA256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // TruncateString shortens a string to a maximum length.
 func TruncateString(s string, maxLength int) string {
 	if len(s) > maxLength {
@@ -54,3 +104,22 @@ func StringToSet(s string, sep string) map[string]struct{} {
 	}
 	return set
 }
+
+// StringToMap converts a separator-delimited list of key/value pairs into a map.
+// Each pair is split at the last kvSep, so keys may themselves contain kvSep.
+func StringToMap(s string, sep string, kvSep string) (map[string]string, error) {
+	parts := SplitAndTrim(s, sep)
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(parts))
+	for _, part := range parts {
+		idx := strings.LastIndex(part, kvSep)
+		if idx <= 0 || idx == len(part)-len(kvSep) {
+			return nil, fmt.Errorf("invalid entry %q, expected key%svalue", part, kvSep)
+		}
+		result[strings.TrimSpace(part[:idx])] = strings.TrimSpace(part[idx+len(kvSep):])
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactAPIKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{name: "empty", key: "", want: ""},
+		{name: "short key is fully hidden", key: "abc", want: "****"},
+		{name: "eight characters is fully hidden", key: "abcdefgh", want: "****"},
+		{name: "long key keeps prefix and suffix", key: "sk-abcdefghijklmnop", want: "sk-a****mnop"},
+		{name: "masked value is unchanged", key: "sk-a****mnop", want: "sk-a****mnop"},
+		{name: "fully hidden value is unchanged", key: "****", want: "****"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactAPIKey(tt.key); got != tt.want {
+				t.Errorf("RedactAPIKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringToMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "blank entries only", input: " , ", want: nil},
+		{name: "single pair", input: "sk-a:openai", want: map[string]string{"sk-a": "openai"}},
+		{name: "pairs trimmed", input: " sk-a : openai , sk-b:gemini ", want: map[string]string{"sk-a": "openai", "sk-b": "gemini"}},
+		{name: "key containing separator", input: "sk:a:b:openai", want: map[string]string{"sk:a:b": "openai"}},
+		{name: "later entry wins", input: "sk-a:openai,sk-a:gemini", want: map[string]string{"sk-a": "gemini"}},
+		{name: "missing separator", input: "sk-a", wantErr: true},
+		{name: "missing key", input: ":openai", wantErr: true},
+		{name: "missing value", input: "sk-a:", wantErr: true},
+		{name: "one invalid entry", input: "sk-a:openai,sk-b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StringToMap(tt.input, ",", ":")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("StringToMap(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StringToMap(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAnyKey(t *testing.T) {
+	keys := []string{"sk-admin-old", "sk-admin-new"}
+	tests := []struct {
+		name string
+		key  string
+		keys []string
+		want bool
+	}{
+		{name: "first key", key: "sk-admin-old", keys: keys, want: true},
+		{name: "last key", key: "sk-admin-new", keys: keys, want: true},
+		{name: "unknown key", key: "sk-admin-other", keys: keys, want: false},
+		{name: "prefix of a key", key: "sk-admin", keys: keys, want: false},
+		{name: "key with suffix", key: "sk-admin-new2", keys: keys, want: false},
+		{name: "empty key", key: "", keys: keys, want: false},
+		{name: "empty key against empty entry", key: "", keys: []string{""}, want: false},
+		{name: "no keys", key: "sk-admin-new", keys: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesAnyKey(tt.key, tt.keys); got != tt.want {
+				t.Errorf("MatchesAnyKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAnyKeyInSet(t *testing.T) {
+	global := StringToSet("sk-global-a,sk-global-b", ",")
+	group := StringToSet("sk-group", ",")
+	tests := []struct {
+		name string
+		key  string
+		sets []map[string]struct{}
+		want bool
+	}{
+		{name: "global key", key: "sk-global-b", sets: []map[string]struct{}{global, group}, want: true},
+		{name: "group key", key: "sk-group", sets: []map[string]struct{}{global, group}, want: true},
+		{name: "unknown key", key: "sk-other", sets: []map[string]struct{}{global, group}, want: false},
+		{name: "prefix of a key", key: "sk-global", sets: []map[string]struct{}{global, group}, want: false},
+		{name: "empty key", key: "", sets: []map[string]struct{}{global, group}, want: false},
+		{name: "nil set skipped", key: "sk-group", sets: []map[string]struct{}{nil, group}, want: true},
+		{name: "no sets", key: "sk-group", sets: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesAnyKeyInSet(tt.key, tt.sets...); got != tt.want {
+				t.Errorf("MatchesAnyKeyInSet(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
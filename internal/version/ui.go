@@ -0,0 +1,24 @@
+package version
+
+import (
+	"regexp"
+	"strings"
+)
+
+// uiVersionPattern matches the version meta tag that the UI build writes into index.html.
+var uiVersionPattern = regexp.MustCompile(`<meta\s+name="gpt-load-version"\s+content="([^"]*)"`)
+
+// UIVersion returns the version the embedded UI was built with, or "" when it was built
+// without VITE_VERSION and so carries no version.
+func UIVersion(indexPage []byte) string {
+	match := uiVersionPattern.FindSubmatch(indexPage)
+	if match == nil {
+		return ""
+	}
+	value := strings.TrimSpace(string(match[1]))
+	// 未设置 VITE_VERSION 时 Vite 保留占位符原样输出
+	if strings.Contains(value, "%") {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,27 @@
+package version
+
+import "testing"
+
+func TestUIVersion(t *testing.T) {
+	tests := []struct {
+		name      string
+		indexPage string
+		want      string
+	}{
+		{name: "built with version", indexPage: `<head><meta name="gpt-load-version" content="1.2.3" /></head>`, want: "1.2.3"},
+		{name: "surrounding spaces", indexPage: `<meta name="gpt-load-version" content=" 1.2.3 ">`, want: "1.2.3"},
+		{name: "attributes across lines", indexPage: "<meta\n    name=\"gpt-load-version\"\n    content=\"1.2.3\">", want: "1.2.3"},
+		{name: "placeholder left by vite", indexPage: `<meta name="gpt-load-version" content="%VITE_VERSION%" />`, want: ""},
+		{name: "empty content", indexPage: `<meta name="gpt-load-version" content="" />`, want: ""},
+		{name: "no meta tag", indexPage: `<head><title>GPT-Load</title></head>`, want: ""},
+		{name: "other meta tag", indexPage: `<meta name="version" content="1.2.3" />`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UIVersion([]byte(tt.indexPage)); got != tt.want {
+				t.Errorf("UIVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
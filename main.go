@@ -4,16 +4,22 @@ package main
 import (
 	"context"
 	"embed"
+	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"gpt-load/internal/app"
+	"gpt-load/internal/config"
 	"gpt-load/internal/container"
 	"gpt-load/internal/types"
 	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
 )
 
 //go:embed web/dist
@@ -23,49 +29,60 @@ var buildFS embed.FS
 var indexPage []byte
 
 func main() {
+	initEnv := flag.Bool("init", false, "生成 .env 配置文件后退出，标准输入不是终端时使用默认值")
+	flag.Parse()
+	if *initEnv {
+		if err := config.InitEnvFile(".env"); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create .env: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("已创建.env文件")
+		return
+	}
+
 	// 设置静默模式，禁用项目日志输出到控制台
 	os.Setenv("SILENT_MODE", "true")
 
+	// 配置加载前的日志（包括配置校验失败）由启动日志记录到 stderr，SetupLogger 后交给配置的日志
+	utils.SetupBootstrapLogger()
+
 	// Build the dependency injection container
 	container, err := container.BuildContainer()
 	if err != nil {
-		// 在静默模式下，只输出关键错误信息
-		fmt.Fprintf(os.Stderr, "Failed to build container: %v\n", err)
-		os.Exit(1)
+		exitWithStartupError("Failed to build container", utils.StartupErrFailed, err)
 	}
 
 	// Provide UI assets to the container
 	if err := container.Provide(func() embed.FS { return buildFS }); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to provide buildFS: %v\n", err)
-		os.Exit(1)
+		exitWithStartupError("Failed to provide buildFS", utils.StartupErrFailed, err)
 	}
 	if err := container.Provide(func() []byte { return indexPage }); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to provide indexPage: %v\n", err)
-		os.Exit(1)
+		exitWithStartupError("Failed to provide indexPage", utils.StartupErrFailed, err)
 	}
 
 	// Initialize global logger
 	if err := container.Invoke(func(configManager types.ConfigManager) {
 		utils.SetupLogger(configManager)
 	}); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to setup logger: %v\n", err)
-		os.Exit(1)
+		exitWithStartupError("Failed to setup logger", utils.StartupErrInvalidConfig, err)
 	}
+	utils.EmitStartupEvent("config_loaded", nil)
 
 	// Create and run the application
 	if err := container.Invoke(func(application *app.App, configManager types.ConfigManager) {
 		if err := application.Start(); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to start application: %v\n", err)
-			os.Exit(1)
+			exitWithStartupError("Failed to start application", utils.StartupErrFailed, err)
 		}
+		utils.EmitStartupEvent("ready", map[string]any{"addr": application.ListenAddr()})
 
-		// 显示启动成功信息
+		// 显示启动成功信息，端口取实际监听的端口（PORT=0 时由系统分配）
 		serverConfig := configManager.GetEffectiveServerConfig()
+		_, port, _ := net.SplitHostPort(application.ListenAddr())
 		// 当host为0.0.0.0，显示为localhost
 		if serverConfig.Host == "0.0.0.0" {
 			serverConfig.Host = "localhost"
 		}
-		fmt.Printf("项目已正常启动在 http://%s:%d\n", serverConfig.Host, serverConfig.Port)
+		fmt.Printf("项目已正常启动在 http://%s\n", net.JoinHostPort(serverConfig.Host, port))
 		fmt.Printf("关闭命令行，程序将会被关闭")
 
 		// Wait for interrupt signal for graceful shutdown
@@ -81,7 +98,21 @@ func main() {
 		application.Stop(shutdownCtx)
 
 	}); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to run application: %v\n", err)
-		os.Exit(1)
+		exitWithStartupError("Failed to run application", utils.StartupErrFailed, err)
+	}
+}
+
+// exitWithStartupError reports a startup failure and exits. With STARTUP_EVENTS=json it is
+// reported as an error event whose code comes from the root cause, or fallbackCode. Before the
+// configured logger takes over it is logged through the bootstrap logger.
+func exitWithStartupError(message, fallbackCode string, err error) {
+	if utils.StartupEventsJSON() {
+		rootErr := dig.RootCause(err)
+		utils.EmitStartupError(utils.StartupErrorCode(rootErr, fallbackCode), rootErr)
+	} else if utils.BootstrapLoggerActive() {
+		logrus.Errorf("%s: %v", message, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", message, err)
 	}
+	os.Exit(1)
 }
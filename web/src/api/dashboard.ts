@@ -1,4 +1,4 @@
-import type { ChartData, DashboardStatsResponse, Group } from "@/types/models";
+import type { ChartData, DashboardStatsResponse, Group, ResponseSizeReport } from "@/types/models";
 import http from "@/utils/http";
 
 /**
@@ -18,6 +18,13 @@ export const getDashboardChart = (groupId?: number) => {
   });
 };
 
+/**
+ * 获取各模型的响应体大小统计
+ */
+export const getResponseSizes = () => {
+  return http.get<ResponseSizeReport>("/dashboard/response-sizes");
+};
+
 /**
  * 获取用于筛选的分组列表
  */
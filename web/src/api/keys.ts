@@ -3,6 +3,7 @@ import type {
   Group,
   GroupConfigOption,
   GroupStatsResponse,
+  GroupValidationResponse,
   KeyStatus,
   TaskInfo,
 } from "@/types/models";
@@ -27,9 +28,23 @@ export const keysApi = {
     return res.data;
   },
 
+  // 校验分组的部分或全部字段，不保存
+  async validateGroup(group: Record<string, unknown>, groupId?: number): Promise<GroupValidationResponse> {
+    const res = await http.post("/groups/validate", group, {
+      params: groupId ? { id: groupId } : undefined,
+      hideMessage: true,
+    });
+    return res.data;
+  },
+
   // 删除分组
-  deleteGroup(groupId: number): Promise<void> {
-    return http.delete(`/groups/${groupId}`);
+  deleteGroup(groupId: number, force = false): Promise<void> {
+    return http.delete(`/groups/${groupId}`, { params: force ? { force: true } : undefined });
+  },
+
+  // 取消分组的定时删除
+  cancelGroupDeletion(groupId: number): Promise<void> {
+    return http.delete(`/groups/${groupId}/scheduled-deletion`);
   },
 
   // 获取分组统计信息
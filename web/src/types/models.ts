@@ -6,7 +6,7 @@ export interface ApiResponse<T> {
 }
 
 // 密钥状态
-export type KeyStatus = "active" | "invalid" | undefined;
+export type KeyStatus = "active" | "invalid" | "suspect" | "standby" | undefined;
 
 // 数据模型定义
 export interface APIKey {
@@ -19,6 +19,19 @@ export interface APIKey {
   last_used_at?: string;
   created_at: string;
   updated_at: string;
+  false_alarm_count: number;
+  last_probe_result?: "passed" | "failed" | "";
+  last_probe_at?: string;
+  quota_precheck_endpoint?: string;
+  quota_precheck_min_balance?: number;
+  model_affinity?: string[] | null;
+  expires_at?: string | null;
+  auto_extended_at?: string | null;
+  weight?: number;
+  standby_only?: boolean;
+  last_checked_at?: string | null;
+  last_check_error?: string;
+  health_check_failures?: number;
 }
 
 // 类型别名，用于兼容
@@ -35,6 +48,14 @@ export interface HeaderRule {
   action: "set" | "remove";
 }
 
+export interface ValidationProbe {
+  method: "GET" | "POST" | "PUT" | "HEAD";
+  path: string;
+  body_template?: string;
+  expected_statuses: number[];
+  response_json_path?: string;
+}
+
 export interface Group {
   id?: number;
   name: string;
@@ -42,19 +63,35 @@ export interface Group {
   description: string;
   sort: number;
   test_model: string;
-  channel_type: "openai" | "gemini" | "anthropic";
+  channel_type: "openai" | "gemini" | "anthropic" | "azure-openai";
   upstreams: UpstreamInfo[];
   validation_endpoint: string;
+  validation_probe?: ValidationProbe | null;
   config: Record<string, unknown>;
   api_keys?: APIKey[];
   endpoint?: string;
   param_overrides: Record<string, unknown>;
   header_rules?: HeaderRule[];
   proxy_keys: string;
+  key_sync_source?: string;
+  keepalive_timeout_seconds?: number | null;
+  delete_after?: string | null;
   created_at?: string;
   updated_at?: string;
 }
 
+// 分组校验结果，error 会导致保存失败，warning 仅作提示
+export interface GroupValidationResult {
+  path: string;
+  severity: "error" | "warning";
+  message: string;
+}
+
+export interface GroupValidationResponse {
+  valid: boolean;
+  results: GroupValidationResult[];
+}
+
 export interface GroupConfigOption {
   key: string;
   name: string;
@@ -75,6 +112,8 @@ export interface KeyStats {
   total_keys: number;
   active_keys: number;
   invalid_keys: number;
+  suspect_keys: number;
+  false_alarms: number;
 }
 
 // RequestStats defines the statistics for requests over a period.
@@ -84,7 +123,7 @@ export interface RequestStats {
   failure_rate: number;
 }
 
-export type TaskType = "KEY_VALIDATION" | "KEY_IMPORT" | "KEY_DELETE";
+export type TaskType = "KEY_VALIDATION" | "KEY_IMPORT" | "KEY_DELETE" | "STATS_BACKFILL";
 
 export interface KeyValidationResult {
   invalid_keys: number;
@@ -102,6 +141,12 @@ export interface KeyDeleteResult {
   ignored_count: number;
 }
 
+export interface StatsBackfillResult {
+  hours: number;
+  rows_scanned: number;
+  updated_rows: number;
+}
+
 export interface TaskInfo {
   task_type: TaskType;
   is_running: boolean;
@@ -110,7 +155,8 @@ export interface TaskInfo {
   total?: number;
   started_at?: string;
   finished_at?: string;
-  result?: KeyValidationResult | KeyImportResult | KeyDeleteResult;
+  estimated_finish_at?: string;
+  result?: KeyValidationResult | KeyImportResult | KeyDeleteResult | StatsBackfillResult;
   error?: string;
 }
 
@@ -127,11 +173,16 @@ export interface RequestLog {
   duration_ms: number;
   error_message: string;
   user_agent: string;
-  request_type: "retry" | "final";
+  request_type: "retry" | "final" | "client_deadline_exceeded";
   group_name?: string;
   key_value?: string;
   model: string;
   upstream_addr: string;
+  upstream_request_id: string;
+  request_body_hash?: string;
+  key_hash?: string;
+  request_bytes?: number;
+  response_bytes?: number;
   is_stream: boolean;
   request_body?: string;
 }
@@ -160,7 +211,7 @@ export interface LogFilter {
   error_contains?: string;
   start_time?: string | null;
   end_time?: string | null;
-  request_type?: "retry" | "final";
+  request_type?: "retry" | "final" | "client_deadline_exceeded";
 }
 
 export interface DashboardStats {
@@ -190,6 +241,32 @@ export interface DashboardStatsResponse {
   rpm: StatCard;
   request_count: StatCard;
   error_rate: StatCard;
+  client_quotas?: ClientQuotaStat[];
+}
+
+// 客户端代理密钥本月的请求额度
+export interface ClientQuotaStat {
+  client: string;
+  fingerprint: string;
+  used: number;
+  limit: number;
+  remaining: number;
+  reset_at: string;
+}
+
+// 各模型上游响应体大小相对缓冲阈值的统计
+export interface ModelResponseSize {
+  model: string;
+  responses: number;
+  over_threshold: number;
+  over_threshold_ratio: number;
+  suggest_raise: boolean;
+  suggested_threshold_bytes?: number;
+}
+
+export interface ResponseSizeReport {
+  threshold_bytes: number;
+  models: ModelResponseSize[];
 }
 
 // 图表数据集
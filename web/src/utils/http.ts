@@ -17,6 +17,22 @@ const http = axios.create({
   headers: { "Content-Type": "application/json" },
 });
 
+// 前端与后端版本不一致时只提示一次
+let uiVersionWarned = false;
+
+function warnUIVersionMismatch(headers: Record<string, unknown> | undefined) {
+  const mismatch = headers?.["x-gpt-load-ui-version-mismatch"];
+  if (uiVersionWarned || !mismatch) {
+    return;
+  }
+  uiVersionWarned = true;
+  window.$message.warning(`前端构建版本与后端不一致 (${mismatch})，请重新构建 web/dist`, {
+    keepAliveOnHover: true,
+    duration: 0,
+    closable: true,
+  });
+}
+
 // 请求拦截器
 http.interceptors.request.use(config => {
   // 检查当前请求的 URL 是否在屏蔽列表中
@@ -34,6 +50,7 @@ http.interceptors.request.use(config => {
 http.interceptors.response.use(
   response => {
     appState.loading = false;
+    warnUIVersionMismatch(response.headers);
     if (response.config.method !== "get" && !response.config.hideMessage) {
       window.$message.success(response.data.message ?? "操作成功");
     }